@@ -0,0 +1,37 @@
+// Command mockoidc runs a local OpenID Connect provider for developing the
+// SSO login without a real identity provider. Every login is approved
+// immediately as the user given by the flags.
+package main
+
+import (
+	"flag"
+	"log"
+	"net/http"
+
+	"github.com/vedran77/pulse/internal/oidc/oidctest"
+)
+
+func main() {
+	addr := flag.String("addr", ":9000", "listen address")
+	issuer := flag.String("issuer", "http://localhost:9000", "issuer URL (must match OIDC_ISSUER)")
+	clientID := flag.String("client-id", "pulse", "accepted client ID")
+	subject := flag.String("sub", "mock-user-1", "subject of the signed-in user")
+	email := flag.String("email", "sso.user@example.com", "email of the signed-in user")
+	name := flag.String("name", "SSO User", "display name of the signed-in user")
+	username := flag.String("username", "sso.user", "preferred username of the signed-in user")
+	flag.Parse()
+
+	p, err := oidctest.New(*issuer, *clientID, oidctest.User{
+		Subject:           *subject,
+		Email:             *email,
+		EmailVerified:     true,
+		Name:              *name,
+		PreferredUsername: *username,
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	log.Printf("Mock OIDC provider %s listening on %s", *issuer, *addr)
+	log.Fatal(http.ListenAndServe(*addr, p.Handler()))
+}
@@ -1,29 +1,151 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log"
+	"log/slog"
 	"net/http"
+	"os"
+	"strings"
+	"time"
 
+	"github.com/pressly/goose/v3"
+	"github.com/vedran77/pulse/internal/avatar"
 	"github.com/vedran77/pulse/internal/config"
 	"github.com/vedran77/pulse/internal/database"
+	"github.com/vedran77/pulse/internal/health"
+	"github.com/vedran77/pulse/internal/lifecycle"
+	"github.com/vedran77/pulse/internal/logging"
+	"github.com/vedran77/pulse/internal/mail"
+	"github.com/vedran77/pulse/internal/metrics"
+	"github.com/vedran77/pulse/internal/oidc"
+	"github.com/vedran77/pulse/internal/ratelimit"
 	postgresrepo "github.com/vedran77/pulse/internal/repository/postgres"
 	"github.com/vedran77/pulse/internal/service"
+	"github.com/vedran77/pulse/internal/tracing"
 	"github.com/vedran77/pulse/internal/transport/http/handlers"
 	"github.com/vedran77/pulse/internal/transport/http/middleware"
 	"github.com/vedran77/pulse/internal/transport/ws"
+	"github.com/vedran77/pulse/internal/unfurl"
 )
 
 func main() {
-	cfg := config.Load()
+	cmd, args := "serve", os.Args[1:]
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		cmd, args = args[0], args[1:]
+	}
+	// migrate takes an action of its own: migrate up|down|status
+	var sub string
+	if cmd == "migrate" && len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		sub, args = args[0], args[1:]
+	}
+
+	cfg, err := config.Load(args)
+	if err != nil {
+		log.Fatalf("Loading config: %v", err)
+	}
+
+	switch cmd {
+	case "serve":
+		if err := cfg.Validate(); err != nil {
+			log.Fatalf("Invalid config:\n%v", err)
+		}
+		serve(cfg)
+
+	case "migrate":
+		if err := runMigrate(cfg, sub); err != nil {
+			log.Fatal(err)
+		}
+
+	case "config":
+		// Print the effective config with secrets redacted
+		if err := cfg.Dump(os.Stdout); err != nil {
+			log.Fatal(err)
+		}
+		if err := cfg.Validate(); err != nil {
+			fmt.Fprintf(os.Stderr, "\nConfig is invalid:\n%v\n", err)
+			os.Exit(1)
+		}
+
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown command %q (available: serve, migrate, config)\n", cmd)
+		os.Exit(2)
+	}
+}
+
+func serve(cfg *config.Config) {
+	slog.SetDefault(logging.New(os.Stderr, cfg.Observability.LogFormat, cfg.Observability.LogLevel))
+	slog.Info("starting", "env", cfg.Env)
+	lm := lifecycle.New()
+	lm.SetDrainDelay(cfg.Server.DrainDelay)
+
+	// Health probes; checks are added as dependencies come up
+	live := health.NewChecker()
+	ready := health.NewChecker()
+	ready.Add("lifecycle", func(ctx context.Context) (string, error) {
+		if lm.Draining() {
+			return "", errors.New("shutting down")
+		}
+		return "", nil
+	})
+
+	// Tracing, flushed after everything else has stopped
+	shutdownTracing, err := tracing.Setup(context.Background(), cfg.Observability)
+	if err != nil {
+		fatal("setting up tracing", err)
+	}
+	lm.OnShutdown("tracing", shutdownTracing)
+
+	// Metrics on their own listener so they aren't exposed with the API
+	m := metrics.New()
+	if cfg.Observability.MetricsAddr != "" {
+		metricsMux := http.NewServeMux()
+		metricsMux.Handle("GET /metrics", m.Handler())
+		metricsSrv := &http.Server{
+			Addr:              cfg.Observability.MetricsAddr,
+			Handler:           metricsMux,
+			ReadHeaderTimeout: 10 * time.Second,
+		}
+		lm.OnShutdown("metrics server", metricsSrv.Shutdown)
+		go func() {
+			slog.Info("serving metrics", "addr", metricsSrv.Addr)
+			if err := metricsSrv.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+				lm.Fail(fmt.Errorf("metrics server: %w", err))
+			}
+		}()
+	}
 
 	// Database
-	pool, err := database.Connect(cfg)
+	pool, err := database.Connect(cfg.Database)
+	if err != nil {
+		fatal("connecting to database", err)
+	}
+	lm.OnClose("database", func() error {
+		pool.Close()
+		return nil
+	})
+	m.RegisterPool(pool)
+	slog.Info("connected to database")
+	ready.Add("database", func(ctx context.Context) (string, error) {
+		return "", pool.Ping(ctx)
+	})
+
+	// Schema
+	migrator, err := database.NewMigrator(pool)
 	if err != nil {
-		log.Fatal(err)
+		fatal("loading migrations", err)
+	}
+	if cfg.Database.AutoMigrate {
+		if err := migrateUp(context.Background(), migrator); err != nil {
+			fatal("applying migrations", err)
+		}
 	}
-	defer pool.Close()
-	log.Println("Connected to database")
+	if err := database.CheckSchema(context.Background(), migrator); err != nil {
+		fatal("refusing to start, run `server migrate up` or set DB_AUTO_MIGRATE=true", err)
+	}
+	ready.Add("migrations", migrationCheck(migrator))
 
 	// Repositories
 	userRepo := postgresrepo.NewUserRepo(pool)
@@ -33,60 +155,215 @@ func main() {
 	inviteRepo := postgresrepo.NewInviteRepo(pool)
 	dmRepo := postgresrepo.NewDMRepo(pool)
 	pulsemateRepo := postgresrepo.NewPulsemateRepo(pool)
+	tokenRepo := postgresrepo.NewVerificationTokenRepo(pool)
+	twoFactorRepo := postgresrepo.NewTwoFactorRepo(pool)
+	identityRepo := postgresrepo.NewIdentityRepo(pool)
+	savedRepo := postgresrepo.NewSavedItemRepo(pool)
+	scheduledRepo := postgresrepo.NewScheduledMessageRepo(pool)
+	txManager := postgresrepo.NewTxManager(pool)
+
+	// Mail
+	var mailer service.Mailer
+	if cfg.Mail.SMTPHost != "" {
+		mailer = mail.NewSMTPMailer(cfg.Mail.SMTPHost, cfg.Mail.SMTPPort, cfg.Mail.SMTPUser, cfg.Mail.SMTPPassword, cfg.Mail.From)
+	} else {
+		mailer = mail.NewLogMailer()
+		slog.Info("SMTP_HOST not set, emails will be logged")
+	}
+
+	// Avatar uploads
+	avatarStore, err := avatar.NewDiskStore(cfg.Avatars.Dir, cfg.Avatars.PublicURL)
+	if err != nil {
+		fatal("creating avatar directory", err)
+	}
 
 	// Services
-	authService := service.NewAuthService(userRepo, cfg.JWTSecret)
-	workspaceService := service.NewWorkspaceService(workspaceRepo, userRepo, inviteRepo)
-	channelService := service.NewChannelService(channelRepo, workspaceRepo)
+	authService := service.NewAuthService(userRepo, tokenRepo, twoFactorRepo, identityRepo, cfg.Auth.JWTSecret, cfg.Auth.TOTPEncryptionKey)
+	accountService := service.NewAccountService(userRepo, workspaceRepo, authService, avatarStore)
+	workspaceService := service.NewWorkspaceService(workspaceRepo, userRepo, inviteRepo, txManager)
+	channelService := service.NewChannelService(channelRepo, workspaceRepo, txManager)
 	messageService := service.NewMessageService(messageRepo, channelRepo, workspaceRepo)
 	dmService := service.NewDMService(dmRepo, userRepo)
-	pulsemateService := service.NewPulsemateService(pulsemateRepo, userRepo)
+	pulsemateService := service.NewPulsemateService(pulsemateRepo, userRepo, txManager)
+	savedService := service.NewSavedService(savedRepo, messageRepo, dmRepo, channelRepo, workspaceRepo, userRepo)
+	scheduledService := service.NewScheduledService(scheduledRepo, messageService, dmService, txManager)
+	authService.SetSettings(service.AuthSettings{
+		AccessTokenTTL:        cfg.Auth.AccessTokenTTL,
+		VerifyEmailTokenTTL:   cfg.Auth.VerifyEmailTokenTTL,
+		ResetPasswordTokenTTL: cfg.Auth.ResetPasswordTokenTTL,
+		MaxFailedLogins:       cfg.Auth.MaxFailedLogins,
+		LockoutDuration:       cfg.Auth.LockoutDuration,
+		RegistrationOpen:      cfg.Features.Registration,
+	})
+	authService.SetMailer(mailer, cfg.Server.AppURL)
+	workspaceService.SetMailer(mailer, cfg.Server.AppURL)
+	savedService.SetMailer(mailer, cfg.Server.AppURL)
+
+	// SSO
+	if cfg.OIDC.Issuer != "" {
+		oidcClient, err := oidc.NewClient(context.Background(), oidc.Config{
+			Issuer:       cfg.OIDC.Issuer,
+			ClientID:     cfg.OIDC.ClientID,
+			ClientSecret: cfg.OIDC.ClientSecret,
+			RedirectURL:  cfg.OIDC.RedirectURL,
+		})
+		if err != nil {
+			fatal("setting up OIDC provider", err)
+		}
+		authService.SetOIDC(oidcClient)
+		slog.Info("SSO enabled", "issuer", cfg.OIDC.Issuer)
+	}
 
 	// WebSocket Hub
 	hub := ws.NewHub()
 	go hub.Run()
+	lm.OnShutdown("websocket hub", hub.Shutdown)
+	m.RegisterHub(hub)
+	live.Add("websocket_hub", func(ctx context.Context) (string, error) {
+		return "", hub.CheckAlive(hubStallTimeout)
+	})
 	hubNotifier := ws.NewHubNotifier(hub)
 	messageService.SetNotifier(hubNotifier)
 	dmService.SetNotifier(hubNotifier)
+	dmService.SetPresence(hub.IsOnline)
+	channelService.SetNotifier(hubNotifier)
+	savedService.SetNotifier(hubNotifier)
+
+	// Reminders on saved messages, emailed to users who aren't connected
+	lm.Go("reminders", func(ctx context.Context) {
+		savedService.RunReminders(ctx, cfg.Scheduler.PollInterval)
+	})
+	// Scheduled messages, sent through the services so they're broadcast
+	lm.Go("scheduled messages", func(ctx context.Context) {
+		scheduledService.RunScheduledMessages(ctx, cfg.Scheduler.PollInterval)
+	})
+	// Workspace auto-archive policies
+	lm.Go("channel auto-archive", func(ctx context.Context) {
+		channelService.RunAutoArchive(ctx, cfg.Scheduler.AutoArchiveInterval)
+	})
+	// Deleted workspaces past their restore window
+	lm.Go("workspace purge", func(ctx context.Context) {
+		workspaceService.RunPurge(ctx, cfg.Scheduler.PurgeInterval)
+	})
+
+	// Link previews, unfurled in the background after a message is sent
+	if cfg.Features.LinkPreviews {
+		messageService.SetLinkPreviewer(unfurl.New(unfurl.Config{
+			Timeout:  cfg.Unfurl.Timeout,
+			MaxBytes: int64(cfg.Unfurl.MaxBytes),
+		}))
+		for range cfg.Unfurl.Workers {
+			lm.Go("link previews", messageService.RunLinkPreviews)
+		}
+	}
 
 	// Handlers
-	authHandler := handlers.NewAuthHandler(authService)
+	authHandler := handlers.NewAuthHandler(authService, cfg.Server.AppURL)
+	accountHandler := handlers.NewAccountHandler(accountService, int64(cfg.Avatars.MaxBytes))
 	workspaceHandler := handlers.NewWorkspaceHandler(workspaceService)
 	channelHandler := handlers.NewChannelHandler(channelService)
-	messageHandler := handlers.NewMessageHandler(messageService)
-	dmHandler := handlers.NewDMHandler(dmService)
+	messageHandler := handlers.NewMessageHandler(messageService, scheduledService)
+	dmHandler := handlers.NewDMHandler(dmService, scheduledService)
 	pulsemateHandler := handlers.NewPulsemateHandler(pulsemateService)
+	savedHandler := handlers.NewSavedHandler(savedService)
+	scheduledHandler := handlers.NewScheduledHandler(scheduledService)
 
 	// Auth middleware
-	auth := middleware.Auth(cfg.JWTSecret)
+	auth := middleware.Auth(authService)
+
+	// Rate limiting
+	var rateStore ratelimit.Store = ratelimit.NewMemoryStore()
+	if cfg.RateLimit.Store == "redis" {
+		rdb, err := database.ConnectRedis(cfg.Redis)
+		if err != nil {
+			fatal("connecting to redis", err)
+		}
+		lm.OnClose("redis", rdb.Close)
+		ready.Add("redis", func(ctx context.Context) (string, error) {
+			return "", rdb.Ping(ctx).Err()
+		})
+		rateStore = ratelimit.NewRedisStore(rdb)
+		slog.Info("using redis for rate limiting")
+	}
+	limiter := middleware.NewRateLimiter(rateStore, cfg.Server.TrustProxy)
+	globalLimit := limiter.ByIP("global", rateLimit(cfg.RateLimit.Global))
+	authLimit := limiter.ByIP("auth", rateLimit(cfg.RateLimit.Auth))
+	messageLimit := limiter.ByUser("messages", rateLimit(cfg.RateLimit.Messages))
+	hub.SetRateLimit(rateStore, rateLimit(cfg.RateLimit.WSEvents))
 
 	// Routes
 	mux := http.NewServeMux()
 
 	// Public
-	mux.HandleFunc("GET /health", func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Content-Type", "application/json")
-		w.Write([]byte(`{"status": "ok"}`))
-	})
-	mux.HandleFunc("POST /api/v1/auth/register", authHandler.Register)
-	mux.HandleFunc("POST /api/v1/auth/login", authHandler.Login)
+	mux.Handle("POST /api/v1/auth/register", authLimit(http.HandlerFunc(authHandler.Register)))
+	mux.Handle("POST /api/v1/auth/login", authLimit(http.HandlerFunc(authHandler.Login)))
+	mux.Handle("POST /api/v1/auth/login/2fa", authLimit(http.HandlerFunc(authHandler.LoginTwoFactor)))
+	mux.HandleFunc("GET /api/v1/auth/oidc/login", authHandler.OIDCLogin)
+	mux.HandleFunc("GET /api/v1/auth/oidc/callback", authHandler.OIDCCallback)
+	mux.Handle("POST /api/v1/auth/verify-email", authLimit(http.HandlerFunc(authHandler.VerifyEmail)))
+	mux.Handle("POST /api/v1/auth/forgot-password", authLimit(http.HandlerFunc(authHandler.ForgotPassword)))
+	mux.Handle("POST /api/v1/auth/reset-password", authLimit(http.HandlerFunc(authHandler.ResetPassword)))
+	mux.Handle("POST /api/v1/auth/resend-verification", auth(http.HandlerFunc(authHandler.ResendVerification)))
+	mux.Handle("POST /api/v1/auth/confirm-email", authLimit(http.HandlerFunc(accountHandler.ConfirmEmail)))
+	mux.Handle("GET /avatars/", http.StripPrefix("/avatars/", avatarStore.Handler()))
+
+	// Protected - Profile & account
+	mux.Handle("GET /api/v1/me", auth(http.HandlerFunc(accountHandler.Get)))
+	mux.Handle("PATCH /api/v1/me", auth(http.HandlerFunc(accountHandler.Update)))
+	mux.Handle("DELETE /api/v1/me", auth(http.HandlerFunc(accountHandler.Delete)))
+	mux.Handle("PUT /api/v1/me/avatar", auth(http.HandlerFunc(accountHandler.UploadAvatar)))
+	mux.Handle("DELETE /api/v1/me/avatar", auth(http.HandlerFunc(accountHandler.DeleteAvatar)))
+	mux.Handle("POST /api/v1/me/password", auth(http.HandlerFunc(accountHandler.ChangePassword)))
+	mux.Handle("POST /api/v1/me/email", auth(http.HandlerFunc(accountHandler.ChangeEmail)))
+
+	// Two-factor authentication (protected)
+	mux.Handle("POST /api/v1/me/2fa/enroll", auth(http.HandlerFunc(authHandler.EnrollTwoFactor)))
+	mux.Handle("POST /api/v1/me/2fa/confirm", auth(http.HandlerFunc(authHandler.ConfirmTwoFactor)))
+	mux.Handle("POST /api/v1/me/2fa/disable", auth(http.HandlerFunc(authHandler.DisableTwoFactor)))
+	mux.Handle("POST /api/v1/me/2fa/recovery-codes", auth(http.HandlerFunc(authHandler.RegenerateRecoveryCodes)))
+
+	// Protected - Saved items & reminders
+	mux.Handle("GET /api/v1/me/saved", auth(http.HandlerFunc(savedHandler.List)))
+	mux.Handle("POST /api/v1/me/saved", auth(http.HandlerFunc(savedHandler.Save)))
+	mux.Handle("PATCH /api/v1/me/saved/{id}", auth(http.HandlerFunc(savedHandler.SetReminder)))
+	mux.Handle("DELETE /api/v1/me/saved/{id}", auth(http.HandlerFunc(savedHandler.Unsave)))
+
+	// Protected - Scheduled messages (created with send_at on the send endpoints)
+	mux.Handle("GET /api/v1/me/scheduled", auth(http.HandlerFunc(scheduledHandler.List)))
+	mux.Handle("PATCH /api/v1/me/scheduled/{id}", auth(http.HandlerFunc(scheduledHandler.Update)))
+	mux.Handle("DELETE /api/v1/me/scheduled/{id}", auth(http.HandlerFunc(scheduledHandler.Cancel)))
 
 	// Protected - Workspaces
 	mux.Handle("POST /api/v1/workspaces", auth(http.HandlerFunc(workspaceHandler.Create)))
 	mux.Handle("GET /api/v1/workspaces", auth(http.HandlerFunc(workspaceHandler.List)))
+	mux.Handle("GET /api/v1/workspaces/discoverable", auth(http.HandlerFunc(workspaceHandler.ListDiscoverable)))
+	mux.Handle("GET /api/v1/workspaces/deleted", auth(http.HandlerFunc(workspaceHandler.ListDeleted)))
 	mux.Handle("GET /api/v1/workspaces/{id}", auth(http.HandlerFunc(workspaceHandler.Get)))
 	mux.Handle("PATCH /api/v1/workspaces/{id}", auth(http.HandlerFunc(workspaceHandler.Update)))
 	mux.Handle("DELETE /api/v1/workspaces/{id}", auth(http.HandlerFunc(workspaceHandler.Delete)))
+	mux.Handle("POST /api/v1/workspaces/{id}/restore", auth(http.HandlerFunc(workspaceHandler.Restore)))
+	mux.Handle("POST /api/v1/workspaces/{id}/transfer-ownership", auth(http.HandlerFunc(workspaceHandler.TransferOwnership)))
 
 	// Protected - Workspace Members
 	mux.Handle("POST /api/v1/workspaces/{id}/members", auth(http.HandlerFunc(workspaceHandler.AddMember)))
 	mux.Handle("DELETE /api/v1/workspaces/{id}/members/{uid}", auth(http.HandlerFunc(workspaceHandler.RemoveMember)))
 	mux.Handle("GET /api/v1/workspaces/{id}/members", auth(http.HandlerFunc(workspaceHandler.ListMembers)))
+	mux.Handle("GET /api/v1/workspaces/{id}/members/search", auth(http.HandlerFunc(workspaceHandler.SearchMembers)))
+	mux.Handle("PATCH /api/v1/workspaces/{id}/members/me", auth(http.HandlerFunc(workspaceHandler.UpdateMyProfile)))
+
+	// Protected - Domain-based Joining
+	mux.Handle("POST /api/v1/workspaces/{id}/join", auth(http.HandlerFunc(workspaceHandler.Join)))
+	mux.Handle("GET /api/v1/workspaces/{id}/join-policy", auth(http.HandlerFunc(workspaceHandler.GetJoinPolicy)))
+	mux.Handle("PATCH /api/v1/workspaces/{id}/join-policy", auth(http.HandlerFunc(workspaceHandler.UpdateJoinPolicy)))
+	mux.Handle("GET /api/v1/workspaces/{id}/join-requests", auth(http.HandlerFunc(workspaceHandler.ListJoinRequests)))
+	mux.Handle("POST /api/v1/workspaces/{id}/join-requests/{requestId}/approve", auth(http.HandlerFunc(workspaceHandler.ApproveJoinRequest)))
+	mux.Handle("POST /api/v1/workspaces/{id}/join-requests/{requestId}/reject", auth(http.HandlerFunc(workspaceHandler.RejectJoinRequest)))
 
 	// Protected - Workspace Invites
 	mux.Handle("POST /api/v1/workspaces/{id}/invites", auth(http.HandlerFunc(workspaceHandler.CreateInvite)))
 	mux.Handle("GET /api/v1/workspaces/{id}/invites", auth(http.HandlerFunc(workspaceHandler.ListInvites)))
 	mux.Handle("DELETE /api/v1/workspaces/{id}/invites/{inviteId}", auth(http.HandlerFunc(workspaceHandler.RevokeInvite)))
+	mux.Handle("POST /api/v1/workspaces/{id}/invites/{inviteId}/resend", auth(http.HandlerFunc(workspaceHandler.ResendInvite)))
 
 	// Public - Invite Info
 	mux.HandleFunc("GET /api/v1/invites/{token}", workspaceHandler.GetInviteInfo)
@@ -100,27 +377,48 @@ func main() {
 	mux.Handle("GET /api/v1/channels/{id}", auth(http.HandlerFunc(channelHandler.Get)))
 	mux.Handle("PATCH /api/v1/channels/{id}", auth(http.HandlerFunc(channelHandler.Update)))
 	mux.Handle("DELETE /api/v1/channels/{id}", auth(http.HandlerFunc(channelHandler.Archive)))
+	mux.Handle("POST /api/v1/channels/{id}/unarchive", auth(http.HandlerFunc(channelHandler.Unarchive)))
 
 	// Protected - Channel Members
 	mux.Handle("POST /api/v1/channels/{id}/join", auth(http.HandlerFunc(channelHandler.Join)))
 	mux.Handle("POST /api/v1/channels/{id}/members", auth(http.HandlerFunc(channelHandler.AddMember)))
 	mux.Handle("DELETE /api/v1/channels/{id}/members/{uid}", auth(http.HandlerFunc(channelHandler.RemoveMember)))
 	mux.Handle("GET /api/v1/channels/{id}/members", auth(http.HandlerFunc(channelHandler.ListMembers)))
+	mux.Handle("PUT /api/v1/channels/{id}/members/{uid}/role", auth(http.HandlerFunc(channelHandler.SetMemberRole)))
+	mux.Handle("PUT /api/v1/channels/{id}/topic", auth(http.HandlerFunc(channelHandler.SetTopic)))
+	mux.Handle("GET /api/v1/channels/{id}/topic/history", auth(http.HandlerFunc(channelHandler.TopicHistory)))
+
+	// Protected - Channel Bookmarks
+	mux.Handle("GET /api/v1/channels/{id}/bookmarks", auth(http.HandlerFunc(channelHandler.ListBookmarks)))
+	mux.Handle("POST /api/v1/channels/{id}/bookmarks", auth(http.HandlerFunc(channelHandler.AddBookmark)))
+	mux.Handle("PUT /api/v1/channels/{id}/bookmarks/{bid}", auth(http.HandlerFunc(channelHandler.UpdateBookmark)))
+	mux.Handle("DELETE /api/v1/channels/{id}/bookmarks/{bid}", auth(http.HandlerFunc(channelHandler.RemoveBookmark)))
 
 	// WebSocket (auth via query param)
-	mux.HandleFunc("GET /ws", ws.ServeWS(hub, cfg.JWTSecret))
+	if cfg.Features.WebSocket {
+		mux.HandleFunc("GET /ws", ws.ServeWS(hub, authService, cfg.Server.CORSOrigins))
+	}
 
 	// Protected - Messages
-	mux.Handle("POST /api/v1/channels/{id}/messages", auth(http.HandlerFunc(messageHandler.Send)))
+	mux.Handle("POST /api/v1/channels/{id}/messages", auth(messageLimit(http.HandlerFunc(messageHandler.Send))))
 	mux.Handle("GET /api/v1/channels/{id}/messages", auth(http.HandlerFunc(messageHandler.List)))
 	mux.Handle("PATCH /api/v1/messages/{id}", auth(http.HandlerFunc(messageHandler.Edit)))
 	mux.Handle("DELETE /api/v1/messages/{id}", auth(http.HandlerFunc(messageHandler.Delete)))
 
+	// Protected - Pins
+	mux.Handle("GET /api/v1/channels/{id}/pins", auth(http.HandlerFunc(messageHandler.ListPins)))
+	mux.Handle("POST /api/v1/messages/{id}/pin", auth(http.HandlerFunc(messageHandler.Pin)))
+	mux.Handle("DELETE /api/v1/messages/{id}/pin", auth(http.HandlerFunc(messageHandler.Unpin)))
+
 	// Protected - Direct Messages
 	mux.Handle("POST /api/v1/dm/conversations", auth(http.HandlerFunc(dmHandler.GetOrCreateConversation)))
 	mux.Handle("GET /api/v1/dm/conversations", auth(http.HandlerFunc(dmHandler.ListConversations)))
-	mux.Handle("POST /api/v1/dm/conversations/{id}/messages", auth(http.HandlerFunc(dmHandler.SendMessage)))
+	mux.Handle("POST /api/v1/dm/conversations/{id}/messages", auth(messageLimit(http.HandlerFunc(dmHandler.SendMessage))))
 	mux.Handle("GET /api/v1/dm/conversations/{id}/messages", auth(http.HandlerFunc(dmHandler.ListMessages)))
+	mux.Handle("POST /api/v1/dm/conversations/{id}/hide", auth(http.HandlerFunc(dmHandler.HideConversation)))
+	mux.Handle("POST /api/v1/dm/conversations/{id}/mute", auth(http.HandlerFunc(dmHandler.MuteConversation)))
+	mux.Handle("DELETE /api/v1/dm/conversations/{id}/mute", auth(http.HandlerFunc(dmHandler.UnmuteConversation)))
+	mux.Handle("POST /api/v1/dm/conversations/{id}/read", auth(http.HandlerFunc(dmHandler.MarkRead)))
 	mux.Handle("PATCH /api/v1/dm/messages/{id}", auth(http.HandlerFunc(dmHandler.EditMessage)))
 	mux.Handle("DELETE /api/v1/dm/messages/{id}", auth(http.HandlerFunc(dmHandler.DeleteMessage)))
 
@@ -134,8 +432,66 @@ func main() {
 	mux.Handle("DELETE /api/v1/pulsemates/requests/{id}", auth(http.HandlerFunc(pulsemateHandler.CancelRequest)))
 	mux.Handle("DELETE /api/v1/pulsemates/{userId}", auth(http.HandlerFunc(pulsemateHandler.RemovePulsemate)))
 
-	// Start server with CORS
-	addr := fmt.Sprintf(":%s", cfg.ServerPort)
-	log.Printf("Starting server on %s", addr)
-	log.Fatal(http.ListenAndServe(addr, middleware.CORS(mux)))
+	// Probes bypass the global per-IP limit: the kubelet or load balancer
+	// polls from one address and must not be throttled into restarting or
+	// draining a healthy instance
+	root := http.NewServeMux()
+	root.Handle("GET /livez", live)
+	root.Handle("GET /readyz", ready)
+	root.Handle("GET /health", ready) // kept for existing probes
+	root.Handle("/", globalLimit(mux))
+
+	// Start server with request observation, CORS and the global per-IP limit
+	observe := middleware.Observe(m)
+	cors := middleware.CORS(cfg.Server.CORSOrigins)
+	srv := &http.Server{
+		Addr:              fmt.Sprintf(":%s", cfg.Server.Port),
+		Handler:           observe(cors(root)),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	// Registered after the hub so it stops first: no new connections or
+	// requests, then the hub tells WebSocket clients to reconnect elsewhere.
+	// Hijacked WebSocket connections aren't tracked by srv.Shutdown.
+	lm.OnShutdown("http server", srv.Shutdown)
+
+	go func() {
+		slog.Info("starting server", "addr", srv.Addr)
+		if err := srv.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+			lm.Fail(err)
+		}
+	}()
+
+	if err := lm.Wait(cfg.Server.ShutdownTimeout); err != nil {
+		fatal("shutdown", err)
+	}
+}
+
+// hubStallTimeout is how long the hub loop may go without a heartbeat
+// before /livez fails and the orchestrator restarts the instance.
+const hubStallTimeout = 30 * time.Second
+
+// migrationCheck fails readiness while the database schema is older than the
+// newest migration embedded in the server, e.g. after a rollback.
+func migrationCheck(migrator *goose.Provider) health.CheckFunc {
+	return func(ctx context.Context) (string, error) {
+		current, target, err := migrator.GetVersions(ctx)
+		if err != nil {
+			return "", err
+		}
+		detail := fmt.Sprintf("version %d", current)
+		if current < target {
+			return detail, fmt.Errorf("schema version %d is behind %d, run migrations", current, target)
+		}
+		return detail, nil
+	}
+}
+
+// fatal logs an error that prevents the server from running and exits.
+func fatal(msg string, err error) {
+	slog.Error(msg, "err", err)
+	os.Exit(1)
+}
+
+func rateLimit(l config.Limit) ratelimit.Limit {
+	return ratelimit.PerSecond(l.PerSecond, l.Burst)
 }
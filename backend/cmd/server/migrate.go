@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"path"
+	"text/tabwriter"
+	"time"
+
+	"github.com/pressly/goose/v3"
+	"github.com/vedran77/pulse/internal/config"
+	"github.com/vedran77/pulse/internal/database"
+)
+
+// runMigrate implements `server migrate up|down|status`.
+func runMigrate(cfg *config.Config, action string) error {
+	if action != "up" && action != "down" && action != "status" {
+		return fmt.Errorf("usage: server migrate up|down|status [flags]")
+	}
+
+	pool, err := database.Connect(cfg.Database)
+	if err != nil {
+		return err
+	}
+	defer pool.Close()
+
+	migrator, err := database.NewMigrator(pool)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	switch action {
+	case "up":
+		return migrateUp(ctx, migrator)
+
+	case "down":
+		res, err := migrator.Down(ctx)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Rolled back %s (%s)\n", path.Base(res.Source.Path), res.Duration.Round(time.Millisecond))
+		return nil
+
+	default:
+		statuses, err := migrator.Status(ctx)
+		if err != nil {
+			return err
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "APPLIED AT\tMIGRATION")
+		for _, s := range statuses {
+			applied := "pending"
+			if s.State == goose.StateApplied {
+				applied = s.AppliedAt.Local().Format(time.DateTime)
+			}
+			fmt.Fprintf(w, "%s\t%s\n", applied, path.Base(s.Source.Path))
+		}
+		return w.Flush()
+	}
+}
+
+// migrateUp applies all pending migrations, logging each one.
+func migrateUp(ctx context.Context, migrator *goose.Provider) error {
+	results, err := migrator.Up(ctx)
+	for _, res := range results {
+		if res.Error == nil {
+			slog.Info("applied migration", "migration", path.Base(res.Source.Path), "took", res.Duration.Round(time.Millisecond))
+		}
+	}
+	if err != nil {
+		return err
+	}
+	if len(results) == 0 {
+		slog.Info("database schema is up to date")
+	}
+	return nil
+}
@@ -0,0 +1,101 @@
+// Package avatar turns uploaded images into square profile pictures and
+// keeps them on disk. Uploads are decoded only after their dimensions are
+// checked, so a small file can't expand into a huge bitmap.
+package avatar
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+
+	// Formats accepted for upload
+	_ "image/gif"
+	_ "image/jpeg"
+)
+
+// Size is the width and height of stored avatars, in pixels.
+const Size = 256
+
+// Larger uploads are refused before decoding
+const maxPixels = 25_000_000
+
+var (
+	ErrInvalidImage = errors.New("avatar: not a PNG, JPEG or GIF image")
+	ErrTooLarge     = errors.New("avatar: image dimensions are too large")
+)
+
+// Resize decodes a PNG, JPEG or GIF, crops it to a centered square and
+// scales it to Size×Size. The result is PNG encoded.
+func Resize(r io.Reader) ([]byte, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrInvalidImage
+	}
+	if cfg.Width < 1 || cfg.Height < 1 {
+		return nil, ErrInvalidImage
+	}
+	if cfg.Width*cfg.Height > maxPixels {
+		return nil, ErrTooLarge
+	}
+
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrInvalidImage
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, scale(squareCrop(src.Bounds()), src)); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// squareCrop returns the largest square centered in b.
+func squareCrop(b image.Rectangle) image.Rectangle {
+	side := min(b.Dx(), b.Dy())
+	x := b.Min.X + (b.Dx()-side)/2
+	y := b.Min.Y + (b.Dy()-side)/2
+	return image.Rect(x, y, x+side, y+side)
+}
+
+// scale resamples the square crop of src to Size×Size. Each output pixel
+// is the average of the source pixels it covers, which keeps downscaled
+// photos smooth; small sources are enlarged by repeating pixels.
+func scale(crop image.Rectangle, src image.Image) *image.RGBA {
+	dst := image.NewRGBA(image.Rect(0, 0, Size, Size))
+	side := crop.Dx()
+
+	for dy := range Size {
+		y0 := crop.Min.Y + dy*side/Size
+		y1 := max(crop.Min.Y+(dy+1)*side/Size, y0+1)
+		for dx := range Size {
+			x0 := crop.Min.X + dx*side/Size
+			x1 := max(crop.Min.X+(dx+1)*side/Size, x0+1)
+
+			// Premultiplied, as returned by RGBA
+			var r, g, b, a, n uint64
+			for y := y0; y < y1; y++ {
+				for x := x0; x < x1; x++ {
+					cr, cg, cb, ca := src.At(x, y).RGBA()
+					r, g, b, a = r+uint64(cr), g+uint64(cg), b+uint64(cb), a+uint64(ca)
+					n++
+				}
+			}
+			dst.Set(dx, dy, color.RGBA64{
+				R: uint16(r / n),
+				G: uint16(g / n),
+				B: uint16(b / n),
+				A: uint16(a / n),
+			})
+		}
+	}
+	return dst
+}
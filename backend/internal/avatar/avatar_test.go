@@ -0,0 +1,129 @@
+package avatar
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// wide returns a w×h PNG, red in the middle third and blue elsewhere.
+func wide(t *testing.T, w, h int) []byte {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := range h {
+		for x := range w {
+			c := color.RGBA{B: 255, A: 255}
+			if x >= w/3 && x < 2*w/3 {
+				c = color.RGBA{R: 255, A: 255}
+			}
+			img.Set(x, y, c)
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestResize(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		w, h int
+	}{
+		{"downscale", 900, 300},
+		{"upscale", 60, 20},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			out, err := Resize(bytes.NewReader(wide(t, tc.w, tc.h)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			img, err := png.Decode(bytes.NewReader(out))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if b := img.Bounds(); b.Dx() != Size || b.Dy() != Size {
+				t.Fatalf("size = %v", b)
+			}
+			// The centered square crop is the red third
+			for _, x := range []int{0, Size / 2, Size - 1} {
+				if r, _, b, _ := img.At(x, Size/2).RGBA(); r>>8 != 255 || b != 0 {
+					t.Fatalf("pixel %d = %v", x, img.At(x, Size/2))
+				}
+			}
+		})
+	}
+}
+
+func TestResizeRejects(t *testing.T) {
+	if _, err := Resize(strings.NewReader("not an image")); !errors.Is(err, ErrInvalidImage) {
+		t.Fatalf("garbage: err = %v", err)
+	}
+	// A 65535×65535 GIF header with no image data; refused before decoding
+	bomb := "GIF89a\xff\xff\xff\xff\x00\x00\x00"
+	if _, err := Resize(strings.NewReader(bomb)); !errors.Is(err, ErrTooLarge) {
+		t.Fatalf("huge image: err = %v", err)
+	}
+}
+
+func TestDiskStore(t *testing.T) {
+	ctx := context.Background()
+	store, err := NewDiskStore(t.TempDir(), "https://pulse.example/avatars/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(http.StripPrefix("/avatars/", store.Handler()))
+	defer srv.Close()
+
+	if _, err := store.Put(ctx, "../escape.png", []byte("x")); err == nil {
+		t.Fatal("path traversal accepted")
+	}
+	url, err := store.Put(ctx, "u1-abc.png", []byte("png bytes"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if url != "https://pulse.example/avatars/u1-abc.png" {
+		t.Fatalf("url = %q", url)
+	}
+
+	get := func(path string) (int, string) {
+		resp, err := http.Get(srv.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, string(body)
+	}
+	if code, body := get("/avatars/u1-abc.png"); code != http.StatusOK || body != "png bytes" {
+		t.Fatalf("GET avatar = %d %q", code, body)
+	}
+	if code, _ := get("/avatars/"); code != http.StatusNotFound {
+		t.Fatalf("directory listing = %d", code)
+	}
+
+	if err := store.Delete(ctx, "https://elsewhere.example/u1-abc.png"); err != nil {
+		t.Fatal(err)
+	}
+	if code, _ := get("/avatars/u1-abc.png"); code != http.StatusOK {
+		t.Fatal("foreign URL deleted a stored avatar")
+	}
+	if err := store.Delete(ctx, url); err != nil {
+		t.Fatal(err)
+	}
+	if code, _ := get("/avatars/u1-abc.png"); code != http.StatusNotFound {
+		t.Fatalf("GET after Delete = %d", code)
+	}
+	if err := store.Delete(ctx, url); err != nil {
+		t.Fatalf("second Delete: %v", err)
+	}
+}
@@ -0,0 +1,89 @@
+package avatar
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// DiskStore keeps avatars as files in a directory that Handler serves
+// under baseURL.
+type DiskStore struct {
+	dir     string
+	baseURL string
+}
+
+func NewDiskStore(dir, baseURL string) (*DiskStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &DiskStore{dir: dir, baseURL: strings.TrimRight(baseURL, "/")}, nil
+}
+
+// Put writes the image and returns its public URL. Names must be unique;
+// a stored file is never changed, so clients can cache it forever.
+func (s *DiskStore) Put(ctx context.Context, name string, data []byte) (string, error) {
+	if !validName(name) {
+		return "", errors.New("avatar: invalid file name")
+	}
+
+	// Written under a temporary name so the file is never served half written
+	tmp, err := os.CreateTemp(s.dir, ".upload-*")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return "", err
+	}
+	if err := tmp.Close(); err != nil {
+		return "", err
+	}
+	if err := os.Chmod(tmp.Name(), 0o644); err != nil {
+		return "", err
+	}
+	if err := os.Rename(tmp.Name(), filepath.Join(s.dir, name)); err != nil {
+		return "", err
+	}
+	return s.baseURL + "/" + name, nil
+}
+
+// Delete removes the avatar at url. URLs that Put didn't return, such as
+// avatars set some other way, are ignored.
+func (s *DiskStore) Delete(ctx context.Context, url string) error {
+	name, ok := strings.CutPrefix(url, s.baseURL+"/")
+	if !ok || !validName(name) {
+		return nil
+	}
+	err := os.Remove(filepath.Join(s.dir, name))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// Handler serves stored avatars by name. Mount it with the path prefix of
+// baseURL stripped.
+func (s *DiskStore) Handler() http.Handler {
+	files := http.FileServer(http.Dir(s.dir))
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// No directory listings or temporary files
+		if !validName(r.URL.Path) {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		files.ServeHTTP(w, r)
+	})
+}
+
+func validName(name string) bool {
+	return name != "" && !strings.HasPrefix(name, ".") && !strings.ContainsAny(name, `/\`)
+}
@@ -1,39 +1,251 @@
+// Package config loads server configuration in layers: built-in defaults,
+// then an optional YAML file, then environment variables, then command
+// line flags. Later layers override earlier ones.
 package config
 
 import (
-	"os"
+	"time"
+)
+
+const (
+	EnvDevelopment = "development"
+	EnvProduction  = "production"
 )
 
 type Config struct {
-	ServerPort string
-	DBHost     string
-	DBPort     string
-	DBUser     string
-	DBPassword string
-	DBName     string
-	RedisURL   string
-	JWTSecret  string
+	// "development" or "production"; production enforces stricter validation
+	Env string `yaml:"env"`
+
+	Server    ServerConfig    `yaml:"server"`
+	Database  DatabaseConfig  `yaml:"database"`
+	Redis     RedisConfig     `yaml:"redis"`
+	Auth      AuthConfig      `yaml:"auth"`
+	Mail      MailConfig      `yaml:"mail"`
+	OIDC      OIDCConfig      `yaml:"oidc"`
+	RateLimit RateLimitConfig `yaml:"rate_limit"`
+	Features  FeaturesConfig  `yaml:"features"`
+	Unfurl    UnfurlConfig    `yaml:"unfurl"`
+	Avatars   AvatarsConfig   `yaml:"avatars"`
+	Scheduler SchedulerConfig `yaml:"scheduler"`
+
+	Observability ObservabilityConfig `yaml:"observability"`
 }
 
-func Load() *Config {
-	return &Config{
-		ServerPort: getEnv("SERVER_PORT", "8080"),
-		DBHost:     getEnv("DB_HOST", "localhost"),
-		DBPort:     getEnv("DB_PORT", "5432"),
-		DBUser:     getEnv("DB_USER", "pulse"),
-		DBPassword: getEnv("DB_PASSWORD", "pulse_dev_password"),
-		DBName:     getEnv("DB_NAME", "pulse"),
-		RedisURL:   getEnv("REDIS_URL", "localhost:6379"),
-		JWTSecret:  getEnv("JWT_SECRET", "dev-secret-change-me"),
-	}
+type ServerConfig struct {
+	Port string `yaml:"port"`
+	// Frontend base URL used in links sent by email and SSO redirects
+	AppURL string `yaml:"app_url"`
+	// Origins allowed to call the API from a browser and open WebSockets
+	CORSOrigins []string `yaml:"cors_origins"`
+	// Take the client IP from X-Forwarded-For; only enable behind a proxy
+	TrustProxy bool `yaml:"trust_proxy"`
+	// How long to wait for requests and WebSockets to drain on SIGTERM
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout"`
+	// How long /readyz reports "draining" before the server stops accepting
+	// connections; counts towards ShutdownTimeout
+	DrainDelay time.Duration `yaml:"drain_delay"`
 }
 
-func getEnv(key, fallback string) string {
-	val, exists := os.LookupEnv(key)
+type DatabaseConfig struct {
+	Host     string `yaml:"host"`
+	Port     string `yaml:"port"`
+	User     string `yaml:"user"`
+	Password string `yaml:"password"`
+	Name     string `yaml:"name"`
+	// libpq sslmode: disable, require, verify-ca or verify-full
+	SSLMode     string `yaml:"sslmode"`
+	SSLRootCert string `yaml:"sslrootcert"`
 
-	if exists {
-		return val
-	}
+	MaxConns        int32         `yaml:"max_conns"`
+	MinConns        int32         `yaml:"min_conns"`
+	MaxConnLifetime time.Duration `yaml:"max_conn_lifetime"`
+	MaxConnIdleTime time.Duration `yaml:"max_conn_idle_time"`
+
+	// Apply pending migrations on startup instead of refusing to serve
+	AutoMigrate bool `yaml:"auto_migrate"`
+}
 
-	return fallback
+type RedisConfig struct {
+	// redis:// URL or plain host:port
+	URL string `yaml:"url"`
 }
+
+type AuthConfig struct {
+	JWTSecret             string        `yaml:"jwt_secret"`
+	TOTPEncryptionKey     string        `yaml:"totp_encryption_key"` // changing it disables everyone's 2FA
+	AccessTokenTTL        time.Duration `yaml:"access_token_ttl"`
+	VerifyEmailTokenTTL   time.Duration `yaml:"verify_email_token_ttl"`
+	ResetPasswordTokenTTL time.Duration `yaml:"reset_password_token_ttl"`
+	// Failed password or 2FA attempts before the account is locked
+	MaxFailedLogins int           `yaml:"max_failed_logins"`
+	LockoutDuration time.Duration `yaml:"lockout_duration"`
+}
+
+type MailConfig struct {
+	// When SMTPHost is empty emails are written to the log
+	SMTPHost     string `yaml:"smtp_host"`
+	SMTPPort     string `yaml:"smtp_port"`
+	SMTPUser     string `yaml:"smtp_user"`
+	SMTPPassword string `yaml:"smtp_password"`
+	From         string `yaml:"from"`
+}
+
+type OIDCConfig struct {
+	// SSO is disabled when Issuer is empty
+	Issuer       string `yaml:"issuer"`
+	ClientID     string `yaml:"client_id"`
+	ClientSecret string `yaml:"client_secret"`
+	RedirectURL  string `yaml:"redirect_url"`
+}
+
+// Limit is a token bucket: PerSecond refill rate, up to Burst requests at once.
+type Limit struct {
+	PerSecond float64 `yaml:"per_second"`
+	Burst     int     `yaml:"burst"`
+}
+
+type RateLimitConfig struct {
+	// "memory" or "redis" (shares limits between instances)
+	Store    string `yaml:"store"`
+	Global   Limit  `yaml:"global"`
+	Auth     Limit  `yaml:"auth"`
+	Messages Limit  `yaml:"messages"`
+	WSEvents Limit  `yaml:"ws_events"`
+}
+
+type FeaturesConfig struct {
+	// Allow anyone to sign up with a password (SSO provisioning is unaffected)
+	Registration bool `yaml:"registration"`
+	// Run the server without the WebSocket endpoint
+	WebSocket bool `yaml:"websocket"`
+	// Fetch previews of links in messages
+	LinkPreviews bool `yaml:"link_previews"`
+}
+
+type UnfurlConfig struct {
+	// Deadline for fetching one link preview, including redirects
+	Timeout time.Duration `yaml:"timeout"`
+	// How much of a page is read looking for metadata
+	MaxBytes int `yaml:"max_bytes"`
+	// Number of messages unfurled concurrently
+	Workers int `yaml:"workers"`
+}
+
+type AvatarsConfig struct {
+	// Directory uploaded avatars are stored in
+	Dir string `yaml:"dir"`
+	// URL the server's /avatars/ path is reachable at, used in avatar_url
+	PublicURL string `yaml:"public_url"`
+	// Largest upload accepted; images are resized to 256×256
+	MaxBytes int `yaml:"max_bytes"`
+}
+
+// SchedulerConfig is for the background workers: reminders, scheduled
+// messages, channel auto-archiving and workspace purging.
+type SchedulerConfig struct {
+	// How often due work is looked up; also the worst-case delay
+	PollInterval time.Duration `yaml:"poll_interval"`
+	// How often inactive channels are archived
+	AutoArchiveInterval time.Duration `yaml:"auto_archive_interval"`
+	// How often deleted workspaces past their restore window are purged
+	PurgeInterval time.Duration `yaml:"purge_interval"`
+}
+
+type ObservabilityConfig struct {
+	// debug, info, warn or error
+	LogLevel string `yaml:"log_level"`
+	// "text" or "json"
+	LogFormat string `yaml:"log_format"`
+	// Separate listener for Prometheus /metrics; empty disables it
+	MetricsAddr string `yaml:"metrics_addr"`
+	// OTLP/HTTP collector endpoint (e.g. http://otel-collector:4318); empty disables tracing
+	TracingEndpoint string `yaml:"tracing_endpoint"`
+	// Fraction of new traces to sample, 0 to 1
+	TracingSampleRatio float64 `yaml:"tracing_sample_ratio"`
+	ServiceName        string  `yaml:"service_name"`
+}
+
+// Default returns the built-in configuration, suitable for local development.
+func Default() *Config {
+	return &Config{
+		Env: EnvDevelopment,
+		Server: ServerConfig{
+			Port:            "8080",
+			AppURL:          "http://localhost:5173",
+			CORSOrigins:     []string{"http://localhost:5173"},
+			ShutdownTimeout: 30 * time.Second,
+		},
+		Database: DatabaseConfig{
+			Host:            "localhost",
+			Port:            "5432",
+			User:            "pulse",
+			Password:        defaultDBPassword,
+			Name:            "pulse",
+			SSLMode:         "disable",
+			MaxConns:        10,
+			MinConns:        0,
+			MaxConnLifetime: time.Hour,
+			MaxConnIdleTime: 30 * time.Minute,
+		},
+		Redis: RedisConfig{
+			URL: "localhost:6379",
+		},
+		Auth: AuthConfig{
+			JWTSecret:             defaultJWTSecret,
+			TOTPEncryptionKey:     defaultTOTPEncryptionKey,
+			AccessTokenTTL:        24 * time.Hour,
+			VerifyEmailTokenTTL:   48 * time.Hour,
+			ResetPasswordTokenTTL: time.Hour,
+			MaxFailedLogins:       10,
+			LockoutDuration:       15 * time.Minute,
+		},
+		Mail: MailConfig{
+			SMTPPort: "587",
+			From:     "Pulse <no-reply@pulse.local>",
+		},
+		OIDC: OIDCConfig{
+			RedirectURL: "http://localhost:8080/api/v1/auth/oidc/callback",
+		},
+		RateLimit: RateLimitConfig{
+			Store:    "memory",
+			Global:   Limit{PerSecond: 20, Burst: 100},
+			Auth:     Limit{PerSecond: 10.0 / 60, Burst: 10},
+			Messages: Limit{PerSecond: 1, Burst: 20},
+			WSEvents: Limit{PerSecond: 10, Burst: 30},
+		},
+		Features: FeaturesConfig{
+			Registration: true,
+			WebSocket:    true,
+			LinkPreviews: true,
+		},
+		Unfurl: UnfurlConfig{
+			Timeout:  5 * time.Second,
+			MaxBytes: 512 << 10,
+			Workers:  4,
+		},
+		Avatars: AvatarsConfig{
+			Dir:       "data/avatars",
+			PublicURL: "http://localhost:8080/avatars",
+			MaxBytes:  5 << 20,
+		},
+		Scheduler: SchedulerConfig{
+			PollInterval:        15 * time.Second,
+			AutoArchiveInterval: time.Hour,
+			PurgeInterval:       time.Hour,
+		},
+		Observability: ObservabilityConfig{
+			LogLevel:           "info",
+			LogFormat:          "text",
+			MetricsAddr:        ":9091",
+			TracingSampleRatio: 1,
+			ServiceName:        "pulse",
+		},
+	}
+}
+
+// Development defaults that must not reach production
+const (
+	defaultJWTSecret         = "dev-secret-change-me"
+	defaultTOTPEncryptionKey = "dev-totp-key-change-me"
+	defaultDBPassword        = "pulse_dev_password"
+)
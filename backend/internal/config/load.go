@@ -0,0 +1,272 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Load builds the configuration from defaults, the YAML file given by
+// -config or CONFIG_FILE, environment variables and flags in args.
+func Load(args []string) (*Config, error) {
+	fs := flag.NewFlagSet("server", flag.ContinueOnError)
+	configPath := fs.String("config", os.Getenv("CONFIG_FILE"), "path to a YAML config file")
+	env := fs.String("env", "", "environment: development or production")
+	port := fs.String("port", "", "HTTP listen port")
+	var overrides setFlags
+	fs.Var(&overrides, "set", "override a value by its YAML path, e.g. -set database.max_conns=20 (repeatable)")
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+
+	cfg := Default()
+
+	if *configPath != "" {
+		data, err := os.ReadFile(*configPath)
+		if err != nil {
+			return nil, fmt.Errorf("reading config file: %w", err)
+		}
+		if err := decodeYAML(data, cfg); err != nil {
+			return nil, fmt.Errorf("parsing %s: %w", *configPath, err)
+		}
+	}
+
+	if err := applyEnv(cfg); err != nil {
+		return nil, err
+	}
+
+	if *env != "" {
+		cfg.Env = *env
+	}
+	if *port != "" {
+		cfg.Server.Port = *port
+	}
+	for _, o := range overrides {
+		if err := applyOverride(cfg, o); err != nil {
+			return nil, err
+		}
+	}
+
+	return cfg, nil
+}
+
+// decodeYAML merges a YAML document into cfg, rejecting unknown keys so
+// typos don't silently fall back to defaults.
+func decodeYAML(data []byte, cfg *Config) error {
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(cfg); err != nil && !errors.Is(err, io.EOF) {
+		return err
+	}
+	return nil
+}
+
+type setFlags []string
+
+func (s *setFlags) String() string     { return strings.Join(*s, ",") }
+func (s *setFlags) Set(v string) error { *s = append(*s, v); return nil }
+
+// applyOverride applies "a.b.c=value" by turning it into a YAML document.
+func applyOverride(cfg *Config, override string) error {
+	path, raw, ok := strings.Cut(override, "=")
+	if !ok || path == "" {
+		return fmt.Errorf("invalid -set %q, expected key=value", override)
+	}
+
+	var value any
+	if err := yaml.Unmarshal([]byte(raw), &value); err != nil {
+		value = raw
+	}
+
+	keys := strings.Split(path, ".")
+	var doc any = value
+	for i := len(keys) - 1; i >= 0; i-- {
+		doc = map[string]any{keys[i]: doc}
+	}
+
+	data, err := yaml.Marshal(doc)
+	if err != nil {
+		return err
+	}
+	if err := decodeYAML(data, cfg); err != nil {
+		return fmt.Errorf("invalid -set %q: %w", override, err)
+	}
+	return nil
+}
+
+type envVar struct {
+	name string
+	set  func(string) error
+}
+
+// envVars maps environment variables onto config fields. The original flat
+// variable names are kept so existing deployments keep working.
+func envVars(cfg *Config) []envVar {
+	return []envVar{
+		{"APP_ENV", setString(&cfg.Env)},
+
+		{"SERVER_PORT", setString(&cfg.Server.Port)},
+		{"APP_URL", setString(&cfg.Server.AppURL)},
+		{"CORS_ALLOWED_ORIGINS", setList(&cfg.Server.CORSOrigins)},
+		{"TRUST_PROXY", setBool(&cfg.Server.TrustProxy)},
+		{"SHUTDOWN_TIMEOUT", setDuration(&cfg.Server.ShutdownTimeout)},
+		{"DRAIN_DELAY", setDuration(&cfg.Server.DrainDelay)},
+
+		{"DB_HOST", setString(&cfg.Database.Host)},
+		{"DB_PORT", setString(&cfg.Database.Port)},
+		{"DB_USER", setString(&cfg.Database.User)},
+		{"DB_PASSWORD", setString(&cfg.Database.Password)},
+		{"DB_NAME", setString(&cfg.Database.Name)},
+		{"DB_SSLMODE", setString(&cfg.Database.SSLMode)},
+		{"DB_SSLROOTCERT", setString(&cfg.Database.SSLRootCert)},
+		{"DB_MAX_CONNS", setInt32(&cfg.Database.MaxConns)},
+		{"DB_MIN_CONNS", setInt32(&cfg.Database.MinConns)},
+		{"DB_MAX_CONN_LIFETIME", setDuration(&cfg.Database.MaxConnLifetime)},
+		{"DB_MAX_CONN_IDLE_TIME", setDuration(&cfg.Database.MaxConnIdleTime)},
+		{"DB_AUTO_MIGRATE", setBool(&cfg.Database.AutoMigrate)},
+
+		{"REDIS_URL", setString(&cfg.Redis.URL)},
+
+		{"JWT_SECRET", setString(&cfg.Auth.JWTSecret)},
+		{"TOTP_ENCRYPTION_KEY", setString(&cfg.Auth.TOTPEncryptionKey)},
+		{"ACCESS_TOKEN_TTL", setDuration(&cfg.Auth.AccessTokenTTL)},
+		{"VERIFY_EMAIL_TOKEN_TTL", setDuration(&cfg.Auth.VerifyEmailTokenTTL)},
+		{"RESET_PASSWORD_TOKEN_TTL", setDuration(&cfg.Auth.ResetPasswordTokenTTL)},
+		{"MAX_FAILED_LOGINS", setInt(&cfg.Auth.MaxFailedLogins)},
+		{"LOCKOUT_DURATION", setDuration(&cfg.Auth.LockoutDuration)},
+
+		{"SMTP_HOST", setString(&cfg.Mail.SMTPHost)},
+		{"SMTP_PORT", setString(&cfg.Mail.SMTPPort)},
+		{"SMTP_USER", setString(&cfg.Mail.SMTPUser)},
+		{"SMTP_PASSWORD", setString(&cfg.Mail.SMTPPassword)},
+		{"MAIL_FROM", setString(&cfg.Mail.From)},
+
+		{"OIDC_ISSUER", setString(&cfg.OIDC.Issuer)},
+		{"OIDC_CLIENT_ID", setString(&cfg.OIDC.ClientID)},
+		{"OIDC_CLIENT_SECRET", setString(&cfg.OIDC.ClientSecret)},
+		{"OIDC_REDIRECT_URL", setString(&cfg.OIDC.RedirectURL)},
+
+		{"RATE_LIMIT_STORE", setString(&cfg.RateLimit.Store)},
+
+		{"FEATURE_REGISTRATION", setBool(&cfg.Features.Registration)},
+		{"FEATURE_WEBSOCKET", setBool(&cfg.Features.WebSocket)},
+		{"FEATURE_LINK_PREVIEWS", setBool(&cfg.Features.LinkPreviews)},
+
+		{"UNFURL_TIMEOUT", setDuration(&cfg.Unfurl.Timeout)},
+		{"UNFURL_MAX_BYTES", setInt(&cfg.Unfurl.MaxBytes)},
+		{"UNFURL_WORKERS", setInt(&cfg.Unfurl.Workers)},
+
+		{"AVATAR_DIR", setString(&cfg.Avatars.Dir)},
+		{"AVATAR_PUBLIC_URL", setString(&cfg.Avatars.PublicURL)},
+		{"AVATAR_MAX_BYTES", setInt(&cfg.Avatars.MaxBytes)},
+
+		{"SCHEDULER_POLL_INTERVAL", setDuration(&cfg.Scheduler.PollInterval)},
+		{"SCHEDULER_AUTO_ARCHIVE_INTERVAL", setDuration(&cfg.Scheduler.AutoArchiveInterval)},
+		{"SCHEDULER_PURGE_INTERVAL", setDuration(&cfg.Scheduler.PurgeInterval)},
+
+		{"LOG_LEVEL", setString(&cfg.Observability.LogLevel)},
+		{"LOG_FORMAT", setString(&cfg.Observability.LogFormat)},
+		{"METRICS_ADDR", setString(&cfg.Observability.MetricsAddr)},
+		{"OTEL_EXPORTER_OTLP_ENDPOINT", setString(&cfg.Observability.TracingEndpoint)},
+		{"OTEL_TRACES_SAMPLER_ARG", setFloat(&cfg.Observability.TracingSampleRatio)},
+		{"OTEL_SERVICE_NAME", setString(&cfg.Observability.ServiceName)},
+	}
+}
+
+func applyEnv(cfg *Config) error {
+	var errs []error
+	for _, v := range envVars(cfg) {
+		val, ok := os.LookupEnv(v.name)
+		if !ok {
+			continue
+		}
+		if err := v.set(val); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", v.name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func setString(p *string) func(string) error {
+	return func(v string) error {
+		*p = v
+		return nil
+	}
+}
+
+func setInt(p *int) func(string) error {
+	return func(v string) error {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return err
+		}
+		*p = n
+		return nil
+	}
+}
+
+func setInt32(p *int32) func(string) error {
+	return func(v string) error {
+		n, err := strconv.ParseInt(v, 10, 32)
+		if err != nil {
+			return err
+		}
+		*p = int32(n)
+		return nil
+	}
+}
+
+func setBool(p *bool) func(string) error {
+	return func(v string) error {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return err
+		}
+		*p = b
+		return nil
+	}
+}
+
+func setFloat(p *float64) func(string) error {
+	return func(v string) error {
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return err
+		}
+		*p = f
+		return nil
+	}
+}
+
+func setDuration(p *time.Duration) func(string) error {
+	return func(v string) error {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return err
+		}
+		*p = d
+		return nil
+	}
+}
+
+// setList parses a comma-separated list.
+func setList(p *[]string) func(string) error {
+	return func(v string) error {
+		var list []string
+		for item := range strings.SplitSeq(v, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				list = append(list, item)
+			}
+		}
+		*p = list
+		return nil
+	}
+}
@@ -0,0 +1,181 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"slices"
+	"strconv"
+
+	"gopkg.in/yaml.v3"
+)
+
+const minProductionSecretLength = 32
+
+var sslModes = []string{"disable", "allow", "prefer", "require", "verify-ca", "verify-full"}
+
+var logLevels = []string{"debug", "info", "warn", "error"}
+
+// Validate checks the configuration. In production it also refuses
+// development defaults such as the built-in JWT secret.
+func (c *Config) Validate() error {
+	var errs []error
+	fail := func(format string, args ...any) {
+		errs = append(errs, fmt.Errorf(format, args...))
+	}
+
+	if c.Env != EnvDevelopment && c.Env != EnvProduction {
+		fail("env must be %q or %q, got %q", EnvDevelopment, EnvProduction, c.Env)
+	}
+
+	if p, err := strconv.Atoi(c.Server.Port); err != nil || p < 1 || p > 65535 {
+		fail("server.port must be a port number, got %q", c.Server.Port)
+	}
+	if !isHTTPURL(c.Server.AppURL) {
+		fail("server.app_url must be an http(s) URL")
+	}
+	for _, origin := range c.Server.CORSOrigins {
+		if origin != "*" && !isHTTPURL(origin) {
+			fail("server.cors_origins: %q is not an http(s) origin", origin)
+		}
+	}
+	if c.Server.ShutdownTimeout <= 0 {
+		fail("server.shutdown_timeout must be positive")
+	}
+	if c.Server.DrainDelay < 0 || c.Server.DrainDelay >= c.Server.ShutdownTimeout {
+		fail("server.drain_delay must be between 0 and shutdown_timeout")
+	}
+
+	if !slices.Contains(sslModes, c.Database.SSLMode) {
+		fail("database.sslmode must be one of %v", sslModes)
+	}
+	if c.Database.MaxConns < 1 {
+		fail("database.max_conns must be at least 1")
+	}
+	if c.Database.MinConns < 0 || c.Database.MinConns > c.Database.MaxConns {
+		fail("database.min_conns must be between 0 and max_conns")
+	}
+
+	if c.Auth.JWTSecret == "" {
+		fail("auth.jwt_secret is required")
+	}
+	if c.Auth.TOTPEncryptionKey == "" {
+		fail("auth.totp_encryption_key is required")
+	}
+	if c.Auth.AccessTokenTTL <= 0 || c.Auth.VerifyEmailTokenTTL <= 0 || c.Auth.ResetPasswordTokenTTL <= 0 {
+		fail("auth token TTLs must be positive")
+	}
+	if c.Auth.MaxFailedLogins < 1 || c.Auth.LockoutDuration <= 0 {
+		fail("auth.max_failed_logins and auth.lockout_duration must be positive")
+	}
+
+	if c.OIDC.Issuer != "" && (c.OIDC.ClientID == "" || !isHTTPURL(c.OIDC.RedirectURL)) {
+		fail("oidc.client_id and oidc.redirect_url are required when oidc.issuer is set")
+	}
+
+	if c.RateLimit.Store != "memory" && c.RateLimit.Store != "redis" {
+		fail("rate_limit.store must be \"memory\" or \"redis\"")
+	}
+	for name, l := range map[string]Limit{
+		"global": c.RateLimit.Global, "auth": c.RateLimit.Auth,
+		"messages": c.RateLimit.Messages, "ws_events": c.RateLimit.WSEvents,
+	} {
+		if l.PerSecond <= 0 || l.Burst < 1 {
+			fail("rate_limit.%s needs a positive per_second and burst", name)
+		}
+	}
+
+	if c.Features.LinkPreviews && (c.Unfurl.Timeout <= 0 || c.Unfurl.MaxBytes < 1 || c.Unfurl.Workers < 1) {
+		fail("unfurl.timeout, unfurl.max_bytes and unfurl.workers must be positive when link previews are enabled")
+	}
+	if c.Avatars.Dir == "" || !isHTTPURL(c.Avatars.PublicURL) || c.Avatars.MaxBytes < 1 {
+		fail("avatars.dir, avatars.public_url (http(s) URL) and avatars.max_bytes are required")
+	}
+	if c.Scheduler.PollInterval <= 0 || c.Scheduler.AutoArchiveInterval <= 0 || c.Scheduler.PurgeInterval <= 0 {
+		fail("scheduler.poll_interval, scheduler.auto_archive_interval and scheduler.purge_interval must be positive")
+	}
+
+	if !slices.Contains(logLevels, c.Observability.LogLevel) {
+		fail("observability.log_level must be one of %v", logLevels)
+	}
+	if c.Observability.LogFormat != "text" && c.Observability.LogFormat != "json" {
+		fail("observability.log_format must be \"text\" or \"json\"")
+	}
+	if c.Observability.TracingEndpoint != "" && !isHTTPURL(c.Observability.TracingEndpoint) {
+		fail("observability.tracing_endpoint must be an http(s) URL")
+	}
+	if r := c.Observability.TracingSampleRatio; r < 0 || r > 1 {
+		fail("observability.tracing_sample_ratio must be between 0 and 1")
+	}
+
+	if c.Env == EnvProduction {
+		if c.Auth.JWTSecret == defaultJWTSecret || len(c.Auth.JWTSecret) < minProductionSecretLength {
+			fail("auth.jwt_secret must be changed from the default and be at least %d characters in production", minProductionSecretLength)
+		}
+		if c.Auth.TOTPEncryptionKey == defaultTOTPEncryptionKey || len(c.Auth.TOTPEncryptionKey) < minProductionSecretLength {
+			fail("auth.totp_encryption_key must be changed from the default and be at least %d characters in production", minProductionSecretLength)
+		}
+		if c.Auth.TOTPEncryptionKey == c.Auth.JWTSecret {
+			fail("auth.totp_encryption_key must differ from auth.jwt_secret")
+		}
+		if c.Database.Password == defaultDBPassword {
+			fail("database.password must be changed from the default in production")
+		}
+		if c.Database.SSLMode == "disable" && !isLocalHost(c.Database.Host) {
+			fail("database.sslmode=disable is only allowed for a local database in production")
+		}
+		if slices.Contains(c.Server.CORSOrigins, "*") {
+			fail("server.cors_origins can't contain \"*\" in production")
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+func isHTTPURL(s string) bool {
+	u, err := url.Parse(s)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+func isLocalHost(host string) bool {
+	return host == "localhost" || host == "127.0.0.1" || host == "::1"
+}
+
+const redacted = "[redacted]"
+
+// Redacted returns a copy of the config with secrets masked.
+func (c *Config) Redacted() *Config {
+	r := *c
+	r.Server.CORSOrigins = slices.Clone(c.Server.CORSOrigins)
+	mask(&r.Database.Password)
+	mask(&r.Auth.JWTSecret)
+	mask(&r.Auth.TOTPEncryptionKey)
+	mask(&r.Mail.SMTPPassword)
+	mask(&r.OIDC.ClientSecret)
+
+	// The Redis URL may carry a password
+	if u, err := url.Parse(r.Redis.URL); err == nil && u.User != nil {
+		if _, ok := u.User.Password(); ok {
+			u.User = url.UserPassword(u.User.Username(), redacted)
+			r.Redis.URL = u.String()
+		}
+	}
+	return &r
+}
+
+// Dump writes the effective configuration as YAML with secrets redacted.
+func (c *Config) Dump(w io.Writer) error {
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	if err := enc.Encode(c.Redacted()); err != nil {
+		return err
+	}
+	return enc.Close()
+}
+
+func mask(s *string) {
+	if *s != "" {
+		*s = redacted
+	}
+}
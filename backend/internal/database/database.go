@@ -3,23 +3,73 @@ package database
 import (
 	"context"
 	"fmt"
+	"net"
+	"net/url"
+	"strings"
 
 	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/redis/go-redis/v9"
 	"github.com/vedran77/pulse/internal/config"
 )
 
-func Connect(cfg *config.Config) (*pgxpool.Pool, error) {
-	dsn := fmt.Sprintf("postgres://%s:%s@%s:%s/%s?sslmode=disable", cfg.DBUser, cfg.DBPassword, cfg.DBHost, cfg.DBPort, cfg.DBName)
+// DSN builds the Postgres connection URL from the config.
+func DSN(cfg config.DatabaseConfig) string {
+	q := url.Values{}
+	q.Set("sslmode", cfg.SSLMode)
+	if cfg.SSLRootCert != "" {
+		q.Set("sslrootcert", cfg.SSLRootCert)
+	}
+
+	u := url.URL{
+		Scheme:   "postgres",
+		User:     url.UserPassword(cfg.User, cfg.Password),
+		Host:     net.JoinHostPort(cfg.Host, cfg.Port),
+		Path:     "/" + cfg.Name,
+		RawQuery: q.Encode(),
+	}
+	return u.String()
+}
 
-	pool, err := pgxpool.New(context.Background(), dsn)
+func Connect(cfg config.DatabaseConfig) (*pgxpool.Pool, error) {
+	poolCfg, err := pgxpool.ParseConfig(DSN(cfg))
+	if err != nil {
+		return nil, fmt.Errorf("invalid database config: %w", err)
+	}
+	poolCfg.MaxConns = cfg.MaxConns
+	poolCfg.MinConns = cfg.MinConns
+	poolCfg.MaxConnLifetime = cfg.MaxConnLifetime
+	poolCfg.MaxConnIdleTime = cfg.MaxConnIdleTime
+	poolCfg.ConnConfig.Tracer = queryTracer{}
 
+	pool, err := pgxpool.NewWithConfig(context.Background(), poolCfg)
 	if err != nil {
 		return nil, fmt.Errorf("unable to create connection pool: %w", err)
 	}
 
 	if err := pool.Ping(context.Background()); err != nil {
+		pool.Close()
 		return nil, fmt.Errorf("unable to ping database: %w", err)
 	}
 
 	return pool, nil
 }
+
+// ConnectRedis connects to Redis. The URL may be a redis:// URL or a plain host:port.
+func ConnectRedis(cfg config.RedisConfig) (*redis.Client, error) {
+	opts := &redis.Options{Addr: cfg.URL}
+	if strings.Contains(cfg.URL, "://") {
+		parsed, err := redis.ParseURL(cfg.URL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid redis url: %w", err)
+		}
+		opts = parsed
+	}
+
+	client := redis.NewClient(opts)
+	if err := client.Ping(context.Background()).Err(); err != nil {
+		client.Close()
+		return nil, fmt.Errorf("unable to ping redis: %w", err)
+	}
+
+	return client, nil
+}
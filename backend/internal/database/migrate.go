@@ -0,0 +1,49 @@
+package database
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/jackc/pgx/v5/stdlib"
+	"github.com/pressly/goose/v3"
+	"github.com/pressly/goose/v3/lock"
+	"github.com/vedran77/pulse/migrations"
+)
+
+// NewMigrator returns a goose provider for the migrations embedded in the
+// binary. Applying or rolling back holds a Postgres advisory lock, so
+// replicas starting at the same time don't race.
+func NewMigrator(pool *pgxpool.Pool) (*goose.Provider, error) {
+	locker, err := lock.NewPostgresSessionLocker()
+	if err != nil {
+		return nil, fmt.Errorf("creating migration lock: %w", err)
+	}
+
+	// Closing this *sql.DB doesn't close the pool
+	db := stdlib.OpenDBFromPool(pool)
+	provider, err := goose.NewProvider(goose.DialectPostgres, db, migrations.FS,
+		goose.WithSessionLocker(locker),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("loading migrations: %w", err)
+	}
+	return provider, nil
+}
+
+// CheckSchema returns an error if any embedded migration hasn't been applied.
+func CheckSchema(ctx context.Context, migrator *goose.Provider) error {
+	pending, err := migrator.HasPending(ctx)
+	if err != nil {
+		return fmt.Errorf("checking migrations: %w", err)
+	}
+	if !pending {
+		return nil
+	}
+
+	current, target, err := migrator.GetVersions(ctx)
+	if err != nil {
+		return fmt.Errorf("checking migrations: %w", err)
+	}
+	return fmt.Errorf("database schema has pending migrations (at version %d, latest is %d)", current, target)
+}
@@ -7,15 +7,43 @@ import (
 )
 
 type Channel struct {
-	ID          uuid.UUID  `json:"id"`
-	WorkspaceID uuid.UUID  `json:"workspace_id"`
-	Name        string     `json:"name"`
-	Description *string    `json:"description,omitempty"`
-	Type        string     `json:"type"`
-	IsEncrypted bool       `json:"is_encrypted"`
-	CreatedBy   uuid.UUID  `json:"created_by"`
-	CreatedAt   time.Time  `json:"created_at"`
-	ArchivedAt  *time.Time `json:"archived_at,omitempty"`
+	ID            uuid.UUID `json:"id"`
+	WorkspaceID   uuid.UUID `json:"workspace_id"`
+	Name          string    `json:"name"`
+	Description   *string   `json:"description,omitempty"`
+	Topic         *string   `json:"topic,omitempty"`
+	Type          string    `json:"type"`
+	IsEncrypted   bool      `json:"is_encrypted"`
+	PostingPolicy string    `json:"posting_policy"`
+	// Minimum time between one member's messages, 0 = off
+	SlowModeSeconds int        `json:"slow_mode_seconds"`
+	CreatedBy       uuid.UUID  `json:"created_by"`
+	CreatedAt       time.Time  `json:"created_at"`
+	ArchivedAt      *time.Time `json:"archived_at,omitempty"`
+	// Counts as activity for the workspace's auto-archive policy
+	UnarchivedAt *time.Time `json:"-"`
+}
+
+// Who can post in a channel
+const (
+	PostingPolicyEveryone = "everyone"
+	PostingPolicyAdmins   = "admins" // read-only for members, as in announcement channels
+)
+
+// Channel member roles
+const (
+	ChannelRoleAdmin  = "admin"
+	ChannelRoleMember = "member"
+)
+
+// ChannelTopicChange records who set the channel topic and when. A nil
+// Topic means it was cleared.
+type ChannelTopicChange struct {
+	ID        uuid.UUID `json:"id"`
+	ChannelID uuid.UUID `json:"channel_id"`
+	Topic     *string   `json:"topic"`
+	ChangedBy uuid.UUID `json:"changed_by"`
+	ChangedAt time.Time `json:"changed_at"`
 }
 
 type ChannelMember struct {
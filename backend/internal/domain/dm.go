@@ -15,6 +15,33 @@ type DMConversation struct {
 	OtherUserID          uuid.UUID `json:"other_user_id"`
 	OtherUserUsername    string    `json:"other_username"`
 	OtherUserDisplayName string    `json:"other_display_name"`
+	// "online" or "offline", filled in by the service from live connections
+	OtherUserStatus string `json:"other_status"`
+	// The participant's view, filled in when listing conversations
+	LastMessage    *DMMessagePreview `json:"last_message,omitempty"`
+	LastActivityAt time.Time         `json:"last_activity_at"`
+	UnreadCount    int               `json:"unread_count"`
+	Muted          bool              `json:"muted"`
+}
+
+// DMMessagePreview is the newest message of a conversation, for the
+// conversation list.
+type DMMessagePreview struct {
+	ID        uuid.UUID `json:"id"`
+	SenderID  uuid.UUID `json:"sender_id"`
+	Content   string    `json:"content"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// DMParticipant holds one participant's settings for a conversation.
+type DMParticipant struct {
+	ConversationID uuid.UUID
+	UserID         uuid.UUID
+	// Messages from the other user after this are unread
+	LastReadAt *time.Time
+	// The conversation is hidden from the list until a newer message
+	HiddenAt *time.Time
+	Muted    bool
 }
 
 type DMMessage struct {
@@ -28,4 +55,6 @@ type DMMessage struct {
 	// Joined fields
 	SenderUsername    string `json:"sender_username,omitempty"`
 	SenderDisplayName string `json:"sender_display_name,omitempty"`
+	// Parsed Content, for clients to render
+	Markup []MarkupNode `json:"markup,omitempty"`
 }
@@ -0,0 +1,27 @@
+package domain
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// UserIdentity links a user to an account at an external OIDC provider.
+type UserIdentity struct {
+	ID          uuid.UUID  `json:"id"`
+	UserID      uuid.UUID  `json:"user_id"`
+	Issuer      string     `json:"issuer"`
+	Subject     string     `json:"subject"`
+	Email       string     `json:"email"`
+	CreatedAt   time.Time  `json:"created_at"`
+	LastLoginAt *time.Time `json:"last_login_at,omitempty"`
+}
+
+// OIDCLoginState is kept between redirecting to the provider and the callback.
+type OIDCLoginState struct {
+	StateHash    string
+	CodeVerifier string
+	Nonce        string
+	ExpiresAt    time.Time
+	CreatedAt    time.Time
+}
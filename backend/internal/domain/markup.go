@@ -0,0 +1,31 @@
+package domain
+
+// Markup node types. Block nodes (paragraph, code_block) are at the top
+// level; the others appear in a paragraph's children.
+const (
+	MarkupParagraph = "paragraph"
+	MarkupCodeBlock = "code_block"
+	MarkupText      = "text"
+	MarkupLineBreak = "line_break"
+	MarkupBold      = "bold"
+	MarkupItalic    = "italic"
+	MarkupCode      = "code"
+	MarkupLink      = "link"
+	MarkupMention   = "mention"
+	MarkupChannel   = "channel"
+)
+
+// MarkupNode is a node of parsed message content. Clients render nodes by
+// type and always treat Text as plain text, never as HTML.
+type MarkupNode struct {
+	Type string `json:"type"`
+	// Text of text, code and code_block nodes
+	Text string `json:"text,omitempty"`
+	// Language of a code_block, if given after the opening fence
+	Language string `json:"language,omitempty"`
+	// URL of a link; always http, https or mailto
+	URL string `json:"url,omitempty"`
+	// Name is the username of a mention or the name of a channel reference
+	Name     string       `json:"name,omitempty"`
+	Children []MarkupNode `json:"children,omitempty"`
+}
@@ -21,4 +21,18 @@ type Message struct {
 	// Joined fields
 	SenderUsername    string `json:"sender_username,omitempty"`
 	SenderDisplayName string `json:"sender_display_name,omitempty"`
+	// Parsed Content, for clients to render
+	Markup []MarkupNode `json:"markup,omitempty"`
+	// Link previews, filled in asynchronously after the message is sent
+	Embeds []MessageEmbed `json:"embeds,omitempty"`
+}
+
+// MessageEmbed is a preview of a link in the message, built from the page's
+// OpenGraph tags or oEmbed data.
+type MessageEmbed struct {
+	URL         string `json:"url"`
+	Title       string `json:"title,omitempty"`
+	Description string `json:"description,omitempty"`
+	ImageURL    string `json:"image_url,omitempty"`
+	SiteName    string `json:"site_name,omitempty"`
 }
@@ -0,0 +1,26 @@
+package domain
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type PinnedMessage struct {
+	MessageID uuid.UUID `json:"message_id"`
+	ChannelID uuid.UUID `json:"channel_id"`
+	PinnedBy  uuid.UUID `json:"pinned_by"`
+	PinnedAt  time.Time `json:"pinned_at"`
+	// Joined fields
+	Message *Message `json:"message,omitempty"`
+}
+
+// ChannelBookmark is a titled link shown in the channel header.
+type ChannelBookmark struct {
+	ID        uuid.UUID `json:"id"`
+	ChannelID uuid.UUID `json:"channel_id"`
+	Title     string    `json:"title"`
+	URL       string    `json:"url"`
+	CreatedBy uuid.UUID `json:"created_by"`
+	CreatedAt time.Time `json:"created_at"`
+}
@@ -0,0 +1,23 @@
+package domain
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// SavedItem is a channel message or DM a user saved for later. Exactly one
+// of MessageID and DMMessageID is set.
+type SavedItem struct {
+	ID          uuid.UUID  `json:"id"`
+	UserID      uuid.UUID  `json:"user_id"`
+	MessageID   *uuid.UUID `json:"message_id,omitempty"`
+	DMMessageID *uuid.UUID `json:"dm_message_id,omitempty"`
+	// RemindAt is when to remind the user; RemindedAt is set once the reminder fired
+	RemindAt   *time.Time `json:"remind_at,omitempty"`
+	RemindedAt *time.Time `json:"reminded_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	// Filled in by the service
+	Message   *Message   `json:"message,omitempty"`
+	DMMessage *DMMessage `json:"dm_message,omitempty"`
+}
@@ -0,0 +1,26 @@
+package domain
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ScheduledMessage is a channel message or DM queued to be sent at SendAt.
+// Exactly one of ChannelID and ConversationID is set.
+type ScheduledMessage struct {
+	ID             uuid.UUID  `json:"id"`
+	UserID         uuid.UUID  `json:"user_id"`
+	ChannelID      *uuid.UUID `json:"channel_id,omitempty"`
+	ConversationID *uuid.UUID `json:"conversation_id,omitempty"`
+	ParentID       *uuid.UUID `json:"parent_id,omitempty"`
+	Content        string     `json:"content"`
+	SendAt         time.Time  `json:"send_at"`
+	// Set when delivery failed for good; editing the message retries it
+	FailedAt *time.Time `json:"failed_at,omitempty"`
+	Error    *string    `json:"error,omitempty"`
+	// Deliveries that failed and may be retried
+	Attempts  int       `json:"-"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
@@ -0,0 +1,33 @@
+package domain
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+)
+
+// How a session was signed in
+const (
+	AuthMethodPassword = "password"
+	AuthMethodSSO      = "sso"
+)
+
+// Session is the signed-in user behind a request, as of its access token.
+type Session struct {
+	UserID           uuid.UUID
+	TwoFactorEnabled bool
+	AuthMethod       string
+}
+
+type sessionKey struct{}
+
+// WithSession returns a context carrying the request's session.
+func WithSession(ctx context.Context, s Session) context.Context {
+	return context.WithValue(ctx, sessionKey{}, s)
+}
+
+// SessionFrom returns the request's session. Background jobs have none.
+func SessionFrom(ctx context.Context) (Session, bool) {
+	s, ok := ctx.Value(sessionKey{}).(Session)
+	return s, ok
+}
@@ -0,0 +1,26 @@
+package domain
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Verification token purposes
+const (
+	TokenPurposeVerifyEmail   = "verify_email"
+	TokenPurposeResetPassword = "reset_password"
+	TokenPurposeChangeEmail   = "change_email"
+)
+
+// VerificationToken is a single-use token sent to the user by email.
+// Only the SHA-256 hash of the token is stored.
+type VerificationToken struct {
+	ID        uuid.UUID
+	UserID    uuid.UUID
+	Purpose   string
+	TokenHash string
+	ExpiresAt time.Time
+	UsedAt    *time.Time
+	CreatedAt time.Time
+}
@@ -0,0 +1,22 @@
+package domain
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// TwoFactor holds a user's TOTP enrollment. Secret is encrypted at rest.
+type TwoFactor struct {
+	UserID       uuid.UUID
+	Secret       []byte
+	ConfirmedAt  *time.Time
+	LastUsedStep int64
+	CreatedAt    time.Time
+}
+
+// TwoFactorEnrollment is returned when a user starts setting up an authenticator app.
+type TwoFactorEnrollment struct {
+	Secret     string `json:"secret"`
+	OTPAuthURI string `json:"otpauth_uri"`
+}
@@ -17,4 +17,19 @@ type User struct {
 	Status       string    `json:"status"`
 	CreatedAt    time.Time `json:"created_at"`
 	UpdatedAt    time.Time `json:"updated_at"`
+
+	EmailVerifiedAt *time.Time `json:"email_verified_at,omitempty"`
+	// Requested new address, applied once the link sent to it is opened
+	PendingEmail     *string `json:"pending_email,omitempty"`
+	TwoFactorEnabled bool    `json:"two_factor_enabled"`
+	// Incremented on password change; tokens with an older version are rejected
+	TokenVersion int `json:"-"`
+
+	// Consecutive failed logins; the account is locked when it reaches the limit
+	FailedLoginAttempts int        `json:"-"`
+	LockedUntil         *time.Time `json:"-"`
+
+	// Set when the account was deleted; the row stays, anonymized, so the
+	// user's messages keep their sender
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
 }
@@ -13,6 +13,43 @@ type Workspace struct {
 	Description *string   `json:"description,omitempty"`
 	OwnerID     uuid.UUID `json:"owner_id"`
 	CreatedAt   time.Time `json:"created_at"`
+	// Whether domain-based joins need admin approval
+	JoinRequiresApproval bool `json:"join_requires_approval"`
+	// Members must have two-factor authentication enabled to access the workspace
+	RequireTwoFactor bool `json:"require_two_factor"`
+	// Members must sign in through the SSO provider
+	RequireSSO bool `json:"require_sso"`
+	// Channels with no messages for this many days are archived, nil = never
+	AutoArchiveDays *int `json:"auto_archive_days,omitempty"`
+	// Set while a deleted workspace can still be restored, before it's purged
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+}
+
+// WorkspaceJoinPolicy controls who can join a workspace without an invite.
+type WorkspaceJoinPolicy struct {
+	AllowedDomains   []string `json:"allowed_domains"`
+	RequiresApproval bool     `json:"requires_approval"`
+}
+
+// DiscoverableWorkspace is a workspace the user can join through their email domain.
+type DiscoverableWorkspace struct {
+	Workspace
+	MemberCount       int  `json:"member_count"`
+	HasPendingRequest bool `json:"has_pending_request"`
+}
+
+type WorkspaceJoinRequest struct {
+	ID          uuid.UUID  `json:"id"`
+	WorkspaceID uuid.UUID  `json:"workspace_id"`
+	UserID      uuid.UUID  `json:"user_id"`
+	Status      string     `json:"status"`
+	CreatedAt   time.Time  `json:"created_at"`
+	DecidedBy   *uuid.UUID `json:"decided_by,omitempty"`
+	DecidedAt   *time.Time `json:"decided_at,omitempty"`
+	// Joined fields
+	Username    string `json:"username,omitempty"`
+	DisplayName string `json:"display_name,omitempty"`
+	Email       string `json:"email,omitempty"`
 }
 
 type WorkspaceMember struct {
@@ -20,20 +57,37 @@ type WorkspaceMember struct {
 	UserID      uuid.UUID `json:"user_id"`
 	Role        string    `json:"role"`
 	JoinedAt    time.Time `json:"joined_at"`
+	// Profile fields the member sets for this workspace
+	Title    *string `json:"title,omitempty"`
+	Timezone *string `json:"timezone,omitempty"`
+	Pronouns *string `json:"pronouns,omitempty"`
 	// Joined fields
-	Username    string `json:"username,omitempty"`
-	DisplayName string `json:"display_name,omitempty"`
+	Username    string  `json:"username,omitempty"`
+	DisplayName string  `json:"display_name,omitempty"`
+	AvatarURL   *string `json:"avatar_url,omitempty"`
+	// Only filled in for workspace admins
+	Email string `json:"email,omitempty"`
 }
 
+// Invite types
+const (
+	InviteTypeEmail = "email" // single-use, bound to Email
+	InviteTypeLink  = "link"  // shareable, usable by anyone until MaxUses is reached
+)
+
 type WorkspaceInvite struct {
 	ID          uuid.UUID  `json:"id"`
 	WorkspaceID uuid.UUID  `json:"workspace_id"`
-	Email       string     `json:"email"`
+	Type        string     `json:"type"`
+	Email       string     `json:"email,omitempty"`
 	Token       string     `json:"token,omitempty"`
+	Role        string     `json:"role"`
+	MaxUses     *int       `json:"max_uses,omitempty"` // nil = unlimited
+	UseCount    int        `json:"use_count"`
 	InvitedBy   uuid.UUID  `json:"invited_by"`
 	CreatedAt   time.Time  `json:"created_at"`
 	ExpiresAt   time.Time  `json:"expires_at"`
-	AcceptedAt  *time.Time `json:"accepted_at,omitempty"`
+	AcceptedAt  *time.Time `json:"accepted_at,omitempty"` // set once the invite is used up
 	AcceptedBy  *uuid.UUID `json:"accepted_by,omitempty"`
 
 	// Joined field for accept page
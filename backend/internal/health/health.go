@@ -0,0 +1,104 @@
+// Package health serves liveness and readiness probes built from named
+// dependency checks.
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// checkTimeout bounds each check so a hung dependency fails the probe
+// instead of hanging it.
+const checkTimeout = 2 * time.Second
+
+// CheckFunc reports whether a dependency is healthy. The detail string is
+// included in the response either way, e.g. a schema version.
+type CheckFunc func(ctx context.Context) (detail string, err error)
+
+type check struct {
+	name string
+	fn   CheckFunc
+}
+
+// Checker runs a set of checks and serves the combined result as JSON.
+type Checker struct {
+	checks []check
+}
+
+func NewChecker() *Checker {
+	return &Checker{}
+}
+
+// Add registers a named check.
+func (c *Checker) Add(name string, fn CheckFunc) {
+	c.checks = append(c.checks, check{name, fn})
+}
+
+type Result struct {
+	Status     string  `json:"status"`
+	Detail     string  `json:"detail,omitempty"`
+	Error      string  `json:"error,omitempty"`
+	DurationMs float64 `json:"duration_ms"`
+}
+
+type Response struct {
+	Status string            `json:"status"`
+	Checks map[string]Result `json:"checks"`
+}
+
+const (
+	StatusOK   = "ok"
+	StatusFail = "fail"
+)
+
+// Run executes all checks concurrently.
+func (c *Checker) Run(ctx context.Context) Response {
+	resp := Response{Status: StatusOK, Checks: make(map[string]Result, len(c.checks))}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, chk := range c.checks {
+		wg.Go(func() {
+			ctx, cancel := context.WithTimeout(ctx, checkTimeout)
+			defer cancel()
+
+			start := time.Now()
+			detail, err := chk.fn(ctx)
+			res := Result{
+				Status:     StatusOK,
+				Detail:     detail,
+				DurationMs: float64(time.Since(start).Microseconds()) / 1000,
+			}
+			if err != nil {
+				res.Status = StatusFail
+				res.Error = err.Error()
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			resp.Checks[chk.name] = res
+			if err != nil {
+				resp.Status = StatusFail
+			}
+		})
+	}
+	wg.Wait()
+	return resp
+}
+
+// ServeHTTP responds 200 when every check passes and 503 otherwise.
+func (c *Checker) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	resp := c.Run(r.Context())
+
+	status := http.StatusOK
+	if resp.Status != StatusOK {
+		status = http.StatusServiceUnavailable
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(resp)
+}
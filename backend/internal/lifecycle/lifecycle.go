@@ -0,0 +1,178 @@
+// Package lifecycle coordinates graceful shutdown of the server: it waits
+// for SIGINT/SIGTERM, then stops servers, background workers and finally
+// shared resources, all within one deadline.
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+type hook struct {
+	name string
+	fn   func(ctx context.Context) error
+}
+
+type Manager struct {
+	// ctx is handed to workers and cancelled when shutdown starts
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu       sync.Mutex
+	stoppers []hook
+	closers  []hook
+	workers  sync.WaitGroup
+
+	draining   atomic.Bool
+	drainDelay time.Duration
+	errs       chan error
+}
+
+func New() *Manager {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Manager{
+		ctx:    ctx,
+		cancel: cancel,
+		errs:   make(chan error, 1),
+	}
+}
+
+// Context is cancelled as soon as shutdown starts.
+func (m *Manager) Context() context.Context {
+	return m.ctx
+}
+
+// Draining reports whether shutdown has started.
+func (m *Manager) Draining() bool {
+	return m.draining.Load()
+}
+
+// SetDrainDelay makes shutdown wait after Draining starts reporting true and
+// before servers stop, so load balancers polling readiness can take the
+// instance out of rotation first.
+func (m *Manager) SetDrainDelay(d time.Duration) {
+	m.drainDelay = d
+}
+
+// OnShutdown registers a server to stop first, e.g. http.Server.Shutdown.
+// Hooks run in reverse order of registration.
+func (m *Manager) OnShutdown(name string, fn func(ctx context.Context) error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.stoppers = append(m.stoppers, hook{name, fn})
+}
+
+// OnClose registers a resource to release after servers and workers have
+// stopped, e.g. the database pool. Closers run in reverse order of registration.
+func (m *Manager) OnClose(name string, fn func() error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.closers = append(m.closers, hook{name, func(context.Context) error { return fn() }})
+}
+
+// Go runs a background worker. Its context is cancelled at shutdown and
+// shutdown waits for it to return.
+func (m *Manager) Go(name string, fn func(ctx context.Context)) {
+	m.workers.Add(1)
+	go func() {
+		defer m.workers.Done()
+		fn(m.ctx)
+		if m.ctx.Err() == nil {
+			slog.Warn("lifecycle: worker exited early", "worker", name)
+		}
+	}()
+}
+
+// Fail reports a fatal error from a component, such as a server that
+// couldn't listen, and triggers shutdown.
+func (m *Manager) Fail(err error) {
+	select {
+	case m.errs <- err:
+	default:
+	}
+}
+
+// Wait blocks until a termination signal or Fail, then shuts down with the
+// given deadline. It returns the failure that triggered shutdown, if any,
+// joined with errors from stopping components.
+func (m *Manager) Wait(timeout time.Duration) error {
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(sig)
+
+	var cause error
+	select {
+	case s := <-sig:
+		slog.Info("lifecycle: shutting down", "signal", s.String())
+	case cause = <-m.errs:
+		slog.Error("lifecycle: shutting down", "err", cause)
+	}
+
+	return errors.Join(cause, m.Shutdown(timeout))
+}
+
+// Shutdown stops servers, then waits for workers, then closes resources.
+func (m *Manager) Shutdown(timeout time.Duration) error {
+	m.draining.Store(true)
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	if m.drainDelay > 0 {
+		slog.Info("lifecycle: draining", "delay", m.drainDelay)
+		select {
+		case <-time.After(m.drainDelay):
+		case <-ctx.Done():
+		}
+	}
+
+	m.mu.Lock()
+	stoppers := m.stoppers
+	closers := m.closers
+	m.mu.Unlock()
+
+	var errs []error
+	errs = append(errs, runHooks(ctx, stoppers)...)
+
+	// Workers stop after the servers so in-flight requests can still enqueue work
+	m.cancel()
+	done := make(chan struct{})
+	go func() {
+		m.workers.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		errs = append(errs, errors.New("background workers did not stop before the deadline"))
+	}
+
+	errs = append(errs, runHooks(ctx, closers)...)
+
+	if err := errors.Join(errs...); err != nil {
+		return err
+	}
+	slog.Info("lifecycle: shutdown complete")
+	return nil
+}
+
+func runHooks(ctx context.Context, hooks []hook) []error {
+	var errs []error
+	for i := len(hooks) - 1; i >= 0; i-- {
+		h := hooks[i]
+		start := time.Now()
+		if err := h.fn(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("stopping %s: %w", h.name, err))
+			continue
+		}
+		slog.Info("lifecycle: stopped", "component", h.name, "took", time.Since(start).Round(time.Millisecond))
+	}
+	return errs
+}
@@ -0,0 +1,82 @@
+package mail
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	netmail "net/mail"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+// LogMailer writes emails to the server log instead of sending them.
+// Used in development when no SMTP server is configured.
+type LogMailer struct{}
+
+func NewLogMailer() *LogMailer {
+	return &LogMailer{}
+}
+
+func (m *LogMailer) Send(ctx context.Context, to, subject, body string) error {
+	slog.InfoContext(ctx, "mail: not sent, SMTP not configured", "to", to, "subject", subject, "body", body)
+	return nil
+}
+
+// SMTPMailer sends plain-text email through an SMTP server.
+type SMTPMailer struct {
+	addr string
+	auth smtp.Auth
+	from string
+}
+
+func NewSMTPMailer(host, port, username, password, from string) *SMTPMailer {
+	var auth smtp.Auth
+	if username != "" {
+		auth = smtp.PlainAuth("", username, password, host)
+	}
+	return &SMTPMailer{
+		addr: host + ":" + port,
+		auth: auth,
+		from: from,
+	}
+}
+
+func (m *SMTPMailer) Send(ctx context.Context, to, subject, body string) error {
+	from, err := netmail.ParseAddress(m.from)
+	if err != nil {
+		return fmt.Errorf("parsing from address: %w", err)
+	}
+	rcpt, err := netmail.ParseAddress(to)
+	if err != nil {
+		return fmt.Errorf("parsing recipient address: %w", err)
+	}
+
+	var msg strings.Builder
+	msg.WriteString("From: " + from.String() + "\r\n")
+	msg.WriteString("To: " + rcpt.String() + "\r\n")
+	msg.WriteString("Subject: " + stripNewlines(subject) + "\r\n")
+	msg.WriteString("Date: " + time.Now().Format(time.RFC1123Z) + "\r\n")
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	msg.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	msg.WriteString("\r\n")
+	msg.WriteString(strings.ReplaceAll(body, "\n", "\r\n"))
+
+	// net/smtp has no context support, so honour cancellation around the call
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- smtp.SendMail(m.addr, m.auth, from.Address, []string{rcpt.Address}, []byte(msg.String()))
+	}()
+
+	select {
+	case err := <-errCh:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// stripNewlines prevents header injection through user-controlled values.
+func stripNewlines(s string) string {
+	return strings.NewReplacer("\r", "", "\n", " ").Replace(s)
+}
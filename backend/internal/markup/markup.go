@@ -0,0 +1,50 @@
+// Package markup validates message content and parses the Markdown subset
+// Pulse supports into an AST, so every client renders a message the same
+// way: fenced code blocks, `inline code`, **bold**, _italic_, links,
+// @mentions and #channel references. Everything else is plain text.
+package markup
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// MaxLength is the longest message content, in characters.
+const MaxLength = 4000
+
+var (
+	ErrEmpty            = errors.New("message content is required")
+	ErrTooLong          = fmt.Errorf("message content is longer than %d characters", MaxLength)
+	ErrControlCharacter = errors.New("message content contains control characters")
+)
+
+// Normalize prepares content for storage: line endings become \n, text is
+// converted to Unicode NFC so equal-looking strings compare equal, and
+// surrounding whitespace is trimmed. Control characters other than newline
+// and tab are rejected.
+func Normalize(s string) (string, error) {
+	s = strings.ReplaceAll(s, "\r\n", "\n")
+	s = strings.ReplaceAll(s, "\r", "\n")
+	if !utf8.ValidString(s) {
+		return "", ErrControlCharacter
+	}
+	for _, r := range s {
+		if unicode.IsControl(r) && r != '\n' && r != '\t' {
+			return "", ErrControlCharacter
+		}
+	}
+
+	s = strings.TrimSpace(norm.NFC.String(s))
+	if s == "" {
+		return "", ErrEmpty
+	}
+	if utf8.RuneCountInString(s) > MaxLength {
+		return "", ErrTooLong
+	}
+	return s, nil
+}
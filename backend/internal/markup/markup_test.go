@@ -0,0 +1,107 @@
+package markup
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/vedran77/pulse/internal/domain"
+)
+
+func TestNormalize(t *testing.T) {
+	for _, tc := range []struct {
+		in, want string
+		err      error
+	}{
+		{in: "  hello\r\nworld\t ", want: "hello\nworld"},
+		// e + combining acute accent becomes é
+		{in: "cafe\u0301", want: "caf\u00e9"},
+		{in: "tab\tand\nnewline", want: "tab\tand\nnewline"},
+		{in: " \n\t ", err: ErrEmpty},
+		{in: "", err: ErrEmpty},
+		{in: "bell\a", err: ErrControlCharacter},
+		{in: "null\x00byte", err: ErrControlCharacter},
+		{in: "c1\u0085control", err: ErrControlCharacter},
+		{in: "bad \xff utf-8", err: ErrControlCharacter},
+		{in: strings.Repeat("é", MaxLength), want: strings.Repeat("é", MaxLength)},
+		{in: strings.Repeat("a", MaxLength+1), err: ErrTooLong},
+	} {
+		got, err := Normalize(tc.in)
+		if !errors.Is(err, tc.err) || got != tc.want {
+			t.Errorf("Normalize(%q) = %q, %v; want %q, %v", tc.in, got, err, tc.want, tc.err)
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	for _, tc := range []struct{ in, want string }{
+		{"plain text", `p(t"plain text")`},
+		{"one\ntwo\n\n\nthree", `p(t"one" br t"two") p(t"three")`},
+		{"**bold** and _italic_", `p(b(t"bold") t" and " i(t"italic"))`},
+		{"**_both_**", `p(b(i(t"both")))`},
+		{"snake_case_name and 2*3*4 and ** spaced **", `p(t"snake_case_name and 2*3*4 and ** spaced **")`},
+		{"unclosed **bold and _italic", `p(t"unclosed **bold and _italic")`},
+		{"run `go test ./...` now", `p(t"run " c"go test ./..." t" now")`},
+		{"`**not bold**`", `p(c"**not bold**")`},
+		{`\*\*escaped\*\* \@here \#general`, `p(t"**escaped** @here #general")`},
+		{"see [the PR](https://example.com/pr/1).", `p(t"see " a"https://example.com/pr/1"(t"the PR") t".")`},
+		{"[**bold** link](http://example.com)", `p(a"http://example.com"(b(t"bold") t" link"))`},
+		{"[mail](mailto:ops@example.com)", `p(a"mailto:ops@example.com"(t"mail"))`},
+		{"[xss](javascript:alert(1)) [data](data:text/html,x)", `p(t"[xss](javascript:alert(1)) [data](data:text/html,x)")`},
+		{"[nested https://a.example](https://b.example)", `p(a"https://b.example"(t"nested https://a.example"))`},
+		{"go to https://example.com/a_b?x=1, now", `p(t"go to " a"https://example.com/a_b?x=1"(t"https://example.com/a_b?x=1") t", now")`},
+		{"<script>alert(1)</script>", `p(t"<script>alert(1)</script>")`},
+		{"hey @alice-b, see #général and #ops_2", `p(t"hey " @"alice-b" t", see " #"général" t" and " #"ops_2")`},
+		{"mail bob@example.com about issue #42", `p(t"mail bob@example.com about issue #42")`},
+		{"```go\nfunc main() {\n\t**x**\n}\n```\nafter", `pre"go""func main() {\n\t**x**\n}" p(t"after")`},
+		{"before\n```\nnot closed\n\nstill code", `p(t"before") pre"""not closed\n\nstill code"`},
+		{"```one line```", `pre"""one line"`},
+		{"```select 1\nfrom t```", `pre"""select 1\nfrom t"`},
+	} {
+		if got := dump(Parse(tc.in)); got != tc.want {
+			t.Errorf("Parse(%q)\n got %s\nwant %s", tc.in, got, tc.want)
+		}
+	}
+}
+
+func TestLinks(t *testing.T) {
+	nodes := Parse("[docs](https://docs.example) `https://in.code` HTTPS://upper.example\n```\nhttps://in.block\n```\n**https://bold.example** [mail](mailto:a@b.c)")
+	got := strings.Join(Links(nodes), " ")
+	if want := "https://docs.example HTTPS://upper.example https://bold.example"; got != want {
+		t.Fatalf("Links = %s, want %s", got, want)
+	}
+}
+
+// dump prints nodes compactly: p(...) paragraph, pre"lang""code", t"text",
+// br, b(...) bold, i(...) italic, c"code", a"url"(...) link, @"name", #"name".
+func dump(nodes []domain.MarkupNode) string {
+	parts := make([]string, len(nodes))
+	for i, n := range nodes {
+		switch n.Type {
+		case domain.MarkupParagraph:
+			parts[i] = "p(" + dump(n.Children) + ")"
+		case domain.MarkupCodeBlock:
+			parts[i] = fmt.Sprintf("pre%q%q", n.Language, n.Text)
+		case domain.MarkupText:
+			parts[i] = fmt.Sprintf("t%q", n.Text)
+		case domain.MarkupLineBreak:
+			parts[i] = "br"
+		case domain.MarkupBold:
+			parts[i] = "b(" + dump(n.Children) + ")"
+		case domain.MarkupItalic:
+			parts[i] = "i(" + dump(n.Children) + ")"
+		case domain.MarkupCode:
+			parts[i] = fmt.Sprintf("c%q", n.Text)
+		case domain.MarkupLink:
+			parts[i] = fmt.Sprintf("a%q(%s)", n.URL, dump(n.Children))
+		case domain.MarkupMention:
+			parts[i] = fmt.Sprintf("@%q", n.Name)
+		case domain.MarkupChannel:
+			parts[i] = fmt.Sprintf("#%q", n.Name)
+		default:
+			parts[i] = "?" + n.Type
+		}
+	}
+	return strings.Join(parts, " ")
+}
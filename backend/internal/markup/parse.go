@@ -0,0 +1,273 @@
+package markup
+
+import (
+	"net/url"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/vedran77/pulse/internal/domain"
+)
+
+const fence = "```"
+
+// escapable are the characters a backslash makes literal.
+const escapable = "\\`*_[]()@#"
+
+var (
+	languagePattern = regexp.MustCompile(`^[A-Za-z0-9_+#.-]{1,32}$`)
+	autolinkPattern = regexp.MustCompile("^(?i)https?://[^\\s<>\"'`]+")
+	mentionPattern  = regexp.MustCompile(`^[A-Za-z0-9_-]+`)
+	channelPattern  = regexp.MustCompile(`^\pL[\pL\pN_-]*`)
+)
+
+// Parse parses normalized content into paragraphs and code blocks.
+func Parse(s string) []domain.MarkupNode {
+	var blocks []domain.MarkupNode
+	var para []string
+	flush := func() {
+		if len(para) > 0 {
+			blocks = append(blocks, domain.MarkupNode{
+				Type:     domain.MarkupParagraph,
+				Children: parseInline(strings.Join(para, "\n"), true),
+			})
+			para = nil
+		}
+	}
+
+	lines := strings.Split(s, "\n")
+	for i := 0; i < len(lines); i++ {
+		rest, ok := strings.CutPrefix(strings.TrimSpace(lines[i]), fence)
+		if !ok {
+			if strings.TrimSpace(lines[i]) == "" {
+				flush()
+			} else {
+				para = append(para, lines[i])
+			}
+			continue
+		}
+
+		flush()
+		block := domain.MarkupNode{Type: domain.MarkupCodeBlock}
+		// ```code``` on one line
+		if code, ok := strings.CutSuffix(rest, fence); ok {
+			block.Text = code
+			blocks = append(blocks, block)
+			continue
+		}
+		var code []string
+		if languagePattern.MatchString(rest) {
+			block.Language = rest
+		} else if rest != "" {
+			// ```code starting on the fence line
+			code = append(code, rest)
+		}
+		// The block ends at a line ending with a fence, or at the end of
+		// the message if it's never closed
+		for i++; i < len(lines); i++ {
+			if last, ok := strings.CutSuffix(strings.TrimRight(lines[i], " \t"), fence); ok {
+				if strings.TrimSpace(last) != "" {
+					code = append(code, last)
+				}
+				break
+			}
+			code = append(code, lines[i])
+		}
+		block.Text = strings.Join(code, "\n")
+		blocks = append(blocks, block)
+	}
+	flush()
+	return blocks
+}
+
+// parseInline parses the text of a paragraph. Links aren't parsed inside
+// link text, since they can't nest.
+func parseInline(s string, links bool) []domain.MarkupNode {
+	var nodes []domain.MarkupNode
+	var text strings.Builder
+	emit := func(n domain.MarkupNode) {
+		if text.Len() > 0 {
+			nodes = append(nodes, domain.MarkupNode{Type: domain.MarkupText, Text: text.String()})
+			text.Reset()
+		}
+		nodes = append(nodes, n)
+	}
+
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case c == '\\' && i+1 < len(s) && strings.IndexByte(escapable, s[i+1]) >= 0:
+			text.WriteByte(s[i+1])
+			i += 2
+			continue
+
+		case c == '\n':
+			emit(domain.MarkupNode{Type: domain.MarkupLineBreak})
+			i++
+			continue
+
+		case c == '`':
+			if end := strings.IndexByte(s[i+1:], '`'); end > 0 {
+				emit(domain.MarkupNode{Type: domain.MarkupCode, Text: s[i+1 : i+1+end]})
+				i += end + 2
+				continue
+			}
+
+		case strings.HasPrefix(s[i:], "**"):
+			inner := s[i+2:]
+			if end := strings.Index(inner, "**"); end > 0 && !isSpace(inner[0]) && !isSpace(inner[end-1]) {
+				emit(domain.MarkupNode{Type: domain.MarkupBold, Children: parseInline(inner[:end], links)})
+				i += end + 4
+				continue
+			}
+
+		case c == '_' && !wordBefore(s, i):
+			if end := closingUnderscore(s, i+1); end > 0 {
+				emit(domain.MarkupNode{Type: domain.MarkupItalic, Children: parseInline(s[i+1:end], links)})
+				i = end + 1
+				continue
+			}
+
+		case c == '[' && links:
+			if label, target, n, ok := linkAt(s[i:]); ok {
+				emit(domain.MarkupNode{Type: domain.MarkupLink, URL: target, Children: parseInline(label, false)})
+				i += n
+				continue
+			}
+
+		case (c == 'h' || c == 'H') && links && !wordBefore(s, i):
+			if link := autolinkAt(s[i:]); link != "" {
+				emit(domain.MarkupNode{
+					Type:     domain.MarkupLink,
+					URL:      link,
+					Children: []domain.MarkupNode{{Type: domain.MarkupText, Text: link}},
+				})
+				i += len(link)
+				continue
+			}
+
+		case c == '@' && !wordBefore(s, i):
+			if name := mentionPattern.FindString(s[i+1:]); name != "" {
+				emit(domain.MarkupNode{Type: domain.MarkupMention, Name: name})
+				i += 1 + len(name)
+				continue
+			}
+
+		case c == '#' && !wordBefore(s, i):
+			if name := channelPattern.FindString(s[i+1:]); name != "" {
+				emit(domain.MarkupNode{Type: domain.MarkupChannel, Name: name})
+				i += 1 + len(name)
+				continue
+			}
+		}
+		text.WriteByte(c)
+		i++
+	}
+	if text.Len() > 0 {
+		nodes = append(nodes, domain.MarkupNode{Type: domain.MarkupText, Text: text.String()})
+	}
+	return nodes
+}
+
+// closingUnderscore finds the underscore closing italic text that starts at
+// start. Underscores inside words, as in snake_case, don't count.
+func closingUnderscore(s string, start int) int {
+	if start >= len(s) || isSpace(s[start]) {
+		return -1
+	}
+	for j := start + 1; j < len(s); j++ {
+		if s[j] == '_' && !isSpace(s[j-1]) && !wordAt(s, j+1) {
+			return j
+		}
+	}
+	return -1
+}
+
+// linkAt parses a [label](url) link at the start of s and returns its
+// length. Only http, https and mailto URLs are links.
+func linkAt(s string) (label, target string, n int, ok bool) {
+	mid := strings.Index(s, "](")
+	if mid < 2 {
+		return "", "", 0, false
+	}
+	end := strings.IndexByte(s[mid+2:], ')')
+	if end < 0 {
+		return "", "", 0, false
+	}
+	label, target = s[1:mid], strings.TrimSpace(s[mid+2:mid+2+end])
+	if strings.ContainsAny(label, "[\n") || strings.ContainsAny(target, " \t\n") {
+		return "", "", 0, false
+	}
+	u, err := url.Parse(target)
+	if err != nil {
+		return "", "", 0, false
+	}
+	switch u.Scheme {
+	case "http", "https":
+		ok = u.Host != ""
+	case "mailto":
+		ok = u.Opaque != ""
+	}
+	return label, target, mid + 3 + end, ok
+}
+
+// autolinkAt returns the bare http(s) URL at the start of s, without
+// punctuation that ends the sentence around it.
+func autolinkAt(s string) string {
+	link := trimLink(autolinkPattern.FindString(s))
+	if u, err := url.Parse(link); err != nil || u.Host == "" {
+		return ""
+	}
+	return link
+}
+
+// trimLink strips trailing punctuation from a URL found in text. A closing
+// parenthesis is kept only if the URL opened one, as in Wikipedia links.
+func trimLink(link string) string {
+	for {
+		trimmed := strings.TrimRight(link, ".,:;!?*_~")
+		if strings.HasSuffix(trimmed, ")") && strings.Count(trimmed, "(") < strings.Count(trimmed, ")") {
+			trimmed = trimmed[:len(trimmed)-1]
+		}
+		if trimmed == link {
+			return link
+		}
+		link = trimmed
+	}
+}
+
+// Links returns the http(s) URLs linked from nodes, in order.
+func Links(nodes []domain.MarkupNode) []string {
+	var links []string
+	for _, n := range nodes {
+		if n.Type == domain.MarkupLink {
+			if u, err := url.Parse(n.URL); err == nil && (u.Scheme == "http" || u.Scheme == "https") {
+				links = append(links, n.URL)
+			}
+		}
+		links = append(links, Links(n.Children)...)
+	}
+	return links
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n'
+}
+
+// wordBefore reports whether the character before s[i] is part of a word,
+// so markers like @ and _ in the middle of e-mail addresses and identifiers
+// stay text.
+func wordBefore(s string, i int) bool {
+	r, _ := utf8.DecodeLastRuneInString(s[:i])
+	return i > 0 && isWord(r)
+}
+
+func wordAt(s string, i int) bool {
+	r, _ := utf8.DecodeRuneInString(s[i:])
+	return i < len(s) && isWord(r)
+}
+
+func isWord(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
@@ -0,0 +1,143 @@
+// Package metrics exposes Prometheus metrics for HTTP requests, the
+// WebSocket hub and the database pool.
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/vedran77/pulse/internal/transport/ws"
+)
+
+const namespace = "pulse"
+
+type Metrics struct {
+	registry *prometheus.Registry
+
+	httpDuration *prometheus.HistogramVec
+	httpInFlight prometheus.Gauge
+}
+
+func New() *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		httpDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: "http",
+			Name:      "request_duration_seconds",
+			Help:      "HTTP request latency by route and status.",
+			Buckets:   []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5},
+		}, []string{"method", "route", "status"}),
+		httpInFlight: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: "http",
+			Name:      "requests_in_flight",
+			Help:      "HTTP requests currently being served.",
+		}),
+	}
+
+	m.registry.MustRegister(
+		m.httpDuration,
+		m.httpInFlight,
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+	return m
+}
+
+// Handler serves the metrics in the Prometheus exposition format.
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+// ObserveRequest records a finished HTTP request. route is the matched
+// ServeMux pattern so cardinality stays bounded.
+func (m *Metrics) ObserveRequest(method, route string, status int, d time.Duration) {
+	m.httpDuration.WithLabelValues(method, route, strconv.Itoa(status)).Observe(d.Seconds())
+}
+
+// RequestStarted increments the in-flight gauge; call the returned func when done.
+func (m *Metrics) RequestStarted() func() {
+	m.httpInFlight.Inc()
+	return m.httpInFlight.Dec
+}
+
+// RegisterHub exports WebSocket hub statistics.
+func (m *Metrics) RegisterHub(hub *ws.Hub) {
+	m.registry.MustRegister(
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: "ws",
+			Name:      "connections",
+			Help:      "Open WebSocket connections.",
+		}, func() float64 { return float64(hub.Stats().Clients) }),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: "ws",
+			Name:      "broadcast_queue_depth",
+			Help:      "Events waiting to be fanned out by the hub.",
+		}, func() float64 { return float64(hub.Stats().QueueDepth) }),
+		prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "ws",
+			Name:      "dropped_clients_total",
+			Help:      "Clients disconnected because they couldn't keep up.",
+		}, func() float64 { return float64(hub.Stats().Dropped) }),
+	)
+}
+
+// RegisterPool exports pgx connection pool statistics.
+func (m *Metrics) RegisterPool(pool *pgxpool.Pool) {
+	m.registry.MustRegister(&poolCollector{pool: pool})
+}
+
+var (
+	poolAcquired = prometheus.NewDesc(namespace+"_db_pool_acquired_conns",
+		"Connections currently in use.", nil, nil)
+	poolIdle = prometheus.NewDesc(namespace+"_db_pool_idle_conns",
+		"Idle connections.", nil, nil)
+	poolTotal = prometheus.NewDesc(namespace+"_db_pool_total_conns",
+		"Open connections, including ones being established.", nil, nil)
+	poolMax = prometheus.NewDesc(namespace+"_db_pool_max_conns",
+		"Maximum pool size.", nil, nil)
+	poolAcquires = prometheus.NewDesc(namespace+"_db_pool_acquires_total",
+		"Successful connection acquires.", nil, nil)
+	poolEmptyAcquires = prometheus.NewDesc(namespace+"_db_pool_empty_acquires_total",
+		"Acquires that had to wait because no idle connection was available.", nil, nil)
+	poolCanceledAcquires = prometheus.NewDesc(namespace+"_db_pool_canceled_acquires_total",
+		"Acquires canceled by their context.", nil, nil)
+	poolAcquireSeconds = prometheus.NewDesc(namespace+"_db_pool_acquire_seconds_total",
+		"Total time spent waiting for connections.", nil, nil)
+)
+
+type poolCollector struct {
+	pool *pgxpool.Pool
+}
+
+func (c *poolCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- poolAcquired
+	ch <- poolIdle
+	ch <- poolTotal
+	ch <- poolMax
+	ch <- poolAcquires
+	ch <- poolEmptyAcquires
+	ch <- poolCanceledAcquires
+	ch <- poolAcquireSeconds
+}
+
+func (c *poolCollector) Collect(ch chan<- prometheus.Metric) {
+	s := c.pool.Stat()
+	ch <- prometheus.MustNewConstMetric(poolAcquired, prometheus.GaugeValue, float64(s.AcquiredConns()))
+	ch <- prometheus.MustNewConstMetric(poolIdle, prometheus.GaugeValue, float64(s.IdleConns()))
+	ch <- prometheus.MustNewConstMetric(poolTotal, prometheus.GaugeValue, float64(s.TotalConns()))
+	ch <- prometheus.MustNewConstMetric(poolMax, prometheus.GaugeValue, float64(s.MaxConns()))
+	ch <- prometheus.MustNewConstMetric(poolAcquires, prometheus.CounterValue, float64(s.AcquireCount()))
+	ch <- prometheus.MustNewConstMetric(poolEmptyAcquires, prometheus.CounterValue, float64(s.EmptyAcquireCount()))
+	ch <- prometheus.MustNewConstMetric(poolCanceledAcquires, prometheus.CounterValue, float64(s.CanceledAcquireCount()))
+	ch <- prometheus.MustNewConstMetric(poolAcquireSeconds, prometheus.CounterValue, s.AcquireDuration().Seconds())
+}
@@ -0,0 +1,110 @@
+package oidc
+
+import (
+	"context"
+	"crypto/rsa"
+	"encoding/base64"
+	"fmt"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Minimum time between JWKS refetches triggered by an unknown key ID
+const jwksRefreshInterval = time.Minute
+
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+// keySet caches the provider's signing keys and refetches them when a
+// token is signed with a key it hasn't seen (key rotation).
+type keySet struct {
+	client *http.Client
+	uri    string
+
+	mu        sync.Mutex
+	keys      map[string]*rsa.PublicKey
+	fetchedAt time.Time
+}
+
+func newKeySet(client *http.Client, uri string) *keySet {
+	return &keySet{client: client, uri: uri}
+}
+
+func (ks *keySet) get(ctx context.Context, kid string) (*rsa.PublicKey, error) {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+
+	if key, ok := ks.lookup(kid); ok {
+		return key, nil
+	}
+	if time.Since(ks.fetchedAt) < jwksRefreshInterval && ks.keys != nil {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+
+	if err := ks.refresh(ctx); err != nil {
+		return nil, err
+	}
+	if key, ok := ks.lookup(kid); ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("unknown signing key %q", kid)
+}
+
+// lookup finds a key by ID; tokens without a kid match when there is only one key.
+func (ks *keySet) lookup(kid string) (*rsa.PublicKey, bool) {
+	if kid == "" && len(ks.keys) == 1 {
+		for _, k := range ks.keys {
+			return k, true
+		}
+	}
+	key, ok := ks.keys[kid]
+	return key, ok
+}
+
+func (ks *keySet) refresh(ctx context.Context) error {
+	var doc struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := getJSON(ctx, ks.client, ks.uri, &doc); err != nil {
+		return fmt.Errorf("fetching jwks: %w", err)
+	}
+
+	keys := make(map[string]*rsa.PublicKey)
+	for _, k := range doc.Keys {
+		if k.Kty != "RSA" || (k.Use != "" && k.Use != "sig") {
+			continue
+		}
+		pub, err := parseRSAKey(k)
+		if err != nil {
+			continue
+		}
+		keys[k.Kid] = pub
+	}
+
+	ks.keys = keys
+	ks.fetchedAt = time.Now()
+	return nil
+}
+
+func parseRSAKey(k jsonWebKey) (*rsa.PublicKey, error) {
+	n, err := base64.RawURLEncoding.DecodeString(k.N)
+	if err != nil {
+		return nil, err
+	}
+	e, err := base64.RawURLEncoding.DecodeString(k.E)
+	if err != nil {
+		return nil, err
+	}
+
+	return &rsa.PublicKey{
+		N: new(big.Int).SetBytes(n),
+		E: int(new(big.Int).SetBytes(e).Int64()),
+	}, nil
+}
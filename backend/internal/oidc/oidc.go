@@ -0,0 +1,249 @@
+// Package oidc implements the OpenID Connect authorization code flow with
+// PKCE against a single provider: discovery, the token exchange and ID
+// token verification against the provider's JWKS.
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var ErrInvalidIDToken = errors.New("invalid id token")
+
+type Config struct {
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	// Scopes defaults to openid, email and profile
+	Scopes []string
+	// HTTPClient defaults to a client with a 10 second timeout
+	HTTPClient *http.Client
+}
+
+// Claims are the ID token claims Pulse uses to identify a user.
+type Claims struct {
+	Issuer            string
+	Subject           string
+	Email             string
+	EmailVerified     bool
+	Name              string
+	PreferredUsername string
+}
+
+type discoveryDocument struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+type Client struct {
+	cfg       Config
+	discovery discoveryDocument
+	keys      *keySet
+	http      *http.Client
+}
+
+// NewClient fetches the provider's discovery document and returns a client for it.
+func NewClient(ctx context.Context, cfg Config) (*Client, error) {
+	httpClient := cfg.HTTPClient
+	if httpClient == nil {
+		httpClient = &http.Client{Timeout: 10 * time.Second}
+	}
+	if len(cfg.Scopes) == 0 {
+		cfg.Scopes = []string{"openid", "email", "profile"}
+	}
+
+	wellKnown := strings.TrimRight(cfg.Issuer, "/") + "/.well-known/openid-configuration"
+	var doc discoveryDocument
+	if err := getJSON(ctx, httpClient, wellKnown, &doc); err != nil {
+		return nil, fmt.Errorf("fetching discovery document: %w", err)
+	}
+	if doc.Issuer != cfg.Issuer {
+		return nil, fmt.Errorf("issuer mismatch: configured %q, provider reports %q", cfg.Issuer, doc.Issuer)
+	}
+	if doc.AuthorizationEndpoint == "" || doc.TokenEndpoint == "" || doc.JWKSURI == "" {
+		return nil, errors.New("discovery document is missing endpoints")
+	}
+
+	return &Client{
+		cfg:       cfg,
+		discovery: doc,
+		keys:      newKeySet(httpClient, doc.JWKSURI),
+		http:      httpClient,
+	}, nil
+}
+
+// Issuer returns the provider's issuer identifier.
+func (c *Client) Issuer() string {
+	return c.discovery.Issuer
+}
+
+// AuthCodeURL returns the provider URL to send the browser to.
+func (c *Client) AuthCodeURL(state, nonce, codeChallenge string) string {
+	v := url.Values{}
+	v.Set("response_type", "code")
+	v.Set("client_id", c.cfg.ClientID)
+	v.Set("redirect_uri", c.cfg.RedirectURL)
+	v.Set("scope", strings.Join(c.cfg.Scopes, " "))
+	v.Set("state", state)
+	v.Set("nonce", nonce)
+	v.Set("code_challenge", codeChallenge)
+	v.Set("code_challenge_method", "S256")
+
+	sep := "?"
+	if strings.Contains(c.discovery.AuthorizationEndpoint, "?") {
+		sep = "&"
+	}
+	return c.discovery.AuthorizationEndpoint + sep + v.Encode()
+}
+
+// Exchange redeems an authorization code and returns the verified ID token claims.
+func (c *Client) Exchange(ctx context.Context, code, codeVerifier, nonce string) (*Claims, error) {
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", c.cfg.RedirectURL)
+	form.Set("client_id", c.cfg.ClientID)
+	form.Set("code_verifier", codeVerifier)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.discovery.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if c.cfg.ClientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(c.cfg.ClientID), url.QueryEscape(c.cfg.ClientSecret))
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("token request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, fmt.Errorf("reading token response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("token endpoint returned %d: %s", resp.StatusCode, truncate(string(body), 200))
+	}
+
+	var tokens struct {
+		IDToken string `json:"id_token"`
+	}
+	if err := json.Unmarshal(body, &tokens); err != nil {
+		return nil, fmt.Errorf("decoding token response: %w", err)
+	}
+	if tokens.IDToken == "" {
+		return nil, errors.New("token response has no id_token")
+	}
+
+	return c.Verify(ctx, tokens.IDToken, nonce)
+}
+
+// Verify checks the ID token's signature, issuer, audience, expiry and nonce.
+func (c *Client) Verify(ctx context.Context, rawIDToken, nonce string) (*Claims, error) {
+	var claims struct {
+		jwt.RegisteredClaims
+		Nonce             string `json:"nonce"`
+		Email             string `json:"email"`
+		EmailVerified     any    `json:"email_verified"`
+		Name              string `json:"name"`
+		PreferredUsername string `json:"preferred_username"`
+	}
+
+	_, err := jwt.ParseWithClaims(rawIDToken, &claims, func(t *jwt.Token) (any, error) {
+		kid, _ := t.Header["kid"].(string)
+		return c.keys.get(ctx, kid)
+	},
+		jwt.WithValidMethods([]string{"RS256"}),
+		jwt.WithIssuer(c.discovery.Issuer),
+		jwt.WithAudience(c.cfg.ClientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(time.Minute),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidIDToken, err)
+	}
+	if claims.Nonce != nonce {
+		return nil, fmt.Errorf("%w: nonce mismatch", ErrInvalidIDToken)
+	}
+	if claims.Subject == "" {
+		return nil, fmt.Errorf("%w: missing subject", ErrInvalidIDToken)
+	}
+
+	// Some providers send email_verified as a string
+	verified := false
+	switch v := claims.EmailVerified.(type) {
+	case bool:
+		verified = v
+	case string:
+		verified = v == "true"
+	}
+
+	return &Claims{
+		Issuer:            claims.Issuer,
+		Subject:           claims.Subject,
+		Email:             claims.Email,
+		EmailVerified:     verified,
+		Name:              claims.Name,
+		PreferredUsername: claims.PreferredUsername,
+	}, nil
+}
+
+// NewPKCEVerifier returns a random code verifier (RFC 7636).
+func NewPKCEVerifier() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// PKCEChallenge returns the S256 code challenge for a verifier.
+func PKCEChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+func getJSON(ctx context.Context, client *http.Client, url string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s returned %d", url, resp.StatusCode)
+	}
+	return json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(v)
+}
+
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n] + "..."
+}
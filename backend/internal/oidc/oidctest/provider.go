@@ -0,0 +1,245 @@
+// Package oidctest provides a minimal OpenID Connect provider for tests
+// and local development. It signs in a configurable user without asking
+// for credentials, and checks client ID, redirect URI and PKCE.
+package oidctest
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const keyID = "oidctest"
+
+// User is the identity the provider signs in.
+type User struct {
+	Subject           string
+	Email             string
+	EmailVerified     bool
+	Name              string
+	PreferredUsername string
+}
+
+type Provider struct {
+	Issuer   string
+	ClientID string
+
+	key    *rsa.PrivateKey
+	server *httptest.Server
+
+	mu    sync.Mutex
+	user  User
+	codes map[string]authRequest
+}
+
+type authRequest struct {
+	redirectURI   string
+	codeChallenge string
+	nonce         string
+	user          User
+}
+
+// New returns a provider served under issuer. Mount Handler() at that URL.
+func New(issuer, clientID string, user User) (*Provider, error) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Provider{
+		Issuer:   issuer,
+		ClientID: clientID,
+		key:      key,
+		user:     user,
+		codes:    make(map[string]authRequest),
+	}, nil
+}
+
+// NewServer starts a provider on a local httptest server. Call Close when done.
+func NewServer(clientID string, user User) (*Provider, error) {
+	p, err := New("", clientID, user)
+	if err != nil {
+		return nil, err
+	}
+
+	p.server = httptest.NewServer(p.Handler())
+	p.Issuer = p.server.URL
+	return p, nil
+}
+
+func (p *Provider) Close() {
+	if p.server != nil {
+		p.server.Close()
+	}
+}
+
+// SetUser changes the identity returned by subsequent logins.
+func (p *Provider) SetUser(u User) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.user = u
+}
+
+func (p *Provider) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", p.discovery)
+	mux.HandleFunc("GET /jwks", p.jwks)
+	mux.HandleFunc("GET /authorize", p.authorize)
+	mux.HandleFunc("POST /token", p.token)
+	return mux
+}
+
+func (p *Provider) discovery(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]any{
+		"issuer":                                p.Issuer,
+		"authorization_endpoint":                p.Issuer + "/authorize",
+		"token_endpoint":                        p.Issuer + "/token",
+		"jwks_uri":                              p.Issuer + "/jwks",
+		"response_types_supported":              []string{"code"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+		"code_challenge_methods_supported":      []string{"S256"},
+	})
+}
+
+func (p *Provider) jwks(w http.ResponseWriter, r *http.Request) {
+	pub := p.key.PublicKey
+	writeJSON(w, http.StatusOK, map[string]any{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": keyID,
+			"use": "sig",
+			"alg": "RS256",
+			"n":   base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+		}},
+	})
+}
+
+// authorize approves every request immediately and redirects back with a code.
+func (p *Provider) authorize(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	if q.Get("response_type") != "code" || q.Get("client_id") != p.ClientID {
+		http.Error(w, "invalid_request", http.StatusBadRequest)
+		return
+	}
+	if q.Get("code_challenge") == "" || q.Get("code_challenge_method") != "S256" {
+		http.Error(w, "PKCE with S256 is required", http.StatusBadRequest)
+		return
+	}
+
+	redirect, err := url.Parse(q.Get("redirect_uri"))
+	if err != nil || redirect.Scheme == "" {
+		http.Error(w, "invalid redirect_uri", http.StatusBadRequest)
+		return
+	}
+
+	code := randomString()
+	p.mu.Lock()
+	p.codes[code] = authRequest{
+		redirectURI:   q.Get("redirect_uri"),
+		codeChallenge: q.Get("code_challenge"),
+		nonce:         q.Get("nonce"),
+		user:          p.user,
+	}
+	p.mu.Unlock()
+
+	params := redirect.Query()
+	params.Set("code", code)
+	params.Set("state", q.Get("state"))
+	redirect.RawQuery = params.Encode()
+	http.Redirect(w, r, redirect.String(), http.StatusFound)
+}
+
+func (p *Provider) token(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		tokenError(w, "invalid_request")
+		return
+	}
+
+	clientID := r.PostForm.Get("client_id")
+	if user, _, ok := r.BasicAuth(); ok {
+		clientID, _ = url.QueryUnescape(user)
+	}
+	if r.PostForm.Get("grant_type") != "authorization_code" || clientID != p.ClientID {
+		tokenError(w, "invalid_client")
+		return
+	}
+
+	p.mu.Lock()
+	req, ok := p.codes[r.PostForm.Get("code")]
+	delete(p.codes, r.PostForm.Get("code"))
+	p.mu.Unlock()
+
+	if !ok || req.redirectURI != r.PostForm.Get("redirect_uri") {
+		tokenError(w, "invalid_grant")
+		return
+	}
+
+	sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	if base64.RawURLEncoding.EncodeToString(sum[:]) != req.codeChallenge {
+		tokenError(w, "invalid_grant")
+		return
+	}
+
+	idToken, err := p.IDToken(req.user, req.nonce)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"access_token": randomString(),
+		"token_type":   "Bearer",
+		"expires_in":   3600,
+		"id_token":     idToken,
+	})
+}
+
+// IDToken signs an ID token for the user, as the token endpoint would.
+func (p *Provider) IDToken(u User, nonce string) (string, error) {
+	now := time.Now()
+	claims := jwt.MapClaims{
+		"iss":                p.Issuer,
+		"sub":                u.Subject,
+		"aud":                p.ClientID,
+		"iat":                now.Unix(),
+		"exp":                now.Add(time.Hour).Unix(),
+		"nonce":              nonce,
+		"email":              u.Email,
+		"email_verified":     u.EmailVerified,
+		"name":               u.Name,
+		"preferred_username": u.PreferredUsername,
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = keyID
+	return token.SignedString(p.key)
+}
+
+func tokenError(w http.ResponseWriter, code string) {
+	writeJSON(w, http.StatusBadRequest, map[string]string{"error": code})
+}
+
+func writeJSON(w http.ResponseWriter, status int, data any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(data)
+}
+
+func randomString() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,79 @@
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+const sweepInterval = time.Minute
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+	limit  Limit
+}
+
+// MemoryStore keeps buckets in process memory. Limits aren't shared
+// between server instances.
+type MemoryStore struct {
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		buckets:   make(map[string]*bucket),
+		lastSweep: time.Now(),
+		now:       time.Now,
+	}
+}
+
+func (s *MemoryStore) Allow(_ context.Context, key string, limit Limit) (Result, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	if now.Sub(s.lastSweep) > sweepInterval {
+		s.sweep(now)
+	}
+
+	b, ok := s.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(limit.Burst), last: now}
+		s.buckets[key] = b
+	}
+	b.limit = limit
+	b.refill(now)
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return Result{Allowed: true, Remaining: int(b.tokens)}, nil
+	}
+
+	wait := time.Duration((1 - b.tokens) / limit.Rate * float64(time.Second))
+	return Result{Allowed: false, RetryAfter: wait}, nil
+}
+
+func (b *bucket) refill(now time.Time) {
+	elapsed := now.Sub(b.last).Seconds()
+	if elapsed > 0 {
+		b.tokens = math.Min(float64(b.limit.Burst), b.tokens+elapsed*b.limit.Rate)
+		b.last = now
+	}
+}
+
+// sweep drops buckets that have refilled completely; they behave the same
+// as a missing bucket.
+func (s *MemoryStore) sweep(now time.Time) {
+	for key, b := range s.buckets {
+		b.refill(now)
+		if b.tokens >= float64(b.limit.Burst) {
+			delete(s.buckets, key)
+		}
+	}
+	s.lastSweep = now
+}
@@ -0,0 +1,38 @@
+// Package ratelimit implements token bucket rate limiting with pluggable
+// storage: in memory for a single instance, or Redis when several
+// instances share limits.
+package ratelimit
+
+import (
+	"context"
+	"time"
+)
+
+// Limit describes a token bucket: it refills at Rate tokens per second and
+// holds at most Burst tokens.
+type Limit struct {
+	Rate  float64
+	Burst int
+}
+
+// PerMinute allows n requests per minute with bursts of up to n.
+func PerMinute(n int) Limit {
+	return Limit{Rate: float64(n) / 60, Burst: n}
+}
+
+// PerSecond allows n requests per second with bursts of up to burst.
+func PerSecond(n float64, burst int) Limit {
+	return Limit{Rate: n, Burst: burst}
+}
+
+type Result struct {
+	Allowed   bool
+	Remaining int
+	// RetryAfter is how long until the next request would be allowed
+	RetryAfter time.Duration
+}
+
+// Store takes one token from the bucket identified by key.
+type Store interface {
+	Allow(ctx context.Context, key string, limit Limit) (Result, error)
+}
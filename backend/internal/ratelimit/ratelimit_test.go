@@ -0,0 +1,117 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// clock is a hand-advanced time source for MemoryStore.
+type clock struct{ t time.Time }
+
+func (c *clock) now() time.Time          { return c.t }
+func (c *clock) advance(d time.Duration) { c.t = c.t.Add(d) }
+
+func newTestStore() (*MemoryStore, *clock) {
+	c := &clock{t: time.Unix(1700000000, 0)}
+	s := NewMemoryStore()
+	s.now = c.now
+	s.lastSweep = c.t
+	return s, c
+}
+
+func TestMemoryStoreRefill(t *testing.T) {
+	ctx := context.Background()
+	s, c := newTestStore()
+	limit := PerMinute(60)
+
+	for i := range limit.Burst {
+		res, _ := s.Allow(ctx, "k", limit)
+		if !res.Allowed || res.Remaining != limit.Burst-1-i {
+			t.Fatalf("request %d = %+v", i, res)
+		}
+	}
+	res, _ := s.Allow(ctx, "k", limit)
+	if res.Allowed || res.RetryAfter != time.Second {
+		t.Fatalf("empty bucket = %+v, want a 1s wait", res)
+	}
+
+	// Half a token back: still refused, with the wait shortened to match
+	c.advance(500 * time.Millisecond)
+	res, _ = s.Allow(ctx, "k", limit)
+	if res.Allowed || res.RetryAfter != 500*time.Millisecond {
+		t.Fatalf("half refilled = %+v, want a 500ms wait", res)
+	}
+	c.advance(500 * time.Millisecond)
+	if res, _ := s.Allow(ctx, "k", limit); !res.Allowed || res.Remaining != 0 {
+		t.Fatalf("refilled = %+v", res)
+	}
+
+	// Buckets are per key
+	if res, _ := s.Allow(ctx, "other", limit); !res.Allowed || res.Remaining != limit.Burst-1 {
+		t.Fatalf("other key = %+v", res)
+	}
+}
+
+func TestMemoryStoreBurstCap(t *testing.T) {
+	ctx := context.Background()
+	s, c := newTestStore()
+	limit := PerSecond(2, 5)
+
+	s.Allow(ctx, "k", limit)
+	// An idle hour refills the bucket to its burst, no further
+	c.advance(time.Hour)
+	for i := range limit.Burst {
+		if res, _ := s.Allow(ctx, "k", limit); !res.Allowed || res.Remaining != limit.Burst-1-i {
+			t.Fatalf("request %d after idling = %+v", i, res)
+		}
+	}
+	if res, _ := s.Allow(ctx, "k", limit); res.Allowed {
+		t.Fatal("allowed past the burst")
+	}
+}
+
+func TestMemoryStoreWSEvents(t *testing.T) {
+	ctx := context.Background()
+	s, c := newTestStore()
+	// The default ws_events limit
+	limit := PerSecond(10, 30)
+	key := "ws:user:alice"
+
+	for range limit.Burst {
+		if res, _ := s.Allow(ctx, key, limit); !res.Allowed {
+			t.Fatal("burst refused")
+		}
+	}
+	res, _ := s.Allow(ctx, key, limit)
+	if res.Allowed || res.RetryAfter != 100*time.Millisecond {
+		t.Fatalf("past the burst = %+v, want a 100ms wait", res)
+	}
+
+	// A second of steady sending at the rate is allowed
+	for i := range 10 {
+		c.advance(100 * time.Millisecond)
+		if res, _ := s.Allow(ctx, key, limit); !res.Allowed {
+			t.Fatalf("event %d at the rate refused: %+v", i, res)
+		}
+	}
+	if res, _ := s.Allow(ctx, key, limit); res.Allowed {
+		t.Fatal("event above the rate allowed")
+	}
+}
+
+func TestMemoryStoreSweep(t *testing.T) {
+	ctx := context.Background()
+	s, c := newTestStore()
+	limit := PerSecond(1, 2)
+
+	s.Allow(ctx, "idle", limit)
+	c.advance(sweepInterval + time.Second)
+	s.Allow(ctx, "busy", limit)
+	if _, ok := s.buckets["idle"]; ok {
+		t.Fatal("full bucket not swept")
+	}
+	if _, ok := s.buckets["busy"]; !ok {
+		t.Fatal("bucket in use swept")
+	}
+}
@@ -0,0 +1,67 @@
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// tokenBucketScript refills and takes from a bucket atomically, using the
+// Redis server clock so all instances agree on time.
+// Returns {allowed, remaining, retry_after_ms}.
+var tokenBucketScript = redis.NewScript(`
+local rate = tonumber(ARGV[1])
+local burst = tonumber(ARGV[2])
+local t = redis.call('TIME')
+local now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+
+local data = redis.call('HMGET', KEYS[1], 'tokens', 'ts')
+local tokens = tonumber(data[1])
+local ts = tonumber(data[2])
+if tokens == nil then
+	tokens = burst
+	ts = now
+end
+
+tokens = math.min(burst, tokens + math.max(0, now - ts) / 1000 * rate)
+
+local allowed = 0
+local retry = 0
+if tokens >= 1 then
+	tokens = tokens - 1
+	allowed = 1
+else
+	retry = math.ceil((1 - tokens) / rate * 1000)
+end
+
+redis.call('HSET', KEYS[1], 'tokens', tostring(tokens), 'ts', now)
+redis.call('PEXPIRE', KEYS[1], math.ceil(burst / rate * 1000) + 1000)
+return {allowed, math.floor(tokens), retry}
+`)
+
+// RedisStore keeps buckets in Redis so limits hold across server instances.
+type RedisStore struct {
+	client *redis.Client
+	prefix string
+}
+
+func NewRedisStore(client *redis.Client) *RedisStore {
+	return &RedisStore{client: client, prefix: "ratelimit:"}
+}
+
+func (s *RedisStore) Allow(ctx context.Context, key string, limit Limit) (Result, error) {
+	res, err := tokenBucketScript.Run(ctx, s.client, []string{s.prefix + key},
+		limit.Rate, limit.Burst,
+	).Int64Slice()
+	if err != nil {
+		return Result{}, err
+	}
+
+	return Result{
+		Allowed:    res[0] == 1,
+		Remaining:  int(res[1]),
+		RetryAfter: time.Duration(math.Max(0, float64(res[2]))) * time.Millisecond,
+	}, nil
+}
@@ -2,57 +2,230 @@ package repository
 
 import (
 	"context"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/vedran77/pulse/internal/domain"
 )
 
+// TxManager runs a unit of work atomically. Repository calls made with the
+// context passed to fn join the transaction.
+type TxManager interface {
+	WithinTx(ctx context.Context, fn func(ctx context.Context) error) error
+}
+
 type UserRepository interface {
 	Create(ctx context.Context, user *domain.User) error
 	GetByID(ctx context.Context, id uuid.UUID) (*domain.User, error)
 	GetByEmail(ctx context.Context, email string) (*domain.User, error)
 	GetByUsername(ctx context.Context, username string) (*domain.User, error)
+	MarkEmailVerified(ctx context.Context, id uuid.UUID) error
+	// UpdatePassword sets a new password hash and invalidates existing sessions.
+	UpdatePassword(ctx context.Context, id uuid.UUID, passwordHash string) error
+	// RecordFailedLogin counts a failed login and locks the account for lockFor
+	// once maxAttempts is reached. Returns the lock expiry, if any.
+	RecordFailedLogin(ctx context.Context, id uuid.UUID, maxAttempts int, lockFor time.Duration) (*time.Time, error)
+	ResetFailedLogins(ctx context.Context, id uuid.UUID) error
+	// UpdateProfile saves the user's username and display name.
+	UpdateProfile(ctx context.Context, user *domain.User) error
+	SetAvatarURL(ctx context.Context, id uuid.UUID, avatarURL *string) error
+	// SetPendingEmail stores an address waiting for confirmation; nil clears it.
+	SetPendingEmail(ctx context.Context, id uuid.UUID, email *string) error
+	// ConfirmEmailChange replaces the email with the pending one and marks it verified.
+	ConfirmEmailChange(ctx context.Context, id uuid.UUID) error
+	// Anonymize deletes the user's personal data, memberships and sessions.
+	// The row stays, scrubbed, for the messages and other records that
+	// reference it.
+	Anonymize(ctx context.Context, id uuid.UUID, deletedAt time.Time) error
+}
+
+type VerificationTokenRepository interface {
+	Create(ctx context.Context, token *domain.VerificationToken) error
+	GetByHash(ctx context.Context, tokenHash string) (*domain.VerificationToken, error)
+	// Consume marks the token used; returns false if it was already used.
+	Consume(ctx context.Context, id uuid.UUID) (bool, error)
+	// InvalidateForUser marks all unused tokens of the purpose as used.
+	InvalidateForUser(ctx context.Context, userID uuid.UUID, purpose string) error
+}
+
+type TwoFactorRepository interface {
+	// Upsert stores a new, unconfirmed enrollment, replacing any previous one.
+	Upsert(ctx context.Context, tf *domain.TwoFactor) error
+	Get(ctx context.Context, userID uuid.UUID) (*domain.TwoFactor, error)
+	// Enable confirms the enrollment, replaces the recovery codes and turns 2FA on for the user.
+	Enable(ctx context.Context, userID uuid.UUID, codeHashes []string) error
+	// Disable removes the enrollment and recovery codes and turns 2FA off.
+	Disable(ctx context.Context, userID uuid.UUID) error
+	// UseStep records a successfully used time step; returns false if it
+	// isn't newer than the last one, so a code can't be replayed.
+	UseStep(ctx context.Context, userID uuid.UUID, step int64) (bool, error)
+	ReplaceRecoveryCodes(ctx context.Context, userID uuid.UUID, codeHashes []string) error
+	// UseRecoveryCode marks a matching unused code as used; returns false if none matched.
+	UseRecoveryCode(ctx context.Context, userID uuid.UUID, codeHash string) (bool, error)
+}
+
+type IdentityRepository interface {
+	Create(ctx context.Context, identity *domain.UserIdentity) error
+	GetBySubject(ctx context.Context, issuer, subject string) (*domain.UserIdentity, error)
+	HasIdentity(ctx context.Context, userID uuid.UUID) (bool, error)
+	TouchLogin(ctx context.Context, id uuid.UUID) error
+	// RequiresSSO reports whether any workspace the user belongs to requires SSO.
+	RequiresSSO(ctx context.Context, userID uuid.UUID) (bool, error)
+
+	CreateLoginState(ctx context.Context, state *domain.OIDCLoginState) error
+	// ConsumeLoginState deletes and returns the state; nil if it doesn't exist.
+	ConsumeLoginState(ctx context.Context, stateHash string) (*domain.OIDCLoginState, error)
 }
 
 type WorkspaceRepository interface {
 	Create(ctx context.Context, workspace *domain.Workspace) error
+	// GetByID returns nil for deleted workspaces; GetDeletedByID only finds those.
 	GetByID(ctx context.Context, id uuid.UUID) (*domain.Workspace, error)
+	GetDeletedByID(ctx context.Context, id uuid.UUID) (*domain.Workspace, error)
+	// GetBySlug also finds deleted workspaces, whose slugs stay reserved until they're purged.
 	GetBySlug(ctx context.Context, slug string) (*domain.Workspace, error)
 	ListByUser(ctx context.Context, userID uuid.UUID) ([]domain.Workspace, error)
+	ListDeletedByOwner(ctx context.Context, ownerID uuid.UUID) ([]domain.Workspace, error)
+	// ListDeletedBefore returns up to limit workspaces deleted before the time, oldest first.
+	ListDeletedBefore(ctx context.Context, before time.Time, limit int) ([]domain.Workspace, error)
 	Update(ctx context.Context, workspace *domain.Workspace) error
+	SetOwner(ctx context.Context, id, ownerID uuid.UUID) error
+	// SoftDelete hides the workspace from members until it's restored or purged.
+	SoftDelete(ctx context.Context, id uuid.UUID, deletedAt time.Time) error
+	Restore(ctx context.Context, id uuid.UUID) error
+	// Delete removes the workspace and everything that cascades from it.
 	Delete(ctx context.Context, id uuid.UUID) error
 	AddMember(ctx context.Context, member *domain.WorkspaceMember) error
 	RemoveMember(ctx context.Context, workspaceID, userID uuid.UUID) error
+	UpdateMemberRole(ctx context.Context, workspaceID, userID uuid.UUID, role string) error
+	// GetMember returns nil for members of deleted workspaces.
 	GetMember(ctx context.Context, workspaceID, userID uuid.UUID) (*domain.WorkspaceMember, error)
-	ListMembers(ctx context.Context, workspaceID uuid.UUID) ([]domain.WorkspaceMember, error)
+	// ListMembers pages through the members in the order they joined.
+	ListMembers(ctx context.Context, workspaceID uuid.UUID, page Page) ([]domain.WorkspaceMember, error)
+	// UpdateMemberProfile saves the member's title, timezone and pronouns.
+	UpdateMemberProfile(ctx context.Context, member *domain.WorkspaceMember) error
+	SearchMembers(ctx context.Context, workspaceID uuid.UUID, search MemberSearch) ([]MemberMatch, error)
+	// Domain-based joining
+	SetAllowedDomains(ctx context.Context, workspaceID uuid.UUID, domains []string) error
+	ListAllowedDomains(ctx context.Context, workspaceID uuid.UUID) ([]string, error)
+	ListDiscoverable(ctx context.Context, userID uuid.UUID, emailDomain string) ([]domain.DiscoverableWorkspace, error)
+	CreateJoinRequest(ctx context.Context, req *domain.WorkspaceJoinRequest) error
+	GetJoinRequestByID(ctx context.Context, id uuid.UUID) (*domain.WorkspaceJoinRequest, error)
+	GetPendingJoinRequest(ctx context.Context, workspaceID, userID uuid.UUID) (*domain.WorkspaceJoinRequest, error)
+	ListPendingJoinRequests(ctx context.Context, workspaceID uuid.UUID) ([]domain.WorkspaceJoinRequest, error)
+	DecideJoinRequest(ctx context.Context, id uuid.UUID, status string, decidedBy uuid.UUID) error
+}
+
+// MemberSearch filters and pages a workspace member search. The query is
+// matched case-insensitively; results are ordered by rank, best first, then
+// by username:
+//
+//	0  username equals the query
+//	1  username starts with it
+//	2  a word in the display name starts with it
+//	3  email starts with it
+//	4  username, display name or email contains it
+//	5  username or display name contains its characters in order
+//
+// An empty query matches every member.
+type MemberSearch struct {
+	Query string
+	// Role limits results to one role, empty matches any
+	Role string
+	// IncludeEmail matches the query against email addresses and returns
+	// them; only for workspace admins
+	IncludeEmail bool
+	// After continues from the last result of the previous page, Before
+	// returns the last Limit results before the first one; both keep the
+	// search order
+	After, Before *MemberMatchKey
+	Limit         int
+}
+
+// MemberMatch is a member found by SearchMembers.
+type MemberMatch struct {
+	domain.WorkspaceMember
+	Rank int
+}
+
+// MemberMatchKey is a match's position in the search order.
+type MemberMatchKey struct {
+	Rank     int
+	Username string
+	UserID   uuid.UUID
+}
+
+func (m MemberMatch) Key() MemberMatchKey {
+	return MemberMatchKey{Rank: m.Rank, Username: m.Username, UserID: m.UserID}
 }
 
 type ChannelRepository interface {
 	Create(ctx context.Context, channel *domain.Channel) error
+	// GetByID returns nil for channels of deleted workspaces.
 	GetByID(ctx context.Context, id uuid.UUID) (*domain.Channel, error)
-	ListByWorkspace(ctx context.Context, workspaceID uuid.UUID) ([]domain.Channel, error)
+	// ListByWorkspace pages through the workspace's channels, oldest first.
+	ListByWorkspace(ctx context.Context, workspaceID uuid.UUID, includeArchived bool, page Page) ([]domain.Channel, error)
+	// Update saves the name, description, posting policy and slow mode.
 	Update(ctx context.Context, channel *domain.Channel) error
 	Archive(ctx context.Context, id uuid.UUID) error
+	// Unarchive clears the archive and records at as the channel's last
+	// activity for the auto-archive policy.
+	Unarchive(ctx context.Context, id uuid.UUID, at time.Time) error
+	// ArchiveInactive archives the channels of workspaces with an auto-archive
+	// policy that have had no messages, and weren't unarchived, for that many
+	// days before now, and returns them.
+	ArchiveInactive(ctx context.Context, now time.Time) ([]domain.Channel, error)
 	AddMember(ctx context.Context, member *domain.ChannelMember) error
 	RemoveMember(ctx context.Context, channelID, userID uuid.UUID) error
 	GetMember(ctx context.Context, channelID, userID uuid.UUID) (*domain.ChannelMember, error)
 	ListMembers(ctx context.Context, channelID uuid.UUID) ([]domain.ChannelMember, error)
+	UpdateMemberRole(ctx context.Context, channelID, userID uuid.UUID, role string) error
+	// Topic and its history, newest change first
+	SetTopic(ctx context.Context, channelID uuid.UUID, topic *string) error
+	AddTopicChange(ctx context.Context, change *domain.ChannelTopicChange) error
+	ListTopicChanges(ctx context.Context, channelID uuid.UUID, limit int) ([]domain.ChannelTopicChange, error)
+	// RecordPost stores at as the user's last post in the channel, unless
+	// their previous post is later than notBefore; it reports whether it
+	// did. Used for slow mode.
+	RecordPost(ctx context.Context, channelID, userID uuid.UUID, at, notBefore time.Time) (bool, error)
+	LastPostAt(ctx context.Context, channelID, userID uuid.UUID) (*time.Time, error)
+	// Bookmarks
+	CreateBookmark(ctx context.Context, bookmark *domain.ChannelBookmark) error
+	GetBookmark(ctx context.Context, id uuid.UUID) (*domain.ChannelBookmark, error)
+	ListBookmarks(ctx context.Context, channelID uuid.UUID) ([]domain.ChannelBookmark, error)
+	UpdateBookmark(ctx context.Context, bookmark *domain.ChannelBookmark) error
+	DeleteBookmark(ctx context.Context, id uuid.UUID) error
 }
 
 type InviteRepository interface {
 	Create(ctx context.Context, invite *domain.WorkspaceInvite) error
+	GetByID(ctx context.Context, id uuid.UUID) (*domain.WorkspaceInvite, error)
 	GetByToken(ctx context.Context, token string) (*domain.WorkspaceInvite, error)
-	ListByWorkspace(ctx context.Context, workspaceID uuid.UUID) ([]domain.WorkspaceInvite, error)
-	MarkAccepted(ctx context.Context, id, userID uuid.UUID) error
+	// ListByWorkspace pages through the invites that can still be used, newest first.
+	ListByWorkspace(ctx context.Context, workspaceID uuid.UUID, page Page) ([]domain.WorkspaceInvite, error)
+	RecordUse(ctx context.Context, id, userID uuid.UUID) (bool, error)
+	UpdateExpiry(ctx context.Context, id uuid.UUID, expiresAt time.Time) error
 	Delete(ctx context.Context, id uuid.UUID) error
 }
 
 type MessageRepository interface {
 	Create(ctx context.Context, msg *domain.Message) error
 	GetByID(ctx context.Context, id uuid.UUID) (*domain.Message, error)
-	ListByChannel(ctx context.Context, channelID uuid.UUID, before *uuid.UUID, limit int) ([]domain.Message, error)
+	// ListByChannel pages through the channel's messages, oldest first.
+	ListByChannel(ctx context.Context, channelID uuid.UUID, page Page) ([]domain.Message, error)
 	Update(ctx context.Context, msg *domain.Message) error
 	SoftDelete(ctx context.Context, id uuid.UUID) error
+	// SetEmbeds replaces the message's link previews.
+	SetEmbeds(ctx context.Context, messageID uuid.UUID, embeds []domain.MessageEmbed) error
+	// AddPin pins a message unless its channel already has limit pins. It
+	// returns false if the pin wasn't added because of the limit or because
+	// the message is already pinned.
+	AddPin(ctx context.Context, pin *domain.PinnedMessage, limit int) (bool, error)
+	GetPin(ctx context.Context, messageID uuid.UUID) (*domain.PinnedMessage, error)
+	// ListPins returns the channel's pins with their messages, newest pin first.
+	// Pins of deleted messages are left out.
+	ListPins(ctx context.Context, channelID uuid.UUID) ([]domain.PinnedMessage, error)
+	RemovePin(ctx context.Context, messageID uuid.UUID) error
 }
 
 type PulsemateRepository interface {
@@ -65,7 +238,8 @@ type PulsemateRepository interface {
 	CreatePulsemate(ctx context.Context, pm *domain.Pulsemate) error
 	GetPulsemateByUsers(ctx context.Context, user1ID, user2ID uuid.UUID) (*domain.Pulsemate, error)
 	DeletePulsemate(ctx context.Context, user1ID, user2ID uuid.UUID) error
-	ListPulsemates(ctx context.Context, userID uuid.UUID) ([]domain.Pulsemate, error)
+	// ListPulsemates pages through the user's pulsemates, newest first.
+	ListPulsemates(ctx context.Context, userID uuid.UUID, page Page) ([]domain.Pulsemate, error)
 	ArePulsemates(ctx context.Context, userA, userB uuid.UUID) (bool, error)
 }
 
@@ -73,10 +247,58 @@ type DMRepository interface {
 	CreateConversation(ctx context.Context, conv *domain.DMConversation) error
 	GetConversationByUsers(ctx context.Context, user1ID, user2ID uuid.UUID) (*domain.DMConversation, error)
 	GetConversationByID(ctx context.Context, id uuid.UUID) (*domain.DMConversation, error)
-	ListConversations(ctx context.Context, userID uuid.UUID) ([]domain.DMConversation, error)
+	// ListConversations pages through the user's conversations by their
+	// last activity, the newest message or else creation, most recent first.
+	// It fills in the newest message, unread count and mute setting but not
+	// the other user's presence, and it
+	// leaves out conversations hidden since their last activity.
+	ListConversations(ctx context.Context, userID uuid.UUID, page Page) ([]domain.DMConversation, error)
+	// GetParticipant returns the user's settings for the conversation, or
+	// nil if they've never changed them.
+	GetParticipant(ctx context.Context, conversationID, userID uuid.UUID) (*domain.DMParticipant, error)
+	SaveParticipant(ctx context.Context, p *domain.DMParticipant) error
 	CreateMessage(ctx context.Context, msg *domain.DMMessage) error
 	GetMessageByID(ctx context.Context, id uuid.UUID) (*domain.DMMessage, error)
-	ListMessages(ctx context.Context, conversationID uuid.UUID, before *uuid.UUID, limit int) ([]domain.DMMessage, error)
+	// ListMessages pages through the conversation's messages, oldest first.
+	ListMessages(ctx context.Context, conversationID uuid.UUID, page Page) ([]domain.DMMessage, error)
 	UpdateMessage(ctx context.Context, msg *domain.DMMessage) error
 	SoftDeleteMessage(ctx context.Context, id uuid.UUID) error
 }
+
+type SavedItemRepository interface {
+	Create(ctx context.Context, item *domain.SavedItem) error
+	GetByID(ctx context.Context, id uuid.UUID) (*domain.SavedItem, error)
+	// GetByMessage finds the user's saved item for a channel message or DM.
+	GetByMessage(ctx context.Context, userID, messageID uuid.UUID) (*domain.SavedItem, error)
+	// ListByUser returns the user's saved items, newest first.
+	ListByUser(ctx context.Context, userID uuid.UUID) ([]domain.SavedItem, error)
+	// SetReminder sets or clears the reminder and re-arms it.
+	SetReminder(ctx context.Context, id uuid.UUID, remindAt *time.Time) error
+	Delete(ctx context.Context, id uuid.UUID) error
+	// ListDueReminders returns up to limit reminders due at now that haven't
+	// fired, oldest first.
+	ListDueReminders(ctx context.Context, now time.Time, limit int) ([]domain.SavedItem, error)
+	// MarkReminded records that the reminder fired. It returns false if it
+	// already had, so each reminder is delivered by one worker only.
+	MarkReminded(ctx context.Context, id uuid.UUID, at time.Time) (bool, error)
+}
+
+type ScheduledMessageRepository interface {
+	Create(ctx context.Context, msg *domain.ScheduledMessage) error
+	GetByID(ctx context.Context, id uuid.UUID) (*domain.ScheduledMessage, error)
+	// ListByUser returns the user's scheduled messages, soonest first.
+	ListByUser(ctx context.Context, userID uuid.UUID) ([]domain.ScheduledMessage, error)
+	// Update saves the content and send time and clears a delivery failure
+	// and the attempt count. It returns false if the message is gone, e.g.
+	// sent or cancelled since it was read.
+	Update(ctx context.Context, msg *domain.ScheduledMessage) (bool, error)
+	// Delete returns false if there was no such message.
+	Delete(ctx context.Context, id uuid.UUID) (bool, error)
+	// ClaimDue locks the earliest message due at now that hasn't failed,
+	// skipping ones locked by other workers. It must be called within a
+	// transaction, which holds the lock until it ends.
+	ClaimDue(ctx context.Context, now time.Time) (*domain.ScheduledMessage, error)
+	MarkFailed(ctx context.Context, id uuid.UUID, reason string, at time.Time) error
+	// Retry counts a failed delivery attempt and moves the send time to sendAt.
+	Retry(ctx context.Context, id uuid.UUID, sendAt time.Time) error
+}
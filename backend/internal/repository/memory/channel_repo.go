@@ -0,0 +1,486 @@
+package memory
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/vedran77/pulse/internal/domain"
+	"github.com/vedran77/pulse/internal/repository"
+)
+
+type ChannelRepo struct {
+	store *Store
+}
+
+func NewChannelRepo(store *Store) *ChannelRepo {
+	return &ChannelRepo{store: store}
+}
+
+func (r *ChannelRepo) Create(ctx context.Context, ch *domain.Channel) error {
+	s := r.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.workspaces[ch.WorkspaceID]; !ok {
+		return ErrConstraint
+	}
+	if _, ok := s.users[ch.CreatedBy]; !ok {
+		return ErrConstraint
+	}
+	if _, ok := s.channels[ch.ID]; ok {
+		return ErrDuplicate
+	}
+	if s.channelNameTaken(ch.WorkspaceID, ch.Name, ch.ID) {
+		return ErrDuplicate
+	}
+	policy := ch.PostingPolicy
+	if policy == "" {
+		policy = domain.PostingPolicyEveryone
+	}
+	if !validPostingPolicy(policy) || !validSlowMode(ch.SlowModeSeconds) {
+		return ErrConstraint
+	}
+	s.channels[ch.ID] = &domain.Channel{
+		ID:              ch.ID,
+		WorkspaceID:     ch.WorkspaceID,
+		Name:            ch.Name,
+		Description:     ch.Description,
+		Topic:           ch.Topic,
+		Type:            ch.Type,
+		IsEncrypted:     ch.IsEncrypted,
+		PostingPolicy:   policy,
+		SlowModeSeconds: ch.SlowModeSeconds,
+		CreatedBy:       ch.CreatedBy,
+		CreatedAt:       ts(ch.CreatedAt),
+	}
+	return nil
+}
+
+func (r *ChannelRepo) GetByID(ctx context.Context, id uuid.UUID) (*domain.Channel, error) {
+	s := r.store
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	ch, ok := s.channels[id]
+	if !ok {
+		return nil, nil
+	}
+	if ws := s.workspaces[ch.WorkspaceID]; ws == nil || ws.DeletedAt != nil {
+		return nil, nil
+	}
+	cp := *ch
+	return &cp, nil
+}
+
+func (r *ChannelRepo) ListByWorkspace(ctx context.Context, workspaceID uuid.UUID, includeArchived bool, p repository.Page) ([]domain.Channel, error) {
+	s := r.store
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var channels []domain.Channel
+	for _, ch := range s.channels {
+		if ch.WorkspaceID == workspaceID && (includeArchived || ch.ArchivedAt == nil) {
+			channels = append(channels, *ch)
+		}
+	}
+	return page(channels, p, func(ch domain.Channel) repository.PageKey {
+		return repository.PageKey{Time: ch.CreatedAt, ID: ch.ID}
+	}, false, false), nil
+}
+
+func (r *ChannelRepo) Update(ctx context.Context, ch *domain.Channel) error {
+	s := r.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, ok := s.channels[ch.ID]
+	if !ok {
+		return nil
+	}
+	if s.channelNameTaken(stored.WorkspaceID, ch.Name, ch.ID) {
+		return ErrDuplicate
+	}
+	policy := ch.PostingPolicy
+	if policy == "" {
+		policy = domain.PostingPolicyEveryone
+	}
+	if !validPostingPolicy(policy) || !validSlowMode(ch.SlowModeSeconds) {
+		return ErrConstraint
+	}
+	stored.Name = ch.Name
+	stored.Description = ch.Description
+	stored.PostingPolicy = policy
+	stored.SlowModeSeconds = ch.SlowModeSeconds
+	return nil
+}
+
+// validPostingPolicy and validSlowMode mirror the channels check constraints.
+func validPostingPolicy(policy string) bool {
+	return policy == domain.PostingPolicyEveryone || policy == domain.PostingPolicyAdmins
+}
+
+func validSlowMode(seconds int) bool {
+	return seconds >= 0 && seconds <= 21600
+}
+
+func (r *ChannelRepo) Archive(ctx context.Context, id uuid.UUID) error {
+	s := r.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if ch, ok := s.channels[id]; ok {
+		t := now()
+		ch.ArchivedAt = &t
+	}
+	return nil
+}
+
+func (r *ChannelRepo) Unarchive(ctx context.Context, id uuid.UUID, at time.Time) error {
+	s := r.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if ch, ok := s.channels[id]; ok {
+		ch.ArchivedAt = nil
+		ch.UnarchivedAt = tsPtr(&at)
+	}
+	return nil
+}
+
+func (r *ChannelRepo) ArchiveInactive(ctx context.Context, now time.Time) ([]domain.Channel, error) {
+	s := r.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now = ts(now)
+	var archived []domain.Channel
+	for _, ch := range s.channels {
+		ws := s.liveWorkspace(ch.WorkspaceID)
+		if ws == nil || ws.AutoArchiveDays == nil || ch.ArchivedAt != nil || ch.Type == "dm" {
+			continue
+		}
+		cutoff := now.AddDate(0, 0, -*ws.AutoArchiveDays)
+		if !ch.CreatedAt.Before(cutoff) || s.hasMessageSince(ch.ID, cutoff) {
+			continue
+		}
+		if ch.UnarchivedAt != nil && !ch.UnarchivedAt.Before(cutoff) {
+			continue
+		}
+		archivedAt := now
+		ch.ArchivedAt = &archivedAt
+		archived = append(archived, *ch)
+	}
+	return archived, nil
+}
+
+// hasMessageSince reports whether the channel has a message created at or
+// after t. The caller holds the lock.
+func (s *Store) hasMessageSince(channelID uuid.UUID, t time.Time) bool {
+	for _, msg := range s.messages {
+		if msg.ChannelID == channelID && !msg.CreatedAt.Before(t) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *ChannelRepo) AddMember(ctx context.Context, m *domain.ChannelMember) error {
+	s := r.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.channels[m.ChannelID]; !ok {
+		return ErrConstraint
+	}
+	if _, ok := s.users[m.UserID]; !ok {
+		return ErrConstraint
+	}
+	if !validChannelRole(m.Role) {
+		return ErrConstraint
+	}
+	key := memberKey{m.ChannelID, m.UserID}
+	if _, ok := s.channelMembers[key]; ok {
+		return ErrDuplicate
+	}
+	s.channelMembers[key] = &domain.ChannelMember{
+		ChannelID: m.ChannelID,
+		UserID:    m.UserID,
+		Role:      m.Role,
+		JoinedAt:  ts(m.JoinedAt),
+	}
+	return nil
+}
+
+func (r *ChannelRepo) RemoveMember(ctx context.Context, channelID, userID uuid.UUID) error {
+	s := r.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.channelMembers, memberKey{channelID, userID})
+	return nil
+}
+
+func (r *ChannelRepo) GetMember(ctx context.Context, channelID, userID uuid.UUID) (*domain.ChannelMember, error) {
+	s := r.store
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	m, ok := s.channelMembers[memberKey{channelID, userID}]
+	if !ok {
+		return nil, nil
+	}
+	cp := *m
+	return &cp, nil
+}
+
+func (r *ChannelRepo) ListMembers(ctx context.Context, channelID uuid.UUID) ([]domain.ChannelMember, error) {
+	s := r.store
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var members []domain.ChannelMember
+	for key, m := range s.channelMembers {
+		if key.parentID == channelID {
+			members = append(members, *m)
+		}
+	}
+	slices.SortStableFunc(members, func(a, b domain.ChannelMember) int {
+		return a.JoinedAt.Compare(b.JoinedAt)
+	})
+	return members, nil
+}
+
+func (r *ChannelRepo) UpdateMemberRole(ctx context.Context, channelID, userID uuid.UUID, role string) error {
+	s := r.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !validChannelRole(role) {
+		return ErrConstraint
+	}
+	if m, ok := s.channelMembers[memberKey{channelID, userID}]; ok {
+		m.Role = role
+	}
+	return nil
+}
+
+// validChannelRole mirrors the channel_members role check constraint.
+func validChannelRole(role string) bool {
+	return role == domain.ChannelRoleAdmin || role == domain.ChannelRoleMember
+}
+
+func (r *ChannelRepo) SetTopic(ctx context.Context, channelID uuid.UUID, topic *string) error {
+	s := r.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if ch, ok := s.channels[channelID]; ok {
+		ch.Topic = topic
+	}
+	return nil
+}
+
+func (r *ChannelRepo) AddTopicChange(ctx context.Context, c *domain.ChannelTopicChange) error {
+	s := r.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.channels[c.ChannelID]; !ok {
+		return ErrConstraint
+	}
+	if _, ok := s.users[c.ChangedBy]; !ok {
+		return ErrConstraint
+	}
+	if _, ok := s.topicChanges[c.ID]; ok {
+		return ErrDuplicate
+	}
+	cp := *c
+	cp.ChangedAt = ts(c.ChangedAt)
+	s.topicChanges[c.ID] = &cp
+	return nil
+}
+
+func (r *ChannelRepo) ListTopicChanges(ctx context.Context, channelID uuid.UUID, limit int) ([]domain.ChannelTopicChange, error) {
+	s := r.store
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var changes []domain.ChannelTopicChange
+	for _, c := range s.topicChanges {
+		if c.ChannelID == channelID {
+			changes = append(changes, *c)
+		}
+	}
+	slices.SortFunc(changes, func(a, b domain.ChannelTopicChange) int {
+		if c := b.ChangedAt.Compare(a.ChangedAt); c != 0 {
+			return c
+		}
+		return strings.Compare(a.ID.String(), b.ID.String())
+	})
+	if len(changes) > limit {
+		changes = changes[:limit]
+	}
+	return changes, nil
+}
+
+func (r *ChannelRepo) RecordPost(ctx context.Context, channelID, userID uuid.UUID, at, notBefore time.Time) (bool, error) {
+	s := r.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.channels[channelID]; !ok {
+		return false, ErrConstraint
+	}
+	if _, ok := s.users[userID]; !ok {
+		return false, ErrConstraint
+	}
+	key := memberKey{channelID, userID}
+	if last, ok := s.postTimes[key]; ok && last.After(notBefore) {
+		return false, nil
+	}
+	s.postTimes[key] = ts(at)
+	return true, nil
+}
+
+func (r *ChannelRepo) LastPostAt(ctx context.Context, channelID, userID uuid.UUID) (*time.Time, error) {
+	s := r.store
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	last, ok := s.postTimes[memberKey{channelID, userID}]
+	if !ok {
+		return nil, nil
+	}
+	return &last, nil
+}
+
+// channelNameTaken reports whether another channel in the workspace uses
+// name. The caller holds the lock.
+func (s *Store) channelNameTaken(workspaceID uuid.UUID, name string, except uuid.UUID) bool {
+	for _, ch := range s.channels {
+		if ch.WorkspaceID == workspaceID && ch.Name == name && ch.ID != except {
+			return true
+		}
+	}
+	return false
+}
+
+// deleteChannel removes a channel with its members and messages, as the
+// cascade from workspaces does. The caller holds the lock.
+func (s *Store) deleteChannel(id uuid.UUID) {
+	delete(s.channels, id)
+	for key := range s.channelMembers {
+		if key.parentID == id {
+			delete(s.channelMembers, key)
+		}
+	}
+	for msgID, msg := range s.messages {
+		if msg.ChannelID == id {
+			delete(s.messages, msgID)
+			delete(s.messageEmbeds, msgID)
+			delete(s.pins, msgID)
+			for itemID, item := range s.savedItems {
+				if sameID(item.MessageID, &msgID) {
+					delete(s.savedItems, itemID)
+				}
+			}
+		}
+	}
+	for bookmarkID, b := range s.bookmarks {
+		if b.ChannelID == id {
+			delete(s.bookmarks, bookmarkID)
+		}
+	}
+	for changeID, c := range s.topicChanges {
+		if c.ChannelID == id {
+			delete(s.topicChanges, changeID)
+		}
+	}
+	for key := range s.postTimes {
+		if key.parentID == id {
+			delete(s.postTimes, key)
+		}
+	}
+	for msgID, msg := range s.scheduledMessages {
+		if sameID(msg.ChannelID, &id) {
+			delete(s.scheduledMessages, msgID)
+		}
+	}
+}
+
+func (r *ChannelRepo) CreateBookmark(ctx context.Context, b *domain.ChannelBookmark) error {
+	s := r.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.channels[b.ChannelID]; !ok {
+		return ErrConstraint
+	}
+	if _, ok := s.users[b.CreatedBy]; !ok {
+		return ErrConstraint
+	}
+	if _, ok := s.bookmarks[b.ID]; ok {
+		return ErrDuplicate
+	}
+	cp := *b
+	cp.CreatedAt = ts(b.CreatedAt)
+	s.bookmarks[b.ID] = &cp
+	return nil
+}
+
+func (r *ChannelRepo) GetBookmark(ctx context.Context, id uuid.UUID) (*domain.ChannelBookmark, error) {
+	s := r.store
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	b, ok := s.bookmarks[id]
+	if !ok {
+		return nil, nil
+	}
+	cp := *b
+	return &cp, nil
+}
+
+func (r *ChannelRepo) ListBookmarks(ctx context.Context, channelID uuid.UUID) ([]domain.ChannelBookmark, error) {
+	s := r.store
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var bookmarks []domain.ChannelBookmark
+	for _, b := range s.bookmarks {
+		if b.ChannelID == channelID {
+			bookmarks = append(bookmarks, *b)
+		}
+	}
+	slices.SortFunc(bookmarks, func(a, b domain.ChannelBookmark) int {
+		if c := a.CreatedAt.Compare(b.CreatedAt); c != 0 {
+			return c
+		}
+		return strings.Compare(a.ID.String(), b.ID.String())
+	})
+	return bookmarks, nil
+}
+
+func (r *ChannelRepo) UpdateBookmark(ctx context.Context, b *domain.ChannelBookmark) error {
+	s := r.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if stored, ok := s.bookmarks[b.ID]; ok {
+		stored.Title = b.Title
+		stored.URL = b.URL
+	}
+	return nil
+}
+
+func (r *ChannelRepo) DeleteBookmark(ctx context.Context, id uuid.UUID) error {
+	s := r.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.bookmarks, id)
+	return nil
+}
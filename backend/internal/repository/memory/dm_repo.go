@@ -0,0 +1,259 @@
+package memory
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+	"github.com/vedran77/pulse/internal/domain"
+	"github.com/vedran77/pulse/internal/repository"
+)
+
+type DMRepo struct {
+	store *Store
+}
+
+func NewDMRepo(store *Store) *DMRepo {
+	return &DMRepo{store: store}
+}
+
+func (r *DMRepo) CreateConversation(ctx context.Context, conv *domain.DMConversation) error {
+	s := r.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.users[conv.User1ID]; !ok {
+		return ErrConstraint
+	}
+	if _, ok := s.users[conv.User2ID]; !ok {
+		return ErrConstraint
+	}
+	// Participants are stored in a canonical order
+	if !less(conv.User1ID, conv.User2ID) {
+		return ErrConstraint
+	}
+	if _, ok := s.dmConversations[conv.ID]; ok {
+		return ErrDuplicate
+	}
+	if s.conversationByUsers(conv.User1ID, conv.User2ID) != nil {
+		return ErrDuplicate
+	}
+	s.dmConversations[conv.ID] = &domain.DMConversation{
+		ID:        conv.ID,
+		User1ID:   conv.User1ID,
+		User2ID:   conv.User2ID,
+		CreatedAt: ts(conv.CreatedAt),
+	}
+	return nil
+}
+
+func (r *DMRepo) GetConversationByUsers(ctx context.Context, user1ID, user2ID uuid.UUID) (*domain.DMConversation, error) {
+	s := r.store
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	conv := s.conversationByUsers(user1ID, user2ID)
+	if conv == nil {
+		return nil, nil
+	}
+	cp := *conv
+	return &cp, nil
+}
+
+func (r *DMRepo) GetConversationByID(ctx context.Context, id uuid.UUID) (*domain.DMConversation, error) {
+	s := r.store
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	conv, ok := s.dmConversations[id]
+	if !ok {
+		return nil, nil
+	}
+	cp := *conv
+	return &cp, nil
+}
+
+func (r *DMRepo) ListConversations(ctx context.Context, userID uuid.UUID, p repository.Page) ([]domain.DMConversation, error) {
+	s := r.store
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var convs []domain.DMConversation
+	for _, conv := range s.dmConversations {
+		if conv.User1ID != userID && conv.User2ID != userID {
+			continue
+		}
+		cp := *conv
+		cp.OtherUserID = conv.User2ID
+		if conv.User2ID == userID {
+			cp.OtherUserID = conv.User1ID
+		}
+		other := s.users[cp.OtherUserID]
+		cp.OtherUserUsername = other.Username
+		cp.OtherUserDisplayName = other.DisplayName
+
+		settings := s.dmParticipants[memberKey{conv.ID, userID}]
+		if settings == nil {
+			settings = &domain.DMParticipant{}
+		}
+		cp.Muted = settings.Muted
+		cp.LastActivityAt = conv.CreatedAt
+		var last *domain.DMMessage
+		for _, msg := range s.dmMessages {
+			if msg.ConversationID != conv.ID || msg.DeletedAt != nil {
+				continue
+			}
+			if last == nil || msg.CreatedAt.After(last.CreatedAt) || (msg.CreatedAt.Equal(last.CreatedAt) && less(last.ID, msg.ID)) {
+				last = msg
+			}
+			if msg.SenderID != userID && (settings.LastReadAt == nil || msg.CreatedAt.After(*settings.LastReadAt)) {
+				cp.UnreadCount++
+			}
+		}
+		if last != nil {
+			cp.LastActivityAt = last.CreatedAt
+			cp.LastMessage = &domain.DMMessagePreview{ID: last.ID, SenderID: last.SenderID, CreatedAt: last.CreatedAt}
+			if last.Content != nil {
+				cp.LastMessage.Content = *last.Content
+			}
+		}
+		if settings.HiddenAt != nil && !cp.LastActivityAt.After(*settings.HiddenAt) {
+			continue
+		}
+		convs = append(convs, cp)
+	}
+	return page(convs, p, func(c domain.DMConversation) repository.PageKey {
+		return repository.PageKey{Time: c.LastActivityAt, ID: c.ID}
+	}, true, false), nil
+}
+
+func (r *DMRepo) GetParticipant(ctx context.Context, conversationID, userID uuid.UUID) (*domain.DMParticipant, error) {
+	s := r.store
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	p, ok := s.dmParticipants[memberKey{conversationID, userID}]
+	if !ok {
+		return nil, nil
+	}
+	cp := *p
+	return &cp, nil
+}
+
+func (r *DMRepo) SaveParticipant(ctx context.Context, p *domain.DMParticipant) error {
+	s := r.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.dmConversations[p.ConversationID]; !ok {
+		return ErrConstraint
+	}
+	if _, ok := s.users[p.UserID]; !ok {
+		return ErrConstraint
+	}
+	s.dmParticipants[memberKey{p.ConversationID, p.UserID}] = &domain.DMParticipant{
+		ConversationID: p.ConversationID,
+		UserID:         p.UserID,
+		LastReadAt:     tsPtr(p.LastReadAt),
+		HiddenAt:       tsPtr(p.HiddenAt),
+		Muted:          p.Muted,
+	}
+	return nil
+}
+
+func (r *DMRepo) CreateMessage(ctx context.Context, msg *domain.DMMessage) error {
+	s := r.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.dmConversations[msg.ConversationID]; !ok {
+		return ErrConstraint
+	}
+	if _, ok := s.users[msg.SenderID]; !ok {
+		return ErrConstraint
+	}
+	if _, ok := s.dmMessages[msg.ID]; ok {
+		return ErrDuplicate
+	}
+	s.dmMessages[msg.ID] = &domain.DMMessage{
+		ID:             msg.ID,
+		ConversationID: msg.ConversationID,
+		SenderID:       msg.SenderID,
+		Content:        msg.Content,
+		CreatedAt:      ts(msg.CreatedAt),
+	}
+	return nil
+}
+
+func (r *DMRepo) GetMessageByID(ctx context.Context, id uuid.UUID) (*domain.DMMessage, error) {
+	s := r.store
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	msg, ok := s.dmMessages[id]
+	if !ok {
+		return nil, nil
+	}
+	cp := s.dmWithSender(msg)
+	return &cp, nil
+}
+
+func (r *DMRepo) ListMessages(ctx context.Context, conversationID uuid.UUID, p repository.Page) ([]domain.DMMessage, error) {
+	s := r.store
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var messages []domain.DMMessage
+	for _, msg := range s.dmMessages {
+		if msg.ConversationID == conversationID && msg.DeletedAt == nil {
+			messages = append(messages, s.dmWithSender(msg))
+		}
+	}
+	return page(messages, p, func(m domain.DMMessage) repository.PageKey {
+		return repository.PageKey{Time: m.CreatedAt, ID: m.ID}
+	}, false, true), nil
+}
+
+func (r *DMRepo) UpdateMessage(ctx context.Context, msg *domain.DMMessage) error {
+	s := r.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if stored, ok := s.dmMessages[msg.ID]; ok {
+		t := now()
+		stored.Content = msg.Content
+		stored.EditedAt = &t
+	}
+	return nil
+}
+
+func (r *DMRepo) SoftDeleteMessage(ctx context.Context, id uuid.UUID) error {
+	s := r.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if stored, ok := s.dmMessages[id]; ok {
+		t := now()
+		stored.DeletedAt = &t
+	}
+	return nil
+}
+
+// conversationByUsers looks up a conversation by its ordered participants.
+// The caller holds the lock.
+func (s *Store) conversationByUsers(user1ID, user2ID uuid.UUID) *domain.DMConversation {
+	for _, conv := range s.dmConversations {
+		if conv.User1ID == user1ID && conv.User2ID == user2ID {
+			return conv
+		}
+	}
+	return nil
+}
+
+// dmWithSender copies msg and fills in the sender's names. The caller holds the lock.
+func (s *Store) dmWithSender(msg *domain.DMMessage) domain.DMMessage {
+	cp := *msg
+	u := s.users[msg.SenderID]
+	cp.SenderUsername = u.Username
+	cp.SenderDisplayName = u.DisplayName
+	return cp
+}
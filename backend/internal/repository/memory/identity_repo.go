@@ -0,0 +1,130 @@
+package memory
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/vedran77/pulse/internal/domain"
+)
+
+type IdentityRepo struct {
+	store *Store
+}
+
+func NewIdentityRepo(store *Store) *IdentityRepo {
+	return &IdentityRepo{store: store}
+}
+
+func (r *IdentityRepo) Create(ctx context.Context, identity *domain.UserIdentity) error {
+	s := r.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.users[identity.UserID]; !ok {
+		return ErrConstraint
+	}
+	if _, ok := s.identities[identity.ID]; ok {
+		return ErrDuplicate
+	}
+	for _, i := range s.identities {
+		if i.Issuer == identity.Issuer && i.Subject == identity.Subject {
+			return ErrDuplicate
+		}
+	}
+	cp := *identity
+	cp.CreatedAt = ts(identity.CreatedAt)
+	cp.LastLoginAt = tsPtr(identity.LastLoginAt)
+	s.identities[identity.ID] = &cp
+	return nil
+}
+
+func (r *IdentityRepo) GetBySubject(ctx context.Context, issuer, subject string) (*domain.UserIdentity, error) {
+	s := r.store
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, i := range s.identities {
+		if i.Issuer == issuer && i.Subject == subject {
+			cp := *i
+			return &cp, nil
+		}
+	}
+	return nil, nil
+}
+
+func (r *IdentityRepo) HasIdentity(ctx context.Context, userID uuid.UUID) (bool, error) {
+	s := r.store
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, i := range s.identities {
+		if i.UserID == userID {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (r *IdentityRepo) TouchLogin(ctx context.Context, id uuid.UUID) error {
+	s := r.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if i, ok := s.identities[id]; ok {
+		t := now()
+		i.LastLoginAt = &t
+	}
+	return nil
+}
+
+func (r *IdentityRepo) RequiresSSO(ctx context.Context, userID uuid.UUID) (bool, error) {
+	s := r.store
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for key := range s.workspaceMembers {
+		if key.userID != userID {
+			continue
+		}
+		if ws := s.liveWorkspace(key.parentID); ws != nil && ws.RequireSSO {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (r *IdentityRepo) CreateLoginState(ctx context.Context, state *domain.OIDCLoginState) error {
+	s := r.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Abandoned logins are cleaned up here, as in Postgres
+	t := time.Now()
+	for hash, st := range s.loginStates {
+		if st.ExpiresAt.Before(t) {
+			delete(s.loginStates, hash)
+		}
+	}
+	if _, ok := s.loginStates[state.StateHash]; ok {
+		return ErrDuplicate
+	}
+	cp := *state
+	cp.ExpiresAt = ts(state.ExpiresAt)
+	cp.CreatedAt = ts(state.CreatedAt)
+	s.loginStates[state.StateHash] = &cp
+	return nil
+}
+
+func (r *IdentityRepo) ConsumeLoginState(ctx context.Context, stateHash string) (*domain.OIDCLoginState, error) {
+	s := r.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	st, ok := s.loginStates[stateHash]
+	if !ok {
+		return nil, nil
+	}
+	delete(s.loginStates, stateHash)
+	return st, nil
+}
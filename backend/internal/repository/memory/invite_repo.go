@@ -0,0 +1,171 @@
+package memory
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/vedran77/pulse/internal/domain"
+	"github.com/vedran77/pulse/internal/repository"
+)
+
+type InviteRepo struct {
+	store *Store
+}
+
+func NewInviteRepo(store *Store) *InviteRepo {
+	return &InviteRepo{store: store}
+}
+
+func (r *InviteRepo) Create(ctx context.Context, inv *domain.WorkspaceInvite) error {
+	s := r.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.workspaces[inv.WorkspaceID]; !ok {
+		return ErrConstraint
+	}
+	if _, ok := s.users[inv.InvitedBy]; !ok {
+		return ErrConstraint
+	}
+	if inv.Type != domain.InviteTypeEmail && inv.Type != domain.InviteTypeLink {
+		return ErrConstraint
+	}
+	if inv.Type == domain.InviteTypeEmail && inv.Email == "" {
+		return ErrConstraint
+	}
+	if inv.MaxUses != nil && *inv.MaxUses <= 0 {
+		return ErrConstraint
+	}
+	if _, ok := s.invites[inv.ID]; ok {
+		return ErrDuplicate
+	}
+	for _, other := range s.invites {
+		if other.Token == inv.Token {
+			return ErrDuplicate
+		}
+		// Like NULLs in Postgres, link invites without an email never collide
+		if inv.Email != "" && other.WorkspaceID == inv.WorkspaceID && other.Email == inv.Email {
+			return ErrDuplicate
+		}
+	}
+	var maxUses *int
+	if inv.MaxUses != nil {
+		n := *inv.MaxUses
+		maxUses = &n
+	}
+	s.invites[inv.ID] = &domain.WorkspaceInvite{
+		ID:          inv.ID,
+		WorkspaceID: inv.WorkspaceID,
+		Type:        inv.Type,
+		Email:       inv.Email,
+		Token:       inv.Token,
+		Role:        inv.Role,
+		MaxUses:     maxUses,
+		InvitedBy:   inv.InvitedBy,
+		CreatedAt:   ts(inv.CreatedAt),
+		ExpiresAt:   ts(inv.ExpiresAt),
+	}
+	return nil
+}
+
+func (r *InviteRepo) GetByID(ctx context.Context, id uuid.UUID) (*domain.WorkspaceInvite, error) {
+	s := r.store
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	inv, ok := s.invites[id]
+	if !ok || s.liveWorkspace(inv.WorkspaceID) == nil {
+		return nil, nil
+	}
+	return s.inviteWithWorkspace(inv), nil
+}
+
+func (r *InviteRepo) GetByToken(ctx context.Context, token string) (*domain.WorkspaceInvite, error) {
+	s := r.store
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, inv := range s.invites {
+		if inv.Token == token && s.liveWorkspace(inv.WorkspaceID) != nil {
+			return s.inviteWithWorkspace(inv), nil
+		}
+	}
+	return nil, nil
+}
+
+func (r *InviteRepo) ListByWorkspace(ctx context.Context, workspaceID uuid.UUID, p repository.Page) ([]domain.WorkspaceInvite, error) {
+	s := r.store
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var invites []domain.WorkspaceInvite
+	for _, inv := range s.invites {
+		if inv.WorkspaceID == workspaceID && inv.AcceptedAt == nil {
+			invites = append(invites, copyInvite(inv))
+		}
+	}
+	return page(invites, p, func(inv domain.WorkspaceInvite) repository.PageKey {
+		return repository.PageKey{Time: inv.CreatedAt, ID: inv.ID}
+	}, true, false), nil
+}
+
+func (r *InviteRepo) RecordUse(ctx context.Context, id, userID uuid.UUID) (bool, error) {
+	s := r.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	inv, ok := s.invites[id]
+	if !ok || inv.AcceptedAt != nil {
+		return false, nil
+	}
+	if inv.MaxUses != nil && inv.UseCount >= *inv.MaxUses {
+		return false, nil
+	}
+	if inv.MaxUses != nil && inv.UseCount+1 >= *inv.MaxUses {
+		if _, ok := s.users[userID]; !ok {
+			return false, ErrConstraint
+		}
+		t := now()
+		inv.AcceptedAt = &t
+		inv.AcceptedBy = &userID
+	}
+	inv.UseCount++
+	return true, nil
+}
+
+func (r *InviteRepo) UpdateExpiry(ctx context.Context, id uuid.UUID, expiresAt time.Time) error {
+	s := r.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if inv, ok := s.invites[id]; ok {
+		inv.ExpiresAt = ts(expiresAt)
+	}
+	return nil
+}
+
+func (r *InviteRepo) Delete(ctx context.Context, id uuid.UUID) error {
+	s := r.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.invites, id)
+	return nil
+}
+
+// inviteWithWorkspace copies inv and fills in the workspace name. The caller holds the lock.
+func (s *Store) inviteWithWorkspace(inv *domain.WorkspaceInvite) *domain.WorkspaceInvite {
+	cp := copyInvite(inv)
+	cp.WorkspaceName = s.workspaces[inv.WorkspaceID].Name
+	return &cp
+}
+
+func copyInvite(inv *domain.WorkspaceInvite) domain.WorkspaceInvite {
+	cp := *inv
+	if inv.MaxUses != nil {
+		n := *inv.MaxUses
+		cp.MaxUses = &n
+	}
+	return cp
+}
@@ -0,0 +1,29 @@
+package memory_test
+
+import (
+	"testing"
+
+	"github.com/vedran77/pulse/internal/repository/memory"
+	"github.com/vedran77/pulse/internal/repository/repotest"
+)
+
+func TestContract(t *testing.T) {
+	repotest.Run(t, func(t *testing.T) repotest.Repos {
+		s := memory.NewStore()
+		return repotest.Repos{
+			Users:      memory.NewUserRepo(s),
+			Tokens:     memory.NewVerificationTokenRepo(s),
+			TwoFactor:  memory.NewTwoFactorRepo(s),
+			Identities: memory.NewIdentityRepo(s),
+			Workspaces: memory.NewWorkspaceRepo(s),
+			Channels:   memory.NewChannelRepo(s),
+			Invites:    memory.NewInviteRepo(s),
+			Messages:   memory.NewMessageRepo(s),
+			Pulsemates: memory.NewPulsemateRepo(s),
+			DMs:        memory.NewDMRepo(s),
+			Saved:      memory.NewSavedItemRepo(s),
+			Scheduled:  memory.NewScheduledMessageRepo(s),
+			Tx:         memory.NewTxManager(s),
+		}
+	})
+}
@@ -0,0 +1,218 @@
+package memory
+
+import (
+	"context"
+	"slices"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/vedran77/pulse/internal/domain"
+	"github.com/vedran77/pulse/internal/repository"
+)
+
+type MessageRepo struct {
+	store *Store
+}
+
+func NewMessageRepo(store *Store) *MessageRepo {
+	return &MessageRepo{store: store}
+}
+
+func (r *MessageRepo) Create(ctx context.Context, msg *domain.Message) error {
+	s := r.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.channels[msg.ChannelID]; !ok {
+		return ErrConstraint
+	}
+	if _, ok := s.users[msg.SenderID]; !ok {
+		return ErrConstraint
+	}
+	if msg.ParentID != nil {
+		if _, ok := s.messages[*msg.ParentID]; !ok {
+			return ErrConstraint
+		}
+	}
+	if _, ok := s.messages[msg.ID]; ok {
+		return ErrDuplicate
+	}
+	s.messages[msg.ID] = &domain.Message{
+		ID:        msg.ID,
+		ChannelID: msg.ChannelID,
+		SenderID:  msg.SenderID,
+		Content:   msg.Content,
+		Type:      msg.Type,
+		ParentID:  msg.ParentID,
+		CreatedAt: ts(msg.CreatedAt),
+	}
+	return nil
+}
+
+func (r *MessageRepo) GetByID(ctx context.Context, id uuid.UUID) (*domain.Message, error) {
+	s := r.store
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	msg, ok := s.messages[id]
+	if !ok {
+		return nil, nil
+	}
+	cp := s.withSender(msg)
+	return &cp, nil
+}
+
+func (r *MessageRepo) ListByChannel(ctx context.Context, channelID uuid.UUID, p repository.Page) ([]domain.Message, error) {
+	s := r.store
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var messages []domain.Message
+	for _, msg := range s.messages {
+		if msg.ChannelID == channelID && msg.DeletedAt == nil {
+			messages = append(messages, s.withSender(msg))
+		}
+	}
+	return page(messages, p, func(m domain.Message) repository.PageKey {
+		return repository.PageKey{Time: m.CreatedAt, ID: m.ID}
+	}, false, true), nil
+}
+
+func (r *MessageRepo) Update(ctx context.Context, msg *domain.Message) error {
+	s := r.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if stored, ok := s.messages[msg.ID]; ok {
+		t := now()
+		stored.Content = msg.Content
+		stored.EditedAt = &t
+	}
+	return nil
+}
+
+func (r *MessageRepo) SoftDelete(ctx context.Context, id uuid.UUID) error {
+	s := r.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if stored, ok := s.messages[id]; ok {
+		t := now()
+		stored.DeletedAt = &t
+	}
+	return nil
+}
+
+func (r *MessageRepo) SetEmbeds(ctx context.Context, messageID uuid.UUID, embeds []domain.MessageEmbed) error {
+	s := r.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.messages[messageID]; !ok && len(embeds) > 0 {
+		return ErrConstraint
+	}
+	var stored []domain.MessageEmbed
+	for _, e := range embeds {
+		// Postgres skips a repeated URL with ON CONFLICT DO NOTHING
+		if !slices.ContainsFunc(stored, func(o domain.MessageEmbed) bool { return o.URL == e.URL }) {
+			stored = append(stored, e)
+		}
+	}
+	if stored == nil {
+		delete(s.messageEmbeds, messageID)
+	} else {
+		s.messageEmbeds[messageID] = stored
+	}
+	return nil
+}
+
+func (r *MessageRepo) AddPin(ctx context.Context, pin *domain.PinnedMessage, limit int) (bool, error) {
+	s := r.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.messages[pin.MessageID]; !ok {
+		return false, ErrConstraint
+	}
+	if _, ok := s.channels[pin.ChannelID]; !ok {
+		return false, ErrConstraint
+	}
+	if _, ok := s.users[pin.PinnedBy]; !ok {
+		return false, ErrConstraint
+	}
+	if _, ok := s.pins[pin.MessageID]; ok {
+		return false, nil
+	}
+	count := 0
+	for _, p := range s.pins {
+		if p.ChannelID == pin.ChannelID {
+			count++
+		}
+	}
+	if count >= limit {
+		return false, nil
+	}
+	cp := *pin
+	cp.PinnedAt = ts(pin.PinnedAt)
+	cp.Message = nil
+	s.pins[pin.MessageID] = &cp
+	return true, nil
+}
+
+func (r *MessageRepo) GetPin(ctx context.Context, messageID uuid.UUID) (*domain.PinnedMessage, error) {
+	s := r.store
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	pin, ok := s.pins[messageID]
+	if !ok {
+		return nil, nil
+	}
+	cp := *pin
+	return &cp, nil
+}
+
+func (r *MessageRepo) ListPins(ctx context.Context, channelID uuid.UUID) ([]domain.PinnedMessage, error) {
+	s := r.store
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var pins []domain.PinnedMessage
+	for _, pin := range s.pins {
+		msg := s.messages[pin.MessageID]
+		if pin.ChannelID != channelID || msg.DeletedAt != nil {
+			continue
+		}
+		cp := *pin
+		full := s.withSender(msg)
+		cp.Message = &full
+		pins = append(pins, cp)
+	}
+	slices.SortFunc(pins, func(a, b domain.PinnedMessage) int {
+		if c := b.PinnedAt.Compare(a.PinnedAt); c != 0 {
+			return c
+		}
+		return strings.Compare(a.MessageID.String(), b.MessageID.String())
+	})
+	return pins, nil
+}
+
+func (r *MessageRepo) RemovePin(ctx context.Context, messageID uuid.UUID) error {
+	s := r.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.pins, messageID)
+	return nil
+}
+
+// withSender copies msg and fills in the sender's names and the link
+// previews. The caller holds the lock.
+func (s *Store) withSender(msg *domain.Message) domain.Message {
+	cp := *msg
+	u := s.users[msg.SenderID]
+	cp.SenderUsername = u.Username
+	cp.SenderDisplayName = u.DisplayName
+	cp.Embeds = slices.Clone(s.messageEmbeds[msg.ID])
+	return cp
+}
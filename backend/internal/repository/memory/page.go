@@ -0,0 +1,41 @@
+package memory
+
+import (
+	"bytes"
+	"cmp"
+	"slices"
+
+	"github.com/vedran77/pulse/internal/repository"
+)
+
+// page sorts items into list order, ascending by key unless desc, and
+// returns the ones in p the way the Postgres keyset queries do. fromEnd
+// makes a page without a cursor hold the last items of the list.
+func page[T any](items []T, p repository.Page, key func(T) repository.PageKey, desc, fromEnd bool) []T {
+	order := func(a, b repository.PageKey) int {
+		c := cmp.Or(a.Time.Compare(b.Time), bytes.Compare(a.ID[:], b.ID[:]))
+		if desc {
+			return -c
+		}
+		return c
+	}
+	slices.SortFunc(items, func(a, b T) int { return order(key(a), key(b)) })
+
+	limit := max(p.Limit, 0)
+	switch {
+	case p.After != nil:
+		items = slices.DeleteFunc(items, func(item T) bool { return order(key(item), *p.After) <= 0 })
+		items = items[:min(limit, len(items))]
+	case p.Before != nil:
+		items = slices.DeleteFunc(items, func(item T) bool { return order(key(item), *p.Before) >= 0 })
+		items = items[max(len(items)-limit, 0):]
+	case fromEnd:
+		items = items[max(len(items)-limit, 0):]
+	default:
+		items = items[:min(limit, len(items))]
+	}
+	if len(items) == 0 {
+		return nil
+	}
+	return items
+}
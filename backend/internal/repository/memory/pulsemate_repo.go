@@ -0,0 +1,242 @@
+package memory
+
+import (
+	"context"
+	"slices"
+
+	"github.com/google/uuid"
+	"github.com/vedran77/pulse/internal/domain"
+	"github.com/vedran77/pulse/internal/repository"
+)
+
+type PulsemateRepo struct {
+	store *Store
+}
+
+func NewPulsemateRepo(store *Store) *PulsemateRepo {
+	return &PulsemateRepo{store: store}
+}
+
+func (r *PulsemateRepo) CreateRequest(ctx context.Context, req *domain.PulsemateRequest) error {
+	s := r.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.users[req.SenderID]; !ok {
+		return ErrConstraint
+	}
+	if _, ok := s.users[req.ReceiverID]; !ok {
+		return ErrConstraint
+	}
+	if req.SenderID == req.ReceiverID || (req.Status != "pending" && req.Status != "rejected") {
+		return ErrConstraint
+	}
+	if _, ok := s.pulsemateRequests[req.ID]; ok {
+		return ErrDuplicate
+	}
+	if s.requestByUsers(req.SenderID, req.ReceiverID) != nil {
+		return ErrDuplicate
+	}
+	s.pulsemateRequests[req.ID] = &domain.PulsemateRequest{
+		ID:         req.ID,
+		SenderID:   req.SenderID,
+		ReceiverID: req.ReceiverID,
+		Status:     req.Status,
+		CreatedAt:  ts(req.CreatedAt),
+	}
+	return nil
+}
+
+func (r *PulsemateRepo) GetRequestByID(ctx context.Context, id uuid.UUID) (*domain.PulsemateRequest, error) {
+	s := r.store
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	req, ok := s.pulsemateRequests[id]
+	if !ok {
+		return nil, nil
+	}
+	cp := *req
+	return &cp, nil
+}
+
+func (r *PulsemateRepo) GetRequestByUsers(ctx context.Context, senderID, receiverID uuid.UUID) (*domain.PulsemateRequest, error) {
+	s := r.store
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	req := s.requestByUsers(senderID, receiverID)
+	if req == nil {
+		return nil, nil
+	}
+	cp := *req
+	return &cp, nil
+}
+
+func (r *PulsemateRepo) ListIncomingRequests(ctx context.Context, userID uuid.UUID) ([]domain.PulsemateRequest, error) {
+	s := r.store
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var reqs []domain.PulsemateRequest
+	for _, req := range s.pulsemateRequests {
+		if req.ReceiverID != userID || req.Status != "pending" {
+			continue
+		}
+		cp := *req
+		sender := s.users[req.SenderID]
+		cp.SenderUsername = sender.Username
+		cp.SenderDisplayName = sender.DisplayName
+		reqs = append(reqs, cp)
+	}
+	sortNewestFirst(reqs)
+	return reqs, nil
+}
+
+func (r *PulsemateRepo) ListOutgoingRequests(ctx context.Context, userID uuid.UUID) ([]domain.PulsemateRequest, error) {
+	s := r.store
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var reqs []domain.PulsemateRequest
+	for _, req := range s.pulsemateRequests {
+		if req.SenderID != userID || req.Status != "pending" {
+			continue
+		}
+		cp := *req
+		receiver := s.users[req.ReceiverID]
+		cp.ReceiverUsername = receiver.Username
+		cp.ReceiverDisplayName = receiver.DisplayName
+		reqs = append(reqs, cp)
+	}
+	sortNewestFirst(reqs)
+	return reqs, nil
+}
+
+func (r *PulsemateRepo) DeleteRequest(ctx context.Context, id uuid.UUID) error {
+	s := r.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.pulsemateRequests, id)
+	return nil
+}
+
+func (r *PulsemateRepo) CreatePulsemate(ctx context.Context, pm *domain.Pulsemate) error {
+	s := r.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.users[pm.User1ID]; !ok {
+		return ErrConstraint
+	}
+	if _, ok := s.users[pm.User2ID]; !ok {
+		return ErrConstraint
+	}
+	if !less(pm.User1ID, pm.User2ID) {
+		return ErrConstraint
+	}
+	if _, ok := s.pulsemates[pm.ID]; ok {
+		return ErrDuplicate
+	}
+	if s.pulsemateByUsers(pm.User1ID, pm.User2ID) != nil {
+		return ErrDuplicate
+	}
+	s.pulsemates[pm.ID] = &domain.Pulsemate{
+		ID:        pm.ID,
+		User1ID:   pm.User1ID,
+		User2ID:   pm.User2ID,
+		CreatedAt: ts(pm.CreatedAt),
+	}
+	return nil
+}
+
+func (r *PulsemateRepo) GetPulsemateByUsers(ctx context.Context, user1ID, user2ID uuid.UUID) (*domain.Pulsemate, error) {
+	s := r.store
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	pm := s.pulsemateByUsers(user1ID, user2ID)
+	if pm == nil {
+		return nil, nil
+	}
+	cp := *pm
+	return &cp, nil
+}
+
+func (r *PulsemateRepo) DeletePulsemate(ctx context.Context, user1ID, user2ID uuid.UUID) error {
+	s := r.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if pm := s.pulsemateByUsers(user1ID, user2ID); pm != nil {
+		delete(s.pulsemates, pm.ID)
+	}
+	return nil
+}
+
+func (r *PulsemateRepo) ListPulsemates(ctx context.Context, userID uuid.UUID, p repository.Page) ([]domain.Pulsemate, error) {
+	s := r.store
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var pms []domain.Pulsemate
+	for _, pm := range s.pulsemates {
+		if pm.User1ID != userID && pm.User2ID != userID {
+			continue
+		}
+		cp := *pm
+		cp.OtherUserID = pm.User2ID
+		if pm.User2ID == userID {
+			cp.OtherUserID = pm.User1ID
+		}
+		other := s.users[cp.OtherUserID]
+		cp.OtherUsername = other.Username
+		cp.OtherDisplayName = other.DisplayName
+		cp.OtherStatus = other.Status
+		pms = append(pms, cp)
+	}
+	return page(pms, p, func(pm domain.Pulsemate) repository.PageKey {
+		return repository.PageKey{Time: pm.CreatedAt, ID: pm.ID}
+	}, true, false), nil
+}
+
+func (r *PulsemateRepo) ArePulsemates(ctx context.Context, userA, userB uuid.UUID) (bool, error) {
+	s := r.store
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	u1, u2 := userA, userB
+	if less(u2, u1) {
+		u1, u2 = u2, u1
+	}
+	return s.pulsemateByUsers(u1, u2) != nil, nil
+}
+
+// requestByUsers returns the stored request from sender to receiver, if any.
+// The caller holds the lock.
+func (s *Store) requestByUsers(senderID, receiverID uuid.UUID) *domain.PulsemateRequest {
+	for _, req := range s.pulsemateRequests {
+		if req.SenderID == senderID && req.ReceiverID == receiverID {
+			return req
+		}
+	}
+	return nil
+}
+
+// pulsemateByUsers looks up a pulsemate pair by its ordered users. The
+// caller holds the lock.
+func (s *Store) pulsemateByUsers(user1ID, user2ID uuid.UUID) *domain.Pulsemate {
+	for _, pm := range s.pulsemates {
+		if pm.User1ID == user1ID && pm.User2ID == user2ID {
+			return pm
+		}
+	}
+	return nil
+}
+
+func sortNewestFirst(reqs []domain.PulsemateRequest) {
+	slices.SortStableFunc(reqs, func(a, b domain.PulsemateRequest) int {
+		return b.CreatedAt.Compare(a.CreatedAt)
+	})
+}
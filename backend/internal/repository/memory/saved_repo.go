@@ -0,0 +1,173 @@
+package memory
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/vedran77/pulse/internal/domain"
+)
+
+type SavedItemRepo struct {
+	store *Store
+}
+
+func NewSavedItemRepo(store *Store) *SavedItemRepo {
+	return &SavedItemRepo{store: store}
+}
+
+func (r *SavedItemRepo) Create(ctx context.Context, item *domain.SavedItem) error {
+	s := r.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.users[item.UserID]; !ok {
+		return ErrConstraint
+	}
+	if (item.MessageID == nil) == (item.DMMessageID == nil) {
+		return ErrConstraint
+	}
+	if item.MessageID != nil {
+		if _, ok := s.messages[*item.MessageID]; !ok {
+			return ErrConstraint
+		}
+	}
+	if item.DMMessageID != nil {
+		if _, ok := s.dmMessages[*item.DMMessageID]; !ok {
+			return ErrConstraint
+		}
+	}
+	if _, ok := s.savedItems[item.ID]; ok {
+		return ErrDuplicate
+	}
+	for _, existing := range s.savedItems {
+		if existing.UserID == item.UserID && (sameID(existing.MessageID, item.MessageID) || sameID(existing.DMMessageID, item.DMMessageID)) {
+			return ErrDuplicate
+		}
+	}
+	s.savedItems[item.ID] = &domain.SavedItem{
+		ID:          item.ID,
+		UserID:      item.UserID,
+		MessageID:   item.MessageID,
+		DMMessageID: item.DMMessageID,
+		RemindAt:    tsPtr(item.RemindAt),
+		CreatedAt:   ts(item.CreatedAt),
+	}
+	return nil
+}
+
+// sameID reports whether both IDs are set and equal, like a unique
+// constraint that ignores NULLs.
+func sameID(a, b *uuid.UUID) bool {
+	return a != nil && b != nil && *a == *b
+}
+
+func (r *SavedItemRepo) GetByID(ctx context.Context, id uuid.UUID) (*domain.SavedItem, error) {
+	s := r.store
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	item, ok := s.savedItems[id]
+	if !ok {
+		return nil, nil
+	}
+	cp := *item
+	return &cp, nil
+}
+
+func (r *SavedItemRepo) GetByMessage(ctx context.Context, userID, messageID uuid.UUID) (*domain.SavedItem, error) {
+	s := r.store
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, item := range s.savedItems {
+		if item.UserID == userID && (sameID(item.MessageID, &messageID) || sameID(item.DMMessageID, &messageID)) {
+			cp := *item
+			return &cp, nil
+		}
+	}
+	return nil, nil
+}
+
+func (r *SavedItemRepo) ListByUser(ctx context.Context, userID uuid.UUID) ([]domain.SavedItem, error) {
+	s := r.store
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var items []domain.SavedItem
+	for _, item := range s.savedItems {
+		if item.UserID == userID {
+			items = append(items, *item)
+		}
+	}
+	slices.SortFunc(items, func(a, b domain.SavedItem) int {
+		if c := b.CreatedAt.Compare(a.CreatedAt); c != 0 {
+			return c
+		}
+		return strings.Compare(a.ID.String(), b.ID.String())
+	})
+	return items, nil
+}
+
+func (r *SavedItemRepo) SetReminder(ctx context.Context, id uuid.UUID, remindAt *time.Time) error {
+	s := r.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if item, ok := s.savedItems[id]; ok {
+		cp := *item
+		cp.RemindAt = tsPtr(remindAt)
+		cp.RemindedAt = nil
+		s.savedItems[id] = &cp
+	}
+	return nil
+}
+
+func (r *SavedItemRepo) Delete(ctx context.Context, id uuid.UUID) error {
+	s := r.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.savedItems, id)
+	return nil
+}
+
+func (r *SavedItemRepo) ListDueReminders(ctx context.Context, now time.Time, limit int) ([]domain.SavedItem, error) {
+	s := r.store
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var items []domain.SavedItem
+	for _, item := range s.savedItems {
+		if item.RemindAt != nil && !item.RemindAt.After(now) && item.RemindedAt == nil {
+			items = append(items, *item)
+		}
+	}
+	slices.SortFunc(items, func(a, b domain.SavedItem) int {
+		if c := a.RemindAt.Compare(*b.RemindAt); c != 0 {
+			return c
+		}
+		return strings.Compare(a.ID.String(), b.ID.String())
+	})
+	if len(items) > limit {
+		items = items[:limit]
+	}
+	return items, nil
+}
+
+func (r *SavedItemRepo) MarkReminded(ctx context.Context, id uuid.UUID, at time.Time) (bool, error) {
+	s := r.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	item, ok := s.savedItems[id]
+	if !ok || item.RemindAt == nil || item.RemindedAt != nil {
+		return false, nil
+	}
+	cp := *item
+	cp.RemindedAt = tsPtr(&at)
+	s.savedItems[id] = &cp
+	return true, nil
+}
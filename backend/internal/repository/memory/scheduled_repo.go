@@ -0,0 +1,179 @@
+package memory
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/vedran77/pulse/internal/domain"
+)
+
+type ScheduledMessageRepo struct {
+	store *Store
+}
+
+func NewScheduledMessageRepo(store *Store) *ScheduledMessageRepo {
+	return &ScheduledMessageRepo{store: store}
+}
+
+func (r *ScheduledMessageRepo) Create(ctx context.Context, msg *domain.ScheduledMessage) error {
+	s := r.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.users[msg.UserID]; !ok {
+		return ErrConstraint
+	}
+	if (msg.ChannelID == nil) == (msg.ConversationID == nil) {
+		return ErrConstraint
+	}
+	if msg.ChannelID != nil {
+		if _, ok := s.channels[*msg.ChannelID]; !ok {
+			return ErrConstraint
+		}
+	}
+	if msg.ConversationID != nil {
+		if _, ok := s.dmConversations[*msg.ConversationID]; !ok {
+			return ErrConstraint
+		}
+	}
+	if msg.ParentID != nil {
+		if _, ok := s.messages[*msg.ParentID]; !ok {
+			return ErrConstraint
+		}
+	}
+	if _, ok := s.scheduledMessages[msg.ID]; ok {
+		return ErrDuplicate
+	}
+	s.scheduledMessages[msg.ID] = &domain.ScheduledMessage{
+		ID:             msg.ID,
+		UserID:         msg.UserID,
+		ChannelID:      msg.ChannelID,
+		ConversationID: msg.ConversationID,
+		ParentID:       msg.ParentID,
+		Content:        msg.Content,
+		SendAt:         ts(msg.SendAt),
+		CreatedAt:      ts(msg.CreatedAt),
+		UpdatedAt:      ts(msg.UpdatedAt),
+	}
+	return nil
+}
+
+func (r *ScheduledMessageRepo) GetByID(ctx context.Context, id uuid.UUID) (*domain.ScheduledMessage, error) {
+	s := r.store
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	msg, ok := s.scheduledMessages[id]
+	if !ok {
+		return nil, nil
+	}
+	cp := *msg
+	return &cp, nil
+}
+
+func (r *ScheduledMessageRepo) ListByUser(ctx context.Context, userID uuid.UUID) ([]domain.ScheduledMessage, error) {
+	s := r.store
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var msgs []domain.ScheduledMessage
+	for _, msg := range s.scheduledMessages {
+		if msg.UserID == userID {
+			msgs = append(msgs, *msg)
+		}
+	}
+	sortBySendAt(msgs)
+	return msgs, nil
+}
+
+func (r *ScheduledMessageRepo) Update(ctx context.Context, msg *domain.ScheduledMessage) (bool, error) {
+	s := r.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	existing, ok := s.scheduledMessages[msg.ID]
+	if !ok {
+		return false, nil
+	}
+	cp := *existing
+	cp.Content = msg.Content
+	cp.SendAt = ts(msg.SendAt)
+	cp.FailedAt = nil
+	cp.Error = nil
+	cp.Attempts = 0
+	cp.UpdatedAt = ts(msg.UpdatedAt)
+	s.scheduledMessages[msg.ID] = &cp
+	return true, nil
+}
+
+func (r *ScheduledMessageRepo) Delete(ctx context.Context, id uuid.UUID) (bool, error) {
+	s := r.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.scheduledMessages[id]; !ok {
+		return false, nil
+	}
+	delete(s.scheduledMessages, id)
+	return true, nil
+}
+
+// ClaimDue returns the earliest due message. The store has no row locks,
+// so unlike Postgres it doesn't keep concurrent workers apart.
+func (r *ScheduledMessageRepo) ClaimDue(ctx context.Context, now time.Time) (*domain.ScheduledMessage, error) {
+	s := r.store
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var due []domain.ScheduledMessage
+	for _, msg := range s.scheduledMessages {
+		if !msg.SendAt.After(now) && msg.FailedAt == nil {
+			due = append(due, *msg)
+		}
+	}
+	if len(due) == 0 {
+		return nil, nil
+	}
+	sortBySendAt(due)
+	return &due[0], nil
+}
+
+func (r *ScheduledMessageRepo) MarkFailed(ctx context.Context, id uuid.UUID, reason string, at time.Time) error {
+	s := r.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if msg, ok := s.scheduledMessages[id]; ok {
+		cp := *msg
+		cp.FailedAt = tsPtr(&at)
+		cp.Error = &reason
+		s.scheduledMessages[id] = &cp
+	}
+	return nil
+}
+
+func (r *ScheduledMessageRepo) Retry(ctx context.Context, id uuid.UUID, sendAt time.Time) error {
+	s := r.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if msg, ok := s.scheduledMessages[id]; ok {
+		cp := *msg
+		cp.SendAt = ts(sendAt)
+		cp.Attempts++
+		s.scheduledMessages[id] = &cp
+	}
+	return nil
+}
+
+func sortBySendAt(msgs []domain.ScheduledMessage) {
+	slices.SortFunc(msgs, func(a, b domain.ScheduledMessage) int {
+		if c := a.SendAt.Compare(b.SendAt); c != 0 {
+			return c
+		}
+		return strings.Compare(a.ID.String(), b.ID.String())
+	})
+}
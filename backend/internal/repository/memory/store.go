@@ -0,0 +1,121 @@
+// Package memory implements the repository interfaces in memory, for tests
+// and local experiments. The fakes mirror the Postgres repositories closely,
+// including unique constraints, cascading deletes and the joined fields
+// filled in from users, and are checked against them by the shared contract
+// suite in repository/repotest.
+package memory
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/vedran77/pulse/internal/domain"
+)
+
+var (
+	// ErrDuplicate is returned where Postgres would violate a unique constraint.
+	ErrDuplicate = errors.New("memory: duplicate key")
+	// ErrConstraint is returned where Postgres would violate a check or foreign key constraint.
+	ErrConstraint = errors.New("memory: constraint violation")
+	// ErrNoRows is returned where the Postgres query would fail with pgx.ErrNoRows.
+	ErrNoRows = errors.New("memory: no rows")
+)
+
+type memberKey struct {
+	parentID uuid.UUID
+	userID   uuid.UUID
+}
+
+type recoveryCode struct {
+	hash   string
+	usedAt *time.Time
+}
+
+// Store holds the data shared by all memory repositories, like a database
+// shared by the Postgres repositories. It is safe for concurrent use.
+type Store struct {
+	mu sync.RWMutex
+
+	users             map[uuid.UUID]*domain.User
+	tokens            map[uuid.UUID]*domain.VerificationToken
+	twoFactor         map[uuid.UUID]*domain.TwoFactor
+	recoveryCodes     map[uuid.UUID][]recoveryCode
+	identities        map[uuid.UUID]*domain.UserIdentity
+	loginStates       map[string]*domain.OIDCLoginState
+	workspaces        map[uuid.UUID]*domain.Workspace
+	workspaceMembers  map[memberKey]*domain.WorkspaceMember
+	allowedDomains    map[uuid.UUID][]string
+	joinRequests      map[uuid.UUID]*domain.WorkspaceJoinRequest
+	invites           map[uuid.UUID]*domain.WorkspaceInvite
+	channels          map[uuid.UUID]*domain.Channel
+	channelMembers    map[memberKey]*domain.ChannelMember
+	messages          map[uuid.UUID]*domain.Message
+	messageEmbeds     map[uuid.UUID][]domain.MessageEmbed
+	pins              map[uuid.UUID]*domain.PinnedMessage
+	bookmarks         map[uuid.UUID]*domain.ChannelBookmark
+	topicChanges      map[uuid.UUID]*domain.ChannelTopicChange
+	postTimes         map[memberKey]time.Time
+	savedItems        map[uuid.UUID]*domain.SavedItem
+	scheduledMessages map[uuid.UUID]*domain.ScheduledMessage
+	dmConversations   map[uuid.UUID]*domain.DMConversation
+	dmMessages        map[uuid.UUID]*domain.DMMessage
+	dmParticipants    map[memberKey]*domain.DMParticipant
+	pulsemateRequests map[uuid.UUID]*domain.PulsemateRequest
+	pulsemates        map[uuid.UUID]*domain.Pulsemate
+}
+
+func NewStore() *Store {
+	return &Store{
+		users:             make(map[uuid.UUID]*domain.User),
+		tokens:            make(map[uuid.UUID]*domain.VerificationToken),
+		twoFactor:         make(map[uuid.UUID]*domain.TwoFactor),
+		recoveryCodes:     make(map[uuid.UUID][]recoveryCode),
+		identities:        make(map[uuid.UUID]*domain.UserIdentity),
+		loginStates:       make(map[string]*domain.OIDCLoginState),
+		workspaces:        make(map[uuid.UUID]*domain.Workspace),
+		workspaceMembers:  make(map[memberKey]*domain.WorkspaceMember),
+		allowedDomains:    make(map[uuid.UUID][]string),
+		joinRequests:      make(map[uuid.UUID]*domain.WorkspaceJoinRequest),
+		invites:           make(map[uuid.UUID]*domain.WorkspaceInvite),
+		channels:          make(map[uuid.UUID]*domain.Channel),
+		channelMembers:    make(map[memberKey]*domain.ChannelMember),
+		messages:          make(map[uuid.UUID]*domain.Message),
+		messageEmbeds:     make(map[uuid.UUID][]domain.MessageEmbed),
+		pins:              make(map[uuid.UUID]*domain.PinnedMessage),
+		bookmarks:         make(map[uuid.UUID]*domain.ChannelBookmark),
+		topicChanges:      make(map[uuid.UUID]*domain.ChannelTopicChange),
+		postTimes:         make(map[memberKey]time.Time),
+		savedItems:        make(map[uuid.UUID]*domain.SavedItem),
+		scheduledMessages: make(map[uuid.UUID]*domain.ScheduledMessage),
+		dmConversations:   make(map[uuid.UUID]*domain.DMConversation),
+		dmMessages:        make(map[uuid.UUID]*domain.DMMessage),
+		dmParticipants:    make(map[memberKey]*domain.DMParticipant),
+		pulsemateRequests: make(map[uuid.UUID]*domain.PulsemateRequest),
+		pulsemates:        make(map[uuid.UUID]*domain.Pulsemate),
+	}
+}
+
+// now matches the microsecond precision of Postgres timestamps.
+func now() time.Time {
+	return time.Now().Truncate(time.Microsecond)
+}
+
+// ts stores t with the precision Postgres would.
+func ts(t time.Time) time.Time {
+	return t.Truncate(time.Microsecond)
+}
+
+func tsPtr(t *time.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+	v := ts(*t)
+	return &v
+}
+
+// less orders UUIDs the way Postgres compares them.
+func less(a, b uuid.UUID) bool {
+	return a.String() < b.String()
+}
@@ -0,0 +1,90 @@
+package memory
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+	"github.com/vedran77/pulse/internal/domain"
+)
+
+type VerificationTokenRepo struct {
+	store *Store
+}
+
+func NewVerificationTokenRepo(store *Store) *VerificationTokenRepo {
+	return &VerificationTokenRepo{store: store}
+}
+
+func (r *VerificationTokenRepo) Create(ctx context.Context, t *domain.VerificationToken) error {
+	s := r.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.users[t.UserID]; !ok {
+		return ErrConstraint
+	}
+	switch t.Purpose {
+	case domain.TokenPurposeVerifyEmail, domain.TokenPurposeResetPassword, domain.TokenPurposeChangeEmail:
+	default:
+		return ErrConstraint
+	}
+	if _, ok := s.tokens[t.ID]; ok {
+		return ErrDuplicate
+	}
+	for _, other := range s.tokens {
+		if other.TokenHash == t.TokenHash {
+			return ErrDuplicate
+		}
+	}
+	s.tokens[t.ID] = &domain.VerificationToken{
+		ID:        t.ID,
+		UserID:    t.UserID,
+		Purpose:   t.Purpose,
+		TokenHash: t.TokenHash,
+		ExpiresAt: ts(t.ExpiresAt),
+		CreatedAt: ts(t.CreatedAt),
+	}
+	return nil
+}
+
+func (r *VerificationTokenRepo) GetByHash(ctx context.Context, tokenHash string) (*domain.VerificationToken, error) {
+	s := r.store
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, t := range s.tokens {
+		if t.TokenHash == tokenHash {
+			cp := *t
+			return &cp, nil
+		}
+	}
+	return nil, nil
+}
+
+func (r *VerificationTokenRepo) Consume(ctx context.Context, id uuid.UUID) (bool, error) {
+	s := r.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t, ok := s.tokens[id]
+	if !ok || t.UsedAt != nil {
+		return false, nil
+	}
+	usedAt := now()
+	t.UsedAt = &usedAt
+	return true, nil
+}
+
+func (r *VerificationTokenRepo) InvalidateForUser(ctx context.Context, userID uuid.UUID, purpose string) error {
+	s := r.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	usedAt := now()
+	for _, t := range s.tokens {
+		if t.UserID == userID && t.Purpose == purpose && t.UsedAt == nil {
+			t.UsedAt = &usedAt
+		}
+	}
+	return nil
+}
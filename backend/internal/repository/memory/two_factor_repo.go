@@ -0,0 +1,143 @@
+package memory
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+	"github.com/vedran77/pulse/internal/domain"
+)
+
+type TwoFactorRepo struct {
+	store *Store
+}
+
+func NewTwoFactorRepo(store *Store) *TwoFactorRepo {
+	return &TwoFactorRepo{store: store}
+}
+
+func (r *TwoFactorRepo) Upsert(ctx context.Context, tf *domain.TwoFactor) error {
+	s := r.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.users[tf.UserID]; !ok {
+		return ErrConstraint
+	}
+	s.twoFactor[tf.UserID] = &domain.TwoFactor{
+		UserID:    tf.UserID,
+		Secret:    append([]byte(nil), tf.Secret...),
+		CreatedAt: ts(tf.CreatedAt),
+	}
+	return nil
+}
+
+func (r *TwoFactorRepo) Get(ctx context.Context, userID uuid.UUID) (*domain.TwoFactor, error) {
+	s := r.store
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	tf, ok := s.twoFactor[userID]
+	if !ok {
+		return nil, nil
+	}
+	cp := *tf
+	cp.Secret = append([]byte(nil), tf.Secret...)
+	return &cp, nil
+}
+
+func (r *TwoFactorRepo) Enable(ctx context.Context, userID uuid.UUID, codeHashes []string) error {
+	s := r.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	codes, err := s.recoveryCodesFor(userID, codeHashes)
+	if err != nil {
+		return err
+	}
+	t := now()
+	if tf, ok := s.twoFactor[userID]; ok {
+		tf.ConfirmedAt = &t
+	}
+	if u, ok := s.users[userID]; ok {
+		u.TwoFactorEnabled = true
+		u.UpdatedAt = t
+	}
+	s.recoveryCodes[userID] = codes
+	return nil
+}
+
+func (r *TwoFactorRepo) Disable(ctx context.Context, userID uuid.UUID) error {
+	s := r.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.twoFactor, userID)
+	delete(s.recoveryCodes, userID)
+	if u, ok := s.users[userID]; ok {
+		u.TwoFactorEnabled = false
+		u.UpdatedAt = now()
+	}
+	return nil
+}
+
+func (r *TwoFactorRepo) UseStep(ctx context.Context, userID uuid.UUID, step int64) (bool, error) {
+	s := r.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tf, ok := s.twoFactor[userID]
+	if !ok || tf.LastUsedStep >= step {
+		return false, nil
+	}
+	tf.LastUsedStep = step
+	return true, nil
+}
+
+func (r *TwoFactorRepo) ReplaceRecoveryCodes(ctx context.Context, userID uuid.UUID, codeHashes []string) error {
+	s := r.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	codes, err := s.recoveryCodesFor(userID, codeHashes)
+	if err != nil {
+		return err
+	}
+	s.recoveryCodes[userID] = codes
+	return nil
+}
+
+func (r *TwoFactorRepo) UseRecoveryCode(ctx context.Context, userID uuid.UUID, codeHash string) (bool, error) {
+	s := r.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	codes := s.recoveryCodes[userID]
+	for i := range codes {
+		if codes[i].hash == codeHash && codes[i].usedAt == nil {
+			usedAt := now()
+			codes[i].usedAt = &usedAt
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// recoveryCodesFor builds a new set of unused codes, checking the same
+// constraints the recovery code inserts would. The caller holds the lock.
+func (s *Store) recoveryCodesFor(userID uuid.UUID, codeHashes []string) ([]recoveryCode, error) {
+	if len(codeHashes) > 0 {
+		if _, ok := s.users[userID]; !ok {
+			return nil, ErrConstraint
+		}
+	}
+	seen := make(map[string]bool, len(codeHashes))
+	codes := make([]recoveryCode, 0, len(codeHashes))
+	for _, h := range codeHashes {
+		if seen[h] {
+			return nil, ErrDuplicate
+		}
+		seen[h] = true
+		codes = append(codes, recoveryCode{hash: h})
+	}
+	return codes, nil
+}
@@ -0,0 +1,124 @@
+package memory
+
+import (
+	"context"
+	"maps"
+	"slices"
+
+	"github.com/google/uuid"
+	"github.com/vedran77/pulse/internal/domain"
+)
+
+type txKey struct{}
+
+type TxManager struct {
+	store *Store
+}
+
+func NewTxManager(store *Store) *TxManager {
+	return &TxManager{store: store}
+}
+
+// WithinTx runs fn and restores the store to its previous state if fn
+// returns an error. Unlike Postgres it doesn't isolate fn from concurrent
+// writers, which is fine for tests that check rollback.
+func (m *TxManager) WithinTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	if ctx.Value(txKey{}) != nil {
+		return fn(ctx)
+	}
+	snap := m.store.snapshot()
+	if err := fn(context.WithValue(ctx, txKey{}, true)); err != nil {
+		m.store.restore(snap)
+		return err
+	}
+	return nil
+}
+
+// snapshot deep-copies the stored rows.
+func (s *Store) snapshot() *Store {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	snap := &Store{
+		users:             cloneRows(s.users),
+		tokens:            cloneRows(s.tokens),
+		twoFactor:         cloneRows(s.twoFactor),
+		recoveryCodes:     make(map[uuid.UUID][]recoveryCode, len(s.recoveryCodes)),
+		identities:        cloneRows(s.identities),
+		loginStates:       cloneRows(s.loginStates),
+		workspaces:        cloneRows(s.workspaces),
+		workspaceMembers:  cloneRows(s.workspaceMembers),
+		allowedDomains:    make(map[uuid.UUID][]string, len(s.allowedDomains)),
+		joinRequests:      cloneRows(s.joinRequests),
+		invites:           cloneRows(s.invites),
+		channels:          cloneRows(s.channels),
+		channelMembers:    cloneRows(s.channelMembers),
+		messages:          cloneRows(s.messages),
+		messageEmbeds:     make(map[uuid.UUID][]domain.MessageEmbed, len(s.messageEmbeds)),
+		pins:              cloneRows(s.pins),
+		bookmarks:         cloneRows(s.bookmarks),
+		topicChanges:      cloneRows(s.topicChanges),
+		postTimes:         maps.Clone(s.postTimes),
+		savedItems:        cloneRows(s.savedItems),
+		scheduledMessages: cloneRows(s.scheduledMessages),
+		dmConversations:   cloneRows(s.dmConversations),
+		dmMessages:        cloneRows(s.dmMessages),
+		dmParticipants:    cloneRows(s.dmParticipants),
+		pulsemateRequests: cloneRows(s.pulsemateRequests),
+		pulsemates:        cloneRows(s.pulsemates),
+	}
+	for id, codes := range s.recoveryCodes {
+		snap.recoveryCodes[id] = slices.Clone(codes)
+	}
+	for id, domains := range s.allowedDomains {
+		snap.allowedDomains[id] = slices.Clone(domains)
+	}
+	for id, embeds := range s.messageEmbeds {
+		snap.messageEmbeds[id] = slices.Clone(embeds)
+	}
+	return snap
+}
+
+// restore replaces the stored rows with a snapshot.
+func (s *Store) restore(snap *Store) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.users = snap.users
+	s.tokens = snap.tokens
+	s.twoFactor = snap.twoFactor
+	s.recoveryCodes = snap.recoveryCodes
+	s.identities = snap.identities
+	s.loginStates = snap.loginStates
+	s.workspaces = snap.workspaces
+	s.workspaceMembers = snap.workspaceMembers
+	s.allowedDomains = snap.allowedDomains
+	s.joinRequests = snap.joinRequests
+	s.invites = snap.invites
+	s.channels = snap.channels
+	s.channelMembers = snap.channelMembers
+	s.messages = snap.messages
+	s.messageEmbeds = snap.messageEmbeds
+	s.pins = snap.pins
+	s.bookmarks = snap.bookmarks
+	s.topicChanges = snap.topicChanges
+	s.postTimes = snap.postTimes
+	s.savedItems = snap.savedItems
+	s.scheduledMessages = snap.scheduledMessages
+	s.dmConversations = snap.dmConversations
+	s.dmMessages = snap.dmMessages
+	s.dmParticipants = snap.dmParticipants
+	s.pulsemateRequests = snap.pulsemateRequests
+	s.pulsemates = snap.pulsemates
+}
+
+// cloneRows copies a table. Rows are copied by value; their pointer fields
+// are only ever replaced, never written through, so sharing them is safe.
+func cloneRows[K comparable, V any](rows map[K]*V) map[K]*V {
+	out := make(map[K]*V, len(rows))
+	for k, v := range rows {
+		cp := *v
+		out[k] = &cp
+	}
+	return out
+}
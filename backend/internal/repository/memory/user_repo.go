@@ -0,0 +1,225 @@
+package memory
+
+import (
+	"context"
+	"maps"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/vedran77/pulse/internal/domain"
+)
+
+type UserRepo struct {
+	store *Store
+}
+
+func NewUserRepo(store *Store) *UserRepo {
+	return &UserRepo{store: store}
+}
+
+func (r *UserRepo) Create(ctx context.Context, user *domain.User) error {
+	s := r.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.users[user.ID]; ok {
+		return ErrDuplicate
+	}
+	for _, u := range s.users {
+		if u.Email == user.Email || u.Username == user.Username {
+			return ErrDuplicate
+		}
+	}
+	// Only the columns the Postgres insert writes; the rest take their defaults
+	s.users[user.ID] = &domain.User{
+		ID:              user.ID,
+		Email:           user.Email,
+		Username:        user.Username,
+		DisplayName:     user.DisplayName,
+		PasswordHash:    user.PasswordHash,
+		Status:          user.Status,
+		CreatedAt:       ts(user.CreatedAt),
+		UpdatedAt:       ts(user.UpdatedAt),
+		EmailVerifiedAt: tsPtr(user.EmailVerifiedAt),
+	}
+	return nil
+}
+
+func (r *UserRepo) GetByID(ctx context.Context, id uuid.UUID) (*domain.User, error) {
+	return r.find(func(u *domain.User) bool { return u.ID == id }), nil
+}
+
+func (r *UserRepo) GetByEmail(ctx context.Context, email string) (*domain.User, error) {
+	return r.find(func(u *domain.User) bool { return u.Email == email }), nil
+}
+
+func (r *UserRepo) GetByUsername(ctx context.Context, username string) (*domain.User, error) {
+	return r.find(func(u *domain.User) bool { return u.Username == username }), nil
+}
+
+func (r *UserRepo) MarkEmailVerified(ctx context.Context, id uuid.UUID) error {
+	r.update(id, func(u *domain.User) {
+		t := now()
+		u.EmailVerifiedAt = &t
+		u.UpdatedAt = t
+	})
+	return nil
+}
+
+func (r *UserRepo) UpdatePassword(ctx context.Context, id uuid.UUID, passwordHash string) error {
+	r.update(id, func(u *domain.User) {
+		u.PasswordHash = passwordHash
+		u.TokenVersion++
+		u.UpdatedAt = now()
+	})
+	return nil
+}
+
+func (r *UserRepo) RecordFailedLogin(ctx context.Context, id uuid.UUID, maxAttempts int, lockFor time.Duration) (*time.Time, error) {
+	var lockedUntil *time.Time
+	found := r.update(id, func(u *domain.User) {
+		if u.FailedLoginAttempts+1 >= maxAttempts {
+			u.FailedLoginAttempts = 0
+			t := ts(time.Now().Add(lockFor))
+			u.LockedUntil = &t
+		} else {
+			u.FailedLoginAttempts++
+		}
+		lockedUntil = tsPtr(u.LockedUntil)
+	})
+	if !found {
+		return nil, ErrNoRows
+	}
+	return lockedUntil, nil
+}
+
+func (r *UserRepo) ResetFailedLogins(ctx context.Context, id uuid.UUID) error {
+	r.update(id, func(u *domain.User) {
+		u.FailedLoginAttempts = 0
+		u.LockedUntil = nil
+	})
+	return nil
+}
+
+func (r *UserRepo) UpdateProfile(ctx context.Context, user *domain.User) error {
+	s := r.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, u := range s.users {
+		if u.ID != user.ID && u.Username == user.Username {
+			return ErrDuplicate
+		}
+	}
+	if u, ok := s.users[user.ID]; ok {
+		u.Username = user.Username
+		u.DisplayName = user.DisplayName
+		u.UpdatedAt = now()
+	}
+	return nil
+}
+
+func (r *UserRepo) SetAvatarURL(ctx context.Context, id uuid.UUID, avatarURL *string) error {
+	r.update(id, func(u *domain.User) {
+		u.AvatarURL = avatarURL
+		u.UpdatedAt = now()
+	})
+	return nil
+}
+
+func (r *UserRepo) SetPendingEmail(ctx context.Context, id uuid.UUID, email *string) error {
+	r.update(id, func(u *domain.User) {
+		u.PendingEmail = email
+		u.UpdatedAt = now()
+	})
+	return nil
+}
+
+func (r *UserRepo) ConfirmEmailChange(ctx context.Context, id uuid.UUID) error {
+	s := r.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, ok := s.users[id]
+	if !ok || u.PendingEmail == nil {
+		return nil
+	}
+	for _, other := range s.users {
+		if other.ID != id && other.Email == *u.PendingEmail {
+			return ErrDuplicate
+		}
+	}
+	t := now()
+	u.Email = *u.PendingEmail
+	u.PendingEmail = nil
+	u.EmailVerifiedAt = &t
+	u.UpdatedAt = t
+	return nil
+}
+
+func (r *UserRepo) Anonymize(ctx context.Context, id uuid.UUID, deletedAt time.Time) error {
+	s := r.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, ok := s.users[id]
+	if !ok {
+		return nil
+	}
+
+	maps.DeleteFunc(s.workspaceMembers, func(key memberKey, _ *domain.WorkspaceMember) bool { return key.userID == id })
+	maps.DeleteFunc(s.channelMembers, func(key memberKey, _ *domain.ChannelMember) bool { return key.userID == id })
+	maps.DeleteFunc(s.postTimes, func(key memberKey, _ time.Time) bool { return key.userID == id })
+	maps.DeleteFunc(s.joinRequests, func(_ uuid.UUID, jr *domain.WorkspaceJoinRequest) bool { return jr.UserID == id })
+	maps.DeleteFunc(s.tokens, func(_ uuid.UUID, t *domain.VerificationToken) bool { return t.UserID == id })
+	maps.DeleteFunc(s.identities, func(_ uuid.UUID, i *domain.UserIdentity) bool { return i.UserID == id })
+	maps.DeleteFunc(s.savedItems, func(_ uuid.UUID, item *domain.SavedItem) bool { return item.UserID == id })
+	maps.DeleteFunc(s.scheduledMessages, func(_ uuid.UUID, sm *domain.ScheduledMessage) bool { return sm.UserID == id })
+	maps.DeleteFunc(s.pulsemateRequests, func(_ uuid.UUID, pr *domain.PulsemateRequest) bool {
+		return pr.SenderID == id || pr.ReceiverID == id
+	})
+	maps.DeleteFunc(s.pulsemates, func(_ uuid.UUID, pm *domain.Pulsemate) bool { return pm.User1ID == id || pm.User2ID == id })
+	delete(s.twoFactor, id)
+	delete(s.recoveryCodes, id)
+
+	t := ts(deletedAt)
+	*u = domain.User{
+		ID:           u.ID,
+		Email:        "deleted-" + id.String() + "@deleted.invalid",
+		Username:     "deleted-" + id.String(),
+		DisplayName:  "Deleted user",
+		Status:       "offline",
+		CreatedAt:    u.CreatedAt,
+		UpdatedAt:    t,
+		TokenVersion: u.TokenVersion + 1,
+		DeletedAt:    &t,
+	}
+	return nil
+}
+
+func (r *UserRepo) find(match func(*domain.User) bool) *domain.User {
+	s := r.store
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, u := range s.users {
+		if match(u) {
+			cp := *u
+			return &cp
+		}
+	}
+	return nil
+}
+
+// update applies fn to the stored user and reports whether it exists.
+func (r *UserRepo) update(id uuid.UUID, fn func(*domain.User)) bool {
+	s := r.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, ok := s.users[id]
+	if ok {
+		fn(u)
+	}
+	return ok
+}
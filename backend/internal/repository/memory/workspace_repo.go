@@ -0,0 +1,618 @@
+package memory
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"slices"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"github.com/vedran77/pulse/internal/domain"
+	"github.com/vedran77/pulse/internal/repository"
+)
+
+type WorkspaceRepo struct {
+	store *Store
+}
+
+func NewWorkspaceRepo(store *Store) *WorkspaceRepo {
+	return &WorkspaceRepo{store: store}
+}
+
+func (r *WorkspaceRepo) Create(ctx context.Context, ws *domain.Workspace) error {
+	s := r.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.users[ws.OwnerID]; !ok {
+		return ErrConstraint
+	}
+	if _, ok := s.workspaces[ws.ID]; ok {
+		return ErrDuplicate
+	}
+	if s.slugTaken(ws.Slug, ws.ID) {
+		return ErrDuplicate
+	}
+	// The policy flags aren't part of the insert and start out false
+	s.workspaces[ws.ID] = &domain.Workspace{
+		ID:          ws.ID,
+		Name:        ws.Name,
+		Slug:        ws.Slug,
+		Description: ws.Description,
+		OwnerID:     ws.OwnerID,
+		CreatedAt:   ts(ws.CreatedAt),
+	}
+	return nil
+}
+
+func (r *WorkspaceRepo) GetByID(ctx context.Context, id uuid.UUID) (*domain.Workspace, error) {
+	s := r.store
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	ws := s.liveWorkspace(id)
+	if ws == nil {
+		return nil, nil
+	}
+	cp := *ws
+	return &cp, nil
+}
+
+func (r *WorkspaceRepo) GetDeletedByID(ctx context.Context, id uuid.UUID) (*domain.Workspace, error) {
+	s := r.store
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	ws, ok := s.workspaces[id]
+	if !ok || ws.DeletedAt == nil {
+		return nil, nil
+	}
+	cp := *ws
+	return &cp, nil
+}
+
+func (r *WorkspaceRepo) GetBySlug(ctx context.Context, slug string) (*domain.Workspace, error) {
+	s := r.store
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, ws := range s.workspaces {
+		if ws.Slug == slug {
+			cp := *ws
+			return &cp, nil
+		}
+	}
+	return nil, nil
+}
+
+func (r *WorkspaceRepo) ListByUser(ctx context.Context, userID uuid.UUID) ([]domain.Workspace, error) {
+	s := r.store
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var workspaces []domain.Workspace
+	for key := range s.workspaceMembers {
+		if ws := s.liveWorkspace(key.parentID); key.userID == userID && ws != nil {
+			workspaces = append(workspaces, *ws)
+		}
+	}
+	slices.SortStableFunc(workspaces, func(a, b domain.Workspace) int {
+		return b.CreatedAt.Compare(a.CreatedAt)
+	})
+	return workspaces, nil
+}
+
+func (r *WorkspaceRepo) ListDeletedByOwner(ctx context.Context, ownerID uuid.UUID) ([]domain.Workspace, error) {
+	s := r.store
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var workspaces []domain.Workspace
+	for _, ws := range s.workspaces {
+		if ws.OwnerID == ownerID && ws.DeletedAt != nil {
+			workspaces = append(workspaces, *ws)
+		}
+	}
+	slices.SortStableFunc(workspaces, func(a, b domain.Workspace) int {
+		return b.DeletedAt.Compare(*a.DeletedAt)
+	})
+	return workspaces, nil
+}
+
+func (r *WorkspaceRepo) ListDeletedBefore(ctx context.Context, before time.Time, limit int) ([]domain.Workspace, error) {
+	s := r.store
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var workspaces []domain.Workspace
+	for _, ws := range s.workspaces {
+		if ws.DeletedAt != nil && ws.DeletedAt.Before(before) {
+			workspaces = append(workspaces, *ws)
+		}
+	}
+	slices.SortStableFunc(workspaces, func(a, b domain.Workspace) int {
+		return a.DeletedAt.Compare(*b.DeletedAt)
+	})
+	if len(workspaces) > limit {
+		workspaces = workspaces[:limit]
+	}
+	return workspaces, nil
+}
+
+func (r *WorkspaceRepo) Update(ctx context.Context, ws *domain.Workspace) error {
+	s := r.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, ok := s.workspaces[ws.ID]
+	if !ok {
+		return nil
+	}
+	if s.slugTaken(ws.Slug, ws.ID) {
+		return ErrDuplicate
+	}
+	if ws.AutoArchiveDays != nil && *ws.AutoArchiveDays <= 0 {
+		return ErrConstraint
+	}
+	stored.Name = ws.Name
+	stored.Slug = ws.Slug
+	stored.Description = ws.Description
+	stored.JoinRequiresApproval = ws.JoinRequiresApproval
+	stored.RequireTwoFactor = ws.RequireTwoFactor
+	stored.RequireSSO = ws.RequireSSO
+	stored.AutoArchiveDays = ws.AutoArchiveDays
+	return nil
+}
+
+func (r *WorkspaceRepo) SetOwner(ctx context.Context, id, ownerID uuid.UUID) error {
+	s := r.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ws, ok := s.workspaces[id]
+	if !ok {
+		return nil
+	}
+	if _, ok := s.users[ownerID]; !ok {
+		return ErrConstraint
+	}
+	ws.OwnerID = ownerID
+	return nil
+}
+
+func (r *WorkspaceRepo) SoftDelete(ctx context.Context, id uuid.UUID, deletedAt time.Time) error {
+	s := r.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if ws, ok := s.workspaces[id]; ok && ws.DeletedAt == nil {
+		t := ts(deletedAt)
+		ws.DeletedAt = &t
+	}
+	return nil
+}
+
+func (r *WorkspaceRepo) Restore(ctx context.Context, id uuid.UUID) error {
+	s := r.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if ws, ok := s.workspaces[id]; ok {
+		ws.DeletedAt = nil
+	}
+	return nil
+}
+
+// Delete removes the workspace and everything that cascades from it.
+func (r *WorkspaceRepo) Delete(ctx context.Context, id uuid.UUID) error {
+	s := r.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.workspaces, id)
+	delete(s.allowedDomains, id)
+	for key := range s.workspaceMembers {
+		if key.parentID == id {
+			delete(s.workspaceMembers, key)
+		}
+	}
+	for reqID, req := range s.joinRequests {
+		if req.WorkspaceID == id {
+			delete(s.joinRequests, reqID)
+		}
+	}
+	for invID, inv := range s.invites {
+		if inv.WorkspaceID == id {
+			delete(s.invites, invID)
+		}
+	}
+	for chID, ch := range s.channels {
+		if ch.WorkspaceID == id {
+			s.deleteChannel(chID)
+		}
+	}
+	return nil
+}
+
+func (r *WorkspaceRepo) AddMember(ctx context.Context, m *domain.WorkspaceMember) error {
+	s := r.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.workspaces[m.WorkspaceID]; !ok {
+		return ErrConstraint
+	}
+	if _, ok := s.users[m.UserID]; !ok {
+		return ErrConstraint
+	}
+	key := memberKey{m.WorkspaceID, m.UserID}
+	if _, ok := s.workspaceMembers[key]; ok {
+		return ErrDuplicate
+	}
+	s.workspaceMembers[key] = &domain.WorkspaceMember{
+		WorkspaceID: m.WorkspaceID,
+		UserID:      m.UserID,
+		Role:        m.Role,
+		JoinedAt:    ts(m.JoinedAt),
+	}
+	return nil
+}
+
+func (r *WorkspaceRepo) RemoveMember(ctx context.Context, workspaceID, userID uuid.UUID) error {
+	s := r.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.workspaceMembers, memberKey{workspaceID, userID})
+	return nil
+}
+
+func (r *WorkspaceRepo) UpdateMemberRole(ctx context.Context, workspaceID, userID uuid.UUID, role string) error {
+	s := r.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if m, ok := s.workspaceMembers[memberKey{workspaceID, userID}]; ok {
+		m.Role = role
+	}
+	return nil
+}
+
+func (r *WorkspaceRepo) GetMember(ctx context.Context, workspaceID, userID uuid.UUID) (*domain.WorkspaceMember, error) {
+	s := r.store
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	m, ok := s.workspaceMembers[memberKey{workspaceID, userID}]
+	if !ok || s.liveWorkspace(workspaceID) == nil {
+		return nil, nil
+	}
+	cp := *m
+	return &cp, nil
+}
+
+func (r *WorkspaceRepo) ListMembers(ctx context.Context, workspaceID uuid.UUID, p repository.Page) ([]domain.WorkspaceMember, error) {
+	s := r.store
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var members []domain.WorkspaceMember
+	for key, m := range s.workspaceMembers {
+		if key.parentID != workspaceID {
+			continue
+		}
+		cp := *m
+		u := s.users[m.UserID]
+		cp.Username = u.Username
+		cp.DisplayName = u.DisplayName
+		cp.AvatarURL = u.AvatarURL
+		members = append(members, cp)
+	}
+	return page(members, p, func(m domain.WorkspaceMember) repository.PageKey {
+		return repository.PageKey{Time: m.JoinedAt, ID: m.UserID}
+	}, false, false), nil
+}
+
+func (r *WorkspaceRepo) UpdateMemberProfile(ctx context.Context, m *domain.WorkspaceMember) error {
+	s := r.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if cur, ok := s.workspaceMembers[memberKey{m.WorkspaceID, m.UserID}]; ok {
+		cur.Title = m.Title
+		cur.Timezone = m.Timezone
+		cur.Pronouns = m.Pronouns
+	}
+	return nil
+}
+
+func (r *WorkspaceRepo) SearchMembers(ctx context.Context, workspaceID uuid.UUID, search repository.MemberSearch) ([]repository.MemberMatch, error) {
+	s := r.store
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	q := strings.ToLower(strings.TrimSpace(search.Query))
+	var matches []repository.MemberMatch
+	for key, m := range s.workspaceMembers {
+		if key.parentID != workspaceID || (search.Role != "" && m.Role != search.Role) {
+			continue
+		}
+		u := s.users[m.UserID]
+		rank, ok := memberRank(q, u, search.IncludeEmail)
+		if !ok {
+			continue
+		}
+		match := repository.MemberMatch{WorkspaceMember: *m, Rank: rank}
+		match.Username = u.Username
+		match.DisplayName = u.DisplayName
+		match.AvatarURL = u.AvatarURL
+		if search.IncludeEmail {
+			match.Email = u.Email
+		}
+		if search.After != nil && compareMatchKeys(match.Key(), *search.After) <= 0 {
+			continue
+		}
+		if search.Before != nil && compareMatchKeys(match.Key(), *search.Before) >= 0 {
+			continue
+		}
+		matches = append(matches, match)
+	}
+	slices.SortFunc(matches, func(a, b repository.MemberMatch) int {
+		return compareMatchKeys(a.Key(), b.Key())
+	})
+	if len(matches) > search.Limit {
+		if search.Before != nil {
+			return matches[len(matches)-search.Limit:], nil
+		}
+		matches = matches[:search.Limit]
+	}
+	return matches, nil
+}
+
+// memberRank ranks the user against a lowercased query the way the Postgres
+// search does.
+func memberRank(q string, u *domain.User, withEmail bool) (int, bool) {
+	username := strings.ToLower(u.Username)
+	name := strings.ToLower(u.DisplayName)
+	email := strings.ToLower(u.Email)
+	switch {
+	case username == q:
+		return 0, true
+	case strings.HasPrefix(username, q):
+		return 1, true
+	case strings.HasPrefix(name, q) || strings.Contains(name, " "+q):
+		return 2, true
+	case withEmail && strings.HasPrefix(email, q):
+		return 3, true
+	case strings.Contains(username, q) || strings.Contains(name, q) || (withEmail && strings.Contains(email, q)):
+		return 4, true
+	case inOrder(username, q) || inOrder(name, q):
+		return 5, true
+	}
+	return 0, false
+}
+
+// inOrder reports whether s contains the characters of sub in order.
+func inOrder(s, sub string) bool {
+	for _, c := range s {
+		if sub == "" {
+			break
+		}
+		if r, size := utf8.DecodeRuneInString(sub); c == r {
+			sub = sub[size:]
+		}
+	}
+	return sub == ""
+}
+
+func compareMatchKeys(a, b repository.MemberMatchKey) int {
+	return cmp.Or(
+		cmp.Compare(a.Rank, b.Rank),
+		strings.Compare(a.Username, b.Username),
+		bytes.Compare(a.UserID[:], b.UserID[:]),
+	)
+}
+
+func (r *WorkspaceRepo) SetAllowedDomains(ctx context.Context, workspaceID uuid.UUID, domains []string) error {
+	s := r.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(domains) > 0 {
+		if _, ok := s.workspaces[workspaceID]; !ok {
+			return ErrConstraint
+		}
+	}
+	var unique []string
+	for _, d := range domains {
+		if !slices.Contains(unique, d) {
+			unique = append(unique, d)
+		}
+	}
+	if len(unique) == 0 {
+		delete(s.allowedDomains, workspaceID)
+		return nil
+	}
+	s.allowedDomains[workspaceID] = unique
+	return nil
+}
+
+func (r *WorkspaceRepo) ListAllowedDomains(ctx context.Context, workspaceID uuid.UUID) ([]string, error) {
+	s := r.store
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	domains := slices.Clone(s.allowedDomains[workspaceID])
+	slices.Sort(domains)
+	return domains, nil
+}
+
+func (r *WorkspaceRepo) ListDiscoverable(ctx context.Context, userID uuid.UUID, emailDomain string) ([]domain.DiscoverableWorkspace, error) {
+	s := r.store
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var workspaces []domain.DiscoverableWorkspace
+	for wsID, domains := range s.allowedDomains {
+		if !slices.Contains(domains, emailDomain) || s.liveWorkspace(wsID) == nil {
+			continue
+		}
+		if _, member := s.workspaceMembers[memberKey{wsID, userID}]; member {
+			continue
+		}
+		dw := domain.DiscoverableWorkspace{Workspace: *s.workspaces[wsID]}
+		for key := range s.workspaceMembers {
+			if key.parentID == wsID {
+				dw.MemberCount++
+			}
+		}
+		dw.HasPendingRequest = s.pendingJoinRequest(wsID, userID) != nil
+		workspaces = append(workspaces, dw)
+	}
+	slices.SortStableFunc(workspaces, func(a, b domain.DiscoverableWorkspace) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+	return workspaces, nil
+}
+
+func (r *WorkspaceRepo) CreateJoinRequest(ctx context.Context, req *domain.WorkspaceJoinRequest) error {
+	s := r.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.workspaces[req.WorkspaceID]; !ok {
+		return ErrConstraint
+	}
+	if _, ok := s.users[req.UserID]; !ok {
+		return ErrConstraint
+	}
+	if !validJoinRequestStatus(req.Status) {
+		return ErrConstraint
+	}
+	if _, ok := s.joinRequests[req.ID]; ok {
+		return ErrDuplicate
+	}
+	// Only one pending request per user and workspace
+	if req.Status == "pending" && s.pendingJoinRequest(req.WorkspaceID, req.UserID) != nil {
+		return ErrDuplicate
+	}
+	s.joinRequests[req.ID] = &domain.WorkspaceJoinRequest{
+		ID:          req.ID,
+		WorkspaceID: req.WorkspaceID,
+		UserID:      req.UserID,
+		Status:      req.Status,
+		CreatedAt:   ts(req.CreatedAt),
+	}
+	return nil
+}
+
+func (r *WorkspaceRepo) GetJoinRequestByID(ctx context.Context, id uuid.UUID) (*domain.WorkspaceJoinRequest, error) {
+	s := r.store
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	req, ok := s.joinRequests[id]
+	if !ok {
+		return nil, nil
+	}
+	cp := *req
+	return &cp, nil
+}
+
+func (r *WorkspaceRepo) GetPendingJoinRequest(ctx context.Context, workspaceID, userID uuid.UUID) (*domain.WorkspaceJoinRequest, error) {
+	s := r.store
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	req := s.pendingJoinRequest(workspaceID, userID)
+	if req == nil {
+		return nil, nil
+	}
+	cp := *req
+	return &cp, nil
+}
+
+func (r *WorkspaceRepo) ListPendingJoinRequests(ctx context.Context, workspaceID uuid.UUID) ([]domain.WorkspaceJoinRequest, error) {
+	s := r.store
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var reqs []domain.WorkspaceJoinRequest
+	for _, req := range s.joinRequests {
+		if req.WorkspaceID != workspaceID || req.Status != "pending" {
+			continue
+		}
+		cp := *req
+		u := s.users[req.UserID]
+		cp.Username = u.Username
+		cp.DisplayName = u.DisplayName
+		cp.Email = u.Email
+		reqs = append(reqs, cp)
+	}
+	slices.SortStableFunc(reqs, func(a, b domain.WorkspaceJoinRequest) int {
+		return a.CreatedAt.Compare(b.CreatedAt)
+	})
+	return reqs, nil
+}
+
+func (r *WorkspaceRepo) DecideJoinRequest(ctx context.Context, id uuid.UUID, status string, decidedBy uuid.UUID) error {
+	s := r.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	req, ok := s.joinRequests[id]
+	if !ok {
+		return nil
+	}
+	if !validJoinRequestStatus(status) {
+		return ErrConstraint
+	}
+	if _, ok := s.users[decidedBy]; !ok {
+		return ErrConstraint
+	}
+	if status == "pending" && req.Status != "pending" && s.pendingJoinRequest(req.WorkspaceID, req.UserID) != nil {
+		return ErrDuplicate
+	}
+	t := now()
+	req.Status = status
+	req.DecidedBy = &decidedBy
+	req.DecidedAt = &t
+	return nil
+}
+
+// liveWorkspace returns the stored workspace unless it doesn't exist or is
+// deleted. The caller holds the lock.
+func (s *Store) liveWorkspace(id uuid.UUID) *domain.Workspace {
+	ws, ok := s.workspaces[id]
+	if !ok || ws.DeletedAt != nil {
+		return nil
+	}
+	return ws
+}
+
+// slugTaken reports whether another workspace uses slug. The caller holds the lock.
+func (s *Store) slugTaken(slug string, except uuid.UUID) bool {
+	for _, ws := range s.workspaces {
+		if ws.Slug == slug && ws.ID != except {
+			return true
+		}
+	}
+	return false
+}
+
+// pendingJoinRequest returns the stored pending request, if any. The caller holds the lock.
+func (s *Store) pendingJoinRequest(workspaceID, userID uuid.UUID) *domain.WorkspaceJoinRequest {
+	for _, req := range s.joinRequests {
+		if req.WorkspaceID == workspaceID && req.UserID == userID && req.Status == "pending" {
+			return req
+		}
+	}
+	return nil
+}
+
+func validJoinRequestStatus(status string) bool {
+	return status == "pending" || status == "approved" || status == "rejected"
+}
@@ -0,0 +1,26 @@
+package repository
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Page selects part of a list. Lists are ordered by a timestamp, usually
+// created_at, with the row ID breaking ties, so rows sharing a timestamp are
+// never skipped or repeated between pages.
+type Page struct {
+	// After selects the rows that follow the key in list order, Before the
+	// rows that precede it; at most one is set. Without either a list starts
+	// at its beginning, except message lists, which end with the newest
+	// messages and start there.
+	After  *PageKey
+	Before *PageKey
+	Limit  int
+}
+
+// PageKey is a row's position in a list.
+type PageKey struct {
+	Time time.Time `json:"t"`
+	ID   uuid.UUID `json:"id"`
+}
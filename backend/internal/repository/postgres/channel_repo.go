@@ -3,12 +3,14 @@ package postgres
 import (
 	"context"
 	"errors"
+	"slices"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/vedran77/pulse/internal/domain"
+	"github.com/vedran77/pulse/internal/repository"
 )
 
 type ChannelRepo struct {
@@ -21,33 +23,36 @@ func NewChannelRepo(pool *pgxpool.Pool) *ChannelRepo {
 
 func (r *ChannelRepo) Create(ctx context.Context, ch *domain.Channel) error {
 	query := `
-		INSERT INTO channels (id, workspace_id, name, description, type, is_encrypted, created_by, created_at)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`
-	_, err := r.pool.Exec(ctx, query,
-		ch.ID, ch.WorkspaceID, ch.Name, ch.Description, ch.Type, ch.IsEncrypted, ch.CreatedBy, ch.CreatedAt,
+		INSERT INTO channels (id, workspace_id, name, description, topic, type, is_encrypted,
+			posting_policy, slow_mode_seconds, created_by, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)`
+	_, err := conn(ctx, r.pool).Exec(ctx, query,
+		ch.ID, ch.WorkspaceID, ch.Name, ch.Description, ch.Topic, ch.Type, ch.IsEncrypted,
+		postingPolicy(ch), ch.SlowModeSeconds, ch.CreatedBy, ch.CreatedAt,
 	)
 	return err
 }
 
 func (r *ChannelRepo) GetByID(ctx context.Context, id uuid.UUID) (*domain.Channel, error) {
-	query := `SELECT id, workspace_id, name, description, type, is_encrypted, created_by, created_at, archived_at
-		FROM channels WHERE id = $1`
+	query := `SELECT ` + channelColumns + ` FROM channels
+		WHERE id = $1 AND EXISTS (
+			SELECT 1 FROM workspaces w WHERE w.id = channels.workspace_id AND w.deleted_at IS NULL
+		)`
 	var ch domain.Channel
-	err := r.pool.QueryRow(ctx, query, id).Scan(
-		&ch.ID, &ch.WorkspaceID, &ch.Name, &ch.Description, &ch.Type,
-		&ch.IsEncrypted, &ch.CreatedBy, &ch.CreatedAt, &ch.ArchivedAt,
-	)
+	err := scanChannel(conn(ctx, r.pool).QueryRow(ctx, query, id), &ch)
 	if errors.Is(err, pgx.ErrNoRows) {
 		return nil, nil
 	}
 	return &ch, err
 }
 
-func (r *ChannelRepo) ListByWorkspace(ctx context.Context, workspaceID uuid.UUID) ([]domain.Channel, error) {
-	query := `SELECT id, workspace_id, name, description, type, is_encrypted, created_by, created_at, archived_at
-		FROM channels WHERE workspace_id = $1 AND archived_at IS NULL ORDER BY created_at`
+func (r *ChannelRepo) ListByWorkspace(ctx context.Context, workspaceID uuid.UUID, includeArchived bool, page repository.Page) ([]domain.Channel, error) {
+	cond, orderLimit, pageArgs, backwards := keyset{time: "created_at", id: "id"}.clauses(page, 3)
+	query := `SELECT ` + channelColumns + `
+		FROM channels WHERE workspace_id = $1 AND ($2 OR archived_at IS NULL) AND ` + cond + `
+		` + orderLimit
 
-	rows, err := r.pool.Query(ctx, query, workspaceID)
+	rows, err := conn(ctx, r.pool).Query(ctx, query, append([]any{workspaceID, includeArchived}, pageArgs...)...)
 	if err != nil {
 		return nil, err
 	}
@@ -56,34 +61,89 @@ func (r *ChannelRepo) ListByWorkspace(ctx context.Context, workspaceID uuid.UUID
 	var channels []domain.Channel
 	for rows.Next() {
 		var ch domain.Channel
-		if err := rows.Scan(&ch.ID, &ch.WorkspaceID, &ch.Name, &ch.Description, &ch.Type,
-			&ch.IsEncrypted, &ch.CreatedBy, &ch.CreatedAt, &ch.ArchivedAt); err != nil {
+		if err := scanChannel(rows, &ch); err != nil {
 			return nil, err
 		}
 		channels = append(channels, ch)
 	}
+	if backwards {
+		slices.Reverse(channels)
+	}
 	return channels, rows.Err()
 }
 
 func (r *ChannelRepo) Update(ctx context.Context, ch *domain.Channel) error {
-	query := `UPDATE channels SET name = $1, description = $2 WHERE id = $3`
-	_, err := r.pool.Exec(ctx, query, ch.Name, ch.Description, ch.ID)
+	query := `UPDATE channels SET name = $1, description = $2, posting_policy = $3, slow_mode_seconds = $4 WHERE id = $5`
+	_, err := conn(ctx, r.pool).Exec(ctx, query, ch.Name, ch.Description, postingPolicy(ch), ch.SlowModeSeconds, ch.ID)
 	return err
 }
 
+const channelColumns = `id, workspace_id, name, description, topic, type, is_encrypted,
+	posting_policy, slow_mode_seconds, created_by, created_at, archived_at, unarchived_at`
+
+func scanChannel(row pgx.Row, ch *domain.Channel) error {
+	return row.Scan(&ch.ID, &ch.WorkspaceID, &ch.Name, &ch.Description, &ch.Topic, &ch.Type, &ch.IsEncrypted,
+		&ch.PostingPolicy, &ch.SlowModeSeconds, &ch.CreatedBy, &ch.CreatedAt, &ch.ArchivedAt, &ch.UnarchivedAt)
+}
+
+// postingPolicy defaults an unset policy the way the column does.
+func postingPolicy(ch *domain.Channel) string {
+	if ch.PostingPolicy == "" {
+		return domain.PostingPolicyEveryone
+	}
+	return ch.PostingPolicy
+}
+
 func (r *ChannelRepo) Archive(ctx context.Context, id uuid.UUID) error {
-	_, err := r.pool.Exec(ctx, `UPDATE channels SET archived_at = $1 WHERE id = $2`, time.Now(), id)
+	_, err := conn(ctx, r.pool).Exec(ctx, `UPDATE channels SET archived_at = $1 WHERE id = $2`, time.Now(), id)
+	return err
+}
+
+func (r *ChannelRepo) Unarchive(ctx context.Context, id uuid.UUID, at time.Time) error {
+	_, err := conn(ctx, r.pool).Exec(ctx, `UPDATE channels SET archived_at = NULL, unarchived_at = $1 WHERE id = $2`, at, id)
 	return err
 }
 
+func (r *ChannelRepo) ArchiveInactive(ctx context.Context, now time.Time) ([]domain.Channel, error) {
+	query := `
+		UPDATE channels c SET archived_at = $1
+		FROM workspaces w
+		WHERE w.id = c.workspace_id AND w.auto_archive_days IS NOT NULL AND w.deleted_at IS NULL
+		  AND c.archived_at IS NULL AND c.type <> 'dm'
+		  AND c.created_at < $1 - make_interval(days => w.auto_archive_days)
+		  AND (c.unarchived_at IS NULL OR c.unarchived_at < $1 - make_interval(days => w.auto_archive_days))
+		  AND NOT EXISTS (
+			SELECT 1 FROM messages m
+			WHERE m.channel_id = c.id AND m.created_at >= $1 - make_interval(days => w.auto_archive_days)
+		  )
+		RETURNING c.id, c.workspace_id, c.name, c.description, c.topic, c.type, c.is_encrypted,
+			c.posting_policy, c.slow_mode_seconds, c.created_by, c.created_at, c.archived_at, c.unarchived_at`
+
+	rows, err := conn(ctx, r.pool).Query(ctx, query, now)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var channels []domain.Channel
+	for rows.Next() {
+		var ch domain.Channel
+		if err := scanChannel(rows, &ch); err != nil {
+			return nil, err
+		}
+		channels = append(channels, ch)
+	}
+	return channels, rows.Err()
+}
+
 func (r *ChannelRepo) AddMember(ctx context.Context, m *domain.ChannelMember) error {
 	query := `INSERT INTO channel_members (channel_id, user_id, role, joined_at) VALUES ($1, $2, $3, $4)`
-	_, err := r.pool.Exec(ctx, query, m.ChannelID, m.UserID, m.Role, m.JoinedAt)
+	_, err := conn(ctx, r.pool).Exec(ctx, query, m.ChannelID, m.UserID, m.Role, m.JoinedAt)
 	return err
 }
 
 func (r *ChannelRepo) RemoveMember(ctx context.Context, channelID, userID uuid.UUID) error {
-	_, err := r.pool.Exec(ctx, `DELETE FROM channel_members WHERE channel_id = $1 AND user_id = $2`, channelID, userID)
+	_, err := conn(ctx, r.pool).Exec(ctx, `DELETE FROM channel_members WHERE channel_id = $1 AND user_id = $2`, channelID, userID)
 	return err
 }
 
@@ -91,7 +151,7 @@ func (r *ChannelRepo) GetMember(ctx context.Context, channelID, userID uuid.UUID
 	query := `SELECT channel_id, user_id, role, encrypted_key, last_read_msg_id, joined_at
 		FROM channel_members WHERE channel_id = $1 AND user_id = $2`
 	var m domain.ChannelMember
-	err := r.pool.QueryRow(ctx, query, channelID, userID).Scan(
+	err := conn(ctx, r.pool).QueryRow(ctx, query, channelID, userID).Scan(
 		&m.ChannelID, &m.UserID, &m.Role, &m.EncryptedKey, &m.LastReadMsgID, &m.JoinedAt,
 	)
 	if errors.Is(err, pgx.ErrNoRows) {
@@ -104,7 +164,7 @@ func (r *ChannelRepo) ListMembers(ctx context.Context, channelID uuid.UUID) ([]d
 	query := `SELECT channel_id, user_id, role, encrypted_key, last_read_msg_id, joined_at
 		FROM channel_members WHERE channel_id = $1 ORDER BY joined_at`
 
-	rows, err := r.pool.Query(ctx, query, channelID)
+	rows, err := conn(ctx, r.pool).Query(ctx, query, channelID)
 	if err != nil {
 		return nil, err
 	}
@@ -120,3 +180,117 @@ func (r *ChannelRepo) ListMembers(ctx context.Context, channelID uuid.UUID) ([]d
 	}
 	return members, rows.Err()
 }
+
+func (r *ChannelRepo) UpdateMemberRole(ctx context.Context, channelID, userID uuid.UUID, role string) error {
+	_, err := conn(ctx, r.pool).Exec(ctx, `UPDATE channel_members SET role = $1 WHERE channel_id = $2 AND user_id = $3`, role, channelID, userID)
+	return err
+}
+
+func (r *ChannelRepo) SetTopic(ctx context.Context, channelID uuid.UUID, topic *string) error {
+	_, err := conn(ctx, r.pool).Exec(ctx, `UPDATE channels SET topic = $1 WHERE id = $2`, topic, channelID)
+	return err
+}
+
+func (r *ChannelRepo) AddTopicChange(ctx context.Context, c *domain.ChannelTopicChange) error {
+	query := `
+		INSERT INTO channel_topic_changes (id, channel_id, topic, changed_by, changed_at)
+		VALUES ($1, $2, $3, $4, $5)`
+	_, err := conn(ctx, r.pool).Exec(ctx, query, c.ID, c.ChannelID, c.Topic, c.ChangedBy, c.ChangedAt)
+	return err
+}
+
+func (r *ChannelRepo) ListTopicChanges(ctx context.Context, channelID uuid.UUID, limit int) ([]domain.ChannelTopicChange, error) {
+	query := `SELECT id, channel_id, topic, changed_by, changed_at
+		FROM channel_topic_changes WHERE channel_id = $1 ORDER BY changed_at DESC, id LIMIT $2`
+
+	rows, err := conn(ctx, r.pool).Query(ctx, query, channelID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var changes []domain.ChannelTopicChange
+	for rows.Next() {
+		var c domain.ChannelTopicChange
+		if err := rows.Scan(&c.ID, &c.ChannelID, &c.Topic, &c.ChangedBy, &c.ChangedAt); err != nil {
+			return nil, err
+		}
+		changes = append(changes, c)
+	}
+	return changes, rows.Err()
+}
+
+func (r *ChannelRepo) RecordPost(ctx context.Context, channelID, userID uuid.UUID, at, notBefore time.Time) (bool, error) {
+	query := `
+		INSERT INTO channel_post_times (channel_id, user_id, posted_at) VALUES ($1, $2, $3)
+		ON CONFLICT (channel_id, user_id) DO UPDATE SET posted_at = EXCLUDED.posted_at
+		WHERE channel_post_times.posted_at <= $4`
+	tag, err := conn(ctx, r.pool).Exec(ctx, query, channelID, userID, at, notBefore)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() == 1, nil
+}
+
+func (r *ChannelRepo) LastPostAt(ctx context.Context, channelID, userID uuid.UUID) (*time.Time, error) {
+	var at time.Time
+	err := conn(ctx, r.pool).QueryRow(ctx,
+		`SELECT posted_at FROM channel_post_times WHERE channel_id = $1 AND user_id = $2`, channelID, userID,
+	).Scan(&at)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &at, nil
+}
+
+func (r *ChannelRepo) CreateBookmark(ctx context.Context, b *domain.ChannelBookmark) error {
+	query := `
+		INSERT INTO channel_bookmarks (id, channel_id, title, url, created_by, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6)`
+	_, err := conn(ctx, r.pool).Exec(ctx, query, b.ID, b.ChannelID, b.Title, b.URL, b.CreatedBy, b.CreatedAt)
+	return err
+}
+
+func (r *ChannelRepo) GetBookmark(ctx context.Context, id uuid.UUID) (*domain.ChannelBookmark, error) {
+	query := `SELECT id, channel_id, title, url, created_by, created_at FROM channel_bookmarks WHERE id = $1`
+	var b domain.ChannelBookmark
+	err := conn(ctx, r.pool).QueryRow(ctx, query, id).Scan(&b.ID, &b.ChannelID, &b.Title, &b.URL, &b.CreatedBy, &b.CreatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	return &b, err
+}
+
+func (r *ChannelRepo) ListBookmarks(ctx context.Context, channelID uuid.UUID) ([]domain.ChannelBookmark, error) {
+	query := `SELECT id, channel_id, title, url, created_by, created_at
+		FROM channel_bookmarks WHERE channel_id = $1 ORDER BY created_at, id`
+
+	rows, err := conn(ctx, r.pool).Query(ctx, query, channelID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var bookmarks []domain.ChannelBookmark
+	for rows.Next() {
+		var b domain.ChannelBookmark
+		if err := rows.Scan(&b.ID, &b.ChannelID, &b.Title, &b.URL, &b.CreatedBy, &b.CreatedAt); err != nil {
+			return nil, err
+		}
+		bookmarks = append(bookmarks, b)
+	}
+	return bookmarks, rows.Err()
+}
+
+func (r *ChannelRepo) UpdateBookmark(ctx context.Context, b *domain.ChannelBookmark) error {
+	_, err := conn(ctx, r.pool).Exec(ctx, `UPDATE channel_bookmarks SET title = $1, url = $2 WHERE id = $3`, b.Title, b.URL, b.ID)
+	return err
+}
+
+func (r *ChannelRepo) DeleteBookmark(ctx context.Context, id uuid.UUID) error {
+	_, err := conn(ctx, r.pool).Exec(ctx, `DELETE FROM channel_bookmarks WHERE id = $1`, id)
+	return err
+}
@@ -3,13 +3,14 @@ package postgres
 import (
 	"context"
 	"errors"
-	"fmt"
+	"slices"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/vedran77/pulse/internal/domain"
+	"github.com/vedran77/pulse/internal/repository"
 )
 
 type DMRepo struct {
@@ -24,7 +25,7 @@ func (r *DMRepo) CreateConversation(ctx context.Context, conv *domain.DMConversa
 	query := `
 		INSERT INTO dm_conversations (id, user1_id, user2_id, created_at)
 		VALUES ($1, $2, $3, $4)`
-	_, err := r.pool.Exec(ctx, query, conv.ID, conv.User1ID, conv.User2ID, conv.CreatedAt)
+	_, err := conn(ctx, r.pool).Exec(ctx, query, conv.ID, conv.User1ID, conv.User2ID, conv.CreatedAt)
 	return err
 }
 
@@ -34,7 +35,7 @@ func (r *DMRepo) GetConversationByUsers(ctx context.Context, user1ID, user2ID uu
 		FROM dm_conversations
 		WHERE user1_id = $1 AND user2_id = $2`
 	var conv domain.DMConversation
-	err := r.pool.QueryRow(ctx, query, user1ID, user2ID).Scan(
+	err := conn(ctx, r.pool).QueryRow(ctx, query, user1ID, user2ID).Scan(
 		&conv.ID, &conv.User1ID, &conv.User2ID, &conv.CreatedAt,
 	)
 	if errors.Is(err, pgx.ErrNoRows) {
@@ -49,7 +50,7 @@ func (r *DMRepo) GetConversationByID(ctx context.Context, id uuid.UUID) (*domain
 		FROM dm_conversations
 		WHERE id = $1`
 	var conv domain.DMConversation
-	err := r.pool.QueryRow(ctx, query, id).Scan(
+	err := conn(ctx, r.pool).QueryRow(ctx, query, id).Scan(
 		&conv.ID, &conv.User1ID, &conv.User2ID, &conv.CreatedAt,
 	)
 	if errors.Is(err, pgx.ErrNoRows) {
@@ -58,19 +59,35 @@ func (r *DMRepo) GetConversationByID(ctx context.Context, id uuid.UUID) (*domain
 	return &conv, err
 }
 
-func (r *DMRepo) ListConversations(ctx context.Context, userID uuid.UUID) ([]domain.DMConversation, error) {
+// conversationKeyset orders conversations by their last activity.
+var conversationKeyset = keyset{time: "COALESCE(lm.created_at, c.created_at)", id: "c.id", desc: true}
+
+func (r *DMRepo) ListConversations(ctx context.Context, userID uuid.UUID, page repository.Page) ([]domain.DMConversation, error) {
+	cond, orderLimit, pageArgs, backwards := conversationKeyset.clauses(page, 2)
 	query := `
 		SELECT c.id, c.user1_id, c.user2_id, c.created_at,
-			CASE WHEN c.user1_id = $1 THEN c.user2_id ELSE c.user1_id END AS other_user_id,
-			CASE WHEN c.user1_id = $1 THEN u2.username ELSE u1.username END AS other_username,
-			CASE WHEN c.user1_id = $1 THEN u2.display_name ELSE u1.display_name END AS other_display_name
+			o.id, o.username, o.display_name,
+			lm.id, lm.sender_id, lm.content, lm.created_at,
+			COALESCE(lm.created_at, c.created_at), COALESCE(p.muted, FALSE),
+			(SELECT COUNT(*) FROM dm_messages um
+			 WHERE um.conversation_id = c.id AND um.sender_id <> $1 AND um.deleted_at IS NULL
+				AND (p.last_read_at IS NULL OR um.created_at > p.last_read_at))
 		FROM dm_conversations c
-		JOIN users u1 ON c.user1_id = u1.id
-		JOIN users u2 ON c.user2_id = u2.id
-		WHERE c.user1_id = $1 OR c.user2_id = $1
-		ORDER BY c.created_at DESC`
-
-	rows, err := r.pool.Query(ctx, query, userID)
+		JOIN users o ON o.id = CASE WHEN c.user1_id = $1 THEN c.user2_id ELSE c.user1_id END
+		LEFT JOIN dm_participants p ON p.conversation_id = c.id AND p.user_id = $1
+		LEFT JOIN LATERAL (
+			SELECT m.id, m.sender_id, m.content, m.created_at
+			FROM dm_messages m
+			WHERE m.conversation_id = c.id AND m.deleted_at IS NULL
+			ORDER BY m.created_at DESC, m.id DESC
+			LIMIT 1
+		) lm ON TRUE
+		WHERE (c.user1_id = $1 OR c.user2_id = $1)
+			AND (p.hidden_at IS NULL OR COALESCE(lm.created_at, c.created_at) > p.hidden_at)
+			AND ` + cond + `
+		` + orderLimit
+
+	rows, err := conn(ctx, r.pool).Query(ctx, query, append([]any{userID}, pageArgs...)...)
 	if err != nil {
 		return nil, err
 	}
@@ -79,22 +96,61 @@ func (r *DMRepo) ListConversations(ctx context.Context, userID uuid.UUID) ([]dom
 	var convs []domain.DMConversation
 	for rows.Next() {
 		var conv domain.DMConversation
+		var lastID, lastSenderID *uuid.UUID
+		var lastContent *string
+		var lastAt *time.Time
 		if err := rows.Scan(
 			&conv.ID, &conv.User1ID, &conv.User2ID, &conv.CreatedAt,
 			&conv.OtherUserID, &conv.OtherUserUsername, &conv.OtherUserDisplayName,
+			&lastID, &lastSenderID, &lastContent, &lastAt,
+			&conv.LastActivityAt, &conv.Muted, &conv.UnreadCount,
 		); err != nil {
 			return nil, err
 		}
+		if lastID != nil {
+			conv.LastMessage = &domain.DMMessagePreview{ID: *lastID, SenderID: *lastSenderID, CreatedAt: *lastAt}
+			if lastContent != nil {
+				conv.LastMessage.Content = *lastContent
+			}
+		}
 		convs = append(convs, conv)
 	}
+	if backwards {
+		slices.Reverse(convs)
+	}
 	return convs, rows.Err()
 }
 
+func (r *DMRepo) GetParticipant(ctx context.Context, conversationID, userID uuid.UUID) (*domain.DMParticipant, error) {
+	query := `
+		SELECT conversation_id, user_id, last_read_at, hidden_at, muted
+		FROM dm_participants
+		WHERE conversation_id = $1 AND user_id = $2`
+	var p domain.DMParticipant
+	err := conn(ctx, r.pool).QueryRow(ctx, query, conversationID, userID).Scan(
+		&p.ConversationID, &p.UserID, &p.LastReadAt, &p.HiddenAt, &p.Muted,
+	)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	return &p, err
+}
+
+func (r *DMRepo) SaveParticipant(ctx context.Context, p *domain.DMParticipant) error {
+	query := `
+		INSERT INTO dm_participants (conversation_id, user_id, last_read_at, hidden_at, muted)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (conversation_id, user_id) DO UPDATE
+		SET last_read_at = EXCLUDED.last_read_at, hidden_at = EXCLUDED.hidden_at, muted = EXCLUDED.muted`
+	_, err := conn(ctx, r.pool).Exec(ctx, query, p.ConversationID, p.UserID, p.LastReadAt, p.HiddenAt, p.Muted)
+	return err
+}
+
 func (r *DMRepo) CreateMessage(ctx context.Context, msg *domain.DMMessage) error {
 	query := `
 		INSERT INTO dm_messages (id, conversation_id, sender_id, content, created_at)
 		VALUES ($1, $2, $3, $4, $5)`
-	_, err := r.pool.Exec(ctx, query,
+	_, err := conn(ctx, r.pool).Exec(ctx, query,
 		msg.ID, msg.ConversationID, msg.SenderID, msg.Content, msg.CreatedAt,
 	)
 	return err
@@ -108,7 +164,7 @@ func (r *DMRepo) GetMessageByID(ctx context.Context, id uuid.UUID) (*domain.DMMe
 		JOIN users u ON m.sender_id = u.id
 		WHERE m.id = $1`
 	var msg domain.DMMessage
-	err := r.pool.QueryRow(ctx, query, id).Scan(
+	err := conn(ctx, r.pool).QueryRow(ctx, query, id).Scan(
 		&msg.ID, &msg.ConversationID, &msg.SenderID, &msg.Content,
 		&msg.EditedAt, &msg.DeletedAt, &msg.CreatedAt,
 		&msg.SenderUsername, &msg.SenderDisplayName,
@@ -119,34 +175,18 @@ func (r *DMRepo) GetMessageByID(ctx context.Context, id uuid.UUID) (*domain.DMMe
 	return &msg, err
 }
 
-func (r *DMRepo) ListMessages(ctx context.Context, conversationID uuid.UUID, before *uuid.UUID, limit int) ([]domain.DMMessage, error) {
-	var query string
-	var args []any
-
-	if before != nil {
-		query = fmt.Sprintf(`
-			SELECT m.id, m.conversation_id, m.sender_id, m.content,
-				m.edited_at, m.deleted_at, m.created_at, u.username, u.display_name
-			FROM dm_messages m
-			JOIN users u ON m.sender_id = u.id
-			WHERE m.conversation_id = $1 AND m.deleted_at IS NULL
-				AND m.created_at < (SELECT created_at FROM dm_messages WHERE id = $2)
-			ORDER BY m.created_at DESC
-			LIMIT %d`, limit)
-		args = []any{conversationID, *before}
-	} else {
-		query = fmt.Sprintf(`
-			SELECT m.id, m.conversation_id, m.sender_id, m.content,
-				m.edited_at, m.deleted_at, m.created_at, u.username, u.display_name
-			FROM dm_messages m
-			JOIN users u ON m.sender_id = u.id
-			WHERE m.conversation_id = $1 AND m.deleted_at IS NULL
-			ORDER BY m.created_at DESC
-			LIMIT %d`, limit)
-		args = []any{conversationID}
-	}
+func (r *DMRepo) ListMessages(ctx context.Context, conversationID uuid.UUID, page repository.Page) ([]domain.DMMessage, error) {
+	cond, orderLimit, pageArgs, backwards := messageKeyset.clauses(page, 2)
+	query := `
+		SELECT m.id, m.conversation_id, m.sender_id, m.content,
+			m.edited_at, m.deleted_at, m.created_at, u.username, u.display_name
+		FROM dm_messages m
+		JOIN users u ON m.sender_id = u.id
+		WHERE m.conversation_id = $1 AND m.deleted_at IS NULL AND ` + cond + `
+		` + orderLimit
+	args := append([]any{conversationID}, pageArgs...)
 
-	rows, err := r.pool.Query(ctx, query, args...)
+	rows, err := conn(ctx, r.pool).Query(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -165,9 +205,8 @@ func (r *DMRepo) ListMessages(ctx context.Context, conversationID uuid.UUID, bef
 		messages = append(messages, msg)
 	}
 
-	// Reverse to chronological order (query returns DESC)
-	for i, j := 0, len(messages)-1; i < j; i, j = i+1, j-1 {
-		messages[i], messages[j] = messages[j], messages[i]
+	if backwards {
+		slices.Reverse(messages)
 	}
 
 	return messages, rows.Err()
@@ -175,11 +214,11 @@ func (r *DMRepo) ListMessages(ctx context.Context, conversationID uuid.UUID, bef
 
 func (r *DMRepo) UpdateMessage(ctx context.Context, msg *domain.DMMessage) error {
 	query := `UPDATE dm_messages SET content = $1, edited_at = $2 WHERE id = $3`
-	_, err := r.pool.Exec(ctx, query, msg.Content, time.Now(), msg.ID)
+	_, err := conn(ctx, r.pool).Exec(ctx, query, msg.Content, time.Now(), msg.ID)
 	return err
 }
 
 func (r *DMRepo) SoftDeleteMessage(ctx context.Context, id uuid.UUID) error {
-	_, err := r.pool.Exec(ctx, `UPDATE dm_messages SET deleted_at = $1 WHERE id = $2`, time.Now(), id)
+	_, err := conn(ctx, r.pool).Exec(ctx, `UPDATE dm_messages SET deleted_at = $1 WHERE id = $2`, time.Now(), id)
 	return err
 }
@@ -0,0 +1,96 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/vedran77/pulse/internal/domain"
+)
+
+type IdentityRepo struct {
+	pool *pgxpool.Pool
+}
+
+func NewIdentityRepo(pool *pgxpool.Pool) *IdentityRepo {
+	return &IdentityRepo{pool: pool}
+}
+
+func (r *IdentityRepo) Create(ctx context.Context, identity *domain.UserIdentity) error {
+	query := `
+		INSERT INTO user_identities (id, user_id, issuer, subject, email, created_at, last_login_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)`
+	_, err := conn(ctx, r.pool).Exec(ctx, query,
+		identity.ID, identity.UserID, identity.Issuer, identity.Subject,
+		identity.Email, identity.CreatedAt, identity.LastLoginAt,
+	)
+	return err
+}
+
+func (r *IdentityRepo) GetBySubject(ctx context.Context, issuer, subject string) (*domain.UserIdentity, error) {
+	query := `
+		SELECT id, user_id, issuer, subject, email, created_at, last_login_at
+		FROM user_identities
+		WHERE issuer = $1 AND subject = $2`
+	var i domain.UserIdentity
+	err := conn(ctx, r.pool).QueryRow(ctx, query, issuer, subject).Scan(
+		&i.ID, &i.UserID, &i.Issuer, &i.Subject, &i.Email, &i.CreatedAt, &i.LastLoginAt,
+	)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	return &i, err
+}
+
+func (r *IdentityRepo) HasIdentity(ctx context.Context, userID uuid.UUID) (bool, error) {
+	var exists bool
+	err := conn(ctx, r.pool).QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM user_identities WHERE user_id = $1)`, userID).Scan(&exists)
+	return exists, err
+}
+
+func (r *IdentityRepo) TouchLogin(ctx context.Context, id uuid.UUID) error {
+	_, err := conn(ctx, r.pool).Exec(ctx, `UPDATE user_identities SET last_login_at = NOW() WHERE id = $1`, id)
+	return err
+}
+
+func (r *IdentityRepo) RequiresSSO(ctx context.Context, userID uuid.UUID) (bool, error) {
+	query := `
+		SELECT EXISTS (
+			SELECT 1 FROM workspace_members wm
+			JOIN workspaces w ON w.id = wm.workspace_id
+			WHERE wm.user_id = $1 AND w.require_sso AND w.deleted_at IS NULL
+		)`
+	var required bool
+	err := conn(ctx, r.pool).QueryRow(ctx, query, userID).Scan(&required)
+	return required, err
+}
+
+func (r *IdentityRepo) CreateLoginState(ctx context.Context, state *domain.OIDCLoginState) error {
+	// Abandoned logins are cleaned up here rather than by a background job
+	if _, err := conn(ctx, r.pool).Exec(ctx, `DELETE FROM oidc_login_states WHERE expires_at < NOW()`); err != nil {
+		return err
+	}
+
+	query := `
+		INSERT INTO oidc_login_states (state_hash, code_verifier, nonce, expires_at, created_at)
+		VALUES ($1, $2, $3, $4, $5)`
+	_, err := conn(ctx, r.pool).Exec(ctx, query, state.StateHash, state.CodeVerifier, state.Nonce, state.ExpiresAt, state.CreatedAt)
+	return err
+}
+
+func (r *IdentityRepo) ConsumeLoginState(ctx context.Context, stateHash string) (*domain.OIDCLoginState, error) {
+	query := `
+		DELETE FROM oidc_login_states
+		WHERE state_hash = $1
+		RETURNING state_hash, code_verifier, nonce, expires_at, created_at`
+	var s domain.OIDCLoginState
+	err := conn(ctx, r.pool).QueryRow(ctx, query, stateHash).Scan(
+		&s.StateHash, &s.CodeVerifier, &s.Nonce, &s.ExpiresAt, &s.CreatedAt,
+	)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	return &s, err
+}
@@ -3,11 +3,14 @@ package postgres
 import (
 	"context"
 	"errors"
+	"slices"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/vedran77/pulse/internal/domain"
+	"github.com/vedran77/pulse/internal/repository"
 )
 
 type InviteRepo struct {
@@ -20,45 +23,52 @@ func NewInviteRepo(pool *pgxpool.Pool) *InviteRepo {
 
 func (r *InviteRepo) Create(ctx context.Context, inv *domain.WorkspaceInvite) error {
 	query := `
-		INSERT INTO workspace_invites (id, workspace_id, email, token, invited_by, created_at, expires_at)
-		VALUES ($1, $2, $3, $4, $5, $6, $7)`
+		INSERT INTO workspace_invites (id, workspace_id, type, email, token, role, max_uses, invited_by, created_at, expires_at)
+		VALUES ($1, $2, $3, NULLIF($4, ''), $5, $6, $7, $8, $9, $10)`
 
-	_, err := r.pool.Exec(ctx, query,
-		inv.ID, inv.WorkspaceID, inv.Email, inv.Token, inv.InvitedBy, inv.CreatedAt, inv.ExpiresAt,
+	_, err := conn(ctx, r.pool).Exec(ctx, query,
+		inv.ID, inv.WorkspaceID, inv.Type, inv.Email, inv.Token, inv.Role, inv.MaxUses,
+		inv.InvitedBy, inv.CreatedAt, inv.ExpiresAt,
 	)
 	return err
 }
 
-func (r *InviteRepo) GetByToken(ctx context.Context, token string) (*domain.WorkspaceInvite, error) {
+func (r *InviteRepo) GetByID(ctx context.Context, id uuid.UUID) (*domain.WorkspaceInvite, error) {
 	query := `
-		SELECT wi.id, wi.workspace_id, wi.email, wi.token, wi.invited_by,
+		SELECT wi.id, wi.workspace_id, wi.type, COALESCE(wi.email, ''), wi.token, wi.role,
+		       wi.max_uses, wi.use_count, wi.invited_by,
 		       wi.created_at, wi.expires_at, wi.accepted_at, wi.accepted_by,
 		       w.name
 		FROM workspace_invites wi
 		JOIN workspaces w ON w.id = wi.workspace_id
-		WHERE wi.token = $1`
+		WHERE wi.id = $1 AND w.deleted_at IS NULL`
+	return r.scanInvite(ctx, query, id)
+}
 
-	var inv domain.WorkspaceInvite
-	err := r.pool.QueryRow(ctx, query, token).Scan(
-		&inv.ID, &inv.WorkspaceID, &inv.Email, &inv.Token, &inv.InvitedBy,
-		&inv.CreatedAt, &inv.ExpiresAt, &inv.AcceptedAt, &inv.AcceptedBy,
-		&inv.WorkspaceName,
-	)
-	if errors.Is(err, pgx.ErrNoRows) {
-		return nil, nil
-	}
-	return &inv, err
+func (r *InviteRepo) GetByToken(ctx context.Context, token string) (*domain.WorkspaceInvite, error) {
+	query := `
+		SELECT wi.id, wi.workspace_id, wi.type, COALESCE(wi.email, ''), wi.token, wi.role,
+		       wi.max_uses, wi.use_count, wi.invited_by,
+		       wi.created_at, wi.expires_at, wi.accepted_at, wi.accepted_by,
+		       w.name
+		FROM workspace_invites wi
+		JOIN workspaces w ON w.id = wi.workspace_id
+		WHERE wi.token = $1 AND w.deleted_at IS NULL`
+	return r.scanInvite(ctx, query, token)
 }
 
-func (r *InviteRepo) ListByWorkspace(ctx context.Context, workspaceID uuid.UUID) ([]domain.WorkspaceInvite, error) {
+func (r *InviteRepo) ListByWorkspace(ctx context.Context, workspaceID uuid.UUID, page repository.Page) ([]domain.WorkspaceInvite, error) {
+	cond, orderLimit, pageArgs, backwards := keyset{time: "created_at", id: "id", desc: true}.clauses(page, 2)
 	query := `
-		SELECT id, workspace_id, email, token, invited_by, created_at, expires_at, accepted_at, accepted_by
+		SELECT id, workspace_id, type, COALESCE(email, ''), token, role, max_uses, use_count,
+		       invited_by, created_at, expires_at, accepted_at, accepted_by
 		FROM workspace_invites
 		WHERE workspace_id = $1
 		  AND accepted_at IS NULL
-		ORDER BY created_at DESC`
+		  AND ` + cond + `
+		` + orderLimit
 
-	rows, err := r.pool.Query(ctx, query, workspaceID)
+	rows, err := conn(ctx, r.pool).Query(ctx, query, append([]any{workspaceID}, pageArgs...)...)
 	if err != nil {
 		return nil, err
 	}
@@ -68,23 +78,58 @@ func (r *InviteRepo) ListByWorkspace(ctx context.Context, workspaceID uuid.UUID)
 	for rows.Next() {
 		var inv domain.WorkspaceInvite
 		if err := rows.Scan(
-			&inv.ID, &inv.WorkspaceID, &inv.Email, &inv.Token, &inv.InvitedBy,
-			&inv.CreatedAt, &inv.ExpiresAt, &inv.AcceptedAt, &inv.AcceptedBy,
+			&inv.ID, &inv.WorkspaceID, &inv.Type, &inv.Email, &inv.Token, &inv.Role, &inv.MaxUses, &inv.UseCount,
+			&inv.InvitedBy, &inv.CreatedAt, &inv.ExpiresAt, &inv.AcceptedAt, &inv.AcceptedBy,
 		); err != nil {
 			return nil, err
 		}
 		invites = append(invites, inv)
 	}
+	if backwards {
+		slices.Reverse(invites)
+	}
 	return invites, rows.Err()
 }
 
-func (r *InviteRepo) MarkAccepted(ctx context.Context, id, userID uuid.UUID) error {
-	query := `UPDATE workspace_invites SET accepted_at = NOW(), accepted_by = $1 WHERE id = $2`
-	_, err := r.pool.Exec(ctx, query, userID, id)
+// RecordUse atomically consumes one use of the invite. It returns false if the
+// invite was already used up by a concurrent accept. Once the last use is
+// consumed the invite is marked accepted.
+func (r *InviteRepo) RecordUse(ctx context.Context, id, userID uuid.UUID) (bool, error) {
+	query := `
+		UPDATE workspace_invites
+		SET use_count = use_count + 1,
+		    accepted_at = CASE WHEN max_uses IS NOT NULL AND use_count + 1 >= max_uses THEN NOW() ELSE accepted_at END,
+		    accepted_by = CASE WHEN max_uses IS NOT NULL AND use_count + 1 >= max_uses THEN $1 ELSE accepted_by END
+		WHERE id = $2
+		  AND accepted_at IS NULL
+		  AND (max_uses IS NULL OR use_count < max_uses)`
+	tag, err := conn(ctx, r.pool).Exec(ctx, query, userID, id)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() == 1, nil
+}
+
+func (r *InviteRepo) UpdateExpiry(ctx context.Context, id uuid.UUID, expiresAt time.Time) error {
+	_, err := conn(ctx, r.pool).Exec(ctx, `UPDATE workspace_invites SET expires_at = $1 WHERE id = $2`, expiresAt, id)
 	return err
 }
 
 func (r *InviteRepo) Delete(ctx context.Context, id uuid.UUID) error {
-	_, err := r.pool.Exec(ctx, `DELETE FROM workspace_invites WHERE id = $1`, id)
+	_, err := conn(ctx, r.pool).Exec(ctx, `DELETE FROM workspace_invites WHERE id = $1`, id)
 	return err
 }
+
+func (r *InviteRepo) scanInvite(ctx context.Context, query string, arg any) (*domain.WorkspaceInvite, error) {
+	var inv domain.WorkspaceInvite
+	err := conn(ctx, r.pool).QueryRow(ctx, query, arg).Scan(
+		&inv.ID, &inv.WorkspaceID, &inv.Type, &inv.Email, &inv.Token, &inv.Role,
+		&inv.MaxUses, &inv.UseCount, &inv.InvitedBy,
+		&inv.CreatedAt, &inv.ExpiresAt, &inv.AcceptedAt, &inv.AcceptedBy,
+		&inv.WorkspaceName,
+	)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	return &inv, err
+}
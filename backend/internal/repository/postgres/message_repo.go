@@ -3,13 +3,14 @@ package postgres
 import (
 	"context"
 	"errors"
-	"fmt"
+	"slices"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/vedran77/pulse/internal/domain"
+	"github.com/vedran77/pulse/internal/repository"
 )
 
 type MessageRepo struct {
@@ -24,7 +25,7 @@ func (r *MessageRepo) Create(ctx context.Context, msg *domain.Message) error {
 	query := `
 		INSERT INTO messages (id, channel_id, sender_id, content, type, parent_id, created_at)
 		VALUES ($1, $2, $3, $4, $5, $6, $7)`
-	_, err := r.pool.Exec(ctx, query,
+	_, err := conn(ctx, r.pool).Exec(ctx, query,
 		msg.ID, msg.ChannelID, msg.SenderID, msg.Content, msg.Type, msg.ParentID, msg.CreatedAt,
 	)
 	return err
@@ -38,7 +39,7 @@ func (r *MessageRepo) GetByID(ctx context.Context, id uuid.UUID) (*domain.Messag
 		JOIN users u ON m.sender_id = u.id
 		WHERE m.id = $1`
 	var msg domain.Message
-	err := r.pool.QueryRow(ctx, query, id).Scan(
+	err := conn(ctx, r.pool).QueryRow(ctx, query, id).Scan(
 		&msg.ID, &msg.ChannelID, &msg.SenderID, &msg.Content, &msg.Type,
 		&msg.ParentID, &msg.EditedAt, &msg.DeletedAt, &msg.CreatedAt,
 		&msg.SenderUsername, &msg.SenderDisplayName,
@@ -46,38 +47,31 @@ func (r *MessageRepo) GetByID(ctx context.Context, id uuid.UUID) (*domain.Messag
 	if errors.Is(err, pgx.ErrNoRows) {
 		return nil, nil
 	}
-	return &msg, err
+	if err != nil {
+		return nil, err
+	}
+
+	messages := []domain.Message{msg}
+	if err := r.attachEmbeds(ctx, messages); err != nil {
+		return nil, err
+	}
+	return &messages[0], nil
 }
 
-func (r *MessageRepo) ListByChannel(ctx context.Context, channelID uuid.UUID, before *uuid.UUID, limit int) ([]domain.Message, error) {
-	var query string
-	var args []any
-
-	if before != nil {
-		// Dohvati created_at od "before" poruke za cursor paginaciju
-		query = fmt.Sprintf(`
-			SELECT m.id, m.channel_id, m.sender_id, m.content, m.type, m.parent_id,
-				m.edited_at, m.deleted_at, m.created_at, u.username, u.display_name
-			FROM messages m
-			JOIN users u ON m.sender_id = u.id
-			WHERE m.channel_id = $1 AND m.deleted_at IS NULL
-				AND m.created_at < (SELECT created_at FROM messages WHERE id = $2)
-			ORDER BY m.created_at DESC
-			LIMIT %d`, limit)
-		args = []any{channelID, *before}
-	} else {
-		query = fmt.Sprintf(`
-			SELECT m.id, m.channel_id, m.sender_id, m.content, m.type, m.parent_id,
-				m.edited_at, m.deleted_at, m.created_at, u.username, u.display_name
-			FROM messages m
-			JOIN users u ON m.sender_id = u.id
-			WHERE m.channel_id = $1 AND m.deleted_at IS NULL
-			ORDER BY m.created_at DESC
-			LIMIT %d`, limit)
-		args = []any{channelID}
-	}
-
-	rows, err := r.pool.Query(ctx, query, args...)
+var messageKeyset = keyset{time: "m.created_at", id: "m.id", fromEnd: true}
+
+func (r *MessageRepo) ListByChannel(ctx context.Context, channelID uuid.UUID, page repository.Page) ([]domain.Message, error) {
+	cond, orderLimit, pageArgs, backwards := messageKeyset.clauses(page, 2)
+	query := `
+		SELECT m.id, m.channel_id, m.sender_id, m.content, m.type, m.parent_id,
+			m.edited_at, m.deleted_at, m.created_at, u.username, u.display_name
+		FROM messages m
+		JOIN users u ON m.sender_id = u.id
+		WHERE m.channel_id = $1 AND m.deleted_at IS NULL AND ` + cond + `
+		` + orderLimit
+	args := append([]any{channelID}, pageArgs...)
+
+	rows, err := conn(ctx, r.pool).Query(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -96,21 +90,163 @@ func (r *MessageRepo) ListByChannel(ctx context.Context, channelID uuid.UUID, be
 		messages = append(messages, msg)
 	}
 
-	// Reverse da budu chronological (query ih daje DESC)
-	for i, j := 0, len(messages)-1; i < j; i, j = i+1, j-1 {
-		messages[i], messages[j] = messages[j], messages[i]
+	if err := rows.Err(); err != nil {
+		return nil, err
 	}
 
-	return messages, rows.Err()
+	if backwards {
+		slices.Reverse(messages)
+	}
+
+	if err := r.attachEmbeds(ctx, messages); err != nil {
+		return nil, err
+	}
+	return messages, nil
 }
 
 func (r *MessageRepo) Update(ctx context.Context, msg *domain.Message) error {
 	query := `UPDATE messages SET content = $1, edited_at = $2 WHERE id = $3`
-	_, err := r.pool.Exec(ctx, query, msg.Content, time.Now(), msg.ID)
+	_, err := conn(ctx, r.pool).Exec(ctx, query, msg.Content, time.Now(), msg.ID)
 	return err
 }
 
 func (r *MessageRepo) SoftDelete(ctx context.Context, id uuid.UUID) error {
-	_, err := r.pool.Exec(ctx, `UPDATE messages SET deleted_at = $1 WHERE id = $2`, time.Now(), id)
+	_, err := conn(ctx, r.pool).Exec(ctx, `UPDATE messages SET deleted_at = $1 WHERE id = $2`, time.Now(), id)
+	return err
+}
+
+func (r *MessageRepo) SetEmbeds(ctx context.Context, messageID uuid.UUID, embeds []domain.MessageEmbed) error {
+	return pgx.BeginFunc(ctx, conn(ctx, r.pool), func(tx pgx.Tx) error {
+		if _, err := tx.Exec(ctx, `DELETE FROM message_embeds WHERE message_id = $1`, messageID); err != nil {
+			return err
+		}
+		for i, e := range embeds {
+			if _, err := tx.Exec(ctx, `
+				INSERT INTO message_embeds (message_id, position, url, title, description, image_url, site_name)
+				VALUES ($1, $2, $3, $4, $5, $6, $7)
+				ON CONFLICT DO NOTHING`,
+				messageID, i, e.URL, e.Title, e.Description, e.ImageURL, e.SiteName,
+			); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// attachEmbeds loads the link previews of messages with one query.
+func (r *MessageRepo) attachEmbeds(ctx context.Context, messages []domain.Message) error {
+	if len(messages) == 0 {
+		return nil
+	}
+	ids := make([]uuid.UUID, len(messages))
+	byID := make(map[uuid.UUID]*domain.Message, len(messages))
+	for i := range messages {
+		ids[i] = messages[i].ID
+		byID[messages[i].ID] = &messages[i]
+	}
+
+	rows, err := conn(ctx, r.pool).Query(ctx, `
+		SELECT message_id, url, title, description, image_url, site_name
+		FROM message_embeds
+		WHERE message_id = ANY($1)
+		ORDER BY message_id, position`, ids)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var messageID uuid.UUID
+		var e domain.MessageEmbed
+		if err := rows.Scan(&messageID, &e.URL, &e.Title, &e.Description, &e.ImageURL, &e.SiteName); err != nil {
+			return err
+		}
+		msg := byID[messageID]
+		msg.Embeds = append(msg.Embeds, e)
+	}
+	return rows.Err()
+}
+
+func (r *MessageRepo) AddPin(ctx context.Context, pin *domain.PinnedMessage, limit int) (bool, error) {
+	var added bool
+	err := pgx.BeginFunc(ctx, conn(ctx, r.pool), func(tx pgx.Tx) error {
+		// Lock the channel so concurrent pins can't both take the last slot
+		if _, err := tx.Exec(ctx, `SELECT 1 FROM channels WHERE id = $1 FOR UPDATE`, pin.ChannelID); err != nil {
+			return err
+		}
+		tag, err := tx.Exec(ctx, `
+			INSERT INTO pinned_messages (message_id, channel_id, pinned_by, pinned_at)
+			SELECT $1, $2, $3, $4
+			WHERE (SELECT COUNT(*) FROM pinned_messages WHERE channel_id = $2) < $5
+			ON CONFLICT (message_id) DO NOTHING`,
+			pin.MessageID, pin.ChannelID, pin.PinnedBy, pin.PinnedAt, limit,
+		)
+		if err != nil {
+			return err
+		}
+		added = tag.RowsAffected() == 1
+		return nil
+	})
+	return added, err
+}
+
+func (r *MessageRepo) GetPin(ctx context.Context, messageID uuid.UUID) (*domain.PinnedMessage, error) {
+	query := `SELECT message_id, channel_id, pinned_by, pinned_at FROM pinned_messages WHERE message_id = $1`
+	var pin domain.PinnedMessage
+	err := conn(ctx, r.pool).QueryRow(ctx, query, messageID).Scan(&pin.MessageID, &pin.ChannelID, &pin.PinnedBy, &pin.PinnedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	return &pin, err
+}
+
+func (r *MessageRepo) ListPins(ctx context.Context, channelID uuid.UUID) ([]domain.PinnedMessage, error) {
+	query := `
+		SELECT p.message_id, p.channel_id, p.pinned_by, p.pinned_at,
+			m.id, m.channel_id, m.sender_id, m.content, m.type, m.parent_id,
+			m.edited_at, m.deleted_at, m.created_at, u.username, u.display_name
+		FROM pinned_messages p
+		JOIN messages m ON m.id = p.message_id
+		JOIN users u ON m.sender_id = u.id
+		WHERE p.channel_id = $1 AND m.deleted_at IS NULL
+		ORDER BY p.pinned_at DESC, p.message_id`
+	rows, err := conn(ctx, r.pool).Query(ctx, query, channelID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var pins []domain.PinnedMessage
+	var messages []domain.Message
+	for rows.Next() {
+		var pin domain.PinnedMessage
+		var msg domain.Message
+		if err := rows.Scan(
+			&pin.MessageID, &pin.ChannelID, &pin.PinnedBy, &pin.PinnedAt,
+			&msg.ID, &msg.ChannelID, &msg.SenderID, &msg.Content, &msg.Type,
+			&msg.ParentID, &msg.EditedAt, &msg.DeletedAt, &msg.CreatedAt,
+			&msg.SenderUsername, &msg.SenderDisplayName,
+		); err != nil {
+			return nil, err
+		}
+		pins = append(pins, pin)
+		messages = append(messages, msg)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if err := r.attachEmbeds(ctx, messages); err != nil {
+		return nil, err
+	}
+	for i := range pins {
+		pins[i].Message = &messages[i]
+	}
+	return pins, nil
+}
+
+func (r *MessageRepo) RemovePin(ctx context.Context, messageID uuid.UUID) error {
+	_, err := conn(ctx, r.pool).Exec(ctx, `DELETE FROM pinned_messages WHERE message_id = $1`, messageID)
 	return err
 }
@@ -0,0 +1,41 @@
+package postgres
+
+import (
+	"fmt"
+
+	"github.com/vedran77/pulse/internal/repository"
+)
+
+// keyset orders a list by a timestamp column, with the ID column breaking ties.
+type keyset struct {
+	time, id string
+	desc     bool
+	// fromEnd makes a page without a cursor hold the last rows of the list
+	fromEnd bool
+}
+
+// clauses returns the page's WHERE condition and its ORDER BY ... LIMIT,
+// with the arguments for placeholders from $n on. Rows of a backwards page
+// are scanned from the cursor towards the start of the list and have to be
+// reversed into list order.
+func (k keyset) clauses(page repository.Page, n int) (cond, orderLimit string, args []any, backwards bool) {
+	backwards = page.Before != nil || (page.After == nil && k.fromEnd)
+	dir, op := "ASC", ">"
+	if k.desc != backwards {
+		dir, op = "DESC", "<"
+	}
+
+	cond = "TRUE"
+	key := page.After
+	if key == nil {
+		key = page.Before
+	}
+	if key != nil {
+		cond = fmt.Sprintf("(%s, %s) %s ($%d, $%d)", k.time, k.id, op, n, n+1)
+		args = append(args, key.Time, key.ID)
+		n += 2
+	}
+	orderLimit = fmt.Sprintf("ORDER BY %s %s, %s %s LIMIT $%d", k.time, dir, k.id, dir, n)
+	args = append(args, page.Limit)
+	return cond, orderLimit, args, backwards
+}
@@ -0,0 +1,85 @@
+package postgres_test
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/vedran77/pulse/internal/database"
+	"github.com/vedran77/pulse/internal/repository/postgres"
+	"github.com/vedran77/pulse/internal/repository/repotest"
+)
+
+// The contract suite needs a database it can wipe, e.g. pulse_test in the
+// dev container (see the README).
+const dsnEnv = "PULSE_TEST_DATABASE_URL"
+
+func TestContract(t *testing.T) {
+	dsn := os.Getenv(dsnEnv)
+	if dsn == "" {
+		t.Skipf("%s not set", dsnEnv)
+	}
+	ctx := context.Background()
+
+	pool, err := pgxpool.New(ctx, dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(pool.Close)
+
+	migrator, err := database.NewMigrator(pool)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := migrator.Up(ctx); err != nil {
+		t.Fatalf("applying migrations: %v", err)
+	}
+
+	repotest.Run(t, func(t *testing.T) repotest.Repos {
+		truncate(t, pool)
+		return repotest.Repos{
+			Users:      postgres.NewUserRepo(pool),
+			Tokens:     postgres.NewVerificationTokenRepo(pool),
+			TwoFactor:  postgres.NewTwoFactorRepo(pool),
+			Identities: postgres.NewIdentityRepo(pool),
+			Workspaces: postgres.NewWorkspaceRepo(pool),
+			Channels:   postgres.NewChannelRepo(pool),
+			Invites:    postgres.NewInviteRepo(pool),
+			Messages:   postgres.NewMessageRepo(pool),
+			Pulsemates: postgres.NewPulsemateRepo(pool),
+			DMs:        postgres.NewDMRepo(pool),
+			Saved:      postgres.NewSavedItemRepo(pool),
+			Scheduled:  postgres.NewScheduledMessageRepo(pool),
+			Tx:         postgres.NewTxManager(pool),
+		}
+	})
+}
+
+// truncate empties every table except the migration history.
+func truncate(t *testing.T, pool *pgxpool.Pool) {
+	t.Helper()
+	ctx := context.Background()
+
+	rows, err := pool.Query(ctx, `
+		SELECT quote_ident(tablename) FROM pg_tables
+		WHERE schemaname = current_schema() AND tablename <> 'goose_db_version'`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var tables []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			t.Fatal(err)
+		}
+		tables = append(tables, name)
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := pool.Exec(ctx, "TRUNCATE "+strings.Join(tables, ", ")+" CASCADE"); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -3,11 +3,13 @@ package postgres
 import (
 	"context"
 	"errors"
+	"slices"
 
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/vedran77/pulse/internal/domain"
+	"github.com/vedran77/pulse/internal/repository"
 )
 
 type PulsemateRepo struct {
@@ -22,7 +24,7 @@ func (r *PulsemateRepo) CreateRequest(ctx context.Context, req *domain.Pulsemate
 	query := `
 		INSERT INTO pulsemate_requests (id, sender_id, receiver_id, status, created_at)
 		VALUES ($1, $2, $3, $4, $5)`
-	_, err := r.pool.Exec(ctx, query, req.ID, req.SenderID, req.ReceiverID, req.Status, req.CreatedAt)
+	_, err := conn(ctx, r.pool).Exec(ctx, query, req.ID, req.SenderID, req.ReceiverID, req.Status, req.CreatedAt)
 	return err
 }
 
@@ -32,7 +34,7 @@ func (r *PulsemateRepo) GetRequestByID(ctx context.Context, id uuid.UUID) (*doma
 		FROM pulsemate_requests
 		WHERE id = $1`
 	var req domain.PulsemateRequest
-	err := r.pool.QueryRow(ctx, query, id).Scan(
+	err := conn(ctx, r.pool).QueryRow(ctx, query, id).Scan(
 		&req.ID, &req.SenderID, &req.ReceiverID, &req.Status, &req.CreatedAt,
 	)
 	if errors.Is(err, pgx.ErrNoRows) {
@@ -47,7 +49,7 @@ func (r *PulsemateRepo) GetRequestByUsers(ctx context.Context, senderID, receive
 		FROM pulsemate_requests
 		WHERE sender_id = $1 AND receiver_id = $2`
 	var req domain.PulsemateRequest
-	err := r.pool.QueryRow(ctx, query, senderID, receiverID).Scan(
+	err := conn(ctx, r.pool).QueryRow(ctx, query, senderID, receiverID).Scan(
 		&req.ID, &req.SenderID, &req.ReceiverID, &req.Status, &req.CreatedAt,
 	)
 	if errors.Is(err, pgx.ErrNoRows) {
@@ -65,7 +67,7 @@ func (r *PulsemateRepo) ListIncomingRequests(ctx context.Context, userID uuid.UU
 		WHERE r.receiver_id = $1 AND r.status = 'pending'
 		ORDER BY r.created_at DESC`
 
-	rows, err := r.pool.Query(ctx, query, userID)
+	rows, err := conn(ctx, r.pool).Query(ctx, query, userID)
 	if err != nil {
 		return nil, err
 	}
@@ -94,7 +96,7 @@ func (r *PulsemateRepo) ListOutgoingRequests(ctx context.Context, userID uuid.UU
 		WHERE r.sender_id = $1 AND r.status = 'pending'
 		ORDER BY r.created_at DESC`
 
-	rows, err := r.pool.Query(ctx, query, userID)
+	rows, err := conn(ctx, r.pool).Query(ctx, query, userID)
 	if err != nil {
 		return nil, err
 	}
@@ -115,7 +117,7 @@ func (r *PulsemateRepo) ListOutgoingRequests(ctx context.Context, userID uuid.UU
 }
 
 func (r *PulsemateRepo) DeleteRequest(ctx context.Context, id uuid.UUID) error {
-	_, err := r.pool.Exec(ctx, `DELETE FROM pulsemate_requests WHERE id = $1`, id)
+	_, err := conn(ctx, r.pool).Exec(ctx, `DELETE FROM pulsemate_requests WHERE id = $1`, id)
 	return err
 }
 
@@ -123,7 +125,7 @@ func (r *PulsemateRepo) CreatePulsemate(ctx context.Context, pm *domain.Pulsemat
 	query := `
 		INSERT INTO pulsemates (id, user1_id, user2_id, created_at)
 		VALUES ($1, $2, $3, $4)`
-	_, err := r.pool.Exec(ctx, query, pm.ID, pm.User1ID, pm.User2ID, pm.CreatedAt)
+	_, err := conn(ctx, r.pool).Exec(ctx, query, pm.ID, pm.User1ID, pm.User2ID, pm.CreatedAt)
 	return err
 }
 
@@ -133,7 +135,7 @@ func (r *PulsemateRepo) GetPulsemateByUsers(ctx context.Context, user1ID, user2I
 		FROM pulsemates
 		WHERE user1_id = $1 AND user2_id = $2`
 	var pm domain.Pulsemate
-	err := r.pool.QueryRow(ctx, query, user1ID, user2ID).Scan(
+	err := conn(ctx, r.pool).QueryRow(ctx, query, user1ID, user2ID).Scan(
 		&pm.ID, &pm.User1ID, &pm.User2ID, &pm.CreatedAt,
 	)
 	if errors.Is(err, pgx.ErrNoRows) {
@@ -143,11 +145,12 @@ func (r *PulsemateRepo) GetPulsemateByUsers(ctx context.Context, user1ID, user2I
 }
 
 func (r *PulsemateRepo) DeletePulsemate(ctx context.Context, user1ID, user2ID uuid.UUID) error {
-	_, err := r.pool.Exec(ctx, `DELETE FROM pulsemates WHERE user1_id = $1 AND user2_id = $2`, user1ID, user2ID)
+	_, err := conn(ctx, r.pool).Exec(ctx, `DELETE FROM pulsemates WHERE user1_id = $1 AND user2_id = $2`, user1ID, user2ID)
 	return err
 }
 
-func (r *PulsemateRepo) ListPulsemates(ctx context.Context, userID uuid.UUID) ([]domain.Pulsemate, error) {
+func (r *PulsemateRepo) ListPulsemates(ctx context.Context, userID uuid.UUID, page repository.Page) ([]domain.Pulsemate, error) {
+	cond, orderLimit, pageArgs, backwards := keyset{time: "p.created_at", id: "p.id", desc: true}.clauses(page, 2)
 	query := `
 		SELECT p.id, p.user1_id, p.user2_id, p.created_at,
 			CASE WHEN p.user1_id = $1 THEN p.user2_id ELSE p.user1_id END AS other_user_id,
@@ -157,10 +160,10 @@ func (r *PulsemateRepo) ListPulsemates(ctx context.Context, userID uuid.UUID) ([
 		FROM pulsemates p
 		JOIN users u1 ON p.user1_id = u1.id
 		JOIN users u2 ON p.user2_id = u2.id
-		WHERE p.user1_id = $1 OR p.user2_id = $1
-		ORDER BY other_display_name ASC`
+		WHERE (p.user1_id = $1 OR p.user2_id = $1) AND ` + cond + `
+		` + orderLimit
 
-	rows, err := r.pool.Query(ctx, query, userID)
+	rows, err := conn(ctx, r.pool).Query(ctx, query, append([]any{userID}, pageArgs...)...)
 	if err != nil {
 		return nil, err
 	}
@@ -177,6 +180,9 @@ func (r *PulsemateRepo) ListPulsemates(ctx context.Context, userID uuid.UUID) ([
 		}
 		pms = append(pms, pm)
 	}
+	if backwards {
+		slices.Reverse(pms)
+	}
 	return pms, rows.Err()
 }
 
@@ -186,7 +192,7 @@ func (r *PulsemateRepo) ArePulsemates(ctx context.Context, userA, userB uuid.UUI
 		u1, u2 = u2, u1
 	}
 	var exists bool
-	err := r.pool.QueryRow(ctx,
+	err := conn(ctx, r.pool).QueryRow(ctx,
 		`SELECT EXISTS(SELECT 1 FROM pulsemates WHERE user1_id = $1 AND user2_id = $2)`,
 		u1, u2,
 	).Scan(&exists)
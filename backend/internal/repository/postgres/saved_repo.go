@@ -0,0 +1,108 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/vedran77/pulse/internal/domain"
+)
+
+type SavedItemRepo struct {
+	pool *pgxpool.Pool
+}
+
+func NewSavedItemRepo(pool *pgxpool.Pool) *SavedItemRepo {
+	return &SavedItemRepo{pool: pool}
+}
+
+const savedItemColumns = `id, user_id, message_id, dm_message_id, remind_at, reminded_at, created_at`
+
+func (r *SavedItemRepo) Create(ctx context.Context, item *domain.SavedItem) error {
+	query := `
+		INSERT INTO saved_items (id, user_id, message_id, dm_message_id, remind_at, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6)`
+	_, err := conn(ctx, r.pool).Exec(ctx, query,
+		item.ID, item.UserID, item.MessageID, item.DMMessageID, item.RemindAt, item.CreatedAt,
+	)
+	return err
+}
+
+func (r *SavedItemRepo) GetByID(ctx context.Context, id uuid.UUID) (*domain.SavedItem, error) {
+	query := `SELECT ` + savedItemColumns + ` FROM saved_items WHERE id = $1`
+	return r.getOne(ctx, query, id)
+}
+
+func (r *SavedItemRepo) GetByMessage(ctx context.Context, userID, messageID uuid.UUID) (*domain.SavedItem, error) {
+	query := `SELECT ` + savedItemColumns + ` FROM saved_items
+		WHERE user_id = $1 AND (message_id = $2 OR dm_message_id = $2)`
+	return r.getOne(ctx, query, userID, messageID)
+}
+
+func (r *SavedItemRepo) getOne(ctx context.Context, query string, args ...any) (*domain.SavedItem, error) {
+	var item domain.SavedItem
+	err := conn(ctx, r.pool).QueryRow(ctx, query, args...).Scan(
+		&item.ID, &item.UserID, &item.MessageID, &item.DMMessageID, &item.RemindAt, &item.RemindedAt, &item.CreatedAt,
+	)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	return &item, err
+}
+
+func (r *SavedItemRepo) ListByUser(ctx context.Context, userID uuid.UUID) ([]domain.SavedItem, error) {
+	query := `SELECT ` + savedItemColumns + ` FROM saved_items
+		WHERE user_id = $1 ORDER BY created_at DESC, id`
+	return r.list(ctx, query, userID)
+}
+
+func (r *SavedItemRepo) SetReminder(ctx context.Context, id uuid.UUID, remindAt *time.Time) error {
+	_, err := conn(ctx, r.pool).Exec(ctx,
+		`UPDATE saved_items SET remind_at = $1, reminded_at = NULL WHERE id = $2`, remindAt, id)
+	return err
+}
+
+func (r *SavedItemRepo) Delete(ctx context.Context, id uuid.UUID) error {
+	_, err := conn(ctx, r.pool).Exec(ctx, `DELETE FROM saved_items WHERE id = $1`, id)
+	return err
+}
+
+func (r *SavedItemRepo) ListDueReminders(ctx context.Context, now time.Time, limit int) ([]domain.SavedItem, error) {
+	query := `SELECT ` + savedItemColumns + ` FROM saved_items
+		WHERE remind_at <= $1 AND reminded_at IS NULL
+		ORDER BY remind_at, id
+		LIMIT $2`
+	return r.list(ctx, query, now, limit)
+}
+
+func (r *SavedItemRepo) MarkReminded(ctx context.Context, id uuid.UUID, at time.Time) (bool, error) {
+	tag, err := conn(ctx, r.pool).Exec(ctx,
+		`UPDATE saved_items SET reminded_at = $1 WHERE id = $2 AND reminded_at IS NULL AND remind_at IS NOT NULL`, at, id)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() == 1, nil
+}
+
+func (r *SavedItemRepo) list(ctx context.Context, query string, args ...any) ([]domain.SavedItem, error) {
+	rows, err := conn(ctx, r.pool).Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var items []domain.SavedItem
+	for rows.Next() {
+		var item domain.SavedItem
+		if err := rows.Scan(
+			&item.ID, &item.UserID, &item.MessageID, &item.DMMessageID, &item.RemindAt, &item.RemindedAt, &item.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
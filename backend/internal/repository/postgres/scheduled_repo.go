@@ -0,0 +1,115 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/vedran77/pulse/internal/domain"
+)
+
+type ScheduledMessageRepo struct {
+	pool *pgxpool.Pool
+}
+
+func NewScheduledMessageRepo(pool *pgxpool.Pool) *ScheduledMessageRepo {
+	return &ScheduledMessageRepo{pool: pool}
+}
+
+const scheduledMessageColumns = `id, user_id, channel_id, conversation_id, parent_id, content, send_at,
+	failed_at, error, attempts, created_at, updated_at`
+
+func (r *ScheduledMessageRepo) Create(ctx context.Context, msg *domain.ScheduledMessage) error {
+	query := `
+		INSERT INTO scheduled_messages (id, user_id, channel_id, conversation_id, parent_id, content, send_at, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`
+	_, err := conn(ctx, r.pool).Exec(ctx, query,
+		msg.ID, msg.UserID, msg.ChannelID, msg.ConversationID, msg.ParentID, msg.Content, msg.SendAt, msg.CreatedAt, msg.UpdatedAt,
+	)
+	return err
+}
+
+func (r *ScheduledMessageRepo) GetByID(ctx context.Context, id uuid.UUID) (*domain.ScheduledMessage, error) {
+	query := `SELECT ` + scheduledMessageColumns + ` FROM scheduled_messages WHERE id = $1`
+	return r.getOne(ctx, query, id)
+}
+
+func (r *ScheduledMessageRepo) ListByUser(ctx context.Context, userID uuid.UUID) ([]domain.ScheduledMessage, error) {
+	query := `SELECT ` + scheduledMessageColumns + ` FROM scheduled_messages
+		WHERE user_id = $1 ORDER BY send_at, id`
+
+	rows, err := conn(ctx, r.pool).Query(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var msgs []domain.ScheduledMessage
+	for rows.Next() {
+		var m domain.ScheduledMessage
+		if err := rows.Scan(
+			&m.ID, &m.UserID, &m.ChannelID, &m.ConversationID, &m.ParentID, &m.Content, &m.SendAt,
+			&m.FailedAt, &m.Error, &m.Attempts, &m.CreatedAt, &m.UpdatedAt,
+		); err != nil {
+			return nil, err
+		}
+		msgs = append(msgs, m)
+	}
+	return msgs, rows.Err()
+}
+
+func (r *ScheduledMessageRepo) Update(ctx context.Context, msg *domain.ScheduledMessage) (bool, error) {
+	query := `
+		UPDATE scheduled_messages
+		SET content = $1, send_at = $2, failed_at = NULL, error = NULL, attempts = 0, updated_at = $3
+		WHERE id = $4`
+	tag, err := conn(ctx, r.pool).Exec(ctx, query, msg.Content, msg.SendAt, msg.UpdatedAt, msg.ID)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() == 1, nil
+}
+
+func (r *ScheduledMessageRepo) Delete(ctx context.Context, id uuid.UUID) (bool, error) {
+	tag, err := conn(ctx, r.pool).Exec(ctx, `DELETE FROM scheduled_messages WHERE id = $1`, id)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() == 1, nil
+}
+
+func (r *ScheduledMessageRepo) ClaimDue(ctx context.Context, now time.Time) (*domain.ScheduledMessage, error) {
+	query := `SELECT ` + scheduledMessageColumns + ` FROM scheduled_messages
+		WHERE send_at <= $1 AND failed_at IS NULL
+		ORDER BY send_at, id
+		LIMIT 1
+		FOR UPDATE SKIP LOCKED`
+	return r.getOne(ctx, query, now)
+}
+
+func (r *ScheduledMessageRepo) MarkFailed(ctx context.Context, id uuid.UUID, reason string, at time.Time) error {
+	_, err := conn(ctx, r.pool).Exec(ctx,
+		`UPDATE scheduled_messages SET failed_at = $1, error = $2 WHERE id = $3`, at, reason, id)
+	return err
+}
+
+func (r *ScheduledMessageRepo) Retry(ctx context.Context, id uuid.UUID, sendAt time.Time) error {
+	_, err := conn(ctx, r.pool).Exec(ctx,
+		`UPDATE scheduled_messages SET send_at = $1, attempts = attempts + 1 WHERE id = $2`, sendAt, id)
+	return err
+}
+
+func (r *ScheduledMessageRepo) getOne(ctx context.Context, query string, args ...any) (*domain.ScheduledMessage, error) {
+	var m domain.ScheduledMessage
+	err := conn(ctx, r.pool).QueryRow(ctx, query, args...).Scan(
+		&m.ID, &m.UserID, &m.ChannelID, &m.ConversationID, &m.ParentID, &m.Content, &m.SendAt,
+		&m.FailedAt, &m.Error, &m.Attempts, &m.CreatedAt, &m.UpdatedAt,
+	)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	return &m, err
+}
@@ -0,0 +1,56 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/vedran77/pulse/internal/domain"
+)
+
+type VerificationTokenRepo struct {
+	pool *pgxpool.Pool
+}
+
+func NewVerificationTokenRepo(pool *pgxpool.Pool) *VerificationTokenRepo {
+	return &VerificationTokenRepo{pool: pool}
+}
+
+func (r *VerificationTokenRepo) Create(ctx context.Context, t *domain.VerificationToken) error {
+	query := `
+		INSERT INTO verification_tokens (id, user_id, purpose, token_hash, expires_at, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6)`
+	_, err := conn(ctx, r.pool).Exec(ctx, query, t.ID, t.UserID, t.Purpose, t.TokenHash, t.ExpiresAt, t.CreatedAt)
+	return err
+}
+
+func (r *VerificationTokenRepo) GetByHash(ctx context.Context, tokenHash string) (*domain.VerificationToken, error) {
+	query := `
+		SELECT id, user_id, purpose, token_hash, expires_at, used_at, created_at
+		FROM verification_tokens
+		WHERE token_hash = $1`
+	var t domain.VerificationToken
+	err := conn(ctx, r.pool).QueryRow(ctx, query, tokenHash).Scan(
+		&t.ID, &t.UserID, &t.Purpose, &t.TokenHash, &t.ExpiresAt, &t.UsedAt, &t.CreatedAt,
+	)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	return &t, err
+}
+
+func (r *VerificationTokenRepo) Consume(ctx context.Context, id uuid.UUID) (bool, error) {
+	tag, err := conn(ctx, r.pool).Exec(ctx, `UPDATE verification_tokens SET used_at = NOW() WHERE id = $1 AND used_at IS NULL`, id)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() == 1, nil
+}
+
+func (r *VerificationTokenRepo) InvalidateForUser(ctx context.Context, userID uuid.UUID, purpose string) error {
+	query := `UPDATE verification_tokens SET used_at = NOW() WHERE user_id = $1 AND purpose = $2 AND used_at IS NULL`
+	_, err := conn(ctx, r.pool).Exec(ctx, query, userID, purpose)
+	return err
+}
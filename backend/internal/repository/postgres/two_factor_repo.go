@@ -0,0 +1,112 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/vedran77/pulse/internal/domain"
+)
+
+type TwoFactorRepo struct {
+	pool *pgxpool.Pool
+}
+
+func NewTwoFactorRepo(pool *pgxpool.Pool) *TwoFactorRepo {
+	return &TwoFactorRepo{pool: pool}
+}
+
+func (r *TwoFactorRepo) Upsert(ctx context.Context, tf *domain.TwoFactor) error {
+	query := `
+		INSERT INTO user_totp (user_id, secret, confirmed_at, last_used_step, created_at)
+		VALUES ($1, $2, NULL, 0, $3)
+		ON CONFLICT (user_id) DO UPDATE
+		SET secret = EXCLUDED.secret, confirmed_at = NULL, last_used_step = 0, created_at = EXCLUDED.created_at`
+	_, err := conn(ctx, r.pool).Exec(ctx, query, tf.UserID, tf.Secret, tf.CreatedAt)
+	return err
+}
+
+func (r *TwoFactorRepo) Get(ctx context.Context, userID uuid.UUID) (*domain.TwoFactor, error) {
+	query := `
+		SELECT user_id, secret, confirmed_at, last_used_step, created_at
+		FROM user_totp
+		WHERE user_id = $1`
+	var tf domain.TwoFactor
+	err := conn(ctx, r.pool).QueryRow(ctx, query, userID).Scan(
+		&tf.UserID, &tf.Secret, &tf.ConfirmedAt, &tf.LastUsedStep, &tf.CreatedAt,
+	)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	return &tf, err
+}
+
+func (r *TwoFactorRepo) Enable(ctx context.Context, userID uuid.UUID, codeHashes []string) error {
+	return pgx.BeginFunc(ctx, conn(ctx, r.pool), func(tx pgx.Tx) error {
+		if _, err := tx.Exec(ctx, `UPDATE user_totp SET confirmed_at = NOW() WHERE user_id = $1`, userID); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(ctx, `UPDATE users SET two_factor_enabled = true, updated_at = NOW() WHERE id = $1`, userID); err != nil {
+			return err
+		}
+		return replaceRecoveryCodes(ctx, tx, userID, codeHashes)
+	})
+}
+
+func (r *TwoFactorRepo) Disable(ctx context.Context, userID uuid.UUID) error {
+	return pgx.BeginFunc(ctx, conn(ctx, r.pool), func(tx pgx.Tx) error {
+		if _, err := tx.Exec(ctx, `DELETE FROM user_totp WHERE user_id = $1`, userID); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(ctx, `DELETE FROM user_recovery_codes WHERE user_id = $1`, userID); err != nil {
+			return err
+		}
+		_, err := tx.Exec(ctx, `UPDATE users SET two_factor_enabled = false, updated_at = NOW() WHERE id = $1`, userID)
+		return err
+	})
+}
+
+func (r *TwoFactorRepo) UseStep(ctx context.Context, userID uuid.UUID, step int64) (bool, error) {
+	tag, err := conn(ctx, r.pool).Exec(ctx,
+		`UPDATE user_totp SET last_used_step = $1 WHERE user_id = $2 AND last_used_step < $1`,
+		step, userID,
+	)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() == 1, nil
+}
+
+func (r *TwoFactorRepo) ReplaceRecoveryCodes(ctx context.Context, userID uuid.UUID, codeHashes []string) error {
+	return pgx.BeginFunc(ctx, conn(ctx, r.pool), func(tx pgx.Tx) error {
+		return replaceRecoveryCodes(ctx, tx, userID, codeHashes)
+	})
+}
+
+func (r *TwoFactorRepo) UseRecoveryCode(ctx context.Context, userID uuid.UUID, codeHash string) (bool, error) {
+	tag, err := conn(ctx, r.pool).Exec(ctx,
+		`UPDATE user_recovery_codes SET used_at = NOW() WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL`,
+		userID, codeHash,
+	)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() == 1, nil
+}
+
+func replaceRecoveryCodes(ctx context.Context, tx pgx.Tx, userID uuid.UUID, codeHashes []string) error {
+	if _, err := tx.Exec(ctx, `DELETE FROM user_recovery_codes WHERE user_id = $1`, userID); err != nil {
+		return err
+	}
+	for _, h := range codeHashes {
+		if _, err := tx.Exec(ctx,
+			`INSERT INTO user_recovery_codes (user_id, code_hash) VALUES ($1, $2)`,
+			userID, h,
+		); err != nil {
+			return err
+		}
+	}
+	return nil
+}
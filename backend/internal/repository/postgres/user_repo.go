@@ -3,6 +3,7 @@ package postgres
 import (
 	"context"
 	"errors"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5"
@@ -10,6 +11,9 @@ import (
 	"github.com/vedran77/pulse/internal/domain"
 )
 
+const userColumns = `id, email, username, display_name, password_hash, public_key, avatar_url, status, created_at, updated_at,
+	email_verified_at, pending_email, token_version, two_factor_enabled, failed_login_attempts, locked_until, deleted_at`
+
 type UserRepo struct {
 	pool *pgxpool.Pool
 }
@@ -20,34 +24,139 @@ func NewUserRepo(pool *pgxpool.Pool) *UserRepo {
 
 func (r *UserRepo) Create(ctx context.Context, user *domain.User) error {
 	query := `
-		INSERT INTO users (id, email, username, display_name, password_hash, status, created_at, updated_at)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`
+		INSERT INTO users (id, email, username, display_name, password_hash, status, created_at, updated_at, email_verified_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`
 
-	_, err := r.pool.Exec(ctx, query,
+	_, err := conn(ctx, r.pool).Exec(ctx, query,
 		user.ID, user.Email, user.Username, user.DisplayName,
-		user.PasswordHash, user.Status, user.CreatedAt, user.UpdatedAt,
+		user.PasswordHash, user.Status, user.CreatedAt, user.UpdatedAt, user.EmailVerifiedAt,
 	)
 	return err
 }
 
 func (r *UserRepo) GetByID(ctx context.Context, id uuid.UUID) (*domain.User, error) {
-	return r.scanUser(ctx, "SELECT id, email, username, display_name, password_hash, public_key, avatar_url, status, created_at, updated_at FROM users WHERE id = $1", id)
+	return r.scanUser(ctx, "SELECT "+userColumns+" FROM users WHERE id = $1", id)
 }
 
 func (r *UserRepo) GetByEmail(ctx context.Context, email string) (*domain.User, error) {
-	return r.scanUser(ctx, "SELECT id, email, username, display_name, password_hash, public_key, avatar_url, status, created_at, updated_at FROM users WHERE email = $1", email)
+	return r.scanUser(ctx, "SELECT "+userColumns+" FROM users WHERE email = $1", email)
 }
 
 func (r *UserRepo) GetByUsername(ctx context.Context, username string) (*domain.User, error) {
-	return r.scanUser(ctx, "SELECT id, email, username, display_name, password_hash, public_key, avatar_url, status, created_at, updated_at FROM users WHERE username = $1", username)
+	return r.scanUser(ctx, "SELECT "+userColumns+" FROM users WHERE username = $1", username)
+}
+
+func (r *UserRepo) MarkEmailVerified(ctx context.Context, id uuid.UUID) error {
+	_, err := conn(ctx, r.pool).Exec(ctx, `UPDATE users SET email_verified_at = NOW(), updated_at = NOW() WHERE id = $1`, id)
+	return err
+}
+
+func (r *UserRepo) UpdatePassword(ctx context.Context, id uuid.UUID, passwordHash string) error {
+	query := `
+		UPDATE users
+		SET password_hash = $1, token_version = token_version + 1, updated_at = NOW()
+		WHERE id = $2`
+	_, err := conn(ctx, r.pool).Exec(ctx, query, passwordHash, id)
+	return err
+}
+
+func (r *UserRepo) RecordFailedLogin(ctx context.Context, id uuid.UUID, maxAttempts int, lockFor time.Duration) (*time.Time, error) {
+	// Both CASEs see the old attempt count
+	query := `
+		UPDATE users SET
+			failed_login_attempts = CASE WHEN failed_login_attempts + 1 >= $2 THEN 0 ELSE failed_login_attempts + 1 END,
+			locked_until = CASE WHEN failed_login_attempts + 1 >= $2 THEN NOW() + make_interval(secs => $3) ELSE locked_until END
+		WHERE id = $1
+		RETURNING locked_until`
+	var lockedUntil *time.Time
+	err := conn(ctx, r.pool).QueryRow(ctx, query, id, maxAttempts, lockFor.Seconds()).Scan(&lockedUntil)
+	return lockedUntil, err
+}
+
+func (r *UserRepo) ResetFailedLogins(ctx context.Context, id uuid.UUID) error {
+	_, err := conn(ctx, r.pool).Exec(ctx, `UPDATE users SET failed_login_attempts = 0, locked_until = NULL WHERE id = $1`, id)
+	return err
+}
+
+func (r *UserRepo) UpdateProfile(ctx context.Context, user *domain.User) error {
+	query := `UPDATE users SET username = $1, display_name = $2, updated_at = NOW() WHERE id = $3`
+	_, err := conn(ctx, r.pool).Exec(ctx, query, user.Username, user.DisplayName, user.ID)
+	return err
+}
+
+func (r *UserRepo) SetAvatarURL(ctx context.Context, id uuid.UUID, avatarURL *string) error {
+	_, err := conn(ctx, r.pool).Exec(ctx, `UPDATE users SET avatar_url = $1, updated_at = NOW() WHERE id = $2`, avatarURL, id)
+	return err
+}
+
+func (r *UserRepo) SetPendingEmail(ctx context.Context, id uuid.UUID, email *string) error {
+	_, err := conn(ctx, r.pool).Exec(ctx, `UPDATE users SET pending_email = $1, updated_at = NOW() WHERE id = $2`, email, id)
+	return err
+}
+
+func (r *UserRepo) ConfirmEmailChange(ctx context.Context, id uuid.UUID) error {
+	query := `
+		UPDATE users
+		SET email = pending_email, pending_email = NULL, email_verified_at = NOW(), updated_at = NOW()
+		WHERE id = $1 AND pending_email IS NOT NULL`
+	_, err := conn(ctx, r.pool).Exec(ctx, query, id)
+	return err
+}
+
+func (r *UserRepo) Anonymize(ctx context.Context, id uuid.UUID, deletedAt time.Time) error {
+	// Rows owned by the user; the ON DELETE CASCADE foreign keys don't fire
+	// because the user row is kept
+	personal := []string{
+		`DELETE FROM workspace_members WHERE user_id = $1`,
+		`DELETE FROM channel_members WHERE user_id = $1`,
+		`DELETE FROM channel_post_times WHERE user_id = $1`,
+		`DELETE FROM workspace_join_requests WHERE user_id = $1`,
+		`DELETE FROM verification_tokens WHERE user_id = $1`,
+		`DELETE FROM user_totp WHERE user_id = $1`,
+		`DELETE FROM user_recovery_codes WHERE user_id = $1`,
+		`DELETE FROM user_identities WHERE user_id = $1`,
+		`DELETE FROM saved_items WHERE user_id = $1`,
+		`DELETE FROM scheduled_messages WHERE user_id = $1`,
+		`DELETE FROM pulsemate_requests WHERE sender_id = $1 OR receiver_id = $1`,
+		`DELETE FROM pulsemates WHERE user1_id = $1 OR user2_id = $1`,
+	}
+	return pgx.BeginFunc(ctx, conn(ctx, r.pool), func(tx pgx.Tx) error {
+		for _, q := range personal {
+			if _, err := tx.Exec(ctx, q, id); err != nil {
+				return err
+			}
+		}
+		query := `
+			UPDATE users SET
+				email = 'deleted-' || id || '@deleted.invalid',
+				username = 'deleted-' || id,
+				display_name = 'Deleted user',
+				password_hash = '',
+				public_key = NULL,
+				avatar_url = NULL,
+				pending_email = NULL,
+				status = 'offline',
+				email_verified_at = NULL,
+				two_factor_enabled = false,
+				token_version = token_version + 1,
+				failed_login_attempts = 0,
+				locked_until = NULL,
+				deleted_at = $2,
+				updated_at = $2
+			WHERE id = $1`
+		_, err := tx.Exec(ctx, query, id, deletedAt)
+		return err
+	})
 }
 
 func (r *UserRepo) scanUser(ctx context.Context, query string, arg any) (*domain.User, error) {
 	var u domain.User
-	err := r.pool.QueryRow(ctx, query, arg).Scan(
+	err := conn(ctx, r.pool).QueryRow(ctx, query, arg).Scan(
 		&u.ID, &u.Email, &u.Username, &u.DisplayName,
 		&u.PasswordHash, &u.PublicKey, &u.AvatarURL,
 		&u.Status, &u.CreatedAt, &u.UpdatedAt,
+		&u.EmailVerifiedAt, &u.PendingEmail, &u.TokenVersion, &u.TwoFactorEnabled,
+		&u.FailedLoginAttempts, &u.LockedUntil, &u.DeletedAt,
 	)
 	if errors.Is(err, pgx.ErrNoRows) {
 		return nil, nil
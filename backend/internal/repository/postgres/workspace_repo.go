@@ -3,11 +3,15 @@ package postgres
 import (
 	"context"
 	"errors"
+	"slices"
+	"strings"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/vedran77/pulse/internal/domain"
+	"github.com/vedran77/pulse/internal/repository"
 )
 
 type WorkspaceRepo struct {
@@ -23,31 +27,71 @@ func (r *WorkspaceRepo) Create(ctx context.Context, ws *domain.Workspace) error
 		INSERT INTO workspaces (id, name, slug, description, owner_id, created_at)
 		VALUES ($1, $2, $3, $4, $5, $6)`
 
-	_, err := r.pool.Exec(ctx, query,
+	_, err := conn(ctx, r.pool).Exec(ctx, query,
 		ws.ID, ws.Name, ws.Slug, ws.Description, ws.OwnerID, ws.CreatedAt,
 	)
 	return err
 }
 
+// workspaceColumns are the workspace columns read by scanWorkspaceRow, from
+// a query that aliases workspaces as w.
+const workspaceColumns = `w.id, w.name, w.slug, w.description, w.owner_id, w.created_at,
+	w.join_requires_approval, w.require_two_factor, w.require_sso, w.auto_archive_days, w.deleted_at`
+
+func scanWorkspaceRow(row pgx.Row, ws *domain.Workspace, extra ...any) error {
+	dest := []any{&ws.ID, &ws.Name, &ws.Slug, &ws.Description, &ws.OwnerID, &ws.CreatedAt,
+		&ws.JoinRequiresApproval, &ws.RequireTwoFactor, &ws.RequireSSO, &ws.AutoArchiveDays, &ws.DeletedAt}
+	return row.Scan(append(dest, extra...)...)
+}
+
 func (r *WorkspaceRepo) GetByID(ctx context.Context, id uuid.UUID) (*domain.Workspace, error) {
-	query := `SELECT id, name, slug, description, owner_id, created_at FROM workspaces WHERE id = $1`
+	query := `SELECT ` + workspaceColumns + ` FROM workspaces w WHERE w.id = $1 AND w.deleted_at IS NULL`
+	return r.scanWorkspace(ctx, query, id)
+}
+
+func (r *WorkspaceRepo) GetDeletedByID(ctx context.Context, id uuid.UUID) (*domain.Workspace, error) {
+	query := `SELECT ` + workspaceColumns + ` FROM workspaces w WHERE w.id = $1 AND w.deleted_at IS NOT NULL`
 	return r.scanWorkspace(ctx, query, id)
 }
 
+// GetBySlug also finds deleted workspaces, whose slugs stay reserved until
+// they're purged.
 func (r *WorkspaceRepo) GetBySlug(ctx context.Context, slug string) (*domain.Workspace, error) {
-	query := `SELECT id, name, slug, description, owner_id, created_at FROM workspaces WHERE slug = $1`
+	query := `SELECT ` + workspaceColumns + ` FROM workspaces w WHERE w.slug = $1`
 	return r.scanWorkspace(ctx, query, slug)
 }
 
 func (r *WorkspaceRepo) ListByUser(ctx context.Context, userID uuid.UUID) ([]domain.Workspace, error) {
 	query := `
-		SELECT w.id, w.name, w.slug, w.description, w.owner_id, w.created_at
+		SELECT ` + workspaceColumns + `
 		FROM workspaces w
 		INNER JOIN workspace_members wm ON w.id = wm.workspace_id
-		WHERE wm.user_id = $1
+		WHERE wm.user_id = $1 AND w.deleted_at IS NULL
 		ORDER BY w.created_at DESC`
+	return r.listWorkspaces(ctx, query, userID)
+}
+
+func (r *WorkspaceRepo) ListDeletedByOwner(ctx context.Context, ownerID uuid.UUID) ([]domain.Workspace, error) {
+	query := `
+		SELECT ` + workspaceColumns + `
+		FROM workspaces w
+		WHERE w.owner_id = $1 AND w.deleted_at IS NOT NULL
+		ORDER BY w.deleted_at DESC`
+	return r.listWorkspaces(ctx, query, ownerID)
+}
+
+func (r *WorkspaceRepo) ListDeletedBefore(ctx context.Context, before time.Time, limit int) ([]domain.Workspace, error) {
+	query := `
+		SELECT ` + workspaceColumns + `
+		FROM workspaces w
+		WHERE w.deleted_at < $1
+		ORDER BY w.deleted_at
+		LIMIT $2`
+	return r.listWorkspaces(ctx, query, before, limit)
+}
 
-	rows, err := r.pool.Query(ctx, query, userID)
+func (r *WorkspaceRepo) listWorkspaces(ctx context.Context, query string, args ...any) ([]domain.Workspace, error) {
+	rows, err := conn(ctx, r.pool).Query(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -56,7 +100,7 @@ func (r *WorkspaceRepo) ListByUser(ctx context.Context, userID uuid.UUID) ([]dom
 	var workspaces []domain.Workspace
 	for rows.Next() {
 		var ws domain.Workspace
-		if err := rows.Scan(&ws.ID, &ws.Name, &ws.Slug, &ws.Description, &ws.OwnerID, &ws.CreatedAt); err != nil {
+		if err := scanWorkspaceRow(rows, &ws); err != nil {
 			return nil, err
 		}
 		workspaces = append(workspaces, ws)
@@ -65,13 +109,30 @@ func (r *WorkspaceRepo) ListByUser(ctx context.Context, userID uuid.UUID) ([]dom
 }
 
 func (r *WorkspaceRepo) Update(ctx context.Context, ws *domain.Workspace) error {
-	query := `UPDATE workspaces SET name = $1, slug = $2, description = $3 WHERE id = $4`
-	_, err := r.pool.Exec(ctx, query, ws.Name, ws.Slug, ws.Description, ws.ID)
+	query := `UPDATE workspaces SET name = $1, slug = $2, description = $3, join_requires_approval = $4, require_two_factor = $5, require_sso = $6,
+		auto_archive_days = $7 WHERE id = $8`
+	_, err := conn(ctx, r.pool).Exec(ctx, query, ws.Name, ws.Slug, ws.Description, ws.JoinRequiresApproval, ws.RequireTwoFactor, ws.RequireSSO,
+		ws.AutoArchiveDays, ws.ID)
+	return err
+}
+
+func (r *WorkspaceRepo) SetOwner(ctx context.Context, id, ownerID uuid.UUID) error {
+	_, err := conn(ctx, r.pool).Exec(ctx, `UPDATE workspaces SET owner_id = $1 WHERE id = $2`, ownerID, id)
+	return err
+}
+
+func (r *WorkspaceRepo) SoftDelete(ctx context.Context, id uuid.UUID, deletedAt time.Time) error {
+	_, err := conn(ctx, r.pool).Exec(ctx, `UPDATE workspaces SET deleted_at = $1 WHERE id = $2 AND deleted_at IS NULL`, deletedAt, id)
+	return err
+}
+
+func (r *WorkspaceRepo) Restore(ctx context.Context, id uuid.UUID) error {
+	_, err := conn(ctx, r.pool).Exec(ctx, `UPDATE workspaces SET deleted_at = NULL WHERE id = $1`, id)
 	return err
 }
 
 func (r *WorkspaceRepo) Delete(ctx context.Context, id uuid.UUID) error {
-	_, err := r.pool.Exec(ctx, `DELETE FROM workspaces WHERE id = $1`, id)
+	_, err := conn(ctx, r.pool).Exec(ctx, `DELETE FROM workspaces WHERE id = $1`, id)
 	return err
 }
 
@@ -79,34 +140,48 @@ func (r *WorkspaceRepo) AddMember(ctx context.Context, m *domain.WorkspaceMember
 	query := `
 		INSERT INTO workspace_members (workspace_id, user_id, role, joined_at)
 		VALUES ($1, $2, $3, $4)`
-	_, err := r.pool.Exec(ctx, query, m.WorkspaceID, m.UserID, m.Role, m.JoinedAt)
+	_, err := conn(ctx, r.pool).Exec(ctx, query, m.WorkspaceID, m.UserID, m.Role, m.JoinedAt)
 	return err
 }
 
 func (r *WorkspaceRepo) RemoveMember(ctx context.Context, workspaceID, userID uuid.UUID) error {
-	_, err := r.pool.Exec(ctx, `DELETE FROM workspace_members WHERE workspace_id = $1 AND user_id = $2`, workspaceID, userID)
+	_, err := conn(ctx, r.pool).Exec(ctx, `DELETE FROM workspace_members WHERE workspace_id = $1 AND user_id = $2`, workspaceID, userID)
+	return err
+}
+
+func (r *WorkspaceRepo) UpdateMemberRole(ctx context.Context, workspaceID, userID uuid.UUID, role string) error {
+	query := `UPDATE workspace_members SET role = $1 WHERE workspace_id = $2 AND user_id = $3`
+	_, err := conn(ctx, r.pool).Exec(ctx, query, role, workspaceID, userID)
 	return err
 }
 
 func (r *WorkspaceRepo) GetMember(ctx context.Context, workspaceID, userID uuid.UUID) (*domain.WorkspaceMember, error) {
-	query := `SELECT workspace_id, user_id, role, joined_at FROM workspace_members WHERE workspace_id = $1 AND user_id = $2`
+	query := `
+		SELECT wm.workspace_id, wm.user_id, wm.role, wm.joined_at, wm.title, wm.timezone, wm.pronouns
+		FROM workspace_members wm
+		JOIN workspaces w ON w.id = wm.workspace_id
+		WHERE wm.workspace_id = $1 AND wm.user_id = $2 AND w.deleted_at IS NULL`
 	var m domain.WorkspaceMember
-	err := r.pool.QueryRow(ctx, query, workspaceID, userID).Scan(&m.WorkspaceID, &m.UserID, &m.Role, &m.JoinedAt)
+	err := conn(ctx, r.pool).QueryRow(ctx, query, workspaceID, userID).Scan(
+		&m.WorkspaceID, &m.UserID, &m.Role, &m.JoinedAt, &m.Title, &m.Timezone, &m.Pronouns,
+	)
 	if errors.Is(err, pgx.ErrNoRows) {
 		return nil, nil
 	}
 	return &m, err
 }
 
-func (r *WorkspaceRepo) ListMembers(ctx context.Context, workspaceID uuid.UUID) ([]domain.WorkspaceMember, error) {
+func (r *WorkspaceRepo) ListMembers(ctx context.Context, workspaceID uuid.UUID, page repository.Page) ([]domain.WorkspaceMember, error) {
+	cond, orderLimit, pageArgs, backwards := keyset{time: "wm.joined_at", id: "wm.user_id"}.clauses(page, 2)
 	query := `
-		SELECT wm.workspace_id, wm.user_id, wm.role, wm.joined_at, u.username, u.display_name
+		SELECT wm.workspace_id, wm.user_id, wm.role, wm.joined_at, wm.title, wm.timezone, wm.pronouns,
+			u.username, u.display_name, u.avatar_url
 		FROM workspace_members wm
 		JOIN users u ON wm.user_id = u.id
-		WHERE wm.workspace_id = $1
-		ORDER BY wm.joined_at`
+		WHERE wm.workspace_id = $1 AND ` + cond + `
+		` + orderLimit
 
-	rows, err := r.pool.Query(ctx, query, workspaceID)
+	rows, err := conn(ctx, r.pool).Query(ctx, query, append([]any{workspaceID}, pageArgs...)...)
 	if err != nil {
 		return nil, err
 	}
@@ -115,19 +190,253 @@ func (r *WorkspaceRepo) ListMembers(ctx context.Context, workspaceID uuid.UUID)
 	var members []domain.WorkspaceMember
 	for rows.Next() {
 		var m domain.WorkspaceMember
-		if err := rows.Scan(&m.WorkspaceID, &m.UserID, &m.Role, &m.JoinedAt, &m.Username, &m.DisplayName); err != nil {
+		if err := rows.Scan(
+			&m.WorkspaceID, &m.UserID, &m.Role, &m.JoinedAt, &m.Title, &m.Timezone, &m.Pronouns,
+			&m.Username, &m.DisplayName, &m.AvatarURL,
+		); err != nil {
 			return nil, err
 		}
 		members = append(members, m)
 	}
+	if backwards {
+		slices.Reverse(members)
+	}
 	return members, rows.Err()
 }
 
+func (r *WorkspaceRepo) UpdateMemberProfile(ctx context.Context, m *domain.WorkspaceMember) error {
+	query := `
+		UPDATE workspace_members SET title = $1, timezone = $2, pronouns = $3
+		WHERE workspace_id = $4 AND user_id = $5`
+	_, err := conn(ctx, r.pool).Exec(ctx, query, m.Title, m.Timezone, m.Pronouns, m.WorkspaceID, m.UserID)
+	return err
+}
+
+// SearchMembers ranks the workspace's members against the query, see
+// repository.MemberSearch for the order. Usernames are compared bytewise so
+// pages line up with the cursor regardless of the database collation.
+func (r *WorkspaceRepo) SearchMembers(ctx context.Context, workspaceID uuid.UUID, search repository.MemberSearch) ([]repository.MemberMatch, error) {
+	q := strings.ToLower(strings.TrimSpace(search.Query))
+	prefix := escapeLike(q) + "%"
+	contains := "%" + prefix
+	var fuzzy strings.Builder
+	fuzzy.WriteString("%")
+	for _, c := range q {
+		fuzzy.WriteString(escapeLike(string(c)) + "%")
+	}
+
+	// A backwards page is read from the cursor towards the best match
+	op, dir := ">", "ASC"
+	key := search.After
+	if search.Before != nil {
+		op, dir, key = "<", "DESC", search.Before
+	}
+
+	query := `
+		SELECT workspace_id, user_id, role, joined_at, title, timezone, pronouns,
+			username, display_name, avatar_url, email, rank
+		FROM (
+			SELECT wm.workspace_id, wm.user_id, wm.role, wm.joined_at, wm.title, wm.timezone, wm.pronouns,
+				u.username, u.display_name, u.avatar_url,
+				CASE WHEN $6::bool THEN u.email ELSE '' END AS email,
+				CASE
+					WHEN lower(u.username) = $2 THEN 0
+					WHEN lower(u.username) LIKE $3 THEN 1
+					WHEN lower(u.display_name) LIKE $3 OR lower(u.display_name) LIKE '% ' || $3 THEN 2
+					WHEN $6 AND lower(u.email) LIKE $3 THEN 3
+					WHEN lower(u.username) LIKE $4 OR lower(u.display_name) LIKE $4
+						OR ($6 AND lower(u.email) LIKE $4) THEN 4
+					WHEN lower(u.username) LIKE $5 OR lower(u.display_name) LIKE $5 THEN 5
+				END AS rank
+			FROM workspace_members wm
+			JOIN users u ON u.id = wm.user_id
+			WHERE wm.workspace_id = $1 AND ($7::text = '' OR wm.role = $7)
+		) m
+		WHERE rank IS NOT NULL
+			AND ($8::int IS NULL OR (rank, username COLLATE "C", user_id) ` + op + ` ($8, $9::text COLLATE "C", $10::uuid))
+		ORDER BY rank ` + dir + `, username COLLATE "C" ` + dir + `, user_id ` + dir + `
+		LIMIT $11`
+
+	var keyRank *int
+	var keyUsername string
+	var keyID uuid.UUID
+	if key != nil {
+		keyRank, keyUsername, keyID = &key.Rank, key.Username, key.UserID
+	}
+	rows, err := conn(ctx, r.pool).Query(ctx, query,
+		workspaceID, q, prefix, contains, fuzzy.String(), search.IncludeEmail, search.Role,
+		keyRank, keyUsername, keyID, search.Limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var matches []repository.MemberMatch
+	for rows.Next() {
+		var m repository.MemberMatch
+		if err := rows.Scan(
+			&m.WorkspaceID, &m.UserID, &m.Role, &m.JoinedAt, &m.Title, &m.Timezone, &m.Pronouns,
+			&m.Username, &m.DisplayName, &m.AvatarURL, &m.Email, &m.Rank,
+		); err != nil {
+			return nil, err
+		}
+		matches = append(matches, m)
+	}
+	if search.Before != nil {
+		slices.Reverse(matches)
+	}
+	return matches, rows.Err()
+}
+
+// escapeLike escapes LIKE wildcards so s matches literally.
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
+
+// SetAllowedDomains replaces the workspace's allowed email domains.
+func (r *WorkspaceRepo) SetAllowedDomains(ctx context.Context, workspaceID uuid.UUID, domains []string) error {
+	return pgx.BeginFunc(ctx, conn(ctx, r.pool), func(tx pgx.Tx) error {
+		if _, err := tx.Exec(ctx, `DELETE FROM workspace_allowed_domains WHERE workspace_id = $1`, workspaceID); err != nil {
+			return err
+		}
+		for _, d := range domains {
+			if _, err := tx.Exec(ctx,
+				`INSERT INTO workspace_allowed_domains (workspace_id, domain) VALUES ($1, $2) ON CONFLICT DO NOTHING`,
+				workspaceID, d,
+			); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (r *WorkspaceRepo) ListAllowedDomains(ctx context.Context, workspaceID uuid.UUID) ([]string, error) {
+	rows, err := conn(ctx, r.pool).Query(ctx, `SELECT domain FROM workspace_allowed_domains WHERE workspace_id = $1 ORDER BY domain`, workspaceID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var domains []string
+	for rows.Next() {
+		var d string
+		if err := rows.Scan(&d); err != nil {
+			return nil, err
+		}
+		domains = append(domains, d)
+	}
+	return domains, rows.Err()
+}
+
+// ListDiscoverable returns workspaces that allow emailDomain and that the user is not yet a member of.
+func (r *WorkspaceRepo) ListDiscoverable(ctx context.Context, userID uuid.UUID, emailDomain string) ([]domain.DiscoverableWorkspace, error) {
+	query := `
+		SELECT ` + workspaceColumns + `,
+			(SELECT COUNT(*) FROM workspace_members m WHERE m.workspace_id = w.id),
+			EXISTS (
+				SELECT 1 FROM workspace_join_requests jr
+				WHERE jr.workspace_id = w.id AND jr.user_id = $1 AND jr.status = 'pending'
+			)
+		FROM workspaces w
+		JOIN workspace_allowed_domains d ON d.workspace_id = w.id
+		WHERE d.domain = $2 AND w.deleted_at IS NULL
+		  AND NOT EXISTS (
+			SELECT 1 FROM workspace_members wm WHERE wm.workspace_id = w.id AND wm.user_id = $1
+		  )
+		ORDER BY w.name`
+
+	rows, err := conn(ctx, r.pool).Query(ctx, query, userID, emailDomain)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var workspaces []domain.DiscoverableWorkspace
+	for rows.Next() {
+		var ws domain.DiscoverableWorkspace
+		if err := scanWorkspaceRow(rows, &ws.Workspace, &ws.MemberCount, &ws.HasPendingRequest); err != nil {
+			return nil, err
+		}
+		workspaces = append(workspaces, ws)
+	}
+	return workspaces, rows.Err()
+}
+
+func (r *WorkspaceRepo) CreateJoinRequest(ctx context.Context, req *domain.WorkspaceJoinRequest) error {
+	query := `
+		INSERT INTO workspace_join_requests (id, workspace_id, user_id, status, created_at)
+		VALUES ($1, $2, $3, $4, $5)`
+	_, err := conn(ctx, r.pool).Exec(ctx, query, req.ID, req.WorkspaceID, req.UserID, req.Status, req.CreatedAt)
+	return err
+}
+
+func (r *WorkspaceRepo) GetJoinRequestByID(ctx context.Context, id uuid.UUID) (*domain.WorkspaceJoinRequest, error) {
+	query := `
+		SELECT id, workspace_id, user_id, status, created_at, decided_by, decided_at
+		FROM workspace_join_requests
+		WHERE id = $1`
+	return r.scanJoinRequest(ctx, query, id)
+}
+
+func (r *WorkspaceRepo) GetPendingJoinRequest(ctx context.Context, workspaceID, userID uuid.UUID) (*domain.WorkspaceJoinRequest, error) {
+	query := `
+		SELECT id, workspace_id, user_id, status, created_at, decided_by, decided_at
+		FROM workspace_join_requests
+		WHERE workspace_id = $1 AND user_id = $2 AND status = 'pending'`
+	return r.scanJoinRequest(ctx, query, workspaceID, userID)
+}
+
+func (r *WorkspaceRepo) ListPendingJoinRequests(ctx context.Context, workspaceID uuid.UUID) ([]domain.WorkspaceJoinRequest, error) {
+	query := `
+		SELECT jr.id, jr.workspace_id, jr.user_id, jr.status, jr.created_at, jr.decided_by, jr.decided_at,
+			u.username, u.display_name, u.email
+		FROM workspace_join_requests jr
+		JOIN users u ON jr.user_id = u.id
+		WHERE jr.workspace_id = $1 AND jr.status = 'pending'
+		ORDER BY jr.created_at`
+
+	rows, err := conn(ctx, r.pool).Query(ctx, query, workspaceID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var reqs []domain.WorkspaceJoinRequest
+	for rows.Next() {
+		var req domain.WorkspaceJoinRequest
+		if err := rows.Scan(
+			&req.ID, &req.WorkspaceID, &req.UserID, &req.Status, &req.CreatedAt, &req.DecidedBy, &req.DecidedAt,
+			&req.Username, &req.DisplayName, &req.Email,
+		); err != nil {
+			return nil, err
+		}
+		reqs = append(reqs, req)
+	}
+	return reqs, rows.Err()
+}
+
+func (r *WorkspaceRepo) DecideJoinRequest(ctx context.Context, id uuid.UUID, status string, decidedBy uuid.UUID) error {
+	query := `UPDATE workspace_join_requests SET status = $1, decided_by = $2, decided_at = NOW() WHERE id = $3`
+	_, err := conn(ctx, r.pool).Exec(ctx, query, status, decidedBy, id)
+	return err
+}
+
+func (r *WorkspaceRepo) scanJoinRequest(ctx context.Context, query string, args ...any) (*domain.WorkspaceJoinRequest, error) {
+	var req domain.WorkspaceJoinRequest
+	err := conn(ctx, r.pool).QueryRow(ctx, query, args...).Scan(
+		&req.ID, &req.WorkspaceID, &req.UserID, &req.Status, &req.CreatedAt, &req.DecidedBy, &req.DecidedAt,
+	)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	return &req, err
+}
+
 func (r *WorkspaceRepo) scanWorkspace(ctx context.Context, query string, arg any) (*domain.Workspace, error) {
 	var ws domain.Workspace
-	err := r.pool.QueryRow(ctx, query, arg).Scan(
-		&ws.ID, &ws.Name, &ws.Slug, &ws.Description, &ws.OwnerID, &ws.CreatedAt,
-	)
+	err := scanWorkspaceRow(conn(ctx, r.pool).QueryRow(ctx, query, arg), &ws)
 	if errors.Is(err, pgx.ErrNoRows) {
 		return nil, nil
 	}
@@ -0,0 +1,267 @@
+package repotest
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/vedran77/pulse/internal/domain"
+	"github.com/vedran77/pulse/internal/repository"
+)
+
+func testChannels(t *testing.T, r Repos) {
+	ctx := context.Background()
+	alice := newUser(t, r, "alice")
+	bob := newUser(t, r, "bob")
+	ws := newWorkspace(t, r, "acme", alice, base)
+	otherWS := newWorkspace(t, r, "other", alice, base)
+
+	general := newChannel(t, r, ws, "general", alice, at(1))
+	random := newChannel(t, r, ws, "random", alice, at(2))
+	archived := newChannel(t, r, ws, "old", alice, at(3))
+	// Names are unique per workspace only
+	newChannel(t, r, otherWS, "general", alice, at(4))
+
+	dup := *general
+	dup.ID = uuid.New()
+	if err := r.Channels.Create(ctx, &dup); err == nil {
+		t.Fatal("duplicate channel name accepted")
+	}
+
+	got, err := r.Channels.GetByID(ctx, general.ID)
+	must(t, err)
+	if got == nil || got.Name != "general" || got.Type != "public" || got.ArchivedAt != nil || !got.CreatedAt.Equal(at(1)) {
+		t.Fatalf("GetByID = %+v", got)
+	}
+	if got, err := r.Channels.GetByID(ctx, uuid.New()); got != nil || err != nil {
+		t.Fatalf("GetByID(missing) = %v, %v", got, err)
+	}
+
+	must(t, r.Channels.Archive(ctx, archived.ID))
+	if got, _ := r.Channels.GetByID(ctx, archived.ID); got.ArchivedAt == nil {
+		t.Fatal("Archive didn't set ArchivedAt")
+	}
+	channelID := func(c domain.Channel) uuid.UUID { return c.ID }
+	all := repository.Page{Limit: 10}
+	list, err := r.Channels.ListByWorkspace(ctx, ws.ID, false, all)
+	must(t, err)
+	equalIDs(t, "ListByWorkspace", ids(list, channelID), general.ID, random.ID)
+	list, err = r.Channels.ListByWorkspace(ctx, ws.ID, true, all)
+	must(t, err)
+	equalIDs(t, "ListByWorkspace(includeArchived)", ids(list, channelID), general.ID, random.ID, archived.ID)
+	list, _ = r.Channels.ListByWorkspace(ctx, ws.ID, true, repository.Page{After: &repository.PageKey{Time: general.CreatedAt, ID: general.ID}, Limit: 1})
+	equalIDs(t, "ListByWorkspace after general", ids(list, channelID), random.ID)
+
+	t.Run("unarchive", func(t *testing.T) {
+		must(t, r.Channels.Unarchive(ctx, archived.ID, base))
+		if got, _ := r.Channels.GetByID(ctx, archived.ID); got.ArchivedAt != nil {
+			t.Fatal("Unarchive didn't clear ArchivedAt")
+		}
+		must(t, r.Channels.Archive(ctx, archived.ID))
+	})
+
+	t.Run("auto archive", func(t *testing.T) {
+		quiet := newWorkspace(t, r, "quiet", alice, base)
+		days := 30
+		quiet.AutoArchiveDays = &days
+		must(t, r.Workspaces.Update(ctx, quiet))
+		if got, _ := r.Workspaces.GetByID(ctx, quiet.ID); got.AutoArchiveDays == nil || *got.AutoArchiveDays != 30 {
+			t.Fatalf("AutoArchiveDays = %v", got.AutoArchiveDays)
+		}
+
+		now := base.Add(60 * 24 * time.Hour)
+		post := func(ch *domain.Channel, createdAt time.Time) {
+			t.Helper()
+			content := "ping"
+			must(t, r.Messages.Create(ctx, &domain.Message{ID: uuid.New(), ChannelID: ch.ID, SenderID: alice.ID, Content: &content, Type: "text", CreatedAt: createdAt}))
+		}
+		empty := newChannel(t, r, quiet, "empty", alice, at(1))
+		stale := newChannel(t, r, quiet, "stale", alice, at(2))
+		post(stale, at(3))
+		busy := newChannel(t, r, quiet, "busy", alice, at(4))
+		post(busy, now.Add(-24*time.Hour))
+		// Too new to have been inactive for 30 days
+		fresh := newChannel(t, r, quiet, "fresh", alice, now.Add(-24*time.Hour))
+
+		got, err := r.Channels.ArchiveInactive(ctx, now)
+		must(t, err)
+		var inQuiet []domain.Channel
+		for _, ch := range got {
+			if ch.ArchivedAt == nil {
+				t.Fatalf("returned channel %s isn't archived", ch.Name)
+			}
+			// Workspaces without a policy are left alone
+			if ch.WorkspaceID != quiet.ID {
+				t.Fatalf("archived %s in a workspace without a policy", ch.Name)
+			}
+			inQuiet = append(inQuiet, ch)
+		}
+		slices.SortFunc(inQuiet, func(a, b domain.Channel) int { return a.CreatedAt.Compare(b.CreatedAt) })
+		equalIDs(t, "ArchiveInactive", ids(inQuiet, channelID), empty.ID, stale.ID)
+
+		list, _ := r.Channels.ListByWorkspace(ctx, quiet.ID, false, all)
+		equalIDs(t, "active after ArchiveInactive", ids(list, channelID), busy.ID, fresh.ID)
+
+		// Unarchiving counts as activity, so the next run doesn't archive
+		// the channel straight back
+		must(t, r.Channels.Unarchive(ctx, empty.ID, now))
+		got, err = r.Channels.ArchiveInactive(ctx, now.Add(24*time.Hour))
+		must(t, err)
+		if len(got) != 0 {
+			t.Fatalf("ArchiveInactive after Unarchive returned %d channels", len(got))
+		}
+		if ch, _ := r.Channels.GetByID(ctx, empty.ID); ch.ArchivedAt != nil {
+			t.Fatal("unarchived channel archived again")
+		}
+		// Until it has been quiet for the whole period again
+		got, err = r.Channels.ArchiveInactive(ctx, now.Add(31*24*time.Hour))
+		must(t, err)
+		if !slices.ContainsFunc(got, func(ch domain.Channel) bool { return ch.ID == empty.ID }) {
+			t.Fatal("ArchiveInactive a period after Unarchive left the channel active")
+		}
+	})
+
+	t.Run("update", func(t *testing.T) {
+		desc := "Chatter"
+		random.Name = "chatter"
+		random.Description = &desc
+		random.Type = "private"
+		must(t, r.Channels.Update(ctx, random))
+		got, _ := r.Channels.GetByID(ctx, random.ID)
+		if got.Name != "chatter" || got.Description == nil || *got.Description != desc {
+			t.Fatalf("after Update: %+v", got)
+		}
+		if got.Type != "public" || got.PostingPolicy != domain.PostingPolicyEveryone || got.SlowModeSeconds != 0 {
+			t.Fatalf("Update changed more than it saves: %+v", got)
+		}
+
+		random.PostingPolicy = domain.PostingPolicyAdmins
+		random.SlowModeSeconds = 30
+		must(t, r.Channels.Update(ctx, random))
+		got, _ = r.Channels.GetByID(ctx, random.ID)
+		if got.PostingPolicy != domain.PostingPolicyAdmins || got.SlowModeSeconds != 30 {
+			t.Fatalf("posting rules after Update: %+v", got)
+		}
+		random.PostingPolicy = "nobody"
+		if err := r.Channels.Update(ctx, random); err == nil {
+			t.Fatal("unknown posting policy accepted")
+		}
+		random.PostingPolicy = domain.PostingPolicyAdmins
+		random.Name = "general"
+		if err := r.Channels.Update(ctx, random); err == nil {
+			t.Fatal("rename to a taken name accepted")
+		}
+	})
+
+	t.Run("members", func(t *testing.T) {
+		must(t, r.Channels.AddMember(ctx, &domain.ChannelMember{ChannelID: general.ID, UserID: bob.ID, Role: "member", JoinedAt: at(6)}))
+		must(t, r.Channels.AddMember(ctx, &domain.ChannelMember{ChannelID: general.ID, UserID: alice.ID, Role: "admin", JoinedAt: at(5)}))
+		if err := r.Channels.AddMember(ctx, &domain.ChannelMember{ChannelID: general.ID, UserID: bob.ID, Role: "member", JoinedAt: at(7)}); err == nil {
+			t.Fatal("duplicate channel member accepted")
+		}
+
+		m, err := r.Channels.GetMember(ctx, general.ID, alice.ID)
+		must(t, err)
+		if m == nil || m.Role != "admin" || m.LastReadMsgID != nil {
+			t.Fatalf("GetMember = %+v", m)
+		}
+		members, err := r.Channels.ListMembers(ctx, general.ID)
+		must(t, err)
+		equalIDs(t, "ListMembers", ids(members, func(m domain.ChannelMember) uuid.UUID { return m.UserID }), alice.ID, bob.ID)
+
+		must(t, r.Channels.UpdateMemberRole(ctx, general.ID, bob.ID, domain.ChannelRoleAdmin))
+		if m, _ := r.Channels.GetMember(ctx, general.ID, bob.ID); m.Role != domain.ChannelRoleAdmin {
+			t.Fatalf("role after UpdateMemberRole = %q", m.Role)
+		}
+		if err := r.Channels.UpdateMemberRole(ctx, general.ID, bob.ID, "owner"); err == nil {
+			t.Fatal("unknown channel role accepted")
+		}
+
+		must(t, r.Channels.RemoveMember(ctx, general.ID, bob.ID))
+		if m, err := r.Channels.GetMember(ctx, general.ID, bob.ID); m != nil || err != nil {
+			t.Fatalf("GetMember after remove = %v, %v", m, err)
+		}
+	})
+	t.Run("topic", func(t *testing.T) {
+		first, second := "Incidents only", "Deploys"
+		for i, topic := range []*string{&first, &second, nil} {
+			must(t, r.Channels.SetTopic(ctx, general.ID, topic))
+			must(t, r.Channels.AddTopicChange(ctx, &domain.ChannelTopicChange{
+				ID: uuid.New(), ChannelID: general.ID, Topic: topic, ChangedBy: alice.ID, ChangedAt: at(10 + i),
+			}))
+		}
+		must(t, r.Channels.SetTopic(ctx, general.ID, &second))
+		got, _ := r.Channels.GetByID(ctx, general.ID)
+		if got.Topic == nil || *got.Topic != second {
+			t.Fatalf("Topic = %v", got.Topic)
+		}
+
+		changes, err := r.Channels.ListTopicChanges(ctx, general.ID, 2)
+		must(t, err)
+		if len(changes) != 2 || changes[0].Topic != nil || *changes[1].Topic != second || !changes[1].ChangedAt.Equal(at(11)) {
+			t.Fatalf("ListTopicChanges = %+v", changes)
+		}
+	})
+
+	t.Run("slow mode", func(t *testing.T) {
+		if last, err := r.Channels.LastPostAt(ctx, general.ID, bob.ID); last != nil || err != nil {
+			t.Fatalf("LastPostAt before posting = %v, %v", last, err)
+		}
+		ok, err := r.Channels.RecordPost(ctx, general.ID, bob.ID, at(20), at(20).Add(-time.Minute))
+		must(t, err)
+		if !ok {
+			t.Fatal("first post refused")
+		}
+		// Within the cooldown
+		if ok, _ := r.Channels.RecordPost(ctx, general.ID, bob.ID, at(20).Add(30*time.Second), at(20).Add(-30*time.Second)); ok {
+			t.Fatal("post within the cooldown recorded")
+		}
+		if last, _ := r.Channels.LastPostAt(ctx, general.ID, bob.ID); last == nil || !last.Equal(at(20)) {
+			t.Fatalf("LastPostAt = %v", last)
+		}
+		// Cooldowns are per channel
+		if ok, _ := r.Channels.RecordPost(ctx, random.ID, bob.ID, at(20), at(20).Add(-time.Minute)); !ok {
+			t.Fatal("post in another channel refused")
+		}
+		if ok, _ := r.Channels.RecordPost(ctx, general.ID, bob.ID, at(21), at(20)); !ok {
+			t.Fatal("post after the cooldown refused")
+		}
+	})
+
+	t.Run("bookmarks", func(t *testing.T) {
+		newBookmark := func(title string, createdAt int) *domain.ChannelBookmark {
+			t.Helper()
+			b := &domain.ChannelBookmark{ID: uuid.New(), ChannelID: random.ID, Title: title, URL: "https://example.com/" + title, CreatedBy: alice.ID, CreatedAt: at(createdAt)}
+			must(t, r.Channels.CreateBookmark(ctx, b))
+			return b
+		}
+		runbook := newBookmark("runbook", 2)
+		oncall := newBookmark("oncall", 1)
+		if err := r.Channels.CreateBookmark(ctx, &domain.ChannelBookmark{ID: uuid.New(), ChannelID: uuid.New(), Title: "x", URL: "https://x.example", CreatedBy: alice.ID, CreatedAt: base}); err == nil {
+			t.Fatal("bookmark in a missing channel accepted")
+		}
+
+		bookmarkID := func(b domain.ChannelBookmark) uuid.UUID { return b.ID }
+		list, err := r.Channels.ListBookmarks(ctx, random.ID)
+		must(t, err)
+		equalIDs(t, "ListBookmarks", ids(list, bookmarkID), oncall.ID, runbook.ID)
+
+		runbook.Title = "Runbook"
+		runbook.URL = "https://wiki.example/runbook"
+		must(t, r.Channels.UpdateBookmark(ctx, runbook))
+		got, err := r.Channels.GetBookmark(ctx, runbook.ID)
+		must(t, err)
+		if got == nil || got.Title != "Runbook" || got.URL != "https://wiki.example/runbook" || got.CreatedBy != alice.ID || !got.CreatedAt.Equal(at(2)) {
+			t.Fatalf("GetBookmark = %+v", got)
+		}
+
+		must(t, r.Channels.DeleteBookmark(ctx, oncall.ID))
+		if got, err := r.Channels.GetBookmark(ctx, oncall.ID); got != nil || err != nil {
+			t.Fatalf("GetBookmark after delete = %v, %v", got, err)
+		}
+		list, _ = r.Channels.ListBookmarks(ctx, random.ID)
+		equalIDs(t, "ListBookmarks after delete", ids(list, bookmarkID), runbook.ID)
+	})
+}
@@ -0,0 +1,143 @@
+package repotest
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/vedran77/pulse/internal/domain"
+	"github.com/vedran77/pulse/internal/repository"
+)
+
+func testInvites(t *testing.T, r Repos) {
+	ctx := context.Background()
+	alice := newUser(t, r, "alice")
+	bob := newUser(t, r, "bob")
+	ws := newWorkspace(t, r, "acme", alice, base)
+
+	newInvite := func(typ, email, token string, maxUses *int, createdAt int) *domain.WorkspaceInvite {
+		t.Helper()
+		inv := &domain.WorkspaceInvite{
+			ID:          uuid.New(),
+			WorkspaceID: ws.ID,
+			Type:        typ,
+			Email:       email,
+			Token:       token,
+			Role:        "member",
+			MaxUses:     maxUses,
+			InvitedBy:   alice.ID,
+			CreatedAt:   at(createdAt),
+			ExpiresAt:   at(createdAt + 60),
+		}
+		must(t, r.Invites.Create(ctx, inv))
+		return inv
+	}
+	one := 1
+	emailInv := newInvite(domain.InviteTypeEmail, "bob@example.com", "t-email", &one, 1)
+	// Link invites have no email, and any number of them can exist
+	linkInv := newInvite(domain.InviteTypeLink, "", "t-link", nil, 2)
+	newInvite(domain.InviteTypeLink, "", "t-link-2", nil, 3)
+
+	if err := r.Invites.Create(ctx, &domain.WorkspaceInvite{
+		ID: uuid.New(), WorkspaceID: ws.ID, Type: domain.InviteTypeLink, Token: "t-link",
+		Role: "member", InvitedBy: alice.ID, CreatedAt: at(4), ExpiresAt: at(64),
+	}); err == nil {
+		t.Fatal("duplicate token accepted")
+	}
+	if err := r.Invites.Create(ctx, &domain.WorkspaceInvite{
+		ID: uuid.New(), WorkspaceID: ws.ID, Type: domain.InviteTypeEmail, Token: "t-no-email",
+		Role: "member", InvitedBy: alice.ID, CreatedAt: at(4), ExpiresAt: at(64),
+	}); err == nil {
+		t.Fatal("email invite without an email accepted")
+	}
+
+	got, err := r.Invites.GetByToken(ctx, "t-email")
+	must(t, err)
+	if got == nil || got.ID != emailInv.ID || got.WorkspaceName != "acme" || got.Email != "bob@example.com" || got.MaxUses == nil || *got.MaxUses != 1 {
+		t.Fatalf("GetByToken = %+v", got)
+	}
+	got, _ = r.Invites.GetByID(ctx, linkInv.ID)
+	if got == nil || got.Email != "" || got.MaxUses != nil || got.WorkspaceName != "acme" {
+		t.Fatalf("GetByID(link) = %+v", got)
+	}
+	if got, err := r.Invites.GetByToken(ctx, "missing"); got != nil || err != nil {
+		t.Fatalf("GetByToken(missing) = %v, %v", got, err)
+	}
+
+	t.Run("single use", func(t *testing.T) {
+		ok, err := r.Invites.RecordUse(ctx, emailInv.ID, bob.ID)
+		must(t, err)
+		if !ok {
+			t.Fatal("first use should succeed")
+		}
+		if ok, _ := r.Invites.RecordUse(ctx, emailInv.ID, bob.ID); ok {
+			t.Fatal("single-use invite used twice")
+		}
+		got, _ := r.Invites.GetByID(ctx, emailInv.ID)
+		if got.UseCount != 1 || got.AcceptedAt == nil || got.AcceptedBy == nil || *got.AcceptedBy != bob.ID {
+			t.Fatalf("after use: %+v", got)
+		}
+	})
+
+	t.Run("unlimited", func(t *testing.T) {
+		for range 3 {
+			if ok, _ := r.Invites.RecordUse(ctx, linkInv.ID, bob.ID); !ok {
+				t.Fatal("unlimited invite rejected a use")
+			}
+		}
+		got, _ := r.Invites.GetByID(ctx, linkInv.ID)
+		if got.UseCount != 3 || got.AcceptedAt != nil {
+			t.Fatalf("after uses: %+v", got)
+		}
+	})
+
+	t.Run("concurrent uses", func(t *testing.T) {
+		five := 5
+		inv := newInvite(domain.InviteTypeLink, "", "t-race", &five, 5)
+		var wg sync.WaitGroup
+		var mu sync.Mutex
+		succeeded := 0
+		for range 20 {
+			wg.Go(func() {
+				ok, err := r.Invites.RecordUse(ctx, inv.ID, bob.ID)
+				if err != nil {
+					t.Error(err)
+				}
+				if ok {
+					mu.Lock()
+					succeeded++
+					mu.Unlock()
+				}
+			})
+		}
+		wg.Wait()
+		if succeeded != 5 {
+			t.Fatalf("%d uses succeeded, want 5", succeeded)
+		}
+	})
+
+	t.Run("list pending", func(t *testing.T) {
+		list, err := r.Invites.ListByWorkspace(ctx, ws.ID, repository.Page{Limit: 10})
+		must(t, err)
+		// Newest first, without the used-up invites
+		if len(list) != 2 || list[0].Token != "t-link-2" || list[1].Token != "t-link" {
+			t.Fatalf("ListByWorkspace = %+v", list)
+		}
+		newest := &repository.PageKey{Time: list[0].CreatedAt, ID: list[0].ID}
+		if page, _ := r.Invites.ListByWorkspace(ctx, ws.ID, repository.Page{After: newest, Limit: 10}); len(page) != 1 || page[0].Token != "t-link" {
+			t.Fatalf("ListByWorkspace after newest = %+v", page)
+		}
+	})
+
+	t.Run("expiry and delete", func(t *testing.T) {
+		must(t, r.Invites.UpdateExpiry(ctx, linkInv.ID, at(500)))
+		if got, _ := r.Invites.GetByID(ctx, linkInv.ID); !got.ExpiresAt.Equal(at(500)) {
+			t.Fatalf("ExpiresAt = %v", got.ExpiresAt)
+		}
+		must(t, r.Invites.Delete(ctx, linkInv.ID))
+		if got, _ := r.Invites.GetByID(ctx, linkInv.ID); got != nil {
+			t.Fatal("invite not deleted")
+		}
+	})
+}
@@ -0,0 +1,365 @@
+package repotest
+
+import (
+	"bytes"
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/vedran77/pulse/internal/domain"
+	"github.com/vedran77/pulse/internal/repository"
+)
+
+func testMessages(t *testing.T, r Repos) {
+	ctx := context.Background()
+	alice := newUser(t, r, "alice")
+	ws := newWorkspace(t, r, "acme", alice, base)
+	ch := newChannel(t, r, ws, "general", alice, base)
+	other := newChannel(t, r, ws, "random", alice, base)
+
+	newMessage := func(ch *domain.Channel, content string, createdAt int) *domain.Message {
+		t.Helper()
+		msg := &domain.Message{
+			ID:        uuid.New(),
+			ChannelID: ch.ID,
+			SenderID:  alice.ID,
+			Content:   &content,
+			Type:      "text",
+			CreatedAt: at(createdAt),
+		}
+		must(t, r.Messages.Create(ctx, msg))
+		return msg
+	}
+	m1 := newMessage(ch, "one", 1)
+	m2 := newMessage(ch, "two", 2)
+	m3 := newMessage(ch, "three", 3)
+	m4 := newMessage(ch, "four", 4)
+	newMessage(other, "elsewhere", 5)
+
+	got, err := r.Messages.GetByID(ctx, m2.ID)
+	must(t, err)
+	if got == nil || *got.Content != "two" || got.SenderUsername != "alice" || got.SenderDisplayName != "alice" || !got.CreatedAt.Equal(at(2)) {
+		t.Fatalf("GetByID = %+v", got)
+	}
+	if got, err := r.Messages.GetByID(ctx, uuid.New()); got != nil || err != nil {
+		t.Fatalf("GetByID(missing) = %v, %v", got, err)
+	}
+
+	msgID := func(m domain.Message) uuid.UUID { return m.ID }
+	key := func(m *domain.Message) *repository.PageKey { return &repository.PageKey{Time: m.CreatedAt, ID: m.ID} }
+	page, err := r.Messages.ListByChannel(ctx, ch.ID, repository.Page{Limit: 3})
+	must(t, err)
+	equalIDs(t, "newest page", ids(page, msgID), m2.ID, m3.ID, m4.ID)
+	page, _ = r.Messages.ListByChannel(ctx, ch.ID, repository.Page{Before: key(m2), Limit: 3})
+	equalIDs(t, "page before m2", ids(page, msgID), m1.ID)
+	page, _ = r.Messages.ListByChannel(ctx, ch.ID, repository.Page{After: key(m1), Limit: 2})
+	equalIDs(t, "page after m1", ids(page, msgID), m2.ID, m3.ID)
+	page, _ = r.Messages.ListByChannel(ctx, ch.ID, repository.Page{After: key(m4), Limit: 2})
+	equalIDs(t, "page after newest", ids(page, msgID))
+
+	t.Run("equal timestamps", func(t *testing.T) {
+		tied := newChannel(t, r, ws, "tied", alice, base)
+		var want []uuid.UUID
+		for range 5 {
+			want = append(want, newMessage(tied, "same time", 7).ID)
+		}
+		slices.SortFunc(want, func(a, b uuid.UUID) int { return bytes.Compare(a[:], b[:]) })
+
+		// Backwards from the newest, then forwards from the oldest
+		var got []uuid.UUID
+		p := repository.Page{Limit: 2}
+		for {
+			page, err := r.Messages.ListByChannel(ctx, tied.ID, p)
+			must(t, err)
+			if len(page) == 0 {
+				break
+			}
+			got = append(ids(page, msgID), got...)
+			p.Before = key(&page[0])
+		}
+		equalIDs(t, "paging backwards", got, want...)
+
+		got = nil
+		p = repository.Page{After: &repository.PageKey{Time: at(7).Add(-time.Microsecond)}, Limit: 2}
+		for {
+			page, err := r.Messages.ListByChannel(ctx, tied.ID, p)
+			must(t, err)
+			if len(page) == 0 {
+				break
+			}
+			got = append(got, ids(page, msgID)...)
+			p.After = key(&page[len(page)-1])
+		}
+		equalIDs(t, "paging forwards", got, want...)
+	})
+
+	t.Run("embeds", func(t *testing.T) {
+		embeds := []domain.MessageEmbed{
+			{URL: "https://example.com/b", Title: "B", Description: "second link", ImageURL: "https://example.com/b.png", SiteName: "Example"},
+			{URL: "https://example.com/a", Title: "A"},
+			{URL: "https://example.com/b", Title: "B again"},
+		}
+		must(t, r.Messages.SetEmbeds(ctx, m2.ID, embeds))
+		got, _ := r.Messages.GetByID(ctx, m2.ID)
+		if len(got.Embeds) != 2 || got.Embeds[0] != embeds[0] || got.Embeds[1] != embeds[1] {
+			t.Fatalf("embeds = %+v", got.Embeds)
+		}
+		page, _ := r.Messages.ListByChannel(ctx, ch.ID, repository.Page{Limit: 10})
+		for _, msg := range page {
+			want := 0
+			if msg.ID == m2.ID {
+				want = 2
+			}
+			if len(msg.Embeds) != want {
+				t.Fatalf("ListByChannel embeds of %s = %+v", *msg.Content, msg.Embeds)
+			}
+		}
+
+		must(t, r.Messages.SetEmbeds(ctx, m2.ID, embeds[1:2]))
+		got, _ = r.Messages.GetByID(ctx, m2.ID)
+		if len(got.Embeds) != 1 || got.Embeds[0].URL != "https://example.com/a" {
+			t.Fatalf("replaced embeds = %+v", got.Embeds)
+		}
+		must(t, r.Messages.SetEmbeds(ctx, m2.ID, nil))
+		if got, _ := r.Messages.GetByID(ctx, m2.ID); len(got.Embeds) != 0 {
+			t.Fatalf("cleared embeds = %+v", got.Embeds)
+		}
+		if err := r.Messages.SetEmbeds(ctx, uuid.New(), embeds[:1]); err == nil {
+			t.Fatal("embeds for a missing message accepted")
+		}
+	})
+
+	t.Run("pins", func(t *testing.T) {
+		pin := func(m *domain.Message, pinnedAt, limit int) bool {
+			t.Helper()
+			added, err := r.Messages.AddPin(ctx, &domain.PinnedMessage{MessageID: m.ID, ChannelID: m.ChannelID, PinnedBy: alice.ID, PinnedAt: at(pinnedAt)}, limit)
+			must(t, err)
+			return added
+		}
+		if !pin(m1, 10, 2) || !pin(m3, 11, 2) {
+			t.Fatal("AddPin under the limit failed")
+		}
+		if pin(m1, 12, 2) {
+			t.Fatal("message pinned twice")
+		}
+		if pin(m2, 12, 2) {
+			t.Fatal("pin over the limit accepted")
+		}
+
+		got, err := r.Messages.GetPin(ctx, m1.ID)
+		must(t, err)
+		if got == nil || got.ChannelID != ch.ID || got.PinnedBy != alice.ID || !got.PinnedAt.Equal(at(10)) {
+			t.Fatalf("GetPin = %+v", got)
+		}
+		if got, err := r.Messages.GetPin(ctx, m2.ID); got != nil || err != nil {
+			t.Fatalf("GetPin(unpinned) = %v, %v", got, err)
+		}
+
+		pins, err := r.Messages.ListPins(ctx, ch.ID)
+		must(t, err)
+		equalIDs(t, "ListPins", ids(pins, func(p domain.PinnedMessage) uuid.UUID { return p.MessageID }), m3.ID, m1.ID)
+		if msg := pins[1].Message; msg == nil || *msg.Content != "one" || msg.SenderUsername != "alice" {
+			t.Fatalf("pinned message = %+v", msg)
+		}
+
+		must(t, r.Messages.RemovePin(ctx, m3.ID))
+		if !pin(m2, 13, 2) {
+			t.Fatal("pin after unpinning failed")
+		}
+		pins, _ = r.Messages.ListPins(ctx, ch.ID)
+		equalIDs(t, "ListPins after unpin", ids(pins, func(p domain.PinnedMessage) uuid.UUID { return p.MessageID }), m2.ID, m1.ID)
+		must(t, r.Messages.RemovePin(ctx, m1.ID))
+		must(t, r.Messages.RemovePin(ctx, m2.ID))
+	})
+
+	t.Run("edit and delete", func(t *testing.T) {
+		edited := "three, edited"
+		m3.Content = &edited
+		must(t, r.Messages.Update(ctx, m3))
+		got, _ := r.Messages.GetByID(ctx, m3.ID)
+		if *got.Content != edited || got.EditedAt == nil {
+			t.Fatalf("after Update: %+v", got)
+		}
+
+		must(t, r.Messages.SoftDelete(ctx, m4.ID))
+		got, _ = r.Messages.GetByID(ctx, m4.ID)
+		if got == nil || got.DeletedAt == nil {
+			t.Fatalf("soft-deleted message = %+v", got)
+		}
+		page, _ := r.Messages.ListByChannel(ctx, ch.ID, repository.Page{Limit: 10})
+		equalIDs(t, "page after delete", ids(page, msgID), m1.ID, m2.ID, m3.ID)
+	})
+
+	t.Run("replies", func(t *testing.T) {
+		content := "reply"
+		reply := &domain.Message{ID: uuid.New(), ChannelID: ch.ID, SenderID: alice.ID, Content: &content, Type: "text", ParentID: &m1.ID, CreatedAt: at(6)}
+		must(t, r.Messages.Create(ctx, reply))
+		if got, _ := r.Messages.GetByID(ctx, reply.ID); got.ParentID == nil || *got.ParentID != m1.ID {
+			t.Fatalf("reply = %+v", got)
+		}
+		missing := uuid.New()
+		reply = &domain.Message{ID: uuid.New(), ChannelID: ch.ID, SenderID: alice.ID, Content: &content, Type: "text", ParentID: &missing, CreatedAt: at(7)}
+		if err := r.Messages.Create(ctx, reply); err == nil {
+			t.Fatal("reply to a missing message accepted")
+		}
+	})
+}
+
+func testDMs(t *testing.T, r Repos) {
+	ctx := context.Background()
+	alice := newUser(t, r, "alice")
+	bob := newUser(t, r, "bob")
+	carol := newUser(t, r, "carol")
+
+	newConversation := func(a, b *domain.User, createdAt int) *domain.DMConversation {
+		t.Helper()
+		u1, u2 := ordered(a, b)
+		conv := &domain.DMConversation{ID: uuid.New(), User1ID: u1, User2ID: u2, CreatedAt: at(createdAt)}
+		must(t, r.DMs.CreateConversation(ctx, conv))
+		return conv
+	}
+	withBob := newConversation(alice, bob, 1)
+	withCarol := newConversation(alice, carol, 2)
+
+	u1, u2 := ordered(alice, bob)
+	if err := r.DMs.CreateConversation(ctx, &domain.DMConversation{ID: uuid.New(), User1ID: u2, User2ID: u1, CreatedAt: base}); err == nil {
+		t.Fatal("conversation with unordered users accepted")
+	}
+	if err := r.DMs.CreateConversation(ctx, &domain.DMConversation{ID: uuid.New(), User1ID: u1, User2ID: u2, CreatedAt: base}); err == nil {
+		t.Fatal("duplicate conversation accepted")
+	}
+
+	got, err := r.DMs.GetConversationByUsers(ctx, u1, u2)
+	must(t, err)
+	if got == nil || got.ID != withBob.ID {
+		t.Fatalf("GetConversationByUsers = %+v", got)
+	}
+	if got, _ := r.DMs.GetConversationByUsers(ctx, u2, u1); got != nil {
+		t.Fatal("GetConversationByUsers matched unordered users")
+	}
+	if got, _ := r.DMs.GetConversationByID(ctx, withCarol.ID); got == nil || !got.CreatedAt.Equal(at(2)) {
+		t.Fatalf("GetConversationByID = %+v", got)
+	}
+
+	convID := func(c domain.DMConversation) uuid.UUID { return c.ID }
+	convs, err := r.DMs.ListConversations(ctx, alice.ID, repository.Page{Limit: 10})
+	must(t, err)
+	equalIDs(t, "ListConversations", ids(convs, convID), withCarol.ID, withBob.ID)
+	if convs[0].OtherUserID != carol.ID || convs[0].OtherUserUsername != "carol" || convs[0].OtherUserDisplayName != "carol" {
+		t.Fatalf("other user fields = %+v", convs[0])
+	}
+	convs, _ = r.DMs.ListConversations(ctx, bob.ID, repository.Page{Limit: 10})
+	if len(convs) != 1 || convs[0].OtherUserID != alice.ID {
+		t.Fatalf("ListConversations(bob) = %+v", convs)
+	}
+	convs, _ = r.DMs.ListConversations(ctx, alice.ID, repository.Page{After: &repository.PageKey{Time: withCarol.CreatedAt, ID: withCarol.ID}, Limit: 10})
+	equalIDs(t, "ListConversations after newest", ids(convs, convID), withBob.ID)
+
+	t.Run("messages", func(t *testing.T) {
+		newMessage := func(sender *domain.User, content string, createdAt int) *domain.DMMessage {
+			t.Helper()
+			msg := &domain.DMMessage{ID: uuid.New(), ConversationID: withBob.ID, SenderID: sender.ID, Content: &content, CreatedAt: at(createdAt)}
+			must(t, r.DMs.CreateMessage(ctx, msg))
+			return msg
+		}
+		m1 := newMessage(alice, "hi", 10)
+		m2 := newMessage(bob, "hey", 11)
+		m3 := newMessage(alice, "bye", 12)
+
+		got, err := r.DMs.GetMessageByID(ctx, m2.ID)
+		must(t, err)
+		if got == nil || *got.Content != "hey" || got.SenderUsername != "bob" {
+			t.Fatalf("GetMessageByID = %+v", got)
+		}
+
+		msgID := func(m domain.DMMessage) uuid.UUID { return m.ID }
+		key := func(m *domain.DMMessage) *repository.PageKey { return &repository.PageKey{Time: m.CreatedAt, ID: m.ID} }
+		page, err := r.DMs.ListMessages(ctx, withBob.ID, repository.Page{Limit: 2})
+		must(t, err)
+		equalIDs(t, "newest page", ids(page, msgID), m2.ID, m3.ID)
+		page, _ = r.DMs.ListMessages(ctx, withBob.ID, repository.Page{Before: key(m2), Limit: 2})
+		equalIDs(t, "page before m2", ids(page, msgID), m1.ID)
+		page, _ = r.DMs.ListMessages(ctx, withBob.ID, repository.Page{After: key(m1), Limit: 1})
+		equalIDs(t, "page after m1", ids(page, msgID), m2.ID)
+
+		edited := "bye!"
+		m3.Content = &edited
+		must(t, r.DMs.UpdateMessage(ctx, m3))
+		if got, _ := r.DMs.GetMessageByID(ctx, m3.ID); *got.Content != edited || got.EditedAt == nil {
+			t.Fatalf("after UpdateMessage: %+v", got)
+		}
+		must(t, r.DMs.SoftDeleteMessage(ctx, m1.ID))
+		page, _ = r.DMs.ListMessages(ctx, withBob.ID, repository.Page{Limit: 10})
+		equalIDs(t, "page after delete", ids(page, msgID), m2.ID, m3.ID)
+
+		t.Run("conversation list", func(t *testing.T) {
+			// The conversation with Bob is now the most recently active
+			convs, err := r.DMs.ListConversations(ctx, alice.ID, repository.Page{Limit: 10})
+			must(t, err)
+			equalIDs(t, "ListConversations by activity", ids(convs, convID), withBob.ID, withCarol.ID)
+			conv := convs[0]
+			if last := conv.LastMessage; last == nil || last.ID != m3.ID || last.Content != edited || last.SenderID != alice.ID {
+				t.Fatalf("last message = %+v", conv.LastMessage)
+			}
+			if !conv.LastActivityAt.Equal(at(12)) || conv.UnreadCount != 1 || conv.Muted {
+				t.Fatalf("conversation = %+v", conv)
+			}
+			if convs[1].LastMessage != nil || !convs[1].LastActivityAt.Equal(at(2)) || convs[1].UnreadCount != 0 {
+				t.Fatalf("conversation without messages = %+v", convs[1])
+			}
+			key := &repository.PageKey{Time: conv.LastActivityAt, ID: conv.ID}
+			convs, _ = r.DMs.ListConversations(ctx, alice.ID, repository.Page{After: key, Limit: 10})
+			equalIDs(t, "ListConversations after the most active", ids(convs, convID), withCarol.ID)
+
+			if p, err := r.DMs.GetParticipant(ctx, withBob.ID, bob.ID); err != nil || p != nil {
+				t.Fatalf("GetParticipant before saving = %+v, %v", p, err)
+			}
+			unread := func(user *domain.User) int {
+				t.Helper()
+				convs, err := r.DMs.ListConversations(ctx, user.ID, repository.Page{Limit: 10})
+				must(t, err)
+				for _, c := range convs {
+					if c.ID == withBob.ID {
+						return c.UnreadCount
+					}
+				}
+				t.Fatal("conversation missing")
+				return 0
+			}
+			// m1 is deleted, so only m3 is unread
+			if n := unread(bob); n != 1 {
+				t.Fatalf("bob's unread count = %d", n)
+			}
+			readAt := at(12)
+			must(t, r.DMs.SaveParticipant(ctx, &domain.DMParticipant{ConversationID: withBob.ID, UserID: bob.ID, LastReadAt: &readAt, Muted: true}))
+			if n := unread(bob); n != 0 {
+				t.Fatalf("bob's unread count after reading = %d", n)
+			}
+			p, err := r.DMs.GetParticipant(ctx, withBob.ID, bob.ID)
+			must(t, err)
+			if p == nil || !p.LastReadAt.Equal(readAt) || !p.Muted || p.HiddenAt != nil {
+				t.Fatalf("GetParticipant = %+v", p)
+			}
+			convs, _ = r.DMs.ListConversations(ctx, bob.ID, repository.Page{Limit: 10})
+			if !convs[0].Muted {
+				t.Fatal("muted conversation listed as not muted")
+			}
+
+			// Hidden until a message arrives after hiding it
+			hiddenAt := at(3)
+			must(t, r.DMs.SaveParticipant(ctx, &domain.DMParticipant{ConversationID: withCarol.ID, UserID: alice.ID, HiddenAt: &hiddenAt}))
+			convs, _ = r.DMs.ListConversations(ctx, alice.ID, repository.Page{Limit: 10})
+			equalIDs(t, "ListConversations with one hidden", ids(convs, convID), withBob.ID)
+			content := "still there?"
+			must(t, r.DMs.CreateMessage(ctx, &domain.DMMessage{ID: uuid.New(), ConversationID: withCarol.ID, SenderID: carol.ID, Content: &content, CreatedAt: at(20)}))
+			convs, _ = r.DMs.ListConversations(ctx, alice.ID, repository.Page{Limit: 10})
+			equalIDs(t, "ListConversations after a new message", ids(convs, convID), withCarol.ID, withBob.ID)
+
+			if err := r.DMs.SaveParticipant(ctx, &domain.DMParticipant{ConversationID: uuid.New(), UserID: alice.ID}); err == nil {
+				t.Fatal("settings for a missing conversation accepted")
+			}
+		})
+	})
+}
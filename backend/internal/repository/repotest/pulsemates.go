@@ -0,0 +1,113 @@
+package repotest
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/vedran77/pulse/internal/domain"
+	"github.com/vedran77/pulse/internal/repository"
+)
+
+func testPulsemates(t *testing.T, r Repos) {
+	ctx := context.Background()
+	alice := newUser(t, r, "alice")
+	bob := newUser(t, r, "bob")
+	carol := newUser(t, r, "carol")
+
+	newRequest := func(from, to *domain.User, status string, createdAt int) *domain.PulsemateRequest {
+		t.Helper()
+		req := &domain.PulsemateRequest{ID: uuid.New(), SenderID: from.ID, ReceiverID: to.ID, Status: status, CreatedAt: at(createdAt)}
+		must(t, r.Pulsemates.CreateRequest(ctx, req))
+		return req
+	}
+	fromBob := newRequest(bob, alice, "pending", 1)
+	fromCarol := newRequest(carol, alice, "pending", 2)
+	newRequest(alice, carol, "rejected", 3)
+
+	if err := r.Pulsemates.CreateRequest(ctx, &domain.PulsemateRequest{ID: uuid.New(), SenderID: bob.ID, ReceiverID: alice.ID, Status: "pending", CreatedAt: base}); err == nil {
+		t.Fatal("duplicate request accepted")
+	}
+	if err := r.Pulsemates.CreateRequest(ctx, &domain.PulsemateRequest{ID: uuid.New(), SenderID: bob.ID, ReceiverID: bob.ID, Status: "pending", CreatedAt: base}); err == nil {
+		t.Fatal("request to self accepted")
+	}
+
+	got, err := r.Pulsemates.GetRequestByUsers(ctx, bob.ID, alice.ID)
+	must(t, err)
+	if got == nil || got.ID != fromBob.ID || got.Status != "pending" {
+		t.Fatalf("GetRequestByUsers = %+v", got)
+	}
+	if got, _ := r.Pulsemates.GetRequestByUsers(ctx, alice.ID, bob.ID); got != nil {
+		t.Fatal("GetRequestByUsers ignored the direction")
+	}
+	if got, _ := r.Pulsemates.GetRequestByID(ctx, fromCarol.ID); got == nil || got.SenderID != carol.ID {
+		t.Fatalf("GetRequestByID = %+v", got)
+	}
+
+	reqID := func(r domain.PulsemateRequest) uuid.UUID { return r.ID }
+	incoming, err := r.Pulsemates.ListIncomingRequests(ctx, alice.ID)
+	must(t, err)
+	equalIDs(t, "ListIncomingRequests", ids(incoming, reqID), fromCarol.ID, fromBob.ID)
+	if incoming[0].SenderUsername != "carol" || incoming[0].SenderDisplayName != "carol" {
+		t.Fatalf("incoming joined fields = %+v", incoming[0])
+	}
+	// Rejected requests aren't listed
+	outgoing, _ := r.Pulsemates.ListOutgoingRequests(ctx, alice.ID)
+	equalIDs(t, "ListOutgoingRequests(alice)", ids(outgoing, reqID))
+	outgoing, _ = r.Pulsemates.ListOutgoingRequests(ctx, bob.ID)
+	equalIDs(t, "ListOutgoingRequests(bob)", ids(outgoing, reqID), fromBob.ID)
+	if outgoing[0].ReceiverUsername != "alice" {
+		t.Fatalf("outgoing joined fields = %+v", outgoing[0])
+	}
+
+	must(t, r.Pulsemates.DeleteRequest(ctx, fromBob.ID))
+	if got, _ := r.Pulsemates.GetRequestByID(ctx, fromBob.ID); got != nil {
+		t.Fatal("request not deleted")
+	}
+
+	t.Run("pulsemates", func(t *testing.T) {
+		newPulsemate := func(a, b *domain.User, createdAt int) *domain.Pulsemate {
+			t.Helper()
+			u1, u2 := ordered(a, b)
+			pm := &domain.Pulsemate{ID: uuid.New(), User1ID: u1, User2ID: u2, CreatedAt: at(createdAt)}
+			must(t, r.Pulsemates.CreatePulsemate(ctx, pm))
+			return pm
+		}
+		withCarol := newPulsemate(alice, carol, 1)
+		withBob := newPulsemate(alice, bob, 2)
+
+		u1, u2 := ordered(alice, bob)
+		if err := r.Pulsemates.CreatePulsemate(ctx, &domain.Pulsemate{ID: uuid.New(), User1ID: u2, User2ID: u1, CreatedAt: base}); err == nil {
+			t.Fatal("pulsemate with unordered users accepted")
+		}
+		if got, _ := r.Pulsemates.GetPulsemateByUsers(ctx, u1, u2); got == nil || got.ID != withBob.ID {
+			t.Fatalf("GetPulsemateByUsers = %+v", got)
+		}
+
+		for _, pair := range [][2]*domain.User{{alice, bob}, {bob, alice}} {
+			if ok, _ := r.Pulsemates.ArePulsemates(ctx, pair[0].ID, pair[1].ID); !ok {
+				t.Fatalf("ArePulsemates(%s, %s) = false", pair[0].Username, pair[1].Username)
+			}
+		}
+		if ok, _ := r.Pulsemates.ArePulsemates(ctx, bob.ID, carol.ID); ok {
+			t.Fatal("ArePulsemates(bob, carol) = true")
+		}
+
+		pmID := func(p domain.Pulsemate) uuid.UUID { return p.ID }
+		list, err := r.Pulsemates.ListPulsemates(ctx, alice.ID, repository.Page{Limit: 10})
+		must(t, err)
+		// Newest first
+		equalIDs(t, "ListPulsemates", ids(list, pmID), withBob.ID, withCarol.ID)
+		if list[0].OtherUserID != bob.ID || list[0].OtherUsername != "bob" || list[0].OtherStatus != "offline" {
+			t.Fatalf("other user fields = %+v", list[0])
+		}
+		oldest := &repository.PageKey{Time: withCarol.CreatedAt, ID: withCarol.ID}
+		list, _ = r.Pulsemates.ListPulsemates(ctx, alice.ID, repository.Page{Before: oldest, Limit: 10})
+		equalIDs(t, "ListPulsemates before oldest", ids(list, pmID), withBob.ID)
+
+		must(t, r.Pulsemates.DeletePulsemate(ctx, u1, u2))
+		if ok, _ := r.Pulsemates.ArePulsemates(ctx, alice.ID, bob.ID); ok {
+			t.Fatal("pulsemate not deleted")
+		}
+	})
+}
@@ -0,0 +1,158 @@
+// Package repotest is a contract test suite for the repository interfaces.
+// It runs against every implementation, so the in-memory fakes used in
+// service tests are held to the same behavior as Postgres.
+package repotest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/vedran77/pulse/internal/domain"
+	"github.com/vedran77/pulse/internal/repository"
+)
+
+// Repos is one set of repositories sharing a store.
+type Repos struct {
+	Users      repository.UserRepository
+	Tokens     repository.VerificationTokenRepository
+	TwoFactor  repository.TwoFactorRepository
+	Identities repository.IdentityRepository
+	Workspaces repository.WorkspaceRepository
+	Channels   repository.ChannelRepository
+	Invites    repository.InviteRepository
+	Messages   repository.MessageRepository
+	Pulsemates repository.PulsemateRepository
+	DMs        repository.DMRepository
+	Saved      repository.SavedItemRepository
+	Scheduled  repository.ScheduledMessageRepository
+	Tx         repository.TxManager
+}
+
+// Run runs the contract tests. newRepos is called once per test and must
+// return repositories backed by an empty store.
+func Run(t *testing.T, newRepos func(t *testing.T) Repos) {
+	suites := []struct {
+		name string
+		fn   func(t *testing.T, r Repos)
+	}{
+		{"Users", testUsers},
+		{"Tokens", testTokens},
+		{"TwoFactor", testTwoFactor},
+		{"Identities", testIdentities},
+		{"Workspaces", testWorkspaces},
+		{"MemberSearch", testMemberSearch},
+		{"JoinRequests", testJoinRequests},
+		{"Channels", testChannels},
+		{"Invites", testInvites},
+		{"Messages", testMessages},
+		{"Pulsemates", testPulsemates},
+		{"DMs", testDMs},
+		{"SavedItems", testSavedItems},
+		{"ScheduledMessages", testScheduledMessages},
+		{"Tx", testTx},
+	}
+	for _, s := range suites {
+		t.Run(s.name, func(t *testing.T) {
+			s.fn(t, newRepos(t))
+		})
+	}
+}
+
+// base is a fixed point in the past with Postgres precision, so stored
+// timestamps compare equal and orderings are deterministic.
+var base = time.Now().Add(-24 * time.Hour).Truncate(time.Microsecond)
+
+// at returns base plus n minutes.
+func at(n int) time.Time {
+	return base.Add(time.Duration(n) * time.Minute)
+}
+
+func must(t *testing.T, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func newUser(t *testing.T, r Repos, name string) *domain.User {
+	t.Helper()
+	u := &domain.User{
+		ID:           uuid.New(),
+		Email:        name + "@example.com",
+		Username:     name,
+		DisplayName:  name,
+		PasswordHash: "hash",
+		Status:       "offline",
+		CreatedAt:    base,
+		UpdatedAt:    base,
+	}
+	must(t, r.Users.Create(context.Background(), u))
+	return u
+}
+
+func newWorkspace(t *testing.T, r Repos, name string, owner *domain.User, createdAt time.Time) *domain.Workspace {
+	t.Helper()
+	ws := &domain.Workspace{
+		ID:        uuid.New(),
+		Name:      name,
+		Slug:      name,
+		OwnerID:   owner.ID,
+		CreatedAt: createdAt,
+	}
+	must(t, r.Workspaces.Create(context.Background(), ws))
+	return ws
+}
+
+func addMember(t *testing.T, r Repos, ws *domain.Workspace, u *domain.User, role string, joinedAt time.Time) {
+	t.Helper()
+	must(t, r.Workspaces.AddMember(context.Background(), &domain.WorkspaceMember{
+		WorkspaceID: ws.ID,
+		UserID:      u.ID,
+		Role:        role,
+		JoinedAt:    joinedAt,
+	}))
+}
+
+func newChannel(t *testing.T, r Repos, ws *domain.Workspace, name string, creator *domain.User, createdAt time.Time) *domain.Channel {
+	t.Helper()
+	ch := &domain.Channel{
+		ID:          uuid.New(),
+		WorkspaceID: ws.ID,
+		Name:        name,
+		Type:        "public",
+		CreatedBy:   creator.ID,
+		CreatedAt:   createdAt,
+	}
+	must(t, r.Channels.Create(context.Background(), ch))
+	return ch
+}
+
+// ordered returns the two users' IDs in the order pair tables store them.
+func ordered(a, b *domain.User) (uuid.UUID, uuid.UUID) {
+	if a.ID.String() < b.ID.String() {
+		return a.ID, b.ID
+	}
+	return b.ID, a.ID
+}
+
+func ids[T any](items []T, id func(T) uuid.UUID) []uuid.UUID {
+	out := make([]uuid.UUID, len(items))
+	for i, item := range items {
+		out[i] = id(item)
+	}
+	return out
+}
+
+func equalIDs(t *testing.T, what string, got []uuid.UUID, want ...uuid.UUID) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("%s: got %d items, want %d", what, len(got), len(want))
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("%s: item %d is %s, want %s", what, i, got[i], want[i])
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package repotest
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/vedran77/pulse/internal/domain"
+)
+
+func testSavedItems(t *testing.T, r Repos) {
+	ctx := context.Background()
+	alice := newUser(t, r, "alice")
+	bob := newUser(t, r, "bob")
+	ws := newWorkspace(t, r, "acme", alice, base)
+	ch := newChannel(t, r, ws, "general", alice, base)
+
+	content := "remember me"
+	msg := &domain.Message{ID: uuid.New(), ChannelID: ch.ID, SenderID: alice.ID, Content: &content, Type: "text", CreatedAt: at(1)}
+	must(t, r.Messages.Create(ctx, msg))
+	u1, u2 := ordered(alice, bob)
+	conv := &domain.DMConversation{ID: uuid.New(), User1ID: u1, User2ID: u2, CreatedAt: base}
+	must(t, r.DMs.CreateConversation(ctx, conv))
+	dm := &domain.DMMessage{ID: uuid.New(), ConversationID: conv.ID, SenderID: bob.ID, Content: &content, CreatedAt: at(2)}
+	must(t, r.DMs.CreateMessage(ctx, dm))
+
+	remindAt, bobRemindAt := at(28), at(30)
+	saved := &domain.SavedItem{ID: uuid.New(), UserID: alice.ID, MessageID: &msg.ID, RemindAt: &remindAt, CreatedAt: at(3)}
+	must(t, r.Saved.Create(ctx, saved))
+	savedDM := &domain.SavedItem{ID: uuid.New(), UserID: alice.ID, DMMessageID: &dm.ID, CreatedAt: at(4)}
+	must(t, r.Saved.Create(ctx, savedDM))
+	bobs := &domain.SavedItem{ID: uuid.New(), UserID: bob.ID, MessageID: &msg.ID, RemindAt: &bobRemindAt, CreatedAt: at(5)}
+	must(t, r.Saved.Create(ctx, bobs))
+
+	if err := r.Saved.Create(ctx, &domain.SavedItem{ID: uuid.New(), UserID: alice.ID, MessageID: &msg.ID, CreatedAt: base}); err == nil {
+		t.Fatal("message saved twice")
+	}
+	if err := r.Saved.Create(ctx, &domain.SavedItem{ID: uuid.New(), UserID: bob.ID, MessageID: &msg.ID, DMMessageID: &dm.ID, CreatedAt: base}); err == nil {
+		t.Fatal("item with both a message and a DM accepted")
+	}
+	if err := r.Saved.Create(ctx, &domain.SavedItem{ID: uuid.New(), UserID: bob.ID, CreatedAt: base}); err == nil {
+		t.Fatal("item without a message accepted")
+	}
+
+	got, err := r.Saved.GetByID(ctx, saved.ID)
+	must(t, err)
+	if got == nil || got.MessageID == nil || *got.MessageID != msg.ID || got.DMMessageID != nil || !got.RemindAt.Equal(remindAt) || got.RemindedAt != nil {
+		t.Fatalf("GetByID = %+v", got)
+	}
+	if got, _ := r.Saved.GetByMessage(ctx, alice.ID, dm.ID); got == nil || got.ID != savedDM.ID {
+		t.Fatalf("GetByMessage(dm) = %+v", got)
+	}
+	if got, err := r.Saved.GetByMessage(ctx, bob.ID, dm.ID); got != nil || err != nil {
+		t.Fatalf("GetByMessage(unsaved) = %v, %v", got, err)
+	}
+
+	itemID := func(item domain.SavedItem) uuid.UUID { return item.ID }
+	items, err := r.Saved.ListByUser(ctx, alice.ID)
+	must(t, err)
+	equalIDs(t, "ListByUser", ids(items, itemID), savedDM.ID, saved.ID)
+
+	t.Run("reminders", func(t *testing.T) {
+		due, err := r.Saved.ListDueReminders(ctx, at(27), 10)
+		must(t, err)
+		equalIDs(t, "due too early", ids(due, itemID))
+		due, _ = r.Saved.ListDueReminders(ctx, at(30), 10)
+		equalIDs(t, "due", ids(due, itemID), saved.ID, bobs.ID)
+		due, _ = r.Saved.ListDueReminders(ctx, at(30), 1)
+		if len(due) != 1 {
+			t.Fatalf("ListDueReminders ignored the limit: %d items", len(due))
+		}
+
+		ok, err := r.Saved.MarkReminded(ctx, saved.ID, at(31))
+		must(t, err)
+		if !ok {
+			t.Fatal("MarkReminded = false")
+		}
+		if ok, _ := r.Saved.MarkReminded(ctx, saved.ID, at(32)); ok {
+			t.Fatal("reminder marked twice")
+		}
+		if ok, _ := r.Saved.MarkReminded(ctx, savedDM.ID, at(32)); ok {
+			t.Fatal("item without a reminder marked")
+		}
+		due, _ = r.Saved.ListDueReminders(ctx, at(40), 10)
+		equalIDs(t, "due after firing", ids(due, itemID), bobs.ID)
+
+		later := at(50)
+		must(t, r.Saved.SetReminder(ctx, saved.ID, &later))
+		got, _ := r.Saved.GetByID(ctx, saved.ID)
+		if !got.RemindAt.Equal(later) || got.RemindedAt != nil {
+			t.Fatalf("after SetReminder: %+v", got)
+		}
+		must(t, r.Saved.SetReminder(ctx, bobs.ID, nil))
+		due, _ = r.Saved.ListDueReminders(ctx, at(60), 10)
+		equalIDs(t, "due after rescheduling", ids(due, itemID), saved.ID)
+	})
+
+	must(t, r.Saved.Delete(ctx, savedDM.ID))
+	if got, _ := r.Saved.GetByID(ctx, savedDM.ID); got != nil {
+		t.Fatal("item still there after Delete")
+	}
+	must(t, r.Workspaces.Delete(ctx, ws.ID))
+	if got, _ := r.Saved.GetByID(ctx, saved.ID); got != nil {
+		t.Fatal("saved message survived its channel")
+	}
+}
@@ -0,0 +1,123 @@
+package repotest
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/vedran77/pulse/internal/domain"
+)
+
+func testScheduledMessages(t *testing.T, r Repos) {
+	ctx := context.Background()
+	alice := newUser(t, r, "alice")
+	bob := newUser(t, r, "bob")
+	ws := newWorkspace(t, r, "acme", alice, base)
+	ch := newChannel(t, r, ws, "general", alice, base)
+	u1, u2 := ordered(alice, bob)
+	conv := &domain.DMConversation{ID: uuid.New(), User1ID: u1, User2ID: u2, CreatedAt: base}
+	must(t, r.DMs.CreateConversation(ctx, conv))
+
+	schedule := func(channelID, conversationID *uuid.UUID, content string, sendAt int) *domain.ScheduledMessage {
+		t.Helper()
+		msg := &domain.ScheduledMessage{
+			ID: uuid.New(), UserID: alice.ID, ChannelID: channelID, ConversationID: conversationID,
+			Content: content, SendAt: at(sendAt), CreatedAt: base, UpdatedAt: base,
+		}
+		must(t, r.Scheduled.Create(ctx, msg))
+		return msg
+	}
+	second := schedule(&ch.ID, nil, "second", 20)
+	first := schedule(nil, &conv.ID, "first", 10)
+	third := schedule(&ch.ID, nil, "third", 30)
+
+	if err := r.Scheduled.Create(ctx, &domain.ScheduledMessage{ID: uuid.New(), UserID: alice.ID, ChannelID: &ch.ID, ConversationID: &conv.ID, Content: "both", SendAt: base, CreatedAt: base, UpdatedAt: base}); err == nil {
+		t.Fatal("message for a channel and a DM accepted")
+	}
+	missing := uuid.New()
+	if err := r.Scheduled.Create(ctx, &domain.ScheduledMessage{ID: uuid.New(), UserID: alice.ID, ChannelID: &missing, Content: "nowhere", SendAt: base, CreatedAt: base, UpdatedAt: base}); err == nil {
+		t.Fatal("message for a missing channel accepted")
+	}
+
+	got, err := r.Scheduled.GetByID(ctx, first.ID)
+	must(t, err)
+	if got == nil || got.ConversationID == nil || *got.ConversationID != conv.ID || got.ChannelID != nil || got.Content != "first" || !got.SendAt.Equal(at(10)) {
+		t.Fatalf("GetByID = %+v", got)
+	}
+	if got, err := r.Scheduled.GetByID(ctx, uuid.New()); got != nil || err != nil {
+		t.Fatalf("GetByID(missing) = %v, %v", got, err)
+	}
+
+	msgID := func(m domain.ScheduledMessage) uuid.UUID { return m.ID }
+	list, err := r.Scheduled.ListByUser(ctx, alice.ID)
+	must(t, err)
+	equalIDs(t, "ListByUser", ids(list, msgID), first.ID, second.ID, third.ID)
+	if list, _ := r.Scheduled.ListByUser(ctx, bob.ID); len(list) != 0 {
+		t.Fatalf("ListByUser(bob) = %+v", list)
+	}
+
+	claim := func(now int) *domain.ScheduledMessage {
+		t.Helper()
+		var claimed *domain.ScheduledMessage
+		must(t, r.Tx.WithinTx(ctx, func(ctx context.Context) error {
+			var err error
+			claimed, err = r.Scheduled.ClaimDue(ctx, at(now))
+			return err
+		}))
+		return claimed
+	}
+	if got := claim(5); got != nil {
+		t.Fatalf("ClaimDue before anything is due = %+v", got)
+	}
+	if got := claim(25); got == nil || got.ID != first.ID {
+		t.Fatalf("ClaimDue = %+v, want the earliest", got)
+	}
+
+	must(t, r.Scheduled.MarkFailed(ctx, first.ID, "no access", at(26)))
+	got, _ = r.Scheduled.GetByID(ctx, first.ID)
+	if got.FailedAt == nil || !got.FailedAt.Equal(at(26)) || got.Error == nil || *got.Error != "no access" {
+		t.Fatalf("after MarkFailed: %+v", got)
+	}
+	if got := claim(25); got == nil || got.ID != second.ID {
+		t.Fatalf("ClaimDue after a failure = %+v, want the next one", got)
+	}
+
+	must(t, r.Scheduled.Retry(ctx, first.ID, at(35)))
+	must(t, r.Scheduled.Retry(ctx, first.ID, at(45)))
+	got, _ = r.Scheduled.GetByID(ctx, first.ID)
+	if got.Attempts != 2 || !got.SendAt.Equal(at(45)) {
+		t.Fatalf("after Retry: %+v", got)
+	}
+
+	// Editing a failed message retries it
+	got.Content = "first, edited"
+	got.SendAt = at(40)
+	got.UpdatedAt = at(27)
+	if ok, err := r.Scheduled.Update(ctx, got); err != nil || !ok {
+		t.Fatalf("Update = %v, %v", ok, err)
+	}
+	got, _ = r.Scheduled.GetByID(ctx, first.ID)
+	if got.Content != "first, edited" || !got.SendAt.Equal(at(40)) || got.FailedAt != nil || got.Error != nil || got.Attempts != 0 || !got.UpdatedAt.Equal(at(27)) {
+		t.Fatalf("after Update: %+v", got)
+	}
+	list, _ = r.Scheduled.ListByUser(ctx, alice.ID)
+	equalIDs(t, "ListByUser after Update", ids(list, msgID), second.ID, third.ID, first.ID)
+
+	if ok, err := r.Scheduled.Delete(ctx, second.ID); err != nil || !ok {
+		t.Fatalf("Delete = %v, %v", ok, err)
+	}
+	if got := claim(25); got != nil {
+		t.Fatalf("ClaimDue after Delete = %+v", got)
+	}
+	// A message sent or cancelled meanwhile matches nothing
+	if ok, _ := r.Scheduled.Delete(ctx, second.ID); ok {
+		t.Fatal("Delete of a deleted message = true")
+	}
+	if ok, _ := r.Scheduled.Update(ctx, &domain.ScheduledMessage{ID: second.ID, Content: "gone", SendAt: at(50), UpdatedAt: at(28)}); ok {
+		t.Fatal("Update of a deleted message = true")
+	}
+
+	must(t, r.Workspaces.Delete(ctx, ws.ID))
+	list, _ = r.Scheduled.ListByUser(ctx, alice.ID)
+	equalIDs(t, "ListByUser after deleting the channel", ids(list, msgID), first.ID)
+}
@@ -0,0 +1,94 @@
+package repotest
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/vedran77/pulse/internal/domain"
+)
+
+func testTx(t *testing.T, r Repos) {
+	ctx := context.Background()
+	alice := newUser(t, r, "alice")
+	errAbort := errors.New("abort")
+
+	// createWorkspace writes two rows, like WorkspaceService.Create
+	createWorkspace := func(ctx context.Context, slug string) error {
+		ws := &domain.Workspace{ID: uuid.New(), Name: slug, Slug: slug, OwnerID: alice.ID, CreatedAt: base}
+		if err := r.Workspaces.Create(ctx, ws); err != nil {
+			return err
+		}
+		return r.Workspaces.AddMember(ctx, &domain.WorkspaceMember{WorkspaceID: ws.ID, UserID: alice.ID, Role: "owner", JoinedAt: base})
+	}
+	workspaces := func() int {
+		t.Helper()
+		list, err := r.Workspaces.ListByUser(ctx, alice.ID)
+		must(t, err)
+		return len(list)
+	}
+
+	t.Run("commit", func(t *testing.T) {
+		must(t, r.Tx.WithinTx(ctx, func(ctx context.Context) error {
+			return createWorkspace(ctx, "committed")
+		}))
+		if ws, _ := r.Workspaces.GetBySlug(ctx, "committed"); ws == nil {
+			t.Fatal("workspace not committed")
+		}
+		if n := workspaces(); n != 1 {
+			t.Fatalf("%d memberships, want 1", n)
+		}
+	})
+
+	t.Run("rollback", func(t *testing.T) {
+		err := r.Tx.WithinTx(ctx, func(ctx context.Context) error {
+			if err := createWorkspace(ctx, "rolled-back"); err != nil {
+				return err
+			}
+			return errAbort
+		})
+		if !errors.Is(err, errAbort) {
+			t.Fatalf("WithinTx = %v, want the error from fn", err)
+		}
+		if ws, _ := r.Workspaces.GetBySlug(ctx, "rolled-back"); ws != nil {
+			t.Fatal("workspace survived the rollback")
+		}
+		if n := workspaces(); n != 1 {
+			t.Fatalf("%d memberships after rollback, want 1", n)
+		}
+	})
+
+	t.Run("failed write rolls back earlier ones", func(t *testing.T) {
+		err := r.Tx.WithinTx(ctx, func(ctx context.Context) error {
+			if err := createWorkspace(ctx, "partial"); err != nil {
+				return err
+			}
+			// Duplicate slug
+			return createWorkspace(ctx, "committed")
+		})
+		if err == nil {
+			t.Fatal("duplicate slug accepted")
+		}
+		if ws, _ := r.Workspaces.GetBySlug(ctx, "partial"); ws != nil {
+			t.Fatal("workspace survived the rollback")
+		}
+	})
+
+	t.Run("nested calls join the outer transaction", func(t *testing.T) {
+		err := r.Tx.WithinTx(ctx, func(ctx context.Context) error {
+			if err := r.Tx.WithinTx(ctx, func(ctx context.Context) error {
+				return createWorkspace(ctx, "nested")
+			}); err != nil {
+				return err
+			}
+			return errAbort
+		})
+		if !errors.Is(err, errAbort) {
+			t.Fatalf("WithinTx = %v, want the error from fn", err)
+		}
+		if ws, _ := r.Workspaces.GetBySlug(ctx, "nested"); ws != nil {
+			t.Fatal("inner work committed despite the outer rollback")
+		}
+	})
+}
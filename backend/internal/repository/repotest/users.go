@@ -0,0 +1,369 @@
+package repotest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/vedran77/pulse/internal/domain"
+)
+
+func testUsers(t *testing.T, r Repos) {
+	ctx := context.Background()
+	alice := newUser(t, r, "alice")
+
+	got, err := r.Users.GetByID(ctx, alice.ID)
+	must(t, err)
+	if got == nil || got.Email != alice.Email || got.Username != "alice" || !got.CreatedAt.Equal(base) {
+		t.Fatalf("GetByID = %+v", got)
+	}
+	if got.TokenVersion != 0 || got.TwoFactorEnabled || got.EmailVerifiedAt != nil {
+		t.Fatalf("new user should have defaults, got %+v", got)
+	}
+	if got, _ := r.Users.GetByEmail(ctx, "alice@example.com"); got == nil || got.ID != alice.ID {
+		t.Fatalf("GetByEmail = %+v", got)
+	}
+	if got, _ := r.Users.GetByUsername(ctx, "alice"); got == nil || got.ID != alice.ID {
+		t.Fatalf("GetByUsername = %+v", got)
+	}
+
+	t.Run("not found", func(t *testing.T) {
+		if got, err := r.Users.GetByID(ctx, uuid.New()); got != nil || err != nil {
+			t.Fatalf("GetByID = %v, %v; want nil, nil", got, err)
+		}
+		if got, err := r.Users.GetByEmail(ctx, "nobody@example.com"); got != nil || err != nil {
+			t.Fatalf("GetByEmail = %v, %v; want nil, nil", got, err)
+		}
+	})
+
+	t.Run("unique email and username", func(t *testing.T) {
+		dup := *alice
+		dup.ID = uuid.New()
+		dup.Username = "alice2"
+		if err := r.Users.Create(ctx, &dup); err == nil {
+			t.Fatal("duplicate email accepted")
+		}
+		dup.Email = "alice2@example.com"
+		dup.Username = "alice"
+		if err := r.Users.Create(ctx, &dup); err == nil {
+			t.Fatal("duplicate username accepted")
+		}
+	})
+
+	t.Run("mark email verified", func(t *testing.T) {
+		must(t, r.Users.MarkEmailVerified(ctx, alice.ID))
+		got, _ := r.Users.GetByID(ctx, alice.ID)
+		if got.EmailVerifiedAt == nil {
+			t.Fatal("EmailVerifiedAt not set")
+		}
+	})
+
+	t.Run("update password bumps token version", func(t *testing.T) {
+		must(t, r.Users.UpdatePassword(ctx, alice.ID, "new-hash"))
+		got, _ := r.Users.GetByID(ctx, alice.ID)
+		if got.PasswordHash != "new-hash" || got.TokenVersion != 1 {
+			t.Fatalf("got hash %q, version %d", got.PasswordHash, got.TokenVersion)
+		}
+	})
+
+	t.Run("failed logins", func(t *testing.T) {
+		bob := newUser(t, r, "bob")
+		for i := 1; i <= 2; i++ {
+			locked, err := r.Users.RecordFailedLogin(ctx, bob.ID, 3, time.Minute)
+			must(t, err)
+			if locked != nil {
+				t.Fatalf("locked after %d attempts", i)
+			}
+		}
+		got, _ := r.Users.GetByID(ctx, bob.ID)
+		if got.FailedLoginAttempts != 2 {
+			t.Fatalf("FailedLoginAttempts = %d, want 2", got.FailedLoginAttempts)
+		}
+
+		locked, err := r.Users.RecordFailedLogin(ctx, bob.ID, 3, time.Minute)
+		must(t, err)
+		if locked == nil || !locked.After(time.Now()) {
+			t.Fatalf("lock expiry = %v, want in the future", locked)
+		}
+		got, _ = r.Users.GetByID(ctx, bob.ID)
+		if got.FailedLoginAttempts != 0 || got.LockedUntil == nil || !got.LockedUntil.Equal(*locked) {
+			t.Fatalf("after lock: attempts %d, locked until %v", got.FailedLoginAttempts, got.LockedUntil)
+		}
+
+		must(t, r.Users.ResetFailedLogins(ctx, bob.ID))
+		got, _ = r.Users.GetByID(ctx, bob.ID)
+		if got.FailedLoginAttempts != 0 || got.LockedUntil != nil {
+			t.Fatalf("after reset: attempts %d, locked until %v", got.FailedLoginAttempts, got.LockedUntil)
+		}
+
+		if _, err := r.Users.RecordFailedLogin(ctx, uuid.New(), 3, time.Minute); err == nil {
+			t.Fatal("RecordFailedLogin for unknown user should fail")
+		}
+	})
+
+	t.Run("profile", func(t *testing.T) {
+		carol := newUser(t, r, "carol")
+		carol.Username = "carol_b"
+		carol.DisplayName = "Carol B"
+		must(t, r.Users.UpdateProfile(ctx, carol))
+		avatar := "https://cdn.example.com/carol.png"
+		must(t, r.Users.SetAvatarURL(ctx, carol.ID, &avatar))
+		got, _ := r.Users.GetByUsername(ctx, "carol_b")
+		if got == nil || got.DisplayName != "Carol B" || got.AvatarURL == nil || *got.AvatarURL != avatar {
+			t.Fatalf("after UpdateProfile: %+v", got)
+		}
+		carol.Username = "alice"
+		if err := r.Users.UpdateProfile(ctx, carol); err == nil {
+			t.Fatal("duplicate username accepted")
+		}
+		must(t, r.Users.SetAvatarURL(ctx, carol.ID, nil))
+		if got, _ := r.Users.GetByID(ctx, carol.ID); got.AvatarURL != nil {
+			t.Fatalf("avatar not cleared: %v", *got.AvatarURL)
+		}
+	})
+
+	t.Run("email change", func(t *testing.T) {
+		dave := newUser(t, r, "dave")
+		// Confirming without a pending address is a no-op
+		must(t, r.Users.ConfirmEmailChange(ctx, dave.ID))
+		taken := "alice@example.com"
+		must(t, r.Users.SetPendingEmail(ctx, dave.ID, &taken))
+		if err := r.Users.ConfirmEmailChange(ctx, dave.ID); err == nil {
+			t.Fatal("changed to an address that's taken")
+		}
+		next := "dave@new.example.com"
+		must(t, r.Users.SetPendingEmail(ctx, dave.ID, &next))
+		must(t, r.Users.ConfirmEmailChange(ctx, dave.ID))
+		got, _ := r.Users.GetByEmail(ctx, next)
+		if got == nil || got.ID != dave.ID || got.PendingEmail != nil || got.EmailVerifiedAt == nil {
+			t.Fatalf("after ConfirmEmailChange: %+v", got)
+		}
+	})
+
+	t.Run("anonymize", func(t *testing.T) {
+		erin := newUser(t, r, "erin")
+		ws := newWorkspace(t, r, "erin-ws", alice, at(1))
+		addMember(t, r, ws, erin, "member", at(2))
+		ch := newChannel(t, r, ws, "general", alice, at(2))
+		content := "hello"
+		msg := &domain.Message{ID: uuid.New(), ChannelID: ch.ID, SenderID: erin.ID, Content: &content, Type: "text", CreatedAt: at(3)}
+		must(t, r.Messages.Create(ctx, msg))
+		must(t, r.Tokens.Create(ctx, &domain.VerificationToken{
+			ID: uuid.New(), UserID: erin.ID, Purpose: domain.TokenPurposeVerifyEmail, TokenHash: "erin", ExpiresAt: at(60), CreatedAt: base,
+		}))
+
+		must(t, r.Users.Anonymize(ctx, erin.ID, at(10)))
+
+		got, _ := r.Users.GetByID(ctx, erin.ID)
+		if got == nil || got.DeletedAt == nil || !got.DeletedAt.Equal(at(10)) || got.DisplayName != "Deleted user" ||
+			got.PasswordHash != "" || got.TokenVersion != 1 || got.Email == erin.Email || got.Username == "erin" {
+			t.Fatalf("after Anonymize: %+v", got)
+		}
+		if got, _ := r.Users.GetByEmail(ctx, erin.Email); got != nil {
+			t.Fatal("old email still finds the user")
+		}
+		if m, _ := r.Workspaces.GetMember(ctx, ws.ID, erin.ID); m != nil {
+			t.Fatal("workspace membership kept")
+		}
+		if tok, _ := r.Tokens.GetByHash(ctx, "erin"); tok != nil {
+			t.Fatal("tokens kept")
+		}
+		kept, _ := r.Messages.GetByID(ctx, msg.ID)
+		if kept == nil || kept.SenderID != erin.ID || kept.SenderDisplayName != "Deleted user" {
+			t.Fatalf("message after Anonymize: %+v", kept)
+		}
+	})
+}
+
+func testTokens(t *testing.T, r Repos) {
+	ctx := context.Background()
+	alice := newUser(t, r, "alice")
+
+	newToken := func(hash, purpose string) *domain.VerificationToken {
+		t.Helper()
+		tok := &domain.VerificationToken{
+			ID:        uuid.New(),
+			UserID:    alice.ID,
+			Purpose:   purpose,
+			TokenHash: hash,
+			ExpiresAt: at(60),
+			CreatedAt: base,
+		}
+		must(t, r.Tokens.Create(ctx, tok))
+		return tok
+	}
+	verify := newToken("h1", domain.TokenPurposeVerifyEmail)
+	reset1 := newToken("h2", domain.TokenPurposeResetPassword)
+	reset2 := newToken("h3", domain.TokenPurposeResetPassword)
+
+	got, err := r.Tokens.GetByHash(ctx, "h1")
+	must(t, err)
+	if got == nil || got.ID != verify.ID || got.UsedAt != nil || !got.ExpiresAt.Equal(at(60)) {
+		t.Fatalf("GetByHash = %+v", got)
+	}
+	if got, err := r.Tokens.GetByHash(ctx, "missing"); got != nil || err != nil {
+		t.Fatalf("GetByHash(missing) = %v, %v", got, err)
+	}
+	if err := r.Tokens.Create(ctx, &domain.VerificationToken{
+		ID: uuid.New(), UserID: alice.ID, Purpose: domain.TokenPurposeVerifyEmail, TokenHash: "h1", ExpiresAt: at(60),
+	}); err == nil {
+		t.Fatal("duplicate token hash accepted")
+	}
+
+	ok, err := r.Tokens.Consume(ctx, verify.ID)
+	must(t, err)
+	if !ok {
+		t.Fatal("first Consume should succeed")
+	}
+	if ok, _ := r.Tokens.Consume(ctx, verify.ID); ok {
+		t.Fatal("second Consume should fail")
+	}
+
+	must(t, r.Tokens.InvalidateForUser(ctx, alice.ID, domain.TokenPurposeResetPassword))
+	for _, tok := range []*domain.VerificationToken{reset1, reset2} {
+		if ok, _ := r.Tokens.Consume(ctx, tok.ID); ok {
+			t.Fatalf("token %s usable after InvalidateForUser", tok.TokenHash)
+		}
+	}
+}
+
+func testTwoFactor(t *testing.T, r Repos) {
+	ctx := context.Background()
+	alice := newUser(t, r, "alice")
+
+	if got, err := r.TwoFactor.Get(ctx, alice.ID); got != nil || err != nil {
+		t.Fatalf("Get before enrollment = %v, %v", got, err)
+	}
+	must(t, r.TwoFactor.Upsert(ctx, &domain.TwoFactor{UserID: alice.ID, Secret: []byte("s1"), CreatedAt: base}))
+	must(t, r.TwoFactor.Enable(ctx, alice.ID, []string{"c1", "c2"}))
+
+	tf, _ := r.TwoFactor.Get(ctx, alice.ID)
+	if tf == nil || tf.ConfirmedAt == nil || string(tf.Secret) != "s1" {
+		t.Fatalf("after Enable: %+v", tf)
+	}
+	if u, _ := r.Users.GetByID(ctx, alice.ID); !u.TwoFactorEnabled {
+		t.Fatal("Enable should set users.two_factor_enabled")
+	}
+
+	t.Run("steps can't be replayed", func(t *testing.T) {
+		if ok, _ := r.TwoFactor.UseStep(ctx, alice.ID, 10); !ok {
+			t.Fatal("UseStep(10) should succeed")
+		}
+		if ok, _ := r.TwoFactor.UseStep(ctx, alice.ID, 10); ok {
+			t.Fatal("UseStep(10) replayed")
+		}
+		if ok, _ := r.TwoFactor.UseStep(ctx, alice.ID, 9); ok {
+			t.Fatal("UseStep(9) accepted after 10")
+		}
+	})
+
+	t.Run("recovery codes are single use", func(t *testing.T) {
+		if ok, _ := r.TwoFactor.UseRecoveryCode(ctx, alice.ID, "c1"); !ok {
+			t.Fatal("first use of c1 should succeed")
+		}
+		if ok, _ := r.TwoFactor.UseRecoveryCode(ctx, alice.ID, "c1"); ok {
+			t.Fatal("c1 used twice")
+		}
+		must(t, r.TwoFactor.ReplaceRecoveryCodes(ctx, alice.ID, []string{"c3"}))
+		if ok, _ := r.TwoFactor.UseRecoveryCode(ctx, alice.ID, "c2"); ok {
+			t.Fatal("replaced code c2 still usable")
+		}
+		if ok, _ := r.TwoFactor.UseRecoveryCode(ctx, alice.ID, "c3"); !ok {
+			t.Fatal("new code c3 should be usable")
+		}
+	})
+
+	t.Run("upsert resets the enrollment", func(t *testing.T) {
+		must(t, r.TwoFactor.Upsert(ctx, &domain.TwoFactor{UserID: alice.ID, Secret: []byte("s2"), CreatedAt: at(1)}))
+		tf, _ := r.TwoFactor.Get(ctx, alice.ID)
+		if tf.ConfirmedAt != nil || tf.LastUsedStep != 0 || string(tf.Secret) != "s2" {
+			t.Fatalf("after re-Upsert: %+v", tf)
+		}
+	})
+
+	t.Run("disable", func(t *testing.T) {
+		must(t, r.TwoFactor.Disable(ctx, alice.ID))
+		if tf, _ := r.TwoFactor.Get(ctx, alice.ID); tf != nil {
+			t.Fatal("enrollment not removed")
+		}
+		if u, _ := r.Users.GetByID(ctx, alice.ID); u.TwoFactorEnabled {
+			t.Fatal("Disable should clear users.two_factor_enabled")
+		}
+		if ok, _ := r.TwoFactor.UseRecoveryCode(ctx, alice.ID, "c3"); ok {
+			t.Fatal("recovery code usable after Disable")
+		}
+	})
+}
+
+func testIdentities(t *testing.T, r Repos) {
+	ctx := context.Background()
+	alice := newUser(t, r, "alice")
+
+	if has, _ := r.Identities.HasIdentity(ctx, alice.ID); has {
+		t.Fatal("HasIdentity before linking")
+	}
+	id := &domain.UserIdentity{
+		ID:        uuid.New(),
+		UserID:    alice.ID,
+		Issuer:    "https://idp.example.com",
+		Subject:   "sub-1",
+		Email:     alice.Email,
+		CreatedAt: base,
+	}
+	must(t, r.Identities.Create(ctx, id))
+	dup := *id
+	dup.ID = uuid.New()
+	if err := r.Identities.Create(ctx, &dup); err == nil {
+		t.Fatal("duplicate issuer and subject accepted")
+	}
+
+	got, err := r.Identities.GetBySubject(ctx, id.Issuer, id.Subject)
+	must(t, err)
+	if got == nil || got.UserID != alice.ID || got.LastLoginAt != nil {
+		t.Fatalf("GetBySubject = %+v", got)
+	}
+	if got, _ := r.Identities.GetBySubject(ctx, id.Issuer, "other"); got != nil {
+		t.Fatal("GetBySubject matched the wrong subject")
+	}
+	if has, _ := r.Identities.HasIdentity(ctx, alice.ID); !has {
+		t.Fatal("HasIdentity after linking")
+	}
+	must(t, r.Identities.TouchLogin(ctx, id.ID))
+	if got, _ := r.Identities.GetBySubject(ctx, id.Issuer, id.Subject); got.LastLoginAt == nil {
+		t.Fatal("TouchLogin didn't set LastLoginAt")
+	}
+
+	t.Run("requires SSO", func(t *testing.T) {
+		ws := newWorkspace(t, r, "acme", alice, base)
+		addMember(t, r, ws, alice, "owner", base)
+		if req, _ := r.Identities.RequiresSSO(ctx, alice.ID); req {
+			t.Fatal("RequiresSSO without a policy")
+		}
+		ws.RequireSSO = true
+		must(t, r.Workspaces.Update(ctx, ws))
+		if req, _ := r.Identities.RequiresSSO(ctx, alice.ID); !req {
+			t.Fatal("RequiresSSO should follow workspace membership")
+		}
+	})
+
+	t.Run("login state", func(t *testing.T) {
+		stale := &domain.OIDCLoginState{StateHash: "stale", CodeVerifier: "v", Nonce: "n", ExpiresAt: time.Now().Add(-time.Minute), CreatedAt: base}
+		must(t, r.Identities.CreateLoginState(ctx, stale))
+		fresh := &domain.OIDCLoginState{StateHash: "fresh", CodeVerifier: "v", Nonce: "n", ExpiresAt: time.Now().Add(time.Minute), CreatedAt: base}
+		must(t, r.Identities.CreateLoginState(ctx, fresh))
+
+		// Creating a state cleans up expired ones
+		if got, _ := r.Identities.ConsumeLoginState(ctx, "stale"); got != nil {
+			t.Fatal("expired state not cleaned up")
+		}
+		got, err := r.Identities.ConsumeLoginState(ctx, "fresh")
+		must(t, err)
+		if got == nil || got.CodeVerifier != "v" || got.Nonce != "n" {
+			t.Fatalf("ConsumeLoginState = %+v", got)
+		}
+		if got, _ := r.Identities.ConsumeLoginState(ctx, "fresh"); got != nil {
+			t.Fatal("state consumed twice")
+		}
+	})
+}
@@ -0,0 +1,373 @@
+package repotest
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/vedran77/pulse/internal/domain"
+	"github.com/vedran77/pulse/internal/repository"
+)
+
+func testWorkspaces(t *testing.T, r Repos) {
+	ctx := context.Background()
+	alice := newUser(t, r, "alice")
+	bob := newUser(t, r, "bob")
+
+	older := newWorkspace(t, r, "older", alice, at(1))
+	newer := newWorkspace(t, r, "newer", alice, at(2))
+	addMember(t, r, older, alice, "owner", at(1))
+	addMember(t, r, newer, alice, "owner", at(2))
+	addMember(t, r, older, bob, "member", at(3))
+
+	got, err := r.Workspaces.GetByID(ctx, older.ID)
+	must(t, err)
+	if got == nil || got.Slug != "older" || got.OwnerID != alice.ID || got.JoinRequiresApproval || got.RequireTwoFactor || got.RequireSSO {
+		t.Fatalf("GetByID = %+v", got)
+	}
+	if got, _ := r.Workspaces.GetBySlug(ctx, "newer"); got == nil || got.ID != newer.ID {
+		t.Fatalf("GetBySlug = %+v", got)
+	}
+	if got, err := r.Workspaces.GetBySlug(ctx, "missing"); got != nil || err != nil {
+		t.Fatalf("GetBySlug(missing) = %v, %v", got, err)
+	}
+
+	dup := *older
+	dup.ID = uuid.New()
+	if err := r.Workspaces.Create(ctx, &dup); err == nil {
+		t.Fatal("duplicate slug accepted")
+	}
+	if err := r.Workspaces.AddMember(ctx, &domain.WorkspaceMember{WorkspaceID: older.ID, UserID: bob.ID, Role: "member", JoinedAt: at(4)}); err == nil {
+		t.Fatal("duplicate member accepted")
+	}
+
+	list, err := r.Workspaces.ListByUser(ctx, alice.ID)
+	must(t, err)
+	equalIDs(t, "ListByUser", ids(list, func(w domain.Workspace) uuid.UUID { return w.ID }), newer.ID, older.ID)
+
+	memberID := func(m domain.WorkspaceMember) uuid.UUID { return m.UserID }
+	members, err := r.Workspaces.ListMembers(ctx, older.ID, repository.Page{Limit: 10})
+	must(t, err)
+	equalIDs(t, "ListMembers", ids(members, memberID), alice.ID, bob.ID)
+	if members[1].Username != "bob" || members[1].DisplayName != "bob" || members[1].Role != "member" {
+		t.Fatalf("member joined fields = %+v", members[1])
+	}
+	last := &repository.PageKey{Time: members[1].JoinedAt, ID: bob.ID}
+	members, _ = r.Workspaces.ListMembers(ctx, older.ID, repository.Page{Before: last, Limit: 10})
+	equalIDs(t, "ListMembers before bob", ids(members, memberID), alice.ID)
+
+	t.Run("update", func(t *testing.T) {
+		desc := "Older workspace"
+		older.Name = "Older"
+		older.Description = &desc
+		older.JoinRequiresApproval = true
+		older.RequireTwoFactor = true
+		must(t, r.Workspaces.Update(ctx, older))
+		got, _ := r.Workspaces.GetByID(ctx, older.ID)
+		if got.Name != "Older" || got.Description == nil || *got.Description != desc || !got.JoinRequiresApproval || !got.RequireTwoFactor || got.RequireSSO {
+			t.Fatalf("after Update: %+v", got)
+		}
+	})
+
+	t.Run("members", func(t *testing.T) {
+		m, err := r.Workspaces.GetMember(ctx, older.ID, bob.ID)
+		must(t, err)
+		if m == nil || m.Role != "member" || !m.JoinedAt.Equal(at(3)) {
+			t.Fatalf("GetMember = %+v", m)
+		}
+		must(t, r.Workspaces.RemoveMember(ctx, older.ID, bob.ID))
+		if m, err := r.Workspaces.GetMember(ctx, older.ID, bob.ID); m != nil || err != nil {
+			t.Fatalf("GetMember after remove = %v, %v", m, err)
+		}
+	})
+
+	t.Run("allowed domains", func(t *testing.T) {
+		must(t, r.Workspaces.SetAllowedDomains(ctx, older.ID, []string{"b.com", "a.com", "a.com"}))
+		domains, err := r.Workspaces.ListAllowedDomains(ctx, older.ID)
+		must(t, err)
+		if len(domains) != 2 || domains[0] != "a.com" || domains[1] != "b.com" {
+			t.Fatalf("ListAllowedDomains = %v", domains)
+		}
+		must(t, r.Workspaces.SetAllowedDomains(ctx, older.ID, nil))
+		if domains, _ := r.Workspaces.ListAllowedDomains(ctx, older.ID); len(domains) != 0 {
+			t.Fatalf("domains not cleared: %v", domains)
+		}
+	})
+
+	t.Run("ownership", func(t *testing.T) {
+		addMember(t, r, older, bob, "admin", at(4))
+		must(t, r.Workspaces.SetOwner(ctx, older.ID, bob.ID))
+		must(t, r.Workspaces.UpdateMemberRole(ctx, older.ID, bob.ID, "owner"))
+		if got, _ := r.Workspaces.GetByID(ctx, older.ID); got.OwnerID != bob.ID {
+			t.Fatalf("OwnerID = %v", got.OwnerID)
+		}
+		if m, _ := r.Workspaces.GetMember(ctx, older.ID, bob.ID); m.Role != "owner" {
+			t.Fatalf("role = %q", m.Role)
+		}
+	})
+
+	t.Run("soft delete", func(t *testing.T) {
+		gone := newWorkspace(t, r, "gone", alice, at(5))
+		addMember(t, r, gone, alice, "owner", at(5))
+		must(t, r.Workspaces.SetAllowedDomains(ctx, gone.ID, []string{"gone.com"}))
+		secret := newChannel(t, r, gone, "secret", alice, at(6))
+		must(t, r.Workspaces.SoftDelete(ctx, gone.ID, at(10)))
+
+		if got, err := r.Workspaces.GetByID(ctx, gone.ID); got != nil || err != nil {
+			t.Fatalf("GetByID(deleted) = %v, %v", got, err)
+		}
+		if m, _ := r.Workspaces.GetMember(ctx, gone.ID, alice.ID); m != nil {
+			t.Fatal("GetMember found a member of a deleted workspace")
+		}
+		if ch, err := r.Channels.GetByID(ctx, secret.ID); ch != nil || err != nil {
+			t.Fatalf("Channels.GetByID in a deleted workspace = %v, %v", ch, err)
+		}
+		if got, _ := r.Workspaces.GetBySlug(ctx, "gone"); got == nil {
+			t.Fatal("deleted workspace's slug isn't reserved")
+		}
+		if list, _ := r.Workspaces.ListDiscoverable(ctx, bob.ID, "gone.com"); len(list) != 0 {
+			t.Fatalf("deleted workspace is discoverable: %+v", list)
+		}
+		got, err := r.Workspaces.GetDeletedByID(ctx, gone.ID)
+		must(t, err)
+		if got == nil || got.DeletedAt == nil || !got.DeletedAt.Equal(at(10)) {
+			t.Fatalf("GetDeletedByID = %+v", got)
+		}
+		wsID := func(w domain.Workspace) uuid.UUID { return w.ID }
+		list, err := r.Workspaces.ListByUser(ctx, alice.ID)
+		must(t, err)
+		equalIDs(t, "ListByUser after soft delete", ids(list, wsID), newer.ID, older.ID)
+		list, err = r.Workspaces.ListDeletedByOwner(ctx, alice.ID)
+		must(t, err)
+		equalIDs(t, "ListDeletedByOwner", ids(list, wsID), gone.ID)
+		list, err = r.Workspaces.ListDeletedBefore(ctx, at(11), 10)
+		must(t, err)
+		equalIDs(t, "ListDeletedBefore", ids(list, wsID), gone.ID)
+		if list, _ := r.Workspaces.ListDeletedBefore(ctx, at(10), 10); len(list) != 0 {
+			t.Fatalf("ListDeletedBefore(deleted_at) = %+v", list)
+		}
+
+		must(t, r.Workspaces.Restore(ctx, gone.ID))
+		if got, _ := r.Workspaces.GetByID(ctx, gone.ID); got == nil || got.DeletedAt != nil {
+			t.Fatalf("GetByID after Restore = %+v", got)
+		}
+		if m, _ := r.Workspaces.GetMember(ctx, gone.ID, alice.ID); m == nil {
+			t.Fatal("members not back after Restore")
+		}
+		if ch, _ := r.Channels.GetByID(ctx, secret.ID); ch == nil {
+			t.Fatal("channels not back after Restore")
+		}
+		must(t, r.Workspaces.Delete(ctx, gone.ID))
+	})
+
+	t.Run("delete cascades", func(t *testing.T) {
+		ch := newChannel(t, r, newer, "general", alice, at(5))
+		must(t, r.Workspaces.SetAllowedDomains(ctx, newer.ID, []string{"example.com"}))
+		must(t, r.Workspaces.Delete(ctx, newer.ID))
+
+		if got, _ := r.Workspaces.GetByID(ctx, newer.ID); got != nil {
+			t.Fatal("workspace not deleted")
+		}
+		if m, _ := r.Workspaces.GetMember(ctx, newer.ID, alice.ID); m != nil {
+			t.Fatal("members not deleted")
+		}
+		if got, _ := r.Channels.GetByID(ctx, ch.ID); got != nil {
+			t.Fatal("channels not deleted")
+		}
+		if d, _ := r.Workspaces.ListAllowedDomains(ctx, newer.ID); len(d) != 0 {
+			t.Fatal("allowed domains not deleted")
+		}
+	})
+}
+
+func testMemberSearch(t *testing.T, r Repos) {
+	ctx := context.Background()
+	newPerson := func(username, displayName, email string) *domain.User {
+		t.Helper()
+		u := &domain.User{
+			ID: uuid.New(), Email: email, Username: username, DisplayName: displayName,
+			PasswordHash: "hash", Status: "offline", CreatedAt: base, UpdatedAt: base,
+		}
+		must(t, r.Users.Create(ctx, u))
+		return u
+	}
+	ana := newPerson("ana", "Ana Horvat", "ana@example.com")
+	anabel := newPerson("anabel", "Anabel", "anabel@example.com")
+	marko := newPerson("marko", "Marko Anand", "marko@example.com")
+	hana := newPerson("hana", "Hana", "hana@example.com")
+	adnan := newPerson("adnan", "Adnan", "adnan@example.com")
+	zed := newPerson("zed", "Zed", "ana.z@example.com")
+	bob := newPerson("bob", "Bob", "bob@example.com")
+	outsider := newPerson("anakin", "Anakin", "anakin@example.com")
+
+	ws := newWorkspace(t, r, "search", ana, at(1))
+	addMember(t, r, ws, ana, "owner", at(1))
+	addMember(t, r, ws, marko, "admin", at(2))
+	for i, u := range []*domain.User{anabel, hana, adnan, zed, bob} {
+		addMember(t, r, ws, u, "member", at(3+i))
+	}
+	other := newWorkspace(t, r, "other", outsider, at(1))
+	addMember(t, r, other, outsider, "owner", at(1))
+
+	userID := func(m repository.MemberMatch) uuid.UUID { return m.UserID }
+	search := func(s repository.MemberSearch) []repository.MemberMatch {
+		t.Helper()
+		if s.Limit == 0 {
+			s.Limit = 50
+		}
+		matches, err := r.Workspaces.SearchMembers(ctx, ws.ID, s)
+		must(t, err)
+		return matches
+	}
+
+	t.Run("ranking", func(t *testing.T) {
+		matches := search(repository.MemberSearch{Query: " ANA "})
+		equalIDs(t, "SearchMembers", ids(matches, userID), ana.ID, anabel.ID, marko.ID, hana.ID, adnan.ID)
+		for i, rank := range []int{0, 1, 2, 4, 5} {
+			if matches[i].Rank != rank {
+				t.Fatalf("%s rank = %d, want %d", matches[i].Username, matches[i].Rank, rank)
+			}
+		}
+		if m := matches[2]; m.DisplayName != "Marko Anand" || m.Role != "admin" || m.Email != "" {
+			t.Fatalf("match fields = %+v", m)
+		}
+	})
+
+	t.Run("email", func(t *testing.T) {
+		matches := search(repository.MemberSearch{Query: "ana.z", IncludeEmail: true})
+		equalIDs(t, "email prefix", ids(matches, userID), zed.ID)
+		if matches[0].Rank != 3 || matches[0].Email != "ana.z@example.com" {
+			t.Fatalf("email match = %+v", matches[0])
+		}
+		if matches := search(repository.MemberSearch{Query: "ana.z"}); len(matches) != 0 {
+			t.Fatalf("matched email without IncludeEmail: %+v", matches)
+		}
+	})
+
+	t.Run("filters", func(t *testing.T) {
+		all := search(repository.MemberSearch{})
+		equalIDs(t, "empty query", ids(all, userID), adnan.ID, ana.ID, anabel.ID, bob.ID, hana.ID, marko.ID, zed.ID)
+		admins := search(repository.MemberSearch{Query: "an", Role: "admin"})
+		equalIDs(t, "role filter", ids(admins, userID), marko.ID)
+		if matches := search(repository.MemberSearch{Query: "%"}); len(matches) != 0 {
+			t.Fatalf("wildcard in query matched: %+v", matches)
+		}
+	})
+
+	t.Run("paging", func(t *testing.T) {
+		page := search(repository.MemberSearch{Query: "ana", Limit: 2})
+		equalIDs(t, "first page", ids(page, userID), ana.ID, anabel.ID)
+		after := page[1].Key()
+		page = search(repository.MemberSearch{Query: "ana", Limit: 2, After: &after})
+		equalIDs(t, "second page", ids(page, userID), marko.ID, hana.ID)
+		after = page[1].Key()
+		page = search(repository.MemberSearch{Query: "ana", Limit: 2, After: &after})
+		equalIDs(t, "last page", ids(page, userID), adnan.ID)
+		before := page[0].Key()
+		page = search(repository.MemberSearch{Query: "ana", Limit: 2, Before: &before})
+		equalIDs(t, "back a page", ids(page, userID), marko.ID, hana.ID)
+		before = page[0].Key()
+		page = search(repository.MemberSearch{Query: "ana", Limit: 2, Before: &before})
+		equalIDs(t, "back to the first page", ids(page, userID), ana.ID, anabel.ID)
+	})
+
+	t.Run("profile", func(t *testing.T) {
+		title, tz, pronouns := "Engineer", "Europe/Zagreb", "she/her"
+		must(t, r.Workspaces.UpdateMemberProfile(ctx, &domain.WorkspaceMember{
+			WorkspaceID: ws.ID, UserID: hana.ID, Title: &title, Timezone: &tz, Pronouns: &pronouns,
+		}))
+		m, err := r.Workspaces.GetMember(ctx, ws.ID, hana.ID)
+		must(t, err)
+		if m.Title == nil || *m.Title != title || m.Timezone == nil || *m.Timezone != tz || m.Pronouns == nil || *m.Pronouns != pronouns {
+			t.Fatalf("GetMember after UpdateMemberProfile = %+v", m)
+		}
+		matches := search(repository.MemberSearch{Query: "hana"})
+		if len(matches) != 1 || matches[0].Title == nil || *matches[0].Title != title {
+			t.Fatalf("search result profile = %+v", matches)
+		}
+
+		must(t, r.Workspaces.UpdateMemberProfile(ctx, &domain.WorkspaceMember{WorkspaceID: ws.ID, UserID: hana.ID}))
+		if m, _ := r.Workspaces.GetMember(ctx, ws.ID, hana.ID); m.Title != nil || m.Timezone != nil || m.Pronouns != nil {
+			t.Fatalf("profile not cleared: %+v", m)
+		}
+	})
+}
+
+func testJoinRequests(t *testing.T, r Repos) {
+	ctx := context.Background()
+	owner := newUser(t, r, "owner")
+	carol := newUser(t, r, "carol")
+	dave := newUser(t, r, "dave")
+
+	beta := newWorkspace(t, r, "beta", owner, at(1))
+	alpha := newWorkspace(t, r, "alpha", owner, at(2))
+	other := newWorkspace(t, r, "other", owner, at(3))
+	addMember(t, r, beta, owner, "owner", at(1))
+	addMember(t, r, alpha, owner, "owner", at(2))
+	addMember(t, r, alpha, dave, "member", at(3))
+	must(t, r.Workspaces.SetAllowedDomains(ctx, beta.ID, []string{"example.com"}))
+	must(t, r.Workspaces.SetAllowedDomains(ctx, alpha.ID, []string{"example.com"}))
+	must(t, r.Workspaces.SetAllowedDomains(ctx, other.ID, []string{"other.com"}))
+
+	newRequest := func(ws *domain.Workspace, u *domain.User, createdAt int) *domain.WorkspaceJoinRequest {
+		t.Helper()
+		req := &domain.WorkspaceJoinRequest{ID: uuid.New(), WorkspaceID: ws.ID, UserID: u.ID, Status: "pending", CreatedAt: at(createdAt)}
+		must(t, r.Workspaces.CreateJoinRequest(ctx, req))
+		return req
+	}
+	carolReq := newRequest(beta, carol, 10)
+	daveReq := newRequest(beta, dave, 5)
+
+	dup := *carolReq
+	dup.ID = uuid.New()
+	if err := r.Workspaces.CreateJoinRequest(ctx, &dup); err == nil {
+		t.Fatal("second pending request accepted")
+	}
+
+	t.Run("discoverable", func(t *testing.T) {
+		list, err := r.Workspaces.ListDiscoverable(ctx, carol.ID, "example.com")
+		must(t, err)
+		equalIDs(t, "ListDiscoverable", ids(list, func(w domain.DiscoverableWorkspace) uuid.UUID { return w.ID }), alpha.ID, beta.ID)
+		if list[0].MemberCount != 2 || list[0].HasPendingRequest {
+			t.Fatalf("alpha = %+v", list[0])
+		}
+		if list[1].MemberCount != 1 || !list[1].HasPendingRequest {
+			t.Fatalf("beta = %+v", list[1])
+		}
+
+		// Workspaces the user already belongs to aren't listed
+		list, _ = r.Workspaces.ListDiscoverable(ctx, dave.ID, "example.com")
+		equalIDs(t, "ListDiscoverable(dave)", ids(list, func(w domain.DiscoverableWorkspace) uuid.UUID { return w.ID }), beta.ID)
+	})
+
+	t.Run("pending", func(t *testing.T) {
+		got, err := r.Workspaces.GetPendingJoinRequest(ctx, beta.ID, carol.ID)
+		must(t, err)
+		if got == nil || got.ID != carolReq.ID {
+			t.Fatalf("GetPendingJoinRequest = %+v", got)
+		}
+		list, err := r.Workspaces.ListPendingJoinRequests(ctx, beta.ID)
+		must(t, err)
+		equalIDs(t, "ListPendingJoinRequests", ids(list, func(r domain.WorkspaceJoinRequest) uuid.UUID { return r.ID }), daveReq.ID, carolReq.ID)
+		if list[1].Username != "carol" || list[1].Email != carol.Email {
+			t.Fatalf("request joined fields = %+v", list[1])
+		}
+	})
+
+	t.Run("decide", func(t *testing.T) {
+		must(t, r.Workspaces.DecideJoinRequest(ctx, carolReq.ID, "rejected", owner.ID))
+		got, _ := r.Workspaces.GetJoinRequestByID(ctx, carolReq.ID)
+		if got.Status != "rejected" || got.DecidedBy == nil || *got.DecidedBy != owner.ID || got.DecidedAt == nil {
+			t.Fatalf("after decision: %+v", got)
+		}
+		if got, _ := r.Workspaces.GetPendingJoinRequest(ctx, beta.ID, carol.ID); got != nil {
+			t.Fatal("decided request still pending")
+		}
+		// A decided request doesn't block a new one
+		newRequest(beta, carol, 20)
+	})
+
+	if got, err := r.Workspaces.GetJoinRequestByID(ctx, uuid.New()); got != nil || err != nil {
+		t.Fatalf("GetJoinRequestByID(missing) = %v, %v", got, err)
+	}
+}
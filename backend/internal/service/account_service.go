@@ -0,0 +1,348 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/vedran77/pulse/internal/avatar"
+	"github.com/vedran77/pulse/internal/domain"
+	"github.com/vedran77/pulse/internal/repository"
+)
+
+var (
+	ErrEmailUnchanged = errors.New("that is already your email address")
+	ErrOwnsWorkspaces = errors.New("transfer or delete the workspaces you own first")
+
+	// Avatar upload errors
+	ErrInvalidImage  = avatar.ErrInvalidImage
+	ErrImageTooLarge = avatar.ErrTooLarge
+)
+
+// AvatarStore keeps uploaded profile pictures.
+type AvatarStore interface {
+	// Put stores a PNG under a unique name and returns its public URL.
+	Put(ctx context.Context, name string, data []byte) (string, error)
+	// Delete removes the avatar at a URL returned by Put; other URLs are ignored.
+	Delete(ctx context.Context, url string) error
+}
+
+// AccountService lets users manage their own profile and account. Changes
+// to the password, email and the account's deletion need the current
+// password.
+type AccountService struct {
+	userRepo      repository.UserRepository
+	workspaceRepo repository.WorkspaceRepository
+	// Token, mail and password helpers are shared with sign-in
+	auth    *AuthService
+	avatars AvatarStore
+}
+
+func NewAccountService(userRepo repository.UserRepository, workspaceRepo repository.WorkspaceRepository, auth *AuthService, avatars AvatarStore) *AccountService {
+	return &AccountService{
+		userRepo:      userRepo,
+		workspaceRepo: workspaceRepo,
+		auth:          auth,
+		avatars:       avatars,
+	}
+}
+
+type UpdateProfileInput struct {
+	Username    *string `json:"username"`
+	DisplayName *string `json:"display_name"`
+}
+
+type ChangePasswordInput struct {
+	CurrentPassword string `json:"current_password"`
+	NewPassword     string `json:"new_password"`
+}
+
+type ChangeEmailInput struct {
+	Email    string `json:"email"`
+	Password string `json:"password"`
+}
+
+func (s *AccountService) Get(ctx context.Context, userID uuid.UUID) (*domain.User, error) {
+	ctx, span := tracer.Start(ctx, "AccountService.Get")
+	defer span.End()
+
+	return s.getUser(ctx, userID)
+}
+
+func (s *AccountService) UpdateProfile(ctx context.Context, userID uuid.UUID, input UpdateProfileInput) (*domain.User, error) {
+	ctx, span := tracer.Start(ctx, "AccountService.UpdateProfile")
+	defer span.End()
+
+	user, err := s.getUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if input.Username != nil {
+		username := strings.TrimSpace(*input.Username)
+		if username != user.Username {
+			existing, err := s.userRepo.GetByUsername(ctx, username)
+			if err != nil {
+				return nil, err
+			}
+			if existing != nil {
+				return nil, ErrUsernameTaken
+			}
+			user.Username = username
+		}
+	}
+	if input.DisplayName != nil {
+		user.DisplayName = strings.TrimSpace(*input.DisplayName)
+	}
+
+	if err := s.userRepo.UpdateProfile(ctx, user); err != nil {
+		return nil, fmt.Errorf("updating profile: %w", err)
+	}
+	return s.getUser(ctx, userID)
+}
+
+// SetAvatar resizes the uploaded image and makes it the user's avatar,
+// replacing the previous one.
+func (s *AccountService) SetAvatar(ctx context.Context, userID uuid.UUID, r io.Reader) (*domain.User, error) {
+	ctx, span := tracer.Start(ctx, "AccountService.SetAvatar")
+	defer span.End()
+
+	user, err := s.getUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	img, err := avatar.Resize(r)
+	if err != nil {
+		return nil, err
+	}
+
+	// A new name for every upload, so cached copies of the old one don't linger
+	suffix, err := randomToken()
+	if err != nil {
+		return nil, err
+	}
+	url, err := s.avatars.Put(ctx, fmt.Sprintf("%s-%s.png", userID, suffix[:16]), img)
+	if err != nil {
+		return nil, fmt.Errorf("storing avatar: %w", err)
+	}
+	if err := s.userRepo.SetAvatarURL(ctx, userID, &url); err != nil {
+		return nil, err
+	}
+	s.deleteAvatar(ctx, user)
+
+	return s.getUser(ctx, userID)
+}
+
+func (s *AccountService) RemoveAvatar(ctx context.Context, userID uuid.UUID) error {
+	ctx, span := tracer.Start(ctx, "AccountService.RemoveAvatar")
+	defer span.End()
+
+	user, err := s.getUser(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if user.AvatarURL == nil {
+		return nil
+	}
+
+	if err := s.userRepo.SetAvatarURL(ctx, userID, nil); err != nil {
+		return err
+	}
+	s.deleteAvatar(ctx, user)
+	return nil
+}
+
+// ChangePassword sets a new password and signs out all existing sessions.
+// The returned token keeps the caller signed in.
+func (s *AccountService) ChangePassword(ctx context.Context, userID uuid.UUID, input ChangePasswordInput) (*AuthResponse, error) {
+	ctx, span := tracer.Start(ctx, "AccountService.ChangePassword")
+	defer span.End()
+
+	user, err := s.getUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.reauthenticate(ctx, user, input.CurrentPassword); err != nil {
+		return nil, err
+	}
+
+	hash, err := hashPassword(input.NewPassword)
+	if err != nil {
+		return nil, fmt.Errorf("hashing password: %w", err)
+	}
+	if err := s.userRepo.UpdatePassword(ctx, userID, hash); err != nil {
+		return nil, fmt.Errorf("updating password: %w", err)
+	}
+
+	// Reloaded for the new token version
+	user, err = s.getUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	// The new token keeps the session's sign-in method
+	authMethod := domain.AuthMethodPassword
+	if session, ok := domain.SessionFrom(ctx); ok {
+		authMethod = session.AuthMethod
+	}
+	token, err := s.auth.generateToken(user, authMethod)
+	if err != nil {
+		return nil, fmt.Errorf("generating token: %w", err)
+	}
+	return &AuthResponse{User: user, AccessToken: token}, nil
+}
+
+// ChangeEmail emails a confirmation link to the new address. The email
+// only changes once the link is opened, with ConfirmEmailChange.
+func (s *AccountService) ChangeEmail(ctx context.Context, userID uuid.UUID, input ChangeEmailInput) error {
+	ctx, span := tracer.Start(ctx, "AccountService.ChangeEmail")
+	defer span.End()
+
+	user, err := s.getUser(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if err := s.reauthenticate(ctx, user, input.Password); err != nil {
+		return err
+	}
+
+	email := strings.TrimSpace(input.Email)
+	if email == user.Email {
+		return ErrEmailUnchanged
+	}
+	existing, err := s.userRepo.GetByEmail(ctx, email)
+	if err != nil {
+		return err
+	}
+	if existing != nil {
+		return ErrEmailTaken
+	}
+
+	if err := s.userRepo.SetPendingEmail(ctx, userID, &email); err != nil {
+		return err
+	}
+	// Only the link for the latest requested address works
+	if err := s.auth.tokenRepo.InvalidateForUser(ctx, userID, domain.TokenPurposeChangeEmail); err != nil {
+		return err
+	}
+	ttl := s.auth.settings.VerifyEmailTokenTTL
+	token, err := s.auth.issueToken(ctx, userID, domain.TokenPurposeChangeEmail, ttl)
+	if err != nil {
+		return err
+	}
+
+	return s.auth.sendMail(ctx, email, changeEmailMail, map[string]any{
+		"DisplayName": user.DisplayName,
+		"Link":        s.auth.appURL + "/confirm-email?token=" + token,
+		"TTL":         humanDuration(ttl),
+	})
+}
+
+// ConfirmEmailChange switches the account to the pending address using a
+// token from the confirmation email.
+func (s *AccountService) ConfirmEmailChange(ctx context.Context, token string) error {
+	ctx, span := tracer.Start(ctx, "AccountService.ConfirmEmailChange")
+	defer span.End()
+
+	t, err := s.auth.consumeToken(ctx, token, domain.TokenPurposeChangeEmail)
+	if err != nil {
+		return err
+	}
+
+	user, err := s.userRepo.GetByID(ctx, t.UserID)
+	if err != nil {
+		return err
+	}
+	if user == nil || user.PendingEmail == nil {
+		return ErrInvalidToken
+	}
+
+	// Someone may have registered the address since the link was sent
+	existing, err := s.userRepo.GetByEmail(ctx, *user.PendingEmail)
+	if err != nil {
+		return err
+	}
+	if existing != nil {
+		return ErrEmailTaken
+	}
+
+	return s.userRepo.ConfirmEmailChange(ctx, user.ID)
+}
+
+// Delete erases the account. Messages the user sent stay in their
+// channels and DMs, attributed to "Deleted user"; everything else personal
+// is removed and all sessions are signed out. Workspaces the user owns
+// have to be transferred or deleted first.
+func (s *AccountService) Delete(ctx context.Context, userID uuid.UUID, password string) error {
+	ctx, span := tracer.Start(ctx, "AccountService.Delete")
+	defer span.End()
+
+	user, err := s.getUser(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if err := s.reauthenticate(ctx, user, password); err != nil {
+		return err
+	}
+
+	workspaces, err := s.workspaceRepo.ListByUser(ctx, userID)
+	if err != nil {
+		return err
+	}
+	for _, ws := range workspaces {
+		if ws.OwnerID == userID {
+			return ErrOwnsWorkspaces
+		}
+	}
+
+	if err := s.userRepo.Anonymize(ctx, userID, time.Now()); err != nil {
+		return fmt.Errorf("anonymizing user: %w", err)
+	}
+	s.deleteAvatar(ctx, user)
+
+	slog.InfoContext(ctx, "account deleted", "user_id", userID)
+	return nil
+}
+
+func (s *AccountService) getUser(ctx context.Context, userID uuid.UUID) (*domain.User, error) {
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, ErrUserNotFound
+	}
+	return user, nil
+}
+
+// reauthenticate checks the password before a sensitive change. Wrong
+// passwords count towards the login lockout, so a stolen session can't be
+// used to guess it.
+func (s *AccountService) reauthenticate(ctx context.Context, user *domain.User, password string) error {
+	if err := checkLocked(user); err != nil {
+		return err
+	}
+	if !verifyPassword(password, user.PasswordHash) {
+		if err := s.auth.recordFailedLogin(ctx, user); err != nil {
+			return err
+		}
+		return ErrInvalidCreds
+	}
+	return s.auth.clearFailedLogins(ctx, user)
+}
+
+// deleteAvatar removes the user's previous avatar file. The user is
+// already updated, so a failure only leaves an orphaned file.
+func (s *AccountService) deleteAvatar(ctx context.Context, user *domain.User) {
+	if user.AvatarURL == nil {
+		return
+	}
+	if err := s.avatars.Delete(ctx, *user.AvatarURL); err != nil {
+		slog.ErrorContext(ctx, "deleting avatar", "user_id", user.ID, "err", err)
+	}
+}
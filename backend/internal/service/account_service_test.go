@@ -0,0 +1,191 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image"
+	"image/png"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/vedran77/pulse/internal/domain"
+	"github.com/vedran77/pulse/internal/repository/memory"
+)
+
+// avatarRecorder stands in for the avatar storage.
+type avatarRecorder struct{ stored map[string][]byte }
+
+func (a *avatarRecorder) Put(ctx context.Context, name string, data []byte) (string, error) {
+	a.stored[name] = data
+	return "https://cdn.example/" + name, nil
+}
+
+func (a *avatarRecorder) Delete(ctx context.Context, url string) error {
+	delete(a.stored, url[len("https://cdn.example/"):])
+	return nil
+}
+
+var mailedToken = regexp.MustCompile(`token=([0-9a-f]+)`)
+
+func TestAccount(t *testing.T) {
+	ctx := context.Background()
+	store := memory.NewStore()
+	users := memory.NewUserRepo(store)
+	workspaces := memory.NewWorkspaceRepo(store)
+	tx := memory.NewTxManager(store)
+
+	mailer := &mailRecorder{}
+	auth := NewAuthService(users, memory.NewVerificationTokenRepo(store), memory.NewTwoFactorRepo(store), memory.NewIdentityRepo(store), "test-secret", "test-totp-key")
+	auth.SetMailer(mailer, "https://pulse.example")
+	settings := DefaultAuthSettings()
+	settings.VerifyEmailTokenTTL = 24 * time.Hour
+	auth.SetSettings(settings)
+	avatars := &avatarRecorder{stored: map[string][]byte{}}
+	svc := NewAccountService(users, workspaces, auth, avatars)
+
+	register := func(name string) *AuthResponse {
+		t.Helper()
+		resp, err := auth.Register(ctx, RegisterInput{Email: name + "@example.com", Username: name, DisplayName: name, Password: "Password123"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+	alice := register("alice")
+	bob := register("bob")
+	if body := mailer.sent[0].body; !strings.Contains(body, "valid for 24 hours") {
+		t.Fatalf("verification mail doesn't give the link's lifetime: %q", body)
+	}
+
+	t.Run("profile", func(t *testing.T) {
+		taken := "alice"
+		if _, err := svc.UpdateProfile(ctx, bob.User.ID, UpdateProfileInput{Username: &taken}); !errors.Is(err, ErrUsernameTaken) {
+			t.Fatalf("taken username: err = %v", err)
+		}
+		username, name := "bobby", " Bobby Tables "
+		user, err := svc.UpdateProfile(ctx, bob.User.ID, UpdateProfileInput{Username: &username, DisplayName: &name})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if user.Username != "bobby" || user.DisplayName != "Bobby Tables" {
+			t.Fatalf("after update: %+v", user)
+		}
+	})
+
+	t.Run("avatar", func(t *testing.T) {
+		var img bytes.Buffer
+		if err := png.Encode(&img, image.NewRGBA(image.Rect(0, 0, 10, 10))); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := svc.SetAvatar(ctx, bob.User.ID, bytes.NewReader([]byte("not an image"))); !errors.Is(err, ErrInvalidImage) {
+			t.Fatalf("garbage upload: err = %v", err)
+		}
+		first, err := svc.SetAvatar(ctx, bob.User.ID, bytes.NewReader(img.Bytes()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		second, err := svc.SetAvatar(ctx, bob.User.ID, bytes.NewReader(img.Bytes()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if first.AvatarURL == nil || second.AvatarURL == nil || *first.AvatarURL == *second.AvatarURL || len(avatars.stored) != 1 {
+			t.Fatalf("replacing the avatar: %v then %v, %d stored", first.AvatarURL, second.AvatarURL, len(avatars.stored))
+		}
+		if err := svc.RemoveAvatar(ctx, bob.User.ID); err != nil {
+			t.Fatal(err)
+		}
+		if user, _ := svc.Get(ctx, bob.User.ID); user.AvatarURL != nil || len(avatars.stored) != 0 {
+			t.Fatalf("after remove: %v, %d stored", user.AvatarURL, len(avatars.stored))
+		}
+	})
+
+	t.Run("password change signs out other sessions", func(t *testing.T) {
+		if _, err := svc.ChangePassword(ctx, bob.User.ID, ChangePasswordInput{CurrentPassword: "wrong", NewPassword: "NewPassword456"}); !errors.Is(err, ErrInvalidCreds) {
+			t.Fatalf("wrong current password: err = %v", err)
+		}
+		resp, err := svc.ChangePassword(ctx, bob.User.ID, ChangePasswordInput{CurrentPassword: "Password123", NewPassword: "NewPassword456"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := auth.ValidateAccessToken(ctx, bob.AccessToken); !errors.Is(err, ErrInvalidToken) {
+			t.Fatalf("old session still valid: err = %v", err)
+		}
+		if _, err := auth.ValidateAccessToken(ctx, resp.AccessToken); err != nil {
+			t.Fatalf("new session: %v", err)
+		}
+		if _, err := auth.Login(ctx, LoginInput{Email: "bob@example.com", Password: "NewPassword456"}); err != nil {
+			t.Fatalf("login with new password: %v", err)
+		}
+	})
+
+	t.Run("email change", func(t *testing.T) {
+		input := ChangeEmailInput{Email: "alice@example.com", Password: "NewPassword456"}
+		if err := svc.ChangeEmail(ctx, bob.User.ID, input); !errors.Is(err, ErrEmailTaken) {
+			t.Fatalf("taken email: err = %v", err)
+		}
+		input.Email = "bob@new.example"
+		if err := svc.ChangeEmail(ctx, bob.User.ID, input); err != nil {
+			t.Fatal(err)
+		}
+		last := mailer.sent[len(mailer.sent)-1]
+		if last.to != "bob@new.example" {
+			t.Fatalf("confirmation sent to %q", last.to)
+		}
+		if user, _ := svc.Get(ctx, bob.User.ID); user.Email != "bob@example.com" || user.PendingEmail == nil {
+			t.Fatalf("email changed before confirmation: %+v", user)
+		}
+
+		token := mailedToken.FindStringSubmatch(last.body)[1]
+		if err := auth.VerifyEmail(ctx, token); !errors.Is(err, ErrInvalidToken) {
+			t.Fatalf("change token accepted as verification: err = %v", err)
+		}
+		if err := svc.ConfirmEmailChange(ctx, token); err != nil {
+			t.Fatal(err)
+		}
+		if err := svc.ConfirmEmailChange(ctx, token); !errors.Is(err, ErrInvalidToken) {
+			t.Fatalf("token reused: err = %v", err)
+		}
+		user, _ := svc.Get(ctx, bob.User.ID)
+		if user.Email != "bob@new.example" || user.PendingEmail != nil || user.EmailVerifiedAt == nil {
+			t.Fatalf("after confirmation: %+v", user)
+		}
+	})
+
+	t.Run("deletion", func(t *testing.T) {
+		ws, err := NewWorkspaceService(workspaces, users, memory.NewInviteRepo(store), tx).
+			Create(ctx, alice.User.ID, CreateWorkspaceInput{Name: "Acme"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := workspaces.AddMember(ctx, &domain.WorkspaceMember{WorkspaceID: ws.ID, UserID: bob.User.ID, Role: "member", JoinedAt: time.Now()}); err != nil {
+			t.Fatal(err)
+		}
+		if err := svc.Delete(ctx, alice.User.ID, "Password123"); !errors.Is(err, ErrOwnsWorkspaces) {
+			t.Fatalf("deleting a workspace owner: err = %v", err)
+		}
+		if err := svc.Delete(ctx, bob.User.ID, "Password123"); !errors.Is(err, ErrInvalidCreds) {
+			t.Fatalf("wrong password: err = %v", err)
+		}
+
+		if err := svc.Delete(ctx, bob.User.ID, "NewPassword456"); err != nil {
+			t.Fatal(err)
+		}
+		user, _ := users.GetByID(ctx, bob.User.ID)
+		if user == nil || user.DeletedAt == nil || user.DisplayName != "Deleted user" || user.Email == "bob@new.example" {
+			t.Fatalf("after deletion: %+v", user)
+		}
+		if _, err := auth.Login(ctx, LoginInput{Email: "bob@new.example", Password: "NewPassword456"}); !errors.Is(err, ErrInvalidCreds) {
+			t.Fatalf("deleted user signed in: err = %v", err)
+		}
+		// The email and username are free again
+		if _, err := auth.Register(ctx, RegisterInput{Email: "bob@new.example", Username: "bobby", DisplayName: "Bob", Password: "Password123"}); err != nil {
+			t.Fatalf("re-registering: %v", err)
+		}
+		if m, _ := workspaces.GetMember(ctx, ws.ID, bob.User.ID); m != nil {
+			t.Fatal("deleted user is still a workspace member")
+		}
+	})
+}
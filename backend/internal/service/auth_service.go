@@ -3,10 +3,12 @@ package service
 import (
 	"context"
 	"crypto/rand"
+	"crypto/sha256"
 	"crypto/subtle"
 	"encoding/base64"
 	"errors"
 	"fmt"
+	"log/slog"
 	"strings"
 	"time"
 
@@ -18,23 +20,101 @@ import (
 )
 
 var (
-	ErrEmailTaken    = errors.New("email already taken")
-	ErrUsernameTaken = errors.New("username already taken")
-	ErrInvalidCreds  = errors.New("invalid email or password")
+	ErrEmailTaken         = errors.New("email already taken")
+	ErrUsernameTaken      = errors.New("username already taken")
+	ErrInvalidCreds       = errors.New("invalid email or password")
+	ErrInvalidToken       = errors.New("invalid or expired token")
+	ErrEmailNotVerified   = errors.New("email address is not verified")
+	ErrAlreadyVerified    = errors.New("email address is already verified")
+	ErrAccountLocked      = errors.New("account is temporarily locked")
+	ErrRegistrationClosed = errors.New("registration is closed")
+)
+
+// AccountLockedError is returned while an account is locked after too many
+// failed logins. It matches ErrAccountLocked with errors.Is.
+type AccountLockedError struct {
+	Until time.Time
+}
+
+func (e *AccountLockedError) Error() string {
+	return fmt.Sprintf("account is locked until %s", e.Until.Format(time.RFC3339))
+}
+
+func (e *AccountLockedError) Is(target error) bool {
+	return target == ErrAccountLocked
+}
+
+// How long the user has to enter their 2FA code after the password step
+const twoFactorChallengeTTL = 5 * time.Minute
+
+// AuthSettings are the tunable token lifetimes and login policy.
+type AuthSettings struct {
+	AccessTokenTTL        time.Duration
+	VerifyEmailTokenTTL   time.Duration
+	ResetPasswordTokenTTL time.Duration
+	// Failed password or 2FA attempts before the account is locked
+	MaxFailedLogins int
+	LockoutDuration time.Duration
+	// Whether anyone can register with a password
+	RegistrationOpen bool
+}
+
+func DefaultAuthSettings() AuthSettings {
+	return AuthSettings{
+		AccessTokenTTL:        24 * time.Hour,
+		VerifyEmailTokenTTL:   48 * time.Hour,
+		ResetPasswordTokenTTL: time.Hour,
+		MaxFailedLogins:       10,
+		LockoutDuration:       15 * time.Minute,
+		RegistrationOpen:      true,
+	}
+}
+
+// JWT "typ" claim values
+const (
+	tokenTypeAccess             = "access"
+	tokenTypeTwoFactorChallenge = "2fa_challenge"
 )
 
 type AuthService struct {
-	userRepo  repository.UserRepository
-	jwtSecret []byte
+	userRepo      repository.UserRepository
+	tokenRepo     repository.VerificationTokenRepository
+	twoFactorRepo repository.TwoFactorRepository
+	identityRepo  repository.IdentityRepository
+	jwtSecret     []byte
+	settings      AuthSettings
+	// AES key for TOTP secrets at rest
+	totpKey []byte
+	mailer  Mailer
+	appURL  string
+	oidc    OIDCProvider
 }
 
-func NewAuthService(userRepo repository.UserRepository, jwtSecret string) *AuthService {
+func NewAuthService(userRepo repository.UserRepository, tokenRepo repository.VerificationTokenRepository, twoFactorRepo repository.TwoFactorRepository, identityRepo repository.IdentityRepository, jwtSecret, totpEncryptionKey string) *AuthService {
+	key := sha256.Sum256([]byte(totpEncryptionKey))
 	return &AuthService{
-		userRepo:  userRepo,
-		jwtSecret: []byte(jwtSecret),
+		userRepo:      userRepo,
+		tokenRepo:     tokenRepo,
+		twoFactorRepo: twoFactorRepo,
+		identityRepo:  identityRepo,
+		jwtSecret:     []byte(jwtSecret),
+		settings:      DefaultAuthSettings(),
+		totpKey:       key[:],
 	}
 }
 
+// SetSettings overrides the default token lifetimes and login policy.
+func (s *AuthService) SetSettings(settings AuthSettings) {
+	s.settings = settings
+}
+
+// SetMailer sets the mailer used for verification and password reset emails
+// (optional dependency). appURL is the frontend base URL that links point to.
+func (s *AuthService) SetMailer(m Mailer, appURL string) {
+	s.mailer = m
+	s.appURL = strings.TrimRight(appURL, "/")
+}
+
 type RegisterInput struct {
 	Email       string `json:"email"`
 	Username    string `json:"username"`
@@ -47,12 +127,28 @@ type LoginInput struct {
 	Password string `json:"password"`
 }
 
+type ResetPasswordInput struct {
+	Token    string `json:"token"`
+	Password string `json:"password"`
+}
+
+// AuthResponse is returned by login and registration. When the user has
+// 2FA enabled, Login only returns a challenge token to pass to LoginTwoFactor.
 type AuthResponse struct {
-	User        *domain.User `json:"user"`
-	AccessToken string       `json:"access_token"`
+	User              *domain.User `json:"user,omitempty"`
+	AccessToken       string       `json:"access_token,omitempty"`
+	TwoFactorRequired bool         `json:"two_factor_required,omitempty"`
+	ChallengeToken    string       `json:"challenge_token,omitempty"`
 }
 
 func (s *AuthService) Register(ctx context.Context, input RegisterInput) (*AuthResponse, error) {
+	ctx, span := tracer.Start(ctx, "AuthService.Register")
+	defer span.End()
+
+	if !s.settings.RegistrationOpen {
+		return nil, ErrRegistrationClosed
+	}
+
 	existing, err := s.userRepo.GetByEmail(ctx, input.Email)
 	if err != nil {
 		return nil, err
@@ -90,7 +186,12 @@ func (s *AuthService) Register(ctx context.Context, input RegisterInput) (*AuthR
 		return nil, fmt.Errorf("creating user: %w", err)
 	}
 
-	token, err := s.generateToken(user.ID)
+	// The account is usable right away but limited until the email is verified
+	if err := s.sendVerificationEmail(ctx, user); err != nil {
+		slog.ErrorContext(ctx, "sending verification email", "user_id", user.ID, "err", err)
+	}
+
+	token, err := s.generateToken(user, domain.AuthMethodPassword)
 	if err != nil {
 		return nil, fmt.Errorf("generating token: %w", err)
 	}
@@ -99,6 +200,9 @@ func (s *AuthService) Register(ctx context.Context, input RegisterInput) (*AuthR
 }
 
 func (s *AuthService) Login(ctx context.Context, input LoginInput) (*AuthResponse, error) {
+	ctx, span := tracer.Start(ctx, "AuthService.Login")
+	defer span.End()
+
 	user, err := s.userRepo.GetByEmail(ctx, input.Email)
 	if err != nil {
 		return nil, err
@@ -107,11 +211,38 @@ func (s *AuthService) Login(ctx context.Context, input LoginInput) (*AuthRespons
 		return nil, ErrInvalidCreds
 	}
 
+	if err := checkLocked(user); err != nil {
+		return nil, err
+	}
+
 	if !verifyPassword(input.Password, user.PasswordHash) {
+		if err := s.recordFailedLogin(ctx, user); err != nil {
+			return nil, err
+		}
 		return nil, ErrInvalidCreds
 	}
 
-	token, err := s.generateToken(user.ID)
+	ssoRequired, err := s.identityRepo.RequiresSSO(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	if ssoRequired {
+		return nil, ErrSSORequired
+	}
+
+	if user.TwoFactorEnabled {
+		challenge, err := s.signToken(user, tokenTypeTwoFactorChallenge, domain.AuthMethodPassword, twoFactorChallengeTTL)
+		if err != nil {
+			return nil, fmt.Errorf("generating token: %w", err)
+		}
+		return &AuthResponse{TwoFactorRequired: true, ChallengeToken: challenge}, nil
+	}
+
+	if err := s.clearFailedLogins(ctx, user); err != nil {
+		return nil, err
+	}
+
+	token, err := s.generateToken(user, domain.AuthMethodPassword)
 	if err != nil {
 		return nil, fmt.Errorf("generating token: %w", err)
 	}
@@ -119,16 +250,309 @@ func (s *AuthService) Login(ctx context.Context, input LoginInput) (*AuthRespons
 	return &AuthResponse{User: user, AccessToken: token}, nil
 }
 
-func (s *AuthService) generateToken(userID uuid.UUID) (string, error) {
+// checkLocked returns an AccountLockedError while the user's lock is active.
+func checkLocked(user *domain.User) error {
+	if user.LockedUntil != nil && time.Now().Before(*user.LockedUntil) {
+		return &AccountLockedError{Until: *user.LockedUntil}
+	}
+	return nil
+}
+
+// recordFailedLogin counts a failed attempt and returns an
+// AccountLockedError if it locked the account.
+func (s *AuthService) recordFailedLogin(ctx context.Context, user *domain.User) error {
+	lockedUntil, err := s.userRepo.RecordFailedLogin(ctx, user.ID, s.settings.MaxFailedLogins, s.settings.LockoutDuration)
+	if err != nil {
+		return err
+	}
+	if lockedUntil != nil && time.Now().Before(*lockedUntil) {
+		slog.WarnContext(ctx, "account locked", "user_id", user.ID, "failed_logins", s.settings.MaxFailedLogins)
+		return &AccountLockedError{Until: *lockedUntil}
+	}
+	return nil
+}
+
+func (s *AuthService) clearFailedLogins(ctx context.Context, user *domain.User) error {
+	if user.FailedLoginAttempts == 0 && user.LockedUntil == nil {
+		return nil
+	}
+	return s.userRepo.ResetFailedLogins(ctx, user.ID)
+}
+
+// VerifyEmail marks the user's email as verified using a token from the verification email.
+func (s *AuthService) VerifyEmail(ctx context.Context, token string) error {
+	ctx, span := tracer.Start(ctx, "AuthService.VerifyEmail")
+	defer span.End()
+
+	t, err := s.consumeToken(ctx, token, domain.TokenPurposeVerifyEmail)
+	if err != nil {
+		return err
+	}
+
+	return s.userRepo.MarkEmailVerified(ctx, t.UserID)
+}
+
+// ResendVerification sends a new verification email, invalidating earlier ones.
+func (s *AuthService) ResendVerification(ctx context.Context, userID uuid.UUID) error {
+	ctx, span := tracer.Start(ctx, "AuthService.ResendVerification")
+	defer span.End()
+
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if user == nil {
+		return ErrUserNotFound
+	}
+	if user.EmailVerifiedAt != nil {
+		return ErrAlreadyVerified
+	}
+
+	if err := s.tokenRepo.InvalidateForUser(ctx, userID, domain.TokenPurposeVerifyEmail); err != nil {
+		return err
+	}
+	return s.sendVerificationEmail(ctx, user)
+}
+
+// ForgotPassword emails a password reset link. Unknown emails are ignored
+// so the endpoint can't be used to find out who has an account.
+func (s *AuthService) ForgotPassword(ctx context.Context, email string) error {
+	ctx, span := tracer.Start(ctx, "AuthService.ForgotPassword")
+	defer span.End()
+
+	user, err := s.userRepo.GetByEmail(ctx, email)
+	if err != nil {
+		return err
+	}
+	if user == nil {
+		return nil
+	}
+
+	// Only the most recent reset link works
+	if err := s.tokenRepo.InvalidateForUser(ctx, user.ID, domain.TokenPurposeResetPassword); err != nil {
+		return err
+	}
+
+	token, err := s.issueToken(ctx, user.ID, domain.TokenPurposeResetPassword, s.settings.ResetPasswordTokenTTL)
+	if err != nil {
+		return err
+	}
+
+	return s.sendMail(ctx, user.Email, resetPasswordMail, map[string]any{
+		"DisplayName": user.DisplayName,
+		"Link":        s.appURL + "/reset-password?token=" + token,
+		"TTL":         humanDuration(s.settings.ResetPasswordTokenTTL),
+	})
+}
+
+// ResetPassword sets a new password using a reset token and signs out all existing sessions.
+func (s *AuthService) ResetPassword(ctx context.Context, input ResetPasswordInput) error {
+	ctx, span := tracer.Start(ctx, "AuthService.ResetPassword")
+	defer span.End()
+
+	t, err := s.consumeToken(ctx, input.Token, domain.TokenPurposeResetPassword)
+	if err != nil {
+		return err
+	}
+
+	hash, err := hashPassword(input.Password)
+	if err != nil {
+		return fmt.Errorf("hashing password: %w", err)
+	}
+
+	if err := s.userRepo.UpdatePassword(ctx, t.UserID, hash); err != nil {
+		return fmt.Errorf("updating password: %w", err)
+	}
+	if err := s.userRepo.ResetFailedLogins(ctx, t.UserID); err != nil {
+		return err
+	}
+
+	// Receiving the reset email proves ownership of the address
+	user, err := s.userRepo.GetByID(ctx, t.UserID)
+	if err != nil {
+		return err
+	}
+	if user != nil && user.EmailVerifiedAt == nil {
+		if err := s.userRepo.MarkEmailVerified(ctx, user.ID); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ValidateAccessToken parses an access token and checks that its session
+// hasn't been revoked by a password change.
+func (s *AuthService) ValidateAccessToken(ctx context.Context, tokenStr string) (domain.Session, error) {
+	ctx, span := tracer.Start(ctx, "AuthService.ValidateAccessToken")
+	defer span.End()
+
+	claims, err := s.parseToken(tokenStr, tokenTypeAccess)
+	if err != nil {
+		return domain.Session{}, err
+	}
+
+	user, err := s.userRepo.GetByID(ctx, claims.UserID)
+	if err != nil {
+		return domain.Session{}, err
+	}
+	if user == nil || user.TokenVersion != claims.Version {
+		return domain.Session{}, ErrInvalidToken
+	}
+
+	return domain.Session{UserID: user.ID, TwoFactorEnabled: user.TwoFactorEnabled, AuthMethod: claims.AuthMethod}, nil
+}
+
+func (s *AuthService) generateToken(user *domain.User, authMethod string) (string, error) {
+	return s.signToken(user, tokenTypeAccess, authMethod, s.settings.AccessTokenTTL)
+}
+
+// signToken issues a JWT recording how the user signed in, which workspaces
+// requiring SSO check.
+func (s *AuthService) signToken(user *domain.User, typ, authMethod string, ttl time.Duration) (string, error) {
 	claims := jwt.MapClaims{
-		"sub": userID.String(),
-		"exp": time.Now().Add(24 * time.Hour).Unix(),
-		"iat": time.Now().Unix(),
+		"sub":         user.ID.String(),
+		"typ":         typ,
+		"ver":         user.TokenVersion,
+		"auth_method": authMethod,
+		"exp":         time.Now().Add(ttl).Unix(),
+		"iat":         time.Now().Unix(),
 	}
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 	return token.SignedString(s.jwtSecret)
 }
 
+// tokenClaims are the claims parseToken checks and returns.
+type tokenClaims struct {
+	UserID     uuid.UUID
+	Version    int
+	AuthMethod string
+}
+
+// parseToken verifies a JWT of the given type and returns its claims.
+func (s *AuthService) parseToken(tokenStr, typ string) (tokenClaims, error) {
+	token, err := jwt.Parse(tokenStr, func(t *jwt.Token) (any, error) {
+		return s.jwtSecret, nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}))
+	if err != nil || !token.Valid {
+		return tokenClaims{}, ErrInvalidToken
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return tokenClaims{}, ErrInvalidToken
+	}
+
+	// Access tokens issued before token types existed have no "typ" claim
+	tokenType, _ := claims["typ"].(string)
+	if tokenType == "" {
+		tokenType = tokenTypeAccess
+	}
+	if tokenType != typ {
+		return tokenClaims{}, ErrInvalidToken
+	}
+
+	sub, _ := claims.GetSubject()
+	userID, err := uuid.Parse(sub)
+	if err != nil {
+		return tokenClaims{}, ErrInvalidToken
+	}
+
+	ver, _ := claims["ver"].(float64)
+	// Tokens issued before SSO existed were all password logins
+	authMethod, _ := claims["auth_method"].(string)
+	if authMethod == "" {
+		authMethod = domain.AuthMethodPassword
+	}
+	return tokenClaims{UserID: userID, Version: int(ver), AuthMethod: authMethod}, nil
+}
+
+func (s *AuthService) sendVerificationEmail(ctx context.Context, user *domain.User) error {
+	token, err := s.issueToken(ctx, user.ID, domain.TokenPurposeVerifyEmail, s.settings.VerifyEmailTokenTTL)
+	if err != nil {
+		return err
+	}
+
+	return s.sendMail(ctx, user.Email, verifyEmailMail, map[string]any{
+		"DisplayName": user.DisplayName,
+		"Link":        s.appURL + "/verify-email?token=" + token,
+		"TTL":         humanDuration(s.settings.VerifyEmailTokenTTL),
+	})
+}
+
+// issueToken stores a new single-use token and returns its plaintext value.
+func (s *AuthService) issueToken(ctx context.Context, userID uuid.UUID, purpose string, ttl time.Duration) (string, error) {
+	token, err := randomToken()
+	if err != nil {
+		return "", fmt.Errorf("generating token: %w", err)
+	}
+
+	now := time.Now()
+	t := &domain.VerificationToken{
+		ID:        uuid.New(),
+		UserID:    userID,
+		Purpose:   purpose,
+		TokenHash: hashToken(token),
+		ExpiresAt: now.Add(ttl),
+		CreatedAt: now,
+	}
+	if err := s.tokenRepo.Create(ctx, t); err != nil {
+		return "", fmt.Errorf("storing token: %w", err)
+	}
+
+	return token, nil
+}
+
+// consumeToken validates a token for the given purpose and marks it used.
+func (s *AuthService) consumeToken(ctx context.Context, token, purpose string) (*domain.VerificationToken, error) {
+	if token == "" {
+		return nil, ErrInvalidToken
+	}
+
+	t, err := s.tokenRepo.GetByHash(ctx, hashToken(token))
+	if err != nil {
+		return nil, err
+	}
+	if t == nil || t.Purpose != purpose || t.UsedAt != nil || time.Now().After(t.ExpiresAt) {
+		return nil, ErrInvalidToken
+	}
+
+	ok, err := s.tokenRepo.Consume(ctx, t.ID)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrInvalidToken
+	}
+
+	return t, nil
+}
+
+func (s *AuthService) sendMail(ctx context.Context, to string, tmpl mailTemplate, data any) error {
+	if s.mailer == nil {
+		return nil
+	}
+
+	subject, body, err := tmpl.render(data)
+	if err != nil {
+		return fmt.Errorf("rendering email: %w", err)
+	}
+
+	return s.mailer.Send(ctx, to, subject, body)
+}
+
+// humanDuration formats whole hours or minutes for emails, e.g. "1 hour".
+func humanDuration(d time.Duration) string {
+	n, unit := int(d.Minutes()), "minute"
+	if d >= time.Hour && d%time.Hour == 0 {
+		n, unit = int(d.Hours()), "hour"
+	}
+	if n == 1 {
+		return "1 " + unit
+	}
+	return fmt.Sprintf("%d %ss", n, unit)
+}
+
 func hashPassword(password string) (string, error) {
 	salt := make([]byte, 16)
 	if _, err := rand.Read(salt); err != nil {
@@ -0,0 +1,155 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/vedran77/pulse/internal/domain"
+)
+
+const maxBookmarksPerChannel = 50
+
+var (
+	ErrBookmarkNotFound     = errors.New("bookmark not found")
+	ErrBookmarkLimitReached = fmt.Errorf("a channel can have at most %d bookmarks", maxBookmarksPerChannel)
+)
+
+type BookmarkInput struct {
+	Title string `json:"title"`
+	URL   string `json:"url"`
+}
+
+// ListBookmarks returns the links shown in the channel header, oldest first.
+func (s *ChannelService) ListBookmarks(ctx context.Context, userID, channelID uuid.UUID) ([]domain.ChannelBookmark, error) {
+	ctx, span := tracer.Start(ctx, "ChannelService.ListBookmarks")
+	defer span.End()
+
+	if _, err := s.GetByID(ctx, userID, channelID); err != nil {
+		return nil, err
+	}
+
+	bookmarks, err := s.channelRepo.ListBookmarks(ctx, channelID)
+	if err != nil {
+		return nil, err
+	}
+	if bookmarks == nil {
+		bookmarks = []domain.ChannelBookmark{}
+	}
+	return bookmarks, nil
+}
+
+// AddBookmark adds a link to the channel header. Channel admins and
+// workspace admins can manage bookmarks.
+func (s *ChannelService) AddBookmark(ctx context.Context, userID, channelID uuid.UUID, input BookmarkInput) (*domain.ChannelBookmark, error) {
+	ctx, span := tracer.Start(ctx, "ChannelService.AddBookmark")
+	defer span.End()
+
+	if _, err := s.moderatedChannel(ctx, userID, channelID); err != nil {
+		return nil, err
+	}
+
+	existing, err := s.channelRepo.ListBookmarks(ctx, channelID)
+	if err != nil {
+		return nil, err
+	}
+	if len(existing) >= maxBookmarksPerChannel {
+		return nil, ErrBookmarkLimitReached
+	}
+
+	b := &domain.ChannelBookmark{
+		ID:        uuid.New(),
+		ChannelID: channelID,
+		Title:     strings.TrimSpace(input.Title),
+		URL:       strings.TrimSpace(input.URL),
+		CreatedBy: userID,
+		CreatedAt: time.Now(),
+	}
+	if err := s.channelRepo.CreateBookmark(ctx, b); err != nil {
+		return nil, fmt.Errorf("creating bookmark: %w", err)
+	}
+
+	if s.notifier != nil {
+		s.notifier.NotifyBookmarkAdded(b)
+	}
+
+	return b, nil
+}
+
+func (s *ChannelService) UpdateBookmark(ctx context.Context, userID, channelID, bookmarkID uuid.UUID, input BookmarkInput) (*domain.ChannelBookmark, error) {
+	ctx, span := tracer.Start(ctx, "ChannelService.UpdateBookmark")
+	defer span.End()
+
+	b, err := s.moderatedBookmark(ctx, userID, channelID, bookmarkID)
+	if err != nil {
+		return nil, err
+	}
+
+	b.Title = strings.TrimSpace(input.Title)
+	b.URL = strings.TrimSpace(input.URL)
+	if err := s.channelRepo.UpdateBookmark(ctx, b); err != nil {
+		return nil, fmt.Errorf("updating bookmark: %w", err)
+	}
+
+	if s.notifier != nil {
+		s.notifier.NotifyBookmarkUpdated(b)
+	}
+
+	return b, nil
+}
+
+func (s *ChannelService) RemoveBookmark(ctx context.Context, userID, channelID, bookmarkID uuid.UUID) error {
+	ctx, span := tracer.Start(ctx, "ChannelService.RemoveBookmark")
+	defer span.End()
+
+	if _, err := s.moderatedBookmark(ctx, userID, channelID, bookmarkID); err != nil {
+		return err
+	}
+
+	if err := s.channelRepo.DeleteBookmark(ctx, bookmarkID); err != nil {
+		return err
+	}
+
+	if s.notifier != nil {
+		s.notifier.NotifyBookmarkRemoved(channelID, bookmarkID)
+	}
+
+	return nil
+}
+
+// moderatedChannel loads a channel whose pins and bookmarks the user may
+// manage. Archived channels can't be changed.
+func (s *ChannelService) moderatedChannel(ctx context.Context, userID, channelID uuid.UUID) (*domain.Channel, error) {
+	ch, err := getChannel(ctx, s.channelRepo, s.workspaceRepo, channelID)
+	if err != nil {
+		return nil, err
+	}
+	ok, err := canModerateChannel(ctx, s.channelRepo, s.workspaceRepo, userID, ch)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrNotChannelAdmin
+	}
+	if err := checkNotArchived(ch); err != nil {
+		return nil, err
+	}
+	return ch, nil
+}
+
+func (s *ChannelService) moderatedBookmark(ctx context.Context, userID, channelID, bookmarkID uuid.UUID) (*domain.ChannelBookmark, error) {
+	if _, err := s.moderatedChannel(ctx, userID, channelID); err != nil {
+		return nil, err
+	}
+	b, err := s.channelRepo.GetBookmark(ctx, bookmarkID)
+	if err != nil {
+		return nil, err
+	}
+	if b == nil || b.ChannelID != channelID {
+		return nil, ErrBookmarkNotFound
+	}
+	return b, nil
+}
@@ -0,0 +1,195 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/vedran77/pulse/internal/domain"
+	"github.com/vedran77/pulse/internal/repository"
+)
+
+// How many topic changes the history endpoint returns
+const topicHistoryLimit = 50
+
+var (
+	ErrChannelReadOnly    = errors.New("only channel admins can post in this channel")
+	ErrSlowMode           = errors.New("slow mode is on, wait before posting again")
+	ErrInvalidChannelRole = errors.New("channel role must be admin or member")
+	ErrLastChannelAdmin   = errors.New("a channel needs at least one admin")
+)
+
+// SlowModeError is returned when a member posts again before the channel's
+// slow mode cooldown is over. It matches ErrSlowMode with errors.Is.
+type SlowModeError struct {
+	Until time.Time
+}
+
+func (e *SlowModeError) Error() string {
+	return fmt.Sprintf("slow mode is on, you can post again at %s", e.Until.Format(time.RFC3339))
+}
+
+func (e *SlowModeError) Is(target error) bool {
+	return target == ErrSlowMode
+}
+
+// SetTopic changes the channel topic and records the change. An empty topic
+// clears it. In read-only channels only admins can change it.
+func (s *ChannelService) SetTopic(ctx context.Context, userID, channelID uuid.UUID, topic string) (*domain.Channel, error) {
+	ctx, span := tracer.Start(ctx, "ChannelService.SetTopic")
+	defer span.End()
+
+	ch, err := s.GetByID(ctx, userID, channelID)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := checkReadOnly(ctx, s.channelRepo, s.workspaceRepo, userID, ch); err != nil {
+		return nil, err
+	}
+
+	var newTopic *string
+	if topic = strings.TrimSpace(topic); topic != "" {
+		newTopic = &topic
+	}
+	change := &domain.ChannelTopicChange{
+		ID:        uuid.New(),
+		ChannelID: channelID,
+		Topic:     newTopic,
+		ChangedBy: userID,
+		ChangedAt: time.Now(),
+	}
+	err = s.tx.WithinTx(ctx, func(ctx context.Context) error {
+		if err := s.channelRepo.SetTopic(ctx, channelID, newTopic); err != nil {
+			return fmt.Errorf("setting topic: %w", err)
+		}
+		if err := s.channelRepo.AddTopicChange(ctx, change); err != nil {
+			return fmt.Errorf("recording topic change: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	ch.Topic = newTopic
+
+	if s.notifier != nil {
+		s.notifier.NotifyChannelUpdated(ch)
+	}
+
+	return ch, nil
+}
+
+// TopicHistory returns the channel's most recent topic changes, newest first.
+func (s *ChannelService) TopicHistory(ctx context.Context, userID, channelID uuid.UUID) ([]domain.ChannelTopicChange, error) {
+	ctx, span := tracer.Start(ctx, "ChannelService.TopicHistory")
+	defer span.End()
+
+	if _, err := s.GetByID(ctx, userID, channelID); err != nil {
+		return nil, err
+	}
+
+	changes, err := s.channelRepo.ListTopicChanges(ctx, channelID, topicHistoryLimit)
+	if err != nil {
+		return nil, err
+	}
+	if changes == nil {
+		changes = []domain.ChannelTopicChange{}
+	}
+	return changes, nil
+}
+
+// SetMemberRole makes a channel member an admin or a regular member.
+// Channel admins and workspace admins can change roles, but the last
+// channel admin can't be demoted.
+func (s *ChannelService) SetMemberRole(ctx context.Context, requesterID, channelID, userID uuid.UUID, role string) error {
+	ctx, span := tracer.Start(ctx, "ChannelService.SetMemberRole")
+	defer span.End()
+
+	if role != domain.ChannelRoleAdmin && role != domain.ChannelRoleMember {
+		return ErrInvalidChannelRole
+	}
+	if _, err := s.moderatedChannel(ctx, requesterID, channelID); err != nil {
+		return err
+	}
+
+	return s.tx.WithinTx(ctx, func(ctx context.Context) error {
+		members, err := s.channelRepo.ListMembers(ctx, channelID)
+		if err != nil {
+			return err
+		}
+		var target *domain.ChannelMember
+		admins := 0
+		for i := range members {
+			if members[i].UserID == userID {
+				target = &members[i]
+			}
+			if members[i].Role == domain.ChannelRoleAdmin {
+				admins++
+			}
+		}
+		if target == nil {
+			return ErrNotChannelMember
+		}
+		if target.Role == role {
+			return nil
+		}
+		if target.Role == domain.ChannelRoleAdmin && admins == 1 {
+			return ErrLastChannelAdmin
+		}
+		return s.channelRepo.UpdateMemberRole(ctx, channelID, userID, role)
+	})
+}
+
+// checkCanPost enforces the channel's posting rules before a message is
+// sent, and records the post for slow mode if it passes.
+func checkCanPost(ctx context.Context, channelRepo repository.ChannelRepository, workspaceRepo repository.WorkspaceRepository, userID uuid.UUID, ch *domain.Channel) error {
+	admin, err := checkReadOnly(ctx, channelRepo, workspaceRepo, userID, ch)
+	if err != nil || admin || ch.SlowModeSeconds == 0 {
+		return err
+	}
+
+	cooldown := time.Duration(ch.SlowModeSeconds) * time.Second
+	now := time.Now()
+	ok, err := channelRepo.RecordPost(ctx, ch.ID, userID, now, now.Add(-cooldown))
+	if err != nil {
+		return fmt.Errorf("recording post: %w", err)
+	}
+	if ok {
+		return nil
+	}
+	last, err := channelRepo.LastPostAt(ctx, ch.ID, userID)
+	if err != nil {
+		return err
+	}
+	until := now.Add(cooldown)
+	if last != nil {
+		until = last.Add(cooldown)
+	}
+	return &SlowModeError{Until: until}
+}
+
+// checkReadOnly returns ErrChannelArchived if the channel is archived, or
+// ErrChannelReadOnly if only admins can post in it and the user isn't one.
+// It reports whether the user is exempt from the posting rules: channel and
+// workspace admins are. Admins are only looked up when the channel has a rule
+// to enforce.
+func checkReadOnly(ctx context.Context, channelRepo repository.ChannelRepository, workspaceRepo repository.WorkspaceRepository, userID uuid.UUID, ch *domain.Channel) (bool, error) {
+	if err := checkNotArchived(ch); err != nil {
+		return false, err
+	}
+	if ch.PostingPolicy != domain.PostingPolicyAdmins && ch.SlowModeSeconds == 0 {
+		return false, nil
+	}
+
+	admin, err := canModerateChannel(ctx, channelRepo, workspaceRepo, userID, ch)
+	if err != nil {
+		return false, err
+	}
+	if !admin && ch.PostingPolicy == domain.PostingPolicyAdmins {
+		return false, ErrChannelReadOnly
+	}
+	return admin, nil
+}
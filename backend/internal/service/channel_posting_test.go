@@ -0,0 +1,173 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/vedran77/pulse/internal/domain"
+	"github.com/vedran77/pulse/internal/repository/memory"
+)
+
+func TestChannelPostingRules(t *testing.T) {
+	ctx := context.Background()
+	f := newTestWorkspace(t)
+	store, workspaces, channels := f.store, f.workspaces, f.channels
+	alice, bob, channelSvc := f.alice, f.bob, f.channelSvc
+	// Alice creates the channel and is its admin; Bob is a plain member
+	ch := f.channel(t, alice, CreateChannelInput{Name: "announcements", Type: "public"}, bob)
+	svc := NewMessageService(memory.NewMessageRepo(store), channels, workspaces)
+	send := func(user domain.User) error {
+		_, err := svc.Send(ctx, user.ID, ch.ID, SendMessageInput{Content: "hello"})
+		return err
+	}
+	update := func(input UpdateChannelInput) {
+		t.Helper()
+		if _, err := channelSvc.Update(ctx, alice.ID, ch.ID, input); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	t.Run("read-only", func(t *testing.T) {
+		admins := domain.PostingPolicyAdmins
+		update(UpdateChannelInput{PostingPolicy: &admins})
+
+		if err := send(*bob); !errors.Is(err, ErrChannelReadOnly) {
+			t.Fatalf("member posting: err = %v", err)
+		}
+		if _, err := channelSvc.SetTopic(ctx, bob.ID, ch.ID, "derailed"); !errors.Is(err, ErrChannelReadOnly) {
+			t.Fatalf("member setting the topic: err = %v", err)
+		}
+		if err := send(*alice); err != nil {
+			t.Fatalf("admin posting: %v", err)
+		}
+
+		everyone := domain.PostingPolicyEveryone
+		update(UpdateChannelInput{PostingPolicy: &everyone})
+		if err := send(*bob); err != nil {
+			t.Fatalf("posting after read-only mode: %v", err)
+		}
+	})
+
+	t.Run("slow mode", func(t *testing.T) {
+		minute := 60
+		update(UpdateChannelInput{SlowModeSeconds: &minute})
+
+		if err := send(*bob); err != nil {
+			t.Fatal(err)
+		}
+		var slow *SlowModeError
+		if err := send(*bob); !errors.As(err, &slow) || !errors.Is(err, ErrSlowMode) {
+			t.Fatalf("second post within the cooldown: err = %v", err)
+		}
+		if wait := time.Until(slow.Until); wait <= 50*time.Second || wait > time.Minute {
+			t.Fatalf("retry in %v, want about a minute", wait)
+		}
+		// Admins are exempt
+		for range 2 {
+			if err := send(*alice); err != nil {
+				t.Fatalf("admin posting in slow mode: %v", err)
+			}
+		}
+	})
+
+	t.Run("roles", func(t *testing.T) {
+		if err := channelSvc.SetMemberRole(ctx, bob.ID, ch.ID, bob.ID, domain.ChannelRoleAdmin); !errors.Is(err, ErrNotChannelAdmin) {
+			t.Fatalf("member promoting themselves: err = %v", err)
+		}
+		if err := channelSvc.SetMemberRole(ctx, alice.ID, ch.ID, bob.ID, "owner"); !errors.Is(err, ErrInvalidChannelRole) {
+			t.Fatalf("unknown role: err = %v", err)
+		}
+		if err := channelSvc.SetMemberRole(ctx, alice.ID, ch.ID, alice.ID, domain.ChannelRoleMember); !errors.Is(err, ErrLastChannelAdmin) {
+			t.Fatalf("demoting the last admin: err = %v", err)
+		}
+
+		if err := channelSvc.SetMemberRole(ctx, alice.ID, ch.ID, bob.ID, domain.ChannelRoleAdmin); err != nil {
+			t.Fatal(err)
+		}
+		// Now an admin, Bob skips the slow mode cooldown
+		if err := send(*bob); err != nil {
+			t.Fatalf("new admin posting in slow mode: %v", err)
+		}
+		if err := channelSvc.SetMemberRole(ctx, bob.ID, ch.ID, alice.ID, domain.ChannelRoleMember); err != nil {
+			t.Fatalf("demoting with another admin left: %v", err)
+		}
+	})
+
+	t.Run("topic", func(t *testing.T) {
+		if _, err := channelSvc.SetTopic(ctx, bob.ID, ch.ID, "  Release notes only  "); err != nil {
+			t.Fatal(err)
+		}
+		got, err := channelSvc.SetTopic(ctx, bob.ID, ch.ID, "")
+		if err != nil || got.Topic != nil {
+			t.Fatalf("clearing the topic = %+v, %v", got, err)
+		}
+
+		history, err := channelSvc.TopicHistory(ctx, alice.ID, ch.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(history) != 2 || history[0].Topic != nil || *history[1].Topic != "Release notes only" || history[1].ChangedBy != bob.ID {
+			t.Fatalf("TopicHistory = %+v", history)
+		}
+	})
+}
+
+func TestArchivedChannelIsReadOnly(t *testing.T) {
+	ctx := context.Background()
+	f := newTestWorkspace(t)
+	store, workspaces, channels := f.store, f.workspaces, f.channels
+	alice, ws, channelSvc := f.alice, f.ws, f.channelSvc
+	ch := f.channel(t, alice, CreateChannelInput{Name: "old-project", Type: "public"})
+	svc := NewMessageService(memory.NewMessageRepo(store), channels, workspaces)
+	msg, err := svc.Send(ctx, alice.ID, ch.ID, SendMessageInput{Content: "wrapping up"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := channelSvc.Archive(ctx, alice.ID, ch.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.Send(ctx, alice.ID, ch.ID, SendMessageInput{Content: "one more thing"}); !errors.Is(err, ErrChannelArchived) {
+		t.Fatalf("posting: err = %v", err)
+	}
+	if _, err := svc.Edit(ctx, alice.ID, msg.ID, EditMessageInput{Content: "edited"}); !errors.Is(err, ErrChannelArchived) {
+		t.Fatalf("editing: err = %v", err)
+	}
+	if _, err := svc.Pin(ctx, alice.ID, msg.ID); !errors.Is(err, ErrChannelArchived) {
+		t.Fatalf("pinning: err = %v", err)
+	}
+	if _, err := channelSvc.SetTopic(ctx, alice.ID, ch.ID, "done"); !errors.Is(err, ErrChannelArchived) {
+		t.Fatalf("setting the topic: err = %v", err)
+	}
+	// Archived channels can still be read
+	if list, err := svc.List(ctx, alice.ID, ch.ID, PageInput{}, nil); err != nil || len(list.Messages) != 1 {
+		t.Fatalf("List = %+v, %v", list, err)
+	}
+
+	listed := func(includeArchived bool) bool {
+		t.Helper()
+		list, err := channelSvc.ListByWorkspace(ctx, alice.ID, ws.ID, includeArchived, PageInput{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, c := range list.Channels {
+			if c.ID == ch.ID {
+				return true
+			}
+		}
+		return false
+	}
+	if listed(false) || !listed(true) {
+		t.Fatal("archived channel should only be listed with includeArchived")
+	}
+
+	got, err := channelSvc.Unarchive(ctx, alice.ID, ch.ID)
+	if err != nil || got.ArchivedAt != nil {
+		t.Fatalf("Unarchive = %+v, %v", got, err)
+	}
+	if _, err := svc.Send(ctx, alice.ID, ch.ID, SendMessageInput{Content: "back again"}); err != nil {
+		t.Fatalf("posting after unarchiving: %v", err)
+	}
+}
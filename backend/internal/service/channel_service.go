@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"log/slog"
 	"time"
 
 	"github.com/google/uuid"
@@ -16,20 +17,29 @@ var (
 	ErrChannelNameTaken = errors.New("channel name already exists in this workspace")
 	ErrNotChannelAdmin  = errors.New("only channel admin can perform this action")
 	ErrNotChannelMember = errors.New("user is not a member of this channel")
+	ErrChannelArchived  = errors.New("channel is archived")
 )
 
 type ChannelService struct {
 	channelRepo   repository.ChannelRepository
 	workspaceRepo repository.WorkspaceRepository
+	tx            repository.TxManager
+	notifier      Notifier
 }
 
-func NewChannelService(channelRepo repository.ChannelRepository, workspaceRepo repository.WorkspaceRepository) *ChannelService {
+func NewChannelService(channelRepo repository.ChannelRepository, workspaceRepo repository.WorkspaceRepository, tx repository.TxManager) *ChannelService {
 	return &ChannelService{
 		channelRepo:   channelRepo,
 		workspaceRepo: workspaceRepo,
+		tx:            tx,
 	}
 }
 
+// SetNotifier sets the real-time notifier (optional dependency).
+func (s *ChannelService) SetNotifier(n Notifier) {
+	s.notifier = n
+}
+
 type CreateChannelInput struct {
 	Name        string `json:"name"`
 	Description string `json:"description"`
@@ -37,13 +47,18 @@ type CreateChannelInput struct {
 }
 
 type UpdateChannelInput struct {
-	Name        *string `json:"name"`
-	Description *string `json:"description"`
+	Name            *string `json:"name"`
+	Description     *string `json:"description"`
+	PostingPolicy   *string `json:"posting_policy"`
+	SlowModeSeconds *int    `json:"slow_mode_seconds"`
 }
 
 func (s *ChannelService) Create(ctx context.Context, userID, workspaceID uuid.UUID, input CreateChannelInput) (*domain.Channel, error) {
+	ctx, span := tracer.Start(ctx, "ChannelService.Create")
+	defer span.End()
+
 	// Provjeri da je user member workspace-a
-	member, err := s.workspaceRepo.GetMember(ctx, workspaceID, userID)
+	member, err := workspaceMember(ctx, s.workspaceRepo, workspaceID, userID)
 	if err != nil {
 		return nil, err
 	}
@@ -62,22 +77,15 @@ func (s *ChannelService) Create(ctx context.Context, userID, workspaceID uuid.UU
 	}
 
 	ch := &domain.Channel{
-		ID:          uuid.New(),
-		WorkspaceID: workspaceID,
-		Name:        input.Name,
-		Description: desc,
-		Type:        chType,
-		IsEncrypted: false,
-		CreatedBy:   userID,
-		CreatedAt:   time.Now(),
-	}
-
-	if err := s.channelRepo.Create(ctx, ch); err != nil {
-		// Unique constraint violation = duplicate name
-		if isDuplicateError(err) {
-			return nil, ErrChannelNameTaken
-		}
-		return nil, fmt.Errorf("creating channel: %w", err)
+		ID:            uuid.New(),
+		WorkspaceID:   workspaceID,
+		Name:          input.Name,
+		Description:   desc,
+		Type:          chType,
+		IsEncrypted:   false,
+		PostingPolicy: domain.PostingPolicyEveryone,
+		CreatedBy:     userID,
+		CreatedAt:     time.Now(),
 	}
 
 	// Dodaj creatora kao admin membera
@@ -87,21 +95,35 @@ func (s *ChannelService) Create(ctx context.Context, userID, workspaceID uuid.UU
 		Role:      "admin",
 		JoinedAt:  time.Now(),
 	}
-	if err := s.channelRepo.AddMember(ctx, cm); err != nil {
-		return nil, fmt.Errorf("adding creator as member: %w", err)
+
+	err = s.tx.WithinTx(ctx, func(ctx context.Context) error {
+		if err := s.channelRepo.Create(ctx, ch); err != nil {
+			// Unique constraint violation = duplicate name
+			if isDuplicateError(err) {
+				return ErrChannelNameTaken
+			}
+			return fmt.Errorf("creating channel: %w", err)
+		}
+		if err := s.channelRepo.AddMember(ctx, cm); err != nil {
+			return fmt.Errorf("adding creator as member: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
 
 	return ch, nil
 }
 
 func (s *ChannelService) GetByID(ctx context.Context, userID, channelID uuid.UUID) (*domain.Channel, error) {
-	ch, err := s.channelRepo.GetByID(ctx, channelID)
+	ctx, span := tracer.Start(ctx, "ChannelService.GetByID")
+	defer span.End()
+
+	ch, err := getChannel(ctx, s.channelRepo, s.workspaceRepo, channelID)
 	if err != nil {
 		return nil, err
 	}
-	if ch == nil {
-		return nil, ErrChannelNotFound
-	}
 
 	// Public kanali su vidljivi svim memberima workspace-a
 	if ch.Type == "public" {
@@ -126,9 +148,19 @@ func (s *ChannelService) GetByID(ctx context.Context, userID, channelID uuid.UUI
 	return ch, nil
 }
 
-func (s *ChannelService) ListByWorkspace(ctx context.Context, userID, workspaceID uuid.UUID) ([]domain.Channel, error) {
+type ChannelListResponse struct {
+	Channels []domain.Channel `json:"channels"`
+	PageCursors
+}
+
+// ListByWorkspace returns a page of the workspace's channels, oldest first,
+// with archived ones only if includeArchived is set.
+func (s *ChannelService) ListByWorkspace(ctx context.Context, userID, workspaceID uuid.UUID, includeArchived bool, input PageInput) (*ChannelListResponse, error) {
+	ctx, span := tracer.Start(ctx, "ChannelService.ListByWorkspace")
+	defer span.End()
+
 	// Provjeri membership
-	member, err := s.workspaceRepo.GetMember(ctx, workspaceID, userID)
+	member, err := workspaceMember(ctx, s.workspaceRepo, workspaceID, userID)
 	if err != nil {
 		return nil, err
 	}
@@ -136,17 +168,25 @@ func (s *ChannelService) ListByWorkspace(ctx context.Context, userID, workspaceI
 		return nil, ErrNotMember
 	}
 
-	return s.channelRepo.ListByWorkspace(ctx, workspaceID)
+	channels, cursors, err := listPage(input, false, func(ch domain.Channel) repository.PageKey {
+		return repository.PageKey{Time: ch.CreatedAt, ID: ch.ID}
+	}, func(page repository.Page) ([]domain.Channel, error) {
+		return s.channelRepo.ListByWorkspace(ctx, workspaceID, includeArchived, page)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &ChannelListResponse{Channels: channels, PageCursors: cursors}, nil
 }
 
 func (s *ChannelService) Update(ctx context.Context, userID, channelID uuid.UUID, input UpdateChannelInput) (*domain.Channel, error) {
-	ch, err := s.channelRepo.GetByID(ctx, channelID)
+	ctx, span := tracer.Start(ctx, "ChannelService.Update")
+	defer span.End()
+
+	ch, err := getChannel(ctx, s.channelRepo, s.workspaceRepo, channelID)
 	if err != nil {
 		return nil, err
 	}
-	if ch == nil {
-		return nil, ErrChannelNotFound
-	}
 
 	// Samo admin ili creator
 	cm, err := s.channelRepo.GetMember(ctx, channelID, userID)
@@ -156,6 +196,9 @@ func (s *ChannelService) Update(ctx context.Context, userID, channelID uuid.UUID
 	if cm == nil || (cm.Role != "admin" && ch.CreatedBy != userID) {
 		return nil, ErrNotChannelAdmin
 	}
+	if err := checkNotArchived(ch); err != nil {
+		return nil, err
+	}
 
 	if input.Name != nil {
 		ch.Name = *input.Name
@@ -163,6 +206,12 @@ func (s *ChannelService) Update(ctx context.Context, userID, channelID uuid.UUID
 	if input.Description != nil {
 		ch.Description = input.Description
 	}
+	if input.PostingPolicy != nil {
+		ch.PostingPolicy = *input.PostingPolicy
+	}
+	if input.SlowModeSeconds != nil {
+		ch.SlowModeSeconds = *input.SlowModeSeconds
+	}
 
 	if err := s.channelRepo.Update(ctx, ch); err != nil {
 		if isDuplicateError(err) {
@@ -171,38 +220,90 @@ func (s *ChannelService) Update(ctx context.Context, userID, channelID uuid.UUID
 		return nil, fmt.Errorf("updating channel: %w", err)
 	}
 
+	if s.notifier != nil {
+		s.notifier.NotifyChannelUpdated(ch)
+	}
+
 	return ch, nil
 }
 
+// Archive makes the channel read-only and hides it from the channel list.
+// Archiving an archived channel does nothing.
 func (s *ChannelService) Archive(ctx context.Context, userID, channelID uuid.UUID) error {
-	ch, err := s.channelRepo.GetByID(ctx, channelID)
-	if err != nil {
+	ctx, span := tracer.Start(ctx, "ChannelService.Archive")
+	defer span.End()
+
+	ch, err := s.archivableChannel(ctx, userID, channelID)
+	if err != nil || ch.ArchivedAt != nil {
 		return err
 	}
-	if ch == nil {
-		return ErrChannelNotFound
+
+	if err := s.channelRepo.Archive(ctx, channelID); err != nil {
+		return fmt.Errorf("archiving channel: %w", err)
+	}
+
+	if s.notifier != nil {
+		now := time.Now()
+		ch.ArchivedAt = &now
+		s.notifier.NotifyChannelUpdated(ch)
+	}
+
+	return nil
+}
+
+// Unarchive makes an archived channel writable again.
+func (s *ChannelService) Unarchive(ctx context.Context, userID, channelID uuid.UUID) (*domain.Channel, error) {
+	ctx, span := tracer.Start(ctx, "ChannelService.Unarchive")
+	defer span.End()
+
+	ch, err := s.archivableChannel(ctx, userID, channelID)
+	if err != nil {
+		return nil, err
+	}
+	if ch.ArchivedAt == nil {
+		return ch, nil
+	}
+
+	now := time.Now()
+	if err := s.channelRepo.Unarchive(ctx, channelID, now); err != nil {
+		return nil, fmt.Errorf("unarchiving channel: %w", err)
+	}
+	ch.ArchivedAt = nil
+	ch.UnarchivedAt = &now
+
+	if s.notifier != nil {
+		s.notifier.NotifyChannelUpdated(ch)
+	}
+
+	return ch, nil
+}
+
+// archivableChannel loads a channel the user may archive or unarchive.
+func (s *ChannelService) archivableChannel(ctx context.Context, userID, channelID uuid.UUID) (*domain.Channel, error) {
+	ch, err := getChannel(ctx, s.channelRepo, s.workspaceRepo, channelID)
+	if err != nil {
+		return nil, err
 	}
 
 	// Samo workspace owner ili channel creator
 	wsMember, err := s.workspaceRepo.GetMember(ctx, ch.WorkspaceID, userID)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	if wsMember == nil || (wsMember.Role != "owner" && ch.CreatedBy != userID) {
-		return ErrNotChannelAdmin
+		return nil, ErrNotChannelAdmin
 	}
-
-	return s.channelRepo.Archive(ctx, channelID)
+	return ch, nil
 }
 
 func (s *ChannelService) AddMember(ctx context.Context, requesterID, channelID, userID uuid.UUID) error {
-	ch, err := s.channelRepo.GetByID(ctx, channelID)
+	ctx, span := tracer.Start(ctx, "ChannelService.AddMember")
+	defer span.End()
+
+	ch, err := getChannel(ctx, s.channelRepo, s.workspaceRepo, channelID)
 	if err != nil {
 		return err
 	}
-	if ch == nil {
-		return ErrChannelNotFound
-	}
 
 	// Za public kanale, bilo koji workspace member može joinati
 	if ch.Type == "public" {
@@ -243,6 +344,12 @@ func (s *ChannelService) AddMember(ctx context.Context, requesterID, channelID,
 }
 
 func (s *ChannelService) RemoveMember(ctx context.Context, requesterID, channelID, userID uuid.UUID) error {
+	ctx, span := tracer.Start(ctx, "ChannelService.RemoveMember")
+	defer span.End()
+
+	if _, err := getChannel(ctx, s.channelRepo, s.workspaceRepo, channelID); err != nil {
+		return err
+	}
 	cm, err := s.channelRepo.GetMember(ctx, channelID, requesterID)
 	if err != nil {
 		return err
@@ -255,13 +362,13 @@ func (s *ChannelService) RemoveMember(ctx context.Context, requesterID, channelI
 }
 
 func (s *ChannelService) ListMembers(ctx context.Context, userID, channelID uuid.UUID) ([]domain.ChannelMember, error) {
-	ch, err := s.channelRepo.GetByID(ctx, channelID)
+	ctx, span := tracer.Start(ctx, "ChannelService.ListMembers")
+	defer span.End()
+
+	ch, err := getChannel(ctx, s.channelRepo, s.workspaceRepo, channelID)
 	if err != nil {
 		return nil, err
 	}
-	if ch == nil {
-		return nil, ErrChannelNotFound
-	}
 
 	// Provjeri pristup
 	wsMember, err := s.workspaceRepo.GetMember(ctx, ch.WorkspaceID, userID)
@@ -275,6 +382,68 @@ func (s *ChannelService) ListMembers(ctx context.Context, userID, channelID uuid
 	return s.channelRepo.ListMembers(ctx, channelID)
 }
 
+// canModerateChannel reports whether the user may manage the channel's pins
+// and bookmarks: channel admins and workspace owners and admins can.
+func canModerateChannel(ctx context.Context, channelRepo repository.ChannelRepository, workspaceRepo repository.WorkspaceRepository, userID uuid.UUID, ch *domain.Channel) (bool, error) {
+	cm, err := channelRepo.GetMember(ctx, ch.ID, userID)
+	if err != nil {
+		return false, err
+	}
+	if cm != nil && cm.Role == "admin" {
+		return true, nil
+	}
+
+	wsMember, err := workspaceRepo.GetMember(ctx, ch.WorkspaceID, userID)
+	if err != nil {
+		return false, err
+	}
+	return wsMember != nil && (wsMember.Role == "owner" || wsMember.Role == "admin"), nil
+}
+
+// RunAutoArchive archives channels that have been inactive for longer than
+// their workspace's auto-archive policy, every interval until ctx is
+// cancelled. Several instances can run it at once.
+func (s *ChannelService) RunAutoArchive(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := s.archiveInactive(ctx, time.Now()); err != nil && ctx.Err() == nil {
+			slog.ErrorContext(ctx, "auto-archiving channels", "err", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// archiveInactive archives the channels that are inactive at now and tells
+// their members.
+func (s *ChannelService) archiveInactive(ctx context.Context, now time.Time) error {
+	channels, err := s.channelRepo.ArchiveInactive(ctx, now)
+	if err != nil {
+		return err
+	}
+	for i := range channels {
+		slog.InfoContext(ctx, "auto-archived channel", "channel_id", channels[i].ID, "workspace_id", channels[i].WorkspaceID)
+		if s.notifier != nil {
+			s.notifier.NotifyChannelUpdated(&channels[i])
+		}
+	}
+	return nil
+}
+
+// checkNotArchived returns ErrChannelArchived for archived channels, which
+// are read-only until they're unarchived.
+func checkNotArchived(ch *domain.Channel) error {
+	if ch.ArchivedAt != nil {
+		return ErrChannelArchived
+	}
+	return nil
+}
+
 // Helper za detekciju duplicate key errora iz pgx
 func isDuplicateError(err error) bool {
 	return err != nil && (errors.Is(err, errors.New("unique_violation")) ||
@@ -0,0 +1,158 @@
+package service
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+
+	"github.com/vedran77/pulse/internal/repository"
+)
+
+const (
+	defaultPageSize = 50
+	maxPageSize     = 100
+)
+
+var ErrInvalidCursor = errors.New("invalid page cursor")
+
+// PageInput asks for one page of a list. Before and After are cursors from
+// an earlier page; at most one can be set.
+type PageInput struct {
+	Before string
+	After  string
+	Limit  int
+}
+
+// PageCursors point at the pages on either side of a page, and are empty
+// when there's nothing more in that direction.
+type PageCursors struct {
+	// Pass as before to get the preceding page
+	Prev string `json:"prev_cursor,omitempty"`
+	// Pass as after to get the following page
+	Next string `json:"next_cursor,omitempty"`
+}
+
+// encodeCursor turns a position in a list into an opaque token clients pass
+// back to fetch the next page.
+func encodeCursor(pos any) string {
+	b, _ := json.Marshal(pos)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// decodeCursor reads a token made by encodeCursor into pos.
+func decodeCursor(cursor string, pos any) error {
+	b, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil || json.Unmarshal(b, pos) != nil {
+		return ErrInvalidCursor
+	}
+	return nil
+}
+
+// cursorKey decodes a list cursor, which may be empty.
+func cursorKey[K any](cursor string) (*K, error) {
+	if cursor == "" {
+		return nil, nil
+	}
+	var pos K
+	if err := decodeCursor(cursor, &pos); err != nil {
+		return nil, err
+	}
+	return &pos, nil
+}
+
+// pageSize returns the requested page size, or the default if it's out of range.
+func pageSize(limit int) int {
+	if limit <= 0 || limit > maxPageSize {
+		return defaultPageSize
+	}
+	return limit
+}
+
+// listPage fetches the page of a list the input asks for. It asks list for
+// one row more than the page size to learn whether there are more rows past
+// the page. fromEnd is for lists that start at their end without a cursor.
+func listPage[T any](input PageInput, fromEnd bool, key func(T) repository.PageKey, list func(repository.Page) ([]T, error)) ([]T, PageCursors, error) {
+	return keysetPage(input, fromEnd, key, func(before, after *repository.PageKey, limit int) ([]T, error) {
+		return list(repository.Page{Before: before, After: after, Limit: limit})
+	})
+}
+
+// keysetPage is listPage for lists ordered by some other key than
+// repository.PageKey, such as search results.
+func keysetPage[T, K any](input PageInput, fromEnd bool, key func(T) K, list func(before, after *K, limit int) ([]T, error)) ([]T, PageCursors, error) {
+	if input.Before != "" && input.After != "" {
+		return nil, PageCursors{}, ErrInvalidCursor
+	}
+	limit := pageSize(input.Limit)
+	before, err := cursorKey[K](input.Before)
+	if err != nil {
+		return nil, PageCursors{}, err
+	}
+	after, err := cursorKey[K](input.After)
+	if err != nil {
+		return nil, PageCursors{}, err
+	}
+
+	items, err := list(before, after, limit+1)
+	if err != nil {
+		return nil, PageCursors{}, err
+	}
+
+	// A backwards page ends at the cursor, so the extra row is its first
+	backwards := before != nil || (after == nil && fromEnd)
+	more := len(items) > limit
+	if more && backwards {
+		items = items[1:]
+	} else if more {
+		items = items[:limit]
+	}
+	if len(items) == 0 {
+		return []T{}, PageCursors{}, nil
+	}
+
+	var cursors PageCursors
+	first, last := encodeCursor(key(items[0])), encodeCursor(key(items[len(items)-1]))
+	if (backwards && more) || after != nil {
+		cursors.Prev = first
+	}
+	if (!backwards && more) || before != nil {
+		cursors.Next = last
+	}
+	return items, cursors, nil
+}
+
+// pageAround returns up to limit rows of a list centred on target, for
+// jumping to a row such as a search result.
+func pageAround[T any](target T, limit int, key func(T) repository.PageKey, list func(repository.Page) ([]T, error)) ([]T, PageCursors, error) {
+	limit = pageSize(limit)
+	pos := key(target)
+	beforeLimit := (limit - 1) / 2
+	afterLimit := limit - 1 - beforeLimit
+
+	before, err := list(repository.Page{Before: &pos, Limit: beforeLimit + 1})
+	if err != nil {
+		return nil, PageCursors{}, err
+	}
+	after, err := list(repository.Page{After: &pos, Limit: afterLimit + 1})
+	if err != nil {
+		return nil, PageCursors{}, err
+	}
+
+	moreBefore, moreAfter := len(before) > beforeLimit, len(after) > afterLimit
+	if moreBefore {
+		before = before[1:]
+	}
+	if moreAfter {
+		after = after[:afterLimit]
+	}
+	items := append(append(before, target), after...)
+
+	var cursors PageCursors
+	if moreBefore {
+		cursors.Prev = encodeCursor(key(items[0]))
+	}
+	if moreAfter {
+		cursors.Next = encodeCursor(key(items[len(items)-1]))
+	}
+	return items, cursors, nil
+}
@@ -0,0 +1,118 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/vedran77/pulse/internal/domain"
+	"github.com/vedran77/pulse/internal/repository/memory"
+)
+
+func TestMessagePagination(t *testing.T) {
+	ctx := context.Background()
+	f := newTestWorkspace(t)
+	store, workspaces, channels := f.store, f.workspaces, f.channels
+	alice := f.alice
+	messages := memory.NewMessageRepo(store)
+	ch := f.channel(t, alice, CreateChannelInput{Name: "history", Type: "public"})
+
+	// Seven messages, the last three posted in the same instant
+	base := time.Now().Add(-time.Hour)
+	var sent []uuid.UUID
+	for i := range 7 {
+		content := "hello"
+		msg := &domain.Message{
+			ID: uuid.New(), ChannelID: ch.ID, SenderID: alice.ID, Content: &content, Type: "text",
+			CreatedAt: base.Add(time.Duration(min(i, 4)) * time.Minute),
+		}
+		if err := messages.Create(ctx, msg); err != nil {
+			t.Fatal(err)
+		}
+		sent = append(sent, msg.ID)
+	}
+	// Messages with the same timestamp are ordered by ID
+	slices.SortFunc(sent[4:], func(a, b uuid.UUID) int { return bytes.Compare(a[:], b[:]) })
+
+	svc := NewMessageService(messages, channels, workspaces)
+	list := func(input PageInput, around *uuid.UUID) *MessageListResponse {
+		t.Helper()
+		resp, err := svc.List(ctx, alice.ID, ch.ID, input, around)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+	expect := func(name string, resp *MessageListResponse, want ...uuid.UUID) {
+		t.Helper()
+		var got []uuid.UUID
+		for _, m := range resp.Messages {
+			got = append(got, m.ID)
+		}
+		if len(got) != len(want) {
+			t.Fatalf("%s: got %d messages, want %d", name, len(got), len(want))
+		}
+		for i := range want {
+			if got[i] != want[i] {
+				t.Fatalf("%s: message %d = %s, want %s", name, i, got[i], want[i])
+			}
+		}
+	}
+
+	t.Run("backwards from the newest", func(t *testing.T) {
+		page := list(PageInput{Limit: 3}, nil)
+		expect("newest", page, sent[4:]...)
+		if !page.HasMore || page.Prev == "" || page.Next != "" {
+			t.Fatalf("newest cursors = %+v, has_more = %v", page.PageCursors, page.HasMore)
+		}
+		page = list(PageInput{Before: page.Prev, Limit: 3}, nil)
+		expect("middle", page, sent[1:4]...)
+		page = list(PageInput{Before: page.Prev, Limit: 3}, nil)
+		expect("oldest", page, sent[0])
+		if page.HasMore || page.Prev != "" || page.Next == "" {
+			t.Fatalf("oldest cursors = %+v", page.PageCursors)
+		}
+
+		// And forwards again, through the tied messages
+		page = list(PageInput{After: page.Next, Limit: 5}, nil)
+		expect("forwards", page, sent[1:6]...)
+		page = list(PageInput{After: page.Next, Limit: 5}, nil)
+		expect("forwards to the end", page, sent[6])
+		if page.Next != "" || page.Prev == "" {
+			t.Fatalf("end cursors = %+v", page.PageCursors)
+		}
+	})
+
+	t.Run("around", func(t *testing.T) {
+		page := list(PageInput{Limit: 3}, &sent[2])
+		expect("around", page, sent[1:4]...)
+		if page.Prev == "" || page.Next == "" {
+			t.Fatalf("around cursors = %+v", page.PageCursors)
+		}
+		expect("around first", list(PageInput{Limit: 3}, &sent[0]), sent[0:2]...)
+
+		missing := uuid.New()
+		if _, err := svc.List(ctx, alice.ID, ch.ID, PageInput{}, &missing); !errors.Is(err, ErrMessageNotFound) {
+			t.Fatalf("around a missing message: err = %v", err)
+		}
+		if _, err := svc.List(ctx, alice.ID, ch.ID, PageInput{Before: page.Prev}, &sent[2]); !errors.Is(err, ErrInvalidCursor) {
+			t.Fatalf("around with a cursor: err = %v", err)
+		}
+	})
+
+	t.Run("invalid cursors", func(t *testing.T) {
+		page := list(PageInput{Limit: 3}, nil)
+		for _, input := range []PageInput{
+			{Before: "not a cursor"},
+			{Before: page.Prev, After: page.Prev},
+		} {
+			if _, err := svc.List(ctx, alice.ID, ch.ID, input, nil); !errors.Is(err, ErrInvalidCursor) {
+				t.Fatalf("List(%+v): err = %v", input, err)
+			}
+		}
+	})
+}
@@ -4,10 +4,12 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/vedran77/pulse/internal/domain"
+	"github.com/vedran77/pulse/internal/markup"
 	"github.com/vedran77/pulse/internal/repository"
 )
 
@@ -20,10 +22,14 @@ var (
 	ErrUserNotFound           = errors.New("user not found")
 )
 
+// Last message previews in the conversation list are cut to this many characters
+const dmPreviewLength = 100
+
 type DMService struct {
 	dmRepo   repository.DMRepository
 	userRepo repository.UserRepository
 	notifier Notifier
+	isOnline func(userID uuid.UUID) bool
 }
 
 func NewDMService(dmRepo repository.DMRepository, userRepo repository.UserRepository) *DMService {
@@ -37,13 +43,37 @@ func (s *DMService) SetNotifier(n Notifier) {
 	s.notifier = n
 }
 
+// SetPresence sets how to tell whether a user is connected (optional
+// dependency). Without it everyone shows as offline.
+func (s *DMService) SetPresence(isOnline func(userID uuid.UUID) bool) {
+	s.isOnline = isOnline
+}
+
+// presence returns the user's status for the conversation list.
+func (s *DMService) presence(userID uuid.UUID) string {
+	if s.isOnline != nil && s.isOnline(userID) {
+		return "online"
+	}
+	return "offline"
+}
+
 type DMMessageListResponse struct {
 	Messages []domain.DMMessage `json:"messages"`
-	HasMore  bool               `json:"has_more"`
+	// Older messages exist, same as prev_cursor being set
+	HasMore bool `json:"has_more"`
+	PageCursors
+}
+
+type ConversationListResponse struct {
+	Conversations []domain.DMConversation `json:"conversations"`
+	PageCursors
 }
 
 // GetOrCreateConversation finds or creates a DM conversation between two users.
 func (s *DMService) GetOrCreateConversation(ctx context.Context, userID, otherUserID uuid.UUID) (*domain.DMConversation, error) {
+	ctx, span := tracer.Start(ctx, "DMService.GetOrCreateConversation")
+	defer span.End()
+
 	if userID == otherUserID {
 		return nil, ErrCannotDMSelf
 	}
@@ -53,7 +83,7 @@ func (s *DMService) GetOrCreateConversation(ctx context.Context, userID, otherUs
 	if err != nil {
 		return nil, err
 	}
-	if other == nil {
+	if other == nil || other.DeletedAt != nil {
 		return nil, ErrUserNotFound
 	}
 
@@ -69,10 +99,23 @@ func (s *DMService) GetOrCreateConversation(ctx context.Context, userID, otherUs
 		return nil, err
 	}
 	if conv != nil {
+		// Opening a hidden conversation brings it back to the list
+		p, err := s.dmRepo.GetParticipant(ctx, conv.ID, userID)
+		if err != nil {
+			return nil, err
+		}
+		if p != nil && p.HiddenAt != nil {
+			p.HiddenAt = nil
+			if err := s.dmRepo.SaveParticipant(ctx, p); err != nil {
+				return nil, err
+			}
+		}
 		// Fill in other user info
 		conv.OtherUserID = otherUserID
 		conv.OtherUserUsername = other.Username
 		conv.OtherUserDisplayName = other.DisplayName
+		conv.OtherUserStatus = s.presence(otherUserID)
+		conv.LastActivityAt = conv.CreatedAt
 		return conv, nil
 	}
 
@@ -86,7 +129,9 @@ func (s *DMService) GetOrCreateConversation(ctx context.Context, userID, otherUs
 		OtherUserID:          otherUserID,
 		OtherUserUsername:    other.Username,
 		OtherUserDisplayName: other.DisplayName,
+		OtherUserStatus:      s.presence(otherUserID),
 	}
+	conv.LastActivityAt = conv.CreatedAt
 
 	if err := s.dmRepo.CreateConversation(ctx, conv); err != nil {
 		return nil, fmt.Errorf("creating dm conversation: %w", err)
@@ -95,20 +140,110 @@ func (s *DMService) GetOrCreateConversation(ctx context.Context, userID, otherUs
 	return conv, nil
 }
 
-// ListConversations returns all DM conversations for a user.
-func (s *DMService) ListConversations(ctx context.Context, userID uuid.UUID) ([]domain.DMConversation, error) {
-	convs, err := s.dmRepo.ListConversations(ctx, userID)
+// ListConversations returns a page of the user's DM conversations, most
+// recently active first, with a preview of the last message and the number
+// of unread messages. Hidden conversations are left out until a new message.
+func (s *DMService) ListConversations(ctx context.Context, userID uuid.UUID, input PageInput) (*ConversationListResponse, error) {
+	ctx, span := tracer.Start(ctx, "DMService.ListConversations")
+	defer span.End()
+
+	convs, cursors, err := listPage(input, false, func(c domain.DMConversation) repository.PageKey {
+		return repository.PageKey{Time: c.LastActivityAt, ID: c.ID}
+	}, func(page repository.Page) ([]domain.DMConversation, error) {
+		return s.dmRepo.ListConversations(ctx, userID, page)
+	})
 	if err != nil {
 		return nil, err
 	}
-	if convs == nil {
-		convs = []domain.DMConversation{}
+	for i := range convs {
+		convs[i].OtherUserStatus = s.presence(convs[i].OtherUserID)
+		if last := convs[i].LastMessage; last != nil {
+			last.Content = previewText(last.Content, dmPreviewLength)
+		}
 	}
-	return convs, nil
+	return &ConversationListResponse{Conversations: convs, PageCursors: cursors}, nil
+}
+
+// HideConversation closes the conversation in the user's list until a new
+// message arrives or they open it again.
+func (s *DMService) HideConversation(ctx context.Context, userID, conversationID uuid.UUID) error {
+	ctx, span := tracer.Start(ctx, "DMService.HideConversation")
+	defer span.End()
+
+	return s.updateParticipant(ctx, userID, conversationID, func(p *domain.DMParticipant) {
+		t := time.Now()
+		p.HiddenAt = &t
+	})
+}
+
+// SetMuted mutes or unmutes the conversation for the user.
+func (s *DMService) SetMuted(ctx context.Context, userID, conversationID uuid.UUID, muted bool) error {
+	ctx, span := tracer.Start(ctx, "DMService.SetMuted")
+	defer span.End()
+
+	return s.updateParticipant(ctx, userID, conversationID, func(p *domain.DMParticipant) {
+		p.Muted = muted
+	})
+}
+
+// MarkRead marks the conversation's messages as read by the user.
+func (s *DMService) MarkRead(ctx context.Context, userID, conversationID uuid.UUID) error {
+	ctx, span := tracer.Start(ctx, "DMService.MarkRead")
+	defer span.End()
+
+	return s.updateParticipant(ctx, userID, conversationID, func(p *domain.DMParticipant) {
+		t := time.Now()
+		p.LastReadAt = &t
+	})
+}
+
+// updateParticipant changes the user's settings for the conversation.
+func (s *DMService) updateParticipant(ctx context.Context, userID, conversationID uuid.UUID, update func(p *domain.DMParticipant)) error {
+	if err := s.checkParticipant(ctx, userID, conversationID); err != nil {
+		return err
+	}
+	p, err := s.dmRepo.GetParticipant(ctx, conversationID, userID)
+	if err != nil {
+		return err
+	}
+	if p == nil {
+		p = &domain.DMParticipant{ConversationID: conversationID, UserID: userID}
+	}
+	update(p)
+	return s.dmRepo.SaveParticipant(ctx, p)
+}
+
+// previewText puts text on one line and cuts it to n characters.
+func previewText(text string, n int) string {
+	text = strings.Join(strings.Fields(text), " ")
+	if runes := []rune(text); len(runes) > n {
+		return strings.TrimSpace(string(runes[:n-1])) + "…"
+	}
+	return text
 }
 
 // SendMessage sends a DM message.
 func (s *DMService) SendMessage(ctx context.Context, userID, conversationID uuid.UUID, content string) (*domain.DMMessage, error) {
+	ctx, span := tracer.Start(ctx, "DMService.SendMessage")
+	defer span.End()
+
+	msg, err := s.createMessage(ctx, userID, conversationID, content)
+	if err != nil {
+		return nil, err
+	}
+	s.announceMessage(msg)
+	return msg, nil
+}
+
+// createMessage stores a new DM without telling anyone about it, for callers
+// that have to wait for their transaction to commit before calling
+// announceMessage.
+func (s *DMService) createMessage(ctx context.Context, userID, conversationID uuid.UUID, content string) (*domain.DMMessage, error) {
+	content, err := markup.Normalize(content)
+	if err != nil {
+		return nil, err
+	}
+
 	if err := s.checkParticipant(ctx, userID, conversationID); err != nil {
 		return nil, err
 	}
@@ -124,51 +259,91 @@ func (s *DMService) SendMessage(ctx context.Context, userID, conversationID uuid
 	if err := s.dmRepo.CreateMessage(ctx, msg); err != nil {
 		return nil, fmt.Errorf("creating dm message: %w", err)
 	}
-
-	full, err := s.dmRepo.GetMessageByID(ctx, msg.ID)
+	// Replying reads everything before the reply
+	err = s.updateParticipant(ctx, userID, conversationID, func(p *domain.DMParticipant) {
+		p.LastReadAt = &msg.CreatedAt
+	})
 	if err != nil {
 		return nil, err
 	}
 
-	if s.notifier != nil {
-		s.notifier.NotifyNewDM(full)
+	full, err := s.dmRepo.GetMessageByID(ctx, msg.ID)
+	if err != nil {
+		return nil, err
 	}
-
+	withDMMarkup(full)
 	return full, nil
 }
 
-// ListMessages returns paginated DM messages.
-func (s *DMService) ListMessages(ctx context.Context, userID, conversationID uuid.UUID, before *uuid.UUID, limit int) (*DMMessageListResponse, error) {
-	if err := s.checkParticipant(ctx, userID, conversationID); err != nil {
-		return nil, err
+// announceMessage pushes a new DM to the conversation.
+func (s *DMService) announceMessage(msg *domain.DMMessage) {
+	if s.notifier != nil {
+		s.notifier.NotifyNewDM(msg)
 	}
+}
 
-	if limit <= 0 || limit > 100 {
-		limit = 50
-	}
+// ListMessages returns a page of the conversation's messages, oldest first.
+// Without a cursor it returns the newest messages, and with around the
+// messages around that one.
+func (s *DMService) ListMessages(ctx context.Context, userID, conversationID uuid.UUID, input PageInput, around *uuid.UUID) (*DMMessageListResponse, error) {
+	ctx, span := tracer.Start(ctx, "DMService.ListMessages")
+	defer span.End()
 
-	messages, err := s.dmRepo.ListMessages(ctx, conversationID, before, limit+1)
-	if err != nil {
+	if err := s.checkParticipant(ctx, userID, conversationID); err != nil {
 		return nil, err
 	}
 
-	hasMore := len(messages) > limit
-	if hasMore {
-		messages = messages[len(messages)-limit:]
-	}
-
-	if messages == nil {
-		messages = []domain.DMMessage{}
+	list := func(page repository.Page) ([]domain.DMMessage, error) {
+		return s.dmRepo.ListMessages(ctx, conversationID, page)
+	}
+	var messages []domain.DMMessage
+	var cursors PageCursors
+	if around != nil {
+		if input.Before != "" || input.After != "" {
+			return nil, ErrInvalidCursor
+		}
+		target, err := s.dmRepo.GetMessageByID(ctx, *around)
+		if err != nil {
+			return nil, err
+		}
+		if target == nil || target.ConversationID != conversationID || target.DeletedAt != nil {
+			return nil, ErrDMMessageNotFound
+		}
+		if messages, cursors, err = pageAround(*target, input.Limit, dmMessageKey, list); err != nil {
+			return nil, err
+		}
+	} else {
+		var err error
+		if messages, cursors, err = listPage(input, true, dmMessageKey, list); err != nil {
+			return nil, err
+		}
+	}
+
+	for i := range messages {
+		withDMMarkup(&messages[i])
 	}
 
 	return &DMMessageListResponse{
-		Messages: messages,
-		HasMore:  hasMore,
+		Messages:    messages,
+		HasMore:     cursors.Prev != "",
+		PageCursors: cursors,
 	}, nil
 }
 
+func dmMessageKey(m domain.DMMessage) repository.PageKey {
+	return repository.PageKey{Time: m.CreatedAt, ID: m.ID}
+}
+
 // EditMessage edits a DM message.
 func (s *DMService) EditMessage(ctx context.Context, userID, messageID uuid.UUID, content string) (*domain.DMMessage, error) {
+	ctx, span := tracer.Start(ctx, "DMService.EditMessage")
+	defer span.End()
+
+	content, err := markup.Normalize(content)
+	if err != nil {
+		return nil, err
+	}
+
 	msg, err := s.dmRepo.GetMessageByID(ctx, messageID)
 	if err != nil {
 		return nil, err
@@ -189,6 +364,7 @@ func (s *DMService) EditMessage(ctx context.Context, userID, messageID uuid.UUID
 	if err != nil {
 		return nil, err
 	}
+	withDMMarkup(updated)
 
 	if s.notifier != nil {
 		s.notifier.NotifyEditedDM(updated)
@@ -199,6 +375,9 @@ func (s *DMService) EditMessage(ctx context.Context, userID, messageID uuid.UUID
 
 // DeleteMessage soft-deletes a DM message.
 func (s *DMService) DeleteMessage(ctx context.Context, userID, messageID uuid.UUID) error {
+	ctx, span := tracer.Start(ctx, "DMService.DeleteMessage")
+	defer span.End()
+
 	msg, err := s.dmRepo.GetMessageByID(ctx, messageID)
 	if err != nil {
 		return err
@@ -221,8 +400,20 @@ func (s *DMService) DeleteMessage(ctx context.Context, userID, messageID uuid.UU
 	return nil
 }
 
+// withDMMarkup parses the message content for clients to render.
+func withDMMarkup(msg *domain.DMMessage) {
+	if msg != nil && msg.Content != nil {
+		msg.Markup = markup.Parse(*msg.Content)
+	}
+}
+
 func (s *DMService) checkParticipant(ctx context.Context, userID, conversationID uuid.UUID) error {
-	conv, err := s.dmRepo.GetConversationByID(ctx, conversationID)
+	return dmParticipant(ctx, s.dmRepo, userID, conversationID)
+}
+
+// dmParticipant checks that the user is one of the conversation's two participants.
+func dmParticipant(ctx context.Context, dmRepo repository.DMRepository, userID, conversationID uuid.UUID) error {
+	conv, err := dmRepo.GetConversationByID(ctx, conversationID)
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,118 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/vedran77/pulse/internal/domain"
+	"github.com/vedran77/pulse/internal/repository/memory"
+)
+
+func TestDMConversationList(t *testing.T) {
+	ctx := context.Background()
+	store := memory.NewStore()
+	users := memory.NewUserRepo(store)
+	svc := NewDMService(memory.NewDMRepo(store), users)
+	online := map[uuid.UUID]bool{}
+	svc.SetPresence(func(userID uuid.UUID) bool { return online[userID] })
+
+	alice := newTestUser(t, users, "alice")
+	bob := newTestUser(t, users, "bob")
+	carol := newTestUser(t, users, "carol")
+	online[bob.ID] = true
+	conv, err := svc.GetOrCreateConversation(ctx, alice.ID, bob.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if conv.OtherUserStatus != "online" {
+		t.Fatalf("new conversation's other_status = %q", conv.OtherUserStatus)
+	}
+	quiet, err := svc.GetOrCreateConversation(ctx, alice.ID, carol.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	send := func(user *domain.User, content string) {
+		t.Helper()
+		if _, err := svc.SendMessage(ctx, user.ID, conv.ID, content); err != nil {
+			t.Fatal(err)
+		}
+	}
+	list := func(user *domain.User) []domain.DMConversation {
+		t.Helper()
+		resp, err := svc.ListConversations(ctx, user.ID, PageInput{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp.Conversations
+	}
+
+	send(bob, "hi")
+	send(bob, "are you\nthere? "+strings.Repeat("a", 200))
+
+	convs := list(alice)
+	if len(convs) != 2 || convs[0].ID != conv.ID || convs[1].ID != quiet.ID {
+		t.Fatalf("conversations = %+v", convs)
+	}
+	last := convs[0].LastMessage
+	if last == nil || !strings.HasPrefix(last.Content, "are you there? aaa") || len([]rune(last.Content)) != dmPreviewLength {
+		t.Fatalf("preview = %+v", last)
+	}
+	if convs[0].OtherUserStatus != "online" || convs[1].OtherUserStatus != "offline" {
+		t.Fatalf("presence = %q, %q", convs[0].OtherUserStatus, convs[1].OtherUserStatus)
+	}
+	if convs[0].UnreadCount != 2 || convs[0].OtherUserUsername != "bob" {
+		t.Fatalf("alice's conversation = %+v", convs[0])
+	}
+
+	t.Run("read", func(t *testing.T) {
+		if err := svc.MarkRead(ctx, alice.ID, conv.ID); err != nil {
+			t.Fatal(err)
+		}
+		if n := list(alice)[0].UnreadCount; n != 0 {
+			t.Fatalf("unread after reading = %d", n)
+		}
+		send(bob, "ping")
+		if n := list(alice)[0].UnreadCount; n != 1 {
+			t.Fatalf("unread after a new message = %d", n)
+		}
+		// Replying reads the conversation
+		send(alice, "pong")
+		if n := list(alice)[0].UnreadCount; n != 0 {
+			t.Fatalf("unread after replying = %d", n)
+		}
+	})
+
+	t.Run("mute", func(t *testing.T) {
+		if err := svc.SetMuted(ctx, alice.ID, conv.ID, true); err != nil {
+			t.Fatal(err)
+		}
+		if !list(alice)[0].Muted || list(bob)[0].Muted {
+			t.Fatal("mute isn't per participant")
+		}
+		if err := svc.SetMuted(ctx, carol.ID, conv.ID, true); !errors.Is(err, ErrDMNotParticipant) {
+			t.Fatalf("muting someone else's conversation: err = %v", err)
+		}
+	})
+
+	t.Run("hide", func(t *testing.T) {
+		if err := svc.HideConversation(ctx, alice.ID, quiet.ID); err != nil {
+			t.Fatal(err)
+		}
+		if convs := list(alice); len(convs) != 1 || convs[0].ID != conv.ID {
+			t.Fatalf("conversations after hiding = %+v", convs)
+		}
+		if len(list(carol)) != 1 {
+			t.Fatal("hiding a conversation hid it for the other participant")
+		}
+		// Opening it again brings it back
+		if _, err := svc.GetOrCreateConversation(ctx, alice.ID, carol.ID); err != nil {
+			t.Fatal(err)
+		}
+		if len(list(alice)) != 2 {
+			t.Fatal("reopened conversation still hidden")
+		}
+	})
+}
@@ -0,0 +1,132 @@
+package service
+
+import (
+	"context"
+	"log/slog"
+	"slices"
+
+	"github.com/google/uuid"
+	"github.com/vedran77/pulse/internal/domain"
+	"github.com/vedran77/pulse/internal/markup"
+)
+
+const (
+	// maxLinkPreviews caps how many links in one message are unfurled
+	maxLinkPreviews = 3
+	// linkPreviewQueueSize is how many messages can wait for unfurling
+	// before new ones are skipped
+	linkPreviewQueueSize = 256
+)
+
+// LinkPreviewer builds the preview of a link, e.g. from the page's OpenGraph tags.
+type LinkPreviewer interface {
+	Preview(ctx context.Context, url string) (*domain.MessageEmbed, error)
+}
+
+// SetLinkPreviewer enables link previews (optional dependency). Sent and
+// edited messages are queued and unfurled by RunLinkPreviews.
+func (s *MessageService) SetLinkPreviewer(p LinkPreviewer) {
+	s.previewer = p
+	s.previewQueue = make(chan uuid.UUID, linkPreviewQueueSize)
+}
+
+// RunLinkPreviews unfurls queued messages until ctx is cancelled, storing
+// the previews and sending a message.updated event. Several can run at once.
+func (s *MessageService) RunLinkPreviews(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case id := <-s.previewQueue:
+			if err := s.unfurl(ctx, id); err != nil && ctx.Err() == nil {
+				slog.WarnContext(ctx, "link previews failed", "message_id", id, "err", err)
+			}
+		}
+	}
+}
+
+// queueLinkPreviews schedules msg for unfurling without blocking the request.
+func (s *MessageService) queueLinkPreviews(ctx context.Context, msg *domain.Message) {
+	if s.previewer == nil || msg.Content == nil || len(linkURLs(*msg.Content)) == 0 {
+		return
+	}
+	select {
+	case s.previewQueue <- msg.ID:
+	default:
+		slog.WarnContext(ctx, "link preview queue full, skipping message", "message_id", msg.ID)
+	}
+}
+
+// pruneLinkPreviews drops the previews of links an edit removed, so the
+// edited message doesn't show them while the rest are unfurled.
+func (s *MessageService) pruneLinkPreviews(ctx context.Context, msg *domain.Message) error {
+	links := linkURLs(*msg.Content)
+	kept := slices.DeleteFunc(slices.Clone(msg.Embeds), func(e domain.MessageEmbed) bool {
+		return !slices.Contains(links, e.URL)
+	})
+	if len(kept) == len(msg.Embeds) {
+		return nil
+	}
+	return s.messageRepo.SetEmbeds(ctx, msg.ID, kept)
+}
+
+func (s *MessageService) unfurl(ctx context.Context, messageID uuid.UUID) error {
+	ctx, span := tracer.Start(ctx, "MessageService.unfurl")
+	defer span.End()
+
+	msg, err := s.messageRepo.GetByID(ctx, messageID)
+	if err != nil {
+		return err
+	}
+	// The message may have been deleted or edited since it was queued
+	if msg == nil || msg.DeletedAt != nil || msg.Content == nil {
+		return nil
+	}
+
+	var embeds []domain.MessageEmbed
+	for _, link := range linkURLs(*msg.Content) {
+		// Links that survived an edit keep their preview
+		if i := slices.IndexFunc(msg.Embeds, func(e domain.MessageEmbed) bool { return e.URL == link }); i >= 0 {
+			embeds = append(embeds, msg.Embeds[i])
+			continue
+		}
+		embed, err := s.previewer.Preview(ctx, link)
+		if err != nil {
+			slog.DebugContext(ctx, "no link preview", "url", link, "err", err)
+			continue
+		}
+		embed.URL = link
+		embeds = append(embeds, *embed)
+	}
+	if slices.Equal(embeds, msg.Embeds) {
+		return nil
+	}
+
+	if err := s.messageRepo.SetEmbeds(ctx, messageID, embeds); err != nil {
+		return err
+	}
+	updated, err := s.messageRepo.GetByID(ctx, messageID)
+	if err != nil {
+		return err
+	}
+	if s.notifier != nil && updated != nil && updated.DeletedAt == nil {
+		withMarkup(updated)
+		s.notifier.NotifyUpdatedMessage(updated)
+	}
+	return nil
+}
+
+// linkURLs returns the distinct http(s) links in content, in order, up to
+// maxLinkPreviews. Links in code aren't included.
+func linkURLs(content string) []string {
+	var links []string
+	for _, link := range markup.Links(markup.Parse(content)) {
+		if !slices.Contains(links, link) {
+			links = append(links, link)
+		}
+		if len(links) == maxLinkPreviews {
+			break
+		}
+	}
+	return links
+}
@@ -0,0 +1,126 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/vedran77/pulse/internal/domain"
+	"github.com/vedran77/pulse/internal/repository/memory"
+)
+
+func TestLinkURLs(t *testing.T) {
+	for content, want := range map[string][]string{
+		"no links here": nil,
+		"see https://github.com/acme/api/pull/42.":                                 {"https://github.com/acme/api/pull/42"},
+		"(dashboard: http://grafana.example.com/d/abc?from=now-1h)":                {"http://grafana.example.com/d/abc?from=now-1h"},
+		"https://en.wikipedia.org/wiki/Go_(programming_language)!":                 {"https://en.wikipedia.org/wiki/Go_(programming_language)"},
+		"https://a.example https://a.example https://b.example, HTTPS://c.example": {"https://a.example", "https://b.example", "HTTPS://c.example"},
+		"https://1.example https://2.example https://3.example https://4.example":  {"https://1.example", "https://2.example", "https://3.example"},
+		"<https://quoted.example> and ftp://files.example and https://":            {"https://quoted.example"},
+	} {
+		if got := linkURLs(content); !slices.Equal(got, want) {
+			t.Errorf("linkURLs(%q) = %q, want %q", content, got, want)
+		}
+	}
+}
+
+type fakePreviewer map[string]domain.MessageEmbed
+
+func (f fakePreviewer) Preview(ctx context.Context, url string) (*domain.MessageEmbed, error) {
+	embed, ok := f[url]
+	if !ok {
+		return nil, errors.New("no preview")
+	}
+	return &embed, nil
+}
+
+// updateRecorder records message.updated notifications and ignores the rest.
+type updateRecorder struct {
+	Notifier
+	updated []*domain.Message
+}
+
+func (r *updateRecorder) NotifyNewMessage(*domain.Message)    {}
+func (r *updateRecorder) NotifyEditedMessage(*domain.Message) {}
+func (r *updateRecorder) NotifyUpdatedMessage(msg *domain.Message) {
+	r.updated = append(r.updated, msg)
+}
+
+func TestLinkPreviews(t *testing.T) {
+	ctx := context.Background()
+	f := newTestWorkspace(t)
+	store, workspaces, channels := f.store, f.workspaces, f.channels
+	alice := f.alice
+	messages := memory.NewMessageRepo(store)
+	ch := f.channel(t, alice, CreateChannelInput{Name: "general", Type: "public"})
+
+	notifier := &updateRecorder{}
+	svc := NewMessageService(messages, channels, workspaces)
+	svc.SetNotifier(notifier)
+	svc.SetLinkPreviewer(fakePreviewer{
+		"https://pr.example/1":   {Title: "Fix the flaky test"},
+		"https://dash.example/2": {Title: "API latency", SiteName: "Grafana"},
+	})
+	// runQueued unfurls the message the last call queued, like RunLinkPreviews
+	runQueued := func() {
+		t.Helper()
+		select {
+		case id := <-svc.previewQueue:
+			if err := svc.unfurl(ctx, id); err != nil {
+				t.Fatal(err)
+			}
+		default:
+			t.Fatal("nothing queued")
+		}
+	}
+
+	msg, err := svc.Send(ctx, alice.ID, ch.ID, SendMessageInput{Content: "see https://pr.example/1 and https://broken.example"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(msg.Embeds) != 0 {
+		t.Fatalf("Send returned previews before unfurling: %+v", msg.Embeds)
+	}
+	if len(msg.Markup) != 1 || len(msg.Markup[0].Children) != 4 {
+		t.Fatalf("Send markup = %+v", msg.Markup)
+	}
+	runQueued()
+	if len(notifier.updated) != 1 || len(notifier.updated[0].Embeds) != 1 || notifier.updated[0].Embeds[0].URL != "https://pr.example/1" {
+		t.Fatalf("message.updated = %+v", notifier.updated)
+	}
+	list, _ := svc.List(ctx, alice.ID, ch.ID, PageInput{}, nil)
+	if embeds := list.Messages[0].Embeds; len(embeds) != 1 || embeds[0].Title != "Fix the flaky test" {
+		t.Fatalf("listed embeds = %+v", embeds)
+	}
+
+	// Replacing the link drops its preview right away and unfurls the new one
+	edited, err := svc.Edit(ctx, alice.ID, msg.ID, EditMessageInput{Content: "actually https://dash.example/2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(edited.Embeds) != 0 {
+		t.Fatalf("edited message kept a removed link's preview: %+v", edited.Embeds)
+	}
+	runQueued()
+	if len(notifier.updated) != 2 || notifier.updated[1].Embeds[0].SiteName != "Grafana" {
+		t.Fatalf("message.updated after edit = %+v", notifier.updated[1:])
+	}
+
+	// Nothing changes, so nothing is sent
+	if _, err := svc.Edit(ctx, alice.ID, msg.ID, EditMessageInput{Content: "actually https://dash.example/2 (fixed typo)"}); err != nil {
+		t.Fatal(err)
+	}
+	runQueued()
+	if len(notifier.updated) != 2 {
+		t.Fatalf("unchanged previews notified: %+v", notifier.updated[2:])
+	}
+
+	if _, err := svc.Send(ctx, alice.ID, ch.ID, SendMessageInput{Content: "no links"}); err != nil {
+		t.Fatal(err)
+	}
+	if len(svc.previewQueue) != 0 {
+		t.Fatal("message without links queued")
+	}
+}
@@ -0,0 +1,96 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"text/template"
+)
+
+// Mailer delivers transactional email (invites, account notifications).
+type Mailer interface {
+	Send(ctx context.Context, to, subject, body string) error
+}
+
+type mailTemplate struct {
+	subject *template.Template
+	body    *template.Template
+}
+
+func newMailTemplate(name, subject, body string) mailTemplate {
+	return mailTemplate{
+		subject: template.Must(template.New(name + "_subject").Parse(subject)),
+		body:    template.Must(template.New(name + "_body").Parse(body)),
+	}
+}
+
+func (t mailTemplate) render(data any) (subject, body string, err error) {
+	var sb, bb bytes.Buffer
+	if err := t.subject.Execute(&sb, data); err != nil {
+		return "", "", err
+	}
+	if err := t.body.Execute(&bb, data); err != nil {
+		return "", "", err
+	}
+	return sb.String(), bb.String(), nil
+}
+
+var inviteMail = newMailTemplate("invite",
+	`{{.InviterName}} invited you to join {{.WorkspaceName}} on Pulse`,
+	`Hi,
+
+{{.InviterName}} has invited you to join the {{.WorkspaceName}} workspace on Pulse.
+
+Accept the invite here:
+{{.Link}}
+
+This invite expires on {{.ExpiresAt.Format "January 2, 2006 at 15:04 MST"}}.
+If you weren't expecting this email, you can safely ignore it.
+`)
+
+var verifyEmailMail = newMailTemplate("verify_email",
+	`Confirm your email address for Pulse`,
+	`Hi {{.DisplayName}},
+
+Please confirm your email address by opening the link below:
+{{.Link}}
+
+The link is valid for {{.TTL}}.
+If you didn't create a Pulse account, you can safely ignore this email.
+`)
+
+var resetPasswordMail = newMailTemplate("reset_password",
+	`Reset your Pulse password`,
+	`Hi {{.DisplayName}},
+
+Someone asked to reset the password for your Pulse account.
+Choose a new password here:
+{{.Link}}
+
+The link is valid for {{.TTL}} and can only be used once.
+Resetting your password signs you out on all devices.
+If you didn't ask for this, you can safely ignore this email.
+`)
+
+var reminderMail = newMailTemplate("reminder",
+	`Reminder: message from {{.SenderName}}`,
+	`Hi {{.DisplayName}},
+
+You asked to be reminded about this message from {{.SenderName}}:
+
+{{.Snippet}}
+
+Open your saved items:
+{{.Link}}
+`)
+
+var changeEmailMail = newMailTemplate("change_email",
+	`Confirm your new email address for Pulse`,
+	`Hi {{.DisplayName}},
+
+You asked to change the email address of your Pulse account to this one.
+Confirm the change by opening the link below:
+{{.Link}}
+
+The link is valid for {{.TTL}}. Until then you keep signing in with your old address.
+If you didn't ask for this, you can safely ignore this email.
+`)
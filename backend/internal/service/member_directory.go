@@ -0,0 +1,102 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/vedran77/pulse/internal/domain"
+	"github.com/vedran77/pulse/internal/repository"
+)
+
+type MemberSearchInput struct {
+	Query string
+	// Role limits results to one role, empty matches any
+	Role string
+	PageInput
+}
+
+type MemberSearchResponse struct {
+	Members []domain.WorkspaceMember `json:"members"`
+	PageCursors
+}
+
+// UpdateMemberProfileInput changes the fields that are set; an empty string
+// clears the field.
+type UpdateMemberProfileInput struct {
+	Title    *string `json:"title"`
+	Timezone *string `json:"timezone"`
+	Pronouns *string `json:"pronouns"`
+}
+
+// SearchMembers finds workspace members by username or display name, best
+// matches first. Admins can also search by email and see members' addresses.
+func (s *WorkspaceService) SearchMembers(ctx context.Context, userID, workspaceID uuid.UUID, input MemberSearchInput) (*MemberSearchResponse, error) {
+	ctx, span := tracer.Start(ctx, "WorkspaceService.SearchMembers")
+	defer span.End()
+
+	requester, err := workspaceMember(ctx, s.workspaceRepo, workspaceID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if requester == nil {
+		return nil, ErrNotMember
+	}
+
+	search := repository.MemberSearch{
+		Query:        input.Query,
+		Role:         input.Role,
+		IncludeEmail: requester.Role == "owner" || requester.Role == "admin",
+	}
+	matches, cursors, err := keysetPage(input.PageInput, false, repository.MemberMatch.Key, func(before, after *repository.MemberMatchKey, limit int) ([]repository.MemberMatch, error) {
+		search.Before, search.After, search.Limit = before, after, limit
+		return s.workspaceRepo.SearchMembers(ctx, workspaceID, search)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &MemberSearchResponse{Members: []domain.WorkspaceMember{}, PageCursors: cursors}
+	for _, m := range matches {
+		resp.Members = append(resp.Members, m.WorkspaceMember)
+	}
+	return resp, nil
+}
+
+// UpdateMemberProfile sets the requester's title, timezone and pronouns in
+// the workspace.
+func (s *WorkspaceService) UpdateMemberProfile(ctx context.Context, userID, workspaceID uuid.UUID, input UpdateMemberProfileInput) (*domain.WorkspaceMember, error) {
+	ctx, span := tracer.Start(ctx, "WorkspaceService.UpdateMemberProfile")
+	defer span.End()
+
+	member, err := workspaceMember(ctx, s.workspaceRepo, workspaceID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if member == nil {
+		return nil, ErrNotMember
+	}
+
+	if input.Title != nil {
+		member.Title = optionalText(*input.Title)
+	}
+	if input.Timezone != nil {
+		member.Timezone = optionalText(*input.Timezone)
+	}
+	if input.Pronouns != nil {
+		member.Pronouns = optionalText(*input.Pronouns)
+	}
+	if err := s.workspaceRepo.UpdateMemberProfile(ctx, member); err != nil {
+		return nil, fmt.Errorf("updating member profile: %w", err)
+	}
+	return member, nil
+}
+
+// optionalText trims s and returns nil if nothing is left.
+func optionalText(s string) *string {
+	if s = strings.TrimSpace(s); s == "" {
+		return nil
+	}
+	return &s
+}
@@ -8,12 +8,18 @@ import (
 
 	"github.com/google/uuid"
 	"github.com/vedran77/pulse/internal/domain"
+	"github.com/vedran77/pulse/internal/markup"
 	"github.com/vedran77/pulse/internal/repository"
 )
 
 var (
 	ErrMessageNotFound = errors.New("message not found")
 	ErrNotMessageOwner = errors.New("only the message sender can perform this action")
+
+	// Content validation errors, shared with DMs
+	ErrEmptyContent   = markup.ErrEmpty
+	ErrContentTooLong = markup.ErrTooLong
+	ErrInvalidContent = markup.ErrControlCharacter
 )
 
 // Notifier broadcasts real-time events to connected clients.
@@ -21,6 +27,17 @@ type Notifier interface {
 	NotifyNewMessage(msg *domain.Message)
 	NotifyEditedMessage(msg *domain.Message)
 	NotifyDeletedMessage(channelID, messageID uuid.UUID)
+	// NotifyUpdatedMessage reports changes made by the server, such as link
+	// previews, as opposed to edits by the sender
+	NotifyUpdatedMessage(msg *domain.Message)
+	// NotifyChannelUpdated reports changes to the channel's topic or settings
+	NotifyChannelUpdated(ch *domain.Channel)
+	// Channel pins and bookmarks
+	NotifyPinAdded(pin *domain.PinnedMessage)
+	NotifyPinRemoved(channelID, messageID uuid.UUID)
+	NotifyBookmarkAdded(bookmark *domain.ChannelBookmark)
+	NotifyBookmarkUpdated(bookmark *domain.ChannelBookmark)
+	NotifyBookmarkRemoved(channelID, bookmarkID uuid.UUID)
 	// DM notifications
 	NotifyNewDM(msg *domain.DMMessage)
 	NotifyEditedDM(msg *domain.DMMessage)
@@ -32,6 +49,9 @@ type MessageService struct {
 	channelRepo   repository.ChannelRepository
 	workspaceRepo repository.WorkspaceRepository
 	notifier      Notifier
+
+	previewer    LinkPreviewer
+	previewQueue chan uuid.UUID
 }
 
 func NewMessageService(
@@ -62,16 +82,40 @@ type EditMessageInput struct {
 
 type MessageListResponse struct {
 	Messages []domain.Message `json:"messages"`
-	HasMore  bool             `json:"has_more"`
+	// Older messages exist, same as prev_cursor being set
+	HasMore bool `json:"has_more"`
+	PageCursors
 }
 
 func (s *MessageService) Send(ctx context.Context, userID, channelID uuid.UUID, input SendMessageInput) (*domain.Message, error) {
+	ctx, span := tracer.Start(ctx, "MessageService.Send")
+	defer span.End()
+
+	msg, err := s.create(ctx, userID, channelID, input)
+	if err != nil {
+		return nil, err
+	}
+	s.announce(ctx, msg)
+	return msg, nil
+}
+
+// create stores a new message without telling anyone about it, for callers
+// that have to wait for their transaction to commit before calling announce.
+func (s *MessageService) create(ctx context.Context, userID, channelID uuid.UUID, input SendMessageInput) (*domain.Message, error) {
+	content, err := markup.Normalize(input.Content)
+	if err != nil {
+		return nil, err
+	}
+
 	// Provjeri pristup kanalu
-	if err := s.checkChannelAccess(ctx, userID, channelID); err != nil {
+	ch, err := s.checkChannelAccess(ctx, userID, channelID)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkCanPost(ctx, s.channelRepo, s.workspaceRepo, userID, ch); err != nil {
 		return nil, err
 	}
 
-	content := input.Content
 	msg := &domain.Message{
 		ID:        uuid.New(),
 		ChannelID: channelID,
@@ -91,45 +135,79 @@ func (s *MessageService) Send(ctx context.Context, userID, channelID uuid.UUID,
 	if err != nil {
 		return nil, err
 	}
-
-	if s.notifier != nil {
-		s.notifier.NotifyNewMessage(full)
-	}
-
+	withMarkup(full)
 	return full, nil
 }
 
-func (s *MessageService) List(ctx context.Context, userID, channelID uuid.UUID, before *uuid.UUID, limit int) (*MessageListResponse, error) {
-	if err := s.checkChannelAccess(ctx, userID, channelID); err != nil {
-		return nil, err
+// announce pushes a new message to the channel and queues its link previews.
+func (s *MessageService) announce(ctx context.Context, msg *domain.Message) {
+	if s.notifier != nil {
+		s.notifier.NotifyNewMessage(msg)
 	}
+	s.queueLinkPreviews(ctx, msg)
+}
 
-	if limit <= 0 || limit > 100 {
-		limit = 50
-	}
+// List returns a page of the channel's messages, oldest first. Without a
+// cursor it returns the newest messages, and with around the messages
+// around that one.
+func (s *MessageService) List(ctx context.Context, userID, channelID uuid.UUID, input PageInput, around *uuid.UUID) (*MessageListResponse, error) {
+	ctx, span := tracer.Start(ctx, "MessageService.List")
+	defer span.End()
 
-	// Dohvati limit+1 da znamo ima li jos
-	messages, err := s.messageRepo.ListByChannel(ctx, channelID, before, limit+1)
-	if err != nil {
+	if _, err := s.checkChannelAccess(ctx, userID, channelID); err != nil {
 		return nil, err
 	}
 
-	hasMore := len(messages) > limit
-	if hasMore {
-		messages = messages[len(messages)-limit:] // zadrzi zadnjih "limit" (najnovije)
+	list := func(page repository.Page) ([]domain.Message, error) {
+		return s.messageRepo.ListByChannel(ctx, channelID, page)
+	}
+	var messages []domain.Message
+	var cursors PageCursors
+	if around != nil {
+		if input.Before != "" || input.After != "" {
+			return nil, ErrInvalidCursor
+		}
+		target, err := s.messageRepo.GetByID(ctx, *around)
+		if err != nil {
+			return nil, err
+		}
+		if target == nil || target.ChannelID != channelID || target.DeletedAt != nil {
+			return nil, ErrMessageNotFound
+		}
+		if messages, cursors, err = pageAround(*target, input.Limit, messageKey, list); err != nil {
+			return nil, err
+		}
+	} else {
+		var err error
+		if messages, cursors, err = listPage(input, true, messageKey, list); err != nil {
+			return nil, err
+		}
 	}
 
-	if messages == nil {
-		messages = []domain.Message{}
+	for i := range messages {
+		withMarkup(&messages[i])
 	}
 
 	return &MessageListResponse{
-		Messages: messages,
-		HasMore:  hasMore,
+		Messages:    messages,
+		HasMore:     cursors.Prev != "",
+		PageCursors: cursors,
 	}, nil
 }
 
+func messageKey(m domain.Message) repository.PageKey {
+	return repository.PageKey{Time: m.CreatedAt, ID: m.ID}
+}
+
 func (s *MessageService) Edit(ctx context.Context, userID, messageID uuid.UUID, input EditMessageInput) (*domain.Message, error) {
+	ctx, span := tracer.Start(ctx, "MessageService.Edit")
+	defer span.End()
+
+	content, err := markup.Normalize(input.Content)
+	if err != nil {
+		return nil, err
+	}
+
 	msg, err := s.messageRepo.GetByID(ctx, messageID)
 	if err != nil {
 		return nil, err
@@ -140,25 +218,36 @@ func (s *MessageService) Edit(ctx context.Context, userID, messageID uuid.UUID,
 	if msg.SenderID != userID {
 		return nil, ErrNotMessageOwner
 	}
+	if err := s.checkChannelWritable(ctx, msg.ChannelID); err != nil {
+		return nil, err
+	}
 
-	msg.Content = &input.Content
+	msg.Content = &content
 	if err := s.messageRepo.Update(ctx, msg); err != nil {
 		return nil, fmt.Errorf("updating message: %w", err)
 	}
+	if err := s.pruneLinkPreviews(ctx, msg); err != nil {
+		return nil, err
+	}
 
 	updated, err := s.messageRepo.GetByID(ctx, msg.ID)
 	if err != nil {
 		return nil, err
 	}
+	withMarkup(updated)
 
 	if s.notifier != nil {
 		s.notifier.NotifyEditedMessage(updated)
 	}
+	s.queueLinkPreviews(ctx, updated)
 
 	return updated, nil
 }
 
 func (s *MessageService) Delete(ctx context.Context, userID, messageID uuid.UUID) error {
+	ctx, span := tracer.Start(ctx, "MessageService.Delete")
+	defer span.End()
+
 	msg, err := s.messageRepo.GetByID(ctx, messageID)
 	if err != nil {
 		return err
@@ -169,10 +258,17 @@ func (s *MessageService) Delete(ctx context.Context, userID, messageID uuid.UUID
 	if msg.SenderID != userID {
 		return ErrNotMessageOwner
 	}
+	if err := s.checkChannelWritable(ctx, msg.ChannelID); err != nil {
+		return err
+	}
 
 	if err := s.messageRepo.SoftDelete(ctx, messageID); err != nil {
 		return err
 	}
+	// A deleted message doesn't count towards the channel's pin limit
+	if err := s.removePin(ctx, msg.ChannelID, messageID); err != nil {
+		return err
+	}
 
 	if s.notifier != nil {
 		s.notifier.NotifyDeletedMessage(msg.ChannelID, messageID)
@@ -181,34 +277,70 @@ func (s *MessageService) Delete(ctx context.Context, userID, messageID uuid.UUID
 	return nil
 }
 
-func (s *MessageService) checkChannelAccess(ctx context.Context, userID, channelID uuid.UUID) error {
-	ch, err := s.channelRepo.GetByID(ctx, channelID)
+// withMarkup parses the message content for clients to render.
+func withMarkup(msg *domain.Message) {
+	if msg != nil && msg.Content != nil {
+		msg.Markup = markup.Parse(*msg.Content)
+	}
+}
+
+// checkChannelWritable returns ErrChannelArchived if the message's channel
+// is archived, so its messages can no longer be edited or deleted.
+func (s *MessageService) checkChannelWritable(ctx context.Context, channelID uuid.UUID) error {
+	ch, err := getChannel(ctx, s.channelRepo, s.workspaceRepo, channelID)
 	if err != nil {
 		return err
 	}
+	return checkNotArchived(ch)
+}
+
+func (s *MessageService) checkChannelAccess(ctx context.Context, userID, channelID uuid.UUID) (*domain.Channel, error) {
+	return channelAccess(ctx, s.channelRepo, s.workspaceRepo, userID, channelID)
+}
+
+// getChannel loads a channel, refusing sessions that don't meet its
+// workspace's sign-in policy.
+func getChannel(ctx context.Context, channelRepo repository.ChannelRepository, workspaceRepo repository.WorkspaceRepository, channelID uuid.UUID) (*domain.Channel, error) {
+	ch, err := channelRepo.GetByID(ctx, channelID)
+	if err != nil {
+		return nil, err
+	}
 	if ch == nil {
-		return ErrChannelNotFound
+		return nil, ErrChannelNotFound
+	}
+	if err := checkWorkspacePolicy(ctx, workspaceRepo, ch.WorkspaceID); err != nil {
+		return nil, err
+	}
+	return ch, nil
+}
+
+// channelAccess checks that the user can read the channel's messages and
+// returns the channel.
+func channelAccess(ctx context.Context, channelRepo repository.ChannelRepository, workspaceRepo repository.WorkspaceRepository, userID, channelID uuid.UUID) (*domain.Channel, error) {
+	ch, err := getChannel(ctx, channelRepo, workspaceRepo, channelID)
+	if err != nil {
+		return nil, err
 	}
 
 	// Za public kanale, workspace membership je dovoljan
 	if ch.Type == "public" {
-		member, err := s.workspaceRepo.GetMember(ctx, ch.WorkspaceID, userID)
+		member, err := workspaceRepo.GetMember(ctx, ch.WorkspaceID, userID)
 		if err != nil {
-			return err
+			return nil, err
 		}
 		if member == nil {
-			return ErrNotMember
+			return nil, ErrNotMember
 		}
-		return nil
+		return ch, nil
 	}
 
 	// Za private kanale, treba channel membership
-	cm, err := s.channelRepo.GetMember(ctx, channelID, userID)
+	cm, err := channelRepo.GetMember(ctx, channelID, userID)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	if cm == nil {
-		return ErrNotChannelMember
+		return nil, ErrNotChannelMember
 	}
-	return nil
+	return ch, nil
 }
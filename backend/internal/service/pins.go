@@ -0,0 +1,144 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/vedran77/pulse/internal/domain"
+)
+
+// maxPinsPerChannel keeps pins meaningful; unpin something to pin more.
+const maxPinsPerChannel = 100
+
+var ErrPinLimitReached = fmt.Errorf("a channel can have at most %d pinned messages", maxPinsPerChannel)
+
+// Pin pins a message to its channel. Pinning an already pinned message
+// returns the existing pin.
+func (s *MessageService) Pin(ctx context.Context, userID, messageID uuid.UUID) (*domain.PinnedMessage, error) {
+	ctx, span := tracer.Start(ctx, "MessageService.Pin")
+	defer span.End()
+
+	msg, ch, err := s.moderatedMessage(ctx, userID, messageID)
+	if err != nil {
+		return nil, err
+	}
+	withMarkup(msg)
+
+	existing, err := s.messageRepo.GetPin(ctx, messageID)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil {
+		existing.Message = msg
+		return existing, nil
+	}
+
+	pin := &domain.PinnedMessage{
+		MessageID: messageID,
+		ChannelID: ch.ID,
+		PinnedBy:  userID,
+		PinnedAt:  time.Now(),
+	}
+	added, err := s.messageRepo.AddPin(ctx, pin, maxPinsPerChannel)
+	if err != nil {
+		return nil, fmt.Errorf("pinning message: %w", err)
+	}
+	if !added {
+		// Either the channel is full or someone pinned the message concurrently
+		existing, err := s.messageRepo.GetPin(ctx, messageID)
+		if err != nil {
+			return nil, err
+		}
+		if existing == nil {
+			return nil, ErrPinLimitReached
+		}
+		existing.Message = msg
+		return existing, nil
+	}
+	pin.Message = msg
+
+	if s.notifier != nil {
+		s.notifier.NotifyPinAdded(pin)
+	}
+
+	return pin, nil
+}
+
+// Unpin removes a message's pin. Unpinning a message that isn't pinned does nothing.
+func (s *MessageService) Unpin(ctx context.Context, userID, messageID uuid.UUID) error {
+	ctx, span := tracer.Start(ctx, "MessageService.Unpin")
+	defer span.End()
+
+	_, ch, err := s.moderatedMessage(ctx, userID, messageID)
+	if err != nil {
+		return err
+	}
+	return s.removePin(ctx, ch.ID, messageID)
+}
+
+// ListPins returns the channel's pinned messages, newest pin first.
+func (s *MessageService) ListPins(ctx context.Context, userID, channelID uuid.UUID) ([]domain.PinnedMessage, error) {
+	ctx, span := tracer.Start(ctx, "MessageService.ListPins")
+	defer span.End()
+
+	if _, err := s.checkChannelAccess(ctx, userID, channelID); err != nil {
+		return nil, err
+	}
+
+	pins, err := s.messageRepo.ListPins(ctx, channelID)
+	if err != nil {
+		return nil, err
+	}
+	if pins == nil {
+		pins = []domain.PinnedMessage{}
+	}
+	for i := range pins {
+		withMarkup(pins[i].Message)
+	}
+	return pins, nil
+}
+
+// moderatedMessage loads a message the user may pin or unpin, with its
+// channel. Messages in archived channels can't be pinned or unpinned.
+func (s *MessageService) moderatedMessage(ctx context.Context, userID, messageID uuid.UUID) (*domain.Message, *domain.Channel, error) {
+	msg, err := s.messageRepo.GetByID(ctx, messageID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if msg == nil || msg.DeletedAt != nil {
+		return nil, nil, ErrMessageNotFound
+	}
+
+	ch, err := getChannel(ctx, s.channelRepo, s.workspaceRepo, msg.ChannelID)
+	if err != nil {
+		return nil, nil, err
+	}
+	ok, err := canModerateChannel(ctx, s.channelRepo, s.workspaceRepo, userID, ch)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !ok {
+		return nil, nil, ErrNotChannelAdmin
+	}
+	if err := checkNotArchived(ch); err != nil {
+		return nil, nil, err
+	}
+	return msg, ch, nil
+}
+
+// removePin unpins the message if it's pinned and tells the channel.
+func (s *MessageService) removePin(ctx context.Context, channelID, messageID uuid.UUID) error {
+	pin, err := s.messageRepo.GetPin(ctx, messageID)
+	if err != nil || pin == nil {
+		return err
+	}
+	if err := s.messageRepo.RemovePin(ctx, messageID); err != nil {
+		return err
+	}
+	if s.notifier != nil {
+		s.notifier.NotifyPinRemoved(channelID, messageID)
+	}
+	return nil
+}
@@ -0,0 +1,86 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/vedran77/pulse/internal/domain"
+	"github.com/vedran77/pulse/internal/repository/memory"
+)
+
+func TestPins(t *testing.T) {
+	ctx := context.Background()
+	f := newTestWorkspace(t)
+	store, users, workspaces, channels := f.store, f.users, f.workspaces, f.channels
+	alice, bob, ws, channelSvc := f.alice, f.bob, f.ws, f.channelSvc
+	ch := f.channel(t, bob, CreateChannelInput{Name: "general", Type: "public"}, alice)
+
+	svc := NewMessageService(memory.NewMessageRepo(store), channels, workspaces)
+	send := func(content string) *domain.Message {
+		t.Helper()
+		msg, err := svc.Send(ctx, alice.ID, ch.ID, SendMessageInput{Content: content})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return msg
+	}
+	msg := send("runbook: https://wiki.example/oncall")
+
+	// Bob created the channel, so he is its admin; Alice is a workspace owner
+	// but a plain channel member. A plain member of both can't pin.
+	carol := newTestUser(t, users, "carol")
+	if err := workspaces.AddMember(ctx, &domain.WorkspaceMember{WorkspaceID: ws.ID, UserID: carol.ID, Role: "member", JoinedAt: time.Now()}); err != nil {
+		t.Fatal(err)
+	}
+	if err := channelSvc.AddMember(ctx, carol.ID, ch.ID, carol.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.Pin(ctx, carol.ID, msg.ID); !errors.Is(err, ErrNotChannelAdmin) {
+		t.Fatalf("Pin by plain member: err = %v", err)
+	}
+
+	for _, user := range []*domain.User{bob, alice} {
+		pin, err := svc.Pin(ctx, user.ID, msg.ID)
+		if err != nil {
+			t.Fatalf("Pin by %s: %v", user.Username, err)
+		}
+		if pin.PinnedBy != bob.ID || pin.Message == nil || len(pin.Message.Markup) == 0 {
+			t.Fatalf("Pin by %s = %+v", user.Username, pin)
+		}
+	}
+
+	for i := 1; i < maxPinsPerChannel; i++ {
+		if _, err := svc.Pin(ctx, bob.ID, send(fmt.Sprintf("message %d", i)).ID); err != nil {
+			t.Fatalf("pin %d: %v", i, err)
+		}
+	}
+	extra := send("one too many")
+	if _, err := svc.Pin(ctx, bob.ID, extra.ID); !errors.Is(err, ErrPinLimitReached) {
+		t.Fatalf("Pin over the limit: err = %v", err)
+	}
+
+	// Deleting a pinned message frees its slot
+	if err := svc.Delete(ctx, alice.ID, msg.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.Pin(ctx, bob.ID, extra.ID); err != nil {
+		t.Fatalf("Pin after delete: %v", err)
+	}
+	if err := svc.Unpin(ctx, bob.ID, extra.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := svc.Unpin(ctx, bob.ID, extra.ID); err != nil {
+		t.Fatalf("repeated Unpin: %v", err)
+	}
+
+	pins, err := svc.ListPins(ctx, carol.ID, ch.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pins) != maxPinsPerChannel-1 {
+		t.Fatalf("ListPins returned %d pins, want %d", len(pins), maxPinsPerChannel-1)
+	}
+}
@@ -24,24 +24,29 @@ var (
 type PulsemateService struct {
 	pmRepo   repository.PulsemateRepository
 	userRepo repository.UserRepository
+	tx       repository.TxManager
 }
 
-func NewPulsemateService(pmRepo repository.PulsemateRepository, userRepo repository.UserRepository) *PulsemateService {
+func NewPulsemateService(pmRepo repository.PulsemateRepository, userRepo repository.UserRepository, tx repository.TxManager) *PulsemateService {
 	return &PulsemateService{
 		pmRepo:   pmRepo,
 		userRepo: userRepo,
+		tx:       tx,
 	}
 }
 
 // SendRequest sends a pulsemate request by target username.
 // Auto-accepts if the other user already sent a request to the sender.
 func (s *PulsemateService) SendRequest(ctx context.Context, senderID uuid.UUID, targetUsername string) (*domain.PulsemateRequest, error) {
+	ctx, span := tracer.Start(ctx, "PulsemateService.SendRequest")
+	defer span.End()
+
 	// Look up target user
 	target, err := s.userRepo.GetByUsername(ctx, targetUsername)
 	if err != nil {
 		return nil, fmt.Errorf("looking up user: %w", err)
 	}
-	if target == nil {
+	if target == nil || target.DeletedAt != nil {
 		return nil, ErrUserNotFoundForRequest
 	}
 
@@ -74,10 +79,7 @@ func (s *PulsemateService) SendRequest(ctx context.Context, senderID uuid.UUID,
 	}
 	if reverse != nil && reverse.Status == "pending" {
 		// Auto-accept: create pulsemate and delete the reverse request
-		if err := s.createPulsemate(ctx, senderID, target.ID); err != nil {
-			return nil, err
-		}
-		if err := s.pmRepo.DeleteRequest(ctx, reverse.ID); err != nil {
+		if err := s.createPulsemate(ctx, senderID, target.ID, reverse.ID); err != nil {
 			return nil, err
 		}
 		// Return nil to indicate auto-accepted (no pending request created)
@@ -102,6 +104,9 @@ func (s *PulsemateService) SendRequest(ctx context.Context, senderID uuid.UUID,
 
 // AcceptRequest accepts a pending pulsemate request.
 func (s *PulsemateService) AcceptRequest(ctx context.Context, userID uuid.UUID, requestID uuid.UUID) error {
+	ctx, span := tracer.Start(ctx, "PulsemateService.AcceptRequest")
+	defer span.End()
+
 	req, err := s.pmRepo.GetRequestByID(ctx, requestID)
 	if err != nil {
 		return err
@@ -113,15 +118,14 @@ func (s *PulsemateService) AcceptRequest(ctx context.Context, userID uuid.UUID,
 		return ErrNotRequestReceiver
 	}
 
-	if err := s.createPulsemate(ctx, req.SenderID, req.ReceiverID); err != nil {
-		return err
-	}
-
-	return s.pmRepo.DeleteRequest(ctx, requestID)
+	return s.createPulsemate(ctx, req.SenderID, req.ReceiverID, requestID)
 }
 
 // RejectRequest rejects (deletes) a pending pulsemate request.
 func (s *PulsemateService) RejectRequest(ctx context.Context, userID uuid.UUID, requestID uuid.UUID) error {
+	ctx, span := tracer.Start(ctx, "PulsemateService.RejectRequest")
+	defer span.End()
+
 	req, err := s.pmRepo.GetRequestByID(ctx, requestID)
 	if err != nil {
 		return err
@@ -138,6 +142,9 @@ func (s *PulsemateService) RejectRequest(ctx context.Context, userID uuid.UUID,
 
 // CancelRequest cancels a pending request sent by the user.
 func (s *PulsemateService) CancelRequest(ctx context.Context, userID uuid.UUID, requestID uuid.UUID) error {
+	ctx, span := tracer.Start(ctx, "PulsemateService.CancelRequest")
+	defer span.End()
+
 	req, err := s.pmRepo.GetRequestByID(ctx, requestID)
 	if err != nil {
 		return err
@@ -152,20 +159,32 @@ func (s *PulsemateService) CancelRequest(ctx context.Context, userID uuid.UUID,
 	return s.pmRepo.DeleteRequest(ctx, requestID)
 }
 
-// ListPulsemates returns all pulsemates for a user.
-func (s *PulsemateService) ListPulsemates(ctx context.Context, userID uuid.UUID) ([]domain.Pulsemate, error) {
-	pms, err := s.pmRepo.ListPulsemates(ctx, userID)
+type PulsemateListResponse struct {
+	Pulsemates []domain.Pulsemate `json:"pulsemates"`
+	PageCursors
+}
+
+// ListPulsemates returns a page of the user's pulsemates, newest first.
+func (s *PulsemateService) ListPulsemates(ctx context.Context, userID uuid.UUID, input PageInput) (*PulsemateListResponse, error) {
+	ctx, span := tracer.Start(ctx, "PulsemateService.ListPulsemates")
+	defer span.End()
+
+	pms, cursors, err := listPage(input, false, func(pm domain.Pulsemate) repository.PageKey {
+		return repository.PageKey{Time: pm.CreatedAt, ID: pm.ID}
+	}, func(page repository.Page) ([]domain.Pulsemate, error) {
+		return s.pmRepo.ListPulsemates(ctx, userID, page)
+	})
 	if err != nil {
 		return nil, err
 	}
-	if pms == nil {
-		pms = []domain.Pulsemate{}
-	}
-	return pms, nil
+	return &PulsemateListResponse{Pulsemates: pms, PageCursors: cursors}, nil
 }
 
 // ListIncomingRequests returns pending requests received by the user.
 func (s *PulsemateService) ListIncomingRequests(ctx context.Context, userID uuid.UUID) ([]domain.PulsemateRequest, error) {
+	ctx, span := tracer.Start(ctx, "PulsemateService.ListIncomingRequests")
+	defer span.End()
+
 	reqs, err := s.pmRepo.ListIncomingRequests(ctx, userID)
 	if err != nil {
 		return nil, err
@@ -178,6 +197,9 @@ func (s *PulsemateService) ListIncomingRequests(ctx context.Context, userID uuid
 
 // ListOutgoingRequests returns pending requests sent by the user.
 func (s *PulsemateService) ListOutgoingRequests(ctx context.Context, userID uuid.UUID) ([]domain.PulsemateRequest, error) {
+	ctx, span := tracer.Start(ctx, "PulsemateService.ListOutgoingRequests")
+	defer span.End()
+
 	reqs, err := s.pmRepo.ListOutgoingRequests(ctx, userID)
 	if err != nil {
 		return nil, err
@@ -190,6 +212,9 @@ func (s *PulsemateService) ListOutgoingRequests(ctx context.Context, userID uuid
 
 // RemovePulsemate removes a pulsemate relationship.
 func (s *PulsemateService) RemovePulsemate(ctx context.Context, userID, otherUserID uuid.UUID) error {
+	ctx, span := tracer.Start(ctx, "PulsemateService.RemovePulsemate")
+	defer span.End()
+
 	u1, u2 := userID, otherUserID
 	if u1.String() > u2.String() {
 		u1, u2 = u2, u1
@@ -197,8 +222,9 @@ func (s *PulsemateService) RemovePulsemate(ctx context.Context, userID, otherUse
 	return s.pmRepo.DeletePulsemate(ctx, u1, u2)
 }
 
-// createPulsemate creates a pulsemate with canonical ordering.
-func (s *PulsemateService) createPulsemate(ctx context.Context, userA, userB uuid.UUID) error {
+// createPulsemate creates a pulsemate with canonical ordering and deletes
+// the accepted request in the same transaction.
+func (s *PulsemateService) createPulsemate(ctx context.Context, userA, userB, requestID uuid.UUID) error {
 	u1, u2 := userA, userB
 	if u1.String() > u2.String() {
 		u1, u2 = u2, u1
@@ -211,5 +237,10 @@ func (s *PulsemateService) createPulsemate(ctx context.Context, userA, userB uui
 		CreatedAt: time.Now(),
 	}
 
-	return s.pmRepo.CreatePulsemate(ctx, pm)
+	return s.tx.WithinTx(ctx, func(ctx context.Context) error {
+		if err := s.pmRepo.CreatePulsemate(ctx, pm); err != nil {
+			return err
+		}
+		return s.pmRepo.DeleteRequest(ctx, requestID)
+	})
 }
@@ -0,0 +1,130 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/vedran77/pulse/internal/domain"
+	"github.com/vedran77/pulse/internal/repository/memory"
+)
+
+func newTestUser(t *testing.T, users *memory.UserRepo, name string) *domain.User {
+	t.Helper()
+	u := &domain.User{
+		ID:          uuid.New(),
+		Email:       name + "@example.com",
+		Username:    name,
+		DisplayName: name,
+		Status:      "offline",
+		CreatedAt:   time.Now(),
+		UpdatedAt:   time.Now(),
+	}
+	if err := users.Create(context.Background(), u); err != nil {
+		t.Fatal(err)
+	}
+	return u
+}
+
+// testWorkspace is an in-memory Acme workspace owned by alice, with bob as
+// a plain member.
+type testWorkspace struct {
+	store      *memory.Store
+	users      *memory.UserRepo
+	workspaces *memory.WorkspaceRepo
+	channels   *memory.ChannelRepo
+	tx         *memory.TxManager
+	channelSvc *ChannelService
+	alice, bob *domain.User
+	ws         *domain.Workspace
+}
+
+func newTestWorkspace(t *testing.T) *testWorkspace {
+	t.Helper()
+	ctx := context.Background()
+	store := memory.NewStore()
+	f := &testWorkspace{
+		store:      store,
+		users:      memory.NewUserRepo(store),
+		workspaces: memory.NewWorkspaceRepo(store),
+		channels:   memory.NewChannelRepo(store),
+		tx:         memory.NewTxManager(store),
+	}
+	f.channelSvc = NewChannelService(f.channels, f.workspaces, f.tx)
+	f.alice = newTestUser(t, f.users, "alice")
+	f.bob = newTestUser(t, f.users, "bob")
+
+	ws, err := NewWorkspaceService(f.workspaces, f.users, memory.NewInviteRepo(store), f.tx).
+		Create(ctx, f.alice.ID, CreateWorkspaceInput{Name: "Acme"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.ws = ws
+	if err := f.workspaces.AddMember(ctx, &domain.WorkspaceMember{WorkspaceID: ws.ID, UserID: f.bob.ID, Role: "member", JoinedAt: time.Now()}); err != nil {
+		t.Fatal(err)
+	}
+	return f
+}
+
+// channel creates a channel as creator, who becomes its admin, and adds
+// members to it.
+func (f *testWorkspace) channel(t *testing.T, creator *domain.User, input CreateChannelInput, members ...*domain.User) *domain.Channel {
+	t.Helper()
+	ctx := context.Background()
+	ch, err := f.channelSvc.Create(ctx, creator.ID, f.ws.ID, input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, m := range members {
+		if err := f.channelSvc.AddMember(ctx, creator.ID, ch.ID, m.ID); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return ch
+}
+
+func TestPulsemateRequests(t *testing.T) {
+	ctx := context.Background()
+	store := memory.NewStore()
+	users := memory.NewUserRepo(store)
+	pulsemates := memory.NewPulsemateRepo(store)
+	svc := NewPulsemateService(pulsemates, users, memory.NewTxManager(store))
+
+	alice := newTestUser(t, users, "alice")
+	bob := newTestUser(t, users, "bob")
+
+	if _, err := svc.SendRequest(ctx, alice.ID, "alice"); !errors.Is(err, ErrCannotRequestSelf) {
+		t.Fatalf("request to self: err = %v", err)
+	}
+	if _, err := svc.SendRequest(ctx, alice.ID, "nobody"); !errors.Is(err, ErrUserNotFoundForRequest) {
+		t.Fatalf("request to unknown user: err = %v", err)
+	}
+
+	req, err := svc.SendRequest(ctx, alice.ID, "bob")
+	if err != nil || req == nil {
+		t.Fatalf("SendRequest = %v, %v", req, err)
+	}
+	if _, err := svc.SendRequest(ctx, alice.ID, "bob"); !errors.Is(err, ErrRequestAlreadyExists) {
+		t.Fatalf("repeated request: err = %v", err)
+	}
+	if err := svc.AcceptRequest(ctx, alice.ID, req.ID); !errors.Is(err, ErrNotRequestReceiver) {
+		t.Fatalf("sender accepting: err = %v", err)
+	}
+
+	// Bob asking back accepts Alice's request
+	req, err = svc.SendRequest(ctx, bob.ID, "alice")
+	if err != nil || req != nil {
+		t.Fatalf("reverse SendRequest = %v, %v; want auto-accept", req, err)
+	}
+	if ok, _ := pulsemates.ArePulsemates(ctx, alice.ID, bob.ID); !ok {
+		t.Fatal("not pulsemates after auto-accept")
+	}
+	if pending, _ := pulsemates.ListIncomingRequests(ctx, bob.ID); len(pending) != 0 {
+		t.Fatalf("pending requests left: %+v", pending)
+	}
+	if _, err := svc.SendRequest(ctx, alice.ID, "bob"); !errors.Is(err, ErrAlreadyPulsemates) {
+		t.Fatalf("request to a pulsemate: err = %v", err)
+	}
+}
@@ -0,0 +1,380 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"github.com/vedran77/pulse/internal/domain"
+	"github.com/vedran77/pulse/internal/repository"
+)
+
+var (
+	ErrSavedItemNotFound = errors.New("saved item not found")
+	ErrInvalidReminder   = errors.New("reminder must be in the future and at most a year away")
+)
+
+const (
+	maxReminderDelay = 365 * 24 * time.Hour
+	// How many due reminders one poll claims at a time
+	reminderBatchSize = 100
+)
+
+// ReminderNotifier delivers due reminders to a user's open connections.
+type ReminderNotifier interface {
+	// NotifyReminderDue reports whether the user was connected to receive it.
+	NotifyReminderDue(userID uuid.UUID, item *domain.SavedItem) bool
+}
+
+// SavedService manages the messages users save for later and reminds them
+// about the ones they set a reminder on.
+type SavedService struct {
+	savedRepo     repository.SavedItemRepository
+	messageRepo   repository.MessageRepository
+	dmRepo        repository.DMRepository
+	channelRepo   repository.ChannelRepository
+	workspaceRepo repository.WorkspaceRepository
+	userRepo      repository.UserRepository
+	notifier      ReminderNotifier
+	mailer        Mailer
+	appURL        string
+}
+
+func NewSavedService(
+	savedRepo repository.SavedItemRepository,
+	messageRepo repository.MessageRepository,
+	dmRepo repository.DMRepository,
+	channelRepo repository.ChannelRepository,
+	workspaceRepo repository.WorkspaceRepository,
+	userRepo repository.UserRepository,
+) *SavedService {
+	return &SavedService{
+		savedRepo:     savedRepo,
+		messageRepo:   messageRepo,
+		dmRepo:        dmRepo,
+		channelRepo:   channelRepo,
+		workspaceRepo: workspaceRepo,
+		userRepo:      userRepo,
+	}
+}
+
+// SetNotifier sets where due reminders are pushed (optional dependency).
+func (s *SavedService) SetNotifier(n ReminderNotifier) {
+	s.notifier = n
+}
+
+// SetMailer sets the mailer used for reminders of users who aren't connected
+// (optional dependency). appURL is the frontend base URL.
+func (s *SavedService) SetMailer(m Mailer, appURL string) {
+	s.mailer = m
+	s.appURL = strings.TrimRight(appURL, "/")
+}
+
+type SaveInput struct {
+	// A channel message or DM
+	MessageID uuid.UUID  `json:"message_id"`
+	RemindAt  *time.Time `json:"remind_at,omitempty"`
+}
+
+// Save adds a message to the user's saved items. Saving a message again
+// returns the existing item, with the reminder replaced if one is given.
+func (s *SavedService) Save(ctx context.Context, userID uuid.UUID, input SaveInput) (*domain.SavedItem, error) {
+	ctx, span := tracer.Start(ctx, "SavedService.Save")
+	defer span.End()
+
+	if err := checkReminder(input.RemindAt); err != nil {
+		return nil, err
+	}
+
+	existing, err := s.savedRepo.GetByMessage(ctx, userID, input.MessageID)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil {
+		if input.RemindAt != nil {
+			return s.SetReminder(ctx, userID, existing.ID, input.RemindAt)
+		}
+		ok, err := s.resolve(ctx, userID, existing, nil)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return nil, ErrMessageNotFound
+		}
+		return existing, nil
+	}
+
+	item := &domain.SavedItem{
+		ID:        uuid.New(),
+		UserID:    userID,
+		RemindAt:  input.RemindAt,
+		CreatedAt: time.Now(),
+	}
+	msg, err := s.messageRepo.GetByID(ctx, input.MessageID)
+	if err != nil {
+		return nil, err
+	}
+	if msg != nil {
+		item.MessageID = &msg.ID
+	} else {
+		item.DMMessageID = &input.MessageID
+	}
+	// Only messages the user can read can be saved
+	ok, err := s.resolve(ctx, userID, item, nil)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrMessageNotFound
+	}
+
+	if err := s.savedRepo.Create(ctx, item); err != nil {
+		if isDuplicateError(err) {
+			// Saved concurrently by another request
+			return s.Save(ctx, userID, input)
+		}
+		return nil, fmt.Errorf("saving message: %w", err)
+	}
+
+	return item, nil
+}
+
+// List returns the user's saved items, newest first. Items whose message
+// was deleted or that the user can no longer read are left out.
+func (s *SavedService) List(ctx context.Context, userID uuid.UUID) ([]domain.SavedItem, error) {
+	ctx, span := tracer.Start(ctx, "SavedService.List")
+	defer span.End()
+
+	items, err := s.savedRepo.ListByUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	access := make(map[uuid.UUID]bool)
+	visible := make([]domain.SavedItem, 0, len(items))
+	for _, item := range items {
+		ok, err := s.resolve(ctx, userID, &item, access)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			visible = append(visible, item)
+		}
+	}
+	return visible, nil
+}
+
+// SetReminder sets, moves or (with a nil time) clears the item's reminder.
+func (s *SavedService) SetReminder(ctx context.Context, userID, itemID uuid.UUID, remindAt *time.Time) (*domain.SavedItem, error) {
+	ctx, span := tracer.Start(ctx, "SavedService.SetReminder")
+	defer span.End()
+
+	if err := checkReminder(remindAt); err != nil {
+		return nil, err
+	}
+
+	item, err := s.ownItem(ctx, userID, itemID)
+	if err != nil {
+		return nil, err
+	}
+	ok, err := s.resolve(ctx, userID, item, nil)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrSavedItemNotFound
+	}
+
+	if err := s.savedRepo.SetReminder(ctx, itemID, remindAt); err != nil {
+		return nil, fmt.Errorf("setting reminder: %w", err)
+	}
+	item.RemindAt = remindAt
+	item.RemindedAt = nil
+	return item, nil
+}
+
+// Unsave removes the item, with its reminder.
+func (s *SavedService) Unsave(ctx context.Context, userID, itemID uuid.UUID) error {
+	ctx, span := tracer.Start(ctx, "SavedService.Unsave")
+	defer span.End()
+
+	if _, err := s.ownItem(ctx, userID, itemID); err != nil {
+		return err
+	}
+	return s.savedRepo.Delete(ctx, itemID)
+}
+
+// RunReminders delivers due reminders every interval until ctx is cancelled.
+// Reminders are stored, so ones that came due while no server was running
+// are delivered on the next poll. Several instances can run it at once.
+func (s *SavedService) RunReminders(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := s.deliverDueReminders(ctx, time.Now()); err != nil && ctx.Err() == nil {
+			slog.ErrorContext(ctx, "delivering reminders", "err", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// deliverDueReminders sends every reminder due at now.
+func (s *SavedService) deliverDueReminders(ctx context.Context, now time.Time) error {
+	for {
+		items, err := s.savedRepo.ListDueReminders(ctx, now, reminderBatchSize)
+		if err != nil {
+			return err
+		}
+		for _, item := range items {
+			if err := s.deliverReminder(ctx, &item, now); err != nil {
+				slog.WarnContext(ctx, "delivering reminder", "saved_item_id", item.ID, "err", err)
+			}
+		}
+		if len(items) < reminderBatchSize {
+			return nil
+		}
+	}
+}
+
+// deliverReminder claims the reminder, so no other worker sends it too, and
+// pushes it to the user's connections, or emails it if they have none. A
+// reminder that fails after being claimed isn't retried.
+func (s *SavedService) deliverReminder(ctx context.Context, item *domain.SavedItem, now time.Time) error {
+	claimed, err := s.savedRepo.MarkReminded(ctx, item.ID, now)
+	if err != nil || !claimed {
+		return err
+	}
+	item.RemindedAt = &now
+
+	// Don't remind anyone about a message they can no longer read
+	ok, err := s.resolve(ctx, item.UserID, item, nil)
+	if err != nil || !ok {
+		return err
+	}
+
+	if s.notifier != nil && s.notifier.NotifyReminderDue(item.UserID, item) {
+		return nil
+	}
+	return s.emailReminder(ctx, item)
+}
+
+func (s *SavedService) emailReminder(ctx context.Context, item *domain.SavedItem) error {
+	if s.mailer == nil {
+		return nil
+	}
+	user, err := s.userRepo.GetByID(ctx, item.UserID)
+	if err != nil || user == nil {
+		return err
+	}
+
+	var sender string
+	var content *string
+	if item.Message != nil {
+		sender, content = item.Message.SenderDisplayName, item.Message.Content
+	} else {
+		sender, content = item.DMMessage.SenderDisplayName, item.DMMessage.Content
+	}
+	subject, body, err := reminderMail.render(map[string]any{
+		"DisplayName": user.DisplayName,
+		"SenderName":  sender,
+		"Snippet":     snippet(content, 200),
+		"Link":        s.appURL + "/saved",
+	})
+	if err != nil {
+		return err
+	}
+	return s.mailer.Send(ctx, user.Email, subject, body)
+}
+
+// snippet shortens message content for a notification.
+func snippet(content *string, max int) string {
+	if content == nil {
+		return ""
+	}
+	text := strings.Join(strings.Fields(*content), " ")
+	if utf8.RuneCountInString(text) <= max {
+		return text
+	}
+	return string([]rune(text)[:max-1]) + "…"
+}
+
+// ownItem loads one of the user's saved items.
+func (s *SavedService) ownItem(ctx context.Context, userID, itemID uuid.UUID) (*domain.SavedItem, error) {
+	item, err := s.savedRepo.GetByID(ctx, itemID)
+	if err != nil {
+		return nil, err
+	}
+	if item == nil || item.UserID != userID {
+		return nil, ErrSavedItemNotFound
+	}
+	return item, nil
+}
+
+// resolve fills in the item's message and reports whether the user can
+// still read it. Access is checked per channel or conversation, and cached
+// in access when it isn't nil.
+func (s *SavedService) resolve(ctx context.Context, userID uuid.UUID, item *domain.SavedItem, access map[uuid.UUID]bool) (bool, error) {
+	var parentID uuid.UUID
+	var check func() error
+	if item.MessageID != nil {
+		msg, err := s.messageRepo.GetByID(ctx, *item.MessageID)
+		if err != nil || msg == nil || msg.DeletedAt != nil {
+			return false, err
+		}
+		withMarkup(msg)
+		item.Message = msg
+		parentID = msg.ChannelID
+		check = func() error {
+			_, err := channelAccess(ctx, s.channelRepo, s.workspaceRepo, userID, msg.ChannelID)
+			return err
+		}
+	} else if item.DMMessageID != nil {
+		msg, err := s.dmRepo.GetMessageByID(ctx, *item.DMMessageID)
+		if err != nil || msg == nil || msg.DeletedAt != nil {
+			return false, err
+		}
+		withDMMarkup(msg)
+		item.DMMessage = msg
+		parentID = msg.ConversationID
+		check = func() error { return dmParticipant(ctx, s.dmRepo, userID, msg.ConversationID) }
+	} else {
+		return false, nil
+	}
+
+	if ok, cached := access[parentID]; cached {
+		return ok, nil
+	}
+	err := check()
+	switch {
+	case err == nil:
+	case errors.Is(err, ErrChannelNotFound), errors.Is(err, ErrNotMember), errors.Is(err, ErrNotChannelMember),
+		errors.Is(err, ErrDMConversationNotFound), errors.Is(err, ErrDMNotParticipant),
+		errors.Is(err, ErrTwoFactorRequired), errors.Is(err, ErrSSORequired):
+	default:
+		return false, err
+	}
+	if access != nil {
+		access[parentID] = err == nil
+	}
+	return err == nil, nil
+}
+
+func checkReminder(remindAt *time.Time) error {
+	if remindAt == nil {
+		return nil
+	}
+	if delay := time.Until(*remindAt); delay <= 0 || delay > maxReminderDelay {
+		return ErrInvalidReminder
+	}
+	return nil
+}
@@ -0,0 +1,123 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/vedran77/pulse/internal/domain"
+	"github.com/vedran77/pulse/internal/repository/memory"
+)
+
+type sentMail struct{ to, subject, body string }
+
+type mailRecorder struct{ sent []sentMail }
+
+func (m *mailRecorder) Send(ctx context.Context, to, subject, body string) error {
+	m.sent = append(m.sent, sentMail{to, subject, body})
+	return nil
+}
+
+// reminderRecorder stands in for the hub, with the given users connected.
+type reminderRecorder struct {
+	online map[uuid.UUID]bool
+	due    []*domain.SavedItem
+}
+
+func (r *reminderRecorder) NotifyReminderDue(userID uuid.UUID, item *domain.SavedItem) bool {
+	if !r.online[userID] {
+		return false
+	}
+	r.due = append(r.due, item)
+	return true
+}
+
+func TestSavedItems(t *testing.T) {
+	ctx := context.Background()
+	f := newTestWorkspace(t)
+	store, users, workspaces, channels := f.store, f.users, f.workspaces, f.channels
+	alice, bob, channelSvc := f.alice, f.bob, f.channelSvc
+	messages := memory.NewMessageRepo(store)
+	ch := f.channel(t, alice, CreateChannelInput{Name: "ops", Type: "private"}, bob)
+	msg, err := NewMessageService(messages, channels, workspaces).Send(ctx, alice.ID, ch.ID, SendMessageInput{Content: "on-call handover at 9"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	svc := NewSavedService(memory.NewSavedItemRepo(store), messages, memory.NewDMRepo(store), channels, workspaces, users)
+	notifier := &reminderRecorder{online: map[uuid.UUID]bool{}}
+	mailer := &mailRecorder{}
+	svc.SetNotifier(notifier)
+	svc.SetMailer(mailer, "https://pulse.example/")
+
+	if _, err := svc.Save(ctx, bob.ID, SaveInput{MessageID: uuid.New()}); !errors.Is(err, ErrMessageNotFound) {
+		t.Fatalf("saving a missing message: err = %v", err)
+	}
+	past := time.Now().Add(-time.Minute)
+	if _, err := svc.Save(ctx, bob.ID, SaveInput{MessageID: msg.ID, RemindAt: &past}); !errors.Is(err, ErrInvalidReminder) {
+		t.Fatalf("reminder in the past: err = %v", err)
+	}
+
+	remindAt := time.Now().Add(time.Hour)
+	saved, err := svc.Save(ctx, bob.ID, SaveInput{MessageID: msg.ID, RemindAt: &remindAt})
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, err := svc.Save(ctx, bob.ID, SaveInput{MessageID: msg.ID})
+	if err != nil || again.ID != saved.ID || again.RemindAt == nil {
+		t.Fatalf("saving again = %+v, %v", again, err)
+	}
+	items, err := svc.List(ctx, bob.ID)
+	if err != nil || len(items) != 1 || items[0].Message == nil || len(items[0].Message.Markup) == 0 {
+		t.Fatalf("List = %+v, %v", items, err)
+	}
+
+	// Bob is offline, so the reminder is emailed, once
+	later := time.Now().Add(2 * time.Hour)
+	if err := svc.deliverDueReminders(ctx, later); err != nil {
+		t.Fatal(err)
+	}
+	if err := svc.deliverDueReminders(ctx, later); err != nil {
+		t.Fatal(err)
+	}
+	if len(mailer.sent) != 1 || mailer.sent[0].to != bob.Email || len(notifier.due) != 0 {
+		t.Fatalf("offline reminder: mails = %+v, events = %d", mailer.sent, len(notifier.due))
+	}
+
+	// Online now: the rescheduled reminder goes to his connections instead
+	if _, err := svc.SetReminder(ctx, bob.ID, saved.ID, &remindAt); err != nil {
+		t.Fatal(err)
+	}
+	notifier.online[bob.ID] = true
+	if err := svc.deliverDueReminders(ctx, later); err != nil {
+		t.Fatal(err)
+	}
+	if len(mailer.sent) != 1 || len(notifier.due) != 1 || notifier.due[0].Message.ID != msg.ID {
+		t.Fatalf("online reminder: mails = %d, events = %+v", len(mailer.sent), notifier.due)
+	}
+
+	// After leaving the channel the item is hidden and its reminder dropped
+	if _, err := svc.SetReminder(ctx, alice.ID, saved.ID, &remindAt); !errors.Is(err, ErrSavedItemNotFound) {
+		t.Fatalf("SetReminder on someone else's item: err = %v", err)
+	}
+	if _, err := svc.SetReminder(ctx, bob.ID, saved.ID, &remindAt); err != nil {
+		t.Fatal(err)
+	}
+	if err := channelSvc.RemoveMember(ctx, bob.ID, ch.ID, bob.ID); err != nil {
+		t.Fatal(err)
+	}
+	if items, _ := svc.List(ctx, bob.ID); len(items) != 0 {
+		t.Fatalf("List after losing access = %+v", items)
+	}
+	if err := svc.deliverDueReminders(ctx, later); err != nil {
+		t.Fatal(err)
+	}
+	if len(notifier.due) != 1 {
+		t.Fatalf("reminder delivered without access: %+v", notifier.due)
+	}
+	if err := svc.Unsave(ctx, bob.ID, saved.ID); err != nil {
+		t.Fatal(err)
+	}
+}
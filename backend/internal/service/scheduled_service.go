@@ -0,0 +1,334 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/vedran77/pulse/internal/domain"
+	"github.com/vedran77/pulse/internal/markup"
+	"github.com/vedran77/pulse/internal/repository"
+)
+
+const (
+	maxScheduledPerUser = 100
+	maxScheduleDelay    = 365 * 24 * time.Hour
+
+	// A delivery that fails for a reason that may pass is retried after
+	// retryBackoff, doubling each time, and given up after maxDeliveryAttempts
+	maxDeliveryAttempts = 5
+	retryBackoff        = 30 * time.Second
+)
+
+var (
+	ErrScheduledMessageNotFound = errors.New("scheduled message not found")
+	ErrInvalidSendTime          = errors.New("send time must be in the future and at most a year away")
+	ErrTooManyScheduled         = fmt.Errorf("at most %d messages can be scheduled at once", maxScheduledPerUser)
+)
+
+// ScheduledService queues channel messages and DMs to be sent later and
+// delivers them when they're due.
+type ScheduledService struct {
+	scheduledRepo  repository.ScheduledMessageRepository
+	messageService *MessageService
+	dmService      *DMService
+	tx             repository.TxManager
+}
+
+func NewScheduledService(scheduledRepo repository.ScheduledMessageRepository, messageService *MessageService, dmService *DMService, tx repository.TxManager) *ScheduledService {
+	return &ScheduledService{
+		scheduledRepo:  scheduledRepo,
+		messageService: messageService,
+		dmService:      dmService,
+		tx:             tx,
+	}
+}
+
+type UpdateScheduledInput struct {
+	Content *string    `json:"content"`
+	SendAt  *time.Time `json:"send_at"`
+}
+
+// ScheduleMessage queues a channel message. Access and read-only mode are
+// checked now and again when it's sent; slow mode only applies at sending.
+func (s *ScheduledService) ScheduleMessage(ctx context.Context, userID, channelID uuid.UUID, input SendMessageInput, sendAt time.Time) (*domain.ScheduledMessage, error) {
+	ctx, span := tracer.Start(ctx, "ScheduledService.ScheduleMessage")
+	defer span.End()
+
+	ch, err := s.messageService.checkChannelAccess(ctx, userID, channelID)
+	if err != nil {
+		return nil, err
+	}
+	ms := s.messageService
+	if _, err := checkReadOnly(ctx, ms.channelRepo, ms.workspaceRepo, userID, ch); err != nil {
+		return nil, err
+	}
+	return s.schedule(ctx, &domain.ScheduledMessage{
+		UserID:    userID,
+		ChannelID: &channelID,
+		ParentID:  input.ParentID,
+		Content:   input.Content,
+		SendAt:    sendAt,
+	})
+}
+
+// ScheduleDM queues a direct message.
+func (s *ScheduledService) ScheduleDM(ctx context.Context, userID, conversationID uuid.UUID, content string, sendAt time.Time) (*domain.ScheduledMessage, error) {
+	ctx, span := tracer.Start(ctx, "ScheduledService.ScheduleDM")
+	defer span.End()
+
+	if err := s.dmService.checkParticipant(ctx, userID, conversationID); err != nil {
+		return nil, err
+	}
+	return s.schedule(ctx, &domain.ScheduledMessage{
+		UserID:         userID,
+		ConversationID: &conversationID,
+		Content:        content,
+		SendAt:         sendAt,
+	})
+}
+
+func (s *ScheduledService) schedule(ctx context.Context, msg *domain.ScheduledMessage) (*domain.ScheduledMessage, error) {
+	content, err := markup.Normalize(msg.Content)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkSendAt(msg.SendAt); err != nil {
+		return nil, err
+	}
+
+	pending, err := s.scheduledRepo.ListByUser(ctx, msg.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if len(pending) >= maxScheduledPerUser {
+		return nil, ErrTooManyScheduled
+	}
+
+	now := time.Now()
+	msg.ID = uuid.New()
+	msg.Content = content
+	msg.CreatedAt = now
+	msg.UpdatedAt = now
+	if err := s.scheduledRepo.Create(ctx, msg); err != nil {
+		return nil, fmt.Errorf("scheduling message: %w", err)
+	}
+	return msg, nil
+}
+
+// List returns the user's scheduled messages, soonest first, including
+// ones that failed to send.
+func (s *ScheduledService) List(ctx context.Context, userID uuid.UUID) ([]domain.ScheduledMessage, error) {
+	ctx, span := tracer.Start(ctx, "ScheduledService.List")
+	defer span.End()
+
+	msgs, err := s.scheduledRepo.ListByUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if msgs == nil {
+		msgs = []domain.ScheduledMessage{}
+	}
+	return msgs, nil
+}
+
+// Update changes the content or send time. A message that failed to send
+// is retried.
+func (s *ScheduledService) Update(ctx context.Context, userID, id uuid.UUID, input UpdateScheduledInput) (*domain.ScheduledMessage, error) {
+	ctx, span := tracer.Start(ctx, "ScheduledService.Update")
+	defer span.End()
+
+	msg, err := s.ownMessage(ctx, userID, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if input.Content != nil {
+		content, err := markup.Normalize(*input.Content)
+		if err != nil {
+			return nil, err
+		}
+		msg.Content = content
+	}
+	if input.SendAt != nil {
+		if err := checkSendAt(*input.SendAt); err != nil {
+			return nil, err
+		}
+		msg.SendAt = *input.SendAt
+	}
+	msg.FailedAt = nil
+	msg.Error = nil
+	msg.UpdatedAt = time.Now()
+
+	// It may have been sent or cancelled since ownMessage read it
+	ok, err := s.scheduledRepo.Update(ctx, msg)
+	if err != nil {
+		return nil, fmt.Errorf("updating scheduled message: %w", err)
+	}
+	if !ok {
+		return nil, ErrScheduledMessageNotFound
+	}
+	return msg, nil
+}
+
+// Cancel deletes a scheduled message before it's sent.
+func (s *ScheduledService) Cancel(ctx context.Context, userID, id uuid.UUID) error {
+	ctx, span := tracer.Start(ctx, "ScheduledService.Cancel")
+	defer span.End()
+
+	if _, err := s.ownMessage(ctx, userID, id); err != nil {
+		return err
+	}
+	ok, err := s.scheduledRepo.Delete(ctx, id)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrScheduledMessageNotFound
+	}
+	return nil
+}
+
+// RunScheduledMessages sends due messages every interval until ctx is
+// cancelled. Messages stay queued in the database until sent, so ones that
+// came due while no server was running go out on the next poll.
+func (s *ScheduledService) RunScheduledMessages(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := s.deliverDue(ctx, time.Now()); err != nil && ctx.Err() == nil {
+			slog.ErrorContext(ctx, "delivering scheduled messages", "err", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// deliverDue sends every message due at now, one transaction each.
+func (s *ScheduledService) deliverDue(ctx context.Context, now time.Time) error {
+	for {
+		sent, err := s.deliverNext(ctx, now)
+		if err != nil || !sent {
+			return err
+		}
+	}
+}
+
+// deliverNext sends the earliest due message and reports whether there was
+// one. The row stays locked while the message is sent and is deleted in the
+// same transaction, so each message is sent exactly once even with several
+// workers; if sending fails the transaction rolls back and it's retried
+// later, so it doesn't hold up the messages behind it. Clients only hear
+// about the message once the transaction has committed.
+func (s *ScheduledService) deliverNext(ctx context.Context, now time.Time) (bool, error) {
+	var claimed *domain.ScheduledMessage
+	var announce func(ctx context.Context)
+	err := s.tx.WithinTx(ctx, func(ctx context.Context) error {
+		msg, err := s.scheduledRepo.ClaimDue(ctx, now)
+		if err != nil || msg == nil {
+			return err
+		}
+		claimed = msg
+
+		sent, err := s.send(ctx, msg)
+		if err != nil {
+			// Slow mode: try again once the cooldown is over
+			var slow *SlowModeError
+			if errors.As(err, &slow) {
+				msg.SendAt = slow.Until
+				_, err := s.scheduledRepo.Update(ctx, msg)
+				return err
+			}
+			if !isPermanentSendError(err) {
+				return err
+			}
+			// The sender can fix it by editing the message, which retries it
+			slog.InfoContext(ctx, "scheduled message failed", "scheduled_message_id", msg.ID, "err", err)
+			return s.scheduledRepo.MarkFailed(ctx, msg.ID, err.Error(), now)
+		}
+		// The claim locks the row, so it's still there to delete
+		if _, err := s.scheduledRepo.Delete(ctx, msg.ID); err != nil {
+			return err
+		}
+		announce = sent
+		return nil
+	})
+	if err != nil {
+		if claimed == nil || ctx.Err() != nil {
+			return false, err
+		}
+		return true, s.retryLater(ctx, claimed, err, now)
+	}
+	if announce != nil {
+		announce(ctx)
+	}
+	return claimed != nil, nil
+}
+
+// retryLater puts a message whose delivery failed back in the queue with a
+// backoff, or marks it failed once it has used up its attempts.
+func (s *ScheduledService) retryLater(ctx context.Context, msg *domain.ScheduledMessage, cause error, now time.Time) error {
+	attempts := msg.Attempts + 1
+	if attempts >= maxDeliveryAttempts {
+		slog.WarnContext(ctx, "scheduled message failed", "scheduled_message_id", msg.ID, "attempts", attempts, "err", cause)
+		return s.scheduledRepo.MarkFailed(ctx, msg.ID, "could not be delivered, edit the message to try again", now)
+	}
+	slog.WarnContext(ctx, "scheduled message delivery failed, retrying", "scheduled_message_id", msg.ID, "attempts", attempts, "err", cause)
+	return s.scheduledRepo.Retry(ctx, msg.ID, now.Add(retryBackoff<<(attempts-1)))
+}
+
+// send stores the scheduled message as a real one and returns the function
+// that announces it.
+func (s *ScheduledService) send(ctx context.Context, msg *domain.ScheduledMessage) (func(ctx context.Context), error) {
+	if msg.ChannelID != nil {
+		sent, err := s.messageService.create(ctx, msg.UserID, *msg.ChannelID, SendMessageInput{Content: msg.Content, ParentID: msg.ParentID})
+		if err != nil {
+			return nil, err
+		}
+		return func(ctx context.Context) { s.messageService.announce(ctx, sent) }, nil
+	}
+	sent, err := s.dmService.createMessage(ctx, msg.UserID, *msg.ConversationID, msg.Content)
+	if err != nil {
+		return nil, err
+	}
+	return func(context.Context) { s.dmService.announceMessage(sent) }, nil
+}
+
+// isPermanentSendError reports whether retrying the send can't help.
+func isPermanentSendError(err error) bool {
+	for _, target := range []error{
+		ErrChannelNotFound, ErrNotMember, ErrNotChannelMember, ErrChannelReadOnly, ErrChannelArchived,
+		ErrDMConversationNotFound, ErrDMNotParticipant,
+		ErrEmptyContent, ErrContentTooLong, ErrInvalidContent,
+	} {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *ScheduledService) ownMessage(ctx context.Context, userID, id uuid.UUID) (*domain.ScheduledMessage, error) {
+	msg, err := s.scheduledRepo.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if msg == nil || msg.UserID != userID {
+		return nil, ErrScheduledMessageNotFound
+	}
+	return msg, nil
+}
+
+func checkSendAt(sendAt time.Time) error {
+	if delay := time.Until(sendAt); delay <= 0 || delay > maxScheduleDelay {
+		return ErrInvalidSendTime
+	}
+	return nil
+}
@@ -0,0 +1,228 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/vedran77/pulse/internal/domain"
+	"github.com/vedran77/pulse/internal/repository"
+	"github.com/vedran77/pulse/internal/repository/memory"
+)
+
+func TestScheduledMessages(t *testing.T) {
+	ctx := context.Background()
+	f := newTestWorkspace(t)
+	store, users, workspaces, channels, tx := f.store, f.users, f.workspaces, f.channels, f.tx
+	alice, bob, channelSvc := f.alice, f.bob, f.channelSvc
+	messages := memory.NewMessageRepo(store)
+	ch := f.channel(t, alice, CreateChannelInput{Name: "ops", Type: "private"}, bob)
+
+	svc := NewScheduledService(memory.NewScheduledMessageRepo(store), NewMessageService(messages, channels, workspaces), NewDMService(memory.NewDMRepo(store), users), tx)
+
+	if _, err := svc.ScheduleMessage(ctx, bob.ID, ch.ID, SendMessageInput{Content: "hi"}, time.Now().Add(-time.Minute)); !errors.Is(err, ErrInvalidSendTime) {
+		t.Fatalf("send time in the past: err = %v", err)
+	}
+
+	sendAt := time.Now().Add(time.Hour)
+	first, err := svc.ScheduleMessage(ctx, bob.ID, ch.ID, SendMessageInput{Content: "standup in 5"}, sendAt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := svc.ScheduleMessage(ctx, bob.ID, ch.ID, SendMessageInput{Content: "retro notes"}, sendAt.Add(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.Update(ctx, alice.ID, first.ID, UpdateScheduledInput{}); !errors.Is(err, ErrScheduledMessageNotFound) {
+		t.Fatalf("editing someone else's message: err = %v", err)
+	}
+
+	// Nothing is due yet
+	if err := svc.deliverDue(ctx, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if list, err := svc.List(ctx, bob.ID); err != nil || len(list) != 2 {
+		t.Fatalf("List = %+v, %v", list, err)
+	}
+
+	// Both are sent once and leave the queue
+	later := sendAt.Add(time.Hour)
+	if err := svc.deliverDue(ctx, later); err != nil {
+		t.Fatal(err)
+	}
+	if err := svc.deliverDue(ctx, later); err != nil {
+		t.Fatal(err)
+	}
+	sent, err := messages.ListByChannel(ctx, ch.ID, repository.Page{Limit: 10})
+	if err != nil || len(sent) != 2 || *sent[0].Content != "standup in 5" || *sent[1].Content != "retro notes" {
+		t.Fatalf("sent messages = %+v, %v", sent, err)
+	}
+	if list, err := svc.List(ctx, bob.ID); err != nil || len(list) != 0 {
+		t.Fatalf("List after sending = %+v, %v", list, err)
+	}
+	if err := svc.Cancel(ctx, bob.ID, second.ID); !errors.Is(err, ErrScheduledMessageNotFound) {
+		t.Fatalf("cancelling a sent message: err = %v", err)
+	}
+
+	// Losing access marks the message failed instead of retrying forever
+	queued, err := svc.ScheduleMessage(ctx, bob.ID, ch.ID, SendMessageInput{Content: "still here?"}, sendAt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := channelSvc.RemoveMember(ctx, alice.ID, ch.ID, bob.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := svc.deliverDue(ctx, later); err != nil {
+		t.Fatal(err)
+	}
+	list, err := svc.List(ctx, bob.ID)
+	if err != nil || len(list) != 1 || list[0].FailedAt == nil || list[0].Error == nil {
+		t.Fatalf("failed message = %+v, %v", list, err)
+	}
+
+	// Editing it retries it
+	if err := channelSvc.AddMember(ctx, alice.ID, ch.ID, bob.ID); err != nil {
+		t.Fatal(err)
+	}
+	retryAt := time.Now().Add(time.Minute)
+	if _, err := svc.Update(ctx, bob.ID, queued.ID, UpdateScheduledInput{SendAt: &retryAt}); err != nil {
+		t.Fatal(err)
+	}
+	if err := svc.deliverDue(ctx, later); err != nil {
+		t.Fatal(err)
+	}
+	if sent, _ := messages.ListByChannel(ctx, ch.ID, repository.Page{Limit: 10}); len(sent) != 3 {
+		t.Fatalf("retried message not sent: %d messages", len(sent))
+	}
+
+	// Sent between being read and written by an edit or cancel
+	racing := NewScheduledService(staleRead{memory.NewScheduledMessageRepo(store), queued}, NewMessageService(messages, channels, workspaces), NewDMService(memory.NewDMRepo(store), users), tx)
+	if _, err := racing.Update(ctx, bob.ID, queued.ID, UpdateScheduledInput{SendAt: &retryAt}); !errors.Is(err, ErrScheduledMessageNotFound) {
+		t.Fatalf("editing a message sent meanwhile: err = %v", err)
+	}
+	if err := racing.Cancel(ctx, bob.ID, queued.ID); !errors.Is(err, ErrScheduledMessageNotFound) {
+		t.Fatalf("cancelling a message sent meanwhile: err = %v", err)
+	}
+}
+
+// staleRead still returns a message that has left the queue.
+type staleRead struct {
+	*memory.ScheduledMessageRepo
+	msg *domain.ScheduledMessage
+}
+
+func (r staleRead) GetByID(ctx context.Context, id uuid.UUID) (*domain.ScheduledMessage, error) {
+	if id == r.msg.ID {
+		cp := *r.msg
+		return &cp, nil
+	}
+	return r.ScheduledMessageRepo.GetByID(ctx, id)
+}
+
+// failingDelete can't take one message off the queue.
+type failingDelete struct {
+	*memory.ScheduledMessageRepo
+	id uuid.UUID
+}
+
+func (r failingDelete) Delete(ctx context.Context, id uuid.UUID) (bool, error) {
+	if id == r.id {
+		return false, errors.New("connection reset")
+	}
+	return r.ScheduledMessageRepo.Delete(ctx, id)
+}
+
+// newMessageRecorder records message.new notifications.
+type newMessageRecorder struct {
+	Notifier
+	sent []string
+}
+
+func (r *newMessageRecorder) NotifyNewMessage(msg *domain.Message) {
+	r.sent = append(r.sent, *msg.Content)
+}
+
+func TestScheduledDeliveryFailures(t *testing.T) {
+	ctx := context.Background()
+	f := newTestWorkspace(t)
+	store, users, workspaces, channels, tx := f.store, f.users, f.workspaces, f.channels, f.tx
+	alice := f.alice
+	messages := memory.NewMessageRepo(store)
+	ch := f.channel(t, alice, CreateChannelInput{Name: "general", Type: "public"})
+
+	messageSvc := NewMessageService(messages, channels, workspaces)
+	recorder := &newMessageRecorder{}
+	messageSvc.SetNotifier(recorder)
+	queue := memory.NewScheduledMessageRepo(store)
+	dmSvc := NewDMService(memory.NewDMRepo(store), users)
+	svc := NewScheduledService(queue, messageSvc, dmSvc, tx)
+	failing := func(msg *domain.ScheduledMessage) *ScheduledService {
+		return NewScheduledService(failingDelete{queue, msg.ID}, messageSvc, dmSvc, tx)
+	}
+
+	sendAt := time.Now().Add(time.Hour)
+	launch, err := svc.ScheduleMessage(ctx, alice.ID, ch.ID, SendMessageInput{Content: "launch"}, sendAt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.ScheduleMessage(ctx, alice.ID, ch.ID, SendMessageInput{Content: "party"}, sendAt.Add(time.Second)); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("rolled back delivery", func(t *testing.T) {
+		// The send is rolled back with the failed delete and nobody hears of
+		// it, while the message behind it still goes out
+		later := sendAt.Add(time.Minute)
+		if err := failing(launch).deliverDue(ctx, later); err != nil {
+			t.Fatal(err)
+		}
+		if len(recorder.sent) != 1 || recorder.sent[0] != "party" {
+			t.Fatalf("announced messages = %v", recorder.sent)
+		}
+		if sent, _ := messages.ListByChannel(ctx, ch.ID, repository.Page{Limit: 10}); len(sent) != 1 {
+			t.Fatalf("rolled back delivery left %d messages", len(sent))
+		}
+		got, _ := queue.GetByID(ctx, launch.ID)
+		if got.Attempts != 1 || !got.SendAt.Equal(later.Add(retryBackoff).Truncate(time.Microsecond)) || got.FailedAt != nil {
+			t.Fatalf("message after a failed delivery = %+v", got)
+		}
+
+		// The retry sends and announces it once
+		if err := svc.deliverDue(ctx, later); err != nil {
+			t.Fatal(err)
+		}
+		if len(recorder.sent) != 1 {
+			t.Fatal("retried before the backoff")
+		}
+		if err := svc.deliverDue(ctx, later.Add(retryBackoff)); err != nil {
+			t.Fatal(err)
+		}
+		if len(recorder.sent) != 2 || recorder.sent[1] != "launch" {
+			t.Fatalf("announced messages = %v", recorder.sent)
+		}
+	})
+
+	t.Run("gives up", func(t *testing.T) {
+		doomed, err := svc.ScheduleMessage(ctx, alice.ID, ch.ID, SendMessageInput{Content: "doomed"}, sendAt)
+		if err != nil {
+			t.Fatal(err)
+		}
+		broken := failing(doomed)
+		at := sendAt
+		for range maxDeliveryAttempts {
+			at = at.Add(time.Hour)
+			if err := broken.deliverDue(ctx, at); err != nil {
+				t.Fatal(err)
+			}
+		}
+		got, _ := queue.GetByID(ctx, doomed.ID)
+		if got.FailedAt == nil || got.Error == nil {
+			t.Fatalf("message after %d failed deliveries = %+v", maxDeliveryAttempts, got)
+		}
+		if len(recorder.sent) != 2 {
+			t.Fatalf("announced messages = %v", recorder.sent)
+		}
+	})
+}
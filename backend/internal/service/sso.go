@@ -0,0 +1,251 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/vedran77/pulse/internal/domain"
+	"github.com/vedran77/pulse/internal/oidc"
+)
+
+var (
+	ErrSSONotConfigured   = errors.New("single sign-on is not configured")
+	ErrSSORequired        = errors.New("single sign-on is required")
+	ErrSSOEmailUnverified = errors.New("identity provider did not return a verified email")
+)
+
+// How long the user has to finish signing in at the provider
+const oidcLoginTTL = 10 * time.Minute
+
+// OIDCProvider runs the authorization code flow against the identity provider.
+type OIDCProvider interface {
+	Issuer() string
+	AuthCodeURL(state, nonce, codeChallenge string) string
+	Exchange(ctx context.Context, code, codeVerifier, nonce string) (*oidc.Claims, error)
+}
+
+// SetOIDC enables SSO login through the given provider (optional dependency).
+func (s *AuthService) SetOIDC(p OIDCProvider) {
+	s.oidc = p
+}
+
+// StartOIDCLogin creates a login attempt and returns the provider URL to
+// redirect to, plus the state the caller must bind to the browser.
+func (s *AuthService) StartOIDCLogin(ctx context.Context) (authURL, state string, err error) {
+	ctx, span := tracer.Start(ctx, "AuthService.StartOIDCLogin")
+	defer span.End()
+
+	if s.oidc == nil {
+		return "", "", ErrSSONotConfigured
+	}
+
+	state, err = randomToken()
+	if err != nil {
+		return "", "", fmt.Errorf("generating state: %w", err)
+	}
+	nonce, err := randomToken()
+	if err != nil {
+		return "", "", fmt.Errorf("generating nonce: %w", err)
+	}
+	verifier, err := oidc.NewPKCEVerifier()
+	if err != nil {
+		return "", "", fmt.Errorf("generating verifier: %w", err)
+	}
+
+	now := time.Now()
+	ls := &domain.OIDCLoginState{
+		StateHash:    hashToken(state),
+		CodeVerifier: verifier,
+		Nonce:        nonce,
+		ExpiresAt:    now.Add(oidcLoginTTL),
+		CreatedAt:    now,
+	}
+	if err := s.identityRepo.CreateLoginState(ctx, ls); err != nil {
+		return "", "", fmt.Errorf("storing login state: %w", err)
+	}
+
+	return s.oidc.AuthCodeURL(state, nonce, oidc.PKCEChallenge(verifier)), state, nil
+}
+
+// CompleteOIDCLogin handles the provider callback: it redeems the code,
+// finds or provisions the user and signs them in.
+func (s *AuthService) CompleteOIDCLogin(ctx context.Context, state, code string) (*AuthResponse, error) {
+	ctx, span := tracer.Start(ctx, "AuthService.CompleteOIDCLogin")
+	defer span.End()
+
+	if s.oidc == nil {
+		return nil, ErrSSONotConfigured
+	}
+
+	ls, err := s.identityRepo.ConsumeLoginState(ctx, hashToken(state))
+	if err != nil {
+		return nil, err
+	}
+	if ls == nil || time.Now().After(ls.ExpiresAt) {
+		return nil, ErrInvalidToken
+	}
+
+	claims, err := s.oidc.Exchange(ctx, code, ls.CodeVerifier, ls.Nonce)
+	if err != nil {
+		return nil, fmt.Errorf("oidc exchange: %w", err)
+	}
+
+	user, err := s.resolveOIDCUser(ctx, claims)
+	if err != nil {
+		return nil, err
+	}
+
+	// SSO replaces the password, not the second factor
+	if user.TwoFactorEnabled {
+		challenge, err := s.signToken(user, tokenTypeTwoFactorChallenge, domain.AuthMethodSSO, twoFactorChallengeTTL)
+		if err != nil {
+			return nil, fmt.Errorf("generating token: %w", err)
+		}
+		return &AuthResponse{TwoFactorRequired: true, ChallengeToken: challenge}, nil
+	}
+
+	token, err := s.generateToken(user, domain.AuthMethodSSO)
+	if err != nil {
+		return nil, fmt.Errorf("generating token: %w", err)
+	}
+
+	return &AuthResponse{User: user, AccessToken: token}, nil
+}
+
+// resolveOIDCUser returns the user linked to the identity. Unknown
+// identities are linked to the account with the same verified email, or
+// get a new account.
+func (s *AuthService) resolveOIDCUser(ctx context.Context, claims *oidc.Claims) (*domain.User, error) {
+	identity, err := s.identityRepo.GetBySubject(ctx, claims.Issuer, claims.Subject)
+	if err != nil {
+		return nil, err
+	}
+	if identity != nil {
+		if err := s.identityRepo.TouchLogin(ctx, identity.ID); err != nil {
+			slog.ErrorContext(ctx, "updating identity last login", "err", err)
+		}
+		user, err := s.userRepo.GetByID(ctx, identity.UserID)
+		if err != nil {
+			return nil, err
+		}
+		if user == nil {
+			return nil, ErrUserNotFound
+		}
+		return user, nil
+	}
+
+	if claims.Email == "" || !claims.EmailVerified {
+		return nil, ErrSSOEmailUnverified
+	}
+
+	user, err := s.userRepo.GetByEmail(ctx, claims.Email)
+	if err != nil {
+		return nil, err
+	}
+
+	if user == nil {
+		user, err = s.provisionOIDCUser(ctx, claims)
+		if err != nil {
+			return nil, err
+		}
+	} else if user.EmailVerifiedAt == nil {
+		// Anyone could have registered this address before its owner. Drop
+		// the password and existing sessions so only the owner keeps access.
+		if err := s.userRepo.UpdatePassword(ctx, user.ID, ""); err != nil {
+			return nil, err
+		}
+		if err := s.userRepo.MarkEmailVerified(ctx, user.ID); err != nil {
+			return nil, err
+		}
+		user.TokenVersion++
+	}
+
+	now := time.Now()
+	identity = &domain.UserIdentity{
+		ID:          uuid.New(),
+		UserID:      user.ID,
+		Issuer:      claims.Issuer,
+		Subject:     claims.Subject,
+		Email:       claims.Email,
+		CreatedAt:   now,
+		LastLoginAt: &now,
+	}
+	if err := s.identityRepo.Create(ctx, identity); err != nil {
+		return nil, fmt.Errorf("linking identity: %w", err)
+	}
+
+	return user, nil
+}
+
+// provisionOIDCUser creates an account without a password for a new SSO user.
+// They can set one later through the password reset flow.
+func (s *AuthService) provisionOIDCUser(ctx context.Context, claims *oidc.Claims) (*domain.User, error) {
+	username, err := s.availableUsername(ctx, claims)
+	if err != nil {
+		return nil, err
+	}
+
+	displayName := strings.TrimSpace(claims.Name)
+	if len(displayName) < 2 {
+		displayName = username
+	}
+	if len(displayName) > 100 {
+		displayName = displayName[:100]
+	}
+
+	now := time.Now()
+	user := &domain.User{
+		ID:              uuid.New(),
+		Email:           claims.Email,
+		Username:        username,
+		DisplayName:     displayName,
+		Status:          "offline",
+		CreatedAt:       now,
+		UpdatedAt:       now,
+		EmailVerifiedAt: &now,
+	}
+	if err := s.userRepo.Create(ctx, user); err != nil {
+		return nil, fmt.Errorf("creating user: %w", err)
+	}
+
+	return user, nil
+}
+
+var invalidUsernameChars = regexp.MustCompile(`[^a-zA-Z0-9_-]+`)
+
+// availableUsername derives a username from the claims, adding a numeric
+// suffix if it's taken.
+func (s *AuthService) availableUsername(ctx context.Context, claims *oidc.Claims) (string, error) {
+	base := claims.PreferredUsername
+	if base == "" {
+		base, _, _ = strings.Cut(claims.Email, "@")
+	}
+	base = strings.Trim(invalidUsernameChars.ReplaceAllString(base, "-"), "-")
+	if len(base) > 40 {
+		base = base[:40]
+	}
+	for len(base) < 3 {
+		base += "_"
+	}
+
+	candidate := base
+	for range 10 {
+		existing, err := s.userRepo.GetByUsername(ctx, candidate)
+		if err != nil {
+			return "", err
+		}
+		if existing == nil {
+			return candidate, nil
+		}
+		candidate = fmt.Sprintf("%s-%04d", base, rand.IntN(10000))
+	}
+
+	return "", ErrUsernameTaken
+}
@@ -0,0 +1,7 @@
+package service
+
+import "go.opentelemetry.io/otel"
+
+// tracer starts a span in each exported service method, between the HTTP
+// request span and the database query spans.
+var tracer = otel.Tracer("github.com/vedran77/pulse/internal/service")
@@ -0,0 +1,274 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base32"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/vedran77/pulse/internal/domain"
+	"github.com/vedran77/pulse/pkg/totp"
+)
+
+var (
+	ErrTwoFactorRequired       = errors.New("two-factor authentication is required")
+	ErrTwoFactorAlreadyEnabled = errors.New("two-factor authentication is already enabled")
+	ErrTwoFactorNotEnabled     = errors.New("two-factor authentication is not enabled")
+	ErrInvalidTwoFactorCode    = errors.New("invalid two-factor code")
+)
+
+const (
+	totpIssuer = "Pulse"
+	// Accept codes from one step before and after to tolerate clock drift
+	totpSkew          = 1
+	recoveryCodeCount = 10
+)
+
+type LoginTwoFactorInput struct {
+	ChallengeToken string `json:"challenge_token"`
+	Code           string `json:"code"`
+}
+
+// LoginTwoFactor completes a login that returned a challenge token by
+// checking a TOTP or recovery code, then issues the access token.
+func (s *AuthService) LoginTwoFactor(ctx context.Context, input LoginTwoFactorInput) (*AuthResponse, error) {
+	ctx, span := tracer.Start(ctx, "AuthService.LoginTwoFactor")
+	defer span.End()
+
+	claims, err := s.parseToken(input.ChallengeToken, tokenTypeTwoFactorChallenge)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := s.userRepo.GetByID(ctx, claims.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil || user.TokenVersion != claims.Version || !user.TwoFactorEnabled {
+		return nil, ErrInvalidToken
+	}
+	if err := checkLocked(user); err != nil {
+		return nil, err
+	}
+
+	if err := s.verifySecondFactor(ctx, user.ID, input.Code); err != nil {
+		// Wrong codes count towards the lockout, so they can't be brute-forced
+		if errors.Is(err, ErrInvalidTwoFactorCode) {
+			if lockErr := s.recordFailedLogin(ctx, user); lockErr != nil {
+				return nil, lockErr
+			}
+		}
+		return nil, err
+	}
+
+	if err := s.clearFailedLogins(ctx, user); err != nil {
+		return nil, err
+	}
+
+	// The challenge carries over how the first factor was given
+	token, err := s.generateToken(user, claims.AuthMethod)
+	if err != nil {
+		return nil, fmt.Errorf("generating token: %w", err)
+	}
+
+	return &AuthResponse{User: user, AccessToken: token}, nil
+}
+
+// EnrollTwoFactor generates a new TOTP secret for the user. 2FA isn't
+// enabled until the user confirms a code from their authenticator app.
+func (s *AuthService) EnrollTwoFactor(ctx context.Context, userID uuid.UUID) (*domain.TwoFactorEnrollment, error) {
+	ctx, span := tracer.Start(ctx, "AuthService.EnrollTwoFactor")
+	defer span.End()
+
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, ErrUserNotFound
+	}
+	if user.TwoFactorEnabled {
+		return nil, ErrTwoFactorAlreadyEnabled
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return nil, fmt.Errorf("generating secret: %w", err)
+	}
+
+	encrypted, err := encryptSecret(s.totpKey, []byte(secret))
+	if err != nil {
+		return nil, fmt.Errorf("encrypting secret: %w", err)
+	}
+
+	tf := &domain.TwoFactor{
+		UserID:    userID,
+		Secret:    encrypted,
+		CreatedAt: time.Now(),
+	}
+	if err := s.twoFactorRepo.Upsert(ctx, tf); err != nil {
+		return nil, fmt.Errorf("storing secret: %w", err)
+	}
+
+	return &domain.TwoFactorEnrollment{
+		Secret:     secret,
+		OTPAuthURI: totp.URI(totpIssuer, user.Email, secret),
+	}, nil
+}
+
+// ConfirmTwoFactor enables 2FA once the user enters a valid code and
+// returns the recovery codes. They are only shown this once.
+func (s *AuthService) ConfirmTwoFactor(ctx context.Context, userID uuid.UUID, code string) ([]string, error) {
+	ctx, span := tracer.Start(ctx, "AuthService.ConfirmTwoFactor")
+	defer span.End()
+
+	tf, err := s.twoFactorRepo.Get(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if tf == nil {
+		return nil, ErrTwoFactorNotEnabled
+	}
+	if tf.ConfirmedAt != nil {
+		return nil, ErrTwoFactorAlreadyEnabled
+	}
+
+	if err := s.verifyTOTP(ctx, tf, code); err != nil {
+		return nil, err
+	}
+
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		return nil, fmt.Errorf("generating recovery codes: %w", err)
+	}
+
+	if err := s.twoFactorRepo.Enable(ctx, userID, hashes); err != nil {
+		return nil, fmt.Errorf("enabling two-factor: %w", err)
+	}
+
+	return codes, nil
+}
+
+// DisableTwoFactor turns 2FA off. It needs both the password and a current code.
+func (s *AuthService) DisableTwoFactor(ctx context.Context, userID uuid.UUID, password, code string) error {
+	ctx, span := tracer.Start(ctx, "AuthService.DisableTwoFactor")
+	defer span.End()
+
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if user == nil {
+		return ErrUserNotFound
+	}
+	if !user.TwoFactorEnabled {
+		return ErrTwoFactorNotEnabled
+	}
+	if !verifyPassword(password, user.PasswordHash) {
+		return ErrInvalidCreds
+	}
+
+	if err := s.verifySecondFactor(ctx, userID, code); err != nil {
+		return err
+	}
+
+	return s.twoFactorRepo.Disable(ctx, userID)
+}
+
+// RegenerateRecoveryCodes replaces all recovery codes with a fresh set.
+func (s *AuthService) RegenerateRecoveryCodes(ctx context.Context, userID uuid.UUID, code string) ([]string, error) {
+	ctx, span := tracer.Start(ctx, "AuthService.RegenerateRecoveryCodes")
+	defer span.End()
+
+	if err := s.verifySecondFactor(ctx, userID, code); err != nil {
+		return nil, err
+	}
+
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		return nil, fmt.Errorf("generating recovery codes: %w", err)
+	}
+
+	if err := s.twoFactorRepo.ReplaceRecoveryCodes(ctx, userID, hashes); err != nil {
+		return nil, err
+	}
+
+	return codes, nil
+}
+
+// verifySecondFactor accepts either a TOTP code or an unused recovery code.
+func (s *AuthService) verifySecondFactor(ctx context.Context, userID uuid.UUID, code string) error {
+	tf, err := s.twoFactorRepo.Get(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if tf == nil || tf.ConfirmedAt == nil {
+		return ErrTwoFactorNotEnabled
+	}
+
+	code = strings.TrimSpace(code)
+	if len(code) == totp.Digits {
+		return s.verifyTOTP(ctx, tf, code)
+	}
+
+	ok, err := s.twoFactorRepo.UseRecoveryCode(ctx, userID, hashToken(normalizeRecoveryCode(code)))
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrInvalidTwoFactorCode
+	}
+	return nil
+}
+
+func (s *AuthService) verifyTOTP(ctx context.Context, tf *domain.TwoFactor, code string) error {
+	secret, err := decryptSecret(s.totpKey, tf.Secret)
+	if err != nil {
+		return fmt.Errorf("decrypting secret: %w", err)
+	}
+
+	step, ok := totp.Validate(string(secret), code, time.Now(), totpSkew)
+	if !ok {
+		return ErrInvalidTwoFactorCode
+	}
+
+	// A code can only be used once, even within its validity window
+	fresh, err := s.twoFactorRepo.UseStep(ctx, tf.UserID, step)
+	if err != nil {
+		return err
+	}
+	if !fresh {
+		return ErrInvalidTwoFactorCode
+	}
+	return nil
+}
+
+var recoveryEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// generateRecoveryCodes returns codes formatted as "xxxxx-xxxxx" and their hashes.
+func generateRecoveryCodes() ([]string, []string, error) {
+	codes := make([]string, recoveryCodeCount)
+	hashes := make([]string, recoveryCodeCount)
+
+	for i := range codes {
+		b := make([]byte, 7)
+		if _, err := rand.Read(b); err != nil {
+			return nil, nil, err
+		}
+		raw := strings.ToLower(recoveryEncoding.EncodeToString(b))[:10]
+		codes[i] = raw[:5] + "-" + raw[5:]
+		hashes[i] = hashToken(raw)
+	}
+
+	return codes, hashes, nil
+}
+
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(code)
+	code = strings.ReplaceAll(code, "-", "")
+	return strings.ReplaceAll(code, " ", "")
+}
@@ -0,0 +1,52 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/vedran77/pulse/internal/repository/memory"
+	"github.com/vedran77/pulse/pkg/totp"
+)
+
+func TestTwoFactor(t *testing.T) {
+	ctx := context.Background()
+	store := memory.NewStore()
+	newAuth := func(totpKey string) *AuthService {
+		return NewAuthService(memory.NewUserRepo(store), memory.NewVerificationTokenRepo(store), memory.NewTwoFactorRepo(store), memory.NewIdentityRepo(store), "test-secret", totpKey)
+	}
+	auth := newAuth("test-totp-key")
+
+	resp, err := auth.Register(ctx, RegisterInput{Email: "alice@example.com", Username: "alice", DisplayName: "Alice", Password: "Password123"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	userID := resp.User.ID
+	enrollment, err := auth.EnrollTwoFactor(ctx, userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, err := totp.Code(enrollment.Secret, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := auth.ConfirmTwoFactor(ctx, userID, code); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("replay", func(t *testing.T) {
+		if _, err := auth.RegenerateRecoveryCodes(ctx, userID, code); !errors.Is(err, ErrInvalidTwoFactorCode) {
+			t.Fatalf("reused code: err = %v, want %v", err, ErrInvalidTwoFactorCode)
+		}
+	})
+
+	t.Run("encryption key", func(t *testing.T) {
+		// The secret is sealed with the TOTP key, not the JWT secret
+		other := newAuth("another-totp-key")
+		next, _ := totp.Code(enrollment.Secret, time.Now().Add(totp.Period*time.Second))
+		if _, err := other.RegenerateRecoveryCodes(ctx, userID, next); err == nil || errors.Is(err, ErrInvalidTwoFactorCode) {
+			t.Fatalf("secret opened with the wrong key: err = %v", err)
+		}
+	})
+}
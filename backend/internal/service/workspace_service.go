@@ -2,11 +2,11 @@ package service
 
 import (
 	"context"
-	"crypto/rand"
-	"encoding/hex"
 	"errors"
 	"fmt"
+	"log/slog"
 	"regexp"
+	"slices"
 	"strings"
 	"time"
 
@@ -16,30 +16,57 @@ import (
 )
 
 var (
-	ErrWorkspaceNotFound = errors.New("workspace not found")
-	ErrSlugTaken         = errors.New("workspace slug already taken")
-	ErrNotWorkspaceOwner = errors.New("only workspace owner can perform this action")
-	ErrNotMember         = errors.New("user is not a member of this workspace")
-	ErrAlreadyMember     = errors.New("user is already a member")
-	ErrInviteNotFound    = errors.New("invite not found")
-	ErrInviteExpired     = errors.New("invite has expired")
-	ErrInviteUsed        = errors.New("invite has already been used")
+	ErrWorkspaceNotFound    = errors.New("workspace not found")
+	ErrSlugTaken            = errors.New("workspace slug already taken")
+	ErrNotWorkspaceOwner    = errors.New("only workspace owner can perform this action")
+	ErrNotMember            = errors.New("user is not a member of this workspace")
+	ErrAlreadyMember        = errors.New("user is already a member")
+	ErrInviteNotFound       = errors.New("invite not found")
+	ErrInviteExpired        = errors.New("invite has expired")
+	ErrInviteUsed           = errors.New("invite has already been used")
+	ErrInviteEmailMismatch  = errors.New("invite was sent to a different email address")
+	ErrInviteNotEmail       = errors.New("only email invites can be resent")
+	ErrDomainNotAllowed     = errors.New("email domain is not allowed to join this workspace")
+	ErrJoinRequestNotFound  = errors.New("join request not found")
+	ErrCannotRemoveOwner    = errors.New("the workspace owner can't be removed, transfer ownership first")
+	ErrNewOwnerNotAdmin     = errors.New("ownership can only be transferred to a workspace admin")
+	ErrTransferNotConfirmed = errors.New("confirm the transfer with the workspace slug")
 )
 
+const defaultInviteTTL = 7 * 24 * time.Hour
+
+// workspaceRestoreWindow is how long a deleted workspace can be restored
+// before it's purged for good.
+const workspaceRestoreWindow = 30 * 24 * time.Hour
+
+// How many deleted workspaces a purge pass loads at a time
+const purgeBatchSize = 50
+
 type WorkspaceService struct {
 	workspaceRepo repository.WorkspaceRepository
 	userRepo      repository.UserRepository
 	inviteRepo    repository.InviteRepository
+	tx            repository.TxManager
+	mailer        Mailer
+	appURL        string
 }
 
-func NewWorkspaceService(workspaceRepo repository.WorkspaceRepository, userRepo repository.UserRepository, inviteRepo repository.InviteRepository) *WorkspaceService {
+func NewWorkspaceService(workspaceRepo repository.WorkspaceRepository, userRepo repository.UserRepository, inviteRepo repository.InviteRepository, tx repository.TxManager) *WorkspaceService {
 	return &WorkspaceService{
 		workspaceRepo: workspaceRepo,
 		userRepo:      userRepo,
 		inviteRepo:    inviteRepo,
+		tx:            tx,
 	}
 }
 
+// SetMailer sets the mailer used for invite emails (optional dependency).
+// appURL is the frontend base URL that invite links point to.
+func (s *WorkspaceService) SetMailer(m Mailer, appURL string) {
+	s.mailer = m
+	s.appURL = strings.TrimRight(appURL, "/")
+}
+
 type CreateWorkspaceInput struct {
 	Name        string `json:"name"`
 	Slug        string `json:"slug"`
@@ -47,12 +74,43 @@ type CreateWorkspaceInput struct {
 }
 
 type UpdateWorkspaceInput struct {
-	Name        *string `json:"name"`
-	Slug        *string `json:"slug"`
-	Description *string `json:"description"`
+	Name             *string `json:"name"`
+	Slug             *string `json:"slug"`
+	Description      *string `json:"description"`
+	RequireTwoFactor *bool   `json:"require_two_factor"`
+	RequireSSO       *bool   `json:"require_sso"`
+	// Archive channels inactive for this many days; 0 turns it off
+	AutoArchiveDays *int `json:"auto_archive_days"`
+}
+
+// UpdateJoinPolicyInput changes how users can join without an invite.
+// Only the owner can change the allowed domains; admins can toggle approval.
+type UpdateJoinPolicyInput struct {
+	AllowedDomains   *[]string `json:"allowed_domains"`
+	RequiresApproval *bool     `json:"requires_approval"`
+}
+
+// TransferOwnershipInput names the new owner. Confirm must repeat the
+// workspace slug.
+type TransferOwnershipInput struct {
+	UserID  uuid.UUID `json:"user_id"`
+	Confirm string    `json:"confirm"`
+}
+
+// CreateInviteInput describes a new invite. An invite with an email is a
+// single-use invite sent to that address; without an email it is a shareable
+// link that anyone can use until MaxUses (nil = unlimited) or expiry.
+type CreateInviteInput struct {
+	Email          string `json:"email"`
+	Role           string `json:"role"`
+	MaxUses        *int   `json:"max_uses"`
+	ExpiresInHours int    `json:"expires_in_hours"`
 }
 
 func (s *WorkspaceService) Create(ctx context.Context, userID uuid.UUID, input CreateWorkspaceInput) (*domain.Workspace, error) {
+	ctx, span := tracer.Start(ctx, "WorkspaceService.Create")
+	defer span.End()
+
 	slug := slugify(input.Slug)
 	if slug == "" {
 		slug = slugify(input.Name)
@@ -80,10 +138,6 @@ func (s *WorkspaceService) Create(ctx context.Context, userID uuid.UUID, input C
 		CreatedAt:   time.Now(),
 	}
 
-	if err := s.workspaceRepo.Create(ctx, ws); err != nil {
-		return nil, fmt.Errorf("creating workspace: %w", err)
-	}
-
 	// Dodaj owner-a kao member sa ulogom "owner"
 	member := &domain.WorkspaceMember{
 		WorkspaceID: ws.ID,
@@ -91,15 +145,28 @@ func (s *WorkspaceService) Create(ctx context.Context, userID uuid.UUID, input C
 		Role:        "owner",
 		JoinedAt:    time.Now(),
 	}
-	if err := s.workspaceRepo.AddMember(ctx, member); err != nil {
-		return nil, fmt.Errorf("adding owner as member: %w", err)
+
+	err = s.tx.WithinTx(ctx, func(ctx context.Context) error {
+		if err := s.workspaceRepo.Create(ctx, ws); err != nil {
+			return fmt.Errorf("creating workspace: %w", err)
+		}
+		if err := s.workspaceRepo.AddMember(ctx, member); err != nil {
+			return fmt.Errorf("adding owner as member: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
 
 	return ws, nil
 }
 
 func (s *WorkspaceService) GetByID(ctx context.Context, userID, workspaceID uuid.UUID) (*domain.Workspace, error) {
-	member, err := s.workspaceRepo.GetMember(ctx, workspaceID, userID)
+	ctx, span := tracer.Start(ctx, "WorkspaceService.GetByID")
+	defer span.End()
+
+	member, err := workspaceMember(ctx, s.workspaceRepo, workspaceID, userID)
 	if err != nil {
 		return nil, err
 	}
@@ -119,10 +186,16 @@ func (s *WorkspaceService) GetByID(ctx context.Context, userID, workspaceID uuid
 }
 
 func (s *WorkspaceService) ListByUser(ctx context.Context, userID uuid.UUID) ([]domain.Workspace, error) {
+	ctx, span := tracer.Start(ctx, "WorkspaceService.ListByUser")
+	defer span.End()
+
 	return s.workspaceRepo.ListByUser(ctx, userID)
 }
 
 func (s *WorkspaceService) Update(ctx context.Context, userID, workspaceID uuid.UUID, input UpdateWorkspaceInput) (*domain.Workspace, error) {
+	ctx, span := tracer.Start(ctx, "WorkspaceService.Update")
+	defer span.End()
+
 	ws, err := s.workspaceRepo.GetByID(ctx, workspaceID)
 	if err != nil {
 		return nil, err
@@ -133,6 +206,9 @@ func (s *WorkspaceService) Update(ctx context.Context, userID, workspaceID uuid.
 	if ws.OwnerID != userID {
 		return nil, ErrNotWorkspaceOwner
 	}
+	if err := checkSessionPolicy(ctx, ws); err != nil {
+		return nil, err
+	}
 
 	if input.Name != nil {
 		ws.Name = *input.Name
@@ -151,6 +227,30 @@ func (s *WorkspaceService) Update(ctx context.Context, userID, workspaceID uuid.
 	if input.Description != nil {
 		ws.Description = input.Description
 	}
+	if input.RequireTwoFactor != nil {
+		// The owner must have 2FA on before requiring it, or they'd lock themselves out
+		if *input.RequireTwoFactor {
+			if err := s.checkTwoFactor(ctx, userID); err != nil {
+				return nil, err
+			}
+		}
+		ws.RequireTwoFactor = *input.RequireTwoFactor
+	}
+	if input.RequireSSO != nil {
+		// Likewise the owner must be signed in with SSO
+		if *input.RequireSSO {
+			if session, ok := domain.SessionFrom(ctx); !ok || session.AuthMethod != domain.AuthMethodSSO {
+				return nil, ErrSSORequired
+			}
+		}
+		ws.RequireSSO = *input.RequireSSO
+	}
+	if input.AutoArchiveDays != nil {
+		ws.AutoArchiveDays = nil
+		if days := *input.AutoArchiveDays; days > 0 {
+			ws.AutoArchiveDays = &days
+		}
+	}
 
 	if err := s.workspaceRepo.Update(ctx, ws); err != nil {
 		return nil, fmt.Errorf("updating workspace: %w", err)
@@ -159,7 +259,12 @@ func (s *WorkspaceService) Update(ctx context.Context, userID, workspaceID uuid.
 	return ws, nil
 }
 
+// Delete soft-deletes the workspace. The owner can restore it within
+// workspaceRestoreWindow, after which RunPurge deletes it for good.
 func (s *WorkspaceService) Delete(ctx context.Context, userID, workspaceID uuid.UUID) error {
+	ctx, span := tracer.Start(ctx, "WorkspaceService.Delete")
+	defer span.End()
+
 	ws, err := s.workspaceRepo.GetByID(ctx, workspaceID)
 	if err != nil {
 		return err
@@ -170,13 +275,152 @@ func (s *WorkspaceService) Delete(ctx context.Context, userID, workspaceID uuid.
 	if ws.OwnerID != userID {
 		return ErrNotWorkspaceOwner
 	}
+	if err := checkSessionPolicy(ctx, ws); err != nil {
+		return err
+	}
+
+	if err := s.workspaceRepo.SoftDelete(ctx, workspaceID, time.Now()); err != nil {
+		return fmt.Errorf("deleting workspace: %w", err)
+	}
+	return nil
+}
+
+// ListDeleted returns the user's deleted workspaces that can still be restored.
+func (s *WorkspaceService) ListDeleted(ctx context.Context, userID uuid.UUID) ([]domain.Workspace, error) {
+	ctx, span := tracer.Start(ctx, "WorkspaceService.ListDeleted")
+	defer span.End()
 
-	return s.workspaceRepo.Delete(ctx, workspaceID)
+	workspaces, err := s.workspaceRepo.ListDeletedByOwner(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if workspaces == nil {
+		workspaces = []domain.Workspace{}
+	}
+	return workspaces, nil
+}
+
+// Restore brings back a workspace deleted within the restore window.
+func (s *WorkspaceService) Restore(ctx context.Context, userID, workspaceID uuid.UUID) (*domain.Workspace, error) {
+	ctx, span := tracer.Start(ctx, "WorkspaceService.Restore")
+	defer span.End()
+
+	ws, err := s.workspaceRepo.GetDeletedByID(ctx, workspaceID)
+	if err != nil {
+		return nil, err
+	}
+	// Past the window it's only waiting for the purge worker
+	if ws == nil || time.Since(*ws.DeletedAt) > workspaceRestoreWindow {
+		return nil, ErrWorkspaceNotFound
+	}
+	if ws.OwnerID != userID {
+		return nil, ErrNotWorkspaceOwner
+	}
+	if err := checkSessionPolicy(ctx, ws); err != nil {
+		return nil, err
+	}
+
+	if err := s.workspaceRepo.Restore(ctx, workspaceID); err != nil {
+		return nil, fmt.Errorf("restoring workspace: %w", err)
+	}
+	ws.DeletedAt = nil
+	return ws, nil
+}
+
+// TransferOwnership makes a workspace admin the owner. The previous owner
+// stays on as an admin.
+func (s *WorkspaceService) TransferOwnership(ctx context.Context, userID, workspaceID uuid.UUID, input TransferOwnershipInput) (*domain.Workspace, error) {
+	ctx, span := tracer.Start(ctx, "WorkspaceService.TransferOwnership")
+	defer span.End()
+
+	ws, err := s.workspaceRepo.GetByID(ctx, workspaceID)
+	if err != nil {
+		return nil, err
+	}
+	if ws == nil {
+		return nil, ErrWorkspaceNotFound
+	}
+	if ws.OwnerID != userID {
+		return nil, ErrNotWorkspaceOwner
+	}
+	if err := checkSessionPolicy(ctx, ws); err != nil {
+		return nil, err
+	}
+	if input.Confirm != ws.Slug {
+		return nil, ErrTransferNotConfirmed
+	}
+
+	err = s.tx.WithinTx(ctx, func(ctx context.Context) error {
+		target, err := s.workspaceRepo.GetMember(ctx, workspaceID, input.UserID)
+		if err != nil {
+			return err
+		}
+		if target == nil || target.Role != "admin" {
+			return ErrNewOwnerNotAdmin
+		}
+		if err := s.workspaceRepo.SetOwner(ctx, workspaceID, input.UserID); err != nil {
+			return fmt.Errorf("setting owner: %w", err)
+		}
+		if err := s.workspaceRepo.UpdateMemberRole(ctx, workspaceID, input.UserID, "owner"); err != nil {
+			return fmt.Errorf("promoting new owner: %w", err)
+		}
+		if err := s.workspaceRepo.UpdateMemberRole(ctx, workspaceID, userID, "admin"); err != nil {
+			return fmt.Errorf("demoting previous owner: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	ws.OwnerID = input.UserID
+	return ws, nil
+}
+
+// RunPurge hard-deletes workspaces whose restore window has passed, every
+// interval until ctx is cancelled.
+func (s *WorkspaceService) RunPurge(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := s.purgeDeleted(ctx, time.Now()); err != nil && ctx.Err() == nil {
+			slog.ErrorContext(ctx, "purging deleted workspaces", "err", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// purgeDeleted deletes every workspace deleted more than the restore window
+// before now, with everything in it.
+func (s *WorkspaceService) purgeDeleted(ctx context.Context, now time.Time) error {
+	for {
+		workspaces, err := s.workspaceRepo.ListDeletedBefore(ctx, now.Add(-workspaceRestoreWindow), purgeBatchSize)
+		if err != nil {
+			return err
+		}
+		for _, ws := range workspaces {
+			if err := s.workspaceRepo.Delete(ctx, ws.ID); err != nil {
+				return fmt.Errorf("purging workspace %s: %w", ws.ID, err)
+			}
+			slog.InfoContext(ctx, "purged workspace", "workspace_id", ws.ID, "deleted_at", ws.DeletedAt)
+		}
+		if len(workspaces) < purgeBatchSize {
+			return nil
+		}
+	}
 }
 
 func (s *WorkspaceService) AddMember(ctx context.Context, requesterID, workspaceID, userID uuid.UUID) error {
+	ctx, span := tracer.Start(ctx, "WorkspaceService.AddMember")
+	defer span.End()
+
 	// Provjeri da requester ima pristup
-	requester, err := s.workspaceRepo.GetMember(ctx, workspaceID, requesterID)
+	requester, err := workspaceMember(ctx, s.workspaceRepo, workspaceID, requesterID)
 	if err != nil {
 		return err
 	}
@@ -189,7 +433,7 @@ func (s *WorkspaceService) AddMember(ctx context.Context, requesterID, workspace
 	if err != nil {
 		return err
 	}
-	if user == nil {
+	if user == nil || user.DeletedAt != nil {
 		return errors.New("user not found")
 	}
 
@@ -212,7 +456,10 @@ func (s *WorkspaceService) AddMember(ctx context.Context, requesterID, workspace
 }
 
 func (s *WorkspaceService) RemoveMember(ctx context.Context, requesterID, workspaceID, userID uuid.UUID) error {
-	requester, err := s.workspaceRepo.GetMember(ctx, workspaceID, requesterID)
+	ctx, span := tracer.Start(ctx, "WorkspaceService.RemoveMember")
+	defer span.End()
+
+	requester, err := workspaceMember(ctx, s.workspaceRepo, workspaceID, requesterID)
 	if err != nil {
 		return err
 	}
@@ -220,11 +467,28 @@ func (s *WorkspaceService) RemoveMember(ctx context.Context, requesterID, worksp
 		return ErrNotWorkspaceOwner
 	}
 
+	target, err := s.workspaceRepo.GetMember(ctx, workspaceID, userID)
+	if err != nil {
+		return err
+	}
+	if target != nil && target.Role == "owner" {
+		return ErrCannotRemoveOwner
+	}
+
 	return s.workspaceRepo.RemoveMember(ctx, workspaceID, userID)
 }
 
-func (s *WorkspaceService) ListMembers(ctx context.Context, userID, workspaceID uuid.UUID) ([]domain.WorkspaceMember, error) {
-	member, err := s.workspaceRepo.GetMember(ctx, workspaceID, userID)
+type MemberListResponse struct {
+	Members []domain.WorkspaceMember `json:"members"`
+	PageCursors
+}
+
+// ListMembers returns a page of the workspace's members in the order they joined.
+func (s *WorkspaceService) ListMembers(ctx context.Context, userID, workspaceID uuid.UUID, input PageInput) (*MemberListResponse, error) {
+	ctx, span := tracer.Start(ctx, "WorkspaceService.ListMembers")
+	defer span.End()
+
+	member, err := workspaceMember(ctx, s.workspaceRepo, workspaceID, userID)
 	if err != nil {
 		return nil, err
 	}
@@ -232,15 +496,82 @@ func (s *WorkspaceService) ListMembers(ctx context.Context, userID, workspaceID
 		return nil, ErrNotMember
 	}
 
-	return s.workspaceRepo.ListMembers(ctx, workspaceID)
+	members, cursors, err := listPage(input, false, func(m domain.WorkspaceMember) repository.PageKey {
+		return repository.PageKey{Time: m.JoinedAt, ID: m.UserID}
+	}, func(page repository.Page) ([]domain.WorkspaceMember, error) {
+		return s.workspaceRepo.ListMembers(ctx, workspaceID, page)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &MemberListResponse{Members: members, PageCursors: cursors}, nil
+}
+
+// workspaceMember returns the user's membership of the workspace, or nil if
+// they aren't a member. Members are refused if the request's session doesn't
+// meet the workspace's sign-in policy.
+func workspaceMember(ctx context.Context, workspaceRepo repository.WorkspaceRepository, workspaceID, userID uuid.UUID) (*domain.WorkspaceMember, error) {
+	member, err := workspaceRepo.GetMember(ctx, workspaceID, userID)
+	if err != nil || member == nil {
+		return nil, err
+	}
+	if err := checkWorkspacePolicy(ctx, workspaceRepo, workspaceID); err != nil {
+		return nil, err
+	}
+	return member, nil
+}
+
+// checkWorkspacePolicy returns ErrTwoFactorRequired if the workspace requires
+// 2FA and the request's user hasn't enabled it, and ErrSSORequired if it
+// requires SSO and the session was signed in another way. Background jobs,
+// such as scheduled delivery, have no session and aren't checked.
+func checkWorkspacePolicy(ctx context.Context, workspaceRepo repository.WorkspaceRepository, workspaceID uuid.UUID) error {
+	ws, err := workspaceRepo.GetByID(ctx, workspaceID)
+	if err != nil {
+		return err
+	}
+	if ws == nil {
+		return ErrWorkspaceNotFound
+	}
+	return checkSessionPolicy(ctx, ws)
+}
+
+// checkSessionPolicy is checkWorkspacePolicy for a workspace already loaded.
+func checkSessionPolicy(ctx context.Context, ws *domain.Workspace) error {
+	session, ok := domain.SessionFrom(ctx)
+	if !ok {
+		return nil
+	}
+	if ws.RequireTwoFactor && !session.TwoFactorEnabled {
+		return ErrTwoFactorRequired
+	}
+	if ws.RequireSSO && session.AuthMethod != domain.AuthMethodSSO {
+		return ErrSSORequired
+	}
+	return nil
+}
+
+// checkTwoFactor returns ErrTwoFactorRequired if the user hasn't enabled 2FA.
+func (s *WorkspaceService) checkTwoFactor(ctx context.Context, userID uuid.UUID) error {
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if user == nil || !user.TwoFactorEnabled {
+		return ErrTwoFactorRequired
+	}
+	return nil
 }
 
 var nonAlphanumeric = regexp.MustCompile(`[^a-z0-9-]`)
 var multiDash = regexp.MustCompile(`-{2,}`)
 
-func (s *WorkspaceService) CreateInvite(ctx context.Context, requesterID, workspaceID uuid.UUID, email string) (*domain.WorkspaceInvite, error) {
+func (s *WorkspaceService) CreateInvite(ctx context.Context, requesterID, workspaceID uuid.UUID, input CreateInviteInput) (*domain.WorkspaceInvite, error) {
+	ctx, span := tracer.Start(ctx, "WorkspaceService.CreateInvite")
+	defer span.End()
+
 	// Permission check: owner or admin
-	requester, err := s.workspaceRepo.GetMember(ctx, workspaceID, requesterID)
+	requester, err := workspaceMember(ctx, s.workspaceRepo, workspaceID, requesterID)
 	if err != nil {
 		return nil, err
 	}
@@ -248,31 +579,141 @@ func (s *WorkspaceService) CreateInvite(ctx context.Context, requesterID, worksp
 		return nil, ErrNotWorkspaceOwner
 	}
 
-	// Generate crypto random token
-	tokenBytes := make([]byte, 32)
-	if _, err := rand.Read(tokenBytes); err != nil {
+	role := input.Role
+	if role == "" {
+		role = "member"
+	}
+	// Only the owner can hand out admin access
+	if role == "admin" && requester.Role != "owner" {
+		return nil, ErrNotWorkspaceOwner
+	}
+
+	token, err := randomToken()
+	if err != nil {
 		return nil, fmt.Errorf("generating token: %w", err)
 	}
-	token := hex.EncodeToString(tokenBytes)
 
+	ttl := defaultInviteTTL
+	if input.ExpiresInHours > 0 {
+		ttl = time.Duration(input.ExpiresInHours) * time.Hour
+	}
+
+	now := time.Now()
 	invite := &domain.WorkspaceInvite{
 		ID:          uuid.New(),
 		WorkspaceID: workspaceID,
-		Email:       email,
 		Token:       token,
+		Role:        role,
 		InvitedBy:   requesterID,
-		CreatedAt:   time.Now(),
-		ExpiresAt:   time.Now().Add(7 * 24 * time.Hour), // 7 days
+		CreatedAt:   now,
+		ExpiresAt:   now.Add(ttl),
+	}
+
+	email := strings.ToLower(strings.TrimSpace(input.Email))
+	if email != "" {
+		one := 1
+		invite.Type = domain.InviteTypeEmail
+		invite.Email = email
+		invite.MaxUses = &one
+	} else {
+		invite.Type = domain.InviteTypeLink
+		invite.MaxUses = input.MaxUses
 	}
 
 	if err := s.inviteRepo.Create(ctx, invite); err != nil {
 		return nil, fmt.Errorf("creating invite: %w", err)
 	}
 
+	if invite.Type == domain.InviteTypeEmail {
+		// The invite is usable through its link even if delivery fails
+		if err := s.sendInviteEmail(ctx, invite); err != nil {
+			slog.ErrorContext(ctx, "sending invite email", "invite_id", invite.ID, "err", err)
+		}
+	}
+
 	return invite, nil
 }
 
+// ResendInvite re-sends an email invite, extending it if it has expired.
+func (s *WorkspaceService) ResendInvite(ctx context.Context, requesterID, workspaceID, inviteID uuid.UUID) (*domain.WorkspaceInvite, error) {
+	ctx, span := tracer.Start(ctx, "WorkspaceService.ResendInvite")
+	defer span.End()
+
+	requester, err := workspaceMember(ctx, s.workspaceRepo, workspaceID, requesterID)
+	if err != nil {
+		return nil, err
+	}
+	if requester == nil || (requester.Role != "owner" && requester.Role != "admin") {
+		return nil, ErrNotWorkspaceOwner
+	}
+
+	invite, err := s.inviteRepo.GetByID(ctx, inviteID)
+	if err != nil {
+		return nil, err
+	}
+	if invite == nil || invite.WorkspaceID != workspaceID {
+		return nil, ErrInviteNotFound
+	}
+	if invite.Type != domain.InviteTypeEmail {
+		return nil, ErrInviteNotEmail
+	}
+	if invite.AcceptedAt != nil {
+		return nil, ErrInviteUsed
+	}
+
+	if time.Now().After(invite.ExpiresAt) {
+		invite.ExpiresAt = time.Now().Add(defaultInviteTTL)
+		if err := s.inviteRepo.UpdateExpiry(ctx, invite.ID, invite.ExpiresAt); err != nil {
+			return nil, fmt.Errorf("extending invite: %w", err)
+		}
+	}
+
+	if err := s.sendInviteEmail(ctx, invite); err != nil {
+		return nil, fmt.Errorf("sending invite email: %w", err)
+	}
+
+	return invite, nil
+}
+
+func (s *WorkspaceService) sendInviteEmail(ctx context.Context, invite *domain.WorkspaceInvite) error {
+	if s.mailer == nil {
+		return nil
+	}
+
+	ws, err := s.workspaceRepo.GetByID(ctx, invite.WorkspaceID)
+	if err != nil {
+		return err
+	}
+	if ws == nil {
+		return ErrWorkspaceNotFound
+	}
+
+	inviter, err := s.userRepo.GetByID(ctx, invite.InvitedBy)
+	if err != nil {
+		return err
+	}
+	inviterName := "A teammate"
+	if inviter != nil {
+		inviterName = inviter.DisplayName
+	}
+
+	subject, body, err := inviteMail.render(map[string]any{
+		"InviterName":   inviterName,
+		"WorkspaceName": ws.Name,
+		"Link":          s.appURL + "/invite/" + invite.Token,
+		"ExpiresAt":     invite.ExpiresAt,
+	})
+	if err != nil {
+		return fmt.Errorf("rendering invite email: %w", err)
+	}
+
+	return s.mailer.Send(ctx, invite.Email, subject, body)
+}
+
 func (s *WorkspaceService) GetInviteInfo(ctx context.Context, token string) (*domain.WorkspaceInvite, error) {
+	ctx, span := tracer.Start(ctx, "WorkspaceService.GetInviteInfo")
+	defer span.End()
+
 	invite, err := s.inviteRepo.GetByToken(ctx, token)
 	if err != nil {
 		return nil, err
@@ -284,6 +725,9 @@ func (s *WorkspaceService) GetInviteInfo(ctx context.Context, token string) (*do
 }
 
 func (s *WorkspaceService) AcceptInvite(ctx context.Context, userID uuid.UUID, token string) (*domain.WorkspaceInvite, error) {
+	ctx, span := tracer.Start(ctx, "WorkspaceService.AcceptInvite")
+	defer span.End()
+
 	invite, err := s.inviteRepo.GetByToken(ctx, token)
 	if err != nil {
 		return nil, err
@@ -299,6 +743,22 @@ func (s *WorkspaceService) AcceptInvite(ctx context.Context, userID uuid.UUID, t
 		return nil, ErrInviteExpired
 	}
 
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, ErrUserNotFound
+	}
+	if user.EmailVerifiedAt == nil {
+		return nil, ErrEmailNotVerified
+	}
+
+	// Email invites can only be accepted by the invited address
+	if invite.Type == domain.InviteTypeEmail && !strings.EqualFold(user.Email, invite.Email) {
+		return nil, ErrInviteEmailMismatch
+	}
+
 	// If already a member, just return success (redirect to workspace)
 	existing, err := s.workspaceRepo.GetMember(ctx, invite.WorkspaceID, userID)
 	if err != nil {
@@ -308,32 +768,54 @@ func (s *WorkspaceService) AcceptInvite(ctx context.Context, userID uuid.UUID, t
 		return invite, nil
 	}
 
-	// Add user as member
 	member := &domain.WorkspaceMember{
 		WorkspaceID: invite.WorkspaceID,
 		UserID:      userID,
-		Role:        "member",
+		Role:        invite.Role,
 		JoinedAt:    time.Now(),
 	}
-	if err := s.workspaceRepo.AddMember(ctx, member); err != nil {
-		return nil, fmt.Errorf("adding member: %w", err)
-	}
 
-	// Mark invite as accepted
-	if err := s.inviteRepo.MarkAccepted(ctx, invite.ID, userID); err != nil {
-		return nil, fmt.Errorf("marking invite accepted: %w", err)
+	// The use is only consumed if the user is actually added
+	err = s.tx.WithinTx(ctx, func(ctx context.Context) error {
+		// Consume a use first so concurrent accepts can't exceed max_uses
+		ok, err := s.inviteRepo.RecordUse(ctx, invite.ID, userID)
+		if err != nil {
+			return fmt.Errorf("recording invite use: %w", err)
+		}
+		if !ok {
+			return ErrInviteUsed
+		}
+		if err := s.workspaceRepo.AddMember(ctx, member); err != nil {
+			return fmt.Errorf("adding member: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
 
-	now := time.Now()
-	invite.AcceptedAt = &now
-	invite.AcceptedBy = &userID
+	invite.UseCount++
+	if invite.MaxUses != nil && invite.UseCount >= *invite.MaxUses {
+		now := time.Now()
+		invite.AcceptedAt = &now
+		invite.AcceptedBy = &userID
+	}
 
 	return invite, nil
 }
 
-func (s *WorkspaceService) ListInvites(ctx context.Context, requesterID, workspaceID uuid.UUID) ([]domain.WorkspaceInvite, error) {
+type InviteListResponse struct {
+	Invites []domain.WorkspaceInvite `json:"invites"`
+	PageCursors
+}
+
+// ListInvites returns a page of the workspace's open invites, newest first.
+func (s *WorkspaceService) ListInvites(ctx context.Context, requesterID, workspaceID uuid.UUID, input PageInput) (*InviteListResponse, error) {
+	ctx, span := tracer.Start(ctx, "WorkspaceService.ListInvites")
+	defer span.End()
+
 	// Permission check
-	member, err := s.workspaceRepo.GetMember(ctx, workspaceID, requesterID)
+	member, err := workspaceMember(ctx, s.workspaceRepo, workspaceID, requesterID)
 	if err != nil {
 		return nil, err
 	}
@@ -341,12 +823,23 @@ func (s *WorkspaceService) ListInvites(ctx context.Context, requesterID, workspa
 		return nil, ErrNotMember
 	}
 
-	return s.inviteRepo.ListByWorkspace(ctx, workspaceID)
+	invites, cursors, err := listPage(input, false, func(inv domain.WorkspaceInvite) repository.PageKey {
+		return repository.PageKey{Time: inv.CreatedAt, ID: inv.ID}
+	}, func(page repository.Page) ([]domain.WorkspaceInvite, error) {
+		return s.inviteRepo.ListByWorkspace(ctx, workspaceID, page)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &InviteListResponse{Invites: invites, PageCursors: cursors}, nil
 }
 
 func (s *WorkspaceService) RevokeInvite(ctx context.Context, requesterID, workspaceID, inviteID uuid.UUID) error {
+	ctx, span := tracer.Start(ctx, "WorkspaceService.RevokeInvite")
+	defer span.End()
+
 	// Permission check: owner or admin
-	requester, err := s.workspaceRepo.GetMember(ctx, workspaceID, requesterID)
+	requester, err := workspaceMember(ctx, s.workspaceRepo, workspaceID, requesterID)
 	if err != nil {
 		return err
 	}
@@ -357,6 +850,275 @@ func (s *WorkspaceService) RevokeInvite(ctx context.Context, requesterID, worksp
 	return s.inviteRepo.Delete(ctx, inviteID)
 }
 
+func (s *WorkspaceService) GetJoinPolicy(ctx context.Context, requesterID, workspaceID uuid.UUID) (*domain.WorkspaceJoinPolicy, error) {
+	ctx, span := tracer.Start(ctx, "WorkspaceService.GetJoinPolicy")
+	defer span.End()
+
+	requester, err := workspaceMember(ctx, s.workspaceRepo, workspaceID, requesterID)
+	if err != nil {
+		return nil, err
+	}
+	if requester == nil || (requester.Role != "owner" && requester.Role != "admin") {
+		return nil, ErrNotWorkspaceOwner
+	}
+
+	return s.joinPolicy(ctx, workspaceID)
+}
+
+func (s *WorkspaceService) UpdateJoinPolicy(ctx context.Context, requesterID, workspaceID uuid.UUID, input UpdateJoinPolicyInput) (*domain.WorkspaceJoinPolicy, error) {
+	ctx, span := tracer.Start(ctx, "WorkspaceService.UpdateJoinPolicy")
+	defer span.End()
+
+	requester, err := workspaceMember(ctx, s.workspaceRepo, workspaceID, requesterID)
+	if err != nil {
+		return nil, err
+	}
+	if requester == nil || (requester.Role != "owner" && requester.Role != "admin") {
+		return nil, ErrNotWorkspaceOwner
+	}
+	if input.AllowedDomains != nil && requester.Role != "owner" {
+		return nil, ErrNotWorkspaceOwner
+	}
+
+	err = s.tx.WithinTx(ctx, func(ctx context.Context) error {
+		if input.AllowedDomains != nil {
+			domains := make([]string, 0, len(*input.AllowedDomains))
+			for _, d := range *input.AllowedDomains {
+				domains = append(domains, normalizeDomain(d))
+			}
+			if err := s.workspaceRepo.SetAllowedDomains(ctx, workspaceID, domains); err != nil {
+				return fmt.Errorf("setting allowed domains: %w", err)
+			}
+		}
+
+		if input.RequiresApproval != nil {
+			ws, err := s.workspaceRepo.GetByID(ctx, workspaceID)
+			if err != nil {
+				return err
+			}
+			if ws == nil {
+				return ErrWorkspaceNotFound
+			}
+			ws.JoinRequiresApproval = *input.RequiresApproval
+			if err := s.workspaceRepo.Update(ctx, ws); err != nil {
+				return fmt.Errorf("updating workspace: %w", err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return s.joinPolicy(ctx, workspaceID)
+}
+
+// ListDiscoverable returns workspaces the user can join through their email domain.
+func (s *WorkspaceService) ListDiscoverable(ctx context.Context, userID uuid.UUID) ([]domain.DiscoverableWorkspace, error) {
+	ctx, span := tracer.Start(ctx, "WorkspaceService.ListDiscoverable")
+	defer span.End()
+
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, ErrUserNotFound
+	}
+	// The email domain only proves anything once the address is verified
+	if user.EmailVerifiedAt == nil {
+		return nil, ErrEmailNotVerified
+	}
+
+	workspaces, err := s.workspaceRepo.ListDiscoverable(ctx, userID, emailDomain(user.Email))
+	if err != nil {
+		return nil, err
+	}
+	if workspaces == nil {
+		workspaces = []domain.DiscoverableWorkspace{}
+	}
+	return workspaces, nil
+}
+
+// Join adds the user to a workspace that allows their email domain.
+// If the workspace requires approval a pending join request is returned
+// instead; a nil request means the user joined immediately.
+func (s *WorkspaceService) Join(ctx context.Context, userID, workspaceID uuid.UUID) (*domain.WorkspaceJoinRequest, error) {
+	ctx, span := tracer.Start(ctx, "WorkspaceService.Join")
+	defer span.End()
+
+	ws, err := s.workspaceRepo.GetByID(ctx, workspaceID)
+	if err != nil {
+		return nil, err
+	}
+	if ws == nil {
+		return nil, ErrWorkspaceNotFound
+	}
+
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, ErrUserNotFound
+	}
+	if user.EmailVerifiedAt == nil {
+		return nil, ErrEmailNotVerified
+	}
+
+	domains, err := s.workspaceRepo.ListAllowedDomains(ctx, workspaceID)
+	if err != nil {
+		return nil, err
+	}
+	if !slices.Contains(domains, emailDomain(user.Email)) {
+		return nil, ErrDomainNotAllowed
+	}
+
+	existing, err := s.workspaceRepo.GetMember(ctx, workspaceID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil {
+		return nil, ErrAlreadyMember
+	}
+
+	if ws.JoinRequiresApproval {
+		pending, err := s.workspaceRepo.GetPendingJoinRequest(ctx, workspaceID, userID)
+		if err != nil {
+			return nil, err
+		}
+		if pending != nil {
+			return pending, nil
+		}
+
+		req := &domain.WorkspaceJoinRequest{
+			ID:          uuid.New(),
+			WorkspaceID: workspaceID,
+			UserID:      userID,
+			Status:      "pending",
+			CreatedAt:   time.Now(),
+		}
+		if err := s.workspaceRepo.CreateJoinRequest(ctx, req); err != nil {
+			return nil, fmt.Errorf("creating join request: %w", err)
+		}
+		return req, nil
+	}
+
+	member := &domain.WorkspaceMember{
+		WorkspaceID: workspaceID,
+		UserID:      userID,
+		Role:        "member",
+		JoinedAt:    time.Now(),
+	}
+	if err := s.workspaceRepo.AddMember(ctx, member); err != nil {
+		return nil, fmt.Errorf("adding member: %w", err)
+	}
+	return nil, nil
+}
+
+func (s *WorkspaceService) ListJoinRequests(ctx context.Context, requesterID, workspaceID uuid.UUID) ([]domain.WorkspaceJoinRequest, error) {
+	ctx, span := tracer.Start(ctx, "WorkspaceService.ListJoinRequests")
+	defer span.End()
+
+	requester, err := workspaceMember(ctx, s.workspaceRepo, workspaceID, requesterID)
+	if err != nil {
+		return nil, err
+	}
+	if requester == nil || (requester.Role != "owner" && requester.Role != "admin") {
+		return nil, ErrNotWorkspaceOwner
+	}
+
+	reqs, err := s.workspaceRepo.ListPendingJoinRequests(ctx, workspaceID)
+	if err != nil {
+		return nil, err
+	}
+	if reqs == nil {
+		reqs = []domain.WorkspaceJoinRequest{}
+	}
+	return reqs, nil
+}
+
+// DecideJoinRequest approves or rejects a pending join request.
+func (s *WorkspaceService) DecideJoinRequest(ctx context.Context, requesterID, workspaceID, requestID uuid.UUID, approve bool) error {
+	ctx, span := tracer.Start(ctx, "WorkspaceService.DecideJoinRequest")
+	defer span.End()
+
+	requester, err := workspaceMember(ctx, s.workspaceRepo, workspaceID, requesterID)
+	if err != nil {
+		return err
+	}
+	if requester == nil || (requester.Role != "owner" && requester.Role != "admin") {
+		return ErrNotWorkspaceOwner
+	}
+
+	req, err := s.workspaceRepo.GetJoinRequestByID(ctx, requestID)
+	if err != nil {
+		return err
+	}
+	if req == nil || req.WorkspaceID != workspaceID || req.Status != "pending" {
+		return ErrJoinRequestNotFound
+	}
+
+	if !approve {
+		return s.workspaceRepo.DecideJoinRequest(ctx, requestID, "rejected", requesterID)
+	}
+
+	return s.tx.WithinTx(ctx, func(ctx context.Context) error {
+		existing, err := s.workspaceRepo.GetMember(ctx, workspaceID, req.UserID)
+		if err != nil {
+			return err
+		}
+		if existing == nil {
+			member := &domain.WorkspaceMember{
+				WorkspaceID: workspaceID,
+				UserID:      req.UserID,
+				Role:        "member",
+				JoinedAt:    time.Now(),
+			}
+			if err := s.workspaceRepo.AddMember(ctx, member); err != nil {
+				return fmt.Errorf("adding member: %w", err)
+			}
+		}
+		return s.workspaceRepo.DecideJoinRequest(ctx, requestID, "approved", requesterID)
+	})
+}
+
+func (s *WorkspaceService) joinPolicy(ctx context.Context, workspaceID uuid.UUID) (*domain.WorkspaceJoinPolicy, error) {
+	ws, err := s.workspaceRepo.GetByID(ctx, workspaceID)
+	if err != nil {
+		return nil, err
+	}
+	if ws == nil {
+		return nil, ErrWorkspaceNotFound
+	}
+
+	domains, err := s.workspaceRepo.ListAllowedDomains(ctx, workspaceID)
+	if err != nil {
+		return nil, err
+	}
+	if domains == nil {
+		domains = []string{}
+	}
+
+	return &domain.WorkspaceJoinPolicy{
+		AllowedDomains:   domains,
+		RequiresApproval: ws.JoinRequiresApproval,
+	}, nil
+}
+
+// emailDomain returns the lowercased domain part of an email address.
+func emailDomain(email string) string {
+	at := strings.LastIndex(email, "@")
+	if at < 0 {
+		return ""
+	}
+	return strings.ToLower(email[at+1:])
+}
+
+func normalizeDomain(d string) string {
+	return strings.TrimPrefix(strings.ToLower(strings.TrimSpace(d)), "@")
+}
+
 func slugify(s string) string {
 	s = strings.ToLower(strings.TrimSpace(s))
 	s = nonAlphanumeric.ReplaceAllString(s, "-")
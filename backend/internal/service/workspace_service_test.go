@@ -0,0 +1,332 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/vedran77/pulse/internal/domain"
+	"github.com/vedran77/pulse/internal/repository/memory"
+)
+
+// failingMembers makes adding workspace members fail.
+type failingMembers struct {
+	*memory.WorkspaceRepo
+}
+
+var errAddMember = errors.New("add member failed")
+
+func (failingMembers) AddMember(context.Context, *domain.WorkspaceMember) error {
+	return errAddMember
+}
+
+func TestWorkspaceCreateRollsBack(t *testing.T) {
+	ctx := context.Background()
+	store := memory.NewStore()
+	users := memory.NewUserRepo(store)
+	workspaces := memory.NewWorkspaceRepo(store)
+	svc := NewWorkspaceService(failingMembers{workspaces}, users, memory.NewInviteRepo(store), memory.NewTxManager(store))
+
+	alice := newTestUser(t, users, "alice")
+	_, err := svc.Create(ctx, alice.ID, CreateWorkspaceInput{Name: "Acme"})
+	if !errors.Is(err, errAddMember) {
+		t.Fatalf("Create = %v, want %v", err, errAddMember)
+	}
+	if ws, _ := workspaces.GetBySlug(ctx, "acme"); ws != nil {
+		t.Fatal("workspace left behind without its owner")
+	}
+}
+
+func TestWorkspaceOwnershipAndDeletion(t *testing.T) {
+	ctx := context.Background()
+	store := memory.NewStore()
+	users := memory.NewUserRepo(store)
+	workspaces := memory.NewWorkspaceRepo(store)
+	channels := memory.NewChannelRepo(store)
+	tx := memory.NewTxManager(store)
+	svc := NewWorkspaceService(workspaces, users, memory.NewInviteRepo(store), tx)
+
+	alice := newTestUser(t, users, "alice")
+	bob := newTestUser(t, users, "bob")
+	carol := newTestUser(t, users, "carol")
+	ws, err := svc.Create(ctx, alice.ID, CreateWorkspaceInput{Name: "Acme"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, m := range []domain.WorkspaceMember{
+		{WorkspaceID: ws.ID, UserID: bob.ID, Role: "admin", JoinedAt: time.Now()},
+		{WorkspaceID: ws.ID, UserID: carol.ID, Role: "member", JoinedAt: time.Now()},
+	} {
+		if err := workspaces.AddMember(ctx, &m); err != nil {
+			t.Fatal(err)
+		}
+	}
+	role := func(user *domain.User) string {
+		t.Helper()
+		m, err := workspaces.GetMember(ctx, ws.ID, user.ID)
+		if err != nil || m == nil {
+			t.Fatalf("GetMember = %v, %v", m, err)
+		}
+		return m.Role
+	}
+
+	t.Run("owner can't be removed", func(t *testing.T) {
+		if err := svc.RemoveMember(ctx, bob.ID, ws.ID, alice.ID); !errors.Is(err, ErrCannotRemoveOwner) {
+			t.Fatalf("admin removing the owner: err = %v", err)
+		}
+	})
+
+	t.Run("transfer", func(t *testing.T) {
+		transfer := func(to *domain.User, confirm string) error {
+			_, err := svc.TransferOwnership(ctx, alice.ID, ws.ID, TransferOwnershipInput{UserID: to.ID, Confirm: confirm})
+			return err
+		}
+		if err := transfer(bob, "wrong"); !errors.Is(err, ErrTransferNotConfirmed) {
+			t.Fatalf("without confirmation: err = %v", err)
+		}
+		if err := transfer(carol, ws.Slug); !errors.Is(err, ErrNewOwnerNotAdmin) {
+			t.Fatalf("to a member: err = %v", err)
+		}
+		if err := transfer(bob, ws.Slug); err != nil {
+			t.Fatal(err)
+		}
+		got, _ := workspaces.GetByID(ctx, ws.ID)
+		if got.OwnerID != bob.ID || role(bob) != "owner" || role(alice) != "admin" {
+			t.Fatalf("after transfer: owner %v, bob %s, alice %s", got.OwnerID, role(bob), role(alice))
+		}
+		if err := svc.Delete(ctx, alice.ID, ws.ID); !errors.Is(err, ErrNotWorkspaceOwner) {
+			t.Fatalf("previous owner deleting: err = %v", err)
+		}
+	})
+
+	t.Run("delete and restore", func(t *testing.T) {
+		channelSvc := NewChannelService(channels, workspaces, tx)
+		messageSvc := NewMessageService(memory.NewMessageRepo(store), channels, workspaces)
+		private, err := channelSvc.Create(ctx, bob.ID, ws.ID, CreateChannelInput{Name: "plans", Type: "private"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := channelSvc.AddMember(ctx, bob.ID, private.ID, carol.ID); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := svc.Delete(ctx, bob.ID, ws.ID); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := svc.GetByID(ctx, carol.ID, ws.ID); !errors.Is(err, ErrNotMember) {
+			t.Fatalf("getting a deleted workspace: err = %v", err)
+		}
+		// Channel membership doesn't get around the deletion
+		if _, err := channelSvc.GetByID(ctx, carol.ID, private.ID); !errors.Is(err, ErrChannelNotFound) {
+			t.Fatalf("getting a private channel of a deleted workspace: err = %v", err)
+		}
+		if _, err := messageSvc.Send(ctx, carol.ID, private.ID, SendMessageInput{Content: "anyone?"}); !errors.Is(err, ErrChannelNotFound) {
+			t.Fatalf("posting in a deleted workspace: err = %v", err)
+		}
+		if _, err := messageSvc.List(ctx, carol.ID, private.ID, PageInput{}, nil); !errors.Is(err, ErrChannelNotFound) {
+			t.Fatalf("reading a deleted workspace: err = %v", err)
+		}
+		deleted, err := svc.ListDeleted(ctx, bob.ID)
+		if err != nil || len(deleted) != 1 || deleted[0].ID != ws.ID {
+			t.Fatalf("ListDeleted = %+v, %v", deleted, err)
+		}
+		if _, err := svc.Restore(ctx, alice.ID, ws.ID); !errors.Is(err, ErrNotWorkspaceOwner) {
+			t.Fatalf("restoring someone else's workspace: err = %v", err)
+		}
+		if _, err := svc.Restore(ctx, bob.ID, ws.ID); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := svc.GetByID(ctx, carol.ID, ws.ID); err != nil {
+			t.Fatalf("getting a restored workspace: %v", err)
+		}
+		if _, err := messageSvc.Send(ctx, carol.ID, private.ID, SendMessageInput{Content: "back"}); err != nil {
+			t.Fatalf("posting in a restored workspace: %v", err)
+		}
+	})
+
+	t.Run("purge", func(t *testing.T) {
+		if err := svc.Delete(ctx, bob.ID, ws.ID); err != nil {
+			t.Fatal(err)
+		}
+		// Still within the restore window
+		if err := svc.purgeDeleted(ctx, time.Now()); err != nil {
+			t.Fatal(err)
+		}
+		if got, _ := workspaces.GetDeletedByID(ctx, ws.ID); got == nil {
+			t.Fatal("purged within the restore window")
+		}
+
+		if err := svc.purgeDeleted(ctx, time.Now().Add(workspaceRestoreWindow+time.Hour)); err != nil {
+			t.Fatal(err)
+		}
+		if got, _ := workspaces.GetDeletedByID(ctx, ws.ID); got != nil {
+			t.Fatal("not purged after the restore window")
+		}
+		if got, _ := workspaces.GetBySlug(ctx, ws.Slug); got != nil {
+			t.Fatal("slug still reserved after purging")
+		}
+	})
+}
+
+func TestWorkspaceMemberDirectory(t *testing.T) {
+	ctx := context.Background()
+	store := memory.NewStore()
+	users := memory.NewUserRepo(store)
+	workspaces := memory.NewWorkspaceRepo(store)
+	svc := NewWorkspaceService(workspaces, users, memory.NewInviteRepo(store), memory.NewTxManager(store))
+
+	alice := newTestUser(t, users, "alice")
+	ws, err := svc.Create(ctx, alice.ID, CreateWorkspaceInput{Name: "Acme"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var members []*domain.User
+	for _, name := range []string{"bob", "bobby", "boris", "carol"} {
+		u := newTestUser(t, users, name)
+		if err := workspaces.AddMember(ctx, &domain.WorkspaceMember{WorkspaceID: ws.ID, UserID: u.ID, Role: "member", JoinedAt: time.Now()}); err != nil {
+			t.Fatal(err)
+		}
+		members = append(members, u)
+	}
+	bob, carol := members[0], members[3]
+	outsider := newTestUser(t, users, "dave")
+
+	t.Run("pages", func(t *testing.T) {
+		var got []string
+		input := MemberSearchInput{Query: "bo", PageInput: PageInput{Limit: 2}}
+		for {
+			resp, err := svc.SearchMembers(ctx, bob.ID, ws.ID, input)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, m := range resp.Members {
+				got = append(got, m.Username)
+			}
+			if resp.Next == "" {
+				if resp.Prev == "" {
+					t.Fatal("last page has no prev_cursor")
+				}
+				input.After, input.Before = "", resp.Prev
+				break
+			}
+			input.After = resp.Next
+		}
+		if len(got) != 3 || got[0] != "bob" || got[1] != "bobby" || got[2] != "boris" {
+			t.Fatalf("paged results = %v", got)
+		}
+		resp, err := svc.SearchMembers(ctx, bob.ID, ws.ID, input)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(resp.Members) != 2 || resp.Members[0].Username != "bob" || resp.Prev != "" || resp.Next == "" {
+			t.Fatalf("previous page = %+v", resp)
+		}
+	})
+
+	t.Run("emails only for admins", func(t *testing.T) {
+		resp, err := svc.SearchMembers(ctx, carol.ID, ws.ID, MemberSearchInput{Query: "alice@"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(resp.Members) != 0 {
+			t.Fatalf("member matched by email: %+v", resp.Members)
+		}
+		resp, err = svc.SearchMembers(ctx, alice.ID, ws.ID, MemberSearchInput{Query: "carol"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(resp.Members) != 1 || resp.Members[0].Email != "carol@example.com" {
+			t.Fatalf("admin search = %+v", resp.Members)
+		}
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		if _, err := svc.SearchMembers(ctx, outsider.ID, ws.ID, MemberSearchInput{}); !errors.Is(err, ErrNotMember) {
+			t.Fatalf("outsider search = %v, want %v", err, ErrNotMember)
+		}
+		if _, err := svc.SearchMembers(ctx, bob.ID, ws.ID, MemberSearchInput{PageInput: PageInput{After: "not a cursor"}}); !errors.Is(err, ErrInvalidCursor) {
+			t.Fatalf("bad cursor = %v, want %v", err, ErrInvalidCursor)
+		}
+	})
+
+	t.Run("profile", func(t *testing.T) {
+		title, pronouns := "  Designer ", "he/him"
+		m, err := svc.UpdateMemberProfile(ctx, bob.ID, ws.ID, UpdateMemberProfileInput{Title: &title, Pronouns: &pronouns})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if m.Title == nil || *m.Title != "Designer" || m.Pronouns == nil || m.Timezone != nil {
+			t.Fatalf("UpdateMemberProfile = %+v", m)
+		}
+		empty := ""
+		if _, err := svc.UpdateMemberProfile(ctx, bob.ID, ws.ID, UpdateMemberProfileInput{Title: &empty}); err != nil {
+			t.Fatal(err)
+		}
+		if m, _ := workspaces.GetMember(ctx, ws.ID, bob.ID); m.Title != nil || m.Pronouns == nil {
+			t.Fatalf("after clearing title: %+v", m)
+		}
+		if _, err := svc.UpdateMemberProfile(ctx, outsider.ID, ws.ID, UpdateMemberProfileInput{Title: &title}); !errors.Is(err, ErrNotMember) {
+			t.Fatalf("outsider update = %v, want %v", err, ErrNotMember)
+		}
+	})
+}
+
+func TestWorkspaceSignInPolicy(t *testing.T) {
+	ctx := context.Background()
+	f := newTestWorkspace(t)
+	store, users, workspaces, channels := f.store, f.users, f.workspaces, f.channels
+	bob, ws := f.bob, f.ws
+	ch := f.channel(t, f.alice, CreateChannelInput{Name: "general", Type: "public"})
+	svc := NewMessageService(memory.NewMessageRepo(store), channels, workspaces)
+	send := func(ctx context.Context) error {
+		_, err := svc.Send(ctx, bob.ID, ch.ID, SendMessageInput{Content: "hello"})
+		return err
+	}
+	require := func(twoFactor, sso bool) {
+		t.Helper()
+		ws.RequireTwoFactor, ws.RequireSSO = twoFactor, sso
+		if err := workspaces.Update(ctx, ws); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	t.Run("two-factor", func(t *testing.T) {
+		require(true, false)
+		if err := send(domain.WithSession(ctx, domain.Session{UserID: bob.ID, AuthMethod: domain.AuthMethodPassword})); !errors.Is(err, ErrTwoFactorRequired) {
+			t.Fatalf("send without 2FA = %v, want %v", err, ErrTwoFactorRequired)
+		}
+		if err := send(domain.WithSession(ctx, domain.Session{UserID: bob.ID, TwoFactorEnabled: true, AuthMethod: domain.AuthMethodPassword})); err != nil {
+			t.Fatalf("send with 2FA = %v", err)
+		}
+		// Scheduled delivery runs without a session
+		if err := send(ctx); err != nil {
+			t.Fatalf("send without a session = %v", err)
+		}
+	})
+
+	t.Run("sso", func(t *testing.T) {
+		require(false, true)
+		// Sessions come from the access token's auth_method claim
+		auth := NewAuthService(users, memory.NewVerificationTokenRepo(store), memory.NewTwoFactorRepo(store), memory.NewIdentityRepo(store), "test-secret", "test-totp-key")
+		session := func(authMethod string) context.Context {
+			t.Helper()
+			token, err := auth.generateToken(bob, authMethod)
+			if err != nil {
+				t.Fatal(err)
+			}
+			s, err := auth.ValidateAccessToken(ctx, token)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return domain.WithSession(ctx, s)
+		}
+
+		if err := send(session(domain.AuthMethodPassword)); !errors.Is(err, ErrSSORequired) {
+			t.Fatalf("send from a password login = %v, want %v", err, ErrSSORequired)
+		}
+		if err := send(session(domain.AuthMethodSSO)); err != nil {
+			t.Fatalf("send from an SSO login = %v", err)
+		}
+	})
+}
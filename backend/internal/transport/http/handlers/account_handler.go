@@ -0,0 +1,232 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/vedran77/pulse/internal/service"
+	"github.com/vedran77/pulse/internal/transport/http/middleware"
+	"github.com/vedran77/pulse/pkg/validator"
+)
+
+type AccountHandler struct {
+	accountService *service.AccountService
+	// Largest avatar upload accepted, in bytes
+	maxAvatarBytes int64
+}
+
+func NewAccountHandler(accountService *service.AccountService, maxAvatarBytes int64) *AccountHandler {
+	return &AccountHandler{accountService: accountService, maxAvatarBytes: maxAvatarBytes}
+}
+
+func (h *AccountHandler) Get(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserID(r.Context())
+
+	user, err := h.accountService.Get(r.Context(), userID)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "get account", "err", err)
+		writeError(w, http.StatusInternalServerError, "INTERNAL", "Something went wrong")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, user)
+}
+
+func (h *AccountHandler) Update(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserID(r.Context())
+
+	var input service.UpdateProfileInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		writeError(w, http.StatusBadRequest, "INVALID_JSON", "Invalid request body")
+		return
+	}
+
+	if errs := validator.ValidateProfileUpdate(input.Username, input.DisplayName); errs.HasErrors() {
+		writeValidationErrors(w, errs)
+		return
+	}
+
+	user, err := h.accountService.UpdateProfile(r.Context(), userID, input)
+	if err != nil {
+		if errors.Is(err, service.ErrUsernameTaken) {
+			writeError(w, http.StatusConflict, "USERNAME_TAKEN", "Username is already taken")
+		} else {
+			slog.ErrorContext(r.Context(), "update profile", "err", err)
+			writeError(w, http.StatusInternalServerError, "INTERNAL", "Something went wrong")
+		}
+		return
+	}
+
+	writeJSON(w, http.StatusOK, user)
+}
+
+// UploadAvatar takes the image in the "avatar" field of a multipart form.
+func (h *AccountHandler) UploadAvatar(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserID(r.Context())
+
+	// Room for the multipart headers on top of the image
+	r.Body = http.MaxBytesReader(w, r.Body, h.maxAvatarBytes+64<<10)
+	file, _, err := r.FormFile("avatar")
+	if err != nil {
+		var tooBig *http.MaxBytesError
+		if errors.As(err, &tooBig) {
+			writeError(w, http.StatusRequestEntityTooLarge, "AVATAR_TOO_LARGE", "Avatar file is too large")
+		} else {
+			writeError(w, http.StatusBadRequest, "MISSING_AVATAR", "Upload the image in the avatar form field")
+		}
+		return
+	}
+	defer file.Close()
+
+	user, err := h.accountService.SetAvatar(r.Context(), userID, file)
+	if err != nil {
+		var tooBig *http.MaxBytesError
+		switch {
+		case errors.As(err, &tooBig):
+			writeError(w, http.StatusRequestEntityTooLarge, "AVATAR_TOO_LARGE", "Avatar file is too large")
+		case errors.Is(err, service.ErrInvalidImage):
+			writeError(w, http.StatusBadRequest, "INVALID_IMAGE", "Avatar must be a PNG, JPEG or GIF image")
+		case errors.Is(err, service.ErrImageTooLarge):
+			writeError(w, http.StatusBadRequest, "IMAGE_TOO_LARGE", "Avatar image dimensions are too large")
+		default:
+			slog.ErrorContext(r.Context(), "upload avatar", "err", err)
+			writeError(w, http.StatusInternalServerError, "INTERNAL", "Something went wrong")
+		}
+		return
+	}
+
+	writeJSON(w, http.StatusOK, user)
+}
+
+func (h *AccountHandler) DeleteAvatar(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserID(r.Context())
+
+	if err := h.accountService.RemoveAvatar(r.Context(), userID); err != nil {
+		slog.ErrorContext(r.Context(), "remove avatar", "err", err)
+		writeError(w, http.StatusInternalServerError, "INTERNAL", "Something went wrong")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *AccountHandler) ChangePassword(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserID(r.Context())
+
+	var input service.ChangePasswordInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		writeError(w, http.StatusBadRequest, "INVALID_JSON", "Invalid request body")
+		return
+	}
+
+	if errs := validator.ValidatePasswordChange(input.CurrentPassword, input.NewPassword); errs.HasErrors() {
+		writeValidationErrors(w, errs)
+		return
+	}
+
+	resp, err := h.accountService.ChangePassword(r.Context(), userID, input)
+	if err != nil {
+		writeReauthError(w, r, "change password", err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (h *AccountHandler) ChangeEmail(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserID(r.Context())
+
+	var input service.ChangeEmailInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		writeError(w, http.StatusBadRequest, "INVALID_JSON", "Invalid request body")
+		return
+	}
+
+	if errs := validator.ValidateEmailChange(input.Email, input.Password); errs.HasErrors() {
+		writeValidationErrors(w, errs)
+		return
+	}
+
+	if err := h.accountService.ChangeEmail(r.Context(), userID, input); err != nil {
+		switch {
+		case errors.Is(err, service.ErrEmailTaken):
+			writeError(w, http.StatusConflict, "EMAIL_TAKEN", "Email is already registered")
+		case errors.Is(err, service.ErrEmailUnchanged):
+			writeError(w, http.StatusBadRequest, "EMAIL_UNCHANGED", "That is already your email address")
+		default:
+			writeReauthError(w, r, "change email", err)
+		}
+		return
+	}
+
+	// The change is applied once the link sent to the new address is opened
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (h *AccountHandler) ConfirmEmail(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Token string `json:"token"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		writeError(w, http.StatusBadRequest, "INVALID_JSON", "Invalid request body")
+		return
+	}
+
+	if err := h.accountService.ConfirmEmailChange(r.Context(), input.Token); err != nil {
+		switch {
+		case errors.Is(err, service.ErrInvalidToken):
+			writeError(w, http.StatusBadRequest, "INVALID_TOKEN", "Confirmation link is invalid or has expired")
+		case errors.Is(err, service.ErrEmailTaken):
+			writeError(w, http.StatusConflict, "EMAIL_TAKEN", "Email is already registered")
+		default:
+			slog.ErrorContext(r.Context(), "confirm email change", "err", err)
+			writeError(w, http.StatusInternalServerError, "INTERNAL", "Something went wrong")
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *AccountHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserID(r.Context())
+
+	var input struct {
+		Password string `json:"password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		writeError(w, http.StatusBadRequest, "INVALID_JSON", "Invalid request body")
+		return
+	}
+
+	if errs := validator.ValidateAccountDeletion(input.Password); errs.HasErrors() {
+		writeValidationErrors(w, errs)
+		return
+	}
+
+	if err := h.accountService.Delete(r.Context(), userID, input.Password); err != nil {
+		if errors.Is(err, service.ErrOwnsWorkspaces) {
+			writeError(w, http.StatusConflict, "OWNS_WORKSPACES", "Transfer or delete the workspaces you own first")
+		} else {
+			writeReauthError(w, r, "delete account", err)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// writeReauthError maps the errors of changes that need the current password.
+func writeReauthError(w http.ResponseWriter, r *http.Request, op string, err error) {
+	switch {
+	case errors.Is(err, service.ErrInvalidCreds):
+		writeError(w, http.StatusUnauthorized, "INVALID_CREDENTIALS", "Invalid password")
+	case errors.Is(err, service.ErrAccountLocked):
+		writeAccountLocked(w, err)
+	default:
+		slog.ErrorContext(r.Context(), op, "err", err)
+		writeError(w, http.StatusInternalServerError, "INTERNAL", "Something went wrong")
+	}
+}
@@ -1,21 +1,33 @@
 package handlers
 
 import (
+	"crypto/subtle"
 	"encoding/json"
 	"errors"
-	"log"
+	"log/slog"
+	"math"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/vedran77/pulse/internal/service"
+	"github.com/vedran77/pulse/internal/transport/http/middleware"
 	"github.com/vedran77/pulse/pkg/validator"
 )
 
+// Cookie binding an SSO login attempt to the browser that started it
+const oidcStateCookie = "pulse_oidc_state"
+
 type AuthHandler struct {
 	authService *service.AuthService
+	// Frontend base URL that SSO logins redirect back to
+	appURL string
 }
 
-func NewAuthHandler(authService *service.AuthService) *AuthHandler {
-	return &AuthHandler{authService: authService}
+func NewAuthHandler(authService *service.AuthService, appURL string) *AuthHandler {
+	return &AuthHandler{authService: authService, appURL: strings.TrimRight(appURL, "/")}
 }
 
 func (h *AuthHandler) Register(w http.ResponseWriter, r *http.Request) {
@@ -37,8 +49,10 @@ func (h *AuthHandler) Register(w http.ResponseWriter, r *http.Request) {
 			writeError(w, http.StatusConflict, "EMAIL_TAKEN", "Email is already registered")
 		case errors.Is(err, service.ErrUsernameTaken):
 			writeError(w, http.StatusConflict, "USERNAME_TAKEN", "Username is already taken")
+		case errors.Is(err, service.ErrRegistrationClosed):
+			writeError(w, http.StatusForbidden, "REGISTRATION_CLOSED", "Registration is closed, ask for an invite or sign in with SSO")
 		default:
-			log.Printf("ERROR register: %v", err)
+			slog.ErrorContext(r.Context(), "register", "err", err)
 			writeError(w, http.StatusInternalServerError, "INTERNAL", "Something went wrong")
 		}
 		return
@@ -61,10 +75,115 @@ func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
 
 	resp, err := h.authService.Login(r.Context(), input)
 	if err != nil {
-		if errors.Is(err, service.ErrInvalidCreds) {
+		switch {
+		case errors.Is(err, service.ErrInvalidCreds):
 			writeError(w, http.StatusUnauthorized, "INVALID_CREDENTIALS", "Invalid email or password")
+		case errors.Is(err, service.ErrSSORequired):
+			writeError(w, http.StatusForbidden, "SSO_REQUIRED", "Your workspace requires signing in with SSO")
+		case errors.Is(err, service.ErrAccountLocked):
+			writeAccountLocked(w, err)
+		default:
+			slog.ErrorContext(r.Context(), "login", "err", err)
+			writeError(w, http.StatusInternalServerError, "INTERNAL", "Something went wrong")
+		}
+		return
+	}
+
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// OIDCLogin redirects the browser to the identity provider.
+func (h *AuthHandler) OIDCLogin(w http.ResponseWriter, r *http.Request) {
+	authURL, state, err := h.authService.StartOIDCLogin(r.Context())
+	if err != nil {
+		if errors.Is(err, service.ErrSSONotConfigured) {
+			writeError(w, http.StatusNotFound, "SSO_NOT_CONFIGURED", "Single sign-on is not configured")
 		} else {
-			log.Printf("ERROR login: %v", err)
+			slog.ErrorContext(r.Context(), "start sso login", "err", err)
+			writeError(w, http.StatusInternalServerError, "INTERNAL", "Something went wrong")
+		}
+		return
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcStateCookie,
+		Value:    state,
+		Path:     "/api/v1/auth/oidc",
+		MaxAge:   600,
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+	http.Redirect(w, r, authURL, http.StatusFound)
+}
+
+// OIDCCallback finishes the SSO login and redirects to the frontend with
+// the tokens in the URL fragment, which browsers never send to servers.
+func (h *AuthHandler) OIDCCallback(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+
+	cookie, err := r.Cookie(oidcStateCookie)
+	http.SetCookie(w, &http.Cookie{Name: oidcStateCookie, Path: "/api/v1/auth/oidc", MaxAge: -1})
+
+	if q.Get("error") != "" {
+		h.redirectSSOError(w, r, "sso_denied")
+		return
+	}
+	if err != nil || subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(q.Get("state"))) != 1 {
+		h.redirectSSOError(w, r, "sso_state_mismatch")
+		return
+	}
+
+	resp, err := h.authService.CompleteOIDCLogin(r.Context(), q.Get("state"), q.Get("code"))
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrInvalidToken):
+			h.redirectSSOError(w, r, "sso_expired")
+		case errors.Is(err, service.ErrSSOEmailUnverified):
+			h.redirectSSOError(w, r, "sso_email_unverified")
+		default:
+			slog.ErrorContext(r.Context(), "complete sso login", "err", err)
+			h.redirectSSOError(w, r, "sso_failed")
+		}
+		return
+	}
+
+	fragment := url.Values{}
+	if resp.TwoFactorRequired {
+		fragment.Set("challenge_token", resp.ChallengeToken)
+	} else {
+		fragment.Set("access_token", resp.AccessToken)
+	}
+	http.Redirect(w, r, h.appURL+"/auth/sso#"+fragment.Encode(), http.StatusFound)
+}
+
+func (h *AuthHandler) redirectSSOError(w http.ResponseWriter, r *http.Request, code string) {
+	http.Redirect(w, r, h.appURL+"/login?error="+code, http.StatusFound)
+}
+
+func (h *AuthHandler) LoginTwoFactor(w http.ResponseWriter, r *http.Request) {
+	var input service.LoginTwoFactorInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		writeError(w, http.StatusBadRequest, "INVALID_JSON", "Invalid request body")
+		return
+	}
+
+	if errs := validator.ValidateTwoFactorCode(input.Code); errs.HasErrors() {
+		writeValidationErrors(w, errs)
+		return
+	}
+
+	resp, err := h.authService.LoginTwoFactor(r.Context(), input)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrInvalidToken):
+			writeError(w, http.StatusUnauthorized, "INVALID_TOKEN", "Login session has expired, sign in again")
+		case errors.Is(err, service.ErrInvalidTwoFactorCode):
+			writeError(w, http.StatusUnauthorized, "INVALID_CODE", "Invalid two-factor code")
+		case errors.Is(err, service.ErrAccountLocked):
+			writeAccountLocked(w, err)
+		default:
+			slog.ErrorContext(r.Context(), "login 2fa", "err", err)
 			writeError(w, http.StatusInternalServerError, "INTERNAL", "Something went wrong")
 		}
 		return
@@ -73,6 +192,212 @@ func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
 	writeJSON(w, http.StatusOK, resp)
 }
 
+func (h *AuthHandler) EnrollTwoFactor(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserID(r.Context())
+
+	enrollment, err := h.authService.EnrollTwoFactor(r.Context(), userID)
+	if err != nil {
+		if errors.Is(err, service.ErrTwoFactorAlreadyEnabled) {
+			writeError(w, http.StatusConflict, "TWO_FACTOR_ENABLED", "Two-factor authentication is already enabled")
+		} else {
+			slog.ErrorContext(r.Context(), "enroll 2fa", "err", err)
+			writeError(w, http.StatusInternalServerError, "INTERNAL", "Something went wrong")
+		}
+		return
+	}
+
+	writeJSON(w, http.StatusOK, enrollment)
+}
+
+func (h *AuthHandler) ConfirmTwoFactor(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserID(r.Context())
+
+	var input struct {
+		Code string `json:"code"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		writeError(w, http.StatusBadRequest, "INVALID_JSON", "Invalid request body")
+		return
+	}
+
+	if errs := validator.ValidateTwoFactorCode(input.Code); errs.HasErrors() {
+		writeValidationErrors(w, errs)
+		return
+	}
+
+	codes, err := h.authService.ConfirmTwoFactor(r.Context(), userID, input.Code)
+	if err != nil {
+		writeTwoFactorError(w, r, "confirm 2fa", err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{"recovery_codes": codes})
+}
+
+func (h *AuthHandler) DisableTwoFactor(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserID(r.Context())
+
+	var input struct {
+		Password string `json:"password"`
+		Code     string `json:"code"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		writeError(w, http.StatusBadRequest, "INVALID_JSON", "Invalid request body")
+		return
+	}
+
+	if errs := validator.ValidateTwoFactorCode(input.Code); errs.HasErrors() {
+		writeValidationErrors(w, errs)
+		return
+	}
+
+	if err := h.authService.DisableTwoFactor(r.Context(), userID, input.Password, input.Code); err != nil {
+		if errors.Is(err, service.ErrInvalidCreds) {
+			writeError(w, http.StatusUnauthorized, "INVALID_CREDENTIALS", "Invalid password")
+		} else {
+			writeTwoFactorError(w, r, "disable 2fa", err)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *AuthHandler) RegenerateRecoveryCodes(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserID(r.Context())
+
+	var input struct {
+		Code string `json:"code"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		writeError(w, http.StatusBadRequest, "INVALID_JSON", "Invalid request body")
+		return
+	}
+
+	if errs := validator.ValidateTwoFactorCode(input.Code); errs.HasErrors() {
+		writeValidationErrors(w, errs)
+		return
+	}
+
+	codes, err := h.authService.RegenerateRecoveryCodes(r.Context(), userID, input.Code)
+	if err != nil {
+		writeTwoFactorError(w, r, "regenerate recovery codes", err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{"recovery_codes": codes})
+}
+
+func writeAccountLocked(w http.ResponseWriter, err error) {
+	var locked *service.AccountLockedError
+	if errors.As(err, &locked) {
+		retry := int(math.Ceil(time.Until(locked.Until).Seconds()))
+		w.Header().Set("Retry-After", strconv.Itoa(max(retry, 1)))
+	}
+	writeError(w, http.StatusTooManyRequests, "ACCOUNT_LOCKED", "Too many failed sign-in attempts, try again later")
+}
+
+func writeTwoFactorError(w http.ResponseWriter, r *http.Request, op string, err error) {
+	switch {
+	case errors.Is(err, service.ErrInvalidTwoFactorCode):
+		writeError(w, http.StatusBadRequest, "INVALID_CODE", "Invalid two-factor code")
+	case errors.Is(err, service.ErrTwoFactorNotEnabled):
+		writeError(w, http.StatusConflict, "TWO_FACTOR_NOT_ENABLED", "Two-factor authentication is not set up")
+	case errors.Is(err, service.ErrTwoFactorAlreadyEnabled):
+		writeError(w, http.StatusConflict, "TWO_FACTOR_ENABLED", "Two-factor authentication is already enabled")
+	default:
+		slog.ErrorContext(r.Context(), op, "err", err)
+		writeError(w, http.StatusInternalServerError, "INTERNAL", "Something went wrong")
+	}
+}
+
+func (h *AuthHandler) VerifyEmail(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Token string `json:"token"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		writeError(w, http.StatusBadRequest, "INVALID_JSON", "Invalid request body")
+		return
+	}
+
+	if err := h.authService.VerifyEmail(r.Context(), input.Token); err != nil {
+		if errors.Is(err, service.ErrInvalidToken) {
+			writeError(w, http.StatusBadRequest, "INVALID_TOKEN", "Verification link is invalid or has expired")
+		} else {
+			slog.ErrorContext(r.Context(), "verify email", "err", err)
+			writeError(w, http.StatusInternalServerError, "INTERNAL", "Something went wrong")
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *AuthHandler) ResendVerification(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserID(r.Context())
+
+	if err := h.authService.ResendVerification(r.Context(), userID); err != nil {
+		if errors.Is(err, service.ErrAlreadyVerified) {
+			writeError(w, http.StatusConflict, "ALREADY_VERIFIED", "Email address is already verified")
+		} else {
+			slog.ErrorContext(r.Context(), "resend verification", "err", err)
+			writeError(w, http.StatusInternalServerError, "INTERNAL", "Something went wrong")
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (h *AuthHandler) ForgotPassword(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Email string `json:"email"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		writeError(w, http.StatusBadRequest, "INVALID_JSON", "Invalid request body")
+		return
+	}
+
+	if errs := validator.ValidateEmail(input.Email); errs.HasErrors() {
+		writeValidationErrors(w, errs)
+		return
+	}
+
+	if err := h.authService.ForgotPassword(r.Context(), input.Email); err != nil {
+		slog.ErrorContext(r.Context(), "forgot password", "err", err)
+		writeError(w, http.StatusInternalServerError, "INTERNAL", "Something went wrong")
+		return
+	}
+
+	// Same response whether or not the account exists
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (h *AuthHandler) ResetPassword(w http.ResponseWriter, r *http.Request) {
+	var input service.ResetPasswordInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		writeError(w, http.StatusBadRequest, "INVALID_JSON", "Invalid request body")
+		return
+	}
+
+	if errs := validator.ValidatePasswordReset(input.Token, input.Password); errs.HasErrors() {
+		writeValidationErrors(w, errs)
+		return
+	}
+
+	if err := h.authService.ResetPassword(r.Context(), input); err != nil {
+		if errors.Is(err, service.ErrInvalidToken) {
+			writeError(w, http.StatusBadRequest, "INVALID_TOKEN", "Reset link is invalid or has expired")
+		} else {
+			slog.ErrorContext(r.Context(), "reset password", "err", err)
+			writeError(w, http.StatusInternalServerError, "INTERNAL", "Something went wrong")
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
 func writeJSON(w http.ResponseWriter, status int, data any) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(status)
@@ -96,3 +421,17 @@ func writeValidationErrors(w http.ResponseWriter, errs validator.ValidationError
 		},
 	})
 }
+
+// pageInput reads a list request's before and after cursors and page size.
+func pageInput(r *http.Request) service.PageInput {
+	query := r.URL.Query()
+	input := service.PageInput{Before: query.Get("before"), After: query.Get("after")}
+	if limit, err := strconv.Atoi(query.Get("limit")); err == nil {
+		input.Limit = limit
+	}
+	return input
+}
+
+func writeInvalidCursor(w http.ResponseWriter) {
+	writeError(w, http.StatusBadRequest, "INVALID_CURSOR", "Invalid page cursor")
+}
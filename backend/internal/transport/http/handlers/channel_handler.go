@@ -3,11 +3,10 @@ package handlers
 import (
 	"encoding/json"
 	"errors"
-	"log"
+	"log/slog"
 	"net/http"
 
 	"github.com/google/uuid"
-	"github.com/vedran77/pulse/internal/domain"
 	"github.com/vedran77/pulse/internal/service"
 	"github.com/vedran77/pulse/internal/transport/http/middleware"
 	"github.com/vedran77/pulse/pkg/validator"
@@ -47,8 +46,10 @@ func (h *ChannelHandler) Create(w http.ResponseWriter, r *http.Request) {
 			writeError(w, http.StatusForbidden, "FORBIDDEN", "You are not a member of this workspace")
 		case errors.Is(err, service.ErrChannelNameTaken):
 			writeError(w, http.StatusConflict, "NAME_TAKEN", "Channel name already exists in this workspace")
+		case errors.Is(err, service.ErrTwoFactorRequired), errors.Is(err, service.ErrSSORequired):
+			writeSignInPolicy(w, err)
 		default:
-			log.Printf("ERROR create channel: %v", err)
+			slog.ErrorContext(r.Context(), "create channel", "err", err)
 			writeError(w, http.StatusInternalServerError, "INTERNAL", "Something went wrong")
 		}
 		return
@@ -65,22 +66,24 @@ func (h *ChannelHandler) List(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	channels, err := h.channelService.ListByWorkspace(r.Context(), userID, workspaceID)
+	includeArchived := r.URL.Query().Get("include_archived") == "true"
+	resp, err := h.channelService.ListByWorkspace(r.Context(), userID, workspaceID, includeArchived, pageInput(r))
 	if err != nil {
-		if errors.Is(err, service.ErrNotMember) {
+		switch {
+		case errors.Is(err, service.ErrInvalidCursor):
+			writeInvalidCursor(w)
+		case errors.Is(err, service.ErrNotMember):
 			writeError(w, http.StatusForbidden, "FORBIDDEN", "You are not a member of this workspace")
-		} else {
-			log.Printf("ERROR list channels: %v", err)
+		case errors.Is(err, service.ErrTwoFactorRequired), errors.Is(err, service.ErrSSORequired):
+			writeSignInPolicy(w, err)
+		default:
+			slog.ErrorContext(r.Context(), "list channels", "err", err)
 			writeError(w, http.StatusInternalServerError, "INTERNAL", "Something went wrong")
 		}
 		return
 	}
 
-	if channels == nil {
-		channels = []domain.Channel{}
-	}
-
-	writeJSON(w, http.StatusOK, channels)
+	writeJSON(w, http.StatusOK, resp)
 }
 
 func (h *ChannelHandler) Get(w http.ResponseWriter, r *http.Request) {
@@ -98,8 +101,10 @@ func (h *ChannelHandler) Get(w http.ResponseWriter, r *http.Request) {
 			writeError(w, http.StatusNotFound, "NOT_FOUND", "Channel not found")
 		case errors.Is(err, service.ErrNotMember), errors.Is(err, service.ErrNotChannelMember):
 			writeError(w, http.StatusForbidden, "FORBIDDEN", "You do not have access to this channel")
+		case errors.Is(err, service.ErrTwoFactorRequired), errors.Is(err, service.ErrSSORequired):
+			writeSignInPolicy(w, err)
 		default:
-			log.Printf("ERROR get channel: %v", err)
+			slog.ErrorContext(r.Context(), "get channel", "err", err)
 			writeError(w, http.StatusInternalServerError, "INTERNAL", "Something went wrong")
 		}
 		return
@@ -122,6 +127,11 @@ func (h *ChannelHandler) Update(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if errs := validator.ValidateChannelUpdate(input.PostingPolicy, input.SlowModeSeconds); errs.HasErrors() {
+		writeValidationErrors(w, errs)
+		return
+	}
+
 	ch, err := h.channelService.Update(r.Context(), userID, channelID, input)
 	if err != nil {
 		switch {
@@ -131,8 +141,12 @@ func (h *ChannelHandler) Update(w http.ResponseWriter, r *http.Request) {
 			writeError(w, http.StatusForbidden, "FORBIDDEN", "Only channel admin can update it")
 		case errors.Is(err, service.ErrChannelNameTaken):
 			writeError(w, http.StatusConflict, "NAME_TAKEN", "Channel name already exists")
+		case errors.Is(err, service.ErrChannelArchived):
+			writeError(w, http.StatusConflict, "CHANNEL_ARCHIVED", "Channel is archived")
+		case errors.Is(err, service.ErrTwoFactorRequired), errors.Is(err, service.ErrSSORequired):
+			writeSignInPolicy(w, err)
 		default:
-			log.Printf("ERROR update channel: %v", err)
+			slog.ErrorContext(r.Context(), "update channel", "err", err)
 			writeError(w, http.StatusInternalServerError, "INTERNAL", "Something went wrong")
 		}
 		return
@@ -155,8 +169,10 @@ func (h *ChannelHandler) Archive(w http.ResponseWriter, r *http.Request) {
 			writeError(w, http.StatusNotFound, "NOT_FOUND", "Channel not found")
 		case errors.Is(err, service.ErrNotChannelAdmin):
 			writeError(w, http.StatusForbidden, "FORBIDDEN", "Only workspace owner or channel creator can archive")
+		case errors.Is(err, service.ErrTwoFactorRequired), errors.Is(err, service.ErrSSORequired):
+			writeSignInPolicy(w, err)
 		default:
-			log.Printf("ERROR archive channel: %v", err)
+			slog.ErrorContext(r.Context(), "archive channel", "err", err)
 			writeError(w, http.StatusInternalServerError, "INTERNAL", "Something went wrong")
 		}
 		return
@@ -165,6 +181,33 @@ func (h *ChannelHandler) Archive(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusNoContent)
 }
 
+func (h *ChannelHandler) Unarchive(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserID(r.Context())
+	channelID, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "INVALID_ID", "Invalid channel ID")
+		return
+	}
+
+	ch, err := h.channelService.Unarchive(r.Context(), userID, channelID)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrChannelNotFound):
+			writeError(w, http.StatusNotFound, "NOT_FOUND", "Channel not found")
+		case errors.Is(err, service.ErrNotChannelAdmin):
+			writeError(w, http.StatusForbidden, "FORBIDDEN", "Only workspace owner or channel creator can unarchive")
+		case errors.Is(err, service.ErrTwoFactorRequired), errors.Is(err, service.ErrSSORequired):
+			writeSignInPolicy(w, err)
+		default:
+			slog.ErrorContext(r.Context(), "unarchive channel", "err", err)
+			writeError(w, http.StatusInternalServerError, "INTERNAL", "Something went wrong")
+		}
+		return
+	}
+
+	writeJSON(w, http.StatusOK, ch)
+}
+
 func (h *ChannelHandler) Join(w http.ResponseWriter, r *http.Request) {
 	userID := middleware.GetUserID(r.Context())
 	channelID, err := uuid.Parse(r.PathValue("id"))
@@ -179,8 +222,10 @@ func (h *ChannelHandler) Join(w http.ResponseWriter, r *http.Request) {
 			writeError(w, http.StatusForbidden, "FORBIDDEN", "You are not a member of this workspace")
 		case errors.Is(err, service.ErrAlreadyMember):
 			writeError(w, http.StatusConflict, "ALREADY_MEMBER", "You are already a member of this channel")
+		case errors.Is(err, service.ErrTwoFactorRequired), errors.Is(err, service.ErrSSORequired):
+			writeSignInPolicy(w, err)
 		default:
-			log.Printf("ERROR join channel: %v", err)
+			slog.ErrorContext(r.Context(), "join channel", "err", err)
 			writeError(w, http.StatusInternalServerError, "INTERNAL", "Something went wrong")
 		}
 		return
@@ -217,8 +262,10 @@ func (h *ChannelHandler) AddMember(w http.ResponseWriter, r *http.Request) {
 			writeError(w, http.StatusForbidden, "FORBIDDEN", "Only channel admin can add members")
 		case errors.Is(err, service.ErrAlreadyMember):
 			writeError(w, http.StatusConflict, "ALREADY_MEMBER", "User is already a member")
+		case errors.Is(err, service.ErrTwoFactorRequired), errors.Is(err, service.ErrSSORequired):
+			writeSignInPolicy(w, err)
 		default:
-			log.Printf("ERROR add channel member: %v", err)
+			slog.ErrorContext(r.Context(), "add channel member", "err", err)
 			writeError(w, http.StatusInternalServerError, "INTERNAL", "Something went wrong")
 		}
 		return
@@ -245,8 +292,10 @@ func (h *ChannelHandler) RemoveMember(w http.ResponseWriter, r *http.Request) {
 		switch {
 		case errors.Is(err, service.ErrNotChannelAdmin):
 			writeError(w, http.StatusForbidden, "FORBIDDEN", "Only channel admin can remove members")
+		case errors.Is(err, service.ErrTwoFactorRequired), errors.Is(err, service.ErrSSORequired):
+			writeSignInPolicy(w, err)
 		default:
-			log.Printf("ERROR remove channel member: %v", err)
+			slog.ErrorContext(r.Context(), "remove channel member", "err", err)
 			writeError(w, http.StatusInternalServerError, "INTERNAL", "Something went wrong")
 		}
 		return
@@ -255,6 +304,125 @@ func (h *ChannelHandler) RemoveMember(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusNoContent)
 }
 
+func (h *ChannelHandler) SetMemberRole(w http.ResponseWriter, r *http.Request) {
+	requesterID := middleware.GetUserID(r.Context())
+	channelID, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "INVALID_ID", "Invalid channel ID")
+		return
+	}
+
+	targetID, err := uuid.Parse(r.PathValue("uid"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "INVALID_ID", "Invalid user ID")
+		return
+	}
+
+	var input struct {
+		Role string `json:"role"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		writeError(w, http.StatusBadRequest, "INVALID_JSON", "Invalid request body")
+		return
+	}
+
+	if err := h.channelService.SetMemberRole(r.Context(), requesterID, channelID, targetID, input.Role); err != nil {
+		switch {
+		case errors.Is(err, service.ErrInvalidChannelRole):
+			writeError(w, http.StatusBadRequest, "INVALID_ROLE", err.Error())
+		case errors.Is(err, service.ErrChannelNotFound):
+			writeError(w, http.StatusNotFound, "NOT_FOUND", "Channel not found")
+		case errors.Is(err, service.ErrNotChannelMember):
+			writeError(w, http.StatusNotFound, "NOT_FOUND", "User is not a member of this channel")
+		case errors.Is(err, service.ErrNotChannelAdmin):
+			writeError(w, http.StatusForbidden, "FORBIDDEN", "Only channel or workspace admins can change roles")
+		case errors.Is(err, service.ErrLastChannelAdmin):
+			writeError(w, http.StatusConflict, "LAST_ADMIN", err.Error())
+		case errors.Is(err, service.ErrChannelArchived):
+			writeError(w, http.StatusConflict, "CHANNEL_ARCHIVED", "Channel is archived")
+		case errors.Is(err, service.ErrTwoFactorRequired), errors.Is(err, service.ErrSSORequired):
+			writeSignInPolicy(w, err)
+		default:
+			slog.ErrorContext(r.Context(), "set channel member role", "err", err)
+			writeError(w, http.StatusInternalServerError, "INTERNAL", "Something went wrong")
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *ChannelHandler) SetTopic(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserID(r.Context())
+	channelID, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "INVALID_ID", "Invalid channel ID")
+		return
+	}
+
+	var input struct {
+		Topic string `json:"topic"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		writeError(w, http.StatusBadRequest, "INVALID_JSON", "Invalid request body")
+		return
+	}
+
+	if errs := validator.ValidateChannelTopic(input.Topic); errs.HasErrors() {
+		writeValidationErrors(w, errs)
+		return
+	}
+
+	ch, err := h.channelService.SetTopic(r.Context(), userID, channelID, input.Topic)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrChannelNotFound):
+			writeError(w, http.StatusNotFound, "NOT_FOUND", "Channel not found")
+		case errors.Is(err, service.ErrNotMember), errors.Is(err, service.ErrNotChannelMember):
+			writeError(w, http.StatusForbidden, "FORBIDDEN", "You do not have access")
+		case errors.Is(err, service.ErrChannelReadOnly):
+			writeError(w, http.StatusForbidden, "CHANNEL_READ_ONLY", "Only channel admins can change the topic of this channel")
+		case errors.Is(err, service.ErrChannelArchived):
+			writeError(w, http.StatusConflict, "CHANNEL_ARCHIVED", "Channel is archived")
+		case errors.Is(err, service.ErrTwoFactorRequired), errors.Is(err, service.ErrSSORequired):
+			writeSignInPolicy(w, err)
+		default:
+			slog.ErrorContext(r.Context(), "set channel topic", "err", err)
+			writeError(w, http.StatusInternalServerError, "INTERNAL", "Something went wrong")
+		}
+		return
+	}
+
+	writeJSON(w, http.StatusOK, ch)
+}
+
+func (h *ChannelHandler) TopicHistory(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserID(r.Context())
+	channelID, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "INVALID_ID", "Invalid channel ID")
+		return
+	}
+
+	changes, err := h.channelService.TopicHistory(r.Context(), userID, channelID)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrChannelNotFound):
+			writeError(w, http.StatusNotFound, "NOT_FOUND", "Channel not found")
+		case errors.Is(err, service.ErrNotMember), errors.Is(err, service.ErrNotChannelMember):
+			writeError(w, http.StatusForbidden, "FORBIDDEN", "You do not have access")
+		case errors.Is(err, service.ErrTwoFactorRequired), errors.Is(err, service.ErrSSORequired):
+			writeSignInPolicy(w, err)
+		default:
+			slog.ErrorContext(r.Context(), "list channel topic history", "err", err)
+			writeError(w, http.StatusInternalServerError, "INTERNAL", "Something went wrong")
+		}
+		return
+	}
+
+	writeJSON(w, http.StatusOK, changes)
+}
+
 func (h *ChannelHandler) ListMembers(w http.ResponseWriter, r *http.Request) {
 	userID := middleware.GetUserID(r.Context())
 	channelID, err := uuid.Parse(r.PathValue("id"))
@@ -267,8 +435,10 @@ func (h *ChannelHandler) ListMembers(w http.ResponseWriter, r *http.Request) {
 	if err != nil {
 		if errors.Is(err, service.ErrNotMember) {
 			writeError(w, http.StatusForbidden, "FORBIDDEN", "You do not have access")
+		} else if errors.Is(err, service.ErrTwoFactorRequired) || errors.Is(err, service.ErrSSORequired) {
+			writeSignInPolicy(w, err)
 		} else {
-			log.Printf("ERROR list channel members: %v", err)
+			slog.ErrorContext(r.Context(), "list channel members", "err", err)
 			writeError(w, http.StatusInternalServerError, "INTERNAL", "Something went wrong")
 		}
 		return
@@ -276,3 +446,154 @@ func (h *ChannelHandler) ListMembers(w http.ResponseWriter, r *http.Request) {
 
 	writeJSON(w, http.StatusOK, members)
 }
+
+func (h *ChannelHandler) ListBookmarks(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserID(r.Context())
+	channelID, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "INVALID_ID", "Invalid channel ID")
+		return
+	}
+
+	bookmarks, err := h.channelService.ListBookmarks(r.Context(), userID, channelID)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrChannelNotFound):
+			writeError(w, http.StatusNotFound, "NOT_FOUND", "Channel not found")
+		case errors.Is(err, service.ErrNotMember), errors.Is(err, service.ErrNotChannelMember):
+			writeError(w, http.StatusForbidden, "FORBIDDEN", "You do not have access to this channel")
+		case errors.Is(err, service.ErrTwoFactorRequired), errors.Is(err, service.ErrSSORequired):
+			writeSignInPolicy(w, err)
+		default:
+			slog.ErrorContext(r.Context(), "list bookmarks", "err", err)
+			writeError(w, http.StatusInternalServerError, "INTERNAL", "Something went wrong")
+		}
+		return
+	}
+
+	writeJSON(w, http.StatusOK, bookmarks)
+}
+
+func (h *ChannelHandler) AddBookmark(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserID(r.Context())
+	channelID, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "INVALID_ID", "Invalid channel ID")
+		return
+	}
+
+	var input service.BookmarkInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		writeError(w, http.StatusBadRequest, "INVALID_JSON", "Invalid request body")
+		return
+	}
+
+	if errs := validator.ValidateBookmark(input.Title, input.URL); errs.HasErrors() {
+		writeValidationErrors(w, errs)
+		return
+	}
+
+	b, err := h.channelService.AddBookmark(r.Context(), userID, channelID, input)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrChannelNotFound):
+			writeError(w, http.StatusNotFound, "NOT_FOUND", "Channel not found")
+		case errors.Is(err, service.ErrNotChannelAdmin):
+			writeError(w, http.StatusForbidden, "FORBIDDEN", "Only channel or workspace admins can manage bookmarks")
+		case errors.Is(err, service.ErrBookmarkLimitReached):
+			writeError(w, http.StatusConflict, "BOOKMARK_LIMIT", err.Error())
+		case errors.Is(err, service.ErrChannelArchived):
+			writeError(w, http.StatusConflict, "CHANNEL_ARCHIVED", "Channel is archived")
+		case errors.Is(err, service.ErrTwoFactorRequired), errors.Is(err, service.ErrSSORequired):
+			writeSignInPolicy(w, err)
+		default:
+			slog.ErrorContext(r.Context(), "add bookmark", "err", err)
+			writeError(w, http.StatusInternalServerError, "INTERNAL", "Something went wrong")
+		}
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, b)
+}
+
+func (h *ChannelHandler) UpdateBookmark(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserID(r.Context())
+	channelID, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "INVALID_ID", "Invalid channel ID")
+		return
+	}
+	bookmarkID, err := uuid.Parse(r.PathValue("bid"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "INVALID_ID", "Invalid bookmark ID")
+		return
+	}
+
+	var input service.BookmarkInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		writeError(w, http.StatusBadRequest, "INVALID_JSON", "Invalid request body")
+		return
+	}
+
+	if errs := validator.ValidateBookmark(input.Title, input.URL); errs.HasErrors() {
+		writeValidationErrors(w, errs)
+		return
+	}
+
+	b, err := h.channelService.UpdateBookmark(r.Context(), userID, channelID, bookmarkID, input)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrChannelNotFound):
+			writeError(w, http.StatusNotFound, "NOT_FOUND", "Channel not found")
+		case errors.Is(err, service.ErrBookmarkNotFound):
+			writeError(w, http.StatusNotFound, "NOT_FOUND", "Bookmark not found")
+		case errors.Is(err, service.ErrNotChannelAdmin):
+			writeError(w, http.StatusForbidden, "FORBIDDEN", "Only channel or workspace admins can manage bookmarks")
+		case errors.Is(err, service.ErrChannelArchived):
+			writeError(w, http.StatusConflict, "CHANNEL_ARCHIVED", "Channel is archived")
+		case errors.Is(err, service.ErrTwoFactorRequired), errors.Is(err, service.ErrSSORequired):
+			writeSignInPolicy(w, err)
+		default:
+			slog.ErrorContext(r.Context(), "update bookmark", "err", err)
+			writeError(w, http.StatusInternalServerError, "INTERNAL", "Something went wrong")
+		}
+		return
+	}
+
+	writeJSON(w, http.StatusOK, b)
+}
+
+func (h *ChannelHandler) RemoveBookmark(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserID(r.Context())
+	channelID, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "INVALID_ID", "Invalid channel ID")
+		return
+	}
+	bookmarkID, err := uuid.Parse(r.PathValue("bid"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "INVALID_ID", "Invalid bookmark ID")
+		return
+	}
+
+	if err := h.channelService.RemoveBookmark(r.Context(), userID, channelID, bookmarkID); err != nil {
+		switch {
+		case errors.Is(err, service.ErrChannelNotFound):
+			writeError(w, http.StatusNotFound, "NOT_FOUND", "Channel not found")
+		case errors.Is(err, service.ErrBookmarkNotFound):
+			writeError(w, http.StatusNotFound, "NOT_FOUND", "Bookmark not found")
+		case errors.Is(err, service.ErrNotChannelAdmin):
+			writeError(w, http.StatusForbidden, "FORBIDDEN", "Only channel or workspace admins can manage bookmarks")
+		case errors.Is(err, service.ErrChannelArchived):
+			writeError(w, http.StatusConflict, "CHANNEL_ARCHIVED", "Channel is archived")
+		case errors.Is(err, service.ErrTwoFactorRequired), errors.Is(err, service.ErrSSORequired):
+			writeSignInPolicy(w, err)
+		default:
+			slog.ErrorContext(r.Context(), "remove bookmark", "err", err)
+			writeError(w, http.StatusInternalServerError, "INTERNAL", "Something went wrong")
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
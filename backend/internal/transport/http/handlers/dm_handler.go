@@ -1,11 +1,12 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
-	"log"
+	"log/slog"
 	"net/http"
-	"strconv"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/vedran77/pulse/internal/service"
@@ -13,11 +14,12 @@ import (
 )
 
 type DMHandler struct {
-	dmService *service.DMService
+	dmService        *service.DMService
+	scheduledService *service.ScheduledService
 }
 
-func NewDMHandler(dmService *service.DMService) *DMHandler {
-	return &DMHandler{dmService: dmService}
+func NewDMHandler(dmService *service.DMService, scheduledService *service.ScheduledService) *DMHandler {
+	return &DMHandler{dmService: dmService, scheduledService: scheduledService}
 }
 
 func (h *DMHandler) GetOrCreateConversation(w http.ResponseWriter, r *http.Request) {
@@ -43,7 +45,7 @@ func (h *DMHandler) GetOrCreateConversation(w http.ResponseWriter, r *http.Reque
 		case errors.Is(err, service.ErrUserNotFound):
 			writeError(w, http.StatusNotFound, "NOT_FOUND", "User not found")
 		default:
-			log.Printf("ERROR get or create dm: %v", err)
+			slog.ErrorContext(r.Context(), "get or create dm", "err", err)
 			writeError(w, http.StatusInternalServerError, "INTERNAL", "Something went wrong")
 		}
 		return
@@ -55,14 +57,18 @@ func (h *DMHandler) GetOrCreateConversation(w http.ResponseWriter, r *http.Reque
 func (h *DMHandler) ListConversations(w http.ResponseWriter, r *http.Request) {
 	userID := middleware.GetUserID(r.Context())
 
-	convs, err := h.dmService.ListConversations(r.Context(), userID)
+	resp, err := h.dmService.ListConversations(r.Context(), userID, pageInput(r))
 	if err != nil {
-		log.Printf("ERROR list dm conversations: %v", err)
-		writeError(w, http.StatusInternalServerError, "INTERNAL", "Something went wrong")
+		if errors.Is(err, service.ErrInvalidCursor) {
+			writeInvalidCursor(w)
+		} else {
+			slog.ErrorContext(r.Context(), "list dm conversations", "err", err)
+			writeError(w, http.StatusInternalServerError, "INTERNAL", "Something went wrong")
+		}
 		return
 	}
 
-	writeJSON(w, http.StatusOK, convs)
+	writeJSON(w, http.StatusOK, resp)
 }
 
 func (h *DMHandler) SendMessage(w http.ResponseWriter, r *http.Request) {
@@ -75,6 +81,8 @@ func (h *DMHandler) SendMessage(w http.ResponseWriter, r *http.Request) {
 
 	var input struct {
 		Content string `json:"content"`
+		// Queues the message instead of sending it now
+		SendAt *time.Time `json:"send_at"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
 		writeError(w, http.StatusBadRequest, "INVALID_JSON", "Invalid request body")
@@ -85,20 +93,39 @@ func (h *DMHandler) SendMessage(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	msg, err := h.dmService.SendMessage(r.Context(), userID, convID, input.Content)
+	var msg any
+	if input.SendAt != nil {
+		msg, err = h.scheduledService.ScheduleDM(r.Context(), userID, convID, input.Content, *input.SendAt)
+	} else {
+		msg, err = h.dmService.SendMessage(r.Context(), userID, convID, input.Content)
+	}
 	if err != nil {
 		switch {
+		case errors.Is(err, service.ErrInvalidSendTime):
+			writeError(w, http.StatusBadRequest, "INVALID_SEND_TIME", err.Error())
+		case errors.Is(err, service.ErrTooManyScheduled):
+			writeError(w, http.StatusConflict, "TOO_MANY_SCHEDULED", err.Error())
+		case errors.Is(err, service.ErrEmptyContent):
+			writeError(w, http.StatusBadRequest, "MISSING_CONTENT", "Message content is required")
+		case errors.Is(err, service.ErrContentTooLong):
+			writeError(w, http.StatusBadRequest, "CONTENT_TOO_LONG", "Message content is too long")
+		case errors.Is(err, service.ErrInvalidContent):
+			writeError(w, http.StatusBadRequest, "INVALID_CONTENT", "Message content contains control characters")
 		case errors.Is(err, service.ErrDMConversationNotFound):
 			writeError(w, http.StatusNotFound, "NOT_FOUND", "Conversation not found")
 		case errors.Is(err, service.ErrDMNotParticipant):
 			writeError(w, http.StatusForbidden, "FORBIDDEN", "You are not a participant of this conversation")
 		default:
-			log.Printf("ERROR send dm message: %v", err)
+			slog.ErrorContext(r.Context(), "send dm message", "err", err)
 			writeError(w, http.StatusInternalServerError, "INTERNAL", "Something went wrong")
 		}
 		return
 	}
 
+	if input.SendAt != nil {
+		writeJSON(w, http.StatusAccepted, msg)
+		return
+	}
 	writeJSON(w, http.StatusCreated, msg)
 }
 
@@ -110,32 +137,24 @@ func (h *DMHandler) ListMessages(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var before *uuid.UUID
-	if beforeStr := r.URL.Query().Get("before"); beforeStr != "" {
-		id, err := uuid.Parse(beforeStr)
-		if err != nil {
-			writeError(w, http.StatusBadRequest, "INVALID_ID", "Invalid before cursor")
-			return
-		}
-		before = &id
-	}
-
-	limit := 50
-	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
-		if l, err := strconv.Atoi(limitStr); err == nil && l > 0 && l <= 100 {
-			limit = l
-		}
+	around, ok := aroundParam(w, r)
+	if !ok {
+		return
 	}
 
-	resp, err := h.dmService.ListMessages(r.Context(), userID, convID, before, limit)
+	resp, err := h.dmService.ListMessages(r.Context(), userID, convID, pageInput(r), around)
 	if err != nil {
 		switch {
+		case errors.Is(err, service.ErrInvalidCursor):
+			writeInvalidCursor(w)
+		case errors.Is(err, service.ErrDMMessageNotFound):
+			writeError(w, http.StatusNotFound, "NOT_FOUND", "Message not found")
 		case errors.Is(err, service.ErrDMConversationNotFound):
 			writeError(w, http.StatusNotFound, "NOT_FOUND", "Conversation not found")
 		case errors.Is(err, service.ErrDMNotParticipant):
 			writeError(w, http.StatusForbidden, "FORBIDDEN", "You are not a participant of this conversation")
 		default:
-			log.Printf("ERROR list dm messages: %v", err)
+			slog.ErrorContext(r.Context(), "list dm messages", "err", err)
 			writeError(w, http.StatusInternalServerError, "INTERNAL", "Something went wrong")
 		}
 		return
@@ -167,12 +186,18 @@ func (h *DMHandler) EditMessage(w http.ResponseWriter, r *http.Request) {
 	msg, err := h.dmService.EditMessage(r.Context(), userID, messageID, input.Content)
 	if err != nil {
 		switch {
+		case errors.Is(err, service.ErrEmptyContent):
+			writeError(w, http.StatusBadRequest, "MISSING_CONTENT", "Message content is required")
+		case errors.Is(err, service.ErrContentTooLong):
+			writeError(w, http.StatusBadRequest, "CONTENT_TOO_LONG", "Message content is too long")
+		case errors.Is(err, service.ErrInvalidContent):
+			writeError(w, http.StatusBadRequest, "INVALID_CONTENT", "Message content contains control characters")
 		case errors.Is(err, service.ErrDMMessageNotFound):
 			writeError(w, http.StatusNotFound, "NOT_FOUND", "Message not found")
 		case errors.Is(err, service.ErrNotDMMessageOwner):
 			writeError(w, http.StatusForbidden, "FORBIDDEN", "You can only edit your own messages")
 		default:
-			log.Printf("ERROR edit dm message: %v", err)
+			slog.ErrorContext(r.Context(), "edit dm message", "err", err)
 			writeError(w, http.StatusInternalServerError, "INTERNAL", "Something went wrong")
 		}
 		return
@@ -196,7 +221,52 @@ func (h *DMHandler) DeleteMessage(w http.ResponseWriter, r *http.Request) {
 		case errors.Is(err, service.ErrNotDMMessageOwner):
 			writeError(w, http.StatusForbidden, "FORBIDDEN", "You can only delete your own messages")
 		default:
-			log.Printf("ERROR delete dm message: %v", err)
+			slog.ErrorContext(r.Context(), "delete dm message", "err", err)
+			writeError(w, http.StatusInternalServerError, "INTERNAL", "Something went wrong")
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *DMHandler) HideConversation(w http.ResponseWriter, r *http.Request) {
+	h.updateConversation(w, r, "hide dm conversation", h.dmService.HideConversation)
+}
+
+func (h *DMHandler) MuteConversation(w http.ResponseWriter, r *http.Request) {
+	h.updateConversation(w, r, "mute dm conversation", func(ctx context.Context, userID, convID uuid.UUID) error {
+		return h.dmService.SetMuted(ctx, userID, convID, true)
+	})
+}
+
+func (h *DMHandler) UnmuteConversation(w http.ResponseWriter, r *http.Request) {
+	h.updateConversation(w, r, "unmute dm conversation", func(ctx context.Context, userID, convID uuid.UUID) error {
+		return h.dmService.SetMuted(ctx, userID, convID, false)
+	})
+}
+
+func (h *DMHandler) MarkRead(w http.ResponseWriter, r *http.Request) {
+	h.updateConversation(w, r, "mark dm conversation read", h.dmService.MarkRead)
+}
+
+// updateConversation applies one of the user's per-conversation settings.
+func (h *DMHandler) updateConversation(w http.ResponseWriter, r *http.Request, action string, update func(ctx context.Context, userID, convID uuid.UUID) error) {
+	userID := middleware.GetUserID(r.Context())
+	convID, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "INVALID_ID", "Invalid conversation ID")
+		return
+	}
+
+	if err := update(r.Context(), userID, convID); err != nil {
+		switch {
+		case errors.Is(err, service.ErrDMConversationNotFound):
+			writeError(w, http.StatusNotFound, "NOT_FOUND", "Conversation not found")
+		case errors.Is(err, service.ErrDMNotParticipant):
+			writeError(w, http.StatusForbidden, "FORBIDDEN", "You are not a participant of this conversation")
+		default:
+			slog.ErrorContext(r.Context(), action, "err", err)
 			writeError(w, http.StatusInternalServerError, "INTERNAL", "Something went wrong")
 		}
 		return
@@ -3,9 +3,11 @@ package handlers
 import (
 	"encoding/json"
 	"errors"
-	"log"
+	"log/slog"
+	"math"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/vedran77/pulse/internal/service"
@@ -13,11 +15,12 @@ import (
 )
 
 type MessageHandler struct {
-	messageService *service.MessageService
+	messageService   *service.MessageService
+	scheduledService *service.ScheduledService
 }
 
-func NewMessageHandler(messageService *service.MessageService) *MessageHandler {
-	return &MessageHandler{messageService: messageService}
+func NewMessageHandler(messageService *service.MessageService, scheduledService *service.ScheduledService) *MessageHandler {
+	return &MessageHandler{messageService: messageService, scheduledService: scheduledService}
 }
 
 func (h *MessageHandler) Send(w http.ResponseWriter, r *http.Request) {
@@ -28,7 +31,11 @@ func (h *MessageHandler) Send(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var input service.SendMessageInput
+	var input struct {
+		service.SendMessageInput
+		// Queues the message instead of sending it now
+		SendAt *time.Time `json:"send_at"`
+	}
 	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
 		writeError(w, http.StatusBadRequest, "INVALID_JSON", "Invalid request body")
 		return
@@ -39,23 +46,59 @@ func (h *MessageHandler) Send(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	msg, err := h.messageService.Send(r.Context(), userID, channelID, input)
+	var msg any
+	if input.SendAt != nil {
+		msg, err = h.scheduledService.ScheduleMessage(r.Context(), userID, channelID, input.SendMessageInput, *input.SendAt)
+	} else {
+		msg, err = h.messageService.Send(r.Context(), userID, channelID, input.SendMessageInput)
+	}
 	if err != nil {
 		switch {
+		case errors.Is(err, service.ErrInvalidSendTime):
+			writeError(w, http.StatusBadRequest, "INVALID_SEND_TIME", err.Error())
+		case errors.Is(err, service.ErrTooManyScheduled):
+			writeError(w, http.StatusConflict, "TOO_MANY_SCHEDULED", err.Error())
+		case errors.Is(err, service.ErrEmptyContent):
+			writeError(w, http.StatusBadRequest, "MISSING_CONTENT", "Message content is required")
+		case errors.Is(err, service.ErrContentTooLong):
+			writeError(w, http.StatusBadRequest, "CONTENT_TOO_LONG", "Message content is too long")
+		case errors.Is(err, service.ErrInvalidContent):
+			writeError(w, http.StatusBadRequest, "INVALID_CONTENT", "Message content contains control characters")
 		case errors.Is(err, service.ErrChannelNotFound):
 			writeError(w, http.StatusNotFound, "NOT_FOUND", "Channel not found")
 		case errors.Is(err, service.ErrNotMember), errors.Is(err, service.ErrNotChannelMember):
 			writeError(w, http.StatusForbidden, "FORBIDDEN", "You do not have access to this channel")
+		case errors.Is(err, service.ErrChannelReadOnly):
+			writeError(w, http.StatusForbidden, "CHANNEL_READ_ONLY", "Only channel admins can post in this channel")
+		case errors.Is(err, service.ErrSlowMode):
+			writeSlowMode(w, err)
+		case errors.Is(err, service.ErrChannelArchived):
+			writeError(w, http.StatusConflict, "CHANNEL_ARCHIVED", "Channel is archived")
+		case errors.Is(err, service.ErrTwoFactorRequired), errors.Is(err, service.ErrSSORequired):
+			writeSignInPolicy(w, err)
 		default:
-			log.Printf("ERROR send message: %v", err)
+			slog.ErrorContext(r.Context(), "send message", "err", err)
 			writeError(w, http.StatusInternalServerError, "INTERNAL", "Something went wrong")
 		}
 		return
 	}
 
+	if input.SendAt != nil {
+		writeJSON(w, http.StatusAccepted, msg)
+		return
+	}
 	writeJSON(w, http.StatusCreated, msg)
 }
 
+func writeSlowMode(w http.ResponseWriter, err error) {
+	var slow *service.SlowModeError
+	if errors.As(err, &slow) {
+		retry := int(math.Ceil(time.Until(slow.Until).Seconds()))
+		w.Header().Set("Retry-After", strconv.Itoa(max(retry, 1)))
+	}
+	writeError(w, http.StatusTooManyRequests, "SLOW_MODE", "Slow mode is on, wait before posting again")
+}
+
 func (h *MessageHandler) List(w http.ResponseWriter, r *http.Request) {
 	userID := middleware.GetUserID(r.Context())
 	channelID, err := uuid.Parse(r.PathValue("id"))
@@ -64,33 +107,26 @@ func (h *MessageHandler) List(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Parse query params
-	var before *uuid.UUID
-	if beforeStr := r.URL.Query().Get("before"); beforeStr != "" {
-		id, err := uuid.Parse(beforeStr)
-		if err != nil {
-			writeError(w, http.StatusBadRequest, "INVALID_ID", "Invalid before cursor")
-			return
-		}
-		before = &id
-	}
-
-	limit := 50
-	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
-		if l, err := strconv.Atoi(limitStr); err == nil && l > 0 && l <= 100 {
-			limit = l
-		}
+	around, ok := aroundParam(w, r)
+	if !ok {
+		return
 	}
 
-	resp, err := h.messageService.List(r.Context(), userID, channelID, before, limit)
+	resp, err := h.messageService.List(r.Context(), userID, channelID, pageInput(r), around)
 	if err != nil {
 		switch {
+		case errors.Is(err, service.ErrInvalidCursor):
+			writeInvalidCursor(w)
+		case errors.Is(err, service.ErrMessageNotFound):
+			writeError(w, http.StatusNotFound, "NOT_FOUND", "Message not found")
 		case errors.Is(err, service.ErrChannelNotFound):
 			writeError(w, http.StatusNotFound, "NOT_FOUND", "Channel not found")
 		case errors.Is(err, service.ErrNotMember), errors.Is(err, service.ErrNotChannelMember):
 			writeError(w, http.StatusForbidden, "FORBIDDEN", "You do not have access to this channel")
+		case errors.Is(err, service.ErrTwoFactorRequired), errors.Is(err, service.ErrSSORequired):
+			writeSignInPolicy(w, err)
 		default:
-			log.Printf("ERROR list messages: %v", err)
+			slog.ErrorContext(r.Context(), "list messages", "err", err)
 			writeError(w, http.StatusInternalServerError, "INTERNAL", "Something went wrong")
 		}
 		return
@@ -99,6 +135,21 @@ func (h *MessageHandler) List(w http.ResponseWriter, r *http.Request) {
 	writeJSON(w, http.StatusOK, resp)
 }
 
+// aroundParam reads the ID of the message a page should be centred on, if
+// any. It writes the error response and returns false if it's invalid.
+func aroundParam(w http.ResponseWriter, r *http.Request) (*uuid.UUID, bool) {
+	s := r.URL.Query().Get("around")
+	if s == "" {
+		return nil, true
+	}
+	id, err := uuid.Parse(s)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "INVALID_ID", "Invalid around message ID")
+		return nil, false
+	}
+	return &id, true
+}
+
 func (h *MessageHandler) Edit(w http.ResponseWriter, r *http.Request) {
 	userID := middleware.GetUserID(r.Context())
 	messageID, err := uuid.Parse(r.PathValue("id"))
@@ -121,12 +172,22 @@ func (h *MessageHandler) Edit(w http.ResponseWriter, r *http.Request) {
 	msg, err := h.messageService.Edit(r.Context(), userID, messageID, input)
 	if err != nil {
 		switch {
+		case errors.Is(err, service.ErrEmptyContent):
+			writeError(w, http.StatusBadRequest, "MISSING_CONTENT", "Message content is required")
+		case errors.Is(err, service.ErrContentTooLong):
+			writeError(w, http.StatusBadRequest, "CONTENT_TOO_LONG", "Message content is too long")
+		case errors.Is(err, service.ErrInvalidContent):
+			writeError(w, http.StatusBadRequest, "INVALID_CONTENT", "Message content contains control characters")
 		case errors.Is(err, service.ErrMessageNotFound):
 			writeError(w, http.StatusNotFound, "NOT_FOUND", "Message not found")
 		case errors.Is(err, service.ErrNotMessageOwner):
 			writeError(w, http.StatusForbidden, "FORBIDDEN", "You can only edit your own messages")
+		case errors.Is(err, service.ErrChannelArchived):
+			writeError(w, http.StatusConflict, "CHANNEL_ARCHIVED", "Channel is archived")
+		case errors.Is(err, service.ErrTwoFactorRequired), errors.Is(err, service.ErrSSORequired):
+			writeSignInPolicy(w, err)
 		default:
-			log.Printf("ERROR edit message: %v", err)
+			slog.ErrorContext(r.Context(), "edit message", "err", err)
 			writeError(w, http.StatusInternalServerError, "INTERNAL", "Something went wrong")
 		}
 		return
@@ -149,8 +210,71 @@ func (h *MessageHandler) Delete(w http.ResponseWriter, r *http.Request) {
 			writeError(w, http.StatusNotFound, "NOT_FOUND", "Message not found")
 		case errors.Is(err, service.ErrNotMessageOwner):
 			writeError(w, http.StatusForbidden, "FORBIDDEN", "You can only delete your own messages")
+		case errors.Is(err, service.ErrChannelArchived):
+			writeError(w, http.StatusConflict, "CHANNEL_ARCHIVED", "Channel is archived")
+		case errors.Is(err, service.ErrTwoFactorRequired), errors.Is(err, service.ErrSSORequired):
+			writeSignInPolicy(w, err)
+		default:
+			slog.ErrorContext(r.Context(), "delete message", "err", err)
+			writeError(w, http.StatusInternalServerError, "INTERNAL", "Something went wrong")
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *MessageHandler) Pin(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserID(r.Context())
+	messageID, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "INVALID_ID", "Invalid message ID")
+		return
+	}
+
+	pin, err := h.messageService.Pin(r.Context(), userID, messageID)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrMessageNotFound):
+			writeError(w, http.StatusNotFound, "NOT_FOUND", "Message not found")
+		case errors.Is(err, service.ErrNotChannelAdmin):
+			writeError(w, http.StatusForbidden, "FORBIDDEN", "Only channel or workspace admins can pin messages")
+		case errors.Is(err, service.ErrPinLimitReached):
+			writeError(w, http.StatusConflict, "PIN_LIMIT", err.Error())
+		case errors.Is(err, service.ErrChannelArchived):
+			writeError(w, http.StatusConflict, "CHANNEL_ARCHIVED", "Channel is archived")
+		case errors.Is(err, service.ErrTwoFactorRequired), errors.Is(err, service.ErrSSORequired):
+			writeSignInPolicy(w, err)
 		default:
-			log.Printf("ERROR delete message: %v", err)
+			slog.ErrorContext(r.Context(), "pin message", "err", err)
+			writeError(w, http.StatusInternalServerError, "INTERNAL", "Something went wrong")
+		}
+		return
+	}
+
+	writeJSON(w, http.StatusOK, pin)
+}
+
+func (h *MessageHandler) Unpin(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserID(r.Context())
+	messageID, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "INVALID_ID", "Invalid message ID")
+		return
+	}
+
+	if err := h.messageService.Unpin(r.Context(), userID, messageID); err != nil {
+		switch {
+		case errors.Is(err, service.ErrMessageNotFound):
+			writeError(w, http.StatusNotFound, "NOT_FOUND", "Message not found")
+		case errors.Is(err, service.ErrNotChannelAdmin):
+			writeError(w, http.StatusForbidden, "FORBIDDEN", "Only channel or workspace admins can unpin messages")
+		case errors.Is(err, service.ErrChannelArchived):
+			writeError(w, http.StatusConflict, "CHANNEL_ARCHIVED", "Channel is archived")
+		case errors.Is(err, service.ErrTwoFactorRequired), errors.Is(err, service.ErrSSORequired):
+			writeSignInPolicy(w, err)
+		default:
+			slog.ErrorContext(r.Context(), "unpin message", "err", err)
 			writeError(w, http.StatusInternalServerError, "INTERNAL", "Something went wrong")
 		}
 		return
@@ -158,3 +282,30 @@ func (h *MessageHandler) Delete(w http.ResponseWriter, r *http.Request) {
 
 	w.WriteHeader(http.StatusNoContent)
 }
+
+func (h *MessageHandler) ListPins(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserID(r.Context())
+	channelID, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "INVALID_ID", "Invalid channel ID")
+		return
+	}
+
+	pins, err := h.messageService.ListPins(r.Context(), userID, channelID)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrChannelNotFound):
+			writeError(w, http.StatusNotFound, "NOT_FOUND", "Channel not found")
+		case errors.Is(err, service.ErrNotMember), errors.Is(err, service.ErrNotChannelMember):
+			writeError(w, http.StatusForbidden, "FORBIDDEN", "You do not have access to this channel")
+		case errors.Is(err, service.ErrTwoFactorRequired), errors.Is(err, service.ErrSSORequired):
+			writeSignInPolicy(w, err)
+		default:
+			slog.ErrorContext(r.Context(), "list pins", "err", err)
+			writeError(w, http.StatusInternalServerError, "INTERNAL", "Something went wrong")
+		}
+		return
+	}
+
+	writeJSON(w, http.StatusOK, pins)
+}
@@ -0,0 +1,137 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/vedran77/pulse/internal/oidc"
+	"github.com/vedran77/pulse/internal/oidc/oidctest"
+	"github.com/vedran77/pulse/internal/repository/memory"
+	"github.com/vedran77/pulse/internal/service"
+)
+
+const (
+	testAppURL      = "https://app.example"
+	testCallbackURL = "https://pulse.example/api/v1/auth/oidc/callback"
+)
+
+func TestOIDCFlow(t *testing.T) {
+	ctx := context.Background()
+	provider, err := oidctest.NewServer("pulse", oidctest.User{
+		Subject: "sso-1", Email: "sso@example.com", EmailVerified: true, Name: "SSO User", PreferredUsername: "sso.user",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer provider.Close()
+	client, err := oidc.NewClient(ctx, oidc.Config{Issuer: provider.Issuer, ClientID: "pulse", RedirectURL: testCallbackURL})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store := memory.NewStore()
+	auth := service.NewAuthService(memory.NewUserRepo(store), memory.NewVerificationTokenRepo(store), memory.NewTwoFactorRepo(store), memory.NewIdentityRepo(store), "test-secret", "test-totp-key")
+	auth.SetOIDC(client)
+	h := NewAuthHandler(auth, testAppURL)
+
+	// login starts a login and returns the provider URL and the state cookie
+	login := func() (*url.URL, *http.Cookie) {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		h.OIDCLogin(rec, httptest.NewRequest(http.MethodGet, "/api/v1/auth/oidc/login", nil))
+		if rec.Code != http.StatusFound {
+			t.Fatalf("login status = %d", rec.Code)
+		}
+		cookies := rec.Result().Cookies()
+		if len(cookies) != 1 || cookies[0].Name != oidcStateCookie {
+			t.Fatalf("login cookies = %v", cookies)
+		}
+		authURL, err := url.Parse(rec.Header().Get("Location"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return authURL, cookies[0]
+	}
+	// authorize signs in at the provider, after tamper has had a go at the
+	// request, and returns the callback URL it redirects to
+	authorize := func(authURL *url.URL, tamper func(url.Values)) string {
+		t.Helper()
+		q := authURL.Query()
+		tamper(q)
+		authURL.RawQuery = q.Encode()
+		noRedirect := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+		resp, err := noRedirect.Get(authURL.String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusFound {
+			t.Fatalf("authorize status = %d", resp.StatusCode)
+		}
+		return resp.Header.Get("Location")
+	}
+	// callback returns where the callback sends the browser
+	callback := func(callbackURL string, cookie *http.Cookie) *url.URL {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodGet, callbackURL, nil)
+		req.AddCookie(cookie)
+		rec := httptest.NewRecorder()
+		h.OIDCCallback(rec, req)
+		if rec.Code != http.StatusFound {
+			t.Fatalf("callback status = %d", rec.Code)
+		}
+		to, err := url.Parse(rec.Header().Get("Location"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return to
+	}
+	expectError := func(to *url.URL, code string) {
+		t.Helper()
+		if to.Path != "/login" || to.Query().Get("error") != code || to.Fragment != "" {
+			t.Fatalf("redirected to %s, want the %s error", to, code)
+		}
+	}
+	unchanged := func(url.Values) {}
+
+	t.Run("success", func(t *testing.T) {
+		authURL, cookie := login()
+		callbackURL := authorize(authURL, unchanged)
+		to := callback(callbackURL, cookie)
+		fragment, _ := url.ParseQuery(to.Fragment)
+		if to.Scheme+"://"+to.Host != testAppURL || to.Path != "/auth/sso" || fragment.Get("access_token") == "" {
+			t.Fatalf("redirected to %s", to)
+		}
+
+		// The login state is single use
+		expectError(callback(callbackURL, cookie), "sso_expired")
+	})
+
+	t.Run("state mismatch", func(t *testing.T) {
+		authURL, _ := login()
+		// A callback started in another browser, e.g. login CSRF
+		_, other := login()
+		expectError(callback(authorize(authURL, unchanged), other), "sso_state_mismatch")
+	})
+
+	t.Run("nonce mismatch", func(t *testing.T) {
+		authURL, cookie := login()
+		callbackURL := authorize(authURL, func(q url.Values) { q.Set("nonce", "injected") })
+		expectError(callback(callbackURL, cookie), "sso_failed")
+	})
+
+	t.Run("pkce verifier mismatch", func(t *testing.T) {
+		authURL, cookie := login()
+		// The code is bound to another verifier's challenge, so the one the
+		// server kept doesn't redeem it
+		verifier, err := oidc.NewPKCEVerifier()
+		if err != nil {
+			t.Fatal(err)
+		}
+		callbackURL := authorize(authURL, func(q url.Values) { q.Set("code_challenge", oidc.PKCEChallenge(verifier)) })
+		expectError(callback(callbackURL, cookie), "sso_failed")
+	})
+}
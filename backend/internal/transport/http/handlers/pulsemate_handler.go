@@ -3,7 +3,7 @@ package handlers
 import (
 	"encoding/json"
 	"errors"
-	"log"
+	"log/slog"
 	"net/http"
 
 	"github.com/google/uuid"
@@ -46,7 +46,7 @@ func (h *PulsemateHandler) SendRequest(w http.ResponseWriter, r *http.Request) {
 		case errors.Is(err, service.ErrAlreadyPulsemates):
 			writeError(w, http.StatusConflict, "ALREADY_PULSEMATES", "You are already pulsemates")
 		default:
-			log.Printf("ERROR send pulsemate request: %v", err)
+			slog.ErrorContext(r.Context(), "send pulsemate request", "err", err)
 			writeError(w, http.StatusInternalServerError, "INTERNAL", "Something went wrong")
 		}
 		return
@@ -64,14 +64,18 @@ func (h *PulsemateHandler) SendRequest(w http.ResponseWriter, r *http.Request) {
 func (h *PulsemateHandler) ListPulsemates(w http.ResponseWriter, r *http.Request) {
 	userID := middleware.GetUserID(r.Context())
 
-	pms, err := h.pmService.ListPulsemates(r.Context(), userID)
+	resp, err := h.pmService.ListPulsemates(r.Context(), userID, pageInput(r))
 	if err != nil {
-		log.Printf("ERROR list pulsemates: %v", err)
-		writeError(w, http.StatusInternalServerError, "INTERNAL", "Something went wrong")
+		if errors.Is(err, service.ErrInvalidCursor) {
+			writeInvalidCursor(w)
+		} else {
+			slog.ErrorContext(r.Context(), "list pulsemates", "err", err)
+			writeError(w, http.StatusInternalServerError, "INTERNAL", "Something went wrong")
+		}
 		return
 	}
 
-	writeJSON(w, http.StatusOK, pms)
+	writeJSON(w, http.StatusOK, resp)
 }
 
 func (h *PulsemateHandler) ListIncomingRequests(w http.ResponseWriter, r *http.Request) {
@@ -79,7 +83,7 @@ func (h *PulsemateHandler) ListIncomingRequests(w http.ResponseWriter, r *http.R
 
 	reqs, err := h.pmService.ListIncomingRequests(r.Context(), userID)
 	if err != nil {
-		log.Printf("ERROR list incoming requests: %v", err)
+		slog.ErrorContext(r.Context(), "list incoming requests", "err", err)
 		writeError(w, http.StatusInternalServerError, "INTERNAL", "Something went wrong")
 		return
 	}
@@ -92,7 +96,7 @@ func (h *PulsemateHandler) ListOutgoingRequests(w http.ResponseWriter, r *http.R
 
 	reqs, err := h.pmService.ListOutgoingRequests(r.Context(), userID)
 	if err != nil {
-		log.Printf("ERROR list outgoing requests: %v", err)
+		slog.ErrorContext(r.Context(), "list outgoing requests", "err", err)
 		writeError(w, http.StatusInternalServerError, "INTERNAL", "Something went wrong")
 		return
 	}
@@ -115,7 +119,7 @@ func (h *PulsemateHandler) AcceptRequest(w http.ResponseWriter, r *http.Request)
 		case errors.Is(err, service.ErrNotRequestReceiver):
 			writeError(w, http.StatusForbidden, "FORBIDDEN", "Only the receiver can accept this request")
 		default:
-			log.Printf("ERROR accept pulsemate request: %v", err)
+			slog.ErrorContext(r.Context(), "accept pulsemate request", "err", err)
 			writeError(w, http.StatusInternalServerError, "INTERNAL", "Something went wrong")
 		}
 		return
@@ -139,7 +143,7 @@ func (h *PulsemateHandler) RejectRequest(w http.ResponseWriter, r *http.Request)
 		case errors.Is(err, service.ErrNotRequestReceiver):
 			writeError(w, http.StatusForbidden, "FORBIDDEN", "Only the receiver can reject this request")
 		default:
-			log.Printf("ERROR reject pulsemate request: %v", err)
+			slog.ErrorContext(r.Context(), "reject pulsemate request", "err", err)
 			writeError(w, http.StatusInternalServerError, "INTERNAL", "Something went wrong")
 		}
 		return
@@ -163,7 +167,7 @@ func (h *PulsemateHandler) CancelRequest(w http.ResponseWriter, r *http.Request)
 		case errors.Is(err, service.ErrNotRequestSender):
 			writeError(w, http.StatusForbidden, "FORBIDDEN", "Only the sender can cancel this request")
 		default:
-			log.Printf("ERROR cancel pulsemate request: %v", err)
+			slog.ErrorContext(r.Context(), "cancel pulsemate request", "err", err)
 			writeError(w, http.StatusInternalServerError, "INTERNAL", "Something went wrong")
 		}
 		return
@@ -181,7 +185,7 @@ func (h *PulsemateHandler) RemovePulsemate(w http.ResponseWriter, r *http.Reques
 	}
 
 	if err := h.pmService.RemovePulsemate(r.Context(), userID, otherUserID); err != nil {
-		log.Printf("ERROR remove pulsemate: %v", err)
+		slog.ErrorContext(r.Context(), "remove pulsemate", "err", err)
 		writeError(w, http.StatusInternalServerError, "INTERNAL", "Something went wrong")
 		return
 	}
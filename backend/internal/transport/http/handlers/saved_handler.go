@@ -0,0 +1,124 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/vedran77/pulse/internal/service"
+	"github.com/vedran77/pulse/internal/transport/http/middleware"
+)
+
+type SavedHandler struct {
+	savedService *service.SavedService
+}
+
+func NewSavedHandler(savedService *service.SavedService) *SavedHandler {
+	return &SavedHandler{savedService: savedService}
+}
+
+func (h *SavedHandler) Save(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserID(r.Context())
+
+	var body struct {
+		MessageID string     `json:"message_id"`
+		RemindAt  *time.Time `json:"remind_at"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeError(w, http.StatusBadRequest, "INVALID_JSON", "Invalid request body")
+		return
+	}
+
+	messageID, err := uuid.Parse(body.MessageID)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "INVALID_ID", "Invalid message ID")
+		return
+	}
+
+	item, err := h.savedService.Save(r.Context(), userID, service.SaveInput{MessageID: messageID, RemindAt: body.RemindAt})
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrMessageNotFound):
+			writeError(w, http.StatusNotFound, "NOT_FOUND", "Message not found")
+		case errors.Is(err, service.ErrInvalidReminder):
+			writeError(w, http.StatusBadRequest, "INVALID_REMINDER", err.Error())
+		default:
+			slog.ErrorContext(r.Context(), "save message", "err", err)
+			writeError(w, http.StatusInternalServerError, "INTERNAL", "Something went wrong")
+		}
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, item)
+}
+
+func (h *SavedHandler) List(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserID(r.Context())
+
+	items, err := h.savedService.List(r.Context(), userID)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "list saved items", "err", err)
+		writeError(w, http.StatusInternalServerError, "INTERNAL", "Something went wrong")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, items)
+}
+
+func (h *SavedHandler) SetReminder(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserID(r.Context())
+	itemID, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "INVALID_ID", "Invalid saved item ID")
+		return
+	}
+
+	// A null remind_at clears the reminder
+	var body struct {
+		RemindAt *time.Time `json:"remind_at"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeError(w, http.StatusBadRequest, "INVALID_JSON", "Invalid request body")
+		return
+	}
+
+	item, err := h.savedService.SetReminder(r.Context(), userID, itemID, body.RemindAt)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrSavedItemNotFound):
+			writeError(w, http.StatusNotFound, "NOT_FOUND", "Saved item not found")
+		case errors.Is(err, service.ErrInvalidReminder):
+			writeError(w, http.StatusBadRequest, "INVALID_REMINDER", err.Error())
+		default:
+			slog.ErrorContext(r.Context(), "set reminder", "err", err)
+			writeError(w, http.StatusInternalServerError, "INTERNAL", "Something went wrong")
+		}
+		return
+	}
+
+	writeJSON(w, http.StatusOK, item)
+}
+
+func (h *SavedHandler) Unsave(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserID(r.Context())
+	itemID, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "INVALID_ID", "Invalid saved item ID")
+		return
+	}
+
+	if err := h.savedService.Unsave(r.Context(), userID, itemID); err != nil {
+		if errors.Is(err, service.ErrSavedItemNotFound) {
+			writeError(w, http.StatusNotFound, "NOT_FOUND", "Saved item not found")
+		} else {
+			slog.ErrorContext(r.Context(), "unsave message", "err", err)
+			writeError(w, http.StatusInternalServerError, "INTERNAL", "Something went wrong")
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,93 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/vedran77/pulse/internal/service"
+	"github.com/vedran77/pulse/internal/transport/http/middleware"
+)
+
+// ScheduledHandler manages queued messages. They're created through the
+// channel and DM send endpoints with a send_at time.
+type ScheduledHandler struct {
+	scheduledService *service.ScheduledService
+}
+
+func NewScheduledHandler(scheduledService *service.ScheduledService) *ScheduledHandler {
+	return &ScheduledHandler{scheduledService: scheduledService}
+}
+
+func (h *ScheduledHandler) List(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserID(r.Context())
+
+	msgs, err := h.scheduledService.List(r.Context(), userID)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "list scheduled messages", "err", err)
+		writeError(w, http.StatusInternalServerError, "INTERNAL", "Something went wrong")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, msgs)
+}
+
+func (h *ScheduledHandler) Update(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserID(r.Context())
+	id, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "INVALID_ID", "Invalid scheduled message ID")
+		return
+	}
+
+	var input service.UpdateScheduledInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		writeError(w, http.StatusBadRequest, "INVALID_JSON", "Invalid request body")
+		return
+	}
+
+	msg, err := h.scheduledService.Update(r.Context(), userID, id, input)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrScheduledMessageNotFound):
+			writeError(w, http.StatusNotFound, "NOT_FOUND", "Scheduled message not found")
+		case errors.Is(err, service.ErrInvalidSendTime):
+			writeError(w, http.StatusBadRequest, "INVALID_SEND_TIME", err.Error())
+		case errors.Is(err, service.ErrEmptyContent):
+			writeError(w, http.StatusBadRequest, "MISSING_CONTENT", "Message content is required")
+		case errors.Is(err, service.ErrContentTooLong):
+			writeError(w, http.StatusBadRequest, "CONTENT_TOO_LONG", "Message content is too long")
+		case errors.Is(err, service.ErrInvalidContent):
+			writeError(w, http.StatusBadRequest, "INVALID_CONTENT", "Message content contains control characters")
+		default:
+			slog.ErrorContext(r.Context(), "update scheduled message", "err", err)
+			writeError(w, http.StatusInternalServerError, "INTERNAL", "Something went wrong")
+		}
+		return
+	}
+
+	writeJSON(w, http.StatusOK, msg)
+}
+
+func (h *ScheduledHandler) Cancel(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserID(r.Context())
+	id, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "INVALID_ID", "Invalid scheduled message ID")
+		return
+	}
+
+	if err := h.scheduledService.Cancel(r.Context(), userID, id); err != nil {
+		if errors.Is(err, service.ErrScheduledMessageNotFound) {
+			writeError(w, http.StatusNotFound, "NOT_FOUND", "Scheduled message not found")
+		} else {
+			slog.ErrorContext(r.Context(), "cancel scheduled message", "err", err)
+			writeError(w, http.StatusInternalServerError, "INTERNAL", "Something went wrong")
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
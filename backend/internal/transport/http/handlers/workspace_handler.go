@@ -3,7 +3,7 @@ package handlers
 import (
 	"encoding/json"
 	"errors"
-	"log"
+	"log/slog"
 	"net/http"
 
 	"github.com/google/uuid"
@@ -40,7 +40,7 @@ func (h *WorkspaceHandler) Create(w http.ResponseWriter, r *http.Request) {
 		if errors.Is(err, service.ErrSlugTaken) {
 			writeError(w, http.StatusConflict, "SLUG_TAKEN", "Workspace slug is already taken")
 		} else {
-			log.Printf("ERROR create workspace: %v", err)
+			slog.ErrorContext(r.Context(), "create workspace", "err", err)
 			writeError(w, http.StatusInternalServerError, "INTERNAL", "Something went wrong")
 		}
 		return
@@ -54,7 +54,7 @@ func (h *WorkspaceHandler) List(w http.ResponseWriter, r *http.Request) {
 
 	workspaces, err := h.workspaceService.ListByUser(r.Context(), userID)
 	if err != nil {
-		log.Printf("ERROR list workspaces: %v", err)
+		slog.ErrorContext(r.Context(), "list workspaces", "err", err)
 		writeError(w, http.StatusInternalServerError, "INTERNAL", "Something went wrong")
 		return
 	}
@@ -81,8 +81,10 @@ func (h *WorkspaceHandler) Get(w http.ResponseWriter, r *http.Request) {
 			writeError(w, http.StatusNotFound, "NOT_FOUND", "Workspace not found")
 		case errors.Is(err, service.ErrNotMember):
 			writeError(w, http.StatusForbidden, "FORBIDDEN", "You are not a member of this workspace")
+		case errors.Is(err, service.ErrTwoFactorRequired), errors.Is(err, service.ErrSSORequired):
+			writeSignInPolicy(w, err)
 		default:
-			log.Printf("ERROR get workspace: %v", err)
+			slog.ErrorContext(r.Context(), "get workspace", "err", err)
 			writeError(w, http.StatusInternalServerError, "INTERNAL", "Something went wrong")
 		}
 		return
@@ -105,6 +107,11 @@ func (h *WorkspaceHandler) Update(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if errs := validator.ValidateWorkspaceUpdate(input.AutoArchiveDays); errs.HasErrors() {
+		writeValidationErrors(w, errs)
+		return
+	}
+
 	ws, err := h.workspaceService.Update(r.Context(), userID, workspaceID, input)
 	if err != nil {
 		switch {
@@ -114,8 +121,12 @@ func (h *WorkspaceHandler) Update(w http.ResponseWriter, r *http.Request) {
 			writeError(w, http.StatusForbidden, "FORBIDDEN", "Only the workspace owner can update it")
 		case errors.Is(err, service.ErrSlugTaken):
 			writeError(w, http.StatusConflict, "SLUG_TAKEN", "Workspace slug is already taken")
+		case errors.Is(err, service.ErrTwoFactorRequired):
+			writeError(w, http.StatusForbidden, "TWO_FACTOR_REQUIRED", "Enable two-factor authentication before requiring it for members")
+		case errors.Is(err, service.ErrSSORequired):
+			writeError(w, http.StatusForbidden, "SSO_REQUIRED", "Sign in with SSO before requiring it for members")
 		default:
-			log.Printf("ERROR update workspace: %v", err)
+			slog.ErrorContext(r.Context(), "update workspace", "err", err)
 			writeError(w, http.StatusInternalServerError, "INTERNAL", "Something went wrong")
 		}
 		return
@@ -138,8 +149,10 @@ func (h *WorkspaceHandler) Delete(w http.ResponseWriter, r *http.Request) {
 			writeError(w, http.StatusNotFound, "NOT_FOUND", "Workspace not found")
 		case errors.Is(err, service.ErrNotWorkspaceOwner):
 			writeError(w, http.StatusForbidden, "FORBIDDEN", "Only the workspace owner can delete it")
+		case errors.Is(err, service.ErrTwoFactorRequired), errors.Is(err, service.ErrSSORequired):
+			writeSignInPolicy(w, err)
 		default:
-			log.Printf("ERROR delete workspace: %v", err)
+			slog.ErrorContext(r.Context(), "delete workspace", "err", err)
 			writeError(w, http.StatusInternalServerError, "INTERNAL", "Something went wrong")
 		}
 		return
@@ -148,6 +161,83 @@ func (h *WorkspaceHandler) Delete(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusNoContent)
 }
 
+func (h *WorkspaceHandler) ListDeleted(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserID(r.Context())
+
+	workspaces, err := h.workspaceService.ListDeleted(r.Context(), userID)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "list deleted workspaces", "err", err)
+		writeError(w, http.StatusInternalServerError, "INTERNAL", "Something went wrong")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, workspaces)
+}
+
+func (h *WorkspaceHandler) Restore(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserID(r.Context())
+	workspaceID, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "INVALID_ID", "Invalid workspace ID")
+		return
+	}
+
+	ws, err := h.workspaceService.Restore(r.Context(), userID, workspaceID)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrWorkspaceNotFound):
+			writeError(w, http.StatusNotFound, "NOT_FOUND", "Deleted workspace not found")
+		case errors.Is(err, service.ErrNotWorkspaceOwner):
+			writeError(w, http.StatusForbidden, "FORBIDDEN", "Only the workspace owner can restore it")
+		case errors.Is(err, service.ErrTwoFactorRequired), errors.Is(err, service.ErrSSORequired):
+			writeSignInPolicy(w, err)
+		default:
+			slog.ErrorContext(r.Context(), "restore workspace", "err", err)
+			writeError(w, http.StatusInternalServerError, "INTERNAL", "Something went wrong")
+		}
+		return
+	}
+
+	writeJSON(w, http.StatusOK, ws)
+}
+
+func (h *WorkspaceHandler) TransferOwnership(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserID(r.Context())
+	workspaceID, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "INVALID_ID", "Invalid workspace ID")
+		return
+	}
+
+	var input service.TransferOwnershipInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		writeError(w, http.StatusBadRequest, "INVALID_JSON", "Invalid request body")
+		return
+	}
+
+	ws, err := h.workspaceService.TransferOwnership(r.Context(), userID, workspaceID, input)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrWorkspaceNotFound):
+			writeError(w, http.StatusNotFound, "NOT_FOUND", "Workspace not found")
+		case errors.Is(err, service.ErrNotWorkspaceOwner):
+			writeError(w, http.StatusForbidden, "FORBIDDEN", "Only the workspace owner can transfer ownership")
+		case errors.Is(err, service.ErrTransferNotConfirmed):
+			writeError(w, http.StatusBadRequest, "CONFIRMATION_REQUIRED", err.Error())
+		case errors.Is(err, service.ErrNewOwnerNotAdmin):
+			writeError(w, http.StatusConflict, "NOT_ADMIN", err.Error())
+		case errors.Is(err, service.ErrTwoFactorRequired), errors.Is(err, service.ErrSSORequired):
+			writeSignInPolicy(w, err)
+		default:
+			slog.ErrorContext(r.Context(), "transfer workspace ownership", "err", err)
+			writeError(w, http.StatusInternalServerError, "INTERNAL", "Something went wrong")
+		}
+		return
+	}
+
+	writeJSON(w, http.StatusOK, ws)
+}
+
 func (h *WorkspaceHandler) AddMember(w http.ResponseWriter, r *http.Request) {
 	requesterID := middleware.GetUserID(r.Context())
 	workspaceID, err := uuid.Parse(r.PathValue("id"))
@@ -176,8 +266,10 @@ func (h *WorkspaceHandler) AddMember(w http.ResponseWriter, r *http.Request) {
 			writeError(w, http.StatusForbidden, "FORBIDDEN", "Only owner or admin can add members")
 		case errors.Is(err, service.ErrAlreadyMember):
 			writeError(w, http.StatusConflict, "ALREADY_MEMBER", "User is already a member")
+		case errors.Is(err, service.ErrTwoFactorRequired), errors.Is(err, service.ErrSSORequired):
+			writeSignInPolicy(w, err)
 		default:
-			log.Printf("ERROR add member: %v", err)
+			slog.ErrorContext(r.Context(), "add member", "err", err)
 			writeError(w, http.StatusInternalServerError, "INTERNAL", "Something went wrong")
 		}
 		return
@@ -204,8 +296,12 @@ func (h *WorkspaceHandler) RemoveMember(w http.ResponseWriter, r *http.Request)
 		switch {
 		case errors.Is(err, service.ErrNotWorkspaceOwner):
 			writeError(w, http.StatusForbidden, "FORBIDDEN", "Only owner or admin can remove members")
+		case errors.Is(err, service.ErrCannotRemoveOwner):
+			writeError(w, http.StatusConflict, "CANNOT_REMOVE_OWNER", err.Error())
+		case errors.Is(err, service.ErrTwoFactorRequired), errors.Is(err, service.ErrSSORequired):
+			writeSignInPolicy(w, err)
 		default:
-			log.Printf("ERROR remove member: %v", err)
+			slog.ErrorContext(r.Context(), "remove member", "err", err)
 			writeError(w, http.StatusInternalServerError, "INTERNAL", "Something went wrong")
 		}
 		return
@@ -222,25 +318,26 @@ func (h *WorkspaceHandler) CreateInvite(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	var body struct {
-		Email string `json:"email"`
-	}
-	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+	var input service.CreateInviteInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
 		writeError(w, http.StatusBadRequest, "INVALID_JSON", "Invalid request body")
 		return
 	}
-	if body.Email == "" {
-		writeError(w, http.StatusBadRequest, "VALIDATION_ERROR", "Email is required")
+
+	if errs := validator.ValidateInvite(input.Email, input.Role, input.MaxUses, input.ExpiresInHours); errs.HasErrors() {
+		writeValidationErrors(w, errs)
 		return
 	}
 
-	invite, err := h.workspaceService.CreateInvite(r.Context(), requesterID, workspaceID, body.Email)
+	invite, err := h.workspaceService.CreateInvite(r.Context(), requesterID, workspaceID, input)
 	if err != nil {
 		switch {
 		case errors.Is(err, service.ErrNotWorkspaceOwner):
 			writeError(w, http.StatusForbidden, "FORBIDDEN", "Only owner or admin can create invites")
+		case errors.Is(err, service.ErrTwoFactorRequired), errors.Is(err, service.ErrSSORequired):
+			writeSignInPolicy(w, err)
 		default:
-			log.Printf("ERROR create invite: %v", err)
+			slog.ErrorContext(r.Context(), "create invite", "err", err)
 			writeError(w, http.StatusInternalServerError, "INTERNAL", "Something went wrong")
 		}
 		return
@@ -252,7 +349,7 @@ func (h *WorkspaceHandler) CreateInvite(w http.ResponseWriter, r *http.Request)
 	})
 }
 
-func (h *WorkspaceHandler) ListInvites(w http.ResponseWriter, r *http.Request) {
+func (h *WorkspaceHandler) ResendInvite(w http.ResponseWriter, r *http.Request) {
 	requesterID := middleware.GetUserID(r.Context())
 	workspaceID, err := uuid.Parse(r.PathValue("id"))
 	if err != nil {
@@ -260,22 +357,60 @@ func (h *WorkspaceHandler) ListInvites(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	invites, err := h.workspaceService.ListInvites(r.Context(), requesterID, workspaceID)
+	inviteID, err := uuid.Parse(r.PathValue("inviteId"))
 	if err != nil {
-		if errors.Is(err, service.ErrNotMember) {
-			writeError(w, http.StatusForbidden, "FORBIDDEN", "You are not a member of this workspace")
-		} else {
-			log.Printf("ERROR list invites: %v", err)
+		writeError(w, http.StatusBadRequest, "INVALID_ID", "Invalid invite ID")
+		return
+	}
+
+	invite, err := h.workspaceService.ResendInvite(r.Context(), requesterID, workspaceID, inviteID)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrNotWorkspaceOwner):
+			writeError(w, http.StatusForbidden, "FORBIDDEN", "Only owner or admin can resend invites")
+		case errors.Is(err, service.ErrInviteNotFound):
+			writeError(w, http.StatusNotFound, "NOT_FOUND", "Invite not found")
+		case errors.Is(err, service.ErrInviteNotEmail):
+			writeError(w, http.StatusBadRequest, "NOT_EMAIL_INVITE", "Only email invites can be resent")
+		case errors.Is(err, service.ErrInviteUsed):
+			writeError(w, http.StatusConflict, "ALREADY_USED", "Invite has already been used")
+		case errors.Is(err, service.ErrTwoFactorRequired), errors.Is(err, service.ErrSSORequired):
+			writeSignInPolicy(w, err)
+		default:
+			slog.ErrorContext(r.Context(), "resend invite", "err", err)
 			writeError(w, http.StatusInternalServerError, "INTERNAL", "Something went wrong")
 		}
 		return
 	}
 
-	if invites == nil {
-		invites = []domain.WorkspaceInvite{}
+	writeJSON(w, http.StatusOK, invite)
+}
+
+func (h *WorkspaceHandler) ListInvites(w http.ResponseWriter, r *http.Request) {
+	requesterID := middleware.GetUserID(r.Context())
+	workspaceID, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "INVALID_ID", "Invalid workspace ID")
+		return
+	}
+
+	resp, err := h.workspaceService.ListInvites(r.Context(), requesterID, workspaceID, pageInput(r))
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrInvalidCursor):
+			writeInvalidCursor(w)
+		case errors.Is(err, service.ErrNotMember):
+			writeError(w, http.StatusForbidden, "FORBIDDEN", "You are not a member of this workspace")
+		case errors.Is(err, service.ErrTwoFactorRequired), errors.Is(err, service.ErrSSORequired):
+			writeSignInPolicy(w, err)
+		default:
+			slog.ErrorContext(r.Context(), "list invites", "err", err)
+			writeError(w, http.StatusInternalServerError, "INTERNAL", "Something went wrong")
+		}
+		return
 	}
 
-	writeJSON(w, http.StatusOK, invites)
+	writeJSON(w, http.StatusOK, resp)
 }
 
 func (h *WorkspaceHandler) RevokeInvite(w http.ResponseWriter, r *http.Request) {
@@ -296,8 +431,10 @@ func (h *WorkspaceHandler) RevokeInvite(w http.ResponseWriter, r *http.Request)
 		switch {
 		case errors.Is(err, service.ErrNotWorkspaceOwner):
 			writeError(w, http.StatusForbidden, "FORBIDDEN", "Only owner or admin can revoke invites")
+		case errors.Is(err, service.ErrTwoFactorRequired), errors.Is(err, service.ErrSSORequired):
+			writeSignInPolicy(w, err)
 		default:
-			log.Printf("ERROR revoke invite: %v", err)
+			slog.ErrorContext(r.Context(), "revoke invite", "err", err)
 			writeError(w, http.StatusInternalServerError, "INTERNAL", "Something went wrong")
 		}
 		return
@@ -318,7 +455,7 @@ func (h *WorkspaceHandler) GetInviteInfo(w http.ResponseWriter, r *http.Request)
 		if errors.Is(err, service.ErrInviteNotFound) {
 			writeError(w, http.StatusNotFound, "NOT_FOUND", "Invite not found")
 		} else {
-			log.Printf("ERROR get invite info: %v", err)
+			slog.ErrorContext(r.Context(), "get invite info", "err", err)
 			writeError(w, http.StatusInternalServerError, "INTERNAL", "Something went wrong")
 		}
 		return
@@ -326,6 +463,7 @@ func (h *WorkspaceHandler) GetInviteInfo(w http.ResponseWriter, r *http.Request)
 
 	writeJSON(w, http.StatusOK, map[string]any{
 		"workspace_name": invite.WorkspaceName,
+		"type":           invite.Type,
 		"email":          invite.Email,
 		"expires_at":     invite.ExpiresAt,
 		"accepted":       invite.AcceptedAt != nil,
@@ -349,10 +487,14 @@ func (h *WorkspaceHandler) AcceptInvite(w http.ResponseWriter, r *http.Request)
 			writeError(w, http.StatusGone, "EXPIRED", "Invite has expired")
 		case errors.Is(err, service.ErrInviteUsed):
 			writeError(w, http.StatusConflict, "ALREADY_USED", "Invite has already been used")
+		case errors.Is(err, service.ErrInviteEmailMismatch):
+			writeError(w, http.StatusForbidden, "EMAIL_MISMATCH", "This invite was sent to a different email address")
+		case errors.Is(err, service.ErrEmailNotVerified):
+			writeError(w, http.StatusForbidden, "EMAIL_NOT_VERIFIED", "Verify your email address before accepting invites")
 		case errors.Is(err, service.ErrAlreadyMember):
 			writeError(w, http.StatusConflict, "ALREADY_MEMBER", "You are already a member of this workspace")
 		default:
-			log.Printf("ERROR accept invite: %v", err)
+			slog.ErrorContext(r.Context(), "accept invite", "err", err)
 			writeError(w, http.StatusInternalServerError, "INTERNAL", "Something went wrong")
 		}
 		return
@@ -371,16 +513,293 @@ func (h *WorkspaceHandler) ListMembers(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	members, err := h.workspaceService.ListMembers(r.Context(), userID, workspaceID)
+	resp, err := h.workspaceService.ListMembers(r.Context(), userID, workspaceID, pageInput(r))
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrInvalidCursor):
+			writeInvalidCursor(w)
+		case errors.Is(err, service.ErrNotMember):
+			writeError(w, http.StatusForbidden, "FORBIDDEN", "You are not a member of this workspace")
+		case errors.Is(err, service.ErrTwoFactorRequired), errors.Is(err, service.ErrSSORequired):
+			writeSignInPolicy(w, err)
+		default:
+			slog.ErrorContext(r.Context(), "list members", "err", err)
+			writeError(w, http.StatusInternalServerError, "INTERNAL", "Something went wrong")
+		}
+		return
+	}
+
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (h *WorkspaceHandler) SearchMembers(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserID(r.Context())
+	workspaceID, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "INVALID_ID", "Invalid workspace ID")
+		return
+	}
+
+	query := r.URL.Query()
+	input := service.MemberSearchInput{
+		Query:     query.Get("q"),
+		Role:      query.Get("role"),
+		PageInput: pageInput(r),
+	}
+	if errs := validator.ValidateMemberRole(input.Role); errs.HasErrors() {
+		writeValidationErrors(w, errs)
+		return
+	}
+
+	resp, err := h.workspaceService.SearchMembers(r.Context(), userID, workspaceID, input)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrInvalidCursor):
+			writeInvalidCursor(w)
+		case errors.Is(err, service.ErrNotMember):
+			writeError(w, http.StatusForbidden, "FORBIDDEN", "You are not a member of this workspace")
+		case errors.Is(err, service.ErrTwoFactorRequired), errors.Is(err, service.ErrSSORequired):
+			writeSignInPolicy(w, err)
+		default:
+			slog.ErrorContext(r.Context(), "search members", "err", err)
+			writeError(w, http.StatusInternalServerError, "INTERNAL", "Something went wrong")
+		}
+		return
+	}
+
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// UpdateMyProfile sets the requester's title, timezone and pronouns in the workspace.
+func (h *WorkspaceHandler) UpdateMyProfile(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserID(r.Context())
+	workspaceID, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "INVALID_ID", "Invalid workspace ID")
+		return
+	}
+
+	var input service.UpdateMemberProfileInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		writeError(w, http.StatusBadRequest, "INVALID_JSON", "Invalid request body")
+		return
+	}
+
+	if errs := validator.ValidateMemberProfile(input.Title, input.Timezone, input.Pronouns); errs.HasErrors() {
+		writeValidationErrors(w, errs)
+		return
+	}
+
+	member, err := h.workspaceService.UpdateMemberProfile(r.Context(), userID, workspaceID, input)
 	if err != nil {
 		if errors.Is(err, service.ErrNotMember) {
 			writeError(w, http.StatusForbidden, "FORBIDDEN", "You are not a member of this workspace")
+		} else if errors.Is(err, service.ErrTwoFactorRequired) || errors.Is(err, service.ErrSSORequired) {
+			writeSignInPolicy(w, err)
+		} else {
+			slog.ErrorContext(r.Context(), "update member profile", "err", err)
+			writeError(w, http.StatusInternalServerError, "INTERNAL", "Something went wrong")
+		}
+		return
+	}
+
+	writeJSON(w, http.StatusOK, member)
+}
+
+func (h *WorkspaceHandler) GetJoinPolicy(w http.ResponseWriter, r *http.Request) {
+	requesterID := middleware.GetUserID(r.Context())
+	workspaceID, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "INVALID_ID", "Invalid workspace ID")
+		return
+	}
+
+	policy, err := h.workspaceService.GetJoinPolicy(r.Context(), requesterID, workspaceID)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrNotWorkspaceOwner):
+			writeError(w, http.StatusForbidden, "FORBIDDEN", "Only owner or admin can view the join policy")
+		case errors.Is(err, service.ErrWorkspaceNotFound):
+			writeError(w, http.StatusNotFound, "NOT_FOUND", "Workspace not found")
+		case errors.Is(err, service.ErrTwoFactorRequired), errors.Is(err, service.ErrSSORequired):
+			writeSignInPolicy(w, err)
+		default:
+			slog.ErrorContext(r.Context(), "get join policy", "err", err)
+			writeError(w, http.StatusInternalServerError, "INTERNAL", "Something went wrong")
+		}
+		return
+	}
+
+	writeJSON(w, http.StatusOK, policy)
+}
+
+func (h *WorkspaceHandler) UpdateJoinPolicy(w http.ResponseWriter, r *http.Request) {
+	requesterID := middleware.GetUserID(r.Context())
+	workspaceID, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "INVALID_ID", "Invalid workspace ID")
+		return
+	}
+
+	var input service.UpdateJoinPolicyInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		writeError(w, http.StatusBadRequest, "INVALID_JSON", "Invalid request body")
+		return
+	}
+
+	if input.AllowedDomains != nil {
+		if errs := validator.ValidateJoinPolicy(*input.AllowedDomains); errs.HasErrors() {
+			writeValidationErrors(w, errs)
+			return
+		}
+	}
+
+	policy, err := h.workspaceService.UpdateJoinPolicy(r.Context(), requesterID, workspaceID, input)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrNotWorkspaceOwner):
+			writeError(w, http.StatusForbidden, "FORBIDDEN", "Only the owner can change allowed domains")
+		case errors.Is(err, service.ErrWorkspaceNotFound):
+			writeError(w, http.StatusNotFound, "NOT_FOUND", "Workspace not found")
+		case errors.Is(err, service.ErrTwoFactorRequired), errors.Is(err, service.ErrSSORequired):
+			writeSignInPolicy(w, err)
+		default:
+			slog.ErrorContext(r.Context(), "update join policy", "err", err)
+			writeError(w, http.StatusInternalServerError, "INTERNAL", "Something went wrong")
+		}
+		return
+	}
+
+	writeJSON(w, http.StatusOK, policy)
+}
+
+func (h *WorkspaceHandler) ListDiscoverable(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserID(r.Context())
+
+	workspaces, err := h.workspaceService.ListDiscoverable(r.Context(), userID)
+	if err != nil {
+		if errors.Is(err, service.ErrEmailNotVerified) {
+			writeError(w, http.StatusForbidden, "EMAIL_NOT_VERIFIED", "Verify your email address to discover workspaces")
+		} else {
+			slog.ErrorContext(r.Context(), "list discoverable workspaces", "err", err)
+			writeError(w, http.StatusInternalServerError, "INTERNAL", "Something went wrong")
+		}
+		return
+	}
+
+	writeJSON(w, http.StatusOK, workspaces)
+}
+
+func (h *WorkspaceHandler) Join(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserID(r.Context())
+	workspaceID, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "INVALID_ID", "Invalid workspace ID")
+		return
+	}
+
+	req, err := h.workspaceService.Join(r.Context(), userID, workspaceID)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrWorkspaceNotFound):
+			writeError(w, http.StatusNotFound, "NOT_FOUND", "Workspace not found")
+		case errors.Is(err, service.ErrDomainNotAllowed):
+			writeError(w, http.StatusForbidden, "DOMAIN_NOT_ALLOWED", "Your email domain can't join this workspace without an invite")
+		case errors.Is(err, service.ErrEmailNotVerified):
+			writeError(w, http.StatusForbidden, "EMAIL_NOT_VERIFIED", "Verify your email address before joining")
+		case errors.Is(err, service.ErrAlreadyMember):
+			writeError(w, http.StatusConflict, "ALREADY_MEMBER", "You are already a member of this workspace")
+		default:
+			slog.ErrorContext(r.Context(), "join workspace", "err", err)
+			writeError(w, http.StatusInternalServerError, "INTERNAL", "Something went wrong")
+		}
+		return
+	}
+
+	if req == nil {
+		writeJSON(w, http.StatusOK, map[string]any{
+			"status":       "joined",
+			"workspace_id": workspaceID,
+		})
+		return
+	}
+
+	writeJSON(w, http.StatusAccepted, map[string]any{
+		"status":  "pending",
+		"request": req,
+	})
+}
+
+func (h *WorkspaceHandler) ListJoinRequests(w http.ResponseWriter, r *http.Request) {
+	requesterID := middleware.GetUserID(r.Context())
+	workspaceID, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "INVALID_ID", "Invalid workspace ID")
+		return
+	}
+
+	reqs, err := h.workspaceService.ListJoinRequests(r.Context(), requesterID, workspaceID)
+	if err != nil {
+		if errors.Is(err, service.ErrNotWorkspaceOwner) {
+			writeError(w, http.StatusForbidden, "FORBIDDEN", "Only owner or admin can view join requests")
+		} else if errors.Is(err, service.ErrTwoFactorRequired) || errors.Is(err, service.ErrSSORequired) {
+			writeSignInPolicy(w, err)
 		} else {
-			log.Printf("ERROR list members: %v", err)
+			slog.ErrorContext(r.Context(), "list join requests", "err", err)
 			writeError(w, http.StatusInternalServerError, "INTERNAL", "Something went wrong")
 		}
 		return
 	}
 
-	writeJSON(w, http.StatusOK, members)
+	writeJSON(w, http.StatusOK, reqs)
+}
+
+func (h *WorkspaceHandler) ApproveJoinRequest(w http.ResponseWriter, r *http.Request) {
+	h.decideJoinRequest(w, r, true)
+}
+
+func (h *WorkspaceHandler) RejectJoinRequest(w http.ResponseWriter, r *http.Request) {
+	h.decideJoinRequest(w, r, false)
+}
+
+func (h *WorkspaceHandler) decideJoinRequest(w http.ResponseWriter, r *http.Request, approve bool) {
+	requesterID := middleware.GetUserID(r.Context())
+	workspaceID, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "INVALID_ID", "Invalid workspace ID")
+		return
+	}
+
+	requestID, err := uuid.Parse(r.PathValue("requestId"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "INVALID_ID", "Invalid request ID")
+		return
+	}
+
+	if err := h.workspaceService.DecideJoinRequest(r.Context(), requesterID, workspaceID, requestID, approve); err != nil {
+		switch {
+		case errors.Is(err, service.ErrNotWorkspaceOwner):
+			writeError(w, http.StatusForbidden, "FORBIDDEN", "Only owner or admin can decide join requests")
+		case errors.Is(err, service.ErrJoinRequestNotFound):
+			writeError(w, http.StatusNotFound, "NOT_FOUND", "Join request not found")
+		case errors.Is(err, service.ErrTwoFactorRequired), errors.Is(err, service.ErrSSORequired):
+			writeSignInPolicy(w, err)
+		default:
+			slog.ErrorContext(r.Context(), "decide join request", "err", err)
+			writeError(w, http.StatusInternalServerError, "INTERNAL", "Something went wrong")
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// writeSignInPolicy reports a session refused by the workspace's sign-in
+// policy, so clients can send the user to enable 2FA or sign in with SSO.
+func writeSignInPolicy(w http.ResponseWriter, err error) {
+	if errors.Is(err, service.ErrSSORequired) {
+		writeError(w, http.StatusForbidden, "SSO_REQUIRED", "This workspace requires signing in with SSO")
+		return
+	}
+	writeError(w, http.StatusForbidden, "TWO_FACTOR_REQUIRED", "This workspace requires two-factor authentication")
 }
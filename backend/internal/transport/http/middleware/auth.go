@@ -5,15 +5,20 @@ import (
 	"net/http"
 	"strings"
 
-	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
+	"github.com/vedran77/pulse/internal/domain"
 )
 
 type contextKey string
 
 const UserIDKey contextKey = "user_id"
 
-func Auth(jwtSecret string) func(http.Handler) http.Handler {
+// TokenValidator validates an access token and returns its session.
+type TokenValidator interface {
+	ValidateAccessToken(ctx context.Context, token string) (domain.Session, error)
+}
+
+func Auth(validator TokenValidator) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			header := r.Header.Get("Authorization")
@@ -24,28 +29,14 @@ func Auth(jwtSecret string) func(http.Handler) http.Handler {
 
 			tokenStr := strings.TrimPrefix(header, "Bearer ")
 
-			token, err := jwt.Parse(tokenStr, func(t *jwt.Token) (any, error) {
-				return []byte(jwtSecret), nil
-			})
-			if err != nil || !token.Valid {
-				http.Error(w, `{"error":{"code":"UNAUTHORIZED","message":"Invalid or expired token"}}`, http.StatusUnauthorized)
-				return
-			}
-
-			claims, ok := token.Claims.(jwt.MapClaims)
-			if !ok {
-				http.Error(w, `{"error":{"code":"UNAUTHORIZED","message":"Invalid token claims"}}`, http.StatusUnauthorized)
-				return
-			}
-
-			sub, _ := claims.GetSubject()
-			userID, err := uuid.Parse(sub)
+			session, err := validator.ValidateAccessToken(r.Context(), tokenStr)
 			if err != nil {
-				http.Error(w, `{"error":{"code":"UNAUTHORIZED","message":"Invalid user ID in token"}}`, http.StatusUnauthorized)
+				http.Error(w, `{"error":{"code":"UNAUTHORIZED","message":"Invalid or expired token"}}`, http.StatusUnauthorized)
 				return
 			}
 
-			ctx := context.WithValue(r.Context(), UserIDKey, userID)
+			// Services read the session to enforce workspace sign-in policies
+			ctx := context.WithValue(domain.WithSession(r.Context(), session), UserIDKey, session.UserID)
 			next.ServeHTTP(w, r.WithContext(ctx))
 		})
 	}
@@ -0,0 +1,127 @@
+package middleware
+
+import (
+	"bufio"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"regexp"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/vedran77/pulse/internal/logging"
+	"github.com/vedran77/pulse/internal/metrics"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const RequestIDHeader = "X-Request-ID"
+
+// Accept request IDs from a proxy only if they look sane
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+var tracer = otel.Tracer("github.com/vedran77/pulse/internal/transport/http")
+
+// Observe assigns each request an ID, starts a server span, records latency
+// metrics per route and logs the request. It must wrap the ServeMux without
+// any middleware in between that replaces the request, so the matched
+// pattern is visible once the handler returns.
+func Observe(m *metrics.Metrics) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			done := m.RequestStarted()
+			defer done()
+
+			id := r.Header.Get(RequestIDHeader)
+			if !validRequestID.MatchString(id) {
+				id = uuid.NewString()
+			}
+			w.Header().Set(RequestIDHeader, id)
+
+			ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+			ctx, span := tracer.Start(ctx, r.Method, trace.WithSpanKind(trace.SpanKindServer))
+			defer span.End()
+			ctx = logging.WithRequestID(ctx, id)
+
+			r = r.WithContext(ctx)
+			rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+			next.ServeHTTP(rec, r)
+
+			route := r.Pattern
+			if route == "" {
+				route = "unmatched"
+			}
+			span.SetName(route)
+			span.SetAttributes(
+				attribute.String("http.request.method", r.Method),
+				attribute.String("http.route", route),
+				attribute.Int("http.response.status_code", rec.status),
+				attribute.String("request.id", id),
+			)
+			if rec.status >= 500 {
+				span.SetStatus(codes.Error, http.StatusText(rec.status))
+			}
+
+			// Upgraded WebSocket connections are tracked by the hub metrics
+			if rec.hijacked {
+				return
+			}
+
+			elapsed := time.Since(start)
+			m.ObserveRequest(r.Method, route, rec.status, elapsed)
+			slog.DebugContext(ctx, "http request",
+				"method", r.Method,
+				"route", route,
+				"status", rec.status,
+				"duration", elapsed,
+			)
+		})
+	}
+}
+
+// statusRecorder captures the response status. It passes through hijacking
+// and flushing so WebSocket upgrades keep working.
+type statusRecorder struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+	hijacked    bool
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	if !r.wroteHeader {
+		r.status = status
+		r.wroteHeader = true
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *statusRecorder) Write(b []byte) (int, error) {
+	r.wroteHeader = true
+	return r.ResponseWriter.Write(b)
+}
+
+func (r *statusRecorder) Flush() {
+	if f, ok := r.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (r *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := r.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("response writer %T does not support hijacking", r.ResponseWriter)
+	}
+	r.hijacked = true
+	r.status = http.StatusSwitchingProtocols
+	return h.Hijack()
+}
+
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
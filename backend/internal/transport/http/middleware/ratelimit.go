@@ -0,0 +1,87 @@
+package middleware
+
+import (
+	"log/slog"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/vedran77/pulse/internal/ratelimit"
+)
+
+// RateLimiter builds per-route-class rate limiting middleware.
+type RateLimiter struct {
+	store ratelimit.Store
+	// trustProxy makes the client IP come from X-Forwarded-For
+	trustProxy bool
+}
+
+func NewRateLimiter(store ratelimit.Store, trustProxy bool) *RateLimiter {
+	return &RateLimiter{store: store, trustProxy: trustProxy}
+}
+
+// ByIP limits requests per client IP within a route class.
+func (rl *RateLimiter) ByIP(class string, limit ratelimit.Limit) func(http.Handler) http.Handler {
+	return rl.limit(class, limit, func(r *http.Request) string {
+		return "ip:" + ClientIP(r, rl.trustProxy)
+	})
+}
+
+// ByUser limits requests per authenticated user within a route class.
+// It must run after Auth; unauthenticated requests fall back to the IP.
+func (rl *RateLimiter) ByUser(class string, limit ratelimit.Limit) func(http.Handler) http.Handler {
+	return rl.limit(class, limit, func(r *http.Request) string {
+		if userID, ok := r.Context().Value(UserIDKey).(uuid.UUID); ok {
+			return "user:" + userID.String()
+		}
+		return "ip:" + ClientIP(r, rl.trustProxy)
+	})
+}
+
+func (rl *RateLimiter) limit(class string, limit ratelimit.Limit, key func(*http.Request) string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			res, err := rl.store.Allow(r.Context(), class+":"+key(r), limit)
+			if err != nil {
+				// Fail open: an unavailable store shouldn't take the API down
+				slog.ErrorContext(r.Context(), "rate limit store", "err", err)
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			w.Header().Set("X-RateLimit-Limit", strconv.Itoa(limit.Burst))
+			w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(res.Remaining))
+
+			if !res.Allowed {
+				retry := int(math.Ceil(res.RetryAfter.Seconds()))
+				w.Header().Set("Retry-After", strconv.Itoa(max(retry, 1)))
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusTooManyRequests)
+				w.Write([]byte(`{"error":{"code":"RATE_LIMITED","message":"Too many requests, slow down"}}`))
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// ClientIP returns the caller's IP. X-Forwarded-For is only honoured
+// behind a trusted proxy, since clients can set it to anything.
+func ClientIP(r *http.Request, trustProxy bool) string {
+	if trustProxy {
+		if fwd := r.Header.Get("X-Forwarded-For"); fwd != "" {
+			first, _, _ := strings.Cut(fwd, ",")
+			return strings.TrimSpace(first)
+		}
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,84 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/vedran77/pulse/internal/ratelimit"
+)
+
+// stubStore answers every Allow with res and err, recording the keys asked for.
+type stubStore struct {
+	res  ratelimit.Result
+	err  error
+	keys []string
+}
+
+func (s *stubStore) Allow(_ context.Context, key string, _ ratelimit.Limit) (ratelimit.Result, error) {
+	s.keys = append(s.keys, key)
+	return s.res, s.err
+}
+
+func TestRateLimiter(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+	serve := func(store ratelimit.Store) *httptest.ResponseRecorder {
+		t.Helper()
+		h := NewRateLimiter(store, false).ByIP("auth", ratelimit.PerMinute(10))(ok)
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/auth/login", nil)
+		req.RemoteAddr = "203.0.113.7:4321"
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	t.Run("limited", func(t *testing.T) {
+		store := &stubStore{res: ratelimit.Result{RetryAfter: 1500 * time.Millisecond}}
+		rec := serve(store)
+		if rec.Code != http.StatusTooManyRequests {
+			t.Fatalf("status = %d", rec.Code)
+		}
+		// Rounded up to whole seconds
+		if got := rec.Header().Get("Retry-After"); got != "2" {
+			t.Fatalf("Retry-After = %q, want 2", got)
+		}
+		if got := rec.Header().Get("X-RateLimit-Limit"); got != "10" {
+			t.Fatalf("X-RateLimit-Limit = %q", got)
+		}
+		var body struct {
+			Error struct{ Code, Message string }
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil || body.Error.Code != "RATE_LIMITED" {
+			t.Fatalf("body = %s (%v)", rec.Body, err)
+		}
+		if len(store.keys) != 1 || store.keys[0] != "auth:ip:203.0.113.7" {
+			t.Fatalf("keys = %v", store.keys)
+		}
+	})
+
+	t.Run("short wait", func(t *testing.T) {
+		rec := serve(&stubStore{res: ratelimit.Result{RetryAfter: 10 * time.Millisecond}})
+		if got := rec.Header().Get("Retry-After"); got != "1" {
+			t.Fatalf("Retry-After = %q, want 1", got)
+		}
+	})
+
+	t.Run("allowed", func(t *testing.T) {
+		rec := serve(&stubStore{res: ratelimit.Result{Allowed: true, Remaining: 9}})
+		if rec.Code != http.StatusNoContent || rec.Header().Get("X-RateLimit-Remaining") != "9" {
+			t.Fatalf("status = %d, headers = %v", rec.Code, rec.Header())
+		}
+	})
+
+	t.Run("store down", func(t *testing.T) {
+		if rec := serve(&stubStore{err: errors.New("redis down")}); rec.Code != http.StatusNoContent {
+			t.Fatalf("status = %d, want the request let through", rec.Code)
+		}
+	})
+}
@@ -3,7 +3,7 @@ package ws
 import (
 	"context"
 	"encoding/json"
-	"log"
+	"log/slog"
 	"sync"
 	"time"
 
@@ -18,6 +18,9 @@ const (
 	pingInterval   = 30 * time.Second
 	maxMessageSize = 4096
 	sendBufSize    = 256
+
+	// Close the connection after this many rate limited events in a row
+	maxRateLimitedEvents = 50
 )
 
 // Client represents a single WebSocket connection.
@@ -32,6 +35,12 @@ type Client struct {
 
 	send chan []byte
 	done chan struct{}
+
+	// Close status sent by WritePump once done is closed
+	closeOnce   sync.Once
+	closeMu     sync.Mutex
+	closeCode   websocket.StatusCode
+	closeReason string
 }
 
 func NewClient(hub *Hub, conn *websocket.Conn, userID uuid.UUID) *Client {
@@ -42,9 +51,28 @@ func NewClient(hub *Hub, conn *websocket.Conn, userID uuid.UUID) *Client {
 		subscribedChannels: make(map[uuid.UUID]struct{}),
 		send:               make(chan []byte, sendBufSize),
 		done:               make(chan struct{}),
+		closeCode:          websocket.StatusNormalClosure,
 	}
 }
 
+// close asks WritePump to close the connection with the given status.
+// Only the first call has any effect.
+func (c *Client) close(code websocket.StatusCode, reason string) {
+	c.closeOnce.Do(func() {
+		c.closeMu.Lock()
+		c.closeCode = code
+		c.closeReason = reason
+		c.closeMu.Unlock()
+		close(c.done)
+	})
+}
+
+func (c *Client) closeStatus() (websocket.StatusCode, string) {
+	c.closeMu.Lock()
+	defer c.closeMu.Unlock()
+	return c.closeCode, c.closeReason
+}
+
 // IsSubscribed checks if this client is subscribed to a channel.
 func (c *Client) IsSubscribed(channelID uuid.UUID) bool {
 	c.mu.RLock()
@@ -70,45 +98,59 @@ func (c *Client) Unsubscribe(channelID uuid.UUID) {
 // ReadPump reads messages from the WebSocket and routes them to the Hub.
 func (c *Client) ReadPump() {
 	defer func() {
-		c.hub.unregister <- c
-		c.conn.Close(websocket.StatusNormalClosure, "")
+		c.hub.Unregister(c)
+		c.close(websocket.StatusNormalClosure, "")
 	}()
 
+	c.conn.SetReadLimit(maxMessageSize)
+
+	limited := 0
 	for {
 		var event Event
 		err := wsjson.Read(context.Background(), c.conn, &event)
 		if err != nil {
 			if websocket.CloseStatus(err) != -1 {
-				log.Printf("ws: client %s disconnected", c.userID)
+				slog.Debug("ws: client closed connection", "user_id", c.userID)
 			} else {
-				log.Printf("ws: read error from %s: %v", c.userID, err)
+				slog.Debug("ws: read error", "user_id", c.userID, "err", err)
 			}
 			return
 		}
 
+		if res := c.hub.allowEvent(context.Background(), c.userID); !res.Allowed {
+			limited++
+			if limited >= maxRateLimitedEvents {
+				slog.Warn("ws: closing rate limited client", "user_id", c.userID, "limited_events", limited)
+				c.close(websocket.StatusPolicyViolation, "rate limit exceeded")
+				return
+			}
+			c.sendRateLimited(res.RetryAfter)
+			continue
+		}
+		limited = 0
+
 		c.handleEvent(&event)
 	}
 }
 
 // WritePump writes messages from the send channel to the WebSocket.
+// It owns closing the connection.
 func (c *Client) WritePump() {
 	ticker := time.NewTicker(pingInterval)
 	defer func() {
 		ticker.Stop()
-		c.conn.Close(websocket.StatusNormalClosure, "")
+		c.conn.Close(c.closeStatus())
+		c.hub.conns.Done()
 	}()
 
 	for {
 		select {
-		case message, ok := <-c.send:
-			if !ok {
-				return
-			}
+		case message := <-c.send:
 			ctx, cancel := context.WithTimeout(context.Background(), writeWait)
 			err := c.conn.Write(ctx, websocket.MessageText, message)
 			cancel()
 			if err != nil {
-				log.Printf("ws: write error to %s: %v", c.userID, err)
+				slog.Debug("ws: write error", "user_id", c.userID, "err", err)
 				return
 			}
 
@@ -117,7 +159,7 @@ func (c *Client) WritePump() {
 			err := c.conn.Ping(ctx)
 			cancel()
 			if err != nil {
-				log.Printf("ws: ping error to %s: %v", c.userID, err)
+				slog.Debug("ws: ping error", "user_id", c.userID, "err", err)
 				return
 			}
 
@@ -137,7 +179,7 @@ func (c *Client) handleEvent(event *Event) {
 			return
 		}
 		c.Subscribe(p.ChannelID)
-		log.Printf("ws: %s subscribed to channel %s", c.userID, p.ChannelID)
+		slog.Debug("ws: subscribed", "user_id", c.userID, "channel_id", p.ChannelID)
 
 	case EventTypeChannelUnsubscribe:
 		var p ChannelPayload
@@ -146,7 +188,7 @@ func (c *Client) handleEvent(event *Event) {
 			return
 		}
 		c.Unsubscribe(p.ChannelID)
-		log.Printf("ws: %s unsubscribed from channel %s", c.userID, p.ChannelID)
+		slog.Debug("ws: unsubscribed", "user_id", c.userID, "channel_id", p.ChannelID)
 
 	case EventTypeTypingStart, EventTypeTypingStop:
 		if event.ChannelID == nil {
@@ -172,7 +214,19 @@ func (c *Client) sendPong() {
 }
 
 func (c *Client) sendError(code, message string) {
-	evt, err := NewEvent(EventTypeError, nil, ErrorPayload{Code: code, Message: message})
+	c.sendErrorPayload(ErrorPayload{Code: code, Message: message})
+}
+
+func (c *Client) sendRateLimited(retryAfter time.Duration) {
+	c.sendErrorPayload(ErrorPayload{
+		Code:         "RATE_LIMITED",
+		Message:      "too many events, slow down",
+		RetryAfterMs: retryAfter.Milliseconds(),
+	})
+}
+
+func (c *Client) sendErrorPayload(payload ErrorPayload) {
+	evt, err := NewEvent(EventTypeError, nil, payload)
 	if err != nil {
 		return
 	}
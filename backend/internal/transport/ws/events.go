@@ -23,9 +23,17 @@ const (
 	EventTypeMessageNew     = "message.new"
 	EventTypeMessageEdited  = "message.edited"
 	EventTypeMessageDeleted = "message.deleted"
+	EventTypeMessageUpdated = "message.updated"
 	EventTypeDMNew          = "dm.new"
 	EventTypeDMEdited       = "dm.edited"
 	EventTypeDMDeleted      = "dm.deleted"
+	EventTypeChannelUpdated = "channel.updated"
+	EventTypePinAdded       = "pin.added"
+	EventTypePinRemoved     = "pin.removed"
+	EventTypeBookmarkAdded  = "bookmark.added"
+	EventTypeBookmarkUpdated = "bookmark.updated"
+	EventTypeBookmarkRemoved = "bookmark.removed"
+	EventTypeReminderDue    = "reminder.due"
 	EventTypeTyping         = "typing"
 	EventTypePresence       = "presence"
 	EventTypePong           = "pong"
@@ -69,6 +77,30 @@ type DMMessageDeletedPayload struct {
 	ID uuid.UUID `json:"id"`
 }
 
+type ChannelUpdatedPayload struct {
+	domain.Channel
+}
+
+type PinPayload struct {
+	domain.PinnedMessage
+}
+
+type PinRemovedPayload struct {
+	MessageID uuid.UUID `json:"message_id"`
+}
+
+type BookmarkPayload struct {
+	domain.ChannelBookmark
+}
+
+type BookmarkRemovedPayload struct {
+	ID uuid.UUID `json:"id"`
+}
+
+type ReminderPayload struct {
+	domain.SavedItem
+}
+
 type TypingPayload struct {
 	UserID      uuid.UUID `json:"user_id"`
 	Username    string    `json:"username"`
@@ -83,6 +115,8 @@ type PresencePayload struct {
 type ErrorPayload struct {
 	Code    string `json:"code"`
 	Message string `json:"message"`
+	// Set with RATE_LIMITED: milliseconds until events are accepted again
+	RetryAfterMs int64 `json:"retry_after_ms,omitempty"`
 }
 
 // NewEvent creates a server→client event with the current timestamp.
@@ -1,17 +1,35 @@
 package ws
 
 import (
-	"log"
+	"context"
+	"log/slog"
 	"net/http"
+	"net/url"
 
-	"github.com/golang-jwt/jwt/v5"
-	"github.com/google/uuid"
+	"github.com/vedran77/pulse/internal/domain"
 	"nhooyr.io/websocket"
 )
 
+// TokenValidator validates an access token and returns its session.
+type TokenValidator interface {
+	ValidateAccessToken(ctx context.Context, token string) (domain.Session, error)
+}
+
 // ServeWS returns an HTTP handler that upgrades to WebSocket.
 // Auth is done via ?token=xxx query param (WebSocket can't send headers).
-func ServeWS(hub *Hub, jwtSecret string) http.HandlerFunc {
+// allowedOrigins are the browser origins allowed to connect ("*" allows any).
+func ServeWS(hub *Hub, validator TokenValidator, allowedOrigins []string) http.HandlerFunc {
+	acceptOpts := &websocket.AcceptOptions{}
+	for _, origin := range allowedOrigins {
+		if origin == "*" {
+			acceptOpts.InsecureSkipVerify = true
+			break
+		}
+		if u, err := url.Parse(origin); err == nil && u.Host != "" {
+			acceptOpts.OriginPatterns = append(acceptOpts.OriginPatterns, u.Host)
+		}
+	}
+
 	return func(w http.ResponseWriter, r *http.Request) {
 		// Extract token from query param
 		tokenStr := r.URL.Query().Get("token")
@@ -21,47 +39,27 @@ func ServeWS(hub *Hub, jwtSecret string) http.HandlerFunc {
 		}
 
 		// Validate JWT
-		userID, err := validateToken(tokenStr, jwtSecret)
+		session, err := validator.ValidateAccessToken(r.Context(), tokenStr)
 		if err != nil {
 			http.Error(w, "invalid token", http.StatusUnauthorized)
 			return
 		}
 
 		// Accept WebSocket upgrade
-		conn, err := websocket.Accept(w, r, &websocket.AcceptOptions{
-			InsecureSkipVerify: true, // Allow any origin (dev mode)
-		})
+		conn, err := websocket.Accept(w, r, acceptOpts)
 		if err != nil {
-			log.Printf("ws: accept error: %v", err)
+			slog.WarnContext(r.Context(), "ws: accept", "err", err)
 			return
 		}
 
-		client := NewClient(hub, conn, userID)
-		hub.register <- client
+		client := NewClient(hub, conn, session.UserID)
+		if !hub.Register(client) {
+			conn.Close(websocket.StatusServiceRestart, "server restarting")
+			return
+		}
 
 		// Start read/write pumps in goroutines
 		go client.WritePump()
 		go client.ReadPump()
 	}
 }
-
-func validateToken(tokenStr, secret string) (uuid.UUID, error) {
-	token, err := jwt.Parse(tokenStr, func(t *jwt.Token) (any, error) {
-		return []byte(secret), nil
-	})
-	if err != nil || !token.Valid {
-		return uuid.Nil, err
-	}
-
-	claims, ok := token.Claims.(jwt.MapClaims)
-	if !ok {
-		return uuid.Nil, jwt.ErrTokenInvalidClaims
-	}
-
-	sub, err := claims.GetSubject()
-	if err != nil {
-		return uuid.Nil, err
-	}
-
-	return uuid.Parse(sub)
-}
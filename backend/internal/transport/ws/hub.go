@@ -1,10 +1,18 @@
 package ws
 
 import (
+	"context"
 	"encoding/json"
-	"log"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/google/uuid"
+	"github.com/vedran77/pulse/internal/ratelimit"
+	"nhooyr.io/websocket"
 )
 
 // Hub manages all active WebSocket clients and routes messages.
@@ -15,6 +23,40 @@ type Hub struct {
 	register   chan *Client
 	unregister chan *Client
 	broadcast  chan *broadcastMsg
+	direct     chan *directMsg
+
+	// stop is closed by Shutdown, stopped when Run has returned
+	stop     chan struct{}
+	stopped  chan struct{}
+	stopOnce sync.Once
+
+	// conns tracks open connections until their write pump exits
+	conns sync.WaitGroup
+
+	// Counters readable outside Run, for metrics
+	clientCount atomic.Int64
+	dropped     atomic.Uint64
+	// Users with at least one connection, readable outside Run
+	online sync.Map
+
+	// Unix nanos of the Run loop's last heartbeat, for liveness checks
+	lastBeat atomic.Int64
+
+	// Optional per-user limit on client events
+	limiter    ratelimit.Store
+	eventLimit ratelimit.Limit
+}
+
+// heartbeatInterval is how often the Run loop records that it's not stuck.
+const heartbeatInterval = 5 * time.Second
+
+// HubStats is a snapshot of the hub for metrics.
+type HubStats struct {
+	Clients int
+	// Broadcasts waiting for the hub loop
+	QueueDepth int
+	// Clients disconnected because their send buffer was full
+	Dropped uint64
 }
 
 type broadcastMsg struct {
@@ -23,13 +65,70 @@ type broadcastMsg struct {
 	excludeID *uuid.UUID // optional: skip this user (e.g. sender)
 }
 
+type directMsg struct {
+	userID uuid.UUID
+	data   []byte
+}
+
 func NewHub() *Hub {
 	return &Hub{
 		clients:    make(map[uuid.UUID]map[*Client]struct{}),
 		register:   make(chan *Client),
 		unregister: make(chan *Client),
 		broadcast:  make(chan *broadcastMsg, 256),
+		direct:     make(chan *directMsg, 256),
+		stop:       make(chan struct{}),
+		stopped:    make(chan struct{}),
+	}
+}
+
+// SetRateLimit limits how many events each user can send across all their
+// connections (optional).
+func (h *Hub) SetRateLimit(store ratelimit.Store, limit ratelimit.Limit) {
+	h.limiter = store
+	h.eventLimit = limit
+}
+
+// allowEvent takes a token from the user's event bucket.
+func (h *Hub) allowEvent(ctx context.Context, userID uuid.UUID) ratelimit.Result {
+	if h.limiter == nil {
+		return ratelimit.Result{Allowed: true}
+	}
+
+	res, err := h.limiter.Allow(ctx, "ws:user:"+userID.String(), h.eventLimit)
+	if err != nil {
+		slog.ErrorContext(ctx, "ws hub: rate limit store", "err", err)
+		return ratelimit.Result{Allowed: true}
 	}
+	return res
+}
+
+// Stats returns current counters. Safe to call from any goroutine.
+func (h *Hub) Stats() HubStats {
+	return HubStats{
+		Clients:    int(h.clientCount.Load()),
+		QueueDepth: len(h.broadcast) + len(h.direct),
+		Dropped:    h.dropped.Load(),
+	}
+}
+
+// CheckAlive returns an error when the Run loop hasn't recorded a heartbeat
+// within maxStale, i.e. it's blocked. A hub that was shut down is not an error.
+func (h *Hub) CheckAlive(maxStale time.Duration) error {
+	select {
+	case <-h.stopped:
+		return nil
+	default:
+	}
+
+	last := h.lastBeat.Load()
+	if last == 0 {
+		return errors.New("hub loop not running")
+	}
+	if since := time.Since(time.Unix(0, last)); since > maxStale {
+		return fmt.Errorf("hub loop stalled for %s", since.Round(time.Second))
+	}
+	return nil
 }
 
 // totalClients returns the total number of connected clients.
@@ -42,36 +141,37 @@ func (h *Hub) totalClients() int {
 }
 
 // Run starts the Hub's main event loop. Call this in a goroutine.
+// It returns after Shutdown is called.
 func (h *Hub) Run() {
+	defer close(h.stopped)
+
+	heartbeat := time.NewTicker(heartbeatInterval)
+	defer heartbeat.Stop()
+	h.lastBeat.Store(time.Now().UnixNano())
+
 	for {
 		select {
+		case now := <-heartbeat.C:
+			h.lastBeat.Store(now.UnixNano())
+
 		case client := <-h.register:
 			if h.clients[client.userID] == nil {
 				h.clients[client.userID] = make(map[*Client]struct{})
 			}
 			wasEmpty := len(h.clients[client.userID]) == 0
 			h.clients[client.userID][client] = struct{}{}
-			log.Printf("ws hub: user %s connected (%d total)", client.userID, h.totalClients())
+			h.clientCount.Add(1)
+			slog.Debug("ws hub: client connected", "user_id", client.userID, "total", h.totalClients())
 
 			// Broadcast presence online only on first connection
 			if wasEmpty {
+				h.online.Store(client.userID, struct{}{})
 				h.broadcastPresence(client.userID, "online")
 			}
 
 		case client := <-h.unregister:
-			if set, ok := h.clients[client.userID]; ok {
-				if _, exists := set[client]; exists {
-					delete(set, client)
-					close(client.send)
-					close(client.done)
-					log.Printf("ws hub: user %s disconnected (%d total)", client.userID, h.totalClients())
-
-					// Broadcast presence offline only when last connection drops
-					if len(set) == 0 {
-						delete(h.clients, client.userID)
-						h.broadcastPresence(client.userID, "offline")
-					}
-				}
+			if h.removeClient(client) {
+				slog.Debug("ws hub: client disconnected", "user_id", client.userID, "total", h.totalClients())
 			}
 
 		case msg := <-h.broadcast:
@@ -85,47 +185,153 @@ func (h *Hub) Run() {
 					if !client.IsSubscribed(msg.channelID) {
 						continue
 					}
-					select {
-					case client.send <- msg.data:
-					default:
-						// Client buffer full - disconnect
-						delete(set, client)
-						close(client.send)
-						close(client.done)
-					}
+					h.deliver(client, msg.data)
 				}
 			}
+
+		case msg := <-h.direct:
+			for client := range h.clients[msg.userID] {
+				h.deliver(client, msg.data)
+			}
+
+		case <-h.stop:
+			n := h.totalClients()
+			for _, set := range h.clients {
+				for client := range set {
+					// Clients should reconnect, ideally to another instance
+					client.close(websocket.StatusServiceRestart, "server restarting")
+				}
+			}
+			h.clients = make(map[uuid.UUID]map[*Client]struct{})
+			h.clientCount.Store(0)
+			h.online.Clear()
+			slog.Info("ws hub: stopped", "closing_clients", n)
+			return
 		}
 	}
 }
 
+// deliver queues data for a client, disconnecting it if its buffer is full.
+func (h *Hub) deliver(client *Client, data []byte) {
+	select {
+	case client.send <- data:
+	default:
+		slog.Warn("ws hub: client too slow, disconnecting", "user_id", client.userID)
+		client.close(websocket.StatusTryAgainLater, "client too slow")
+		if h.removeClient(client) {
+			h.dropped.Add(1)
+		}
+	}
+}
+
+// removeClient drops a client from the hub and broadcasts presence offline
+// when it was the user's last connection. Reports whether it was registered.
+func (h *Hub) removeClient(client *Client) bool {
+	set, ok := h.clients[client.userID]
+	if !ok {
+		return false
+	}
+	if _, exists := set[client]; !exists {
+		return false
+	}
+	delete(set, client)
+	h.clientCount.Add(-1)
+	client.close(websocket.StatusNormalClosure, "")
+
+	// Broadcast presence offline only when last connection drops
+	if len(set) == 0 {
+		delete(h.clients, client.userID)
+		h.online.Delete(client.userID)
+		h.broadcastPresence(client.userID, "offline")
+	}
+	return true
+}
+
+// Register adds a client to the hub. It returns false once the hub is
+// shutting down, in which case the caller should close the connection.
+// A registered client's WritePump must run so Shutdown can finish.
+func (h *Hub) Register(client *Client) bool {
+	select {
+	case <-h.stop:
+		return false
+	default:
+	}
+
+	h.conns.Add(1)
+	select {
+	case h.register <- client:
+		return true
+	case <-h.stopped:
+		h.conns.Done()
+		return false
+	}
+}
+
+// Unregister removes a client from the hub.
+func (h *Hub) Unregister(client *Client) {
+	select {
+	case h.unregister <- client:
+	case <-h.stopped:
+	}
+}
+
+// Shutdown stops the hub, closes every client with a service restart status
+// so it reconnects elsewhere, and waits for connections to finish closing.
+func (h *Hub) Shutdown(ctx context.Context) error {
+	h.stopOnce.Do(func() { close(h.stop) })
+
+	select {
+	case <-h.stopped:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	done := make(chan struct{})
+	go func() {
+		h.conns.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
 // BroadcastToChannel sends an event to all subscribers of a channel.
 func (h *Hub) BroadcastToChannel(channelID uuid.UUID, event *Event, excludeUserID *uuid.UUID) {
 	data, err := json.Marshal(event)
 	if err != nil {
-		log.Printf("ws hub: marshal error: %v", err)
+		slog.Error("ws hub: marshal event", "err", err)
 		return
 	}
-	h.broadcast <- &broadcastMsg{
+	select {
+	case h.broadcast <- &broadcastMsg{
 		channelID: channelID,
 		data:      data,
 		excludeID: excludeUserID,
+	}:
+	case <-h.stopped:
 	}
 }
 
+// IsOnline reports whether the user has a connection to this server. Safe to
+// call from any goroutine.
+func (h *Hub) IsOnline(userID uuid.UUID) bool {
+	_, ok := h.online.Load(userID)
+	return ok
+}
+
 // BroadcastToUser sends an event directly to a specific user (all tabs).
 func (h *Hub) BroadcastToUser(userID uuid.UUID, event *Event) {
 	data, err := json.Marshal(event)
 	if err != nil {
 		return
 	}
-	if set, ok := h.clients[userID]; ok {
-		for client := range set {
-			select {
-			case client.send <- data:
-			default:
-			}
-		}
+	select {
+	case h.direct <- &directMsg{userID: userID, data: data}:
+	case <-h.stopped:
 	}
 }
 
@@ -1,7 +1,7 @@
 package ws
 
 import (
-	"log"
+	"log/slog"
 
 	"github.com/google/uuid"
 	"github.com/vedran77/pulse/internal/domain"
@@ -19,7 +19,7 @@ func NewHubNotifier(hub *Hub) *HubNotifier {
 func (n *HubNotifier) NotifyNewMessage(msg *domain.Message) {
 	evt, err := NewEvent(EventTypeMessageNew, &msg.ChannelID, MessagePayload{Message: *msg})
 	if err != nil {
-		log.Printf("ws notifier: marshal error: %v", err)
+		slog.Error("ws notifier: marshal event", "err", err)
 		return
 	}
 	n.hub.BroadcastToChannel(msg.ChannelID, evt, nil)
@@ -28,7 +28,7 @@ func (n *HubNotifier) NotifyNewMessage(msg *domain.Message) {
 func (n *HubNotifier) NotifyEditedMessage(msg *domain.Message) {
 	evt, err := NewEvent(EventTypeMessageEdited, &msg.ChannelID, MessagePayload{Message: *msg})
 	if err != nil {
-		log.Printf("ws notifier: marshal error: %v", err)
+		slog.Error("ws notifier: marshal event", "err", err)
 		return
 	}
 	n.hub.BroadcastToChannel(msg.ChannelID, evt, nil)
@@ -37,7 +37,70 @@ func (n *HubNotifier) NotifyEditedMessage(msg *domain.Message) {
 func (n *HubNotifier) NotifyDeletedMessage(channelID, messageID uuid.UUID) {
 	evt, err := NewEvent(EventTypeMessageDeleted, &channelID, MessageDeletedPayload{ID: messageID})
 	if err != nil {
-		log.Printf("ws notifier: marshal error: %v", err)
+		slog.Error("ws notifier: marshal event", "err", err)
+		return
+	}
+	n.hub.BroadcastToChannel(channelID, evt, nil)
+}
+
+func (n *HubNotifier) NotifyUpdatedMessage(msg *domain.Message) {
+	evt, err := NewEvent(EventTypeMessageUpdated, &msg.ChannelID, MessagePayload{Message: *msg})
+	if err != nil {
+		slog.Error("ws notifier: marshal event", "err", err)
+		return
+	}
+	n.hub.BroadcastToChannel(msg.ChannelID, evt, nil)
+}
+
+func (n *HubNotifier) NotifyChannelUpdated(ch *domain.Channel) {
+	evt, err := NewEvent(EventTypeChannelUpdated, &ch.ID, ChannelUpdatedPayload{Channel: *ch})
+	if err != nil {
+		slog.Error("ws notifier: marshal event", "err", err)
+		return
+	}
+	n.hub.BroadcastToChannel(ch.ID, evt, nil)
+}
+
+func (n *HubNotifier) NotifyPinAdded(pin *domain.PinnedMessage) {
+	evt, err := NewEvent(EventTypePinAdded, &pin.ChannelID, PinPayload{PinnedMessage: *pin})
+	if err != nil {
+		slog.Error("ws notifier: marshal event", "err", err)
+		return
+	}
+	n.hub.BroadcastToChannel(pin.ChannelID, evt, nil)
+}
+
+func (n *HubNotifier) NotifyPinRemoved(channelID, messageID uuid.UUID) {
+	evt, err := NewEvent(EventTypePinRemoved, &channelID, PinRemovedPayload{MessageID: messageID})
+	if err != nil {
+		slog.Error("ws notifier: marshal event", "err", err)
+		return
+	}
+	n.hub.BroadcastToChannel(channelID, evt, nil)
+}
+
+func (n *HubNotifier) NotifyBookmarkAdded(bookmark *domain.ChannelBookmark) {
+	evt, err := NewEvent(EventTypeBookmarkAdded, &bookmark.ChannelID, BookmarkPayload{ChannelBookmark: *bookmark})
+	if err != nil {
+		slog.Error("ws notifier: marshal event", "err", err)
+		return
+	}
+	n.hub.BroadcastToChannel(bookmark.ChannelID, evt, nil)
+}
+
+func (n *HubNotifier) NotifyBookmarkUpdated(bookmark *domain.ChannelBookmark) {
+	evt, err := NewEvent(EventTypeBookmarkUpdated, &bookmark.ChannelID, BookmarkPayload{ChannelBookmark: *bookmark})
+	if err != nil {
+		slog.Error("ws notifier: marshal event", "err", err)
+		return
+	}
+	n.hub.BroadcastToChannel(bookmark.ChannelID, evt, nil)
+}
+
+func (n *HubNotifier) NotifyBookmarkRemoved(channelID, bookmarkID uuid.UUID) {
+	evt, err := NewEvent(EventTypeBookmarkRemoved, &channelID, BookmarkRemovedPayload{ID: bookmarkID})
+	if err != nil {
+		slog.Error("ws notifier: marshal event", "err", err)
 		return
 	}
 	n.hub.BroadcastToChannel(channelID, evt, nil)
@@ -46,7 +109,7 @@ func (n *HubNotifier) NotifyDeletedMessage(channelID, messageID uuid.UUID) {
 func (n *HubNotifier) NotifyNewDM(msg *domain.DMMessage) {
 	evt, err := NewEvent(EventTypeDMNew, &msg.ConversationID, DMMessagePayload{DMMessage: *msg})
 	if err != nil {
-		log.Printf("ws notifier: marshal error: %v", err)
+		slog.Error("ws notifier: marshal event", "err", err)
 		return
 	}
 	n.hub.BroadcastToChannel(msg.ConversationID, evt, nil)
@@ -55,7 +118,7 @@ func (n *HubNotifier) NotifyNewDM(msg *domain.DMMessage) {
 func (n *HubNotifier) NotifyEditedDM(msg *domain.DMMessage) {
 	evt, err := NewEvent(EventTypeDMEdited, &msg.ConversationID, DMMessagePayload{DMMessage: *msg})
 	if err != nil {
-		log.Printf("ws notifier: marshal error: %v", err)
+		slog.Error("ws notifier: marshal event", "err", err)
 		return
 	}
 	n.hub.BroadcastToChannel(msg.ConversationID, evt, nil)
@@ -64,8 +127,22 @@ func (n *HubNotifier) NotifyEditedDM(msg *domain.DMMessage) {
 func (n *HubNotifier) NotifyDeletedDM(conversationID, messageID uuid.UUID) {
 	evt, err := NewEvent(EventTypeDMDeleted, &conversationID, DMMessageDeletedPayload{ID: messageID})
 	if err != nil {
-		log.Printf("ws notifier: marshal error: %v", err)
+		slog.Error("ws notifier: marshal event", "err", err)
 		return
 	}
 	n.hub.BroadcastToChannel(conversationID, evt, nil)
 }
+
+// NotifyReminderDue sends the reminder to the user's connections, if any.
+func (n *HubNotifier) NotifyReminderDue(userID uuid.UUID, item *domain.SavedItem) bool {
+	if !n.hub.IsOnline(userID) {
+		return false
+	}
+	evt, err := NewEvent(EventTypeReminderDue, nil, ReminderPayload{SavedItem: *item})
+	if err != nil {
+		slog.Error("ws notifier: marshal event", "err", err)
+		return false
+	}
+	n.hub.BroadcastToUser(userID, evt)
+	return true
+}
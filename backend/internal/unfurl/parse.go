@@ -0,0 +1,124 @@
+package unfurl
+
+import (
+	"bytes"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/net/html"
+)
+
+const (
+	maxTitleLength       = 256
+	maxDescriptionLength = 1024
+	maxURLLength         = 2048
+)
+
+type pageMeta struct {
+	title       string
+	description string
+	// og holds OpenGraph and Twitter card properties, without the "og:" prefix
+	og map[string]string
+	// oEmbed is the JSON oEmbed discovery link, possibly relative
+	oEmbed string
+}
+
+// parseHTML reads the metadata in the document head. It stops at the body,
+// so a page truncated by the size limit usually still has everything needed.
+func parseHTML(body []byte) pageMeta {
+	meta := pageMeta{og: make(map[string]string)}
+	z := html.NewTokenizer(bytes.NewReader(body))
+	inTitle := false
+	for {
+		switch z.Next() {
+		case html.ErrorToken:
+			return meta
+
+		case html.TextToken:
+			if inTitle && meta.title == "" {
+				meta.title = string(z.Text())
+			}
+
+		case html.EndTagToken:
+			name, _ := z.TagName()
+			switch string(name) {
+			case "title":
+				inTitle = false
+			case "head":
+				return meta
+			}
+
+		case html.StartTagToken, html.SelfClosingTagToken:
+			name, hasAttr := z.TagName()
+			switch string(name) {
+			case "body":
+				return meta
+			case "title":
+				inTitle = true
+			case "meta":
+				if hasAttr {
+					meta.addMeta(attrs(z))
+				}
+			case "link":
+				a := attrs(z)
+				if hasToken(a["rel"], "alternate") && a["type"] == "application/json+oembed" && meta.oEmbed == "" {
+					meta.oEmbed = a["href"]
+				}
+			}
+		}
+	}
+}
+
+func (m *pageMeta) addMeta(a map[string]string) {
+	content := a["content"]
+	if content == "" {
+		return
+	}
+	// OpenGraph uses property=, Twitter cards and plain descriptions use name=
+	key := strings.ToLower(a["property"])
+	if key == "" {
+		key = strings.ToLower(a["name"])
+	}
+	switch {
+	case key == "description":
+		m.description = content
+	case strings.HasPrefix(key, "og:"):
+		key = strings.TrimPrefix(key, "og:")
+		fallthrough
+	case strings.HasPrefix(key, "twitter:"):
+		// The first value wins, e.g. for pages listing several og:image tags
+		if _, ok := m.og[key]; !ok {
+			m.og[key] = content
+		}
+	}
+}
+
+func attrs(z *html.Tokenizer) map[string]string {
+	a := make(map[string]string)
+	for {
+		key, val, more := z.TagAttr()
+		a[string(key)] = string(val)
+		if !more {
+			return a
+		}
+	}
+}
+
+func hasToken(list, token string) bool {
+	for _, t := range strings.Fields(list) {
+		if strings.EqualFold(t, token) {
+			return true
+		}
+	}
+	return false
+}
+
+// clean collapses whitespace, drops invalid UTF-8 and truncates s to limit runes.
+func clean(s string, limit int) string {
+	s = strings.Join(strings.Fields(strings.ToValidUTF8(s, "")), " ")
+	if utf8.RuneCountInString(s) <= limit {
+		return s
+	}
+	r := []rune(s)
+	return strings.TrimSpace(string(r[:limit-1])) + "…"
+}
@@ -0,0 +1,249 @@
+// Package unfurl builds link previews from a page's OpenGraph tags and
+// oEmbed data. Pages are fetched with SSRF protection: connections to
+// loopback, private and other non-public addresses are refused, including
+// after redirects, and every fetch is bounded by a timeout and a size limit.
+package unfurl
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"slices"
+	"syscall"
+	"time"
+
+	"github.com/vedran77/pulse/internal/domain"
+)
+
+var (
+	ErrBlockedAddress = errors.New("unfurl: address not allowed")
+	ErrNoPreview      = errors.New("unfurl: no preview metadata")
+)
+
+const maxRedirects = 5
+
+type Config struct {
+	// Timeout bounds a whole preview, including redirects and oEmbed; defaults to 5 seconds
+	Timeout time.Duration
+	// MaxBytes is how much of each response is read; defaults to 512 KiB
+	MaxBytes int64
+	// AllowPrivate permits non-public addresses, for tests against a local server
+	AllowPrivate bool
+	// UserAgent defaults to "PulseBot/1.0 (link preview)"
+	UserAgent string
+}
+
+type Fetcher struct {
+	cfg    Config
+	client *http.Client
+}
+
+func New(cfg Config) *Fetcher {
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 5 * time.Second
+	}
+	if cfg.MaxBytes <= 0 {
+		cfg.MaxBytes = 512 << 10
+	}
+	if cfg.UserAgent == "" {
+		cfg.UserAgent = "PulseBot/1.0 (link preview)"
+	}
+
+	dialer := &net.Dialer{Timeout: cfg.Timeout}
+	if !cfg.AllowPrivate {
+		// Control sees the resolved address of every connection, so DNS
+		// names pointing at internal hosts and redirects are covered too
+		dialer.Control = checkAddress
+	}
+	transport := &http.Transport{
+		// A proxy would connect on our behalf and bypass the address check
+		Proxy:                 nil,
+		DialContext:           dialer.DialContext,
+		ForceAttemptHTTP2:     true,
+		TLSHandshakeTimeout:   cfg.Timeout,
+		ResponseHeaderTimeout: cfg.Timeout,
+		MaxIdleConns:          16,
+		IdleConnTimeout:       90 * time.Second,
+	}
+	return &Fetcher{
+		cfg: cfg,
+		client: &http.Client{
+			Transport:     transport,
+			Timeout:       cfg.Timeout,
+			CheckRedirect: checkRedirect,
+		},
+	}
+}
+
+// Preview fetches rawURL and returns its preview. It returns ErrNoPreview
+// when the page isn't HTML or has no title or description.
+func (f *Fetcher) Preview(ctx context.Context, rawURL string) (*domain.MessageEmbed, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || !isHTTP(u) {
+		return nil, fmt.Errorf("unfurl: unsupported URL %q", rawURL)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, f.cfg.Timeout)
+	defer cancel()
+
+	body, pageURL, err := f.get(ctx, u, "text/html", "application/xhtml+xml")
+	if err != nil {
+		return nil, err
+	}
+	meta := parseHTML(body)
+
+	embed := &domain.MessageEmbed{
+		URL:         rawURL,
+		Title:       clean(first(meta.og["title"], meta.og["twitter:title"], meta.title), maxTitleLength),
+		Description: clean(first(meta.og["description"], meta.og["twitter:description"], meta.description), maxDescriptionLength),
+		ImageURL:    resolve(pageURL, first(meta.og["image"], meta.og["image:url"], meta.og["twitter:image"])),
+		SiteName:    clean(meta.og["site_name"], maxTitleLength),
+	}
+
+	// oEmbed fills in what the page itself doesn't say, e.g. on sites that
+	// render their metadata client-side
+	if meta.oEmbed != "" && (embed.Title == "" || embed.ImageURL == "" || embed.SiteName == "") {
+		if endpoint, err := pageURL.Parse(meta.oEmbed); err == nil && isHTTP(endpoint) {
+			if oe, err := f.fetchOEmbed(ctx, endpoint); err == nil {
+				embed.Title = first(embed.Title, clean(oe.Title, maxTitleLength))
+				embed.SiteName = first(embed.SiteName, clean(oe.ProviderName, maxTitleLength))
+				embed.ImageURL = first(embed.ImageURL, resolve(endpoint, oe.ThumbnailURL))
+			}
+		}
+	}
+
+	if embed.Title == "" && embed.Description == "" {
+		return nil, ErrNoPreview
+	}
+	return embed, nil
+}
+
+type oEmbed struct {
+	Title        string `json:"title"`
+	ProviderName string `json:"provider_name"`
+	ThumbnailURL string `json:"thumbnail_url"`
+}
+
+func (f *Fetcher) fetchOEmbed(ctx context.Context, endpoint *url.URL) (*oEmbed, error) {
+	body, _, err := f.get(ctx, endpoint, "application/json", "text/json")
+	if err != nil {
+		return nil, err
+	}
+	var oe oEmbed
+	if err := json.Unmarshal(body, &oe); err != nil {
+		return nil, fmt.Errorf("unfurl: decoding oEmbed: %w", err)
+	}
+	return &oe, nil
+}
+
+// get fetches u and reads at most MaxBytes of the body. It returns the URL
+// of the final response, after redirects, for resolving relative links.
+func (f *Fetcher) get(ctx context.Context, u *url.URL, mediaTypes ...string) ([]byte, *url.URL, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	req.Header.Set("User-Agent", f.cfg.UserAgent)
+	req.Header.Set("Accept", mediaTypes[0])
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, nil, fmt.Errorf("unfurl: %s returned %s", u.Redacted(), resp.Status)
+	}
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if !slices.Contains(mediaTypes, mediaType) {
+		return nil, nil, fmt.Errorf("%w: content type %q", ErrNoPreview, mediaType)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, f.cfg.MaxBytes))
+	if err != nil {
+		return nil, nil, err
+	}
+	return body, resp.Request.URL, nil
+}
+
+func checkRedirect(req *http.Request, via []*http.Request) error {
+	if len(via) >= maxRedirects {
+		return fmt.Errorf("unfurl: stopped after %d redirects", maxRedirects)
+	}
+	if !isHTTP(req.URL) {
+		return fmt.Errorf("unfurl: redirect to unsupported URL %q", req.URL.Redacted())
+	}
+	return nil
+}
+
+// checkAddress is a net.Dialer Control function that refuses connections
+// to addresses that aren't on the public internet.
+func checkAddress(network, address string, _ syscall.RawConn) error {
+	ap, err := netip.ParseAddrPort(address)
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrBlockedAddress, address)
+	}
+	if blocked(ap.Addr()) {
+		return fmt.Errorf("%w: %s", ErrBlockedAddress, ap.Addr())
+	}
+	return nil
+}
+
+// Special-purpose ranges that netip doesn't classify as private but that
+// aren't reachable public hosts either.
+var blockedPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),      // "this" network
+	netip.MustParsePrefix("100.64.0.0/10"),  // carrier-grade NAT
+	netip.MustParsePrefix("192.0.0.0/24"),   // IETF protocol assignments
+	netip.MustParsePrefix("198.18.0.0/15"),  // benchmarking
+	netip.MustParsePrefix("240.0.0.0/4"),    // reserved
+	netip.MustParsePrefix("64:ff9b::/96"),   // NAT64, may embed a private IPv4 address
+	netip.MustParsePrefix("64:ff9b:1::/48"), // local-use NAT64
+}
+
+func blocked(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	if !addr.IsGlobalUnicast() || addr.IsPrivate() {
+		// Loopback, link-local, multicast, unspecified and RFC 1918 / ULA
+		return true
+	}
+	for _, p := range blockedPrefixes {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+func isHTTP(u *url.URL) bool {
+	return (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+// resolve makes ref absolute against base. Only http(s) URLs are kept.
+func resolve(base *url.URL, ref string) string {
+	if ref == "" || len(ref) > maxURLLength {
+		return ""
+	}
+	u, err := base.Parse(ref)
+	if err != nil || !isHTTP(u) {
+		return ""
+	}
+	return u.String()
+}
+
+func first(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
@@ -0,0 +1,149 @@
+package unfurl
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strings"
+	"testing"
+	"time"
+)
+
+const page = `<!doctype html>
+<html><head>
+<title>Fallback title</title>
+<meta property="og:title" content="  Fix   the flaky test ">
+<meta property="og:description" content="Retries the connection once.">
+<meta property="og:image" content="/social.png">
+<meta property="og:image" content="/second.png">
+<meta property="og:site_name" content="Forge">
+</head><body><meta property="og:title" content="in the body"></body></html>`
+
+func newServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	mux := http.NewServeMux()
+	mux.HandleFunc("/pr/1", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write([]byte(page))
+	})
+	mux.HandleFunc("/moved", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/pr/1", http.StatusFound)
+	})
+	mux.HandleFunc("/dashboard", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(`<html><head><meta name="description" content="Latency by route">
+<link rel="alternate" type="application/json+oembed" href="/oembed?url=dashboard"></head></html>`))
+	})
+	mux.HandleFunc("/oembed", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"title":"API latency","provider_name":"Grafana","thumbnail_url":"https://img.example.com/thumb.png"}`))
+	})
+	mux.HandleFunc("/image.png", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/png")
+		w.Write([]byte("\x89PNG"))
+	})
+	mux.HandleFunc("/huge", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte("<html><head>" + strings.Repeat("<!-- padding -->", 1000)))
+		w.Write([]byte(`<meta property="og:title" content="past the limit"></head></html>`))
+	})
+	mux.HandleFunc("/slow", func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(2 * time.Second):
+		case <-r.Context().Done():
+		}
+	})
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestPreview(t *testing.T) {
+	srv := newServer(t)
+	f := New(Config{AllowPrivate: true, Timeout: time.Second, MaxBytes: 4096})
+	ctx := context.Background()
+
+	embed, err := f.Preview(ctx, srv.URL+"/moved")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if embed.URL != srv.URL+"/moved" || embed.Title != "Fix the flaky test" || embed.Description != "Retries the connection once." ||
+		embed.ImageURL != srv.URL+"/social.png" || embed.SiteName != "Forge" {
+		t.Fatalf("OpenGraph preview = %+v", embed)
+	}
+
+	embed, err = f.Preview(ctx, srv.URL+"/dashboard")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if embed.Title != "API latency" || embed.Description != "Latency by route" ||
+		embed.ImageURL != "https://img.example.com/thumb.png" || embed.SiteName != "Grafana" {
+		t.Fatalf("oEmbed preview = %+v", embed)
+	}
+
+	if _, err := f.Preview(ctx, srv.URL+"/image.png"); !errors.Is(err, ErrNoPreview) {
+		t.Fatalf("image: err = %v, want ErrNoPreview", err)
+	}
+	if _, err := f.Preview(ctx, srv.URL+"/huge"); !errors.Is(err, ErrNoPreview) {
+		t.Fatalf("metadata past the size limit: err = %v, want ErrNoPreview", err)
+	}
+	if _, err := f.Preview(ctx, srv.URL+"/missing"); err == nil {
+		t.Fatal("404 page previewed")
+	}
+	if _, err := f.Preview(ctx, "ftp://example.com/file"); err == nil {
+		t.Fatal("ftp URL previewed")
+	}
+
+	start := time.Now()
+	fast := New(Config{AllowPrivate: true, Timeout: 100 * time.Millisecond})
+	if _, err := fast.Preview(ctx, srv.URL+"/slow"); err == nil {
+		t.Fatal("slow page previewed")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("timeout not enforced, took %v", elapsed)
+	}
+}
+
+func TestPreviewBlocksPrivateAddresses(t *testing.T) {
+	srv := newServer(t)
+	f := New(Config{Timeout: time.Second})
+
+	for _, u := range []string{
+		srv.URL + "/pr/1",
+		strings.Replace(srv.URL, "127.0.0.1", "localhost", 1) + "/pr/1",
+		"http://[::1]:1/",
+		"http://10.0.0.1:1/",
+		"http://169.254.169.254/latest/meta-data/",
+	} {
+		if _, err := f.Preview(context.Background(), u); !errors.Is(err, ErrBlockedAddress) {
+			t.Errorf("Preview(%s): err = %v, want ErrBlockedAddress", u, err)
+		}
+	}
+}
+
+func TestBlocked(t *testing.T) {
+	for addr, want := range map[string]bool{
+		"127.0.0.1":        true,
+		"10.1.2.3":         true,
+		"172.16.0.1":       true,
+		"192.168.1.1":      true,
+		"169.254.169.254":  true,
+		"100.64.0.1":       true,
+		"0.0.0.0":          true,
+		"224.0.0.1":        true,
+		"255.255.255.255":  true,
+		"::1":              true,
+		"fe80::1":          true,
+		"fd00::1":          true,
+		"::ffff:127.0.0.1": true,
+		"64:ff9b::a00:1":   true,
+		"93.184.216.34":    false,
+		"2606:4700::1111":  false,
+	} {
+		if got := blocked(netip.MustParseAddr(addr)); got != want {
+			t.Errorf("blocked(%s) = %v, want %v", addr, got, want)
+		}
+	}
+}
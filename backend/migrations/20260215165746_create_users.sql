@@ -11,12 +11,6 @@ CREATE TABLE users (
     created_at    TIMESTAMPTZ DEFAULT NOW(),
     updated_at    TIMESTAMPTZ DEFAULT NOW()
 );
--- +goose StatementBegin
-SELECT 'up SQL query';
--- +goose StatementEnd
 
 -- +goose Down
 DROP TABLE users;
--- +goose StatementBegin
-SELECT 'down SQL query';
--- +goose StatementEnd
@@ -12,12 +12,6 @@ CREATE TABLE workspace_invites (
     UNIQUE(workspace_id, email)
 );
 CREATE INDEX idx_workspace_invites_token ON workspace_invites(token);
--- +goose StatementBegin
-SELECT 'up SQL query';
--- +goose StatementEnd
 
 -- +goose Down
 DROP TABLE workspace_invites;
--- +goose StatementBegin
-SELECT 'down SQL query';
--- +goose StatementEnd
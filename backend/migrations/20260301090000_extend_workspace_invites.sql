@@ -0,0 +1,26 @@
+-- +goose Up
+ALTER TABLE workspace_invites ALTER COLUMN email DROP NOT NULL;
+
+ALTER TABLE workspace_invites
+    ADD COLUMN type      VARCHAR(20) NOT NULL DEFAULT 'email',
+    ADD COLUMN role      VARCHAR(20) NOT NULL DEFAULT 'member',
+    ADD COLUMN max_uses  INT,
+    ADD COLUMN use_count INT NOT NULL DEFAULT 0,
+    ADD CHECK (type IN ('email', 'link')),
+    ADD CHECK (type = 'link' OR email IS NOT NULL),
+    ADD CHECK (max_uses IS NULL OR max_uses > 0);
+
+-- Email invites are always single-use
+UPDATE workspace_invites SET max_uses = 1;
+UPDATE workspace_invites SET use_count = 1 WHERE accepted_at IS NOT NULL;
+
+-- +goose Down
+DELETE FROM workspace_invites WHERE type = 'link';
+
+ALTER TABLE workspace_invites
+    DROP COLUMN use_count,
+    DROP COLUMN max_uses,
+    DROP COLUMN role,
+    DROP COLUMN type;
+
+ALTER TABLE workspace_invites ALTER COLUMN email SET NOT NULL;
@@ -0,0 +1,28 @@
+-- +goose Up
+ALTER TABLE workspaces ADD COLUMN join_requires_approval BOOLEAN NOT NULL DEFAULT false;
+
+CREATE TABLE workspace_allowed_domains (
+    workspace_id UUID NOT NULL REFERENCES workspaces(id) ON DELETE CASCADE,
+    domain       VARCHAR(255) NOT NULL,
+    created_at   TIMESTAMPTZ DEFAULT NOW(),
+    PRIMARY KEY (workspace_id, domain)
+);
+CREATE INDEX idx_workspace_allowed_domains_domain ON workspace_allowed_domains(domain);
+
+CREATE TABLE workspace_join_requests (
+    id           UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    workspace_id UUID NOT NULL REFERENCES workspaces(id) ON DELETE CASCADE,
+    user_id      UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    status       VARCHAR(20) NOT NULL DEFAULT 'pending',
+    created_at   TIMESTAMPTZ DEFAULT NOW(),
+    decided_by   UUID REFERENCES users(id),
+    decided_at   TIMESTAMPTZ,
+    CHECK (status IN ('pending', 'approved', 'rejected'))
+);
+CREATE UNIQUE INDEX idx_workspace_join_requests_pending
+    ON workspace_join_requests(workspace_id, user_id) WHERE status = 'pending';
+
+-- +goose Down
+DROP TABLE workspace_join_requests;
+DROP TABLE workspace_allowed_domains;
+ALTER TABLE workspaces DROP COLUMN join_requires_approval;
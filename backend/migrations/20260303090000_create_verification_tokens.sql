@@ -0,0 +1,25 @@
+-- +goose Up
+ALTER TABLE users
+    ADD COLUMN email_verified_at TIMESTAMPTZ,
+    ADD COLUMN token_version     INT NOT NULL DEFAULT 0;
+
+-- Accounts created before verification existed are treated as verified
+UPDATE users SET email_verified_at = created_at;
+
+CREATE TABLE verification_tokens (
+    id         UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id    UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    purpose    VARCHAR(30) NOT NULL,
+    token_hash VARCHAR(64) UNIQUE NOT NULL,
+    expires_at TIMESTAMPTZ NOT NULL,
+    used_at    TIMESTAMPTZ,
+    created_at TIMESTAMPTZ DEFAULT NOW(),
+    CHECK (purpose IN ('verify_email', 'reset_password'))
+);
+CREATE INDEX idx_verification_tokens_user ON verification_tokens(user_id, purpose);
+
+-- +goose Down
+DROP TABLE verification_tokens;
+ALTER TABLE users
+    DROP COLUMN token_version,
+    DROP COLUMN email_verified_at;
@@ -0,0 +1,28 @@
+-- +goose Up
+ALTER TABLE users ADD COLUMN two_factor_enabled BOOLEAN NOT NULL DEFAULT false;
+ALTER TABLE workspaces ADD COLUMN require_two_factor BOOLEAN NOT NULL DEFAULT false;
+
+-- The secret is stored AES-GCM encrypted; confirmed_at is NULL until the
+-- user proves their authenticator works
+CREATE TABLE user_totp (
+    user_id        UUID PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    secret         BYTEA NOT NULL,
+    confirmed_at   TIMESTAMPTZ,
+    last_used_step BIGINT NOT NULL DEFAULT 0,
+    created_at     TIMESTAMPTZ DEFAULT NOW()
+);
+
+CREATE TABLE user_recovery_codes (
+    id         UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id    UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    code_hash  VARCHAR(64) NOT NULL,
+    used_at    TIMESTAMPTZ,
+    created_at TIMESTAMPTZ DEFAULT NOW(),
+    UNIQUE (user_id, code_hash)
+);
+
+-- +goose Down
+DROP TABLE user_recovery_codes;
+DROP TABLE user_totp;
+ALTER TABLE workspaces DROP COLUMN require_two_factor;
+ALTER TABLE users DROP COLUMN two_factor_enabled;
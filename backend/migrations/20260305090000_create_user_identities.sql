@@ -0,0 +1,29 @@
+-- +goose Up
+ALTER TABLE workspaces ADD COLUMN require_sso BOOLEAN NOT NULL DEFAULT false;
+
+-- External (OIDC) identities linked to Pulse accounts
+CREATE TABLE user_identities (
+    id            UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id       UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    issuer        VARCHAR(255) NOT NULL,
+    subject       VARCHAR(255) NOT NULL,
+    email         VARCHAR(255) NOT NULL,
+    created_at    TIMESTAMPTZ DEFAULT NOW(),
+    last_login_at TIMESTAMPTZ,
+    UNIQUE (issuer, subject)
+);
+CREATE INDEX idx_user_identities_user ON user_identities(user_id);
+
+-- In-flight authorization requests; the state is stored hashed
+CREATE TABLE oidc_login_states (
+    state_hash    VARCHAR(64) PRIMARY KEY,
+    code_verifier VARCHAR(128) NOT NULL,
+    nonce         VARCHAR(64) NOT NULL,
+    expires_at    TIMESTAMPTZ NOT NULL,
+    created_at    TIMESTAMPTZ DEFAULT NOW()
+);
+
+-- +goose Down
+DROP TABLE oidc_login_states;
+DROP TABLE user_identities;
+ALTER TABLE workspaces DROP COLUMN require_sso;
@@ -0,0 +1,17 @@
+-- +goose Up
+-- Link previews unfurled from URLs in message content, in the order the
+-- links appear
+CREATE TABLE message_embeds (
+    message_id  UUID NOT NULL REFERENCES messages(id) ON DELETE CASCADE,
+    position    INT NOT NULL,
+    url         TEXT NOT NULL,
+    title       TEXT NOT NULL DEFAULT '',
+    description TEXT NOT NULL DEFAULT '',
+    image_url   TEXT NOT NULL DEFAULT '',
+    site_name   TEXT NOT NULL DEFAULT '',
+    created_at  TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (message_id, url)
+);
+
+-- +goose Down
+DROP TABLE message_embeds;
@@ -0,0 +1,23 @@
+-- +goose Up
+CREATE TABLE pinned_messages (
+    message_id UUID PRIMARY KEY REFERENCES messages(id) ON DELETE CASCADE,
+    channel_id UUID NOT NULL REFERENCES channels(id) ON DELETE CASCADE,
+    pinned_by  UUID NOT NULL REFERENCES users(id),
+    pinned_at  TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+CREATE INDEX idx_pinned_messages_channel ON pinned_messages(channel_id, pinned_at DESC);
+
+-- Titled links shown in the channel header
+CREATE TABLE channel_bookmarks (
+    id         UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    channel_id UUID NOT NULL REFERENCES channels(id) ON DELETE CASCADE,
+    title      VARCHAR(100) NOT NULL,
+    url        TEXT NOT NULL,
+    created_by UUID NOT NULL REFERENCES users(id),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+CREATE INDEX idx_channel_bookmarks_channel ON channel_bookmarks(channel_id, created_at);
+
+-- +goose Down
+DROP TABLE channel_bookmarks;
+DROP TABLE pinned_messages;
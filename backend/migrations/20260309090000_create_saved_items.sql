@@ -0,0 +1,19 @@
+-- +goose Up
+-- Messages a user saved for later, optionally with a reminder
+CREATE TABLE saved_items (
+    id            UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id       UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    message_id    UUID REFERENCES messages(id) ON DELETE CASCADE,
+    dm_message_id UUID REFERENCES dm_messages(id) ON DELETE CASCADE,
+    remind_at     TIMESTAMPTZ,
+    reminded_at   TIMESTAMPTZ,
+    created_at    TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    CHECK ((message_id IS NULL) <> (dm_message_id IS NULL)),
+    UNIQUE (user_id, message_id),
+    UNIQUE (user_id, dm_message_id)
+);
+CREATE INDEX idx_saved_items_user ON saved_items(user_id, created_at DESC);
+CREATE INDEX idx_saved_items_due ON saved_items(remind_at) WHERE reminded_at IS NULL;
+
+-- +goose Down
+DROP TABLE saved_items;
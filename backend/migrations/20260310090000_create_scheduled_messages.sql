@@ -0,0 +1,22 @@
+-- +goose Up
+-- Channel messages and DMs queued to be sent later
+CREATE TABLE scheduled_messages (
+    id              UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id         UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    channel_id      UUID REFERENCES channels(id) ON DELETE CASCADE,
+    conversation_id UUID REFERENCES dm_conversations(id) ON DELETE CASCADE,
+    parent_id       UUID REFERENCES messages(id) ON DELETE SET NULL,
+    content         TEXT NOT NULL,
+    send_at         TIMESTAMPTZ NOT NULL,
+    -- Set when delivery failed for good, e.g. the sender lost access
+    failed_at       TIMESTAMPTZ,
+    error           TEXT,
+    created_at      TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at      TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    CHECK ((channel_id IS NULL) <> (conversation_id IS NULL))
+);
+CREATE INDEX idx_scheduled_messages_user ON scheduled_messages(user_id, send_at);
+CREATE INDEX idx_scheduled_messages_due ON scheduled_messages(send_at) WHERE failed_at IS NULL;
+
+-- +goose Down
+DROP TABLE scheduled_messages;
@@ -0,0 +1,37 @@
+-- +goose Up
+ALTER TABLE channels
+    ADD COLUMN topic             VARCHAR(250),
+    ADD COLUMN posting_policy    VARCHAR(20) NOT NULL DEFAULT 'everyone'
+        CHECK (posting_policy IN ('everyone', 'admins')),
+    ADD COLUMN slow_mode_seconds INT NOT NULL DEFAULT 0
+        CHECK (slow_mode_seconds BETWEEN 0 AND 21600);
+
+ALTER TABLE channel_members
+    ADD CONSTRAINT channel_members_role_check CHECK (role IN ('admin', 'member'));
+
+CREATE TABLE channel_topic_changes (
+    id         UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    channel_id UUID NOT NULL REFERENCES channels(id) ON DELETE CASCADE,
+    topic      VARCHAR(250),
+    changed_by UUID NOT NULL REFERENCES users(id),
+    changed_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+CREATE INDEX idx_channel_topic_changes_channel ON channel_topic_changes(channel_id, changed_at DESC);
+
+-- Last post per user in each channel, for slow mode. Public channels can be
+-- posted to without joining, so this can't live on channel_members.
+CREATE TABLE channel_post_times (
+    channel_id UUID NOT NULL REFERENCES channels(id) ON DELETE CASCADE,
+    user_id    UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    posted_at  TIMESTAMPTZ NOT NULL,
+    PRIMARY KEY (channel_id, user_id)
+);
+
+-- +goose Down
+DROP TABLE channel_post_times;
+DROP TABLE channel_topic_changes;
+ALTER TABLE channel_members DROP CONSTRAINT channel_members_role_check;
+ALTER TABLE channels
+    DROP COLUMN slow_mode_seconds,
+    DROP COLUMN posting_policy,
+    DROP COLUMN topic;
@@ -0,0 +1,6 @@
+-- +goose Up
+-- Channels with no messages for this many days are archived; NULL = never
+ALTER TABLE workspaces ADD COLUMN auto_archive_days INT CHECK (auto_archive_days > 0);
+
+-- +goose Down
+ALTER TABLE workspaces DROP COLUMN auto_archive_days;
@@ -0,0 +1,8 @@
+-- +goose Up
+-- Deleted workspaces are kept for a restore window before they're purged
+ALTER TABLE workspaces ADD COLUMN deleted_at TIMESTAMPTZ;
+CREATE INDEX idx_workspaces_deleted_at ON workspaces (deleted_at) WHERE deleted_at IS NOT NULL;
+
+-- +goose Down
+DROP INDEX idx_workspaces_deleted_at;
+ALTER TABLE workspaces DROP COLUMN deleted_at;
@@ -0,0 +1,21 @@
+-- +goose Up
+-- pending_email holds a new address until the link sent to it is opened
+ALTER TABLE users
+    ADD COLUMN pending_email VARCHAR(255),
+    ADD COLUMN deleted_at    TIMESTAMPTZ;
+
+ALTER TABLE verification_tokens
+    DROP CONSTRAINT verification_tokens_purpose_check,
+    ADD CONSTRAINT verification_tokens_purpose_check
+        CHECK (purpose IN ('verify_email', 'reset_password', 'change_email'));
+
+-- +goose Down
+DELETE FROM verification_tokens WHERE purpose = 'change_email';
+ALTER TABLE verification_tokens
+    DROP CONSTRAINT verification_tokens_purpose_check,
+    ADD CONSTRAINT verification_tokens_purpose_check
+        CHECK (purpose IN ('verify_email', 'reset_password'));
+
+ALTER TABLE users
+    DROP COLUMN deleted_at,
+    DROP COLUMN pending_email;
@@ -0,0 +1,12 @@
+-- +goose Up
+-- Profile fields a member sets for each workspace they're in
+ALTER TABLE workspace_members
+    ADD COLUMN title    VARCHAR(100),
+    ADD COLUMN timezone VARCHAR(64),
+    ADD COLUMN pronouns VARCHAR(40);
+
+-- +goose Down
+ALTER TABLE workspace_members
+    DROP COLUMN pronouns,
+    DROP COLUMN timezone,
+    DROP COLUMN title;
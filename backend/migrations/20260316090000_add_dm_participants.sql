@@ -0,0 +1,14 @@
+-- +goose Up
+-- Each participant's own view of a DM conversation
+CREATE TABLE dm_participants (
+    conversation_id UUID NOT NULL REFERENCES dm_conversations(id) ON DELETE CASCADE,
+    user_id         UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    last_read_at    TIMESTAMPTZ,
+    -- Closed until a message arrives after this
+    hidden_at       TIMESTAMPTZ,
+    muted           BOOLEAN NOT NULL DEFAULT FALSE,
+    PRIMARY KEY (conversation_id, user_id)
+);
+
+-- +goose Down
+DROP TABLE dm_participants;
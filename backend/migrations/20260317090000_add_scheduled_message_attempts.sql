@@ -0,0 +1,6 @@
+-- +goose Up
+-- Failed delivery attempts since the message was last edited
+ALTER TABLE scheduled_messages ADD COLUMN attempts INT NOT NULL DEFAULT 0;
+
+-- +goose Down
+ALTER TABLE scheduled_messages DROP COLUMN attempts;
@@ -0,0 +1,6 @@
+-- +goose Up
+-- Unarchiving counts as activity, so auto-archive doesn't undo it right away
+ALTER TABLE channels ADD COLUMN unarchived_at TIMESTAMPTZ;
+
+-- +goose Down
+ALTER TABLE channels DROP COLUMN unarchived_at;
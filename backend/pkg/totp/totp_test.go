@@ -0,0 +1,107 @@
+package totp
+
+import (
+	"encoding/base32"
+	"testing"
+	"time"
+)
+
+// The SHA-1 seed from RFC 6238 Appendix B
+var rfcSecret = base32.StdEncoding.EncodeToString([]byte("12345678901234567890"))
+
+func TestCodeRFC6238(t *testing.T) {
+	// Appendix B lists 8-digit codes; 6-digit codes are their last six digits
+	for _, tc := range []struct {
+		unix int64
+		code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	} {
+		got, err := Code(rfcSecret, time.Unix(tc.unix, 0))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tc.code {
+			t.Errorf("Code at %d = %s, want %s", tc.unix, got, tc.code)
+		}
+		if _, ok := Validate(rfcSecret, tc.code, time.Unix(tc.unix, 0), 0); !ok {
+			t.Errorf("Validate rejected the code at %d", tc.unix)
+		}
+	}
+}
+
+func TestValidateSkew(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	for _, tc := range []struct {
+		offset time.Duration
+		skew   int
+		ok     bool
+	}{
+		{0, 0, true},
+		{-Period * time.Second, 0, false},
+		{-Period * time.Second, 1, true},
+		{Period * time.Second, 1, true},
+		{-2 * Period * time.Second, 1, false},
+		{2 * Period * time.Second, 1, false},
+	} {
+		code, err := Code(rfcSecret, now.Add(tc.offset))
+		if err != nil {
+			t.Fatal(err)
+		}
+		step, ok := Validate(rfcSecret, code, now, tc.skew)
+		if ok != tc.ok {
+			t.Errorf("code from %v with skew %d: ok = %v, want %v", tc.offset, tc.skew, ok, tc.ok)
+		}
+		if ok && step != Step(now.Add(tc.offset)) {
+			t.Errorf("code from %v matched step %d, want %d", tc.offset, step, Step(now.Add(tc.offset)))
+		}
+	}
+}
+
+// Validate is stateless, so replays are rejected by callers remembering the
+// last step used. That only works if a code always maps to the step it was
+// generated for, wherever the check falls in the window.
+func TestValidateReplay(t *testing.T) {
+	issued := time.Unix(1234567890, 0)
+	code, err := Code(rfcSecret, issued)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var lastUsed int64
+	use := func(at time.Time) bool {
+		step, ok := Validate(rfcSecret, code, at, 1)
+		if !ok || step <= lastUsed {
+			return false
+		}
+		lastUsed = step
+		return true
+	}
+	if !use(issued) {
+		t.Fatal("first use rejected")
+	}
+	if use(issued) {
+		t.Fatal("replay in the same step accepted")
+	}
+	if use(issued.Add(Period * time.Second)) {
+		t.Fatal("replay in the next step accepted")
+	}
+}
+
+func TestValidateMalformed(t *testing.T) {
+	now := time.Unix(59, 0)
+	for _, tc := range []struct{ secret, code string }{
+		{rfcSecret, "28708"},
+		{rfcSecret, "94287082"},
+		{"not base32!", "287082"},
+	} {
+		if _, ok := Validate(tc.secret, tc.code, now, 1); ok {
+			t.Errorf("Validate(%q, %q) accepted", tc.secret, tc.code)
+		}
+	}
+}
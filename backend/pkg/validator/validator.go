@@ -3,9 +3,12 @@ package validator
 import (
 	"fmt"
 	"net/mail"
+	"net/url"
 	"regexp"
 	"strings"
+	"time"
 	"unicode"
+	"unicode/utf8"
 )
 
 type ValidationErrors map[string]string
@@ -20,6 +23,16 @@ func (v ValidationErrors) Add(field, message string) {
 
 var usernameRegex = regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)
 var slugRegex = regexp.MustCompile(`^[a-z0-9-]+$`)
+var domainRegex = regexp.MustCompile(`^([a-z0-9]([a-z0-9-]*[a-z0-9])?\.)+[a-z]{2,}$`)
+
+// Free email providers can't be used for domain-based joining,
+// otherwise anyone could join the workspace.
+var publicEmailDomains = map[string]bool{
+	"gmail.com": true, "googlemail.com": true, "outlook.com": true, "hotmail.com": true,
+	"live.com": true, "yahoo.com": true, "icloud.com": true, "me.com": true,
+	"aol.com": true, "proton.me": true, "protonmail.com": true, "gmx.com": true,
+	"mail.com": true, "yandex.com": true, "zoho.com": true,
+}
 
 func ValidateRegister(email, username, displayName, password string) ValidationErrors {
 	errs := make(ValidationErrors)
@@ -32,30 +45,34 @@ func ValidateRegister(email, username, displayName, password string) ValidationE
 		errs.Add("email", "Invalid email address")
 	}
 
-	// Username
-	username = strings.TrimSpace(username)
-	if username == "" {
-		errs.Add("username", "Username is required")
-	} else if len(username) < 3 {
-		errs.Add("username", "Username must be at least 3 characters")
-	} else if len(username) > 50 {
-		errs.Add("username", "Username is too long")
-	} else if !usernameRegex.MatchString(username) {
-		errs.Add("username", "Username can only contain letters, numbers, _ and -")
-	}
+	validateUsername(username, errs)
+	validateDisplayName(displayName, errs)
+	validatePassword("password", password, errs)
 
-	// Display name
-	displayName = strings.TrimSpace(displayName)
-	if displayName == "" {
-		errs.Add("display_name", "Display name is required")
-	} else if len(displayName) < 2 {
-		errs.Add("display_name", "Display name must be at least 2 characters")
-	} else if len(displayName) > 100 {
-		errs.Add("display_name", "Display name is too long")
+	return errs
+}
+
+// ValidateProfileUpdate checks the fields set in a profile update.
+func ValidateProfileUpdate(username, displayName *string) ValidationErrors {
+	errs := make(ValidationErrors)
+
+	if username != nil {
+		validateUsername(*username, errs)
+	}
+	if displayName != nil {
+		validateDisplayName(*displayName, errs)
 	}
 
-	// Password
-	validatePassword(password, errs)
+	return errs
+}
+
+func ValidatePasswordChange(currentPassword, newPassword string) ValidationErrors {
+	errs := make(ValidationErrors)
+
+	if currentPassword == "" {
+		errs.Add("current_password", "Current password is required")
+	}
+	validatePassword("new_password", newPassword, errs)
 
 	return errs
 }
@@ -77,6 +94,63 @@ func ValidateLogin(email, password string) ValidationErrors {
 	return errs
 }
 
+func ValidateEmail(email string) ValidationErrors {
+	errs := make(ValidationErrors)
+
+	email = strings.TrimSpace(email)
+	if email == "" {
+		errs.Add("email", "Email is required")
+	} else if _, err := mail.ParseAddress(email); err != nil {
+		errs.Add("email", "Invalid email address")
+	}
+
+	return errs
+}
+
+func ValidateEmailChange(email, password string) ValidationErrors {
+	errs := ValidateEmail(email)
+
+	if password == "" {
+		errs.Add("password", "Password is required")
+	}
+
+	return errs
+}
+
+func ValidateAccountDeletion(password string) ValidationErrors {
+	errs := make(ValidationErrors)
+
+	if password == "" {
+		errs.Add("password", "Password is required")
+	}
+
+	return errs
+}
+
+func ValidatePasswordReset(token, password string) ValidationErrors {
+	errs := make(ValidationErrors)
+
+	if token == "" {
+		errs.Add("token", "Token is required")
+	}
+	validatePassword("password", password, errs)
+
+	return errs
+}
+
+func ValidateTwoFactorCode(code string) ValidationErrors {
+	errs := make(ValidationErrors)
+
+	code = strings.TrimSpace(code)
+	if code == "" {
+		errs.Add("code", "Code is required")
+	} else if len(code) > 20 {
+		errs.Add("code", "Invalid code")
+	}
+
+	return errs
+}
+
 func ValidateWorkspace(name, slug string) ValidationErrors {
 	errs := make(ValidationErrors)
 
@@ -122,9 +196,187 @@ func ValidateChannel(name, chType string) ValidationErrors {
 	return errs
 }
 
-func validatePassword(password string, errs ValidationErrors) {
+func ValidateInvite(email, role string, maxUses *int, expiresInHours int) ValidationErrors {
+	errs := make(ValidationErrors)
+
+	email = strings.TrimSpace(email)
+	if email != "" {
+		// The invite is matched against the address users sign up with, so
+		// forms like "Bob <bob@example.com>" aren't accepted
+		if addr, err := mail.ParseAddress(email); err != nil || addr.Address != email {
+			errs.Add("email", "Invalid email address")
+		} else if maxUses != nil {
+			errs.Add("max_uses", "Email invites are single-use")
+		}
+	}
+
+	if role != "" && role != "member" && role != "admin" {
+		errs.Add("role", "Role must be member or admin")
+	}
+
+	if maxUses != nil && (*maxUses < 1 || *maxUses > 10000) {
+		errs.Add("max_uses", "Max uses must be between 1 and 10000")
+	}
+
+	// Up to 30 days
+	if expiresInHours < 0 || expiresInHours > 720 {
+		errs.Add("expires_in_hours", "Expiry must be between 1 and 720 hours")
+	}
+
+	return errs
+}
+
+func ValidateJoinPolicy(domains []string) ValidationErrors {
+	errs := make(ValidationErrors)
+
+	if len(domains) > 20 {
+		errs.Add("allowed_domains", "At most 20 domains are allowed")
+		return errs
+	}
+
+	for _, d := range domains {
+		d = strings.TrimPrefix(strings.ToLower(strings.TrimSpace(d)), "@")
+		if !domainRegex.MatchString(d) || len(d) > 255 {
+			errs.Add("allowed_domains", fmt.Sprintf("Invalid domain: %s", d))
+			return errs
+		}
+		if publicEmailDomains[d] {
+			errs.Add("allowed_domains", fmt.Sprintf("Public email domains can't be used: %s", d))
+			return errs
+		}
+	}
+
+	return errs
+}
+
+func ValidateBookmark(title, rawURL string) ValidationErrors {
+	errs := make(ValidationErrors)
+
+	title = strings.TrimSpace(title)
+	if title == "" {
+		errs.Add("title", "Title is required")
+	} else if utf8.RuneCountInString(title) > 100 {
+		errs.Add("title", "Title is too long")
+	}
+
+	rawURL = strings.TrimSpace(rawURL)
+	if rawURL == "" {
+		errs.Add("url", "URL is required")
+	} else if len(rawURL) > 2048 {
+		errs.Add("url", "URL is too long")
+	} else if u, err := url.Parse(rawURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		errs.Add("url", "URL must be an http or https link")
+	}
+
+	return errs
+}
+
+// ValidateWorkspaceUpdate checks the settings in a workspace update.
+func ValidateWorkspaceUpdate(autoArchiveDays *int) ValidationErrors {
+	errs := make(ValidationErrors)
+
+	if autoArchiveDays != nil && (*autoArchiveDays < 0 || *autoArchiveDays > 3650) {
+		errs.Add("auto_archive_days", "Auto-archive must be between 0 (off) and 3650 days")
+	}
+
+	return errs
+}
+
+// ValidateChannelUpdate checks the posting rules in a channel update.
+func ValidateChannelUpdate(postingPolicy *string, slowModeSeconds *int) ValidationErrors {
+	errs := make(ValidationErrors)
+
+	if postingPolicy != nil && *postingPolicy != "everyone" && *postingPolicy != "admins" {
+		errs.Add("posting_policy", "Posting policy must be everyone or admins")
+	}
+	if slowModeSeconds != nil && (*slowModeSeconds < 0 || *slowModeSeconds > 21600) {
+		errs.Add("slow_mode_seconds", "Slow mode must be between 0 and 21600 seconds")
+	}
+
+	return errs
+}
+
+func ValidateChannelTopic(topic string) ValidationErrors {
+	errs := make(ValidationErrors)
+
+	if utf8.RuneCountInString(strings.TrimSpace(topic)) > 250 {
+		errs.Add("topic", "Topic is too long")
+	} else if strings.ContainsFunc(topic, unicode.IsControl) {
+		errs.Add("topic", "Topic can't contain control characters")
+	}
+
+	return errs
+}
+
+// ValidateMemberProfile checks the fields set in a workspace member profile
+// update. Empty values clear a field.
+func ValidateMemberProfile(title, timezone, pronouns *string) ValidationErrors {
+	errs := make(ValidationErrors)
+
+	if title != nil {
+		validateProfileText("title", "Title", *title, 100, errs)
+	}
+	if timezone != nil {
+		if tz := strings.TrimSpace(*timezone); tz != "" {
+			// LoadLocation also accepts "Local" and "UTC", but only IANA names mean the same to every client
+			if _, err := time.LoadLocation(tz); err != nil || tz == "Local" {
+				errs.Add("timezone", "Timezone must be an IANA name such as Europe/Zagreb")
+			}
+		}
+	}
+	if pronouns != nil {
+		validateProfileText("pronouns", "Pronouns", *pronouns, 40, errs)
+	}
+
+	return errs
+}
+
+// ValidateMemberRole checks a role used to filter workspace members.
+func ValidateMemberRole(role string) ValidationErrors {
+	errs := make(ValidationErrors)
+
+	if role != "" && role != "owner" && role != "admin" && role != "member" {
+		errs.Add("role", "Role must be owner, admin or member")
+	}
+
+	return errs
+}
+
+func validateProfileText(field, label, value string, maxLen int, errs ValidationErrors) {
+	if utf8.RuneCountInString(strings.TrimSpace(value)) > maxLen {
+		errs.Add(field, label+" is too long")
+	} else if strings.ContainsFunc(value, unicode.IsControl) {
+		errs.Add(field, label+" can't contain control characters")
+	}
+}
+
+func validateUsername(username string, errs ValidationErrors) {
+	username = strings.TrimSpace(username)
+	if username == "" {
+		errs.Add("username", "Username is required")
+	} else if len(username) < 3 {
+		errs.Add("username", "Username must be at least 3 characters")
+	} else if len(username) > 50 {
+		errs.Add("username", "Username is too long")
+	} else if !usernameRegex.MatchString(username) {
+		errs.Add("username", "Username can only contain letters, numbers, _ and -")
+	}
+}
+
+func validateDisplayName(displayName string, errs ValidationErrors) {
+	displayName = strings.TrimSpace(displayName)
+	if displayName == "" {
+		errs.Add("display_name", "Display name is required")
+	} else if len(displayName) < 2 {
+		errs.Add("display_name", "Display name must be at least 2 characters")
+	} else if len(displayName) > 100 {
+		errs.Add("display_name", "Display name is too long")
+	}
+}
+
+func validatePassword(field, password string, errs ValidationErrors) {
 	if len(password) < 8 {
-		errs.Add("password", "Password must be at least 8 characters")
+		errs.Add(field, "Password must be at least 8 characters")
 		return
 	}
 
@@ -152,6 +404,6 @@ func validatePassword(password string, errs ValidationErrors) {
 	}
 
 	if len(missing) > 0 {
-		errs.Add("password", fmt.Sprintf("Password must contain at least %s", strings.Join(missing, ", ")))
+		errs.Add(field, fmt.Sprintf("Password must contain at least %s", strings.Join(missing, ", ")))
 	}
 }
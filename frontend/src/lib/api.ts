@@ -33,6 +33,26 @@ async function request<T>(
   return res.json();
 }
 
+// Fetches every page of a list endpoint, following next_cursor until the
+// last page
+async function listAll<K extends string, T>(
+  endpoint: string,
+  key: K
+): Promise<T[]> {
+  const items: T[] = [];
+  let after: string | undefined;
+  do {
+    const params = new URLSearchParams({ limit: "100" });
+    if (after) params.set("after", after);
+    const page = await request<Record<K, T[]> & PageCursors>(
+      `${endpoint}?${params}`
+    );
+    items.push(...page[key]);
+    after = page.next_cursor;
+  } while (after);
+  return items;
+}
+
 // Types
 
 export interface User {
@@ -81,7 +101,13 @@ export interface Message {
   sender_display_name: string;
 }
 
-export interface MessageListResponse {
+// Cursors for the neighbouring pages of a list, absent at either end
+export interface PageCursors {
+  prev_cursor?: string;
+  next_cursor?: string;
+}
+
+export interface MessageListResponse extends PageCursors {
   messages: Message[];
   has_more: boolean;
 }
@@ -94,6 +120,18 @@ export interface DMConversation {
   other_user_id: string;
   other_username: string;
   other_display_name: string;
+  other_status: string;
+  last_message?: DMMessagePreview;
+  last_activity_at: string;
+  unread_count: number;
+  muted: boolean;
+}
+
+export interface DMMessagePreview {
+  id: string;
+  sender_id: string;
+  content: string;
+  created_at: string;
 }
 
 export interface DMMessage {
@@ -107,7 +145,7 @@ export interface DMMessage {
   sender_display_name: string;
 }
 
-export interface DMMessageListResponse {
+export interface DMMessageListResponse extends PageCursors {
   messages: DMMessage[];
   has_more: boolean;
 }
@@ -208,12 +246,18 @@ export const api = {
   },
 
   listWorkspaceMembers(workspaceId: string) {
-    return request<WorkspaceMember[]>(`/workspaces/${workspaceId}/members`);
+    return listAll<"members", WorkspaceMember>(
+      `/workspaces/${workspaceId}/members`,
+      "members"
+    );
   },
 
   // Channels
   listChannels(workspaceId: string) {
-    return request<Channel[]>(`/workspaces/${workspaceId}/channels`);
+    return listAll<"channels", Channel>(
+      `/workspaces/${workspaceId}/channels`,
+      "channels"
+    );
   },
 
   createChannel(
@@ -231,6 +275,7 @@ export const api = {
   },
 
   // Messages
+  // before is a prev_cursor from an earlier page
   listMessages(channelId: string, before?: string, limit = 50) {
     const params = new URLSearchParams({ limit: String(limit) });
     if (before) params.set("before", before);
@@ -266,7 +311,10 @@ export const api = {
   },
 
   listInvites(workspaceId: string) {
-    return request<WorkspaceInvite[]>(`/workspaces/${workspaceId}/invites`);
+    return listAll<"invites", WorkspaceInvite>(
+      `/workspaces/${workspaceId}/invites`,
+      "invites"
+    );
   },
 
   revokeInvite(workspaceId: string, inviteId: string) {
@@ -294,7 +342,10 @@ export const api = {
   },
 
   listDMConversations() {
-    return request<DMConversation[]>("/dm/conversations");
+    return listAll<"conversations", DMConversation>(
+      "/dm/conversations",
+      "conversations"
+    );
   },
 
   listDMMessages(conversationId: string, before?: string, limit = 50) {
@@ -323,6 +374,20 @@ export const api = {
     return request<void>(`/dm/messages/${messageId}`, { method: "DELETE" });
   },
 
+  hideDMConversation(conversationId: string) {
+    return request<void>(`/dm/conversations/${conversationId}/hide`, { method: "POST" });
+  },
+
+  setDMConversationMuted(conversationId: string, muted: boolean) {
+    return request<void>(`/dm/conversations/${conversationId}/mute`, {
+      method: muted ? "POST" : "DELETE",
+    });
+  },
+
+  markDMConversationRead(conversationId: string) {
+    return request<void>(`/dm/conversations/${conversationId}/read`, { method: "POST" });
+  },
+
   // Pulsemates
   sendPulsemateRequest(username: string) {
     return request<PulsemateRequest | { status: string }>("/pulsemates/requests", {
@@ -332,7 +397,7 @@ export const api = {
   },
 
   listPulsemates() {
-    return request<Pulsemate[]>("/pulsemates");
+    return listAll<"pulsemates", Pulsemate>("/pulsemates", "pulsemates");
   },
 
   listIncomingRequests() {